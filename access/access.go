@@ -0,0 +1,201 @@
+// Package access authenticates and rate limits requests to a parsing
+// service, so it can be exposed beyond localhost. Clients authenticate
+// with a static bearer token or a client certificate (mutual TLS), and
+// each client is limited to a steady request rate with bursts.
+package access
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config selects how requests are checked. The zero Config lets every
+// request through.
+type Config struct {
+	// Tokens lists the bearer tokens clients may present. Empty means
+	// tokens are not checked.
+	Tokens []string `json:"tokens,omitempty"`
+
+	// RequireClientCert rejects requests without a verified client
+	// certificate. The server's TLS config must verify certificates; see
+	// TLSConfig.
+	RequireClientCert bool `json:"require_client_cert,omitempty"`
+
+	// RateLimit is the sustained number of requests per second each
+	// client may make. Zero means no limit.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+
+	// Burst is how many requests a client may make at once above the
+	// sustained rate. It is at least 1 when RateLimit is set.
+	Burst int `json:"burst,omitempty"`
+}
+
+// LoadConfig reads a Config from a JSON file
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.RateLimit < 0 || cfg.Burst < 0 {
+		return cfg, fmt.Errorf("%s: rate_limit and burst must not be negative", path)
+	}
+	return cfg, nil
+}
+
+// TLSConfig returns a server TLS config presenting the given certificate.
+// If clientCAFile is set, clients must present a certificate signed by
+// one of the CAs in it.
+func TLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// Middleware checks every request against cfg before passing it to next.
+// Unauthenticated requests get 401 Unauthorized and clients over their
+// rate get 429 Too Many Requests with a Retry-After header.
+func Middleware(cfg Config, next http.Handler) http.Handler {
+	limiter := newLimiter(cfg.RateLimit, cfg.Burst, time.Now)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, ok := authenticate(cfg, r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="qasmparser"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if wait := limiter.reserve(client); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate checks the credentials of r and returns the identity its
+// rate is limited under: the token, the certificate subject or, without
+// either, the remote address
+func authenticate(cfg Config, r *http.Request) (string, bool) {
+	client := ""
+	if cfg.RequireClientCert {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return "", false
+		}
+		client = "cert:" + r.TLS.VerifiedChains[0][0].Subject.String()
+	}
+	if len(cfg.Tokens) > 0 {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !validToken(cfg.Tokens, token) {
+			return "", false
+		}
+		client = "token:" + token
+	}
+	if client == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		client = "addr:" + host
+	}
+	return client, true
+}
+
+// validToken compares token against every allowed token in constant time
+func validToken(tokens []string, token string) bool {
+	valid := 0
+	for _, t := range tokens {
+		valid |= subtle.ConstantTimeCompare([]byte(t), []byte(token))
+	}
+	return valid == 1
+}
+
+// limiter is a token bucket per client. A bucket left idle long enough
+// to refill is no different from a new one, so such buckets are swept
+// away and the map does not grow with every client ever seen.
+type limiter struct {
+	rate    float64
+	burst   float64
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int, now func() time.Time) *limiter {
+	return &limiter{rate: rate, burst: float64(max(burst, 1)), now: now, buckets: make(map[string]*bucket)}
+}
+
+// reserve takes a token from client's bucket and returns zero, or returns
+// how long the client must wait for the next token
+func (l *limiter) reserve(client string) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// sweep removes the buckets that have refilled to the burst, at most
+// once per refill time
+func (l *limiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.swept) < refill {
+		return
+	}
+	l.swept = now
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package access
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	_, _ = w.Write([]byte("ok"))
+})
+
+func serve(h http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/parse", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTokenAuth(t *testing.T) {
+	h := Middleware(Config{Tokens: []string{"alpha", "beta"}}, okHandler)
+	tests := []struct {
+		token string
+		want  int
+	}{
+		{"alpha", http.StatusOK},
+		{"beta", http.StatusOK},
+		{"gamma", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := serve(h, tt.token).Code; got != tt.want {
+			t.Errorf("token %q: status %d, want %d", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestClientCertRequired(t *testing.T) {
+	h := Middleware(Config{RequireClientCert: true}, okHandler)
+	if got := serve(h, "").Code; got != http.StatusUnauthorized {
+		t.Errorf("plain HTTP request: status %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+	h := Middleware(Config{Tokens: []string{"a", "b"}, RateLimit: 0.5, Burst: 2}, okHandler)
+	for i := 0; i < 2; i++ {
+		if got := serve(h, "a").Code; got != http.StatusOK {
+			t.Fatalf("request %d: status %d, want %d", i, got, http.StatusOK)
+		}
+	}
+	rec := serve(h, "a")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request: status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+	if got := serve(h, "b").Code; got != http.StatusOK {
+		t.Errorf("other client: status %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestLimiterRefills(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter(10, 1, func() time.Time { return now })
+	if wait := l.reserve("c"); wait != 0 {
+		t.Fatalf("first reserve waited %v", wait)
+	}
+	if wait := l.reserve("c"); wait != 100*time.Millisecond {
+		t.Errorf("second reserve wait = %v, want 100ms", wait)
+	}
+	now = now.Add(100 * time.Millisecond)
+	if wait := l.reserve("c"); wait != 0 {
+		t.Errorf("reserve after refill waited %v", wait)
+	}
+}
+
+func TestLimiterEvictsIdleBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter(1, 2, func() time.Time { return now })
+	l.reserve("a")
+	now = now.Add(time.Second)
+	l.reserve("b")
+	l.reserve("b")
+	if len(l.buckets) != 2 {
+		t.Fatalf("%d buckets, want 2", len(l.buckets))
+	}
+
+	// Any bucket refills to its burst of 2 within 2s
+	now = now.Add(1500 * time.Millisecond)
+	l.reserve("c")
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("bucket of a refilled but was not evicted")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("bucket of b was evicted before it refilled")
+	}
+
+	// An evicted client starts again with a full bucket
+	for i := 0; i < 2; i++ {
+		if wait := l.reserve("a"); wait != 0 {
+			t.Errorf("reserve %d after eviction waited %v", i, wait)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.json")
+	if err := os.WriteFile(path, []byte(`{"tokens": ["s3cret"], "rate_limit": 5, "burst": 10}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Tokens) != 1 || cfg.Tokens[0] != "s3cret" || cfg.RateLimit != 5 || cfg.Burst != 10 {
+		t.Errorf("LoadConfig() = %+v", cfg)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"rate_limit": -1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("LoadConfig() accepted a negative rate")
+	}
+}
@@ -0,0 +1,282 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/message"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// DefaultAngleTolerance is the precision loss, in radians, above which
+// CheckAngles warns when none is given
+const DefaultAngleTolerance = 1e-6
+
+// quantize returns x as an angle: taken modulo 2π and, for a width N
+// above zero, rounded to the nearest multiple of 2π/2^N
+func quantize(x float64, width int) Value {
+	t := math.Mod(x, 2*math.Pi)
+	if t < 0 {
+		t += 2 * math.Pi
+	}
+	if width > 0 {
+		steps := math.Ldexp(1, width)
+		k := math.Round(t / (2 * math.Pi) * steps)
+		if k == steps {
+			k = 0
+		}
+		t = k * 2 * math.Pi / steps
+	}
+	return Value{Kind: Angle, Float: t, Width: width}
+}
+
+// angleLoss returns how far x moves, modulo 2π, when it is stored as an
+// angle of the given width
+func angleLoss(x float64, width int) float64 {
+	t := math.Mod(x, 2*math.Pi)
+	if t < 0 {
+		t += 2 * math.Pi
+	}
+	d := math.Abs(t - quantize(x, width).Float)
+	return min(d, 2*math.Pi-d)
+}
+
+// angleBits returns the integer whose bits store a sized angle
+func angleBits(v Value) int64 {
+	return int64(math.Round(v.Float / (2 * math.Pi) * math.Ldexp(1, v.Width)))
+}
+
+// angleBinary applies op to two operands of which one is an angle, as
+// the modular arithmetic of angles does: angles add and subtract modulo
+// 2π, scale by integers and divide into an integer ratio. It reports
+// false as handled for operands without an angle and for an angle with
+// a float, which is taken as real.
+func angleBinary(op string, l, r Value) (v Value, ok, handled bool) {
+	switch {
+	case l.Kind != Angle && r.Kind != Angle:
+		return Value{}, false, false
+	case l.Kind == Angle && r.Kind == Angle:
+		width := max(l.Width, r.Width)
+		switch op {
+		case "+":
+			return quantize(l.Float+r.Float, width), true, true
+		case "-":
+			return quantize(l.Float-r.Float, width), true, true
+		case "/":
+			if r.Float == 0 {
+				return Value{}, false, true
+			}
+			return Value{Kind: Int, Int: int64(math.Floor(l.Float / r.Float))}, true, true
+		case "==", "!=", "<", "<=", ">", ">=":
+			return Value{}, false, false
+		}
+		return Value{}, false, true
+	case l.Kind == Angle && r.Kind == Int && (op == "*" || op == "/"):
+		if op == "*" {
+			return quantize(l.Float*float64(r.Int), l.Width), true, true
+		}
+		if r.Int == 0 {
+			return Value{}, false, true
+		}
+		if l.Width > 0 {
+			// Division of the stored integer, rounding down
+			return quantize(float64(angleBits(l)/r.Int)*2*math.Pi/math.Ldexp(1, l.Width), l.Width), true, true
+		}
+		return quantize(l.Float/float64(r.Int), 0), true, true
+	case l.Kind == Int && r.Kind == Angle && op == "*":
+		return quantize(float64(l.Int)*r.Float, r.Width), true, true
+	case l.Kind == Float || r.Kind == Float:
+		return Value{}, false, false
+	}
+	return Value{}, false, true
+}
+
+// castType splits the type a cast converts to, such as angle[8], into
+// the type and its width, 0 if unsized. It reports false for names that
+// are not types.
+func (c Constants) castType(name string) (string, int, bool) {
+	typ, size, sized := strings.Cut(name, "[")
+	switch typ {
+	case "int", "uint", "float", "angle", "bool":
+	case "complex":
+		// Components are evaluated as float[64] whatever their size
+		return typ, 0, true
+	default:
+		return "", 0, false
+	}
+	if !sized {
+		return typ, 0, true
+	}
+	size = strings.TrimSuffix(size, "]")
+	width, err := strconv.Atoi(size)
+	if err != nil {
+		n, ok := c[size]
+		if !ok || n.Kind != Int {
+			return "", 0, true
+		}
+		width = int(n.Int)
+	}
+	if width <= 0 || width > 64 {
+		return "", 0, true
+	}
+	return typ, width, true
+}
+
+// Cast converts v to a value of the classical type typ, as an explicit
+// cast does: typ is int, uint, float, angle, bool, complex or bit, of
+// width bits if above zero. Bits are unsigned integers. It reports false
+// for conversions the language does not allow.
+func Cast(v Value, typ string, width int) (Value, bool) {
+	if typ == "bit" {
+		typ, width = "uint", max(width, 1)
+	}
+	return cast(v, typ, width)
+}
+
+// cast converts v explicitly to typ of the given width. Floats truncate
+// to integers, numbers become angles, and sized angles and integers of
+// the same width reinterpret each other's bits.
+func cast(v Value, typ string, width int) (Value, bool) {
+	switch typ {
+	case "bool":
+		switch v.Kind {
+		case Bool:
+			return v, true
+		case Int:
+			return Value{Kind: Bool, Bool: v.Int != 0}, true
+		case Float, Angle:
+			return Value{Kind: Bool, Bool: v.Float != 0}, true
+		}
+	case "complex":
+		if v.Kind == Complex {
+			return v, true
+		}
+		x, ok := v.number()
+		return Value{Kind: Complex, Float: x}, ok && v.Kind != Angle
+	case "float":
+		if v.Kind == Bool {
+			if v.Bool {
+				return Value{Kind: Float, Float: 1}, true
+			}
+			return Value{Kind: Float}, true
+		}
+		x, ok := v.number()
+		return Value{Kind: Float, Float: x}, ok
+	case "angle":
+		if v.Kind == Int && v.Width > 0 && v.Width == width {
+			return quantize(float64(uint64(v.Int)&(1<<width-1))*2*math.Pi/math.Ldexp(1, width), width), true
+		}
+		if v.Kind == Bool {
+			return Value{}, false
+		}
+		x, ok := v.number()
+		return quantize(x, width), ok
+	case "int", "uint":
+		var n int64
+		switch v.Kind {
+		case Int:
+			n = v.Int
+		case Bool:
+			if v.Bool {
+				n = 1
+			}
+		case Float:
+			if math.IsNaN(v.Float) || math.Abs(v.Float) >= 1<<63 {
+				return Value{}, false
+			}
+			n = int64(v.Float)
+		case Angle:
+			if v.Width == 0 || (width != 0 && width != v.Width) {
+				return Value{}, false
+			}
+			n, width = angleBits(v), v.Width
+		default:
+			return Value{}, false
+		}
+		if width > 0 {
+			return wrap(n, width, typ == "int"), true
+		}
+		return Value{Kind: Int, Int: n}, true
+	}
+	return Value{}, false
+}
+
+// CheckAngles warns where a constant value is stored as a sized angle
+// and moves by more than tolerance radians in being rounded to a
+// multiple of 2π/2^N: in declarations of and assignments to angle[N]
+// variables, and in casts to angle[N]. A tolerance of zero means
+// DefaultAngleTolerance.
+func CheckAngles(program *parser.Program, tolerance float64) []parser.ParseError {
+	if tolerance == 0 {
+		tolerance = DefaultAngleTolerance
+	}
+	consts, _ := EvaluateConstants(program)
+	a := &angleChecker{consts: consts, tolerance: tolerance, widths: make(map[string]int)}
+	a.node(program)
+	sort.SliceStable(a.diagnostics, func(i, j int) bool {
+		return a.diagnostics[i].Position.Offset < a.diagnostics[j].Position.Offset
+	})
+	return a.diagnostics
+}
+
+type angleChecker struct {
+	consts    Constants
+	tolerance float64
+
+	// widths maps the angle[N] variables declared so far to N
+	widths      map[string]int
+	diagnostics []parser.ParseError
+}
+
+func (a *angleChecker) node(n parser.Node) {
+	switch n := n.(type) {
+	case *parser.ClassicalDeclaration:
+		delete(a.widths, n.Identifier)
+		if n.Type == "angle" && n.Size != nil {
+			if width, ok := a.consts.Int(n.Size); ok && width > 0 && width <= 64 {
+				a.widths[n.Identifier] = int(width)
+				a.store(n.Initializer, int(width))
+			}
+		}
+	case *parser.Assignment:
+		if id, ok := n.Target.(*parser.Identifier); ok && n.Operator == "=" {
+			if width, ok := a.widths[id.Name]; ok {
+				a.store(n.Value, width)
+			}
+		}
+	case *parser.FunctionCall:
+		if typ, width, ok := a.consts.castType(n.Name); ok && typ == "angle" && width > 0 && len(n.Arguments) == 1 {
+			a.store(n.Arguments[0], width)
+		}
+	}
+	for _, child := range children(n) {
+		a.node(child)
+	}
+}
+
+// store checks the value of expr, if constant, stored as angle[width]
+func (a *angleChecker) store(expr parser.Expression, width int) {
+	v, ok := a.consts.Evaluate(expr)
+	if !ok || (v.Kind == Angle && v.Width > 0 && v.Width <= width) {
+		return
+	}
+	x, ok := v.number()
+	if !ok {
+		return
+	}
+	loss := angleLoss(x, width)
+	if loss <= a.tolerance {
+		return
+	}
+	pos := expr.Pos()
+	pos.Column--
+	diag := parser.NewDiagnostic("semantic", message.AnglePrecision, map[string]string{
+		"value": exprString(expr),
+		"type":  "angle[" + strconv.Itoa(width) + "]",
+		"loss":  strconv.FormatFloat(loss, 'g', 3, 64),
+	}, pos)
+	diag.Severity = parser.SeverityWarning
+	a.diagnostics = append(a.diagnostics, diag)
+}
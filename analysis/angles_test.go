@@ -0,0 +1,83 @@
+package analysis
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAngleConstants(t *testing.T) {
+	consts, diagnostics := EvaluateConstants(parse(t, `OPENQASM 3.0;
+const angle[4] quarter = pi / 2;
+const angle[4] coarse = pi / 3;
+const angle wrapped = 3 * pi;
+const angle[4] negative = -quarter;
+const angle[4] sum = quarter + negative + quarter;
+const angle[4] scaled = quarter * 5;
+const int ratio = quarter / angle[4](pi / 8);
+const uint[4] raw = uint[4](quarter);
+const angle[4] back = angle[4](raw);
+const float f = float(coarse);
+const int truncated = int(-2.7);
+const bool set = bool(quarter);
+`))
+	if len(diagnostics) != 0 {
+		t.Fatalf("Diagnostics = %v", diagnostics)
+	}
+	floats := map[string]float64{
+		"quarter":  math.Pi / 2,
+		"coarse":   3 * math.Pi / 8,
+		"wrapped":  math.Pi,
+		"negative": 3 * math.Pi / 2,
+		"sum":      math.Pi / 2,
+		"scaled":   math.Pi / 2,
+		"back":     math.Pi / 2,
+		"f":        3 * math.Pi / 8,
+	}
+	for name, want := range floats {
+		if got := consts[name]; math.Abs(got.Float-want) > 1e-12 {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	if v := consts["quarter"]; v.Kind != Angle || v.Width != 4 {
+		t.Errorf("quarter = %+v, want an angle[4]", v)
+	}
+	ints := map[string]int64{"ratio": 4, "raw": 4, "truncated": -2}
+	for name, want := range ints {
+		if got := consts[name]; got.Kind != Int || got.Int != want {
+			t.Errorf("%s = %v, want %d", name, got, want)
+		}
+	}
+	if !consts["set"].Bool {
+		t.Error("bool(quarter) is false")
+	}
+}
+
+func TestCheckAngles(t *testing.T) {
+	diagnostics := CheckAngles(parse(t, `OPENQASM 3.0;
+const angle[8] exact = pi / 4;
+angle[8] a = pi / 3;
+angle[32] fine = pi / 3;
+a = exact;
+a = 0.1;
+float x = 0.2;
+a = x;
+float y = float(angle[4](1.0));
+`), 0)
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.Code+" "+d.Message+" "+string(d.Severity))
+	}
+	want := []string{
+		"QASM0029 pi / 3 stored as angle[8] is off by 0.00818 radians warning",
+		"QASM0029 0.1 stored as angle[8] is off by 0.00183 radians warning",
+		"QASM0029 1.0 stored as angle[4] is off by 0.178 radians warning",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diagnostics =\n%v\nwant\n%v", got, want)
+	}
+
+	if d := CheckAngles(parse(t, "OPENQASM 3.0;\nangle[8] a = 0.1;\n"), 0.01); len(d) != 0 {
+		t.Errorf("Diagnostics within the tolerance: %v", d)
+	}
+}
@@ -0,0 +1,124 @@
+package analysis
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/orangekame3/qasmparser/message"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// CheckArrays type-checks the uses of classical arrays in program. It
+// reports, as errors in source order:
+//
+//   - an array indexed with more indices than it has dimensions
+//   - a constant index outside a dimension of constant size; as with
+//     registers, -1 is the last element
+//   - an assignment to a readonly array parameter or one of its elements
+//
+// Sizes and indices are constant when EvaluateConstants can evaluate
+// them. Subroutine bodies see the array parameters of the subroutine.
+func CheckArrays(program *parser.Program) []parser.ParseError {
+	consts, _ := EvaluateConstants(program)
+	c := &arrayChecker{consts: consts}
+	c.node(program, make(map[string]*parser.ArrayType))
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		return c.diagnostics[i].Position.Offset < c.diagnostics[j].Position.Offset
+	})
+	return c.diagnostics
+}
+
+type arrayChecker struct {
+	consts      Constants
+	diagnostics []parser.ParseError
+}
+
+// node checks n and its children, with arrays mapping the arrays in
+// scope to their types
+func (c *arrayChecker) node(n parser.Node, arrays map[string]*parser.ArrayType) {
+	switch n := n.(type) {
+	case *parser.ClassicalDeclaration:
+		if n.Array != nil {
+			arrays[n.Identifier] = n.Array
+		} else {
+			delete(arrays, n.Identifier)
+		}
+	case *parser.SubroutineDefinition:
+		params := make(map[string]*parser.ArrayType)
+		for _, p := range n.Parameters {
+			if p.Array != nil {
+				params[p.Name] = p.Array
+			}
+		}
+		for _, stmt := range n.Body {
+			c.node(stmt, params)
+		}
+		return
+	case *parser.Assignment:
+		if name := targetName(n.Target); arrays[name] != nil && arrays[name].Access == "readonly" {
+			c.report(message.ReadonlyAssignment, map[string]string{"name": name}, n.Target)
+		}
+	case *parser.IndexedIdentifier:
+		if array := arrays[n.Name]; array != nil {
+			c.index(n, array)
+		}
+	}
+	for _, child := range children(n) {
+		c.node(child, arrays)
+	}
+}
+
+// index checks the indices of an element of array
+func (c *arrayChecker) index(e *parser.IndexedIdentifier, array *parser.ArrayType) {
+	indices := append([]parser.Expression{e.Index}, e.Indices...)
+	rank := len(array.Dimensions)
+	if array.Rank != nil {
+		n, ok := c.consts.Int(array.Rank)
+		if !ok {
+			return
+		}
+		rank = int(n)
+	}
+	if len(indices) > rank {
+		c.report(message.TooManyIndices, map[string]string{
+			"name":       e.Name,
+			"dimensions": strconv.Itoa(rank),
+			"indices":    strconv.Itoa(len(indices)),
+		}, e)
+		return
+	}
+	for i, index := range indices {
+		if i >= len(array.Dimensions) {
+			break
+		}
+		size, ok1 := c.consts.Int(array.Dimensions[i])
+		v, ok2 := c.consts.Int(index)
+		if ok1 && ok2 && (v >= size || v < -size) {
+			c.report(message.IndexOutOfRange, map[string]string{
+				"index":     strconv.FormatInt(v, 10),
+				"dimension": strconv.Itoa(i + 1),
+				"name":      e.Name,
+				"size":      strconv.FormatInt(size, 10),
+			}, index)
+		}
+	}
+}
+
+func (c *arrayChecker) report(code string, args map[string]string, node parser.Node) {
+	pos := node.Pos()
+	pos.Column--
+	c.diagnostics = append(c.diagnostics, parser.NewDiagnostic("semantic", code, args, pos))
+}
+
+// targetName returns the variable an assignment target writes
+func targetName(target parser.Expression) string {
+	switch t := target.(type) {
+	case *parser.Identifier:
+		return t.Name
+	case *parser.IndexedIdentifier:
+		return t.Name
+	case *parser.RangedIdentifier:
+		return t.Name
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckArrays(t *testing.T) {
+	diagnostics := CheckArrays(parse(t, `OPENQASM 3.0;
+const uint n = 4;
+array[int[32], n, 5] a;
+a[3, 4] = 1;
+a[-4][0] = 2;
+a[n, 0] = 3;
+a[0, 5] = 4;
+a[0, 1, 2] = 5;
+int i = 7;
+a[i, 0] = 6;
+def f(readonly array[int[8], #dim = 2] r, mutable array[float[64], 3] m) {
+  m[2] = r[0, 1];
+  m[3] = 1.0;
+  r[0, 0] = 1;
+  a[9] = 1;
+}
+`))
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.Code+" "+d.Message)
+	}
+	want := []string{
+		"QASM0027 index 4 is out of range for dimension 1 of a, of size 4",
+		"QASM0027 index 5 is out of range for dimension 2 of a, of size 5",
+		"QASM0026 a has 2 dimensions but is indexed with 3",
+		"QASM0027 index 3 is out of range for dimension 1 of m, of size 3",
+		"QASM0028 r is a readonly array and cannot be assigned",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diagnostics =\n%v\nwant\n%v", got, want)
+	}
+	if pos := diagnostics[0].Position; pos.Line != 6 || pos.Column != 2 {
+		t.Errorf("Position = %+v, want line 6 column 2", pos)
+	}
+}
@@ -0,0 +1,265 @@
+package analysis
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+
+	"github.com/orangekame3/qasmparser/message"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// BitAudit describes how a program wires measurement results into its
+// classical bits
+type BitAudit struct {
+	// Total is the number of bits each shot outputs: the bits of every bit
+	// register whose size is known
+	Total int `json:"total"`
+
+	// Written lists the bits a measurement writes, such as c[0], in
+	// declaration order
+	Written []string `json:"written"`
+
+	// Diagnostics are warnings about results overwritten before they are
+	// read and bits never written, in source order
+	Diagnostics []parser.ParseError `json:"diagnostics,omitempty"`
+}
+
+// AuditBits follows measurement results through program. A result is
+// read when any expression uses its bit, directly or through its whole
+// register. Bits that are outputs are read by the host at the end of the
+// shot, and since the AST does not record output declarations every bit
+// register is taken to be one; a result is therefore lost only when a
+// later measurement overwrites it unread, which is what the audit warns
+// about, along with bits no measurement writes.
+//
+// Branches may or may not run, so a result measured in either arm may
+// still be unread after them; loop bodies are followed twice, so a
+// result measured in one iteration and overwritten in the next is found.
+// Operands that cannot be resolved to single bits, such as c[i], count as
+// reading every bit of their register but never as overwriting one.
+// Classical assignments read their operands but do not write results.
+func AuditBits(program *parser.Program) BitAudit {
+	a := &bitAuditor{
+		registers: make(map[string]int),
+		declared:  make(map[string]parser.Position),
+		written:   make(map[string]bool),
+		pending:   make(map[string]parser.Position),
+		warned:    make(map[string]bool),
+	}
+	a.statements(program.Statements)
+
+	audit := BitAudit{Total: len(a.bits), Written: []string{}, Diagnostics: a.diagnostics}
+	for _, bit := range a.bits {
+		if a.written[bit] {
+			audit.Written = append(audit.Written, bit)
+		}
+	}
+	for _, name := range a.order {
+		bits := a.resolve(&parser.Identifier{Name: name})
+		unwritten := bits[:0:0]
+		for _, bit := range bits {
+			if !a.written[bit] {
+				unwritten = append(unwritten, bit)
+			}
+		}
+		// Name the register once when none of its bits is written
+		if len(unwritten) == len(bits) && len(bits) > 1 {
+			unwritten = []string{name}
+		}
+		for _, bit := range unwritten {
+			audit.Diagnostics = append(audit.Diagnostics, bitWarning(message.BitNeverWritten,
+				map[string]string{"bit": bit}, a.declared[name]))
+		}
+	}
+	sort.SliceStable(audit.Diagnostics, func(i, j int) bool {
+		return audit.Diagnostics[i].Position.Offset < audit.Diagnostics[j].Position.Offset
+	})
+	return audit
+}
+
+type bitAuditor struct {
+	// registers maps each bit register to its size, 0 for a single bit;
+	// order and bits list registers and their bits in declaration order
+	registers map[string]int
+	declared  map[string]parser.Position
+	order     []string
+	bits      []string
+
+	written map[string]bool
+
+	// pending maps each bit holding an unread result to the measurement
+	// that wrote it
+	pending map[string]parser.Position
+
+	// warned records reported overwrites, so loop bodies followed twice
+	// do not report them twice
+	warned      map[string]bool
+	diagnostics []parser.ParseError
+}
+
+func (a *bitAuditor) statements(statements []parser.Statement) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.ClassicalDeclaration:
+			if s.Type == "bit" || s.Type == "creg" {
+				a.declare(s)
+			}
+			if _, ok := s.Initializer.(*parser.MeasureExpression); ok {
+				a.write(&parser.Identifier{Name: s.Identifier}, s.Pos())
+			} else {
+				a.read(s.Initializer)
+			}
+		case *parser.GateCall:
+			for i := range s.Modifiers {
+				for _, p := range s.Modifiers[i].Parameters {
+					a.read(p)
+				}
+			}
+			for _, p := range s.Parameters {
+				a.read(p)
+			}
+		case *parser.Measurement:
+			if s.Target != nil {
+				a.write(s.Target, s.Pos())
+			}
+		case *parser.Assignment:
+			if s.Operator != "=" {
+				a.read(s.Target)
+			}
+			a.read(s.Value)
+		case *parser.IfStatement:
+			a.read(s.Condition)
+			before := maps.Clone(a.pending)
+			a.statements(s.ThenBody)
+			after := a.pending
+			a.pending = before
+			a.statements(s.ElseBody)
+			maps.Copy(a.pending, after)
+		case *parser.ForStatement:
+			a.read(s.Iterable)
+			a.loop(s.Body, nil)
+		case *parser.WhileStatement:
+			a.read(s.Condition)
+			a.loop(s.Body, s.Condition)
+		}
+	}
+}
+
+// loop follows body twice, reading condition after each pass. As the
+// body may not run at all, results pending before it stay pending.
+func (a *bitAuditor) loop(body []parser.Statement, condition parser.Expression) {
+	before := maps.Clone(a.pending)
+	for range 2 {
+		a.statements(body)
+		a.read(condition)
+	}
+	for bit, pos := range before {
+		if _, ok := a.pending[bit]; !ok {
+			a.pending[bit] = pos
+		}
+	}
+}
+
+// declare records a bit register whose size is known
+func (a *bitAuditor) declare(decl *parser.ClassicalDeclaration) {
+	// Loop bodies are followed twice
+	if _, ok := a.declared[decl.Identifier]; ok {
+		return
+	}
+	size := 0
+	if decl.Size != nil {
+		lit, ok := decl.Size.(*parser.IntegerLiteral)
+		if !ok {
+			return
+		}
+		size = int(lit.Value)
+	}
+	a.registers[decl.Identifier] = size
+	a.declared[decl.Identifier] = decl.Pos()
+	a.order = append(a.order, decl.Identifier)
+	a.bits = append(a.bits, a.resolve(&parser.Identifier{Name: decl.Identifier})...)
+}
+
+// write records a measurement at pos into target
+func (a *bitAuditor) write(target parser.Expression, pos parser.Position) {
+	bits, exact := a.resolveTarget(target)
+	for _, bit := range bits {
+		a.written[bit] = true
+		if !exact {
+			continue
+		}
+		if prev, ok := a.pending[bit]; ok && !a.warned[fmt.Sprint(bit, pos)] {
+			a.warned[fmt.Sprint(bit, pos)] = true
+			a.diagnostics = append(a.diagnostics, bitWarning(message.ResultOverwritten,
+				map[string]string{"bit": bit, "line": strconv.Itoa(prev.Line)}, pos))
+		}
+		a.pending[bit] = pos
+	}
+}
+
+// read marks every bit expr uses as read
+func (a *bitAuditor) read(expr parser.Expression) {
+	if expr == nil {
+		return
+	}
+	var visit func(n parser.Node)
+	visit = func(n parser.Node) {
+		if e, ok := n.(parser.Expression); ok {
+			bits, _ := a.resolveTarget(e)
+			for _, bit := range bits {
+				delete(a.pending, bit)
+			}
+		}
+		for _, child := range children(n) {
+			visit(child)
+		}
+	}
+	visit(expr)
+}
+
+// resolveTarget returns the bits an operand refers to, and whether they
+// are exactly those bits rather than every bit it might refer to
+func (a *bitAuditor) resolveTarget(operand parser.Expression) ([]string, bool) {
+	switch op := operand.(type) {
+	case *parser.Identifier:
+		return a.resolve(op), true
+	case *parser.IndexedIdentifier:
+		if _, ok := a.registers[op.Name]; !ok {
+			return nil, false
+		}
+		if lit, ok := op.Index.(*parser.IntegerLiteral); ok {
+			return []string{fmt.Sprintf("%s[%d]", op.Name, lit.Value)}, true
+		}
+		return a.resolve(&parser.Identifier{Name: op.Name}), false
+	case *parser.RangedIdentifier:
+		return a.resolve(&parser.Identifier{Name: op.Name}), false
+	}
+	return nil, false
+}
+
+// resolve returns the bits of a declared register
+func (a *bitAuditor) resolve(id *parser.Identifier) []string {
+	size, ok := a.registers[id.Name]
+	if !ok {
+		return nil
+	}
+	if size == 0 {
+		return []string{id.Name}
+	}
+	bits := make([]string, size)
+	for i := range bits {
+		bits[i] = fmt.Sprintf("%s[%d]", id.Name, i)
+	}
+	return bits
+}
+
+// bitWarning returns a warning at an AST position, whose column is
+// 1-based where diagnostics count from 0
+func bitWarning(code string, args map[string]string, pos parser.Position) parser.ParseError {
+	pos.Column--
+	diag := parser.NewDiagnostic("semantic", code, args, pos)
+	diag.Severity = parser.SeverityWarning
+	return diag
+}
@@ -0,0 +1,63 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuditBits(t *testing.T) {
+	audit := AuditBits(parse(t, `OPENQASM 3.0;
+qubit[2] q;
+bit[3] c;
+bit flag;
+bit unused;
+c[0] = measure q[0];
+c[0] = measure q[1];
+flag = measure q[0];
+if (flag) { x q[1]; }
+flag = measure q[1];
+for uint i in [0:2] {
+  c[1] = measure q[0];
+}
+`))
+	if audit.Total != 5 {
+		t.Errorf("Total = %d, want 5", audit.Total)
+	}
+	if want := []string{"c[0]", "c[1]", "flag"}; !reflect.DeepEqual(audit.Written, want) {
+		t.Errorf("Written = %v, want %v", audit.Written, want)
+	}
+	var got []string
+	for _, d := range audit.Diagnostics {
+		got = append(got, d.Code+" "+d.Message)
+		if d.Severity != "warning" {
+			t.Errorf("%s has severity %s", d.Code, d.Severity)
+		}
+	}
+	want := []string{
+		"QASM0020 c[2] is never written",
+		"QASM0020 unused is never written",
+		"QASM0019 c[0] is measured again before the result measured on line 6 is read",
+		"QASM0019 c[1] is measured again before the result measured on line 12 is read",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diagnostics =\n%v\nwant\n%v", got, want)
+	}
+	if pos := audit.Diagnostics[2].Position; pos.Line != 7 || pos.Column != 0 {
+		t.Errorf("overwrite reported at %d:%d, want 7:0", pos.Line, pos.Column)
+	}
+}
+
+func TestAuditBitsBranches(t *testing.T) {
+	audit := AuditBits(parse(t, `OPENQASM 3.0;
+qubit q;
+bit c;
+bit d;
+d = measure q;
+if (d) { c = measure q; } else { x q; }
+c = measure q;
+while (c) { c = measure q; }
+`))
+	if len(audit.Diagnostics) != 1 || audit.Diagnostics[0].Position.Line != 7 {
+		t.Errorf("Diagnostics = %v, want one overwrite on line 7", audit.Diagnostics)
+	}
+}
@@ -0,0 +1,22 @@
+package analysis
+
+import (
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// CallSites maps each gate name to the positions of its calls in source
+// order, including calls inside gate and subroutine definitions
+func CallSites(program *parser.Program) map[string][]parser.Position {
+	sites := make(map[string][]parser.Position)
+	var visit func(n parser.Node)
+	visit = func(n parser.Node) {
+		if call, ok := n.(*parser.GateCall); ok {
+			sites[call.Name] = append(sites[call.Name], call.Pos())
+		}
+		for _, child := range children(n) {
+			visit(child)
+		}
+	}
+	visit(program)
+	return sites
+}
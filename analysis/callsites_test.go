@@ -0,0 +1,28 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCallSites(t *testing.T) {
+	sites := CallSites(parse(t, `OPENQASM 3.0;
+qubit[2] q;
+gate bell a, b { h a; cx a, b; }
+h q[0];
+for uint i in [0:1] {
+  cx q[0], q[1];
+}
+bell q[0], q[1];
+`))
+	lines := make(map[string][]int)
+	for name, positions := range sites {
+		for _, pos := range positions {
+			lines[name] = append(lines[name], pos.Line)
+		}
+	}
+	want := map[string][]int{"h": {3, 4}, "cx": {3, 6}, "bell": {8}}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("CallSites() lines = %v, want %v", lines, want)
+	}
+}
@@ -0,0 +1,74 @@
+package analysis
+
+import "math/cmplx"
+
+// complexOf returns a complex or real number as a complex128
+func complexOf(v Value) (complex128, bool) {
+	switch v.Kind {
+	case Complex:
+		return complex(v.Float, v.Imag), true
+	case Int, Float:
+		x, _ := v.number()
+		return complex(x, 0), true
+	}
+	return 0, false
+}
+
+// complexValue returns z as a value, or false if it is not finite
+func complexValue(z complex128) (Value, bool) {
+	if cmplx.IsNaN(z) || cmplx.IsInf(z) {
+		return Value{}, false
+	}
+	return Value{Kind: Complex, Float: real(z), Imag: imag(z)}, true
+}
+
+// complexBinary applies op to two numbers of which one is complex
+func complexBinary(op string, l, r Value) (Value, bool) {
+	a, ok1 := complexOf(l)
+	b, ok2 := complexOf(r)
+	if !ok1 || !ok2 {
+		return Value{}, false
+	}
+	switch op {
+	case "+":
+		return complexValue(a + b)
+	case "-":
+		return complexValue(a - b)
+	case "*":
+		return complexValue(a * b)
+	case "/":
+		if b == 0 {
+			return Value{}, false
+		}
+		return complexValue(a / b)
+	case "**":
+		return complexValue(cmplx.Pow(a, b))
+	case "==":
+		return Value{Kind: Bool, Bool: a == b}, true
+	case "!=":
+		return Value{Kind: Bool, Bool: a != b}, true
+	}
+	return Value{}, false
+}
+
+// complexFunctions are the built-in functions that take a complex
+// argument
+var complexFunctions = map[string]func(complex128) complex128{
+	"sqrt": cmplx.Sqrt, "exp": cmplx.Exp, "log": cmplx.Log,
+	"sin": cmplx.Sin, "cos": cmplx.Cos, "tan": cmplx.Tan,
+}
+
+// complexCall applies a built-in function of one argument to a complex
+// number
+func complexCall(name string, v Value) (Value, bool) {
+	switch name {
+	case "real":
+		return Value{Kind: Float, Float: v.Float}, true
+	case "imag":
+		return Value{Kind: Float, Float: v.Imag}, true
+	}
+	if f, ok := complexFunctions[name]; ok {
+		return complexValue(f(complex(v.Float, v.Imag)))
+	}
+	return Value{}, false
+}
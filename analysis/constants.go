@@ -0,0 +1,547 @@
+package analysis
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/message"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Kind is the type of a constant value
+type Kind int
+
+const (
+	Int Kind = iota
+	Float
+	Bool
+
+	// Angle is an angle in [0, 2π), held in Float; a sized angle[N] is
+	// a multiple of 2π/2^N, with Width N
+	Angle
+
+	// Complex is a complex number, its real part held in Float and its
+	// imaginary part in Imag
+	Complex
+
+	// Array is the shape of an array whose sizes are constant, which
+	// sizeof reads; arrays are not constants themselves
+	Array
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Int:
+		return "int"
+	case Float:
+		return "float"
+	case Bool:
+		return "bool"
+	case Angle:
+		return "angle"
+	case Complex:
+		return "complex"
+	case Array:
+		return "array"
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Value is the value of a constant expression; the field for its Kind
+// holds it
+type Value struct {
+	Kind  Kind
+	Int   int64
+	Float float64
+	Bool  bool
+	Imag  float64
+
+	// Width is the number of bits of a sized integer, such as uint[8],
+	// which rotl and rotr rotate within, or of a sized angle; 0 means
+	// unsized
+	Width int
+
+	// Dimensions are the sizes of an Array
+	Dimensions []int64
+}
+
+func (v Value) String() string {
+	switch v.Kind {
+	case Int:
+		return strconv.FormatInt(v.Int, 10)
+	case Float, Angle:
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case Bool:
+		return strconv.FormatBool(v.Bool)
+	case Complex:
+		re := strconv.FormatFloat(v.Float, 'g', -1, 64)
+		if v.Imag < 0 || math.Signbit(v.Imag) {
+			return re + " - " + strconv.FormatFloat(-v.Imag, 'g', -1, 64) + "im"
+		}
+		return re + " + " + strconv.FormatFloat(v.Imag, 'g', -1, 64) + "im"
+	case Array:
+		dims := make([]string, len(v.Dimensions))
+		for i, d := range v.Dimensions {
+			dims[i] = strconv.FormatInt(d, 10)
+		}
+		return "array[" + strings.Join(dims, ", ") + "]"
+	}
+	return "?"
+}
+
+// number returns a numeric value as a float
+func (v Value) number() (float64, bool) {
+	switch v.Kind {
+	case Int:
+		return float64(v.Int), true
+	case Float, Angle:
+		return v.Float, true
+	}
+	return 0, false
+}
+
+// Constants holds the values of a program's const declarations, by name
+type Constants map[string]Value
+
+// predefined are the values of OpenQASM's built-in constants
+var predefined = map[string]float64{
+	"pi": math.Pi, "π": math.Pi, "tau": 2 * math.Pi, "τ": 2 * math.Pi, "euler": math.E, "ℇ": math.E,
+}
+
+// EvaluateConstants evaluates the const declarations at the top level of
+// program in order, each initializer seeing the constants before it:
+//
+//	const uint n = 4;
+//	const int m = 2 * n - 1;
+//
+// Integer types hold integers, wrapped to their width if sized, float
+// types real numbers, complex types complex numbers and angle types
+// angles, taken modulo 2π and, for angle[N], rounded to the nearest
+// multiple of 2π/2^N; other types are not evaluated. An
+// initializer that is not a constant expression of its type, such as
+// one reading a variable or dividing by zero, is reported and leaves its
+// name out of the result, as are uint constants below zero.
+//
+// Arrays declared at the top level with constant sizes are recorded as
+// values of kind Array, so sizeof can be evaluated on them.
+func EvaluateConstants(program *parser.Program) (Constants, []parser.ParseError) {
+	consts := make(Constants)
+	var diagnostics []parser.ParseError
+	for _, stmt := range program.Statements {
+		decl, ok := stmt.(*parser.ClassicalDeclaration)
+		if ok && decl.Array != nil {
+			if shape, ok := consts.shape(decl.Array); ok {
+				consts[decl.Identifier] = shape
+			}
+			continue
+		}
+		if !ok || !decl.Const || decl.Initializer == nil {
+			continue
+		}
+		var kind Kind
+		switch decl.Type {
+		case "int", "uint":
+			kind = Int
+		case "float":
+			kind = Float
+		case "angle":
+			kind = Angle
+		case "complex":
+			kind = Complex
+		case "bool":
+			kind = Bool
+		default:
+			continue
+		}
+		v, ok := consts.Evaluate(decl.Initializer)
+		if ok {
+			v, ok = convert(v, kind)
+		}
+		if ok && decl.Type == "uint" && v.Int < 0 {
+			ok = false
+		}
+		if ok && (kind == Int || kind == Angle) && decl.Size != nil {
+			width, sized := consts.Int(decl.Size)
+			if ok = sized && width > 0 && width <= 64; ok {
+				v = resize(v, int(width), decl.Type == "int")
+			}
+		}
+		if !ok {
+			pos := decl.Pos()
+			pos.Column--
+			diagnostics = append(diagnostics, parser.NewDiagnostic("semantic", message.NotConstant, map[string]string{
+				"name":  decl.Identifier,
+				"value": exprString(decl.Initializer),
+				"type":  decl.Type,
+			}, pos))
+			continue
+		}
+		consts[decl.Identifier] = v
+	}
+	return consts, diagnostics
+}
+
+// shape returns the shape of an array whose sizes are constant
+func (c Constants) shape(array *parser.ArrayType) (Value, bool) {
+	if array.Rank != nil {
+		return Value{}, false
+	}
+	v := Value{Kind: Array, Dimensions: make([]int64, len(array.Dimensions))}
+	for i, d := range array.Dimensions {
+		n, ok := c.Int(d)
+		if !ok || n < 0 {
+			return Value{}, false
+		}
+		v.Dimensions[i] = n
+	}
+	return v, true
+}
+
+// wrap reduces n to an integer of width bits, two's complement if signed
+func wrap(n int64, width int, signed bool) Value {
+	if width < 64 {
+		n &= 1<<width - 1
+		if signed && n&(1<<(width-1)) != 0 {
+			n -= 1 << width
+		}
+	}
+	return Value{Kind: Int, Int: n, Width: width}
+}
+
+// resize gives an integer or angle the given width
+func resize(v Value, width int, signed bool) Value {
+	if v.Kind == Angle {
+		return quantize(v.Float, width)
+	}
+	return wrap(v.Int, width, signed)
+}
+
+// convert converts v to kind as a const declaration does: integers
+// widen to floats, numbers become angles modulo 2π and angles read as
+// their value in radians, real numbers widen to complex ones, and
+// floats narrow to integers only when whole
+func convert(v Value, kind Kind) (Value, bool) {
+	switch {
+	case v.Kind == kind:
+		return v, true
+	case kind == Float && v.Kind == Int:
+		return Value{Kind: Float, Float: float64(v.Int)}, true
+	case kind == Float && v.Kind == Angle:
+		return Value{Kind: Float, Float: v.Float}, true
+	case kind == Angle && (v.Kind == Int || v.Kind == Float):
+		x, _ := v.number()
+		return quantize(x, 0), true
+	case kind == Complex && (v.Kind == Int || v.Kind == Float):
+		x, _ := v.number()
+		return Value{Kind: Complex, Float: x}, true
+	case kind == Int && v.Kind == Float && v.Float == math.Trunc(v.Float) && math.Abs(v.Float) < 1<<63:
+		return Value{Kind: Int, Int: int64(v.Float)}, true
+	}
+	return Value{}, false
+}
+
+// Int returns the value of an integer constant expression, such as a
+// register size or loop bound written with constants
+func (c Constants) Int(expr parser.Expression) (int64, bool) {
+	v, ok := c.Evaluate(expr)
+	if !ok || v.Kind != Int {
+		return 0, false
+	}
+	return v.Int, true
+}
+
+// Trips returns how many times a for loop over iterable runs, when
+// iterable is a range whose bounds are constant expressions. Ranges
+// include their stop value.
+func (c Constants) Trips(iterable parser.Expression) (int, bool) {
+	r, ok := iterable.(*parser.RangeExpression)
+	if !ok || r.Start == nil || r.Stop == nil {
+		return 0, false
+	}
+	start, ok1 := c.Int(r.Start)
+	stop, ok2 := c.Int(r.Stop)
+	step := int64(1)
+	if r.Step != nil {
+		s, ok := c.Int(r.Step)
+		if !ok || s == 0 {
+			return 0, false
+		}
+		step = s
+	}
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return int(max((stop-start)/step+1, 0)), true
+}
+
+// Evaluate returns the value of an expression of literals, built-in
+// constants such as pi, the constants in c and the built-in functions:
+// the math functions, mod and pow, popcount, rotl and rotr, real and
+// imag, and sizeof of the arrays in c. Complex numbers are written with
+// imaginary literals, as 2.0 + 3.1im. Integer arithmetic stays integral, with division
+// rounding toward zero, and mixing in a float makes it real.
+func (c Constants) Evaluate(expr parser.Expression) (Value, bool) {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral:
+		return Value{Kind: Int, Int: e.Value}, true
+	case *parser.FloatLiteral:
+		return Value{Kind: Float, Float: e.Value}, true
+	case *parser.ImaginaryLiteral:
+		return Value{Kind: Complex, Imag: e.Value}, true
+	case *parser.BooleanLiteral:
+		return Value{Kind: Bool, Bool: e.Value}, true
+	case *parser.Identifier:
+		if v, ok := c[e.Name]; ok {
+			return v, true
+		}
+		if v, ok := predefined[e.Name]; ok {
+			return Value{Kind: Float, Float: v}, true
+		}
+	case *parser.ParenthesizedExpression:
+		return c.Evaluate(e.Expression)
+	case *parser.UnaryExpression:
+		v, ok := c.Evaluate(e.Operand)
+		if !ok {
+			return Value{}, false
+		}
+		return unary(e.Operator, v)
+	case *parser.BinaryExpression:
+		l, ok1 := c.Evaluate(e.Left)
+		r, ok2 := c.Evaluate(e.Right)
+		if !ok1 || !ok2 {
+			return Value{}, false
+		}
+		return binary(e.Operator, l, r)
+	case *parser.FunctionCall:
+		args := make([]Value, len(e.Arguments))
+		for i, arg := range e.Arguments {
+			v, ok := c.Evaluate(arg)
+			if !ok {
+				return Value{}, false
+			}
+			args[i] = v
+		}
+		return c.call(e.Name, args)
+	}
+	return Value{}, false
+}
+
+func unary(op string, v Value) (Value, bool) {
+	if v.Kind == Array {
+		return Value{}, false
+	}
+	switch {
+	case op == "-" && v.Kind == Angle:
+		return quantize(-v.Float, v.Width), true
+	case op == "-" && v.Kind == Int:
+		return Value{Kind: Int, Int: -v.Int}, true
+	case op == "-" && v.Kind == Float:
+		return Value{Kind: Float, Float: -v.Float}, true
+	case op == "-" && v.Kind == Complex:
+		return Value{Kind: Complex, Float: -v.Float, Imag: -v.Imag}, true
+	case op == "+" && v.Kind != Bool:
+		return v, true
+	case op == "!" && v.Kind == Bool:
+		return Value{Kind: Bool, Bool: !v.Bool}, true
+	case op == "~" && v.Kind == Int:
+		return Value{Kind: Int, Int: ^v.Int}, true
+	}
+	return Value{}, false
+}
+
+func binary(op string, l, r Value) (Value, bool) {
+	if l.Kind == Array || r.Kind == Array {
+		return Value{}, false
+	}
+	if v, ok, handled := angleBinary(op, l, r); handled {
+		return v, ok
+	}
+	if l.Kind == Complex || r.Kind == Complex {
+		return complexBinary(op, l, r)
+	}
+	if l.Kind == Bool || r.Kind == Bool {
+		if l.Kind != Bool || r.Kind != Bool {
+			return Value{}, false
+		}
+		switch op {
+		case "&&":
+			return Value{Kind: Bool, Bool: l.Bool && r.Bool}, true
+		case "||":
+			return Value{Kind: Bool, Bool: l.Bool || r.Bool}, true
+		case "==":
+			return Value{Kind: Bool, Bool: l.Bool == r.Bool}, true
+		case "!=":
+			return Value{Kind: Bool, Bool: l.Bool != r.Bool}, true
+		}
+		return Value{}, false
+	}
+
+	if l.Kind == Int && r.Kind == Int {
+		a, b := l.Int, r.Int
+		switch op {
+		case "+":
+			return Value{Kind: Int, Int: a + b}, true
+		case "-":
+			return Value{Kind: Int, Int: a - b}, true
+		case "*":
+			return Value{Kind: Int, Int: a * b}, true
+		case "/":
+			if b == 0 {
+				return Value{}, false
+			}
+			return Value{Kind: Int, Int: a / b}, true
+		case "%":
+			if b == 0 {
+				return Value{}, false
+			}
+			return Value{Kind: Int, Int: a % b}, true
+		case "**":
+			if b >= 0 && b <= 64 {
+				p := int64(1)
+				for range b {
+					p *= a
+				}
+				return Value{Kind: Int, Int: p}, true
+			}
+		case "&":
+			return Value{Kind: Int, Int: a & b}, true
+		case "|":
+			return Value{Kind: Int, Int: a | b}, true
+		case "^":
+			return Value{Kind: Int, Int: a ^ b}, true
+		case "<<":
+			if b >= 0 {
+				return Value{Kind: Int, Int: a << b}, true
+			}
+			return Value{}, false
+		case ">>":
+			if b >= 0 {
+				return Value{Kind: Int, Int: a >> b}, true
+			}
+			return Value{}, false
+		}
+	}
+
+	a, _ := l.number()
+	b, _ := r.number()
+	switch op {
+	case "+":
+		return Value{Kind: Float, Float: a + b}, true
+	case "-":
+		return Value{Kind: Float, Float: a - b}, true
+	case "*":
+		return Value{Kind: Float, Float: a * b}, true
+	case "/":
+		if b == 0 {
+			return Value{}, false
+		}
+		return Value{Kind: Float, Float: a / b}, true
+	case "**":
+		return Value{Kind: Float, Float: math.Pow(a, b)}, true
+	case "==":
+		return Value{Kind: Bool, Bool: a == b}, true
+	case "!=":
+		return Value{Kind: Bool, Bool: a != b}, true
+	case "<":
+		return Value{Kind: Bool, Bool: a < b}, true
+	case "<=":
+		return Value{Kind: Bool, Bool: a <= b}, true
+	case ">":
+		return Value{Kind: Bool, Bool: a > b}, true
+	case ">=":
+		return Value{Kind: Bool, Bool: a >= b}, true
+	}
+	return Value{}, false
+}
+
+// functions are the built-in functions of one real argument
+var functions = map[string]func(float64) float64{
+	"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	"arcsin": math.Asin, "arccos": math.Acos, "arctan": math.Atan,
+	"exp": math.Exp, "log": math.Log, "sqrt": math.Sqrt,
+	"floor": math.Floor, "ceiling": math.Ceil,
+}
+
+func (c Constants) call(name string, args []Value) (Value, bool) {
+	if typ, width, ok := c.castType(name); ok {
+		if len(args) != 1 {
+			return Value{}, false
+		}
+		return cast(args[0], typ, width)
+	}
+	if len(args) == 1 && args[0].Kind == Complex {
+		return complexCall(name, args[0])
+	}
+	if f, ok := functions[name]; ok && len(args) == 1 {
+		x, ok := args[0].number()
+		y := f(x)
+		// Arguments outside the domain, as arcsin(2), have no value
+		return Value{Kind: Float, Float: y}, ok && !math.IsNaN(y) && !math.IsInf(y, 0)
+	}
+	switch {
+	case name == "sizeof" && (len(args) == 1 || len(args) == 2) && args[0].Kind == Array:
+		dim := int64(0)
+		if len(args) == 2 {
+			if args[1].Kind != Int {
+				return Value{}, false
+			}
+			dim = args[1].Int
+		}
+		if dim < 0 || dim >= int64(len(args[0].Dimensions)) {
+			return Value{}, false
+		}
+		return Value{Kind: Int, Int: args[0].Dimensions[dim]}, true
+	case name == "popcount" && len(args) == 1 && args[0].Kind == Int:
+		n := uint64(args[0].Int)
+		if w := args[0].Width; w > 0 && w < 64 {
+			n &= 1<<w - 1
+		}
+		return Value{Kind: Int, Int: int64(bits.OnesCount64(n))}, true
+	case (name == "rotl" || name == "rotr") && len(args) == 2 && args[0].Kind == Int && args[1].Kind == Int:
+		return rotate(args[0], args[1].Int, name == "rotr"), true
+	case name == "mod" && len(args) == 2:
+		if args[0].Kind == Int && args[1].Kind == Int {
+			return binary("%", args[0], args[1])
+		}
+		if args[0].Kind == Angle || args[1].Kind == Angle {
+			return Value{}, false
+		}
+		a, ok1 := args[0].number()
+		b, ok2 := args[1].number()
+		return Value{Kind: Float, Float: math.Mod(a, b)}, ok1 && ok2 && b != 0
+	case name == "pow" && len(args) == 2:
+		return binary("**", args[0], args[1])
+	case name == "real" && len(args) == 1:
+		x, ok := args[0].number()
+		return Value{Kind: Float, Float: x}, ok
+	case name == "imag" && len(args) == 1:
+		_, ok := args[0].number()
+		return Value{Kind: Float}, ok
+	}
+	return Value{}, false
+}
+
+// rotate rotates the bits of v left by k, or right if right is set,
+// within its width; unsized integers rotate as 64 bits
+func rotate(v Value, k int64, right bool) Value {
+	width := v.Width
+	if width == 0 {
+		width = 64
+	}
+	if right {
+		k = -k
+	}
+	k %= int64(width)
+	if k < 0 {
+		k += int64(width)
+	}
+	if width == 64 {
+		return Value{Kind: Int, Int: int64(bits.RotateLeft64(uint64(v.Int), int(k))), Width: v.Width}
+	}
+	mask := uint64(1)<<width - 1
+	n := uint64(v.Int) & mask
+	n = (n<<k | n>>(int64(width)-k)) & mask
+	return Value{Kind: Int, Int: int64(n), Width: width}
+}
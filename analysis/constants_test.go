@@ -0,0 +1,168 @@
+package analysis
+
+import (
+	"math"
+	"math/cmplx"
+	"reflect"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestEvaluateConstants(t *testing.T) {
+	consts, diagnostics := EvaluateConstants(parse(t, `OPENQASM 3.0;
+const uint n = 4;
+const int m = 2 * n - 1;
+const int half = m / 2;
+const float theta = pi / n;
+const bool wide = n > 3 && !false;
+const int bits = popcount(m) << 1;
+float x = 1.5;
+const float y = x * 2;
+const uint negative = 1 - n;
+const int ratio = 1 / (n - 4);
+const int whole = 6.0;
+`))
+	want := Constants{
+		"n":     {Kind: Int, Int: 4},
+		"m":     {Kind: Int, Int: 7},
+		"half":  {Kind: Int, Int: 3},
+		"theta": {Kind: Float, Float: math.Pi / 4},
+		"wide":  {Kind: Bool, Bool: true},
+		"bits":  {Kind: Int, Int: 6},
+		"whole": {Kind: Int, Int: 6},
+	}
+	if !reflect.DeepEqual(consts, want) {
+		t.Errorf("EvaluateConstants() = %v, want %v", consts, want)
+	}
+
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.Code+" "+d.Message)
+	}
+	expected := []string{
+		"QASM0025 const y = x * 2 is not a constant float",
+		"QASM0025 const negative = 1 - n is not a constant uint",
+		"QASM0025 const ratio = 1 / (n - 4) is not a constant int",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Diagnostics =\n%v\nwant\n%v", got, expected)
+	}
+	if pos := diagnostics[0].Position; pos.Line != 9 || pos.Column != 0 {
+		t.Errorf("Position = %+v, want line 9 column 0", pos)
+	}
+}
+
+func TestConstantsTrips(t *testing.T) {
+	consts := Constants{"n": {Kind: Int, Int: 4}}
+	program := parse(t, `OPENQASM 3.0;
+int k = 2;
+for uint i in [0:n - 1] {}
+for uint i in [n:-2:0] {}
+for uint i in [0:k] {}
+`)
+	var got []int
+	for _, stmt := range program.Statements[1:] {
+		n, ok := consts.Trips(stmt.(*parser.ForStatement).Iterable)
+		if !ok {
+			n = -1
+		}
+		got = append(got, n)
+	}
+	if want := []int{4, 3, -1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Trips = %v, want %v", got, want)
+	}
+}
+
+func TestEvaluateConstantsBuiltins(t *testing.T) {
+	consts, diagnostics := EvaluateConstants(parse(t, `OPENQASM 3.0;
+const uint n = 4;
+array[int[32], n, 2 * n] a;
+const uint rows = sizeof(a);
+const uint cols = sizeof(a, 1);
+const uint[8] b = 0b10000001;
+const uint left = rotl(b, 1);
+const uint right = rotr(b, 2);
+const uint wide = rotl(1, 65);
+const int ones = popcount(b);
+const int[4] wrapped = 9;
+const float c = cos(0) + arctan(1) * 4;
+const uint none = sizeof(a, 2);
+const float nan = arcsin(2);
+`))
+	ints := map[string]int64{"rows": 4, "cols": 8, "b": 129, "left": 3, "right": 96, "wide": 2, "ones": 2, "wrapped": -7}
+	for name, want := range ints {
+		if got, ok := consts[name]; !ok || got.Int != want {
+			t.Errorf("%s = %v, want %d", name, got, want)
+		}
+	}
+	if v := consts["c"]; math.Abs(v.Float-(1+math.Pi)) > 1e-12 {
+		t.Errorf("c = %v, want %v", v, 1+math.Pi)
+	}
+	if v := consts["a"]; v.Kind != Array || v.String() != "array[4, 8]" {
+		t.Errorf("a = %v, want array[4, 8]", v)
+	}
+
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.Message)
+	}
+	want := []string{
+		"const none = sizeof(a, 2) is not a constant uint",
+		"const nan = arcsin(2) is not a constant float",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diagnostics =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestEvaluateComplexConstants(t *testing.T) {
+	consts, diagnostics := EvaluateConstants(parse(t, `OPENQASM 3.0;
+const complex[float[64]] z = 2.0 + 3.1im;
+const complex w = z * (1 - 1im);
+const complex q = w / 2im;
+const float re = real(w);
+const float imaginary = imag(z);
+const complex e = exp(pi * 1im);
+const bool same = z == 2 + 3.1 im;
+const complex r = 4;
+const complex c = complex[float[64]](0.5);
+const float bad = z;
+const complex zero = z / 0im;
+`))
+	complexes := map[string]complex128{
+		"z": 2 + 3.1i,
+		"w": (2 + 3.1i) * (1 - 1i),
+		"q": (2 + 3.1i) * (1 - 1i) / 2i,
+		"e": -1,
+		"r": 4,
+		"c": 0.5,
+	}
+	for name, want := range complexes {
+		v := consts[name]
+		if v.Kind != Complex || cmplx.Abs(complex(v.Float, v.Imag)-want) > 1e-12 {
+			t.Errorf("%s = %v, want %v", name, v, want)
+		}
+	}
+	if re, im := consts["re"], consts["imaginary"]; re.Float != 5.1 || im.Float != 3.1 {
+		t.Errorf("re, im = %v, %v, want 5.1, 3.1", re, im)
+	}
+	if !consts["same"].Bool {
+		t.Error("z == 2 + 3.1 im is false")
+	}
+	if s := consts["w"].String(); s != "5.1 + 1.1im" {
+		t.Errorf("w prints as %q", s)
+	}
+
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.Message)
+	}
+	want := []string{
+		"const bad = z is not a constant float",
+		"const zero = z / 0im is not a constant complex",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diagnostics =\n%v\nwant\n%v", got, want)
+	}
+}
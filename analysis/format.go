@@ -0,0 +1,115 @@
+package analysis
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// exprString renders an expression as QASM source
+func exprString(expr parser.Expression) string {
+	switch e := expr.(type) {
+	case nil:
+		return ""
+	case *parser.Identifier:
+		return e.Name
+	case *parser.IndexedIdentifier:
+		indices := []string{exprString(e.Index)}
+		for _, index := range e.Indices {
+			indices = append(indices, exprString(index))
+		}
+		return e.Name + "[" + strings.Join(indices, ", ") + "]"
+	case *parser.RangedIdentifier:
+		return e.Name + "[" + exprString(e.Start) + ":" + exprString(e.EndIndex) + "]"
+	case *parser.RangeExpression:
+		parts := []string{exprString(e.Start)}
+		if e.Step != nil {
+			parts = append(parts, exprString(e.Step))
+		}
+		parts = append(parts, exprString(e.Stop))
+		return "[" + strings.Join(parts, ":") + "]"
+	case *parser.IntegerLiteral:
+		if e.Raw != "" {
+			return e.Raw
+		}
+		return strconv.FormatInt(e.Value, 10)
+	case *parser.FloatLiteral:
+		if e.Raw != "" {
+			return e.Raw
+		}
+		s := strconv.FormatFloat(e.Value, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s
+	case *parser.ImaginaryLiteral:
+		if e.Raw != "" {
+			return e.Raw
+		}
+		return strconv.FormatFloat(e.Value, 'g', -1, 64) + "im"
+	case *parser.StringLiteral:
+		return strconv.Quote(e.Value)
+	case *parser.BooleanLiteral:
+		return strconv.FormatBool(e.Value)
+	case *parser.BinaryExpression:
+		return exprString(e.Left) + " " + e.Operator + " " + exprString(e.Right)
+	case *parser.UnaryExpression:
+		return e.Operator + exprString(e.Operand)
+	case *parser.ParenthesizedExpression:
+		return "(" + exprString(e.Expression) + ")"
+	case *parser.FunctionCall:
+		args := make([]string, len(e.Arguments))
+		for i, arg := range e.Arguments {
+			args[i] = exprString(arg)
+		}
+		return e.Name + "(" + strings.Join(args, ", ") + ")"
+	case *parser.MeasureExpression:
+		return "measure " + exprString(e.Qubit)
+	case *parser.ArrayLiteral:
+		elems := make([]string, len(e.Elements))
+		for i, elem := range e.Elements {
+			elems[i] = exprString(elem)
+		}
+		return "{" + strings.Join(elems, ", ") + "}"
+	default:
+		return expr.String()
+	}
+}
+
+// typeString renders a declared type with its optional size, e.g. qubit[2]
+func typeString(typ string, size parser.Expression) string {
+	if size == nil {
+		return typ
+	}
+	return typ + "[" + exprString(size) + "]"
+}
+
+// gateSignature renders a gate definition header, e.g. gate rz(theta) q
+func gateSignature(g *parser.GateDefinition) string {
+	sig := "gate " + g.Name
+	if len(g.Parameters) > 0 {
+		sig += "(" + parameterList(g.Parameters) + ")"
+	}
+	return sig + " " + parameterList(g.Qubits)
+}
+
+// subroutineSignature renders a def header, e.g. def f(qubit q) -> bit
+func subroutineSignature(s *parser.SubroutineDefinition) string {
+	sig := "def " + s.Name + "(" + parameterList(s.Parameters) + ")"
+	if s.ReturnType != "" {
+		sig += " -> " + s.ReturnType
+	}
+	return sig
+}
+
+func parameterList(params []parser.Parameter) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.Name
+		if p.Type != "" {
+			parts[i] = p.Type + " " + p.Name
+		}
+	}
+	return strings.Join(parts, ", ")
+}
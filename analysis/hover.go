@@ -0,0 +1,202 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/doc"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/symbols"
+)
+
+// Hover describes the symbol under a position
+type Hover struct {
+	// Contents is Markdown: a code block with the declaration, its doc
+	// comment and where it is defined
+	Contents string `json:"contents"`
+
+	// Range is the node the hover applies to
+	Range Range `json:"range"`
+}
+
+// HoverInfo returns the declared type, size, definition location and doc
+// comment of the symbol at pos. It reports false when pos is not on a
+// name the program declares.
+func HoverInfo(program *parser.Program, pos parser.Position) (*Hover, bool) {
+	if program == nil {
+		return nil, false
+	}
+
+	path := enclosing(program, pos)
+	node := path[len(path)-1]
+	name, ok := nameAt(node, pos)
+	if !ok {
+		return nil, false
+	}
+
+	sym, ok := symbols.Build(program).Lookup(name, pos)
+	if !ok {
+		return nil, false
+	}
+	return &Hover{Contents: describe(program, sym), Range: nodeRange(node)}, true
+}
+
+// nameAt returns the name a node refers to when pos is on the node itself
+// rather than one of its children
+func nameAt(node parser.Node, pos parser.Position) (string, bool) {
+	switch n := node.(type) {
+	case *parser.Identifier:
+		return n.Name, true
+	case *parser.IndexedIdentifier:
+		return n.Name, true
+	case *parser.RangedIdentifier:
+		return n.Name, true
+	case *parser.GateCall:
+		// The name follows the modifiers and precedes the arguments
+		for _, m := range n.Modifiers {
+			if before(pos, m.End()) {
+				return "", false
+			}
+		}
+		return n.Name, true
+	case *parser.FunctionCall:
+		return n.Name, true
+	case *parser.QuantumDeclaration:
+		return n.Identifier, true
+	case *parser.ClassicalDeclaration:
+		return n.Identifier, true
+	case *parser.GateDefinition:
+		return n.Name, inHeader(n, n.Body, pos)
+	case *parser.SubroutineDefinition:
+		return n.Name, inHeader(n, n.Body, pos)
+	case *parser.Parameter:
+		return n.Name, true
+	case *parser.ForStatement:
+		return n.Variable, inHeader(n, n.Body, pos)
+	}
+	return "", false
+}
+
+// inHeader reports whether pos is on the first line of a block statement
+// and before its body, rather than in the whitespace inside the block
+func inHeader(node parser.Node, body []parser.Statement, pos parser.Position) bool {
+	if pos.Line != node.Pos().Line {
+		return false
+	}
+	return len(body) == 0 || before(pos, body[0].Pos())
+}
+
+// describe formats the hover contents for a symbol
+func describe(program *parser.Program, sym *symbols.Symbol) string {
+	var sb strings.Builder
+	comment := doc.Comment(program, sym.Node)
+
+	sb.WriteString("```qasm\n")
+	switch n := sym.Node.(type) {
+	case *parser.QuantumDeclaration:
+		sb.WriteString(typeString(n.Type, n.Size) + " " + n.Identifier)
+	case *parser.ClassicalDeclaration:
+		if n.Const {
+			sb.WriteString("const ")
+		}
+		sb.WriteString(typeString(n.Type, n.Size) + " " + n.Identifier)
+		if n.Const && n.Initializer != nil {
+			sb.WriteString(" = " + exprString(n.Initializer))
+		}
+	case *parser.GateDefinition:
+		sb.WriteString(gateSignature(n))
+		comment = definitionDoc(program, n)
+	case *parser.SubroutineDefinition:
+		sb.WriteString(subroutineSignature(n))
+		comment = definitionDoc(program, n)
+	case *parser.Parameter:
+		sb.WriteString(parameterDetail(n, sym.Owner))
+		comment = parameterDoc(program, n, sym.Owner)
+	case *parser.ForStatement:
+		sb.WriteString(n.Variable + " in " + exprString(n.Iterable))
+		comment = ""
+	}
+	sb.WriteString("\n```\n")
+
+	if comment != "" {
+		sb.WriteString("\n" + comment + "\n")
+	}
+	fmt.Fprintf(&sb, "\nDefined at line %d, column %d\n", sym.Node.Pos().Line, sym.Node.Pos().Column)
+	return sb.String()
+}
+
+// parameterDetail describes a gate or subroutine parameter
+func parameterDetail(p *parser.Parameter, owner parser.Node) string {
+	switch o := owner.(type) {
+	case *parser.GateDefinition:
+		for _, q := range o.Qubits {
+			if q.Name == p.Name {
+				return "qubit " + p.Name + " (argument of gate " + o.Name + ")"
+			}
+		}
+		return p.Name + " (parameter of gate " + o.Name + ")"
+	case *parser.SubroutineDefinition:
+		return p.Type + " " + p.Name + " (argument of " + o.Name + ")"
+	}
+	return p.Name
+}
+
+// documented returns the extracted documentation of a definition
+func documented(program *parser.Program, def parser.Node) (doc.Symbol, bool) {
+	for _, sym := range doc.Extract(program).Symbols {
+		if sym.Position == def.Pos() {
+			return sym, true
+		}
+	}
+	return doc.Symbol{}, false
+}
+
+// definitionDoc formats a definition's description and its documented
+// parameters
+func definitionDoc(program *parser.Program, def parser.Node) string {
+	sym, ok := documented(program, def)
+	if !ok {
+		return ""
+	}
+
+	lines := []string{}
+	if sym.Doc != "" {
+		lines = append(lines, sym.Doc)
+	}
+	var params []string
+	for _, p := range append(append([]doc.Param{}, sym.Params...), sym.Qubits...) {
+		if p.Doc != "" {
+			params = append(params, fmt.Sprintf("- `%s`: %s", p.Name, p.Doc))
+		}
+	}
+	if len(params) > 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, params...)
+	}
+	if sym.ReturnDoc != "" {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "Returns: "+sym.ReturnDoc)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parameterDoc returns the @param description of a parameter
+func parameterDoc(program *parser.Program, p *parser.Parameter, owner parser.Node) string {
+	if owner == nil {
+		return ""
+	}
+	sym, ok := documented(program, owner)
+	if !ok {
+		return ""
+	}
+	for _, param := range append(append([]doc.Param{}, sym.Params...), sym.Qubits...) {
+		if param.Name == p.Name {
+			return param.Doc
+		}
+	}
+	return ""
+}
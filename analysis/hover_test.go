@@ -0,0 +1,72 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const hoverSource = `OPENQASM 3.0;
+/// Data register
+qubit[2] q;
+const int shots = 100;
+
+/// Entangling rotation.
+/// @param theta rotation angle
+gate rzz(theta) a, b {
+  cx a, b;
+  rz(theta) b;
+}
+rzz(0.1) q[0], q[1];
+ctrl @ rzz(0.2) q[0], q[1];
+`
+
+func hover(t *testing.T, line, column int) string {
+	t.Helper()
+	h, ok := HoverInfo(parse(t, hoverSource), parser.Position{Line: line, Column: column})
+	if !ok {
+		t.Fatalf("Expected hover at %d:%d", line, column)
+	}
+	return h.Contents
+}
+
+func TestHoverInfo(t *testing.T) {
+	tests := []struct {
+		name         string
+		line, column int
+		want         []string
+	}{
+		{"register use", 12, 11, []string{"```qasm\nqubit[2] q\n```", "Data register", "Defined at line 3, column 1"}},
+		{"register declaration", 3, 10, []string{"qubit[2] q"}},
+		{"constant", 4, 12, []string{"const int shots = 100"}},
+		{"gate call", 12, 1, []string{"gate rzz(theta) a, b", "Entangling rotation.", "- `theta`: rotation angle", "Defined at line 8"}},
+		{"gate call after modifier", 13, 9, []string{"gate rzz(theta) a, b"}},
+		{"gate parameter", 10, 6, []string{"theta (parameter of gate rzz)", "rotation angle"}},
+		{"gate qubit", 9, 6, []string{"qubit a (argument of gate rzz)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hover(t, tt.line, tt.column)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("Hover missing %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHoverInfoMisses(t *testing.T) {
+	program := parse(t, hoverSource)
+	for _, pos := range []parser.Position{
+		{Line: 13, Column: 2},  // ctrl modifier
+		{Line: 12, Column: 5},  // literal argument
+		{Line: 20, Column: 1},  // past the end
+		{Line: 10, Column: 20}, // outside any node
+	} {
+		if h, ok := HoverInfo(program, pos); ok {
+			t.Errorf("Expected no hover at %+v, got %q", pos, h.Contents)
+		}
+	}
+}
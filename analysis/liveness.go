@@ -0,0 +1,74 @@
+package analysis
+
+import (
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Lifetime is when a qubit is in use, in moments as Moments numbers them
+// from 0
+type Lifetime struct {
+	Qubit string `json:"qubit"`
+
+	// FirstUse and LastUse are the moments of the first and last
+	// operation on the qubit, both -1 if nothing uses it
+	FirstUse int `json:"first_use"`
+	LastUse  int `json:"last_use"`
+
+	// Uses are the moments of every operation on the qubit, in order
+	Uses []int `json:"uses"`
+
+	// Idle lists the gaps between uses, when the qubit holds state but
+	// nothing acts on it
+	Idle []Window `json:"idle,omitempty"`
+
+	// Resets are the moments the qubit is reset, after which it holds no
+	// state from before
+	Resets []int `json:"resets,omitempty"`
+}
+
+// Window is a run of moments, from Start up to but not including End
+type Window struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Len returns the number of moments in w
+func (w Window) Len() int {
+	return w.End - w.Start
+}
+
+// Liveness returns the lifetime of every qubit program declares or uses,
+// in the order it first appears, laid out as Moments lays out the circuit.
+// Barriers align qubits but are not uses.
+func Liveness(program *parser.Program) []Lifetime {
+	l := &layout{
+		registers: make(map[string]int),
+		layers:    make(map[string]int),
+	}
+	l.statements(program.Statements)
+
+	lifetimes := make([]Lifetime, len(l.qubits))
+	index := make(map[string]int, len(l.qubits))
+	for i, q := range l.qubits {
+		lifetimes[i] = Lifetime{Qubit: q, FirstUse: -1, LastUse: -1, Uses: []int{}}
+		index[q] = i
+	}
+	for m, moment := range l.moments {
+		for _, op := range moment.Operations {
+			for _, q := range op.Qubits {
+				lt := &lifetimes[index[q]]
+				if lt.FirstUse < 0 {
+					lt.FirstUse = m
+				} else if prev := lt.Uses[len(lt.Uses)-1]; m > prev+1 {
+					lt.Idle = append(lt.Idle, Window{Start: prev + 1, End: m})
+				}
+				lt.LastUse = m
+				lt.Uses = append(lt.Uses, m)
+				if op.Name == "reset" {
+					lt.Resets = append(lt.Resets, m)
+				}
+			}
+		}
+	}
+	return lifetimes
+}
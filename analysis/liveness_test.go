@@ -0,0 +1,46 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLiveness(t *testing.T) {
+	lifetimes := Liveness(parse(t, `OPENQASM 3.0;
+qubit[3] q;
+bit c;
+h q[0];
+cx q[0], q[1];
+x q[1];
+y q[1];
+c = measure q[0];
+reset q[0];
+h q[0];
+`))
+	want := []Lifetime{
+		{Qubit: "q[0]", FirstUse: 0, LastUse: 4, Uses: []int{0, 1, 2, 3, 4}, Resets: []int{3}},
+		{Qubit: "q[1]", FirstUse: 1, LastUse: 3, Uses: []int{1, 2, 3}},
+		{Qubit: "q[2]", FirstUse: -1, LastUse: -1, Uses: []int{}},
+	}
+	if !reflect.DeepEqual(lifetimes, want) {
+		t.Errorf("Liveness() =\n%+v\nwant\n%+v", lifetimes, want)
+	}
+}
+
+func TestLivenessIdle(t *testing.T) {
+	lifetimes := Liveness(parse(t, `OPENQASM 3.0;
+qubit a;
+qubit b;
+h a;
+h b;
+x b;
+y b;
+cx a, b;
+`))
+	if got, want := lifetimes[0].Idle, []Window{{Start: 1, End: 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Idle = %+v, want %+v", got, want)
+	}
+	if lifetimes[0].Idle[0].Len() != 2 || lifetimes[1].Idle != nil {
+		t.Errorf("lifetimes = %+v", lifetimes)
+	}
+}
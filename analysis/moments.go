@@ -0,0 +1,176 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Operation is a gate or measurement placed in a moment
+type Operation struct {
+	// Name is the gate name, "measure" or "reset"
+	Name string `json:"name"`
+
+	// Qubits are the qubits the operation acts on, such as q[0] or $3
+	Qubits []string `json:"qubits"`
+
+	Statement parser.Statement `json:"-"`
+	Position  parser.Position  `json:"position"`
+}
+
+// Moment is a layer of operations on disjoint qubits, which can run at
+// the same time
+type Moment struct {
+	Operations []Operation `json:"operations"`
+}
+
+// Moments groups the operations of program into moments: each operation
+// goes into the first moment after the last one that uses any of its
+// qubits, so the number of moments is the circuit depth. A barrier puts
+// every later operation on its qubits after every earlier one; a barrier
+// without qubits spans all of them.
+//
+// Gate and subroutine definitions are not expanded, and loop and branch
+// bodies are laid out once, as they appear in the source. An operand
+// that cannot be resolved to single qubits, such as q[i], is taken to
+// touch its whole register, and a gate applied to a register is one
+// operation on all of its qubits.
+func Moments(program *parser.Program) []Moment {
+	l := &layout{
+		registers: make(map[string]int),
+		layers:    make(map[string]int),
+	}
+	l.statements(program.Statements)
+	return l.moments
+}
+
+type layout struct {
+	moments []Moment
+
+	// registers maps each quantum register to its size, 0 for a single
+	// qubit; qubits lists every qubit declared or used
+	registers map[string]int
+	qubits    []string
+
+	// layers maps each qubit to the number of moments before the next
+	// operation on it may go
+	layers map[string]int
+}
+
+func (l *layout) statements(statements []parser.Statement) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.QuantumDeclaration:
+			size := 0
+			if s.Size != nil {
+				size = -1
+				if lit, ok := s.Size.(*parser.IntegerLiteral); ok {
+					size = int(lit.Value)
+				}
+			}
+			l.registers[s.Identifier] = size
+			for _, q := range l.resolve(&parser.Identifier{Name: s.Identifier}) {
+				l.touch(q)
+			}
+		case *parser.ClassicalDeclaration:
+			if m, ok := s.Initializer.(*parser.MeasureExpression); ok {
+				l.place(s, "measure", m.Qubit)
+			}
+		case *parser.GateCall:
+			l.place(s, s.Name, s.Qubits...)
+		case *parser.Measurement:
+			l.place(s, "measure", s.Qubit)
+		case *parser.Reset:
+			l.place(s, "reset", s.Qubit)
+		case *parser.Barrier:
+			l.barrier(s.Qubits)
+		case *parser.IfStatement:
+			l.statements(s.ThenBody)
+			l.statements(s.ElseBody)
+		case *parser.ForStatement:
+			l.statements(s.Body)
+		case *parser.WhileStatement:
+			l.statements(s.Body)
+		}
+	}
+}
+
+// place adds an operation on operands to the first moment it fits
+func (l *layout) place(stmt parser.Statement, name string, operands ...parser.Expression) {
+	var qubits []string
+	for _, op := range operands {
+		qubits = append(qubits, l.resolve(op)...)
+	}
+	layer := 0
+	for _, q := range qubits {
+		l.touch(q)
+		layer = max(layer, l.layers[q])
+	}
+	for _, q := range qubits {
+		l.layers[q] = layer + 1
+	}
+	if layer == len(l.moments) {
+		l.moments = append(l.moments, Moment{})
+	}
+	l.moments[layer].Operations = append(l.moments[layer].Operations, Operation{
+		Name:      name,
+		Qubits:    qubits,
+		Statement: stmt,
+		Position:  stmt.Pos(),
+	})
+}
+
+// barrier aligns its qubits, so the next operation on any of them comes
+// after the last operation on all of them
+func (l *layout) barrier(operands []parser.Expression) {
+	qubits := l.qubits
+	if len(operands) > 0 {
+		qubits = nil
+		for _, op := range operands {
+			qubits = append(qubits, l.resolve(op)...)
+		}
+	}
+	layer := 0
+	for _, q := range qubits {
+		layer = max(layer, l.layers[q])
+	}
+	for _, q := range qubits {
+		l.touch(q)
+		l.layers[q] = layer
+	}
+}
+
+// touch records q as one of the program's qubits
+func (l *layout) touch(q string) {
+	if _, ok := l.layers[q]; !ok {
+		l.layers[q] = 0
+		l.qubits = append(l.qubits, q)
+	}
+}
+
+// resolve returns the qubits an operand refers to
+func (l *layout) resolve(operand parser.Expression) []string {
+	var name string
+	switch op := operand.(type) {
+	case *parser.Identifier:
+		name = op.Name
+	case *parser.IndexedIdentifier:
+		if lit, ok := op.Index.(*parser.IntegerLiteral); ok {
+			return []string{fmt.Sprintf("%s[%d]", op.Name, lit.Value)}
+		}
+		name = op.Name
+	case *parser.RangedIdentifier:
+		name = op.Name
+	default:
+		return nil
+	}
+	size, ok := l.registers[name]
+	if !ok || size <= 0 {
+		return []string{name}
+	}
+	qubits := make([]string, size)
+	for i := range qubits {
+		qubits[i] = fmt.Sprintf("%s[%d]", name, i)
+	}
+	return qubits
+}
@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// layers renders moments one per line, e.g. "h(q[0]) cx(q[1],q[2])"
+func layers(moments []Moment) string {
+	var lines []string
+	for _, m := range moments {
+		var ops []string
+		for _, op := range m.Operations {
+			ops = append(ops, fmt.Sprintf("%s(%s)", op.Name, strings.Join(op.Qubits, ",")))
+		}
+		lines = append(lines, strings.Join(ops, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestMoments(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name: "parallel gates",
+			source: `OPENQASM 3.0;
+qubit[3] q;
+bit[3] c;
+h q[0];
+h q[1];
+cx q[1], q[2];
+x q[0];
+c = measure q;
+`,
+			want: "h(q[0]) h(q[1])\ncx(q[1],q[2]) x(q[0])\nmeasure(q[0],q[1],q[2])",
+		},
+		{
+			name: "barrier",
+			source: `OPENQASM 3.0;
+qubit[2] q;
+h q[0];
+h q[0];
+barrier q;
+x q[1];
+`,
+			want: "h(q[0])\nh(q[0])\nx(q[1])",
+		},
+		{
+			name: "barrier on all qubits",
+			source: `OPENQASM 3.0;
+qubit a;
+qubit b;
+h a;
+barrier;
+x b;
+`,
+			want: "h(a)\nx(b)",
+		},
+		{
+			name: "barrier on other qubits",
+			source: `OPENQASM 3.0;
+qubit[3] q;
+h q[0];
+h q[0];
+barrier q[1], q[2];
+x q[1];
+`,
+			want: "h(q[0]) x(q[1])\nh(q[0])",
+		},
+		{
+			name: "unresolved operand",
+			source: `OPENQASM 3.0;
+qubit[2] q;
+for uint i in [0:1] { h q[i]; }
+x q[1];
+`,
+			want: "h(q[0],q[1])\nx(q[1])",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moments := Moments(parse(t, tt.source))
+			if got := layers(moments); got != tt.want {
+				t.Errorf("Moments() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMomentsPositions(t *testing.T) {
+	moments := Moments(parse(t, "OPENQASM 3.0;\nqubit q;\nbit c;\nh q;\nc = measure q;\n"))
+	if len(moments) != 2 {
+		t.Fatalf("Moments() = %d moments, want 2", len(moments))
+	}
+	op := moments[1].Operations[0]
+	if op.Name != "measure" || op.Position.Line != 5 || op.Statement == nil {
+		t.Errorf("measurement = %+v", op)
+	}
+}
@@ -0,0 +1,114 @@
+// Package analysis answers editor-style questions about a parsed program,
+// such as which symbols it defines and where, and structural ones, such
+// as whether the circuit splits into independent parts.
+package analysis
+
+import (
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// SymbolKind classifies an outline entry
+type SymbolKind string
+
+const (
+	SymbolGate       SymbolKind = "gate"
+	SymbolSubroutine SymbolKind = "subroutine"
+	SymbolQubit      SymbolKind = "qubit"
+	SymbolVariable   SymbolKind = "variable"
+	SymbolConstant   SymbolKind = "constant"
+	SymbolIf         SymbolKind = "if"
+	SymbolFor        SymbolKind = "for"
+	SymbolWhile      SymbolKind = "while"
+)
+
+// Range is a source range; End is exclusive
+type Range struct {
+	Start parser.Position `json:"start"`
+	End   parser.Position `json:"end"`
+}
+
+// Contains reports whether pos lies within the range
+func (r Range) Contains(pos parser.Position) bool {
+	return !before(pos, r.Start) && before(pos, r.End)
+}
+
+// before reports whether a comes before b, comparing lines then columns
+func before(a, b parser.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// nodeRange returns the source range of a node
+func nodeRange(n parser.Node) Range {
+	return Range{Start: n.Pos(), End: n.End()}
+}
+
+// Symbol is one entry of a document outline
+type Symbol struct {
+	Name     string     `json:"name"`
+	Kind     SymbolKind `json:"kind"`
+	Detail   string     `json:"detail,omitempty"`
+	Range    Range      `json:"range"`
+	Children []Symbol   `json:"children,omitempty"`
+}
+
+// Outline returns the hierarchical structure of a program: gate and
+// subroutine definitions, register and variable declarations, and
+// control-flow blocks with the declarations and blocks nested in them.
+func Outline(program *parser.Program) []Symbol {
+	if program == nil {
+		return nil
+	}
+	return outlineStatements(program.Statements)
+}
+
+func outlineStatements(statements []parser.Statement) []Symbol {
+	var symbols []Symbol
+	for _, stmt := range statements {
+		if sym, ok := outlineStatement(stmt); ok {
+			symbols = append(symbols, sym)
+		}
+	}
+	return symbols
+}
+
+func outlineStatement(stmt parser.Statement) (Symbol, bool) {
+	sym := Symbol{Range: nodeRange(stmt)}
+
+	switch s := stmt.(type) {
+	case *parser.GateDefinition:
+		sym.Name, sym.Kind = s.Name, SymbolGate
+		sym.Detail = gateSignature(s)
+		sym.Children = outlineStatements(s.Body)
+	case *parser.SubroutineDefinition:
+		sym.Name, sym.Kind = s.Name, SymbolSubroutine
+		sym.Detail = subroutineSignature(s)
+		sym.Children = outlineStatements(s.Body)
+	case *parser.QuantumDeclaration:
+		sym.Name, sym.Kind = s.Identifier, SymbolQubit
+		sym.Detail = typeString(s.Type, s.Size)
+	case *parser.ClassicalDeclaration:
+		sym.Name, sym.Kind = s.Identifier, SymbolVariable
+		if s.Const {
+			sym.Kind = SymbolConstant
+		}
+		sym.Detail = typeString(s.Type, s.Size)
+	case *parser.IfStatement:
+		sym.Name, sym.Kind = "if", SymbolIf
+		sym.Detail = exprString(s.Condition)
+		sym.Children = append(outlineStatements(s.ThenBody), outlineStatements(s.ElseBody)...)
+	case *parser.ForStatement:
+		sym.Name, sym.Kind = "for "+s.Variable, SymbolFor
+		sym.Detail = "in " + exprString(s.Iterable)
+		sym.Children = outlineStatements(s.Body)
+	case *parser.WhileStatement:
+		sym.Name, sym.Kind = "while", SymbolWhile
+		sym.Detail = exprString(s.Condition)
+		sym.Children = outlineStatements(s.Body)
+	default:
+		return Symbol{}, false
+	}
+	return sym, true
+}
@@ -0,0 +1,106 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const outlineSource = `OPENQASM 3.0;
+qubit[2] q;
+bit[2] c;
+const int shots = 100;
+gate rzz(theta) a, b {
+  cx a, b;
+  rz(theta) b;
+  cx a, b;
+}
+def flip(qubit r) -> bit {
+  bit m = 0;
+  return measure r;
+}
+for uint i in [0:1] {
+  if (c[0] == 1) {
+    float x = 0.5;
+  }
+}
+while (true) { h q[0]; }
+`
+
+func parse(t *testing.T, source string) *parser.Program {
+	t.Helper()
+	result := parser.NewParser().ParseWithErrors(source)
+	if result.HasErrors() {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	return result.Program
+}
+
+func TestOutline(t *testing.T) {
+	symbols := Outline(parse(t, outlineSource))
+
+	expected := []struct {
+		name   string
+		kind   SymbolKind
+		detail string
+	}{
+		{"q", SymbolQubit, "qubit[2]"},
+		{"c", SymbolVariable, "bit[2]"},
+		{"shots", SymbolConstant, "int"},
+		{"rzz", SymbolGate, "gate rzz(theta) a, b"},
+		{"flip", SymbolSubroutine, "def flip(qubit r) -> bit"},
+		{"for i", SymbolFor, "in [0:1]"},
+		{"while", SymbolWhile, "true"},
+	}
+	if len(symbols) != len(expected) {
+		t.Fatalf("Expected %d symbols, got %d: %+v", len(expected), len(symbols), symbols)
+	}
+	for i, want := range expected {
+		got := symbols[i]
+		if got.Name != want.name || got.Kind != want.kind || got.Detail != want.detail {
+			t.Errorf("Symbol %d: expected %s %s %q, got %s %s %q",
+				i, want.kind, want.name, want.detail, got.Kind, got.Name, got.Detail)
+		}
+	}
+
+	gate := symbols[3]
+	if gate.Range.Start.Line != 5 || gate.Range.End.Line != 9 {
+		t.Errorf("Expected gate to span lines 5-9, got %+v", gate.Range)
+	}
+	if len(gate.Children) != 0 {
+		t.Errorf("Expected gate calls to be left out of the outline, got %+v", gate.Children)
+	}
+
+	if def := symbols[4]; len(def.Children) != 1 || def.Children[0].Name != "m" {
+		t.Errorf("Expected local declaration in subroutine, got %+v", def.Children)
+	}
+
+	loop := symbols[5]
+	if len(loop.Children) != 1 || loop.Children[0].Kind != SymbolIf || loop.Children[0].Detail != "c[0] == 1" {
+		t.Fatalf("Expected nested if, got %+v", loop.Children)
+	}
+	if inner := loop.Children[0].Children; len(inner) != 1 || inner[0].Name != "x" {
+		t.Errorf("Expected declaration inside if, got %+v", inner)
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	r := Range{
+		Start: parser.Position{Line: 2, Column: 3},
+		End:   parser.Position{Line: 4, Column: 1},
+	}
+	tests := []struct {
+		pos  parser.Position
+		want bool
+	}{
+		{parser.Position{Line: 2, Column: 3}, true},
+		{parser.Position{Line: 2, Column: 2}, false},
+		{parser.Position{Line: 3, Column: 80}, true},
+		{parser.Position{Line: 4, Column: 1}, false},
+	}
+	for _, tt := range tests {
+		if got := r.Contains(tt.pos); got != tt.want {
+			t.Errorf("Contains(%+v) = %v, want %v", tt.pos, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Subcircuit is one independent part of a partitioned program
+type Subcircuit struct {
+	// Qubits are the qubits of the part, in order of first use, such as
+	// q[0] or $3
+	Qubits []string `json:"qubits"`
+
+	// Program is the part as a program of its own: the version, includes,
+	// definitions and classical statements of the original, the
+	// declarations of the registers its qubits belong to, and the
+	// operations on its qubits
+	Program *parser.Program `json:"program"`
+}
+
+// Partition splits program into subcircuits on disjoint sets of qubits
+// that never interact, so each can be simulated on its own. Qubits
+// interact when a multi-qubit gate acts on both, when one is measured
+// into a bit that a condition controlling an operation on the other
+// reads, or when both are used in the same loop or branch, which is kept
+// whole.
+//
+// With k > 0, the independent groups are merged into at most k
+// subcircuits of balanced qubit counts; k <= 0 keeps every group apart. A
+// single subcircuit means the circuit does not decompose. Gates applied
+// to a whole register, as in h q, are split into one call per qubit where
+// the register spans subcircuits. Operands that cannot be resolved to
+// single qubits, such as q[i], are taken to touch the whole register.
+func Partition(program *parser.Program, k int) []Subcircuit {
+	p := &partitioner{
+		registers: make(map[string]int),
+		parent:    make(map[string]string),
+		measured:  make(map[string][]string),
+	}
+	p.declare(program.Statements)
+	uses := make([][][]string, len(program.Statements))
+	for i, stmt := range program.Statements {
+		uses[i] = p.uses(stmt)
+	}
+
+	groups := p.groups(k)
+	part := make(map[string]int)
+	for i, g := range groups {
+		for _, q := range g {
+			part[q] = i
+		}
+	}
+
+	subs := make([]Subcircuit, max(len(groups), 1))
+	for i := range subs {
+		subs[i].Program = &parser.Program{BaseNode: program.BaseNode, Version: program.Version}
+		if i < len(groups) {
+			subs[i].Qubits = groups[i]
+		}
+	}
+	for i, stmt := range program.Statements {
+		p.place(stmt, uses[i], part, subs)
+	}
+	return subs
+}
+
+type partitioner struct {
+	// registers maps each register to its size, 0 for a single qubit or
+	// bit
+	registers map[string]int
+
+	// parent is the union-find forest over qubits; order lists the qubits
+	// in order of first use
+	parent map[string]string
+	order  []string
+
+	// measured maps each bit to the qubits measured into it
+	measured map[string][]string
+}
+
+// declare records the registers declared at the top level
+func (p *partitioner) declare(statements []parser.Statement) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.QuantumDeclaration:
+			p.registers[s.Identifier] = declaredSize(s.Size)
+		case *parser.ClassicalDeclaration:
+			p.registers[s.Identifier] = declaredSize(s.Size)
+		}
+	}
+}
+
+// uses returns the qubits stmt acts on, as one list per independent
+// operation: a broadcast gate call has one per qubit index, anything
+// else at most one. The qubits of each operation are joined.
+func (p *partitioner) uses(stmt parser.Statement) [][]string {
+	var ops [][]string
+	switch s := stmt.(type) {
+	case *parser.GateCall:
+		ops = p.broadcast(s.Qubits)
+	case *parser.Reset:
+		ops = p.broadcast([]parser.Expression{s.Qubit})
+	case *parser.Measurement:
+		ops = p.measure(s.Qubit, s.Target)
+	case *parser.Barrier:
+		// A barrier orders operations without making qubits interact, or
+		// making a qubit used by nothing else a part of its own
+		for _, op := range s.Qubits {
+			for _, q := range p.resolve(op) {
+				ops = append(ops, []string{q})
+			}
+		}
+		return ops
+	case *parser.ClassicalDeclaration:
+		if m, ok := s.Initializer.(*parser.MeasureExpression); ok {
+			ops = p.measure(m.Qubit, &parser.Identifier{Name: s.Identifier})
+		}
+	case *parser.IfStatement, *parser.ForStatement, *parser.WhileStatement:
+		var qubits []string
+		for _, op := range p.nested(stmt) {
+			qubits = append(qubits, op...)
+		}
+		if len(qubits) > 0 {
+			ops = [][]string{qubits}
+		}
+	}
+	for _, op := range ops {
+		for _, q := range op {
+			p.union(op[0], q)
+		}
+	}
+	return ops
+}
+
+// nested returns the operations of a control-flow statement, including
+// the qubits measured into the bits its condition reads
+func (p *partitioner) nested(stmt parser.Statement) [][]string {
+	var (
+		ops    [][]string
+		bodies [][]parser.Statement
+		cond   parser.Expression
+	)
+	switch s := stmt.(type) {
+	case *parser.IfStatement:
+		cond, bodies = s.Condition, [][]parser.Statement{s.ThenBody, s.ElseBody}
+	case *parser.ForStatement:
+		bodies = [][]parser.Statement{s.Body}
+	case *parser.WhileStatement:
+		cond, bodies = s.Condition, [][]parser.Statement{s.Body}
+	}
+	if cond != nil {
+		var reads []string
+		p.reads(cond, &reads)
+		for _, bit := range reads {
+			ops = append(ops, p.measured[bit])
+		}
+	}
+	for _, body := range bodies {
+		for _, stmt := range body {
+			ops = append(ops, p.uses(stmt)...)
+		}
+	}
+	return ops
+}
+
+// reads collects the bits expr reads
+func (p *partitioner) reads(expr parser.Expression, bits *[]string) {
+	switch e := expr.(type) {
+	case *parser.Identifier, *parser.IndexedIdentifier:
+		*bits = append(*bits, p.resolve(e)...)
+	case *parser.BinaryExpression:
+		p.reads(e.Left, bits)
+		p.reads(e.Right, bits)
+	case *parser.UnaryExpression:
+		p.reads(e.Operand, bits)
+	case *parser.ParenthesizedExpression:
+		p.reads(e.Expression, bits)
+	case *parser.FunctionCall:
+		for _, arg := range e.Arguments {
+			p.reads(arg, bits)
+		}
+	}
+}
+
+// broadcast returns the operations of a gate on operands. Operands
+// standing for registers of the same size are applied index by index;
+// any operand that cannot be resolved makes the call one operation.
+func (p *partitioner) broadcast(operands []parser.Expression) [][]string {
+	resolved := make([][]string, len(operands))
+	n := 1
+	for i, op := range operands {
+		resolved[i] = p.resolve(op)
+		if len(resolved[i]) > 1 {
+			if n > 1 && len(resolved[i]) != n || !p.exact(op) {
+				return [][]string{flatten(resolved)}
+			}
+			n = len(resolved[i])
+		}
+	}
+	ops := make([][]string, n)
+	for i := range ops {
+		for _, qs := range resolved {
+			if len(qs) > 0 {
+				ops[i] = append(ops[i], qs[min(i, len(qs)-1)])
+			}
+		}
+	}
+	return ops
+}
+
+// measure returns the operations of measuring qubit into target, one per
+// qubit, and records which qubits each bit holds
+func (p *partitioner) measure(qubit, target parser.Expression) [][]string {
+	qubits := p.resolve(qubit)
+	if !p.exact(qubit) {
+		// Any of the register's qubits may end up in any of the bits
+		if target != nil {
+			for _, bit := range p.resolve(target) {
+				p.measured[bit] = append(p.measured[bit], qubits...)
+			}
+		}
+		return [][]string{qubits}
+	}
+
+	var bits []string
+	if target != nil {
+		bits = p.resolve(target)
+	}
+	ops := make([][]string, len(qubits))
+	for i, q := range qubits {
+		ops[i] = []string{q}
+		if i < len(bits) {
+			p.measured[bits[i]] = append(p.measured[bits[i]], q)
+		}
+	}
+	return ops
+}
+
+// resolve returns the qubits or bits an operand refers to: one for an
+// indexed element, every element of a register otherwise
+func (p *partitioner) resolve(operand parser.Expression) []string {
+	var name string
+	switch op := operand.(type) {
+	case *parser.Identifier:
+		name = op.Name
+	case *parser.IndexedIdentifier:
+		if lit, ok := op.Index.(*parser.IntegerLiteral); ok {
+			return []string{fmt.Sprintf("%s[%d]", op.Name, lit.Value)}
+		}
+		name = op.Name
+	case *parser.RangedIdentifier:
+		name = op.Name
+	default:
+		return nil
+	}
+	size := p.registers[name]
+	if size == 0 {
+		return []string{name}
+	}
+	elements := make([]string, size)
+	for i := range elements {
+		elements[i] = fmt.Sprintf("%s[%d]", name, i)
+	}
+	return elements
+}
+
+// exact reports whether an operand names its qubits precisely, rather
+// than standing for a whole register because its index is unknown
+func (p *partitioner) exact(operand parser.Expression) bool {
+	switch op := operand.(type) {
+	case *parser.Identifier:
+		return true
+	case *parser.IndexedIdentifier:
+		_, ok := op.Index.(*parser.IntegerLiteral)
+		return ok
+	}
+	return false
+}
+
+func (p *partitioner) find(q string) string {
+	parent, ok := p.parent[q]
+	if !ok {
+		p.parent[q] = q
+		p.order = append(p.order, q)
+		return q
+	}
+	if parent == q {
+		return q
+	}
+	root := p.find(parent)
+	p.parent[q] = root
+	return root
+}
+
+func (p *partitioner) union(a, b string) {
+	ra, rb := p.find(a), p.find(b)
+	if ra != rb {
+		p.parent[rb] = ra
+	}
+}
+
+// groups returns the qubits of each independent group in order of first
+// use, merged into at most k groups when k > 0
+func (p *partitioner) groups(k int) [][]string {
+	index := make(map[string]int)
+	var groups [][]string
+	for _, q := range p.order {
+		root := p.find(q)
+		i, ok := index[root]
+		if !ok {
+			i = len(groups)
+			index[root] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], q)
+	}
+	if k <= 0 || len(groups) <= k {
+		return groups
+	}
+
+	// Largest first, each into the bin with the fewest qubits so far
+	bySize := make([]int, len(groups))
+	for i := range bySize {
+		bySize[i] = i
+	}
+	sort.SliceStable(bySize, func(a, b int) bool {
+		return len(groups[bySize[a]]) > len(groups[bySize[b]])
+	})
+	bin := make([]int, len(groups))
+	load := make([]int, k)
+	for _, g := range bySize {
+		best := 0
+		for b := range load {
+			if load[b] < load[best] {
+				best = b
+			}
+		}
+		bin[g] = best
+		load[best] += len(groups[g])
+	}
+
+	// Keep bins, and the qubits within them, in order of first use
+	merged := make([][]string, k)
+	for _, q := range p.order {
+		b := bin[index[p.find(q)]]
+		merged[b] = append(merged[b], q)
+	}
+	sort.SliceStable(merged, func(a, b int) bool {
+		return firstUse(p.order, merged[a]) < firstUse(p.order, merged[b])
+	})
+	return merged
+}
+
+func firstUse(order []string, group []string) int {
+	for i, q := range order {
+		if q == group[0] {
+			return i
+		}
+	}
+	return len(order)
+}
+
+// place appends stmt to the subcircuits it belongs to. Statements
+// without qubits, other than quantum declarations, go to every
+// subcircuit; a quantum declaration goes to those using its qubits, or
+// to the first if none does; a broadcast spanning subcircuits is split.
+// A bit declaration initialized by measurement is declared everywhere
+// and measured where its qubits are.
+func (p *partitioner) place(stmt parser.Statement, ops [][]string, part map[string]int, subs []Subcircuit) {
+	if decl, ok := stmt.(*parser.QuantumDeclaration); ok {
+		used := make(map[int]bool)
+		for _, q := range p.resolve(&parser.Identifier{Name: decl.Identifier}) {
+			if i, ok := part[q]; ok {
+				used[i] = true
+			}
+		}
+		if len(used) == 0 {
+			used[0] = true
+		}
+		for i := range subs {
+			if used[i] {
+				subs[i].Program.Statements = append(subs[i].Program.Statements, stmt)
+			}
+		}
+		return
+	}
+
+	if decl, ok := stmt.(*parser.ClassicalDeclaration); ok && len(ops) > 0 && len(subs) > 1 {
+		// Every subcircuit may read the bits, so each declares them, and
+		// the measurement goes where its qubits are
+		bare := *decl
+		bare.Initializer = nil
+		for i := range subs {
+			subs[i].Program.Statements = append(subs[i].Program.Statements, &bare)
+		}
+		for i, op := range ops {
+			if len(op) > 0 {
+				j := part[op[0]]
+				subs[j].Program.Statements = append(subs[j].Program.Statements, p.split(stmt, i, op))
+			}
+		}
+		return
+	}
+
+	parts := make([]int, len(ops))
+	whole := true
+	for i, op := range ops {
+		parts[i] = -1
+		if len(op) > 0 {
+			if j, ok := part[op[0]]; ok {
+				parts[i] = j
+			}
+		}
+		if parts[i] != parts[0] {
+			whole = false
+		}
+	}
+	if _, ok := stmt.(*parser.Barrier); ok && len(ops) > 0 && parts[0] < 0 && whole {
+		// Only on qubits nothing uses
+		return
+	}
+	if len(ops) == 0 || parts[0] < 0 && whole {
+		for i := range subs {
+			subs[i].Program.Statements = append(subs[i].Program.Statements, stmt)
+		}
+		return
+	}
+	if whole {
+		subs[parts[0]].Program.Statements = append(subs[parts[0]].Program.Statements, stmt)
+		return
+	}
+	if _, ok := stmt.(*parser.Barrier); ok {
+		// One barrier per subcircuit, on the qubits it holds
+		barriers := make(map[int]*parser.Barrier)
+		for i, op := range ops {
+			if parts[i] < 0 {
+				continue
+			}
+			b, ok := barriers[parts[i]]
+			if !ok {
+				b = &parser.Barrier{BaseNode: stmt.(*parser.Barrier).BaseNode}
+				barriers[parts[i]] = b
+				subs[parts[i]].Program.Statements = append(subs[parts[i]].Program.Statements, b)
+			}
+			b.Qubits = append(b.Qubits, qubitOperand(op[0]))
+		}
+		return
+	}
+	for i, op := range ops {
+		if parts[i] >= 0 {
+			subs[parts[i]].Program.Statements = append(subs[parts[i]].Program.Statements, p.split(stmt, i, op))
+		}
+	}
+}
+
+// split returns the operation at index i of a broadcast statement, which
+// acts on qubits
+func (p *partitioner) split(stmt parser.Statement, i int, qubits []string) parser.Statement {
+	switch s := stmt.(type) {
+	case *parser.GateCall:
+		call := *s
+		call.Qubits = make([]parser.Expression, len(s.Qubits))
+		for j, op := range s.Qubits {
+			call.Qubits[j] = p.element(op, i)
+		}
+		return &call
+	case *parser.Reset:
+		r := *s
+		r.Qubit = p.element(s.Qubit, i)
+		return &r
+	case *parser.Measurement:
+		m := *s
+		m.Qubit = p.element(s.Qubit, i)
+		if s.Target != nil {
+			m.Target = p.element(s.Target, i)
+		}
+		return &m
+	case *parser.ClassicalDeclaration:
+		m := s.Initializer.(*parser.MeasureExpression)
+		if !p.exact(m.Qubit) {
+			return &parser.Measurement{BaseNode: s.BaseNode, Qubit: m.Qubit, Target: &parser.Identifier{BaseNode: s.BaseNode, Name: s.Identifier}}
+		}
+		return &parser.Measurement{
+			BaseNode: s.BaseNode,
+			Qubit:    p.element(m.Qubit, i),
+			Target:   p.element(&parser.Identifier{BaseNode: s.BaseNode, Name: s.Identifier}, i),
+		}
+	}
+	return stmt
+}
+
+// element returns element i of a register operand, or the operand
+// itself if it is a single qubit or bit
+func (p *partitioner) element(operand parser.Expression, i int) parser.Expression {
+	id, ok := operand.(*parser.Identifier)
+	if !ok || p.registers[id.Name] == 0 {
+		return operand
+	}
+	return &parser.IndexedIdentifier{
+		BaseNode: id.BaseNode,
+		Name:     id.Name,
+		Index:    &parser.IntegerLiteral{BaseNode: id.BaseNode, Value: int64(i)},
+	}
+}
+
+// qubitOperand returns the operand naming a qubit, such as q[2]
+func qubitOperand(qubit string) parser.Expression {
+	name, index, ok := strings.Cut(strings.TrimSuffix(qubit, "]"), "[")
+	if !ok {
+		return &parser.Identifier{Name: qubit}
+	}
+	i, _ := strconv.ParseInt(index, 10, 64)
+	return &parser.IndexedIdentifier{Name: name, Index: &parser.IntegerLiteral{Value: i}}
+}
+
+func flatten(lists [][]string) []string {
+	var all []string
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	return all
+}
+
+// declaredSize returns the size of a declaration, 0 for a single qubit
+// or bit or a size that is not an integer literal
+func declaredSize(expr parser.Expression) int {
+	if lit, ok := expr.(*parser.IntegerLiteral); ok {
+		return int(lit.Value)
+	}
+	return 0
+}
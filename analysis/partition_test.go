@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+const partitionSource = `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[4] q;
+bit[4] c;
+h q;
+cx q[0], q[1];
+cx q[2], q[3];
+c = measure q;
+`
+
+func TestPartition(t *testing.T) {
+	subs := Partition(parse(t, partitionSource), 0)
+	if len(subs) != 2 {
+		t.Fatalf("Partition() returned %d subcircuits, want 2", len(subs))
+	}
+	if got := strings.Join(subs[0].Qubits, " "); got != "q[0] q[1]" {
+		t.Errorf("subs[0].Qubits = %s", got)
+	}
+	if got := strings.Join(subs[1].Qubits, " "); got != "q[2] q[3]" {
+		t.Errorf("subs[1].Qubits = %s", got)
+	}
+
+	want := `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[4] q;
+bit[4] c;
+h q[2];
+h q[3];
+cx q[2], q[3];
+measure q[2] -> c[2];
+measure q[3] -> c[3];
+`
+	if got := printer.Print(subs[1].Program); got != want {
+		t.Errorf("subs[1] =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPartitionLinks(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		parts  int
+	}{
+		{"entangled", "OPENQASM 3.0;\nqubit[3] q;\ncx q[0], q[1];\ncx q[1], q[2];\n", 1},
+		{"feed-forward", "OPENQASM 3.0;\nqubit[2] q;\nbit c;\nc = measure q[0];\nif (c) { x q[1]; }\n", 1},
+		{"loop", "OPENQASM 3.0;\nqubit[2] q;\nfor uint i in [0:1] { h q[0]; x q[1]; }\n", 1},
+		{"unresolved", "OPENQASM 3.0;\nqubit[2] q;\nint i = 1;\nh q[i];\n", 1},
+		{"hardware", "OPENQASM 3.0;\nh $0;\ncx $1, $2;\nx $3;\n", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(Partition(parse(t, tt.source), 0)); got != tt.parts {
+				t.Errorf("Partition() returned %d subcircuits, want %d", got, tt.parts)
+			}
+		})
+	}
+}
+
+func TestPartitionMerges(t *testing.T) {
+	src := `OPENQASM 3.0;
+qubit[6] q;
+cx q[0], q[1];
+cx q[1], q[2];
+h q[3];
+h q[4];
+h q[5];
+`
+	subs := Partition(parse(t, src), 2)
+	if len(subs) != 2 {
+		t.Fatalf("Partition() returned %d subcircuits, want 2", len(subs))
+	}
+	if got := strings.Join(subs[0].Qubits, " "); got != "q[0] q[1] q[2]" {
+		t.Errorf("subs[0].Qubits = %s", got)
+	}
+	if got := strings.Join(subs[1].Qubits, " "); got != "q[3] q[4] q[5]" {
+		t.Errorf("subs[1].Qubits = %s", got)
+	}
+}
+
+func TestPartitionMeasuredDeclaration(t *testing.T) {
+	src := `OPENQASM 3.0;
+qubit[2] q;
+x q[1];
+bit[2] c = measure q;
+`
+	subs := Partition(parse(t, src), 0)
+	if len(subs) != 2 {
+		t.Fatalf("Partition() returned %d subcircuits, want 2", len(subs))
+	}
+	want := `OPENQASM 3.0;
+qubit[2] q;
+x q[1];
+bit[2] c;
+measure q[1] -> c[1];
+`
+	if got := printer.Print(subs[0].Program); got != want {
+		t.Errorf("subs[0] =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPartitionSplitsBarriers(t *testing.T) {
+	src := `OPENQASM 3.0;
+qubit[4] q;
+h q[0];
+h q[1];
+barrier q;
+x q[0];
+`
+	subs := Partition(parse(t, src), 0)
+	if len(subs) != 2 {
+		t.Fatalf("Partition() returned %d subcircuits, want 2", len(subs))
+	}
+	want := []string{
+		"OPENQASM 3.0;\nqubit[4] q;\nh q[0];\nbarrier q[0];\nx q[0];\n",
+		"OPENQASM 3.0;\nqubit[4] q;\nh q[1];\nbarrier q[1];\n",
+	}
+	for i, sub := range subs {
+		if got := printer.Print(sub.Program); got != want[i] {
+			t.Errorf("subs[%d] =\n%s\nwant\n%s", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// FoldingKind classifies a folding range
+type FoldingKind string
+
+const (
+	FoldingRegion  FoldingKind = "region"
+	FoldingComment FoldingKind = "comment"
+)
+
+// FoldingRange is a span of whole lines an editor can collapse. Lines are
+// 1-based and EndLine is the last line of the construct, such as the line
+// of its closing brace.
+type FoldingRange struct {
+	StartLine int         `json:"start_line"`
+	EndLine   int         `json:"end_line"`
+	Kind      FoldingKind `json:"kind"`
+}
+
+// FoldingRanges returns the foldable regions of a program: multi-line gate
+// and subroutine bodies, control-flow blocks, block comments and runs of
+// line comments. Comments are only seen if the program was parsed with
+// IncludeComments.
+func FoldingRanges(program *parser.Program) []FoldingRange {
+	if program == nil {
+		return nil
+	}
+
+	var ranges []FoldingRange
+	var visit func(statements []parser.Statement)
+	visit = func(statements []parser.Statement) {
+		for _, stmt := range statements {
+			var body [][]parser.Statement
+			switch s := stmt.(type) {
+			case *parser.GateDefinition:
+				body = append(body, s.Body)
+			case *parser.SubroutineDefinition:
+				body = append(body, s.Body)
+			case *parser.IfStatement:
+				body = append(body, s.ThenBody, s.ElseBody)
+			case *parser.ForStatement:
+				body = append(body, s.Body)
+			case *parser.WhileStatement:
+				body = append(body, s.Body)
+			case *parser.CalibrationDefinition, *parser.Calibration:
+			default:
+				continue
+			}
+			if start, end := stmt.Pos().Line, stmt.End().Line; end > start {
+				ranges = append(ranges, FoldingRange{StartLine: start, EndLine: end, Kind: FoldingRegion})
+			}
+			for _, b := range body {
+				visit(b)
+			}
+		}
+	}
+	visit(program.Statements)
+
+	ranges = append(ranges, commentFolds(program)...)
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].StartLine < ranges[j].StartLine
+	})
+	return ranges
+}
+
+// commentFolds folds multi-line block comments and runs of two or more
+// line comments on consecutive lines. A comment trailing code ends a run.
+func commentFolds(program *parser.Program) []FoldingRange {
+	code := make(map[int]bool)
+	var mark func(n parser.Node)
+	mark = func(n parser.Node) {
+		if _, ok := n.(parser.Statement); ok {
+			code[n.Pos().Line] = true
+			code[n.End().Line] = true
+		}
+		for _, child := range children(n) {
+			mark(child)
+		}
+	}
+	mark(program)
+
+	var ranges []FoldingRange
+	runStart, runEnd := 0, 0
+	flush := func() {
+		if runEnd > runStart {
+			ranges = append(ranges, FoldingRange{StartLine: runStart, EndLine: runEnd, Kind: FoldingComment})
+		}
+		runStart, runEnd = 0, 0
+	}
+
+	for _, c := range program.Comments {
+		start, end := c.Position.Line, c.End().Line
+		if c.Type == "block" {
+			flush()
+			if end > start {
+				ranges = append(ranges, FoldingRange{StartLine: start, EndLine: end, Kind: FoldingComment})
+			}
+			continue
+		}
+		if code[start] {
+			flush()
+			continue
+		}
+		if runStart != 0 && start == runEnd+1 {
+			runEnd = start
+			continue
+		}
+		flush()
+		runStart, runEnd = start, start
+	}
+	flush()
+
+	return ranges
+}
+
+// SelectionRanges returns the ranges of the nodes enclosing pos, from the
+// innermost outwards, for expanding an editor selection step by step
+func SelectionRanges(program *parser.Program, pos parser.Position) []Range {
+	if program == nil {
+		return nil
+	}
+
+	path := enclosing(program, pos)
+	var ranges []Range
+	for i := len(path) - 1; i >= 0; i-- {
+		r := nodeRange(path[i])
+		if n := len(ranges); n > 0 && ranges[n-1] == r {
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
@@ -0,0 +1,68 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const rangesSource = `OPENQASM 3.0;
+// Registers used
+// by the circuit
+qubit[2] q; // trailing
+/* a block
+   comment */
+gate g(theta) a {
+  rz(theta + 1) a;
+}
+for uint i in [0:1] {
+  if (i == 0) {
+    h q[i];
+  }
+}
+`
+
+func TestFoldingRanges(t *testing.T) {
+	got := FoldingRanges(parse(t, rangesSource))
+	expected := []FoldingRange{
+		{StartLine: 2, EndLine: 3, Kind: FoldingComment},
+		{StartLine: 5, EndLine: 6, Kind: FoldingComment},
+		{StartLine: 7, EndLine: 9, Kind: FoldingRegion},
+		{StartLine: 10, EndLine: 14, Kind: FoldingRegion},
+		{StartLine: 11, EndLine: 13, Kind: FoldingRegion},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestSelectionRanges(t *testing.T) {
+	program := parse(t, rangesSource)
+
+	// Position of "theta" inside rz(theta + 1)
+	ranges := SelectionRanges(program, parser.Position{Line: 8, Column: 7})
+	if len(ranges) != 5 {
+		t.Fatalf("Expected 5 nested ranges, got %d: %+v", len(ranges), ranges)
+	}
+
+	innermost := ranges[0]
+	if innermost.Start != (parser.Position{Line: 8, Column: 6, Offset: innermost.Start.Offset}) || innermost.End.Column != 11 {
+		t.Errorf("Expected the identifier as innermost range, got %+v", innermost)
+	}
+	if ranges[1].End.Column != 15 {
+		t.Errorf("Expected the binary expression next, got %+v", ranges[1])
+	}
+	if ranges[3].Start.Line != 7 || ranges[3].End.Line != 9 {
+		t.Errorf("Expected the gate definition, got %+v", ranges[3])
+	}
+	if ranges[4].Start.Line != 1 {
+		t.Errorf("Expected the program as outermost range, got %+v", ranges[4])
+	}
+
+	for i := 1; i < len(ranges); i++ {
+		if before(ranges[i-1].Start, ranges[i].Start) || before(ranges[i].End, ranges[i-1].End) {
+			t.Errorf("Range %d does not contain range %d", i, i-1)
+		}
+	}
+}
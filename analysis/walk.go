@@ -0,0 +1,145 @@
+package analysis
+
+import (
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// children returns the direct child nodes of n in source order
+func children(n parser.Node) []parser.Node {
+	var nodes []parser.Node
+	add := func(child parser.Node) {
+		// Nodes built by hand rather than parsed have no position
+		if child.Pos().Line > 0 {
+			nodes = append(nodes, child)
+		}
+	}
+	addExpr := func(e parser.Expression) {
+		if e != nil {
+			add(e)
+		}
+	}
+	addStatements := func(statements []parser.Statement) {
+		for _, s := range statements {
+			add(s)
+		}
+	}
+	addParameters := func(params []parser.Parameter) {
+		for i := range params {
+			add(&params[i])
+		}
+	}
+
+	switch node := n.(type) {
+	case *parser.Program:
+		if node.Version != nil {
+			add(node.Version)
+		}
+		addStatements(node.Statements)
+	case *parser.QuantumDeclaration:
+		addExpr(node.Size)
+	case *parser.ClassicalDeclaration:
+		addExpr(node.Size)
+		if node.Array != nil {
+			for _, e := range node.Array.Dimensions {
+				addExpr(e)
+			}
+		}
+		addExpr(node.Initializer)
+	case *parser.GateCall:
+		for i := range node.Modifiers {
+			add(&node.Modifiers[i])
+		}
+		for _, e := range node.Parameters {
+			addExpr(e)
+		}
+		for _, e := range node.Qubits {
+			addExpr(e)
+		}
+	case *parser.Modifier:
+		for _, e := range node.Parameters {
+			addExpr(e)
+		}
+	case *parser.Barrier:
+		for _, e := range node.Qubits {
+			addExpr(e)
+		}
+	case *parser.Reset:
+		addExpr(node.Qubit)
+	case *parser.Measurement:
+		addExpr(node.Qubit)
+		addExpr(node.Target)
+	case *parser.Assignment:
+		addExpr(node.Target)
+		addExpr(node.Value)
+	case *parser.GateDefinition:
+		addParameters(node.Parameters)
+		addParameters(node.Qubits)
+		addStatements(node.Body)
+	case *parser.SubroutineDefinition:
+		addParameters(node.Parameters)
+		addStatements(node.Body)
+	case *parser.CalibrationDefinition:
+		addParameters(node.Parameters)
+		for _, e := range node.Qubits {
+			addExpr(e)
+		}
+	case *parser.IfStatement:
+		addExpr(node.Condition)
+		addStatements(node.ThenBody)
+		addStatements(node.ElseBody)
+	case *parser.ForStatement:
+		addExpr(node.Iterable)
+		addStatements(node.Body)
+	case *parser.WhileStatement:
+		addExpr(node.Condition)
+		addStatements(node.Body)
+	case *parser.IndexedIdentifier:
+		addExpr(node.Index)
+		for _, e := range node.Indices {
+			addExpr(e)
+		}
+	case *parser.RangedIdentifier:
+		addExpr(node.Start)
+		addExpr(node.EndIndex)
+	case *parser.RangeExpression:
+		addExpr(node.Start)
+		addExpr(node.Step)
+		addExpr(node.Stop)
+	case *parser.BinaryExpression:
+		addExpr(node.Left)
+		addExpr(node.Right)
+	case *parser.UnaryExpression:
+		addExpr(node.Operand)
+	case *parser.ParenthesizedExpression:
+		addExpr(node.Expression)
+	case *parser.FunctionCall:
+		for _, e := range node.Arguments {
+			addExpr(e)
+		}
+	case *parser.MeasureExpression:
+		addExpr(node.Qubit)
+	case *parser.ArrayLiteral:
+		for _, e := range node.Elements {
+			addExpr(e)
+		}
+	}
+	return nodes
+}
+
+// enclosing returns the nodes containing pos, outermost first
+func enclosing(program *parser.Program, pos parser.Position) []parser.Node {
+	var path []parser.Node
+	var node parser.Node = program
+	for node != nil {
+		path = append(path, node)
+		var next parser.Node
+		for _, child := range children(node) {
+			if nodeRange(child).Contains(pos) {
+				next = child
+				break
+			}
+		}
+		node = next
+	}
+	return path
+}
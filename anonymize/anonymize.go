@@ -0,0 +1,276 @@
+// Package anonymize strips the identifying details from a circuit so it
+// can be shared, for example in a bug report, without revealing
+// proprietary names: user identifiers become generic names (q0, g1, ...),
+// and comments, pragmas and the original formatting are dropped.
+package anonymize
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/stdlib"
+)
+
+// Prefixes of the generated names by what they name
+const (
+	prefixQubit      = "q"
+	prefixClassical  = "c"
+	prefixGate       = "g"
+	prefixSubroutine = "f"
+	prefixParameter  = "p"
+	prefixArgument   = "a"
+	prefixLoop       = "i"
+	prefixOther      = "v"
+)
+
+// Program renames the user identifiers of program in place and returns
+// the renaming, from original to new name. Names are assigned in order of
+// first appearance, so the result is deterministic. Predefined names,
+// such as pi, U and the gates of standard includes the program uses, are
+// kept, as are hardware qubits such as $0; custom include paths are
+// replaced too, since they can reveal names. Statements the parser could
+// not recover or the AST has no node for are removed and calibration
+// bodies emptied, as their raw text cannot be anonymized, and the run
+// configuration is dropped with the pragmas that set it.
+func Program(program *parser.Program) map[string]string {
+	r := &renamer{
+		declared: make(map[string]bool),
+		names:    make(map[string]string),
+		counts:   make(map[string]int),
+		std:      make(map[string]bool),
+	}
+	for _, stmt := range program.Statements {
+		if inc, ok := stmt.(*parser.Include); ok && stdlib.IsStandard(inc.Path) {
+			for _, g := range stdlib.Gates(inc.Path) {
+				r.std[g] = true
+			}
+		}
+	}
+	r.collect(program.Statements)
+	program.Statements = r.statements(program.Statements)
+	program.Comments = nil
+	program.Run = nil
+	return r.names
+}
+
+// Source parses src, anonymizes it and prints it in canonical form. A
+// program with syntax errors is an error, not a partial rendering.
+func Source(src string) (string, error) {
+	result := parser.NewParserWithOptions(&parser.ParseOptions{ErrorRecovery: false}).ParseWithErrors(src)
+	if err := result.Err(); err != nil {
+		return "", err
+	}
+	Program(result.Program)
+	return printer.Print(result.Program), nil
+}
+
+type renamer struct {
+	declared map[string]bool
+	names    map[string]string
+	counts   map[string]int
+	std      map[string]bool
+	includes int
+}
+
+// collect records every name the program declares, so a declared name
+// shadowing a predefined one is still renamed
+func (r *renamer) collect(statements []parser.Statement) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.QuantumDeclaration:
+			r.declared[s.Identifier] = true
+		case *parser.ClassicalDeclaration:
+			r.declared[s.Identifier] = true
+		case *parser.GateDefinition:
+			r.declared[s.Name] = true
+			r.collect(s.Body)
+		case *parser.SubroutineDefinition:
+			r.declared[s.Name] = true
+			r.collect(s.Body)
+		case *parser.IfStatement:
+			r.collect(s.ThenBody)
+			r.collect(s.ElseBody)
+		case *parser.ForStatement:
+			r.collect(s.Body)
+		case *parser.WhileStatement:
+			r.collect(s.Body)
+		}
+	}
+}
+
+// rename returns the new name for name, assigning one with prefix on
+// first use
+func (r *renamer) rename(name, prefix string) string {
+	if renamed, ok := r.names[name]; ok {
+		return renamed
+	}
+	renamed := fmt.Sprintf("%s%d", prefix, r.counts[prefix])
+	r.counts[prefix]++
+	r.names[name] = renamed
+	return renamed
+}
+
+// reference renames a name that is used rather than declared, unless it
+// is predefined
+func (r *renamer) reference(name, prefix string) string {
+	if strings.HasPrefix(name, "$") {
+		return name
+	}
+	if !r.declared[name] && (stdlib.IsConstant(name) || stdlib.IsFunction(name) || stdlib.IsBuiltinGate(name) || r.std[name]) {
+		return name
+	}
+	return r.rename(name, prefix)
+}
+
+func (r *renamer) parameters(params []parser.Parameter, prefix string) {
+	for i := range params {
+		params[i].Name = r.rename(params[i].Name, prefix)
+	}
+}
+
+// statements renames within statements and returns them without those
+// kept as raw text
+func (r *renamer) statements(statements []parser.Statement) []parser.Statement {
+	kept := statements[:0]
+	for _, stmt := range statements {
+		switch stmt.(type) {
+		case *parser.BadStatement, *parser.RawStatement:
+			continue
+		}
+		// Annotation content is free text that may name anything
+		parser.SetAnnotations(stmt, nil)
+		r.statement(stmt)
+		kept = append(kept, stmt)
+	}
+	return kept
+}
+
+func (r *renamer) statement(stmt parser.Statement) {
+	switch s := stmt.(type) {
+	case *parser.Include:
+		if !stdlib.IsStandard(s.Path) {
+			s.Path = fmt.Sprintf("include%d.inc", r.includes)
+			r.includes++
+		}
+	case *parser.QuantumDeclaration:
+		s.Identifier = r.rename(s.Identifier, prefixQubit)
+		r.expression(s.Size)
+	case *parser.ClassicalDeclaration:
+		s.Identifier = r.rename(s.Identifier, prefixClassical)
+		r.expression(s.Size)
+		if s.Array != nil {
+			r.expressions(s.Array.Dimensions)
+		}
+		r.expression(s.Initializer)
+	case *parser.GateCall:
+		for i := range s.Modifiers {
+			r.expressions(s.Modifiers[i].Parameters)
+		}
+		s.Name = r.reference(s.Name, prefixGate)
+		r.expressions(s.Parameters)
+		r.expressions(s.Qubits)
+	case *parser.Barrier:
+		r.expressions(s.Qubits)
+	case *parser.Reset:
+		r.expression(s.Qubit)
+	case *parser.Measurement:
+		r.expression(s.Qubit)
+		r.expression(s.Target)
+	case *parser.Assignment:
+		r.expression(s.Target)
+		r.expression(s.Value)
+	case *parser.GateDefinition:
+		s.Name = r.rename(s.Name, prefixGate)
+		r.parameters(s.Parameters, prefixParameter)
+		r.parameters(s.Qubits, prefixArgument)
+		s.Body = r.statements(s.Body)
+	case *parser.SubroutineDefinition:
+		s.Name = r.rename(s.Name, prefixSubroutine)
+		r.parameters(s.Parameters, prefixParameter)
+		s.Body = r.statements(s.Body)
+	case *parser.CalibrationDefinition:
+		s.Name = r.reference(s.Name, prefixGate)
+		for i, p := range s.Parameters {
+			if p.Type != "" {
+				s.Parameters[i].Name = r.rename(p.Name, prefixParameter)
+			}
+		}
+		r.expressions(s.Qubits)
+		s.Body = ""
+		s.Declarations, s.References = nil, nil
+	case *parser.Calibration:
+		s.Body = ""
+		s.Declarations, s.References = nil, nil
+	case *parser.IfStatement:
+		r.expression(s.Condition)
+		s.ThenBody = r.statements(s.ThenBody)
+		s.ElseBody = r.statements(s.ElseBody)
+	case *parser.ForStatement:
+		s.Variable = r.rename(s.Variable, prefixLoop)
+		r.expression(s.Iterable)
+		s.Body = r.statements(s.Body)
+	case *parser.WhileStatement:
+		r.expression(s.Condition)
+		s.Body = r.statements(s.Body)
+	}
+}
+
+func (r *renamer) expressions(exprs []parser.Expression) {
+	for _, e := range exprs {
+		r.expression(e)
+	}
+}
+
+func (r *renamer) expression(expr parser.Expression) {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		e.Name = r.reference(e.Name, prefixOther)
+	case *parser.IndexedIdentifier:
+		e.Name = r.reference(e.Name, prefixOther)
+		r.expression(e.Index)
+		r.expressions(e.Indices)
+	case *parser.RangedIdentifier:
+		e.Name = r.reference(e.Name, prefixOther)
+		r.expression(e.Start)
+		r.expression(e.EndIndex)
+	case *parser.RangeExpression:
+		r.expression(e.Start)
+		r.expression(e.Step)
+		r.expression(e.Stop)
+	case *parser.MeasureExpression:
+		r.expression(e.Qubit)
+	case *parser.ArrayLiteral:
+		r.expressions(e.Elements)
+	case *parser.BinaryExpression:
+		r.expression(e.Left)
+		r.expression(e.Right)
+	case *parser.UnaryExpression:
+		r.expression(e.Operand)
+	case *parser.ParenthesizedExpression:
+		r.expression(e.Expression)
+	case *parser.FunctionCall:
+		// Casts are function calls named by their type, e.g. float[64]
+		if !isTypeName(e.Name) {
+			e.Name = r.reference(e.Name, prefixSubroutine)
+		}
+		r.expressions(e.Arguments)
+	case *parser.StringLiteral:
+		// Bitstrings are values, but free text can identify its author
+		if strings.Trim(e.Value, "01_") != "" {
+			e.Value = ""
+		}
+	}
+}
+
+// isTypeName reports whether name spells a type rather than a function
+func isTypeName(name string) bool {
+	base, _, _ := strings.Cut(name, "[")
+	for _, def := range parser.Vocabulary() {
+		if def.Class == parser.TokenType && def.Literal == base {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package anonymize
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestSource(t *testing.T) {
+	src := `OPENQASM 3.0;
+include "stdgates.inc";
+include "secret_lib.inc";
+// proprietary ansatz
+qubit[2] alice;
+bit[2] result;
+gate entangle(theta) a, b {
+  rz(theta / 2) a;
+  cx a, b;
+}
+pragma secret
+pragma shots 1000
+pragma qasmparser.dump_probs after_secret_ansatz
+@secret_hint alice
+entangle(pi) alice[0], alice[1];
+for int step in [0:1] {
+  h alice[step];
+}
+result = measure alice;
+cal { extern port secret_port; }
+defcal entangle(angle theta) $0, $1 { play(secret_frame, wf); }
+entangle(pi) $0, $1;
+`
+	got, err := Source(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `OPENQASM 3.0;
+include "stdgates.inc";
+include "include0.inc";
+qubit[2] q0;
+bit[2] c0;
+gate g0(p0) a0, a1 {
+  rz(p0 / 2) a0;
+  cx a0, a1;
+}
+g0(pi) q0[0], q0[1];
+for int i0 in [0:1] {
+  h q0[i0];
+}
+measure q0 -> c0;
+cal {}
+defcal g0(angle p0) $0, $1 {}
+g0(pi) $0, $1;
+`
+	if got != want {
+		t.Errorf("Source() =\n%s\nwant\n%s", got, want)
+	}
+	for _, leak := range []string{"alice", "entangle", "secret", "proprietary", "theta", "pragma"} {
+		if strings.Contains(got, leak) {
+			t.Errorf("output leaks %q", leak)
+		}
+	}
+}
+
+func TestSourceSyntaxError(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit[2] alice;\nh alice[0]\ncx alice[0], alice[1];\n"
+	if got, err := Source(src); err == nil {
+		t.Errorf("Source() = %q, want a syntax error", got)
+	}
+}
+
+func TestProgramDeterministic(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit a;\nqubit b;\nmy_gate a, b;\nx a;\n"
+	var first string
+	for i := 0; i < 5; i++ {
+		got, err := Source(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = got
+		} else if got != first {
+			t.Fatalf("run %d differs:\n%s\nfirst:\n%s", i, got, first)
+		}
+	}
+	// x is not predefined without stdgates.inc, so it is renamed too
+	if !strings.Contains(first, "g0 q0, q1;") || !strings.Contains(first, "g1 q0;") {
+		t.Errorf("unexpected output:\n%s", first)
+	}
+}
+
+func TestProgramMapping(t *testing.T) {
+	program, err := parser.NewParser().ParseString("OPENQASM 3.0;\nqubit q;\nfloat[64] pi = 1.0;\nU(pi, 0, 0) q;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := Program(program)
+	want := map[string]string{"q": "q0", "pi": "c0"}
+	if len(names) != len(want) {
+		t.Fatalf("Program() = %v, want %v", names, want)
+	}
+	for from, to := range want {
+		if names[from] != to {
+			t.Errorf("names[%q] = %q, want %q", from, names[from], to)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// Package archive reads many programs submitted at once, as zip or tar
+// archives or multipart uploads, and parses them as one batch. Clients
+// validating a whole project send one request instead of one per file.
+// A Batch also carries how each program is to be run, as experiments are
+// submitted.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/metrics"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Default limits of the Options whose zero value is not unlimited
+const (
+	DefaultMaxTotalSize    = 256 << 20
+	DefaultMaxArchiveBytes = 64 << 20
+)
+
+// Options bounds what an archive may contain
+type Options struct {
+	// MaxEntrySize rejects archives with a program larger than this many
+	// bytes. Zero means no limit.
+	MaxEntrySize int64
+
+	// MaxEntries rejects archives with more programs than this. Zero
+	// means no limit.
+	MaxEntries int
+
+	// MaxTotalSize rejects archives whose programs add up to more than
+	// this many bytes uncompressed, so a small compressed archive cannot
+	// claim unbounded memory. Zero means DefaultMaxTotalSize and a
+	// negative value no limit.
+	MaxTotalSize int64
+
+	// MaxArchiveBytes bounds the request bodies Handler reads, as
+	// uploaded. Zero means DefaultMaxArchiveBytes and a negative value no
+	// limit.
+	MaxArchiveBytes int64
+
+	// Metrics, if set, records the time Handler spends parsing each
+	// program
+	Metrics *metrics.Metrics
+}
+
+// IsProgram reports whether an entry name has a QASM extension. Other
+// entries of an archive are ignored.
+func IsProgram(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".qasm" || ext == ".inc"
+}
+
+// limit returns the limit a field stands for, given its default, or -1
+// for no limit
+func limit(n, def int64) int64 {
+	switch {
+	case n == 0:
+		return def
+	case n < 0:
+		return -1
+	}
+	return n
+}
+
+// reader collects the programs of one archive within its limits
+type reader struct {
+	opts    Options
+	total   int64
+	sources []parser.Source
+}
+
+func newReader(opts *Options) *reader {
+	r := &reader{}
+	if opts != nil {
+		r.opts = *opts
+	}
+	return r
+}
+
+func (r *reader) add(name string, content io.Reader) error {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if !IsProgram(name) {
+		return nil
+	}
+	if r.opts.MaxEntries > 0 && len(r.sources) >= r.opts.MaxEntries {
+		return fmt.Errorf("archive has more than %d programs", r.opts.MaxEntries)
+	}
+	// Entries are read no further than either limit allows, however large
+	// they claim to be
+	max := int64(-1)
+	if r.opts.MaxEntrySize > 0 {
+		max = r.opts.MaxEntrySize
+	}
+	if total := limit(r.opts.MaxTotalSize, DefaultMaxTotalSize); total >= 0 && (max < 0 || total-r.total < max) {
+		max = total - r.total
+	}
+	if max >= 0 {
+		content = io.LimitReader(content, max+1)
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return r.keep(parser.Source{Name: name, Content: data})
+}
+
+// keep adds a program read in full, checking it against the limits
+func (r *reader) keep(src parser.Source) error {
+	size := int64(len(src.Content))
+	if r.opts.MaxEntrySize > 0 && size > r.opts.MaxEntrySize {
+		return fmt.Errorf("%s: larger than %d bytes", src.Name, r.opts.MaxEntrySize)
+	}
+	if total := limit(r.opts.MaxTotalSize, DefaultMaxTotalSize); total >= 0 && size > total-r.total {
+		return fmt.Errorf("%s: programs add up to more than %d bytes", src.Name, total)
+	}
+	r.total += size
+	r.sources = append(r.sources, src)
+	return nil
+}
+
+// ReadZip returns the programs in a zip archive
+func ReadZip(ra io.ReaderAt, size int64, opts *Options) ([]parser.Source, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	r := newReader(opts)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		err = r.add(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r.sources, nil
+}
+
+// ReadTar returns the programs in a tar archive, which may be gzipped
+func ReadTar(in io.Reader, opts *Options) ([]parser.Source, error) {
+	br := bufio.NewReader(in)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		in = gz
+	} else {
+		in = br
+	}
+
+	tr := tar.NewReader(in)
+	r := newReader(opts)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return r.sources, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := r.add(hdr.Name, tr); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ReadMultipart returns the programs uploaded as the file parts of a
+// multipart form. Programs are named by the base name of each part's file
+// name, as mime/multipart drops directories.
+func ReadMultipart(mr *multipart.Reader, opts *Options) ([]parser.Source, error) {
+	r := newReader(opts)
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return r.sources, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if name := part.FileName(); name != "" {
+			err = r.add(name, part)
+		}
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Response is the body Handler answers with
+type Response struct {
+	Results []*parser.ParseFileResult `json:"results"`
+}
+
+// Handler parses a batch of programs posted as a multipart form
+// (multipart/form-data), a zip archive (application/zip), a tar archive
+// (application/x-tar or application/gzip) or a JSON Lines Batch
+// (application/jsonl or application/x-ndjson), and answers with a JSON
+// Response holding one result per program. Batch options bound the
+// parallelism and per-program budgets; opts bound the upload, and a body
+// larger than MaxArchiveBytes is answered with 413 Request Entity Too
+// Large.
+func Handler(p *parser.Parser, batch *parser.BatchOptions, opts *Options) http.Handler {
+	var max int64 = DefaultMaxArchiveBytes
+	if opts != nil {
+		max = limit(opts.MaxArchiveBytes, DefaultMaxArchiveBytes)
+		if m := opts.Metrics; m != nil {
+			batch = observe(batch, m)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if max >= 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+		}
+		sources, err := readRequest(r, opts)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("upload is larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := Response{Results: p.ParseSources(r.Context(), sources, batch)}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// observe returns a copy of batch that also records parse times in m
+func observe(batch *parser.BatchOptions, m *metrics.Metrics) *parser.BatchOptions {
+	observed := parser.BatchOptions{}
+	if batch != nil {
+		observed = *batch
+	}
+	progress := observed.Progress
+	observed.Progress = func(p parser.Progress) {
+		if p.Result == nil || !p.Result.Skipped {
+			m.ObserveParse(p.Duration)
+		}
+		if progress != nil {
+			progress(p)
+		}
+	}
+	return &observed
+}
+
+// readRequest reads the programs from a request body by its content type
+func readRequest(r *http.Request, opts *Options) ([]parser.Source, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("content type: %w", err)
+	}
+	switch mediaType {
+	case "multipart/form-data":
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+		return ReadMultipart(mr, opts)
+	case "application/zip":
+		// Zip needs random access, so the body is read into memory, as far
+		// as Handler's MaxBytesReader lets it
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return ReadZip(bytes.NewReader(data), int64(len(data)), opts)
+	case "application/x-tar", "application/gzip", "application/x-gzip":
+		return ReadTar(r.Body, opts)
+	case "application/jsonl", "application/x-ndjson":
+		batch, err := ReadJSONL(r.Body, opts)
+		if err != nil {
+			return nil, err
+		}
+		return batch.Sources(), nil
+	}
+	return nil, fmt.Errorf("unsupported content type %q", mediaType)
+}
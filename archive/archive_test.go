@@ -0,0 +1,239 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/metrics"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+var files = map[string]string{
+	"good.qasm":       "OPENQASM 3.0;\nqubit q;\n",
+	"lib/defs.inc":    "gate g a { U(0, 0, 0) a; }\n",
+	"README.md":       "not a program",
+	"nested/bad.qasm": "OPENQASM 3.0;\nqubit q\n",
+}
+
+func zipArchive(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"good.qasm", "lib/defs.inc", "README.md", "nested/bad.qasm"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, compress bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+	for _, name := range []string{"good.qasm", "lib/defs.inc", "README.md", "nested/bad.qasm"} {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func names(sources []parser.Source) string {
+	var out []string
+	for _, src := range sources {
+		out = append(out, src.Name)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestReadArchives(t *testing.T) {
+	want := "good.qasm,lib/defs.inc,nested/bad.qasm"
+
+	data := zipArchive(t)
+	sources, err := ReadZip(bytes.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(sources); got != want {
+		t.Errorf("ReadZip() entries = %s, want %s", got, want)
+	}
+	if string(sources[0].Content) != files["good.qasm"] {
+		t.Errorf("content = %q", sources[0].Content)
+	}
+
+	for _, compress := range []bool{false, true} {
+		sources, err := ReadTar(bytes.NewReader(tarArchive(t, compress)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(sources); got != want {
+			t.Errorf("ReadTar(gzip=%v) entries = %s, want %s", compress, got, want)
+		}
+	}
+}
+
+func TestReadLimits(t *testing.T) {
+	data := zipArchive(t)
+	if _, err := ReadZip(bytes.NewReader(data), int64(len(data)), &Options{MaxEntries: 2}); err == nil {
+		t.Error("expected too many programs error")
+	}
+	if _, err := ReadTar(bytes.NewReader(tarArchive(t, false)), &Options{MaxEntrySize: 16}); err == nil || !strings.Contains(err.Error(), "larger than 16 bytes") {
+		t.Errorf("expected entry size error, got %v", err)
+	}
+}
+
+func TestReadTotalSize(t *testing.T) {
+	// A megabyte of zeros compresses to about a kilobyte
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"a.qasm", "b.qasm"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(make([]byte, 1<<20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if _, err := ReadZip(bytes.NewReader(data), int64(len(data)), &Options{MaxTotalSize: 3 << 19}); err == nil || !strings.Contains(err.Error(), "b.qasm: programs add up to more than 1572864 bytes") {
+		t.Errorf("expected total size error, got %v", err)
+	}
+	if _, err := ReadZip(bytes.NewReader(data), int64(len(data)), &Options{MaxTotalSize: 2 << 20}); err != nil {
+		t.Errorf("archive within the total size: %v", err)
+	}
+}
+
+// response is Response decoded without the AST, whose interface fields
+// cannot be unmarshaled
+type response struct {
+	Results []struct {
+		File   string              `json:"file"`
+		Errors []parser.ParseError `json:"errors"`
+	} `json:"results"`
+}
+
+func post(t *testing.T, h http.Handler, contentType string, body []byte) response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestHandler(t *testing.T) {
+	p := parser.NewParserWithOptions(&parser.ParseOptions{ErrorRecovery: false})
+	h := Handler(p, &parser.BatchOptions{Concurrency: 2}, nil)
+
+	check := func(resp response) {
+		t.Helper()
+		if len(resp.Results) != 3 {
+			t.Fatalf("got %d results, want 3", len(resp.Results))
+		}
+		for _, r := range resp.Results {
+			if wantErr := strings.HasSuffix(r.File, "bad.qasm"); (len(r.Errors) > 0) != wantErr {
+				t.Errorf("%s: errors = %v, want errors %v", r.File, r.Errors, wantErr)
+			}
+		}
+	}
+	check(post(t, h, "application/zip", zipArchive(t)))
+	check(post(t, h, "application/gzip", tarArchive(t, true)))
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, name := range []string{"good.qasm", "lib/defs.inc", "nested/bad.qasm"} {
+		w, err := mw.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	check(post(t, h, mw.FormDataContentType(), body.Bytes()))
+
+	var jsonl bytes.Buffer
+	batch := Batch{}
+	for _, name := range []string{"good.qasm", "lib/defs.inc", "nested/bad.qasm"} {
+		batch = append(batch, Entry{Source: parser.Source{Name: name, Content: []byte(files[name])}})
+	}
+	if err := WriteJSONL(&jsonl, batch); err != nil {
+		t.Fatal(err)
+	}
+	check(post(t, h, "application/jsonl", jsonl.Bytes()))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader("x"))
+	req.Header.Set("Content-Type", "text/plain")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unsupported content type: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	m := metrics.New()
+	observed := Handler(p, nil, &Options{Metrics: m})
+	check(post(t, observed, "application/zip", zipArchive(t)))
+	var out strings.Builder
+	if err := m.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "qasmparser_parse_duration_seconds_count 3\n") {
+		t.Errorf("parse times not recorded:\n%s", out.String())
+	}
+
+	small := Handler(p, nil, &Options{MaxArchiveBytes: 64})
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader(zipArchive(t)))
+	req.Header.Set("Content-Type", "application/zip")
+	small.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized upload: status %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
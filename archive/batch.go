@@ -0,0 +1,252 @@
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/endian"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Manifest is the name of the entry of a batch zip that lists its
+// programs with their metadata
+const Manifest = "batch.jsonl"
+
+// Metadata is how a program of a batch is to be run
+type Metadata struct {
+	// Shots is the number of times to run the program; zero leaves it to
+	// the backend
+	Shots int `json:"shots,omitempty"`
+
+	// Seed seeds the randomness of a simulation, nil to leave it to the
+	// backend
+	Seed *int64 `json:"seed,omitempty"`
+
+	// Parameters are values for the program's input parameters, by name
+	Parameters map[string]float64 `json:"parameters,omitempty"`
+
+	// BitOrder is the order the program's results are to be written in;
+	// empty means little endian
+	BitOrder endian.Order `json:"bit_order,omitempty"`
+
+	// Labels are annotations from the tool that made the batch, such as
+	// which parameter a gradient circuit shifts, passed through unchanged
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// WithRun returns m with the shots and seed it leaves unset taken from a
+// program's execution pragmas, so a batch carries them to the backend
+// even when its manifest does not repeat them
+func (m Metadata) WithRun(run *parser.RunConfig) Metadata {
+	if run == nil {
+		return m
+	}
+	if m.Shots == 0 {
+		m.Shots = run.Shots
+	}
+	if m.Seed == nil && run.Seed != nil {
+		seed := *run.Seed
+		m.Seed = &seed
+	}
+	return m
+}
+
+// Entry is a program of a batch with its metadata
+type Entry struct {
+	parser.Source
+	Metadata Metadata
+}
+
+// Batch is a set of programs submitted together, such as the circuits of
+// one experiment. It is stored either as JSON Lines, one program per
+// line with its source inline:
+//
+//	{"name": "bell.qasm", "source": "OPENQASM 3.0;\n...", "shots": 1000}
+//	{"name": "ry.qasm", "source": "...", "parameters": {"theta": 0.5}}
+//
+// or as a zip archive of programs with a Manifest listing them in the
+// same form without the source.
+type Batch []Entry
+
+// line is an entry as a line of JSON
+type line struct {
+	Name   string  `json:"name"`
+	Source *string `json:"source,omitempty"`
+	Metadata
+}
+
+// Sources returns the programs of b, to be parsed with
+// parser.ParseSources. Results are in the same order as b.
+func (b Batch) Sources() []parser.Source {
+	sources := make([]parser.Source, len(b))
+	for i, e := range b {
+		sources[i] = e.Source
+	}
+	return sources
+}
+
+// Validate checks the metadata of b: every program has a name no other
+// has, shots are not negative, parameters are named by identifiers and
+// bit orders are known.
+// It does not parse the programs.
+func (b Batch) Validate() []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, e := range b {
+		switch {
+		case e.Name == "":
+			errs = append(errs, fmt.Errorf("program %d has no name", i))
+		case seen[e.Name]:
+			errs = append(errs, fmt.Errorf("%s: more than one program has this name", e.Name))
+		}
+		seen[e.Name] = true
+		if e.Metadata.Shots < 0 {
+			errs = append(errs, fmt.Errorf("%s: shots %d is negative", e.Name, e.Metadata.Shots))
+		}
+		for _, name := range slices.Sorted(maps.Keys(e.Metadata.Parameters)) {
+			if !parser.IsValidIdentifier(name) {
+				errs = append(errs, fmt.Errorf("%s: parameter %q is not an identifier", e.Name, name))
+			}
+		}
+		if _, err := endian.ParseOrder(string(e.Metadata.BitOrder)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+		}
+	}
+	return errs
+}
+
+// ReadJSONL reads a batch stored as JSON Lines. Blank lines are skipped.
+func ReadJSONL(in io.Reader, opts *Options) (Batch, error) {
+	r := newReader(opts)
+	var batch Batch
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1<<30)
+	for n := 1; scanner.Scan(); n++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var l line
+		if err := json.Unmarshal(text, &l); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if l.Source == nil {
+			return nil, fmt.Errorf("line %d: %s has no source", n, l.Name)
+		}
+		if r.opts.MaxEntries > 0 && len(batch) >= r.opts.MaxEntries {
+			return nil, fmt.Errorf("batch has more than %d programs", r.opts.MaxEntries)
+		}
+		src := parser.Source{Name: l.Name, Content: []byte(*l.Source)}
+		if err := r.keep(src); err != nil {
+			return nil, err
+		}
+		batch = append(batch, Entry{Source: src, Metadata: l.Metadata})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// WriteJSONL writes b as JSON Lines
+func WriteJSONL(w io.Writer, b Batch) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, e := range b {
+		source := string(e.Content)
+		if err := enc.Encode(line{Name: e.Name, Source: &source, Metadata: e.Metadata}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadBatchZip reads a batch stored as a zip archive. Programs the
+// Manifest lists come first, in its order and with its metadata; the
+// other programs of the archive follow without metadata. An archive
+// without a Manifest is a batch of all its programs.
+func ReadBatchZip(ra io.ReaderAt, size int64, opts *Options) (Batch, error) {
+	sources, err := ReadZip(ra, size, opts)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := zr.Open(Manifest)
+	if err != nil {
+		batch := make(Batch, len(sources))
+		for i, src := range sources {
+			batch[i] = Entry{Source: src}
+		}
+		return batch, nil
+	}
+	defer manifest.Close()
+
+	byName := make(map[string]int, len(sources))
+	for i, src := range sources {
+		byName[src.Name] = i
+	}
+	listed := make([]bool, len(sources))
+	var batch Batch
+	var in io.Reader = manifest
+	if max := limit(newReader(opts).opts.MaxTotalSize, DefaultMaxTotalSize); max >= 0 {
+		in = io.LimitReader(manifest, max)
+	}
+	dec := json.NewDecoder(in)
+	for dec.More() {
+		var l line
+		if err := dec.Decode(&l); err != nil {
+			return nil, fmt.Errorf("%s: %w", Manifest, err)
+		}
+		i, ok := byName[path.Clean(strings.TrimPrefix(l.Name, "/"))]
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is not a program of the archive", Manifest, l.Name)
+		}
+		listed[i] = true
+		batch = append(batch, Entry{Source: sources[i], Metadata: l.Metadata})
+	}
+	for i, src := range sources {
+		if !listed[i] {
+			batch = append(batch, Entry{Source: src})
+		}
+	}
+	return batch, nil
+}
+
+// WriteZip writes b as a zip archive of its programs and a Manifest
+func WriteZip(w io.Writer, b Batch) error {
+	zw := zip.NewWriter(w)
+	var manifest bytes.Buffer
+	enc := json.NewEncoder(&manifest)
+	enc.SetEscapeHTML(false)
+	for _, e := range b {
+		f, err := zw.Create(e.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(e.Content); err != nil {
+			return err
+		}
+		if err := enc.Encode(line{Name: e.Name, Metadata: e.Metadata}); err != nil {
+			return err
+		}
+	}
+	f, err := zw.Create(Manifest)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(manifest.Bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,152 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+var batch = Batch{
+	{Source: parser.Source{Name: "bell.qasm", Content: []byte("OPENQASM 3.0;\nqubit[2] q;\nh q[0];\ncx q[0], q[1];\n")},
+		Metadata: Metadata{Shots: 1000}},
+	{Source: parser.Source{Name: "sweep/ry.qasm", Content: []byte("OPENQASM 3.0;\ninput float theta;\nqubit q;\nry(theta) q;\n")},
+		Metadata: Metadata{Shots: 200, Parameters: map[string]float64{"theta": 0.5}}},
+	{Source: parser.Source{Name: "broken.qasm", Content: []byte("OPENQASM 3.0;\nqubit q\n")}},
+}
+
+func TestJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSONL(&buf, batch); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := `{"name":"bell.qasm","source":"OPENQASM 3.0;\nqubit[2] q;\nh q[0];\ncx q[0], q[1];\n","shots":1000}`
+	if len(lines) != 3 || lines[0] != want {
+		t.Fatalf("WriteJSONL() =\n%s", buf.String())
+	}
+
+	got, err := ReadJSONL(strings.NewReader(buf.String()+"\n\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, batch) {
+		t.Errorf("ReadJSONL() = %+v, want %+v", got, batch)
+	}
+
+	if _, err := ReadJSONL(strings.NewReader(`{"name": "a.qasm", "shots": 5}`), nil); err == nil || !strings.Contains(err.Error(), "no source") {
+		t.Errorf("line without source: err = %v", err)
+	}
+	if _, err := ReadJSONL(strings.NewReader("{\"name\": \"a.qasm\", \"source\": \"\"}\nnot json\n"), nil); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("malformed line: err = %v", err)
+	}
+	if _, err := ReadJSONL(strings.NewReader(buf.String()), &Options{MaxEntries: 2}); err == nil {
+		t.Error("expected too many programs error")
+	}
+}
+
+func TestBatchZip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteZip(&buf, batch); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadBatchZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, batch) {
+		t.Errorf("ReadBatchZip() = %+v, want %+v", got, batch)
+	}
+
+	// Programs the manifest does not list follow those it does
+	buf.Reset()
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"a.qasm":   "OPENQASM 3.0;\n",
+		Manifest:   `{"name": "b.qasm", "shots": 10}` + "\n",
+		"b.qasm":   "OPENQASM 3.0;\n",
+		"notes.md": "not a program",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ReadBatchZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "b.qasm" || got[0].Metadata.Shots != 10 || got[1].Name != "a.qasm" {
+		t.Errorf("ReadBatchZip() = %+v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if errs := batch.Validate(); len(errs) != 0 {
+		t.Errorf("Validate() = %v", errs)
+	}
+	bad := Batch{
+		{Source: parser.Source{Name: "a.qasm"}, Metadata: Metadata{Shots: -1}},
+		{Source: parser.Source{Name: "a.qasm"}, Metadata: Metadata{Parameters: map[string]float64{"1x": 0}}},
+		{},
+		{Source: parser.Source{Name: "b.qasm"}, Metadata: Metadata{BitOrder: "middle"}},
+	}
+	want := []string{
+		"a.qasm: shots -1 is negative",
+		"a.qasm: more than one program has this name",
+		`a.qasm: parameter "1x" is not an identifier`,
+		"program 2 has no name",
+		`b.qasm: unknown bit order "middle" (want little or big)`,
+	}
+	errs := bad.Validate()
+	if len(errs) != len(want) {
+		t.Fatalf("Validate() = %v", errs)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, err, want[i])
+		}
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	p := parser.NewParserWithOptions(&parser.ParseOptions{ErrorRecovery: false})
+	results := p.ParseSources(context.Background(), batch.Sources(), nil)
+	if len(results) != len(batch) {
+		t.Fatalf("got %d results", len(results))
+	}
+	for i, r := range results {
+		if r.File != batch[i].Name {
+			t.Errorf("result %d is %s, want %s", i, r.File, batch[i].Name)
+		}
+		if failed := len(r.Errors) > 0; failed != (r.File == "broken.qasm") {
+			t.Errorf("%s: errors = %v", r.File, r.Errors)
+		}
+	}
+}
+
+func TestMetadataWithRun(t *testing.T) {
+	seed, other := int64(7), int64(9)
+	run := &parser.RunConfig{Shots: 4096, Seed: &seed}
+	got := Metadata{}.WithRun(run)
+	if got.Shots != 4096 || got.Seed == nil || *got.Seed != 7 || got.Seed == run.Seed {
+		t.Errorf("WithRun() = %+v", got)
+	}
+	got = Metadata{Shots: 10, Seed: &other}.WithRun(run)
+	if got.Shots != 10 || *got.Seed != 9 {
+		t.Errorf("WithRun() over set metadata = %+v", got)
+	}
+	if got := (Metadata{Shots: 10}).WithRun(nil); got.Shots != 10 || got.Seed != nil {
+		t.Errorf("WithRun(nil) = %+v", got)
+	}
+}
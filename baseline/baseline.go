@@ -0,0 +1,128 @@
+// Package baseline records the diagnostics a codebase already has, so
+// checks can be adopted on legacy code by reporting only new findings.
+//
+// A finding is identified by its file, code, message and the text of its
+// source line, not by its line number, so it stays matched when code
+// above it moves. Identical findings are counted, and only findings
+// beyond the recorded count are reported as new.
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Version is the baseline file format version
+const Version = 1
+
+// Finding is a diagnostic recorded in a baseline
+type Finding struct {
+	File    string `json:"file,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+
+	// Source is the diagnostic's source line with surrounding space
+	// trimmed
+	Source string `json:"source,omitempty"`
+
+	// Count is how many identical diagnostics were recorded
+	Count int `json:"count"`
+}
+
+// Baseline is the set of findings accepted as existing
+type Baseline struct {
+	Version  int       `json:"version"`
+	Findings []Finding `json:"findings"`
+}
+
+// New records diagnostics as a baseline. Writing it over the previous
+// baseline drops findings that have since been fixed.
+func New(diagnostics []parser.ParseError) *Baseline {
+	counts := make(map[Finding]int)
+	for _, diag := range diagnostics {
+		counts[key(diag)]++
+	}
+	b := &Baseline{Version: Version, Findings: make([]Finding, 0, len(counts))}
+	for f, n := range counts {
+		f.Count = n
+		b.Findings = append(b.Findings, f)
+	}
+	sort.Slice(b.Findings, func(i, j int) bool {
+		a, c := b.Findings[i], b.Findings[j]
+		if a.File != c.File {
+			return a.File < c.File
+		}
+		if a.Code != c.Code {
+			return a.Code < c.Code
+		}
+		if a.Message != c.Message {
+			return a.Message < c.Message
+		}
+		return a.Source < c.Source
+	})
+	return b
+}
+
+// Load reads a baseline from a JSON file
+func Load(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if b.Version != Version {
+		return nil, fmt.Errorf("%s: unsupported baseline version %d", path, b.Version)
+	}
+	return &b, nil
+}
+
+// Save writes the baseline to a JSON file
+func (b *Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Filter returns the diagnostics that are not in the baseline, in their
+// original order. A nil baseline filters nothing.
+func (b *Baseline) Filter(diagnostics []parser.ParseError) []parser.ParseError {
+	if b == nil {
+		return diagnostics
+	}
+	remaining := make(map[Finding]int, len(b.Findings))
+	for _, f := range b.Findings {
+		count := f.Count
+		f.Count = 0
+		remaining[f] += count
+	}
+	var fresh []parser.ParseError
+	for _, diag := range diagnostics {
+		k := key(diag)
+		if remaining[k] > 0 {
+			remaining[k]--
+			continue
+		}
+		fresh = append(fresh, diag)
+	}
+	return fresh
+}
+
+// key returns the finding diag is recorded as, without a count
+func key(diag parser.ParseError) Finding {
+	return Finding{
+		File:    diag.File,
+		Code:    diag.Code,
+		Message: diag.Message,
+		Source:  strings.TrimSpace(diag.SourceLine),
+	}
+}
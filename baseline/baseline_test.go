@@ -0,0 +1,64 @@
+package baseline
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func diagnostics(t *testing.T, source string) []parser.ParseError {
+	t.Helper()
+	result := parser.NewParser().ParseWithErrors(source)
+	for i := range result.Errors {
+		result.Errors[i].File = "legacy.qasm"
+	}
+	return result.Errors
+}
+
+func TestFilter(t *testing.T) {
+	b := New(diagnostics(t, "OPENQASM 3.0;\nqreg q[1];\nqreg q[1];\ncreg c[1];\n"))
+	if len(b.Findings) != 2 || b.Findings[1].Count != 2 {
+		t.Fatalf("findings = %+v", b.Findings)
+	}
+
+	// Moved lines still match; a third identical qreg and the new creg
+	// line do not
+	diags := diagnostics(t, "OPENQASM 3.0;\nqubit r;\nqreg q[1];\ncreg c[1];\nqreg q[1];\nqreg q[1];\ncreg d[1];\n")
+	var lines []int
+	for _, diag := range b.Filter(diags) {
+		lines = append(lines, diag.Position.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{6, 7}) {
+		t.Errorf("new findings on lines %v, want [6 7]", lines)
+	}
+
+	var nilBaseline *Baseline
+	if got := nilBaseline.Filter(diags); len(got) != len(diags) {
+		t.Errorf("nil baseline filtered %d diagnostics", len(diags)-len(got))
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	b := New(diagnostics(t, "OPENQASM 3.0;\nqreg q[1];\n"))
+	if err := b.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, b) {
+		t.Errorf("Load() = %+v, want %+v", loaded, b)
+	}
+
+	loaded.Version = 2
+	if err := loaded.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load() accepted an unknown version")
+	}
+}
@@ -0,0 +1,333 @@
+// Package builder constructs AST nodes for code generators.
+//
+// QuasiQuote parses a statement template whose placeholders are filled
+// with typed values after parsing, so generated code is always well
+// formed and values cannot inject QASM the way fmt.Sprintf can:
+//
+//	stmt, err := builder.QuasiQuote("rz(%v) q[%d];", theta, i)
+package builder
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// placeholderPrefix names the identifiers that stand in for arguments
+// while the template is parsed
+const placeholderPrefix = "__qq"
+
+// QuasiQuote parses format as a single statement with its verbs replaced
+// by args. Verbs are:
+//
+//	%v  any supported value
+//	%d  an integer
+//	%f  a float (integers are converted)
+//	%s  an identifier, given as a string
+//	%q  a string literal
+//	%%  a literal percent sign
+//
+// Values may also be parser.Expression nodes, which are inserted as they
+// are. A placeholder may stand wherever the grammar allows an identifier;
+// placeholders in positions the AST does not keep are an error.
+func QuasiQuote(format string, args ...interface{}) (parser.Statement, error) {
+	q, err := newQuote(format, args)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := parser.ParseStatement(q.template)
+	if err != nil {
+		return nil, fmt.Errorf("quasiquote %q: %w", format, err)
+	}
+	if err := q.fill(reflect.ValueOf(stmt)); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// QuasiQuoteExpression is QuasiQuote for an expression template such as
+// "%v / 2"
+func QuasiQuoteExpression(format string, args ...interface{}) (parser.Expression, error) {
+	q, err := newQuote(format, args)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := parser.ParseExpression(q.template)
+	if err != nil {
+		return nil, fmt.Errorf("quasiquote %q: %w", format, err)
+	}
+
+	// The whole expression may be a single placeholder
+	holder := reflect.New(reflect.TypeOf((*parser.Expression)(nil)).Elem()).Elem()
+	holder.Set(reflect.ValueOf(expr))
+	if err := q.fill(holder); err != nil {
+		return nil, err
+	}
+	return holder.Interface().(parser.Expression), nil
+}
+
+// MustQuasiQuote is QuasiQuote that panics on error, for templates fixed
+// at compile time
+func MustQuasiQuote(format string, args ...interface{}) parser.Statement {
+	stmt, err := QuasiQuote(format, args...)
+	if err != nil {
+		panic(err)
+	}
+	return stmt
+}
+
+type quote struct {
+	format   string
+	template string
+	verbs    []rune
+	args     []interface{}
+	used     []bool
+}
+
+// newQuote replaces the verbs of format with placeholder identifiers and
+// checks the arguments against them
+func newQuote(format string, args []interface{}) (*quote, error) {
+	if strings.Contains(format, placeholderPrefix) {
+		return nil, fmt.Errorf("quasiquote %q: template must not contain %q", format, placeholderPrefix)
+	}
+
+	q := &quote{format: format, args: args}
+	var sb strings.Builder
+	runes := []rune(format)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '%' {
+			sb.WriteRune(runes[i])
+			continue
+		}
+		if i+1 == len(runes) {
+			return nil, fmt.Errorf("quasiquote %q: trailing %%", format)
+		}
+		i++
+		switch verb := runes[i]; verb {
+		case '%':
+			sb.WriteRune('%')
+		case 'v', 'd', 'f', 's':
+			fmt.Fprintf(&sb, " %s%d ", placeholderPrefix, len(q.verbs))
+			q.verbs = append(q.verbs, verb)
+		case 'q':
+			fmt.Fprintf(&sb, ` "%s%d" `, placeholderPrefix, len(q.verbs))
+			q.verbs = append(q.verbs, verb)
+		default:
+			return nil, fmt.Errorf("quasiquote %q: unsupported verb %%%c", format, verb)
+		}
+	}
+	if len(q.verbs) != len(args) {
+		return nil, fmt.Errorf("quasiquote %q: %d placeholders but %d arguments", format, len(q.verbs), len(args))
+	}
+	q.template = sb.String()
+	q.used = make([]bool, len(args))
+	return q, nil
+}
+
+// placeholder returns the argument index a placeholder name stands for
+func (q *quote) placeholder(name string) (int, bool) {
+	rest, ok := strings.CutPrefix(name, placeholderPrefix)
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(rest)
+	if err != nil || i < 0 || i >= len(q.args) {
+		return 0, false
+	}
+	return i, true
+}
+
+// fill replaces the placeholders in the tree under v and checks that
+// every one was replaced
+func (q *quote) fill(v reflect.Value) error {
+	if err := q.walk(v); err != nil {
+		return err
+	}
+	for i, used := range q.used {
+		if !used {
+			return fmt.Errorf("quasiquote %q: placeholder %d is in a position the AST does not represent", q.format, i+1)
+		}
+	}
+	return nil
+}
+
+var expressionType = reflect.TypeOf((*parser.Expression)(nil)).Elem()
+
+func (q *quote) walk(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return q.walk(v.Elem())
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if id, ok := v.Interface().(*parser.Identifier); ok && v.CanSet() && v.Type() == expressionType {
+			if i, ok := q.placeholder(id.Name); ok {
+				expr, err := q.expression(i, id.BaseNode)
+				if err != nil {
+					return err
+				}
+				v.Set(reflect.ValueOf(expr))
+				q.used[i] = true
+				return nil
+			}
+		}
+		return q.walk(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if err := q.walk(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := q.walk(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if i, ok := q.placeholder(v.String()); ok && v.CanSet() {
+			text := q.name
+			if q.verbs[i] == 'q' {
+				text = q.text
+			}
+			name, err := text(i)
+			if err != nil {
+				return err
+			}
+			v.SetString(name)
+			q.used[i] = true
+		}
+	}
+	return nil
+}
+
+// name returns argument i for a placeholder that names something
+func (q *quote) name(i int) (string, error) {
+	s, ok := q.args[i].(string)
+	if !ok || (q.verbs[i] != 's' && q.verbs[i] != 'v') {
+		return "", q.mismatch(i, "an identifier string with %s")
+	}
+	if !isIdentifier(s) {
+		return "", fmt.Errorf("quasiquote %q: argument %d: %q is not a valid identifier", q.format, i+1, s)
+	}
+	return s, nil
+}
+
+// text returns argument i for a %q placeholder
+func (q *quote) text(i int) (string, error) {
+	s, ok := q.args[i].(string)
+	if !ok {
+		return "", q.mismatch(i, "a string")
+	}
+	if strings.ContainsAny(s, "\"'\r\n") {
+		return "", fmt.Errorf("quasiquote %q: argument %d: string literal cannot contain quotes or newlines", q.format, i+1)
+	}
+	return s, nil
+}
+
+// expression converts argument i to an expression node positioned where
+// its placeholder was
+func (q *quote) expression(i int, span parser.BaseNode) (parser.Expression, error) {
+	arg, verb := q.args[i], q.verbs[i]
+	if expr, ok := arg.(parser.Expression); ok && verb == 'v' {
+		return expr, nil
+	}
+
+	if _, ok := arg.(string); ok || verb == 's' {
+		name, err := q.name(i)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.Identifier{BaseNode: span, Name: name}, nil
+	}
+	if arg == nil {
+		return nil, q.mismatch(i, "a value")
+	}
+
+	rv := reflect.ValueOf(arg)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if verb == 'f' {
+			return floatNode(span, float64(rv.Int()))
+		}
+		return intNode(span, rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("quasiquote %q: argument %d overflows int64", q.format, i+1)
+		}
+		if verb == 'f' {
+			return floatNode(span, float64(rv.Uint()))
+		}
+		return intNode(span, int64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		if verb == 'd' {
+			return nil, q.mismatch(i, "an integer")
+		}
+		expr, err := floatNode(span, rv.Float())
+		if err != nil {
+			return nil, fmt.Errorf("quasiquote %q: argument %d: %w", q.format, i+1, err)
+		}
+		return expr, nil
+	case reflect.Bool:
+		if verb != 'v' {
+			return nil, q.mismatch(i, "a number")
+		}
+		return &parser.BooleanLiteral{BaseNode: span, Value: rv.Bool()}, nil
+	}
+	return nil, q.mismatch(i, "a number, bool, string or parser.Expression")
+}
+
+func (q *quote) mismatch(i int, want string) error {
+	return fmt.Errorf("quasiquote %q: argument %d for %%%c must be %s, got %T", q.format, i+1, q.verbs[i], want, q.args[i])
+}
+
+// intNode builds an integer literal, negated if negative so it has the
+// shape the parser gives "-1"
+func intNode(span parser.BaseNode, v int64) parser.Expression {
+	if v < 0 && v != math.MinInt64 {
+		return &parser.UnaryExpression{BaseNode: span, Operator: "-", Operand: intNode(span, -v)}
+	}
+	return &parser.IntegerLiteral{BaseNode: span, Value: v, Raw: strconv.FormatInt(v, 10)}
+}
+
+func floatNode(span parser.BaseNode, v float64) (parser.Expression, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, fmt.Errorf("%v has no QASM literal", v)
+	}
+	if v < 0 {
+		operand, _ := floatNode(span, -v)
+		return &parser.UnaryExpression{BaseNode: span, Operator: "-", Operand: operand}, nil
+	}
+	raw := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(raw, ".e") {
+		raw += ".0"
+	}
+	return &parser.FloatLiteral{BaseNode: span, Value: v, Raw: raw}, nil
+}
+
+// isIdentifier reports whether s is a valid QASM identifier and not a
+// keyword
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	for _, def := range parser.Vocabulary() {
+		if def.Literal == s {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+func TestQuasiQuote(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []interface{}
+		want   string
+	}{
+		{"rz(%v) q[%d];", []interface{}{0.5, 3}, "rz(0.5) q[3];"},
+		{"rz(%f) q[%d];", []interface{}{2, -1}, "rz(2.0) q[-1];"},
+		{"%s q[0], %s;", []interface{}{"cx", "anc"}, "cx q[0], anc;"},
+		{"qubit[%d] %s;", []interface{}{4, "data"}, "qubit[4] data;"},
+		{"include %q;", []interface{}{"stdgates.inc"}, `include "stdgates.inc";`},
+		{"rz(%v) q;", []interface{}{&parser.Identifier{Name: "theta"}}, "rz(theta) q;"},
+		{"rz(%v %% 2) q;", []interface{}{7}, "rz(7 % 2) q;"},
+	}
+	for _, tt := range tests {
+		stmt, err := QuasiQuote(tt.format, tt.args...)
+		if err != nil {
+			t.Errorf("QuasiQuote(%q): %v", tt.format, err)
+			continue
+		}
+		if got := printer.Statement(stmt); got != tt.want {
+			t.Errorf("QuasiQuote(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestQuasiQuoteRejects(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []interface{}
+		want   string
+	}{
+		{"rz(%v) q;", nil, "placeholders but"},
+		{"%s q;", []interface{}{"h q; reset"}, "not a valid identifier"},
+		{"%s q;", []interface{}{"gate"}, "not a valid identifier"},
+		{"rz(%d) q;", []interface{}{0.5}, "must be an integer"},
+		{"rz(%v) q;", []interface{}{[]int{1}}, "must be a number"},
+		{"rz(%v) q;", []interface{}{"x)"}, "not a valid identifier"},
+		{"rz(%x) q;", []interface{}{1}, "unsupported verb"},
+		{"rz(%v q;", []interface{}{1}, "quasiquote"},
+	}
+	for _, tt := range tests {
+		_, err := QuasiQuote(tt.format, tt.args...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("QuasiQuote(%q, %v) error = %v, want %q", tt.format, tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestQuasiQuoteExpression(t *testing.T) {
+	expr, err := QuasiQuoteExpression("%v")
+	if err == nil {
+		t.Fatalf("expected an argument count error, got %v", expr)
+	}
+	expr, err = QuasiQuoteExpression("%v", 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lit, ok := expr.(*parser.FloatLiteral); !ok || lit.Value != 1.5 {
+		t.Errorf("expected a float literal, got %#v", expr)
+	}
+	expr, err = QuasiQuoteExpression("%v / %d", &parser.Identifier{Name: "pi"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := printer.Expression(expr); got != "pi / 2" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,106 @@
+// Package checksum records and verifies SHA-256 checksums of generated
+// QASM, so pipelines can detect accidental modification of formatted or
+// compiled artifacts. A checksum lives in a sidecar file next to the
+// artifact, in the format sha256sum uses:
+//
+//	<hex digest>  <file name>
+package checksum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Extension is appended to an artifact's path to name its sidecar file
+const Extension = ".sha256"
+
+// Canonicalize normalizes the parts of content that carry no meaning and
+// tools commonly rewrite: a byte order mark, CRLF line endings, trailing
+// whitespace and trailing blank lines. Anything else, including comments
+// and pragmas, counts as a modification.
+func Canonicalize(content []byte) []byte {
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	lines := bytes.Split(content, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimRight(line, " \t\r")
+	}
+	content = bytes.TrimRight(bytes.Join(lines, []byte("\n")), "\n")
+	if len(content) == 0 {
+		return content
+	}
+	return append(content, '\n')
+}
+
+// Sum returns the hex SHA-256 digest of the canonical form of content
+func Sum(content []byte) string {
+	sum := sha256.Sum256(Canonicalize(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// SidecarPath returns the path of the checksum file for path
+func SidecarPath(path string) string {
+	return path + Extension
+}
+
+// Write writes the sidecar file for an artifact at path whose content is
+// content. It does not write the artifact itself.
+func Write(path string, content []byte) error {
+	line := fmt.Sprintf("%s  %s\n", Sum(content), filepath.Base(path))
+	return os.WriteFile(SidecarPath(path), []byte(line), 0644)
+}
+
+// MismatchError reports an artifact whose content no longer matches its
+// recorded checksum
+type MismatchError struct {
+	File string
+	Want string
+	Got  string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s: checksum mismatch: recorded %s, content has %s", e.File, e.Want, e.Got)
+}
+
+// Verify checks the artifact at path against its sidecar file. It returns
+// a *MismatchError if the content was modified, or another error if
+// either file cannot be read.
+func Verify(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	want, err := readSidecar(SidecarPath(path))
+	if err != nil {
+		return err
+	}
+	if got := Sum(content); got != want {
+		return &MismatchError{File: path, Want: want, Got: got}
+	}
+	return nil
+}
+
+// readSidecar returns the digest recorded in a sidecar file
+func readSidecar(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s: empty checksum file", path)
+	}
+	digest := strings.ToLower(fields[0])
+	if len(digest) != sha256.Size*2 {
+		return "", fmt.Errorf("%s: malformed checksum %q", path, fields[0])
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", fmt.Errorf("%s: malformed checksum %q", path, fields[0])
+	}
+	return digest, nil
+}
@@ -0,0 +1,80 @@
+package checksum
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSumIgnoresInsignificantChanges(t *testing.T) {
+	base := "OPENQASM 3.0;\nqubit q;\nh q;\n"
+	variants := []string{
+		"\ufeff" + base,
+		strings.ReplaceAll(base, "\n", "\r\n"),
+		"OPENQASM 3.0;  \nqubit q;\t\nh q;\n",
+		base + "\n\n",
+		strings.TrimSuffix(base, "\n"),
+	}
+	want := Sum([]byte(base))
+	for _, v := range variants {
+		if got := Sum([]byte(v)); got != want {
+			t.Errorf("Sum(%q) = %s, want %s", v, got, want)
+		}
+	}
+	if Sum([]byte("OPENQASM 3.0;\nqubit q;\nx q;\n")) == want {
+		t.Error("Sum did not change with the program")
+	}
+}
+
+func TestWriteVerify(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.qasm")
+	content := []byte("OPENQASM 3.0;\nqubit q;\nh q;\n")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(path, content); err != nil {
+		t.Fatal(err)
+	}
+
+	sidecar, err := os.ReadFile(SidecarPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := Sum(content) + "  out.qasm\n"; string(sidecar) != want {
+		t.Errorf("sidecar = %q, want %q", sidecar, want)
+	}
+	if err := Verify(path); err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("OPENQASM 3.0;\nqubit q;\nx q;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var mismatch *MismatchError
+	if err := Verify(path); !errors.As(err, &mismatch) {
+		t.Fatalf("Verify() = %v, want *MismatchError", err)
+	}
+	if mismatch.Want != Sum(content) {
+		t.Errorf("Want = %s, want %s", mismatch.Want, Sum(content))
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.qasm")
+	if err := os.WriteFile(path, []byte("OPENQASM 3.0;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Verify() without sidecar = %v, want not-exist error", err)
+	}
+	if err := os.WriteFile(SidecarPath(path), []byte("nothex  out.qasm\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(path); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("Verify() with bad sidecar = %v, want malformed error", err)
+	}
+}
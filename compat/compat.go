@@ -0,0 +1,507 @@
+// Package compat encodes ASTs as versioned JSON documents and converts
+// them between AST versions, so consumers reading JSON are not broken
+// each time a node changes shape.
+//
+// Unlike the plain encoding/json output, every statement and expression
+// carries a "kind" naming its node type, which makes documents decodable
+// back into a *parser.Program:
+//
+//	{"version": "1.10", "program": {"statements": [{"kind": "GateCall", ...}]}}
+//
+// Reading a document of an older version still works but reports a
+// deprecation warning.
+package compat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/schema"
+)
+
+// Current is the AST version Marshal writes by default
+const Current = schema.Version
+
+// migration converts documents between two adjacent versions
+type migration struct {
+	from, to string
+
+	// down rewrites a node of version to into the shape of version from.
+	// It returns false if the node cannot be represented there, in which
+	// case it is dropped.
+	down func(kind string, node map[string]interface{}) bool
+
+	// up rewrites a node of version from into the shape of version to.
+	// Nil means documents of version from are valid as they are.
+	up func(kind string, node map[string]interface{})
+}
+
+// migrations lists the version steps in order, oldest first. The last
+// step leads to Current.
+var migrations = []migration{
+	{
+		// 1.1 keeps statements the parser could not recover as
+		// BadStatement nodes, which 1.0 dropped
+		from: "1.0",
+		to:   "1.1",
+		down: func(kind string, _ map[string]interface{}) bool {
+			return kind != "BadStatement"
+		},
+	},
+	{
+		// 1.2 represents barriers, which 1.1 dropped
+		from: "1.1",
+		to:   "1.2",
+		down: func(kind string, _ map[string]interface{}) bool {
+			return kind != "Barrier"
+		},
+	},
+	{
+		// 1.3 represents resets, which 1.2 dropped
+		from: "1.2",
+		to:   "1.3",
+		down: func(kind string, _ map[string]interface{}) bool {
+			return kind != "Reset"
+		},
+	},
+	{
+		// 1.4 represents defcal declarations, which 1.3 dropped
+		from: "1.3",
+		to:   "1.4",
+		down: func(kind string, _ map[string]interface{}) bool {
+			return kind != "CalibrationDefinition"
+		},
+	},
+	{
+		// 1.5 represents cal blocks and defcalgrammar, which 1.4 dropped,
+		// and models openpulse bodies
+		from: "1.4",
+		to:   "1.5",
+		down: func(kind string, node map[string]interface{}) bool {
+			if kind == "CalibrationDefinition" {
+				delete(node, "declarations")
+				delete(node, "references")
+			}
+			return kind != "Calibration" && kind != "CalibrationGrammar"
+		},
+	},
+	{
+		// 1.6 represents classical assignments, which 1.5 dropped
+		from: "1.5",
+		to:   "1.6",
+		down: func(kind string, _ map[string]interface{}) bool {
+			return kind != "Assignment"
+		},
+	},
+	{
+		// 1.7 models array types and multi-dimensional indices; 1.6
+		// spelled array types out as the type name and kept only the
+		// first index
+		from: "1.6",
+		to:   "1.7",
+		down: func(kind string, node map[string]interface{}) bool {
+			switch kind {
+			case "ClassicalDeclaration":
+				array, ok := node["array"].(map[string]interface{})
+				if !ok {
+					break
+				}
+				var typ parser.ArrayType
+				if err := decode(array, reflect.ValueOf(&typ).Elem()); err != nil {
+					return false
+				}
+				node["type"] = spelled(&typ)
+				delete(node, "array")
+			case "IndexedIdentifier":
+				delete(node, "indices")
+			case "SubroutineDefinition":
+				params, _ := node["parameters"].([]interface{})
+				for _, p := range params {
+					if param, ok := p.(map[string]interface{}); ok && param["array"] != nil {
+						param["type"] = strings.ReplaceAll(param["type"].(string), " ", "")
+						delete(param, "array")
+					}
+				}
+			}
+			return true
+		},
+	},
+	{
+		// 1.8 has imaginary literals and sizes complex types by their
+		// components; 1.7 kept imaginary literals as identifiers and
+		// spelled complex types out in full
+		from: "1.7",
+		to:   "1.8",
+		down: func(kind string, node map[string]interface{}) bool {
+			switch kind {
+			case "ImaginaryLiteral":
+				name, _ := node["raw"].(string)
+				if name == "" {
+					name = fmt.Sprint(node["value"]) + "im"
+				}
+				node["kind"] = "Identifier"
+				node["name"] = name
+				delete(node, "value")
+				delete(node, "raw")
+			case "ClassicalDeclaration":
+				if node["type"] != "complex" || node["size"] == nil {
+					break
+				}
+				var size parser.Expression
+				if err := decode(node["size"], reflect.ValueOf(&size).Elem()); err != nil {
+					return false
+				}
+				node["type"] = "complex[float[" + strings.ReplaceAll(printer.Expression(size), " ", "") + "]]"
+				delete(node, "size")
+			}
+			return true
+		},
+	},
+	{
+		// 1.9 keeps statements the AST has no node for as RawStatement
+		// nodes, which 1.8 dropped
+		from: "1.8",
+		to:   "1.9",
+		down: func(kind string, _ map[string]interface{}) bool {
+			return kind != "RawStatement"
+		},
+	},
+	{
+		// 1.10 builds annotated statements and keeps their annotations,
+		// where 1.9 held them as RawStatement nodes
+		from: "1.9",
+		to:   "1.10",
+		down: func(_ string, node map[string]interface{}) bool {
+			delete(node, "annotations")
+			return true
+		},
+	},
+}
+
+// spelled spells an array type as 1.6 did, without spaces
+func spelled(array *parser.ArrayType) string {
+	parts := []string{array.Element}
+	for _, d := range array.Dimensions {
+		parts = append(parts, strings.ReplaceAll(printer.Expression(d), " ", ""))
+	}
+	return "array[" + strings.Join(parts, ",") + "]"
+}
+
+// Versions returns the supported AST versions, oldest first
+func Versions() []string {
+	if len(migrations) == 0 {
+		return []string{Current}
+	}
+	versions := []string{migrations[0].from}
+	for _, m := range migrations {
+		versions = append(versions, m.to)
+	}
+	return versions
+}
+
+func versionIndex(version string) (int, error) {
+	for i, v := range Versions() {
+		if v == version {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported AST version %q (want one of %s)", version, strings.Join(Versions(), ", "))
+}
+
+// Document is the versioned envelope
+type Document struct {
+	Version string          `json:"version"`
+	Program json.RawMessage `json:"program"`
+}
+
+// Marshal encodes program as a document of the given version. An empty
+// version means Current. Nodes the older version has no shape for are
+// left out.
+func Marshal(program *parser.Program, version string) ([]byte, error) {
+	if version == "" {
+		version = Current
+	}
+	tree := encode(reflect.ValueOf(program))
+	tree, err := migrate(tree, Current, version)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{"version": version, "program": tree})
+}
+
+// Unmarshal decodes a document of any supported version. Documents older
+// than Current are upgraded and reported with a deprecation warning.
+func Unmarshal(data []byte) (*parser.Program, []parser.ParseError, error) {
+	version, tree, err := read(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var warnings []parser.ParseError
+	if version != Current {
+		warnings = append(warnings, parser.NewWarning("deprecated",
+			fmt.Sprintf("AST version %s is deprecated; re-encode as version %s", version, Current), parser.Position{}))
+	}
+	if tree, err = migrate(tree, version, Current); err != nil {
+		return nil, nil, err
+	}
+
+	program := &parser.Program{}
+	if err := decode(tree, reflect.ValueOf(program).Elem()); err != nil {
+		return nil, warnings, err
+	}
+	return program, warnings, nil
+}
+
+// Convert rewrites a document as the given version
+func Convert(data []byte, version string) ([]byte, error) {
+	from, tree, err := read(data)
+	if err != nil {
+		return nil, err
+	}
+	if tree, err = migrate(tree, from, version); err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{"version": version, "program": tree})
+}
+
+func read(data []byte) (string, interface{}, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", nil, err
+	}
+	if doc.Version == "" {
+		return "", nil, fmt.Errorf("document has no version")
+	}
+	if _, err := versionIndex(doc.Version); err != nil {
+		return "", nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc.Program))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return "", nil, err
+	}
+	return doc.Version, tree, nil
+}
+
+// migrate steps tree from one version to another
+func migrate(tree interface{}, from, to string) (interface{}, error) {
+	i, err := versionIndex(from)
+	if err != nil {
+		return nil, err
+	}
+	j, err := versionIndex(to)
+	if err != nil {
+		return nil, err
+	}
+	for ; i < j; i++ {
+		if up := migrations[i].up; up != nil {
+			tree, _ = rewrite(tree, func(kind string, node map[string]interface{}) bool {
+				up(kind, node)
+				return true
+			})
+		}
+	}
+	for ; i > j; i-- {
+		tree, _ = rewrite(tree, migrations[i-1].down)
+	}
+	return tree, nil
+}
+
+// rewrite applies f to every node of tree, children first, removing the
+// nodes it rejects. It reports whether tree itself is kept.
+func rewrite(tree interface{}, f func(kind string, node map[string]interface{}) bool) (interface{}, bool) {
+	switch t := tree.(type) {
+	case map[string]interface{}:
+		for key, child := range t {
+			if kept, ok := rewrite(child, f); ok {
+				t[key] = kept
+			} else {
+				delete(t, key)
+			}
+		}
+		if kind, ok := t["kind"].(string); ok {
+			return t, f(kind, t)
+		}
+	case []interface{}:
+		out := t[:0]
+		for _, child := range t {
+			if kept, ok := rewrite(child, f); ok {
+				out = append(out, kept)
+			}
+		}
+		return out, true
+	}
+	return tree, true
+}
+
+var (
+	statementType  = reflect.TypeOf((*parser.Statement)(nil)).Elem()
+	expressionType = reflect.TypeOf((*parser.Expression)(nil)).Elem()
+)
+
+// kinds maps each node kind to its type
+var kinds = func() map[string]reflect.Type {
+	m := make(map[string]reflect.Type)
+	for _, s := range schema.StatementTypes() {
+		m[reflect.TypeOf(s).Elem().Name()] = reflect.TypeOf(s).Elem()
+	}
+	for _, e := range schema.ExpressionTypes() {
+		m[reflect.TypeOf(e).Elem().Name()] = reflect.TypeOf(e).Elem()
+	}
+	return m
+}()
+
+// field is a struct field as encoding/json sees it
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// fields returns the JSON fields of struct type t, with embedded structs
+// inlined
+func fields(t reflect.Type) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, inner := range fields(f.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				out = append(out, inner)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		out = append(out, field{name: name, index: []int{i}, omitEmpty: strings.Contains(opts, "omitempty")})
+	}
+	return out
+}
+
+// encode converts v into a tree of maps, slices and scalars, adding the
+// kind of every node held in a Statement or Expression
+func encode(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		tree := encode(v.Elem())
+		if v.Type() == statementType || v.Type() == expressionType {
+			tree.(map[string]interface{})["kind"] = v.Elem().Elem().Type().Name()
+		}
+		return tree
+	case reflect.Struct:
+		node := make(map[string]interface{})
+		for _, f := range fields(v.Type()) {
+			fv := v.FieldByIndex(f.index)
+			if f.omitEmpty && isEmpty(fv) {
+				continue
+			}
+			node[f.name] = encode(fv)
+		}
+		return node
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = encode(v.Index(i))
+		}
+		return items
+	}
+	return v.Interface()
+}
+
+// isEmpty reports whether omitempty leaves v out, as encoding/json
+// decides it
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// decode fills v from a tree read by encoding/json with UseNumber
+func decode(tree interface{}, v reflect.Value) error {
+	if tree == nil {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		node, ok := tree.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("want a node object, got %T", tree)
+		}
+		kind, _ := node["kind"].(string)
+		t, ok := kinds[kind]
+		if !ok {
+			return fmt.Errorf("unknown node kind %q", kind)
+		}
+		ptr := reflect.New(t)
+		if !ptr.Type().Implements(v.Type()) {
+			return fmt.Errorf("%s is not a %s", kind, v.Type().Name())
+		}
+		if err := decode(node, ptr.Elem()); err != nil {
+			return fmt.Errorf("%s: %w", kind, err)
+		}
+		v.Set(ptr)
+	case reflect.Pointer:
+		ptr := reflect.New(v.Type().Elem())
+		if err := decode(tree, ptr.Elem()); err != nil {
+			return err
+		}
+		v.Set(ptr)
+	case reflect.Struct:
+		node, ok := tree.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("want an object for %s, got %T", v.Type().Name(), tree)
+		}
+		for _, f := range fields(v.Type()) {
+			if err := decode(node[f.name], v.FieldByIndex(f.index)); err != nil {
+				return fmt.Errorf("%s: %w", f.name, err)
+			}
+		}
+	case reflect.Slice:
+		items, ok := tree.([]interface{})
+		if !ok {
+			return fmt.Errorf("want an array, got %T", tree)
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decode(item, slice.Index(i)); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		v.Set(slice)
+	default:
+		// Scalars go through encoding/json, which handles json.Number
+		data, err := json.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+	return nil
+}
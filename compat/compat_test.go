@@ -0,0 +1,385 @@
+package compat
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+const source = `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+bit[2] c;
+const int n = 0x1F;
+gate rz2(theta) a, b {
+  rz(theta / 2) a;
+  ctrl @ x a, b;
+}
+for uint i in [0:2:10] {
+  h q[i];
+}
+if (c[0] == 1) {
+  x q[1];
+} else {
+  y q[1];
+}
+bit m = measure q[0];
+measure q -> c;
+`
+
+func TestRoundTrip(t *testing.T) {
+	program, err := parser.NewParser().ParseString(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(program, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"kind":"GateCall"`) || !strings.Contains(string(data), `"version":"`+Current+`"`) {
+		t.Errorf("unexpected document: %s", data)
+	}
+
+	decoded, warnings, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings for the current version: %v", warnings)
+	}
+	if got, want := printer.Print(decoded), printer.Print(program); got != want {
+		t.Errorf("round trip changed the program:\n%s\nwant\n%s", got, want)
+	}
+	gate := decoded.Statements[4].(*parser.GateDefinition)
+	if gate.Pos() != program.Statements[4].Pos() || gate.Parameters[0].Name != "theta" {
+		t.Errorf("round trip lost positions or parameters: %+v", gate)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, doc := range []string{
+		`{"program": {}}`,
+		`{"version": "0.1", "program": {}}`,
+		`{"version": "` + Current + `", "program": {"statements": [{"kind": "Nonsense"}]}}`,
+		`{"version": "` + Current + `", "program": {"statements": [{"kind": "Identifier", "name": "q"}]}}`,
+	} {
+		if _, _, err := Unmarshal([]byte(doc)); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", doc)
+		}
+	}
+}
+
+// withMigrations replaces the version history for one test
+func withMigrations(t *testing.T, ms []migration) {
+	saved := migrations
+	migrations = ms
+	t.Cleanup(func() { migrations = saved })
+}
+
+func TestMigrations(t *testing.T) {
+	// Pretend the previous version had no raw spellings and no measure
+	// expressions
+	withMigrations(t, []migration{{
+		from: "0.9",
+		to:   Current,
+		down: func(kind string, node map[string]interface{}) bool {
+			delete(node, "raw")
+			return kind != "MeasureExpression"
+		},
+		up: func(kind string, node map[string]interface{}) {
+			if kind == "IntegerLiteral" {
+				node["raw"] = "legacy"
+			}
+		},
+	}})
+	if got := strings.Join(Versions(), ","); got != "0.9,"+Current {
+		t.Fatalf("Versions() = %s", got)
+	}
+
+	program, err := parser.NewParser().ParseString("OPENQASM 3.0;\nqubit q;\nbit b = measure q;\nh q[0x0];\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := Marshal(program, "0.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(old), "raw") || strings.Contains(string(old), "MeasureExpression") {
+		t.Errorf("downgraded document kept newer shapes: %s", old)
+	}
+
+	decoded, warnings, err := Unmarshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0].Type != "deprecated" || warnings[0].Severity != parser.SeverityWarning {
+		t.Errorf("warnings = %v, want one deprecation warning", warnings)
+	}
+	if decl := decoded.Statements[1].(*parser.ClassicalDeclaration); decl.Initializer != nil {
+		t.Errorf("dropped initializer came back: %v", decl.Initializer)
+	}
+	call := decoded.Statements[2].(*parser.GateCall)
+	if lit := call.Qubits[0].(*parser.IndexedIdentifier).Index.(*parser.IntegerLiteral); lit.Raw != "legacy" {
+		t.Errorf("upgrade did not run: raw = %q", lit.Raw)
+	}
+
+	upgraded, err := Convert(old, Current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc Document
+	if err := json.Unmarshal(upgraded, &doc); err != nil || doc.Version != Current {
+		t.Errorf("Convert() = %s, %v", upgraded, err)
+	}
+}
+
+func TestBadStatementDowngrade(t *testing.T) {
+	if got := strings.Join(Versions(), ","); got != "1.0,1.1,1.2,1.3,1.4,1.5,1.6,1.7,1.8,1.9,1.10" {
+		t.Fatalf("Versions() = %s", got)
+	}
+	result := parser.NewParser().ParseWithErrors("OPENQASM 3.0;\nqubit q;\nh q[0;\nx q;\n")
+	data, err := Marshal(result.Program, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "BadStatement") {
+		t.Errorf("1.0 document contains BadStatement: %s", data)
+	}
+	program, _, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := printer.Print(program), "OPENQASM 3.0;\nqubit q;\nx q;\n"; got != want {
+		t.Errorf("downgraded program =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestBarrierDowngrade(t *testing.T) {
+	program, err := parser.NewParser().ParseString("OPENQASM 3.0;\nqubit[2] q;\nh q[0];\nbarrier q;\nx q[1];\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := Marshal(program, Current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(current), `"kind":"Barrier"`) {
+		t.Errorf("%s document lacks the barrier: %s", Current, current)
+	}
+	data, err := Marshal(program, "1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downgraded, _, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := printer.Print(downgraded), "OPENQASM 3.0;\nqubit[2] q;\nh q[0];\nx q[1];\n"; got != want {
+		t.Errorf("downgraded program =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestResetDowngrade(t *testing.T) {
+	program, err := parser.NewParser().ParseString("OPENQASM 3.0;\nqubit q;\nreset q;\nh q;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(program, "1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downgraded, _, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := printer.Print(downgraded), "OPENQASM 3.0;\nqubit q;\nh q;\n"; got != want {
+		t.Errorf("downgraded program =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCalibrationDowngrade(t *testing.T) {
+	program, err := parser.NewParser().ParseString("OPENQASM 3.0;\ndefcal x $0 { play(d0, wf); }\nx $0;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(program, "1.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downgraded, _, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := printer.Print(downgraded), "OPENQASM 3.0;\nx $0;\n"; got != want {
+		t.Errorf("downgraded program =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPulseDowngrade(t *testing.T) {
+	src := "OPENQASM 3.0;\ndefcalgrammar \"openpulse\";\ncal { extern port d0; }\ndefcal x $0 { frame f = newframe(d0, 5e9, 0); }\n"
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(program, "1.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "declarations") || strings.Contains(string(data), "references") {
+		t.Errorf("1.4 document has openpulse fields: %s", data)
+	}
+	downgraded, _, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "OPENQASM 3.0;\ndefcal x $0 { frame f = newframe(d0, 5e9, 0); }\n"
+	if got := printer.Print(downgraded); got != want {
+		t.Errorf("downgraded program =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAssignmentDowngrade(t *testing.T) {
+	program, err := parser.NewParser().ParseString("OPENQASM 3.0;\nbit c;\nc = 1;\nint x;\nx += 2;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(program, "1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downgraded, _, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := printer.Print(downgraded), "OPENQASM 3.0;\nbit c;\nint x;\n"; got != want {
+		t.Errorf("downgraded program =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestArrayDowngrade(t *testing.T) {
+	src := `OPENQASM 3.0;
+const int n = 2;
+array[int[32], n + 1, 5] a;
+a[1, 2] = 3;
+def f(readonly array[int[8], #dim = 2] m) {}
+`
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(program, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := printer.Print(decoded); got != src {
+		t.Errorf("round trip changed the program:\n%s\nwant\n%s", got, src)
+	}
+
+	data, err = Marshal(program, "1.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"array"`) || strings.Contains(string(data), "indices") {
+		t.Errorf("1.6 document has array fields: %s", data)
+	}
+	downgraded, _, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `OPENQASM 3.0;
+const int n = 2;
+array[int[32],n+1,5] a;
+a[1] = 3;
+def f(readonlyarray[int[8],#dim=2] m) {}
+`
+	if got := printer.Print(downgraded); got != want {
+		t.Errorf("downgraded program =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestComplexDowngrade(t *testing.T) {
+	src := `OPENQASM 3.0;
+complex[float[64]] z = 2.0 + 3.1im;
+`
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(program, "1.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "ImaginaryLiteral") || !strings.Contains(string(data), `"type":"complex[float[64]]"`) {
+		t.Errorf("unexpected 1.7 document: %s", data)
+	}
+	downgraded, _, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl := downgraded.Statements[0].(*parser.ClassicalDeclaration)
+	if decl.Size != nil {
+		t.Errorf("1.7 declaration kept a size: %+v", decl)
+	}
+	if id, ok := decl.Initializer.(*parser.BinaryExpression).Right.(*parser.Identifier); !ok || id.Name != "3.1im" {
+		t.Errorf("imaginary literal downgraded to %#v", decl.Initializer.(*parser.BinaryExpression).Right)
+	}
+}
+
+func TestRawStatementDowngrade(t *testing.T) {
+	program, err := parser.NewParser().ParseString("OPENQASM 3.0;\ninput float theta;\nqubit q;\nrx(theta) q;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := Marshal(program, Current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip, _, err := Unmarshal(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := printer.Print(roundTrip), printer.Print(program); got != want {
+		t.Errorf("%s round trip =\n%s\nwant\n%s", Current, got, want)
+	}
+
+	data, err := Marshal(program, "1.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "RawStatement") {
+		t.Errorf("1.8 document contains RawStatement: %s", data)
+	}
+}
+
+func TestAnnotationDowngrade(t *testing.T) {
+	program, err := parser.NewParser().ParseString("OPENQASM 3.0;\nqubit q;\n@bind fast\nh q;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := Marshal(program, Current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip, _, err := Unmarshal(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := printer.Print(roundTrip), printer.Print(program); got != want {
+		t.Errorf("%s round trip =\n%s\nwant\n%s", Current, got, want)
+	}
+
+	data, err := Marshal(program, "1.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "annotations") {
+		t.Errorf("1.9 document contains annotations: %s", data)
+	}
+}
@@ -0,0 +1,209 @@
+// Package conformance checks a parser against a suite of programs
+// grouped by section of the OpenQASM 3 specification, such as "gates" or
+// "control-flow". Each program is either valid, and must parse without
+// errors, or marked invalid with a leading comment and must be rejected:
+//
+//	// conformance: invalid
+//
+// The bundled suite covers the constructs the reference examples of the
+// specification use. Load reads a suite of the same layout from any
+// fs.FS, so a custom build or dialect profile can be verified against its
+// own additions too:
+//
+//	report := conformance.Run(conformance.Cases(), conformance.Parser(opts))
+//	report.WriteText(os.Stdout)
+package conformance
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// invalidMarker marks a case the parser must reject
+const invalidMarker = "// conformance: invalid"
+
+//go:embed suite
+var suite embed.FS
+
+// Case is one program of the suite
+type Case struct {
+	Section string `json:"section"`
+	Name    string `json:"name"`
+	Source  string `json:"-"`
+	Valid   bool   `json:"valid"`
+}
+
+// Cases returns the bundled suite, sorted by section and name
+func Cases() []Case {
+	sub, err := fs.Sub(suite, "suite")
+	if err != nil {
+		panic(err)
+	}
+	cases, err := Load(sub)
+	if err != nil {
+		panic(err)
+	}
+	return cases
+}
+
+// Load reads a suite from fsys, where each directory at the root is a
+// section holding .qasm cases. The result is sorted by section and name.
+func Load(fsys fs.FS) ([]Case, error) {
+	var cases []Case
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".qasm" {
+			return err
+		}
+		section := path.Dir(p)
+		if section == "." {
+			return fmt.Errorf("%s: cases must be in a section directory", p)
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		src := string(content)
+		cases = append(cases, Case{
+			Section: section,
+			Name:    strings.TrimSuffix(path.Base(p), ".qasm"),
+			Source:  src,
+			Valid:   !strings.HasPrefix(src, invalidMarker),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(cases, func(i, j int) bool {
+		if cases[i].Section != cases[j].Section {
+			return cases[i].Section < cases[j].Section
+		}
+		return cases[i].Name < cases[j].Name
+	})
+	return cases, nil
+}
+
+// Checker parses src and returns its errors, or nil if it is accepted
+type Checker func(src string) error
+
+// Parser checks cases with a parser configured by opts. Syntax errors are
+// always reported, whatever opts.ErrorRecovery says, since recovering
+// from them would accept every invalid case.
+func Parser(opts *parser.ParseOptions) Checker {
+	o := *parser.DefaultParseOptions()
+	if opts != nil {
+		o = *opts
+	}
+	o.ErrorRecovery = false
+	p := parser.NewParserWithOptions(&o)
+	return func(src string) error {
+		return p.ParseWithErrors(src).Err()
+	}
+}
+
+// Result is the outcome of one case
+type Result struct {
+	Case
+	Passed bool `json:"passed"`
+
+	// Err is what the checker returned: the unexpected errors of a
+	// failed valid case, or the expected ones of a passed invalid case
+	Err error `json:"-"`
+}
+
+// Report is the outcome of a run
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Run checks every case
+func Run(cases []Case, check Checker) *Report {
+	report := &Report{Results: make([]Result, len(cases))}
+	for i, c := range cases {
+		err := check(c.Source)
+		report.Results[i] = Result{Case: c, Passed: (err == nil) == c.Valid, Err: err}
+	}
+	return report
+}
+
+// Passed reports whether every case passed
+func (r *Report) Passed() bool {
+	for _, res := range r.Results {
+		if !res.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Failures returns the results of the cases that failed
+func (r *Report) Failures() []Result {
+	var failed []Result
+	for _, res := range r.Results {
+		if !res.Passed {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// SectionSummary counts the results of one section
+type SectionSummary struct {
+	Section string `json:"section"`
+	Passed  int    `json:"passed"`
+	Failed  int    `json:"failed"`
+}
+
+// Sections summarizes the results by section, in section order
+func (r *Report) Sections() []SectionSummary {
+	var sections []SectionSummary
+	for _, res := range r.Results {
+		if len(sections) == 0 || sections[len(sections)-1].Section != res.Section {
+			sections = append(sections, SectionSummary{Section: res.Section})
+		}
+		s := &sections[len(sections)-1]
+		if res.Passed {
+			s.Passed++
+		} else {
+			s.Failed++
+		}
+	}
+	return sections
+}
+
+// WriteText writes a pass/fail table by section followed by the failed
+// cases and why they failed
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SECTION\tPASSED\tFAILED")
+	for _, s := range r.Sections() {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", s.Section, s.Passed, s.Failed)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, res := range r.Failures() {
+		reason := "accepted an invalid program"
+		if res.Valid {
+			reason = "rejected a valid program: " + firstLine(res.Err.Error())
+		}
+		if _, err := fmt.Fprintf(w, "FAIL %s/%s: %s\n", res.Section, res.Name, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,76 @@
+package conformance
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestBundledSuite(t *testing.T) {
+	cases := Cases()
+	if len(cases) == 0 {
+		t.Fatal("no bundled cases")
+	}
+	report := Run(cases, Parser(nil))
+	for _, res := range report.Failures() {
+		t.Errorf("%s/%s failed: %v", res.Section, res.Name, res.Err)
+	}
+
+	// ErrorRecovery would accept invalid programs, so Parser ignores it
+	report = Run(cases, Parser(&parser.ParseOptions{ErrorRecovery: true}))
+	if !report.Passed() {
+		t.Errorf("suite failed with ErrorRecovery set: %v", report.Failures())
+	}
+}
+
+func TestReport(t *testing.T) {
+	cases, err := Load(fstest.MapFS{
+		"gates/ok.qasm":     {Data: []byte("OPENQASM 3.0;\nqubit q;\n")},
+		"gates/bad.qasm":    {Data: []byte(invalidMarker + "\nOPENQASM 3.0;\nqubit q;\n")},
+		"types/ok.qasm":     {Data: []byte("OPENQASM 3.0;\nbit b;\n")},
+		"types/notes.txt":   {Data: []byte("ignored")},
+		"types/broken.qasm": {Data: []byte("OPENQASM 3.0;\nbit ;\n")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 4 || cases[0].Name != "bad" || cases[0].Valid {
+		t.Fatalf("cases = %+v", cases)
+	}
+
+	// A checker that only rejects the text "bit ;"
+	check := func(src string) error {
+		if strings.Contains(src, "bit ;") {
+			return errors.New("missing identifier")
+		}
+		return nil
+	}
+	report := Run(cases, check)
+	sections := report.Sections()
+	if len(sections) != 2 || sections[0] != (SectionSummary{"gates", 1, 1}) || sections[1] != (SectionSummary{"types", 1, 1}) {
+		t.Errorf("Sections() = %+v", sections)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "SECTION  PASSED  FAILED\n" +
+		"gates    1       1\n" +
+		"types    1       1\n" +
+		"FAIL gates/bad: accepted an invalid program\n" +
+		"FAIL types/broken: rejected a valid program: missing identifier\n"
+	if buf.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestLoadRequiresSections(t *testing.T) {
+	if _, err := Load(fstest.MapFS{"top.qasm": {Data: []byte("OPENQASM 3.0;\n")}}); err == nil {
+		t.Error("Load() accepted a case outside a section")
+	}
+}
@@ -0,0 +1,151 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/anonymize"
+	"github.com/orangekame3/qasmparser/compat"
+	"github.com/orangekame3/qasmparser/doc"
+	"github.com/orangekame3/qasmparser/estimate"
+	"github.com/orangekame3/qasmparser/highlight"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/stats"
+	"github.com/orangekame3/qasmparser/stdlib"
+)
+
+// emitters produce every output format from a fresh parse of a program.
+// Output must be byte-identical for identical input, so it can be cached
+// by content.
+var emitters = map[string]func(t *testing.T, src string) []byte{
+	"printer": func(t *testing.T, src string) []byte {
+		program := parse(t, src)
+		var buf bytes.Buffer
+		buf.WriteString(printer.Print(program))
+		symbolic := &printer.Config{Numbers: printer.NumberStyle{Pi: printer.PiSymbolic}, MaxWidth: 40}
+		buf.WriteString(symbolic.Print(program))
+		numeric := &printer.Config{Numbers: printer.NumberStyle{Format: 'e', Precision: 6, Pi: printer.PiNumeric}}
+		buf.WriteString(numeric.Print(program))
+		return buf.Bytes()
+	},
+	"json": func(t *testing.T, src string) []byte {
+		program := parse(t, src)
+		want, err := json.Marshal(program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The encoder's output must not depend on how many workers
+		// marshal statements
+		for _, workers := range []int{1, 4} {
+			var buf bytes.Buffer
+			enc := parser.NewJSONEncoder(&buf)
+			enc.SetWorkers(workers)
+			if err := enc.Encode(program); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("encoder with %d workers differs from json.Marshal", workers)
+			}
+		}
+		data, err := compat.Marshal(program, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(want, data...)
+	},
+	"doc": func(t *testing.T, src string) []byte {
+		d := doc.Extract(parse(t, src))
+		var buf bytes.Buffer
+		if err := d.WriteJSON(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.WriteMarkdown(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	},
+	"highlight": func(t *testing.T, src string) []byte {
+		var buf bytes.Buffer
+		if err := highlight.WriteHTML(&buf, src); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	},
+	"anonymize": func(t *testing.T, src string) []byte {
+		out, err := anonymize.Source(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []byte(out)
+	},
+	"stats": func(t *testing.T, src string) []byte {
+		program := parse(t, src)
+		s := stats.Compute(program)
+		var buf bytes.Buffer
+		if err := stats.WriteTable(&buf, stats.Compare(s, stats.Stats{})); err != nil {
+			t.Fatal(err)
+		}
+		if err := stats.WriteHistogram(&buf, stats.Hotspots(program), 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := stats.WriteLifetimes(&buf, analysis.Liveness(program)); err != nil {
+			t.Fatal(err)
+		}
+		report := estimate.Fidelity(program, &stdlib.Library{}, nil)
+		if err := report.WriteText(&buf, 0); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	},
+	"analysis": func(t *testing.T, src string) []byte {
+		program := parse(t, src)
+		data, err := json.Marshal([]interface{}{
+			stats.Compute(program),
+			analysis.Outline(program),
+			analysis.FoldingRanges(program),
+			analysis.Moments(program),
+			analysis.Partition(program, 2),
+			analysis.CallSites(program),
+			analysis.AuditBits(program),
+			anonymize.Program(program),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	},
+}
+
+func parse(t *testing.T, src string) *parser.Program {
+	t.Helper()
+	program := parser.NewParser().ParseWithErrors(src).Program
+	if program == nil {
+		t.Fatal("no program")
+	}
+	return program
+}
+
+// TestDeterministicOutput emits every valid case of the suite several
+// times, so map iteration order or concurrency leaking into any output
+// shows up as a difference between runs
+func TestDeterministicOutput(t *testing.T) {
+	for name, emit := range emitters {
+		t.Run(name, func(t *testing.T) {
+			for _, c := range Cases() {
+				if !c.Valid {
+					continue
+				}
+				first := emit(t, c.Source)
+				for range 10 {
+					if !bytes.Equal(emit(t, c.Source), first) {
+						t.Errorf("%s/%s: output differs between runs", c.Section, c.Name)
+						break
+					}
+				}
+			}
+		})
+	}
+}
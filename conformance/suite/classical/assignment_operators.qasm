@@ -0,0 +1,6 @@
+OPENQASM 3.0;
+int[32] a = 1;
+a = 2;
+a += 3;
+a -= 1;
+a *= 2;
@@ -0,0 +1,7 @@
+OPENQASM 3.0;
+int[32] a = 3;
+int[32] b = 4;
+int[32] c = (a + b) * 2 - a / b % 3;
+bool d = a < b && !(a == b) || a >= b;
+int[32] e = a << 2 | b & 1 ^ a;
+float[64] f = sin(pi / 4) ** 2;
@@ -0,0 +1,3 @@
+// conformance: invalid
+OPENQASM 3.0;
+int[32] a = (1 + 2;
@@ -0,0 +1,6 @@
+OPENQASM 3.0;
+// A line comment
+/* A block comment
+   spanning several lines */
+qubit q; // trailing comment
+h /* inline */ q;
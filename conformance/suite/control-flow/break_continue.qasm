@@ -0,0 +1,11 @@
+OPENQASM 3.0;
+int[32] total = 0;
+for int i in [0:10] {
+  if (i == 2) {
+    continue;
+  }
+  if (i == 8) {
+    break;
+  }
+  total += i;
+}
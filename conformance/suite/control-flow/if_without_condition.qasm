@@ -0,0 +1,4 @@
+// conformance: invalid
+OPENQASM 3.0;
+if {
+}
@@ -0,0 +1,13 @@
+OPENQASM 3.0;
+include "stdgates.inc";
+qubit[4] q;
+for uint i in [0:3] {
+  h q[i];
+}
+for int j in {0, 2} {
+  x q[j];
+}
+int[32] n = 3;
+while (n > 0) {
+  n -= 1;
+}
@@ -0,0 +1,5 @@
+OPENQASM 3.0;
+pragma compiler.optimize 2
+qubit q;
+@bind physical
+reset q;
@@ -0,0 +1,7 @@
+OPENQASM 3.0;
+gate mygate(theta) a, b {
+  U(theta, 0, pi) a;
+  ctrl @ U(pi, 0, pi) a, b;
+}
+qubit[2] q;
+mygate(pi / 4) q[0], q[1];
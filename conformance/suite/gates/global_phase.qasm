@@ -0,0 +1,4 @@
+OPENQASM 3.0;
+qubit q;
+gphase(pi / 2);
+U(0, 0, 0) q;
@@ -0,0 +1,8 @@
+OPENQASM 3.0;
+include "stdgates.inc";
+qubit[3] q;
+ctrl @ x q[0], q[1];
+negctrl @ x q[0], q[1];
+inv @ s q[2];
+pow(2) @ t q[2];
+ctrl(2) @ x q[0], q[1], q[2];
@@ -0,0 +1,4 @@
+// conformance: invalid
+OPENQASM 3.0;
+gate g a {
+  U(0, 0, 0) a;
@@ -0,0 +1,6 @@
+OPENQASM 3.0;
+input float[64] theta;
+output bit result;
+qubit q;
+U(theta, 0, 0) q;
+result = measure q;
@@ -0,0 +1,8 @@
+OPENQASM 3.0;
+qubit[2] q;
+bit[2] c;
+reset q;
+barrier q;
+c[0] = measure q[0];
+measure q[1] -> c[1];
+c = measure q;
@@ -0,0 +1,12 @@
+OPENQASM 3.0;
+include "stdgates.inc";
+def flip(qubit q) -> bit {
+  x q;
+  return measure q;
+}
+def add(int[32] a, int[32] b) -> int[32] {
+  return a + b;
+}
+qubit q;
+bit result = flip(q);
+int[32] sum = add(1, 2);
@@ -0,0 +1,4 @@
+OPENQASM 3.0;
+extern classify(bit[4]) -> int[32];
+bit[4] bits;
+int[32] label = classify(bits);
@@ -0,0 +1,3 @@
+// conformance: invalid
+OPENQASM 3.0;
+def f(int[32] a) -> int[32];
@@ -0,0 +1,9 @@
+OPENQASM 3.0;
+qubit q;
+duration d = 100ns;
+delay[d] q;
+box {
+  U(0, 0, 0) q;
+}
+stretch s;
+delay[s] q;
@@ -0,0 +1,4 @@
+OPENQASM 3.0;
+int[32] i = 7;
+float[64] f = float[64](i);
+bool b = bool(i);
@@ -0,0 +1,9 @@
+OPENQASM 3.0;
+bit b;
+bit[8] byte = "00001111";
+int[32] i = -5;
+uint[16] u = 0x1F;
+float[64] f = 1.5e-3;
+bool flag = true;
+angle[20] theta = pi / 2;
+const int n = 4;
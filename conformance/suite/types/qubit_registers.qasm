@@ -0,0 +1,5 @@
+OPENQASM 3.0;
+qubit q;
+qubit[5] register;
+qreg legacy[2];
+creg bits[2];
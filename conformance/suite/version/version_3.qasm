@@ -0,0 +1,2 @@
+OPENQASM 3;
+qubit q;
@@ -0,0 +1,281 @@
+// Package daemon keeps a long-lived parsing process behind a local unix
+// socket, so build systems that invoke the tool repeatedly share warm
+// caches instead of paying full startup cost on each run.
+//
+// A Server answers requests from Clients with net/rpc. Results are cached
+// by file content, so unchanged files are not parsed again.
+package daemon
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/orangekame3/qasmparser/metrics"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// serviceName is the name the server registers its methods under
+const serviceName = "Daemon"
+
+// DefaultCacheSize is how many results a server keeps when NewServer is
+// given no size
+const DefaultCacheSize = 1024
+
+// DefaultSocket returns the socket path the daemon listens on by default,
+// in the user's runtime directory when there is one
+func DefaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "qasmparser.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("qasmparser-%d.sock", os.Getuid()))
+}
+
+// Request names a file to process. Content is read from File when nil.
+type Request struct {
+	File    string
+	Content []byte
+}
+
+// Reply is the result of processing one file
+type Reply struct {
+	Errors []parser.ParseError
+
+	// Formatted is the canonical form of the program, set by Format
+	Formatted string
+
+	// Cached reports whether the result came from the cache
+	Cached bool
+}
+
+// Stats describe the state of a server
+type Stats struct {
+	Requests  int
+	CacheHits int
+	Cached    int
+}
+
+// Server parses files for clients, caching results by content
+type Server struct {
+	parser  *parser.Parser
+	metrics *metrics.Metrics
+
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type entry struct {
+	key       [sha256.Size]byte
+	errors    []parser.ParseError
+	formatted string
+	formatErr error
+}
+
+// NewServer creates a server parsing with p and caching up to cacheSize
+// results, evicting the least recently used. A cacheSize of zero means
+// DefaultCacheSize.
+func NewServer(p *parser.Parser, cacheSize int) *Server {
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+	return &Server{
+		parser:  p,
+		metrics: metrics.New(),
+		size:    cacheSize,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// Metrics returns the requests, cache lookups and parse times the server
+// has recorded, which Stats summarizes and metrics.Handler can export
+func (s *Server) Metrics() *metrics.Metrics {
+	return s.metrics
+}
+
+// Serve answers clients connecting to l until l is closed
+func (s *Server) Serve(l net.Listener) error {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName(serviceName, &service{s}); err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go srv.ServeConn(conn)
+	}
+}
+
+// Listen opens the unix socket at path, replacing a stale socket left by
+// a daemon that did not shut down cleanly. It fails if a daemon is
+// already answering there, or if path is some other kind of file.
+func Listen(path string) (net.Listener, error) {
+	if c, err := Dial(path); err == nil {
+		c.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	case info.Mode()&os.ModeSocket == 0:
+		return nil, fmt.Errorf("%s exists and is not a socket", path)
+	default:
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// process returns the cached or fresh result for req
+func (s *Server) process(req Request) (*entry, bool, error) {
+	content := req.Content
+	if content == nil {
+		var err error
+		if content, err = os.ReadFile(req.File); err != nil {
+			return nil, false, err
+		}
+	}
+	key := sha256.Sum256(content)
+
+	s.mu.Lock()
+	if el, ok := s.entries[key]; ok {
+		s.order.MoveToFront(el)
+		s.mu.Unlock()
+		s.metrics.CacheHit()
+		return el.Value.(*entry), true, nil
+	}
+	s.mu.Unlock()
+	s.metrics.CacheMiss()
+
+	start := time.Now()
+	result := s.parser.ParseBytesWithErrors(content)
+	s.metrics.ObserveParse(time.Since(start))
+	e := &entry{key: key, errors: result.Errors}
+	if !result.HasErrors() {
+		e.formatted, e.formatErr = printer.Format(s.parser, result.Program)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; !ok {
+		s.entries[key] = s.order.PushFront(e)
+		if s.order.Len() > s.size {
+			oldest := s.order.Back()
+			s.order.Remove(oldest)
+			delete(s.entries, oldest.Value.(*entry).key)
+		}
+	}
+	return e, false, nil
+}
+
+// service holds the methods clients call. It is separate from Server so
+// the exported Server methods are not mistaken for RPC methods.
+type service struct {
+	s *Server
+}
+
+func (v *service) Check(req Request, reply *Reply) (err error) {
+	defer func() { v.s.metrics.ObserveRequest("check", err != nil) }()
+	e, cached, err := v.s.process(req)
+	if err != nil {
+		return err
+	}
+	*reply = Reply{Errors: withFile(e.errors, req.File), Cached: cached}
+	return nil
+}
+
+func (v *service) Format(req Request, reply *Reply) (err error) {
+	defer func() { v.s.metrics.ObserveRequest("format", err != nil) }()
+	e, cached, err := v.s.process(req)
+	if err != nil {
+		return err
+	}
+	if e.formatErr != nil {
+		return e.formatErr
+	}
+	*reply = Reply{Errors: withFile(e.errors, req.File), Formatted: e.formatted, Cached: cached}
+	return nil
+}
+
+func (v *service) Stats(_ struct{}, stats *Stats) error {
+	// Every request that reads its file looks up the cache once
+	hits, misses := v.s.metrics.CacheCounts()
+	v.s.mu.Lock()
+	defer v.s.mu.Unlock()
+	*stats = Stats{Requests: int(hits + misses), CacheHits: int(hits), Cached: v.s.order.Len()}
+	return nil
+}
+
+// withFile returns a copy of diags naming file, since cached diagnostics
+// are shared by every file with the same content
+func withFile(diags []parser.ParseError, file string) []parser.ParseError {
+	out := make([]parser.ParseError, len(diags))
+	for i, d := range diags {
+		d.File = file
+		out[i] = d
+	}
+	return out
+}
+
+// Client talks to a running daemon
+type Client struct {
+	rpc *rpc.Client
+}
+
+// Dial connects to the daemon listening on the unix socket at path
+func Dial(path string) (*Client, error) {
+	c, err := rpc.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rpc: c}, nil
+}
+
+// Check parses a file and returns its diagnostics
+func (c *Client) Check(req Request) (*Reply, error) {
+	var reply Reply
+	if err := c.rpc.Call(serviceName+".Check", req, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// Format parses a file and returns its canonical form, or its
+// diagnostics if it has errors
+func (c *Client) Format(req Request) (*Reply, error) {
+	var reply Reply
+	if err := c.rpc.Call(serviceName+".Format", req, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// Stats returns the daemon's request and cache counters
+func (c *Client) Stats() (Stats, error) {
+	var stats Stats
+	err := c.rpc.Call(serviceName+".Stats", struct{}{}, &stats)
+	return stats, err
+}
+
+// Close closes the connection to the daemon
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
@@ -0,0 +1,135 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func start(t *testing.T, cacheSize int) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "d.sock")
+	l, err := Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(parser.NewParserWithOptions(&parser.ParseOptions{ErrorRecovery: false}), cacheSize)
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+	t.Cleanup(func() {
+		l.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() = %v", err)
+		}
+	})
+	return socket
+}
+
+func dial(t *testing.T, socket string) *Client {
+	t.Helper()
+	c, err := Dial(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestCheckAndFormat(t *testing.T) {
+	c := dial(t, start(t, 0))
+
+	path := filepath.Join(t.TempDir(), "good.qasm")
+	if err := os.WriteFile(path, []byte("OPENQASM 3.0;\nqubit   q;\nh q ;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := c.Format(Request{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Errors) != 0 || reply.Cached {
+		t.Errorf("first Format() = %+v", reply)
+	}
+	if want := "OPENQASM 3.0;\nqubit q;\nh q;\n"; reply.Formatted != want {
+		t.Errorf("Formatted = %q, want %q", reply.Formatted, want)
+	}
+
+	reply, err = c.Check(Request{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reply.Cached {
+		t.Error("second request was not answered from the cache")
+	}
+
+	reply, err = c.Check(Request{File: "bad.qasm", Content: []byte("OPENQASM 3.0;\nqubit q\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Errors) == 0 || reply.Errors[0].File != "bad.qasm" {
+		t.Errorf("Check() errors = %v, want a syntax error in bad.qasm", reply.Errors)
+	}
+
+	if _, err := c.Check(Request{File: filepath.Join(t.TempDir(), "missing.qasm")}); err == nil {
+		t.Error("Check() of a missing file succeeded")
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Requests != 3 || stats.CacheHits != 1 || stats.Cached != 2 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := dial(t, start(t, 1))
+	for _, src := range []string{"OPENQASM 3.0;\nqubit a;\n", "OPENQASM 3.0;\nqubit b;\n", "OPENQASM 3.0;\nqubit a;\n"} {
+		reply, err := c.Check(Request{File: "f.qasm", Content: []byte(src)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.Cached {
+			t.Errorf("%q was answered from a cache of one after eviction", src)
+		}
+	}
+}
+
+func TestListenRefusesRunningDaemon(t *testing.T) {
+	socket := start(t, 0)
+	if _, err := Listen(socket); err == nil {
+		t.Error("Listen() succeeded on a socket a daemon is serving")
+	}
+}
+
+func TestListenReplacesOnlySockets(t *testing.T) {
+	dir := t.TempDir()
+
+	// A socket left by a daemon that did not shut down is replaced
+	stale := filepath.Join(dir, "stale.sock")
+	l, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if l, err = Listen(stale); err != nil {
+		t.Fatalf("Listen() on a stale socket = %v", err)
+	}
+	l.Close()
+
+	// Any other file is left alone
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, []byte("keep me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(file); err == nil {
+		t.Error("Listen() succeeded on a regular file")
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "keep me" {
+		t.Errorf("Listen() removed or changed a regular file: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,196 @@
+// Package debugger steps through a program on the state-vector simulator
+// of package sim, stopping at line breakpoints to inspect the amplitudes,
+// probabilities and classical variables:
+//
+//	s, err := debugger.New(program, nil)
+//	s.Break(12)
+//	for !s.Done() {
+//		if err := s.Continue(); err != nil { ... }
+//		fmt.Println(s.Inspect())
+//	}
+package debugger
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/sim"
+)
+
+// Session is a program being debugged
+type Session struct {
+	machine     *sim.Machine
+	lines       map[int]bool
+	breakpoints map[int]bool
+}
+
+// New starts a session at the first statement of program
+func New(program *parser.Program, opts *sim.RunOptions) (*Session, error) {
+	m, err := sim.NewMachine(program, opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{machine: m, lines: make(map[int]bool), breakpoints: make(map[int]bool)}
+	statements(s.lines, program.Statements)
+	return s, nil
+}
+
+// Break sets a breakpoint on a line, which must start a statement outside
+// gate and subroutine bodies
+func (s *Session) Break(line int) error {
+	if !s.lines[line] {
+		return fmt.Errorf("no statement starts on line %d", line)
+	}
+	s.breakpoints[line] = true
+	return nil
+}
+
+// Clear removes the breakpoint on a line
+func (s *Session) Clear(line int) {
+	delete(s.breakpoints, line)
+}
+
+// Breakpoints returns the lines with breakpoints in order
+func (s *Session) Breakpoints() []int {
+	lines := make([]int, 0, len(s.breakpoints))
+	for line := range s.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Done reports whether the program has ended
+func (s *Session) Done() bool {
+	return s.machine.Done()
+}
+
+// Line returns the line of the statement to execute next, or 0 when the
+// program has ended
+func (s *Session) Line() int {
+	if stmt := s.machine.Next(); stmt != nil {
+		return stmt.Pos().Line
+	}
+	return 0
+}
+
+// Step executes the next statement
+func (s *Session) Step() error {
+	return s.machine.Step()
+}
+
+// Continue executes statements until the next one is on a line with a
+// breakpoint or the program ends. It always executes at least one, so
+// that continuing from a breakpoint moves past it.
+func (s *Session) Continue() error {
+	for {
+		if err := s.machine.Step(); err != nil {
+			return err
+		}
+		if s.Done() || s.breakpoints[s.Line()] {
+			return nil
+		}
+	}
+}
+
+// State is what the session shows when it stops
+type State struct {
+	// Line and Statement are those executed next; zero when the program
+	// has ended
+	Line      int
+	Statement parser.Statement
+
+	// Amplitudes and Probabilities are indexed by basis state, with the
+	// first of Qubits most significant
+	Qubits        []string
+	Amplitudes    []complex128
+	Probabilities []float64
+
+	// Variables are the classical variables and constants
+	Variables map[string]analysis.Value
+}
+
+// Inspect returns the current state of the program
+func (s *Session) Inspect() *State {
+	return &State{
+		Line:          s.Line(),
+		Statement:     s.machine.Next(),
+		Qubits:        s.machine.Qubits(),
+		Amplitudes:    s.machine.State(),
+		Probabilities: s.machine.Probabilities(),
+		Variables:     s.machine.Variables(),
+	}
+}
+
+// String shows the next line, the basis states with nonzero amplitude
+// and the variables in name order:
+//
+//	line 8: c = measure q;
+//	|00⟩  0.7071+0.0000i  p=0.5000
+//	|11⟩  0.7071+0.0000i  p=0.5000
+//	n = 0
+func (st *State) String() string {
+	var b strings.Builder
+	if st.Statement == nil {
+		b.WriteString("program ended\n")
+	} else {
+		source, _, _ := strings.Cut(printer.Statement(st.Statement), "\n")
+		fmt.Fprintf(&b, "line %d: %s\n", st.Line, source)
+	}
+	for i, a := range st.Amplitudes {
+		if cmplx.Abs(a) < 1e-9 {
+			continue
+		}
+		fmt.Fprintf(&b, "|%s⟩  %.4f%+.4fi  p=%.4f\n", ket(i, len(st.Qubits)), clean(real(a)), clean(imag(a)), st.Probabilities[i])
+	}
+	names := make([]string, 0, len(st.Variables))
+	for name := range st.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s = %s\n", name, st.Variables[name])
+	}
+	return b.String()
+}
+
+// ket spells basis state i of n qubits, first qubit leftmost
+func ket(i, n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%0*b", n, i)
+}
+
+// clean rounds what would print as zero to zero, so that it never prints
+// as -0.0000
+func clean(f float64) float64 {
+	if math.Abs(f) < 5e-5 {
+		return 0
+	}
+	return f
+}
+
+// statements records the lines of the statements the machine stops at:
+// those of the program and of the bodies of its branches and loops, but
+// not of gates, which run as a whole
+func statements(lines map[int]bool, stmts []parser.Statement) {
+	for _, stmt := range stmts {
+		lines[stmt.Pos().Line] = true
+		switch s := stmt.(type) {
+		case *parser.IfStatement:
+			statements(lines, s.ThenBody)
+			statements(lines, s.ElseBody)
+		case *parser.ForStatement:
+			statements(lines, s.Body)
+		case *parser.WhileStatement:
+			statements(lines, s.Body)
+		}
+	}
+}
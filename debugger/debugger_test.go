@@ -0,0 +1,93 @@
+package debugger
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const source = `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+bit[2] c;
+int n = 0;
+h q[0];
+cx q[0], q[1];
+for int i in [1:3] {
+  n += i;
+}
+c = measure q;
+`
+
+func session(t *testing.T) *Session {
+	t.Helper()
+	program, err := parser.NewParser().ParseString(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(program, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestContinue(t *testing.T) {
+	s := session(t)
+	if err := s.Break(1); err == nil {
+		t.Error("Break() accepted the version line")
+	}
+	for _, line := range []int{7, 9, 11} {
+		if err := s.Break(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Clear(11)
+	if got := s.Breakpoints(); !slices.Equal(got, []int{7, 9}) {
+		t.Errorf("Breakpoints() = %v", got)
+	}
+
+	var stops []int
+	for !s.Done() {
+		if err := s.Continue(); err != nil {
+			t.Fatal(err)
+		}
+		stops = append(stops, s.Line())
+	}
+	// The loop body stops once per iteration
+	if want := []int{7, 9, 9, 9, 0}; !slices.Equal(stops, want) {
+		t.Errorf("stopped on lines %v, want %v", stops, want)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	s := session(t)
+	if err := s.Break(9); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	want := `line 9: n += i;
+|00⟩  0.7071+0.0000i  p=0.5000
+|11⟩  0.7071+0.0000i  p=0.5000
+c = 0
+i = 1
+n = 0
+`
+	if got := s.Inspect().String(); got != want {
+		t.Errorf("Inspect() =\n%s\nwant\n%s", got, want)
+	}
+
+	if err := s.Step(); err != nil {
+		t.Fatal(err)
+	}
+	st := s.Inspect()
+	if st.Line != 9 || st.Variables["n"].Int != 1 || st.Variables["i"].Int != 2 {
+		t.Errorf("after a step: line %d, variables %v", st.Line, st.Variables)
+	}
+	if !slices.Equal(st.Qubits, []string{"q[0]", "q[1]"}) || len(st.Amplitudes) != 4 {
+		t.Errorf("qubits %v with %d amplitudes", st.Qubits, len(st.Amplitudes))
+	}
+}
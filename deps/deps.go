@@ -0,0 +1,208 @@
+// Package deps resolves include directives to files and computes the
+// include dependencies of programs, so build systems can rebuild the
+// right targets when an included file changes.
+package deps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/stdlib"
+)
+
+// Resolver finds the files include directives refer to. An include is
+// looked up next to the including file first, then in each of Paths in
+// order. Standard includes such as stdgates.inc are provided by the
+// compiler and are not looked up unless a file of that name exists.
+type Resolver struct {
+	// Paths are the include search directories
+	Paths []string
+
+	// FS, when set, is read instead of the operating system's file
+	// system. Paths within it use forward slashes.
+	FS fs.FS
+}
+
+// ErrNotFound is wrapped by errors for includes no file matches
+var ErrNotFound = errors.New("include not found")
+
+// Resolve returns the path of the file that include, written in the file
+// from, refers to. For a standard include with no file on the search
+// path it returns the include unchanged and standard set to true.
+func (r *Resolver) Resolve(from, include string) (resolved string, standard bool, err error) {
+	found := r.locate(from, include)
+	if len(found) > 0 {
+		return found[0], false, nil
+	}
+	if stdlib.IsStandard(include) {
+		return include, true, nil
+	}
+	return "", false, fmt.Errorf("%s: %q: %w", from, include, ErrNotFound)
+}
+
+// locate returns every existing file include could refer to, in search
+// order
+func (r *Resolver) locate(from, include string) []string {
+	candidates := []string{r.join(r.dir(from), include)}
+	for _, dir := range r.Paths {
+		candidates = append(candidates, r.join(dir, include))
+	}
+	if r.isAbs(include) {
+		candidates = []string{r.clean(include)}
+	}
+	var found []string
+	for _, c := range candidates {
+		if r.exists(c) && !contains(found, c) {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Includes returns the include paths a file contains, as written
+func (r *Resolver) Includes(file string) ([]string, error) {
+	program, err := r.parse(file)
+	if err != nil {
+		return nil, err
+	}
+	var includes []string
+	for _, stmt := range program.Statements {
+		if inc, ok := stmt.(*parser.Include); ok {
+			includes = append(includes, inc.Path)
+		}
+	}
+	return includes, nil
+}
+
+func (r *Resolver) parse(file string) (*parser.Program, error) {
+	content, err := r.read(file)
+	if err != nil {
+		return nil, err
+	}
+	result := parser.NewParser().ParseBytesWithErrors(content)
+	if result.Program == nil {
+		return nil, result.Err()
+	}
+	return result.Program, nil
+}
+
+// Closure is the transitive include dependencies of one file
+type Closure struct {
+	File string `json:"file"`
+
+	// Files are the included files found, in the order they are first
+	// reached
+	Files []string `json:"files"`
+
+	// Standard are the standard includes with no file behind them
+	Standard []string `json:"standard,omitempty"`
+}
+
+// Closure follows the includes of file transitively. Each file is listed
+// once even if included repeatedly or in a cycle. An include that cannot
+// be resolved is an error, since build systems cannot track a dependency
+// they do not know.
+func (r *Resolver) Closure(file string) (*Closure, error) {
+	g, err := r.Graph(file)
+	c := &Closure{File: file, Files: append([]string{}, g.Files[1:]...)}
+	for _, e := range g.Edges {
+		if e.Standard && !contains(c.Standard, e.To) {
+			c.Standard = append(c.Standard, e.To)
+		}
+	}
+	return c, err
+}
+
+// WriteJSON writes closures as a JSON array
+func WriteJSON(w io.Writer, closures []*Closure) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(closures)
+}
+
+// WriteMake writes closures as Makefile dependency rules, the format
+// compilers emit with -M and most build tools can read:
+//
+//	main.qasm: lib/gates.inc lib/util.inc
+func WriteMake(w io.Writer, closures []*Closure) error {
+	for _, c := range closures {
+		line := makeEscape(c.File) + ":"
+		for _, f := range c.Files {
+			line += " " + makeEscape(f)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeEscape escapes the characters make treats specially in file names
+func makeEscape(name string) string {
+	return strings.NewReplacer(" ", `\ `, "#", `\#`, "$", "$$").Replace(name)
+}
+
+func (r *Resolver) read(name string) ([]byte, error) {
+	if r.FS != nil {
+		return fs.ReadFile(r.FS, name)
+	}
+	return os.ReadFile(name)
+}
+
+func (r *Resolver) exists(name string) bool {
+	var (
+		info fs.FileInfo
+		err  error
+	)
+	if r.FS != nil {
+		info, err = fs.Stat(r.FS, name)
+	} else {
+		info, err = os.Stat(name)
+	}
+	return err == nil && !info.IsDir()
+}
+
+func (r *Resolver) dir(name string) string {
+	if r.FS != nil {
+		return path.Dir(name)
+	}
+	return filepath.Dir(name)
+}
+
+func (r *Resolver) join(dir, name string) string {
+	if r.FS != nil {
+		return path.Join(dir, name)
+	}
+	return filepath.Join(dir, name)
+}
+
+func (r *Resolver) clean(name string) string {
+	if r.FS != nil {
+		return path.Clean(name)
+	}
+	return filepath.Clean(name)
+}
+
+func (r *Resolver) isAbs(name string) bool {
+	if r.FS != nil {
+		return false
+	}
+	return filepath.IsAbs(name)
+}
@@ -0,0 +1,96 @@
+package deps
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var project = fstest.MapFS{
+	"main.qasm": {Data: []byte(`OPENQASM 3.0;
+include "stdgates.inc";
+include "lib/a.inc";
+include "shared.inc";
+qubit q;
+`)},
+	"lib/a.inc":         {Data: []byte("include \"b.inc\";\ninclude \"../main.qasm\";\n")},
+	"lib/b.inc":         {Data: []byte("include \"shared.inc\";\n")},
+	"vendor/shared.inc": {Data: []byte("gate s a { U(0, 0, 0) a; }\n")},
+}
+
+func TestClosure(t *testing.T) {
+	r := &Resolver{FS: project, Paths: []string{"vendor"}}
+	c, err := r.Closure("main.qasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(c.Files, ","), "lib/a.inc,vendor/shared.inc,lib/b.inc"; got != want {
+		t.Errorf("Files = %s, want %s", got, want)
+	}
+	if len(c.Standard) != 1 || c.Standard[0] != "stdgates.inc" {
+		t.Errorf("Standard = %v", c.Standard)
+	}
+}
+
+func TestClosureMissing(t *testing.T) {
+	r := &Resolver{FS: project}
+	c, err := r.Closure("main.qasm")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Closure() error = %v, want ErrNotFound", err)
+	}
+	if len(c.Files) != 2 {
+		t.Errorf("Files = %v, want the includes that were found", c.Files)
+	}
+}
+
+func TestClosureOS(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.qasm", "OPENQASM 3.0;\ninclude \"inc/g.inc\";\n")
+	write("inc/g.inc", "gate g a { U(0, 0, 0) a; }\n")
+
+	r := &Resolver{}
+	c, err := r.Closure(filepath.Join(dir, "main.qasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Files) != 1 || c.Files[0] != filepath.Join(dir, "inc", "g.inc") {
+		t.Errorf("Files = %v", c.Files)
+	}
+}
+
+func TestWriters(t *testing.T) {
+	closures := []*Closure{{File: "my main.qasm", Files: []string{"a.inc", "b.inc"}, Standard: []string{"stdgates.inc"}}}
+
+	var sb strings.Builder
+	if err := WriteMake(&sb, closures); err != nil {
+		t.Fatal(err)
+	}
+	if want := "my\\ main.qasm: a.inc b.inc\n"; sb.String() != want {
+		t.Errorf("WriteMake() = %q, want %q", sb.String(), want)
+	}
+
+	sb.Reset()
+	if err := WriteJSON(&sb, closures); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Closure
+	if err := json.Unmarshal([]byte(sb.String()), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || len(decoded[0].Files) != 2 || decoded[0].Standard[0] != "stdgates.inc" {
+		t.Errorf("WriteJSON() round trip = %+v", decoded)
+	}
+}
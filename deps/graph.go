@@ -0,0 +1,254 @@
+package deps
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/stdlib"
+)
+
+// Edge is one include directive
+type Edge struct {
+	// From is the including file and To the file included, or the
+	// include itself for a standard include with no file
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Include string `json:"include"`
+
+	Standard bool `json:"standard,omitempty"`
+
+	// Shadowed lists other files the include could have referred to,
+	// found later on the search path
+	Shadowed []string `json:"shadowed,omitempty"`
+}
+
+// Graph is the include graph of a set of files
+type Graph struct {
+	// Files are the files in the graph in the order they are first
+	// reached, starting with the roots
+	Files []string `json:"files"`
+	Edges []Edge   `json:"edges"`
+
+	// definitions maps each file to the gates and subroutines it defines
+	definitions map[string][]*definition
+}
+
+type definition struct {
+	name     string
+	position parser.Position
+}
+
+// Graph builds the include graph reachable from roots. Unresolved
+// includes are reported in the error and left out of the graph.
+func (r *Resolver) Graph(roots ...string) (*Graph, error) {
+	g := &Graph{Files: []string{}, Edges: []Edge{}, definitions: make(map[string][]*definition)}
+	seen := make(map[string]bool)
+	var queue []string
+	for _, root := range roots {
+		if !seen[r.clean(root)] {
+			seen[r.clean(root)] = true
+			g.Files = append(g.Files, root)
+			queue = append(queue, root)
+		}
+	}
+
+	var errs []error
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		program, err := r.parse(current)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", current, err))
+			continue
+		}
+		for _, stmt := range program.Statements {
+			switch s := stmt.(type) {
+			case *parser.GateDefinition:
+				g.definitions[current] = append(g.definitions[current], &definition{s.Name, s.Pos()})
+			case *parser.SubroutineDefinition:
+				g.definitions[current] = append(g.definitions[current], &definition{s.Name, s.Pos()})
+			case *parser.Include:
+				found := r.locate(current, s.Path)
+				edge := Edge{From: current, Include: s.Path}
+				switch {
+				case len(found) > 0:
+					edge.To, edge.Shadowed = found[0], found[1:]
+				case stdlib.IsStandard(s.Path):
+					edge.To, edge.Standard = s.Path, true
+				default:
+					errs = append(errs, fmt.Errorf("%s: %q: %w", current, s.Path, ErrNotFound))
+					continue
+				}
+				g.Edges = append(g.Edges, edge)
+				if !edge.Standard && !seen[edge.To] {
+					seen[edge.To] = true
+					g.Files = append(g.Files, edge.To)
+					queue = append(queue, edge.To)
+				}
+			}
+		}
+	}
+	return g, errors.Join(errs...)
+}
+
+// Cycles returns the include cycles in the graph, each as the files it
+// passes through starting from the one reached first
+func (g *Graph) Cycles() [][]string {
+	order := make(map[string]int, len(g.Files))
+	for i, f := range g.Files {
+		order[f] = i
+	}
+	next := make(map[string][]string)
+	for _, e := range g.Edges {
+		if !e.Standard {
+			next[e.From] = append(next[e.From], e.To)
+		}
+	}
+
+	// Tarjan's algorithm finds the strongly connected components; each
+	// with more than one file, or a file including itself, is a cycle
+	var (
+		index   = make(map[string]int)
+		low     = make(map[string]int)
+		onStack = make(map[string]bool)
+		stack   []string
+		cycles  [][]string
+	)
+	var connect func(f string)
+	connect = func(f string) {
+		index[f] = len(index)
+		low[f] = index[f]
+		stack = append(stack, f)
+		onStack[f] = true
+		for _, to := range next[f] {
+			if _, visited := index[to]; !visited {
+				connect(to)
+				low[f] = min(low[f], low[to])
+			} else if onStack[to] {
+				low[f] = min(low[f], index[to])
+			}
+		}
+		if low[f] != index[f] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == f {
+				break
+			}
+		}
+		if len(component) > 1 || contains(next[f], f) {
+			sort.Slice(component, func(i, j int) bool { return order[component[i]] < order[component[j]] })
+			cycles = append(cycles, component)
+		}
+	}
+	for _, f := range g.Files {
+		if _, visited := index[f]; !visited {
+			connect(f)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return order[cycles[i][0]] < order[cycles[j][0]] })
+	return cycles
+}
+
+// Problem kinds reported by Check
+const (
+	ProblemCycle     = "cycle"
+	ProblemDuplicate = "duplicate-definition"
+	ProblemShadowed  = "shadowed-include"
+)
+
+// Problem is something wrong with how a project's files include each
+// other
+type Problem struct {
+	Kind    string `json:"kind"`
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.File, p.Kind, p.Message)
+}
+
+// Check reports include cycles, gates and subroutines defined in more
+// than one file, and includes that resolve to one file while shadowing
+// another of the same name later on the search path
+func (g *Graph) Check() []Problem {
+	var problems []Problem
+	for _, cycle := range g.Cycles() {
+		problems = append(problems, Problem{
+			Kind:    ProblemCycle,
+			File:    cycle[0],
+			Message: "include cycle: " + strings.Join(append(cycle, cycle[0]), " -> "),
+		})
+	}
+
+	first := make(map[string]string)
+	for _, f := range g.Files {
+		for _, def := range g.definitions[f] {
+			if prev, ok := first[def.name]; ok && prev != f {
+				problems = append(problems, Problem{
+					Kind:    ProblemDuplicate,
+					File:    f,
+					Message: fmt.Sprintf("%s is also defined in %s", def.name, prev),
+				})
+				continue
+			}
+			first[def.name] = f
+		}
+	}
+
+	for _, e := range g.Edges {
+		if len(e.Shadowed) > 0 {
+			problems = append(problems, Problem{
+				Kind:    ProblemShadowed,
+				File:    e.From,
+				Message: fmt.Sprintf("%q resolves to %s, shadowing %s", e.Include, e.To, strings.Join(e.Shadowed, ", ")),
+			})
+		}
+	}
+	return problems
+}
+
+// WriteDOT writes the graph in Graphviz DOT format. Standard includes are
+// drawn dashed and edges that take part in a cycle red.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	inCycle := make(map[string]int)
+	for i, cycle := range g.Cycles() {
+		for _, f := range cycle {
+			inCycle[f] = i + 1
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("digraph includes {\n")
+	sb.WriteString("  node [shape=box];\n")
+	for _, f := range g.Files {
+		fmt.Fprintf(&sb, "  %q;\n", f)
+	}
+	standard := make(map[string]bool)
+	for _, e := range g.Edges {
+		if e.Standard && !standard[e.To] {
+			standard[e.To] = true
+			fmt.Fprintf(&sb, "  %q [style=dashed];\n", e.To)
+		}
+	}
+	for _, e := range g.Edges {
+		attrs := ""
+		if c := inCycle[e.From]; c > 0 && c == inCycle[e.To] {
+			attrs = " [color=red]"
+		}
+		fmt.Fprintf(&sb, "  %q -> %q%s;\n", e.From, e.To, attrs)
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,93 @@
+package deps
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var tangled = fstest.MapFS{
+	"main.qasm":        {Data: []byte("OPENQASM 3.0;\ninclude \"stdgates.inc\";\ninclude \"a.inc\";\ninclude \"util.inc\";\n")},
+	"a.inc":            {Data: []byte("include \"b.inc\";\ngate bell x, y { U(0, 0, 0) x; }\n")},
+	"b.inc":            {Data: []byte("include \"a.inc\";\ngate bell x, y { U(0, 0, 0) y; }\n")},
+	"util.inc":         {Data: []byte("include \"util.inc\";\n")},
+	"lib/util.inc":     {Data: []byte("\n")},
+	"lib/stdgates.inc": {Data: []byte("gate h a { U(0, 0, 0) a; }\n")},
+}
+
+func TestGraphCycles(t *testing.T) {
+	g, err := (&Resolver{FS: tangled}).Graph("main.qasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(g.Files, ","), "main.qasm,a.inc,util.inc,b.inc"; got != want {
+		t.Errorf("Files = %s, want %s", got, want)
+	}
+	cycles := g.Cycles()
+	if len(cycles) != 2 {
+		t.Fatalf("Cycles() = %v, want 2 cycles", cycles)
+	}
+	if got := strings.Join(cycles[0], ","); got != "a.inc,b.inc" {
+		t.Errorf("first cycle = %s, want a.inc,b.inc", got)
+	}
+	if got := strings.Join(cycles[1], ","); got != "util.inc" {
+		t.Errorf("second cycle = %s, want util.inc", got)
+	}
+}
+
+func TestGraphCheck(t *testing.T) {
+	g, err := (&Resolver{FS: tangled, Paths: []string{"lib"}}).Graph("main.qasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string][]string)
+	for _, p := range g.Check() {
+		kinds[p.Kind] = append(kinds[p.Kind], p.String())
+	}
+	if len(kinds[ProblemCycle]) != 2 {
+		t.Errorf("cycles = %v", kinds[ProblemCycle])
+	}
+	if d := kinds[ProblemDuplicate]; len(d) != 1 || d[0] != "b.inc: duplicate-definition: bell is also defined in a.inc" {
+		t.Errorf("duplicates = %v", d)
+	}
+	// A stdgates.inc on the search path wins over the built-in one
+	// without being flagged, but util.inc exists in two places
+	if s := kinds[ProblemShadowed]; len(s) != 2 || !strings.Contains(strings.Join(s, "\n"), `"util.inc" resolves to util.inc, shadowing lib/util.inc`) {
+		t.Errorf("shadowed = %v", s)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g, err := (&Resolver{FS: tangled}).Graph("main.qasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := g.WriteDOT(&sb); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	for _, want := range []string{
+		"digraph includes {\n",
+		`  "stdgates.inc" [style=dashed];`,
+		`  "main.qasm" -> "a.inc";`,
+		`  "a.inc" -> "b.inc" [color=red];`,
+		`  "util.inc" -> "util.inc" [color=red];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("DOT output missing %q:\n%s", want, out)
+		}
+	}
+
+	// The output is the same every time, cycles and all
+	for range 10 {
+		g, _ := (&Resolver{FS: tangled}).Graph("main.qasm")
+		sb.Reset()
+		if err := g.WriteDOT(&sb); err != nil {
+			t.Fatal(err)
+		}
+		if sb.String() != out {
+			t.Fatalf("DOT output differs between runs:\n%s\nthen\n%s", out, sb.String())
+		}
+	}
+}
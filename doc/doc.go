@@ -0,0 +1,337 @@
+// Package doc extracts reference documentation for the gates and
+// subroutines a QASM file defines.
+//
+// A definition is documented by the comments directly above it. Lines may
+// use the /// doc-comment convention, and tags describe arguments:
+//
+//	/// Rotation about an arbitrary axis.
+//	/// @param theta rotation angle
+//	/// @param q target qubit
+//	gate rot(theta) q { ... }
+//
+// Subroutines may also use @return to describe their result.
+package doc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Kind identifies what a documented symbol is
+type Kind string
+
+const (
+	KindGate       Kind = "gate"
+	KindSubroutine Kind = "subroutine"
+)
+
+// Param documents one gate parameter, gate qubit or subroutine argument
+type Param struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+	Doc  string `json:"doc,omitempty"`
+}
+
+// Symbol documents one gate or subroutine definition
+type Symbol struct {
+	Kind      Kind            `json:"kind"`
+	Name      string          `json:"name"`
+	Signature string          `json:"signature"`
+	Doc       string          `json:"doc,omitempty"`
+	Params    []Param         `json:"params,omitempty"`
+	Qubits    []Param         `json:"qubits,omitempty"`
+	Returns   string          `json:"returns,omitempty"`
+	ReturnDoc string          `json:"return_doc,omitempty"`
+	Position  parser.Position `json:"position"`
+}
+
+// Document is the documentation of one file
+type Document struct {
+	File    string   `json:"file,omitempty"`
+	Symbols []Symbol `json:"symbols"`
+}
+
+// Extract documents the top-level gate and subroutine definitions of a
+// program. Doc comments are only found if the program was parsed with
+// IncludeComments.
+func Extract(program *parser.Program) *Document {
+	doc := &Document{Symbols: make([]Symbol, 0)}
+	if program == nil {
+		return doc
+	}
+
+	trailing := trailingLines(program)
+	for _, stmt := range program.Statements {
+		var sym Symbol
+		switch s := stmt.(type) {
+		case *parser.GateDefinition:
+			sym = gateSymbol(s)
+		case *parser.SubroutineDefinition:
+			sym = subroutineSymbol(s)
+		default:
+			continue
+		}
+		applyComment(&sym, leadingComment(program.Comments, stmt.Pos().Line, trailing))
+		doc.Symbols = append(doc.Symbols, sym)
+	}
+	return doc
+}
+
+// Comment returns the doc comment directly above node, with comment
+// markers removed and tags left in place, or "" if there is none
+func Comment(program *parser.Program, node parser.Node) string {
+	if program == nil || node == nil {
+		return ""
+	}
+	lines := leadingComment(program.Comments, node.Pos().Line, trailingLines(program))
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// trailingLines returns the lines on which a statement ends. A comment
+// sharing such a line trails that statement rather than leading the next.
+func trailingLines(program *parser.Program) map[int]bool {
+	lines := make(map[int]bool)
+	var visit func(statements []parser.Statement)
+	visit = func(statements []parser.Statement) {
+		for _, stmt := range statements {
+			lines[stmt.End().Line] = true
+			switch s := stmt.(type) {
+			case *parser.GateDefinition:
+				visit(s.Body)
+			case *parser.SubroutineDefinition:
+				visit(s.Body)
+			case *parser.IfStatement:
+				visit(s.ThenBody)
+				visit(s.ElseBody)
+			case *parser.ForStatement:
+				visit(s.Body)
+			case *parser.WhileStatement:
+				visit(s.Body)
+			}
+		}
+	}
+	visit(program.Statements)
+	return lines
+}
+
+func gateSymbol(g *parser.GateDefinition) Symbol {
+	sym := Symbol{Kind: KindGate, Name: g.Name, Position: g.Pos()}
+	for _, p := range g.Parameters {
+		sym.Params = append(sym.Params, Param{Name: p.Name})
+	}
+	for _, q := range g.Qubits {
+		sym.Qubits = append(sym.Qubits, Param{Name: q.Name, Type: "qubit"})
+	}
+
+	sig := "gate " + g.Name
+	if len(sym.Params) > 0 {
+		sig += "(" + joinParams(sym.Params, false) + ")"
+	}
+	sym.Signature = sig + " " + joinParams(sym.Qubits, false)
+	return sym
+}
+
+func subroutineSymbol(s *parser.SubroutineDefinition) Symbol {
+	sym := Symbol{Kind: KindSubroutine, Name: s.Name, Returns: s.ReturnType, Position: s.Pos()}
+	for _, p := range s.Parameters {
+		sym.Params = append(sym.Params, Param{Name: p.Name, Type: p.Type})
+	}
+
+	sym.Signature = "def " + s.Name + "(" + joinParams(sym.Params, true) + ")"
+	if s.ReturnType != "" {
+		sym.Signature += " -> " + s.ReturnType
+	}
+	return sym
+}
+
+func joinParams(params []Param, typed bool) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.Name
+		if typed && p.Type != "" {
+			parts[i] = p.Type + " " + p.Name
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// leadingComment returns the text of the comments ending on the lines
+// directly above line, with comment markers removed
+func leadingComment(comments []parser.Comment, line int, trailing map[int]bool) []string {
+	var block []parser.Comment
+	next := line
+	for i := len(comments) - 1; i >= 0; i-- {
+		c := comments[i]
+		if c.Position.Line >= next {
+			continue
+		}
+		if c.End().Line != next-1 || trailing[c.Position.Line] {
+			break
+		}
+		block = append(block, c)
+		next = c.Position.Line
+	}
+
+	var lines []string
+	for i := len(block) - 1; i >= 0; i-- {
+		lines = append(lines, commentLines(block[i])...)
+	}
+	return lines
+}
+
+// commentLines strips comment markers: //, /// and the /* */ frame with
+// the leading asterisks of each line
+func commentLines(c parser.Comment) []string {
+	if c.Type == "line" {
+		text := strings.TrimLeft(c.Text, "/")
+		return []string{strings.TrimSpace(text)}
+	}
+
+	text := strings.TrimPrefix(c.Text, "/*")
+	text = strings.TrimSuffix(text, "*/")
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimLeft(line, "*"))
+		lines = append(lines, line)
+	}
+	// Drop the blank lines left by the opening and closing markers
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// applyComment splits comment lines into the description and @param and
+// @return tags. A tag continues on following lines until a blank line or
+// the next tag.
+func applyComment(sym *Symbol, lines []string) {
+	var description []string
+	var current *string
+
+	for _, line := range lines {
+		if line == "" {
+			current = nil
+			description = append(description, "")
+			continue
+		}
+
+		tag, rest, _ := strings.Cut(line, " ")
+		switch tag {
+		case "@param":
+			name, text, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			current = sym.paramDoc(name)
+			if current != nil {
+				*current = strings.TrimSpace(text)
+			}
+			continue
+		case "@return", "@returns":
+			current = &sym.ReturnDoc
+			*current = strings.TrimSpace(rest)
+			continue
+		}
+
+		if current != nil {
+			*current += " " + line
+			continue
+		}
+		description = append(description, line)
+	}
+
+	sym.Doc = strings.TrimSpace(strings.Join(description, "\n"))
+}
+
+// paramDoc returns the doc field of the named parameter or qubit, or nil
+// if the symbol has no such argument
+func (s *Symbol) paramDoc(name string) *string {
+	for i := range s.Params {
+		if s.Params[i].Name == name {
+			return &s.Params[i].Doc
+		}
+	}
+	for i := range s.Qubits {
+		if s.Qubits[i].Name == name {
+			return &s.Qubits[i].Doc
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the document as indented JSON
+func (d *Document) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// WriteMarkdown writes the document as Markdown, with gates and
+// subroutines in separate sections
+func (d *Document) WriteMarkdown(w io.Writer) error {
+	var sb strings.Builder
+
+	title := d.File
+	if title == "" {
+		title = "QASM Reference"
+	}
+	fmt.Fprintf(&sb, "# %s\n", title)
+
+	d.writeSection(&sb, "Gates", KindGate)
+	d.writeSection(&sb, "Subroutines", KindSubroutine)
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (d *Document) writeSection(sb *strings.Builder, heading string, kind Kind) {
+	var symbols []Symbol
+	for _, sym := range d.Symbols {
+		if sym.Kind == kind {
+			symbols = append(symbols, sym)
+		}
+	}
+	if len(symbols) == 0 {
+		return
+	}
+
+	fmt.Fprintf(sb, "\n## %s\n", heading)
+	for _, sym := range symbols {
+		fmt.Fprintf(sb, "\n### %s\n\n```qasm\n%s\n```\n", sym.Name, sym.Signature)
+		if sym.Doc != "" {
+			fmt.Fprintf(sb, "\n%s\n", sym.Doc)
+		}
+
+		args := append(append([]Param{}, sym.Params...), sym.Qubits...)
+		if len(args) > 0 {
+			sb.WriteString("\n**Parameters**\n\n")
+			for _, p := range args {
+				fmt.Fprintf(sb, "- `%s`", p.Name)
+				if p.Type != "" {
+					fmt.Fprintf(sb, " (%s)", p.Type)
+				}
+				if p.Doc != "" {
+					sb.WriteString(": " + p.Doc)
+				}
+				sb.WriteString("\n")
+			}
+		}
+
+		if sym.Returns != "" || sym.ReturnDoc != "" {
+			sb.WriteString("\n**Returns**\n\n")
+			switch {
+			case sym.Returns != "" && sym.ReturnDoc != "":
+				fmt.Fprintf(sb, "`%s`: %s\n", sym.Returns, sym.ReturnDoc)
+			case sym.Returns != "":
+				fmt.Fprintf(sb, "`%s`\n", sym.Returns)
+			default:
+				fmt.Fprintf(sb, "%s\n", sym.ReturnDoc)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package doc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const source = `OPENQASM 3.0;
+qubit[2] q;
+h q[0]; // not documentation
+
+/// Rotation about the X and Z axes.
+///
+/// @param theta rotation angle
+/// @param phi phase angle,
+///   applied last
+/// @param a target qubit
+gate xz(theta, phi) a {
+  rx(theta) a;
+  rz(phi) a;
+}
+
+/*
+ * Measures a qubit after a Hadamard.
+ * @return the measured bit
+ */
+def coin(qubit q) -> bit {
+  h q;
+  return measure q;
+}
+
+// Not attached: separated by a blank line
+
+gate bare a { x a; }
+`
+
+func extract(t *testing.T) *Document {
+	t.Helper()
+	result := parser.NewParser().ParseWithErrors(source)
+	if result.HasErrors() {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	return Extract(result.Program)
+}
+
+func TestExtract(t *testing.T) {
+	doc := extract(t)
+	if len(doc.Symbols) != 3 {
+		t.Fatalf("Expected 3 symbols, got %d", len(doc.Symbols))
+	}
+
+	gate := doc.Symbols[0]
+	if gate.Kind != KindGate || gate.Signature != "gate xz(theta, phi) a" {
+		t.Errorf("Unexpected gate symbol: %+v", gate)
+	}
+	if gate.Doc != "Rotation about the X and Z axes." {
+		t.Errorf("Unexpected gate doc %q", gate.Doc)
+	}
+	if gate.Params[0].Doc != "rotation angle" || gate.Params[1].Doc != "phase angle, applied last" {
+		t.Errorf("Unexpected parameter docs: %+v", gate.Params)
+	}
+	if gate.Qubits[0].Doc != "target qubit" {
+		t.Errorf("Unexpected qubit docs: %+v", gate.Qubits)
+	}
+	if gate.Position.Line != 11 {
+		t.Errorf("Expected gate on line 11, got %d", gate.Position.Line)
+	}
+
+	def := doc.Symbols[1]
+	if def.Kind != KindSubroutine || def.Signature != "def coin(qubit q) -> bit" {
+		t.Errorf("Unexpected subroutine symbol: %+v", def)
+	}
+	if def.Doc != "Measures a qubit after a Hadamard." || def.ReturnDoc != "the measured bit" {
+		t.Errorf("Unexpected subroutine docs: %q, %q", def.Doc, def.ReturnDoc)
+	}
+
+	if bare := doc.Symbols[2]; bare.Doc != "" {
+		t.Errorf("Expected no doc for a gate after a blank line, got %q", bare.Doc)
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	doc := extract(t)
+	doc.File = "lib.qasm"
+
+	var buf bytes.Buffer
+	if err := doc.WriteMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# lib.qasm\n",
+		"## Gates\n",
+		"### xz\n\n```qasm\ngate xz(theta, phi) a\n```\n",
+		"- `theta`: rotation angle\n",
+		"- `a` (qubit): target qubit\n",
+		"## Subroutines\n",
+		"**Returns**\n\n`bit`: the measured bit\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Markdown missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "## Gates") > strings.Index(out, "## Subroutines") {
+		t.Error("Expected gates before subroutines")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := extract(t).WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Document
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(decoded.Symbols) != 3 || decoded.Symbols[1].Kind != KindSubroutine {
+		t.Errorf("Unexpected decoded document: %+v", decoded)
+	}
+}
@@ -0,0 +1,261 @@
+// Package editor generates client configuration for editors: a TextMate
+// grammar built from the lexer's token definitions, a VS Code language
+// configuration and the settings that launch the language server.
+package editor
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Target is an editor that configuration can be generated for
+type Target string
+
+const (
+	VSCode Target = "vscode"
+	Neovim Target = "nvim"
+)
+
+// ParseTarget converts a --generate flag value into a Target
+func ParseTarget(value string) (Target, error) {
+	switch target := Target(strings.ToLower(value)); target {
+	case VSCode, Neovim:
+		return target, nil
+	case "neovim":
+		return Neovim, nil
+	default:
+		return "", fmt.Errorf("invalid editor %q (want vscode or nvim)", value)
+	}
+}
+
+// Options configures the generated files
+type Options struct {
+	// Command starts the language server. Empty means qasmparser lsp.
+	Command []string
+}
+
+func (o *Options) command() []string {
+	if o == nil || len(o.Command) == 0 {
+		return []string{"qasmparser", "lsp"}
+	}
+	return o.Command
+}
+
+// Generate returns the files making up the configuration for target,
+// keyed by path relative to the extension or config directory
+func Generate(target Target, opts *Options) (map[string][]byte, error) {
+	switch target {
+	case VSCode:
+		grammar, err := TextMateGrammar()
+		if err != nil {
+			return nil, err
+		}
+		config, err := LanguageConfiguration()
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := vscodeManifest(opts.command())
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{
+			"package.json":                  manifest,
+			"language-configuration.json":   config,
+			"syntaxes/qasm.tmLanguage.json": grammar,
+		}, nil
+	case Neovim:
+		return map[string][]byte{"plugin/qasm.lua": neovimPlugin(opts.command())}, nil
+	}
+	return nil, fmt.Errorf("invalid editor %q (want vscode or nvim)", target)
+}
+
+// controlKeywords are the keywords highlighted as control flow
+var controlKeywords = map[string]bool{
+	"if": true, "else": true, "for": true, "while": true, "in": true,
+	"break": true, "continue": true, "return": true, "end": true,
+	"switch": true, "case": true, "default": true,
+}
+
+type pattern struct {
+	Name     string             `json:"name,omitempty"`
+	Match    string             `json:"match,omitempty"`
+	Begin    string             `json:"begin,omitempty"`
+	End      string             `json:"end,omitempty"`
+	Captures map[string]capture `json:"captures,omitempty"`
+}
+
+type capture struct {
+	Name string `json:"name"`
+}
+
+// TextMateGrammar returns a TextMate grammar for QASM. Keywords, types and
+// operators are taken from parser.Vocabulary, so the grammar follows the
+// lexer when it changes.
+func TextMateGrammar() ([]byte, error) {
+	var control, other, types, operators []string
+	for _, def := range parser.Vocabulary() {
+		if def.Literal == "" {
+			continue
+		}
+		switch def.Class {
+		case parser.TokenKeyword:
+			if controlKeywords[def.Literal] {
+				control = append(control, def.Literal)
+			} else {
+				other = append(other, def.Literal)
+			}
+		case parser.TokenType:
+			types = append(types, def.Literal)
+		case parser.TokenOperator:
+			operators = append(operators, def.Literal)
+		}
+	}
+
+	grammar := struct {
+		Schema    string    `json:"$schema"`
+		Name      string    `json:"name"`
+		ScopeName string    `json:"scopeName"`
+		FileTypes []string  `json:"fileTypes"`
+		Patterns  []pattern `json:"patterns"`
+	}{
+		Schema:    "https://raw.githubusercontent.com/martinring/tmlanguage/master/tmlanguage.json",
+		Name:      "OpenQASM",
+		ScopeName: "source.qasm",
+		FileTypes: []string{"qasm", "inc"},
+		Patterns: []pattern{
+			{Name: "comment.line.double-slash.qasm", Match: `//.*$`},
+			{Name: "comment.block.qasm", Begin: `/\*`, End: `\*/`},
+			{Name: "string.quoted.double.qasm", Match: `"[^"]*"`},
+			{Name: "string.quoted.single.qasm", Match: `'[^']*'`},
+			{
+				Match: `\b(gate|def)\s+([A-Za-z_][A-Za-z0-9_]*)`,
+				Captures: map[string]capture{
+					"1": {Name: "keyword.other.qasm"},
+					"2": {Name: "entity.name.function.qasm"},
+				},
+			},
+			{Name: "constant.numeric.qasm", Match: `\b(0[bB][01_]+|0[oO][0-7_]+|0[xX][0-9a-fA-F_]+|[0-9][0-9_]*(\.[0-9_]*)?([eE][+-]?[0-9]+)?)(im|dt|ns|us|ms|s)?\b`},
+			{Name: "constant.language.qasm", Match: `\b(true|false|pi|tau|euler)\b|[πτℇ]`},
+			{Name: "keyword.control.qasm", Match: wordPattern(control)},
+			{Name: "storage.type.qasm", Match: wordPattern(types)},
+			{Name: "keyword.other.qasm", Match: wordPattern(other)},
+			{Name: "keyword.operator.qasm", Match: operatorPattern(operators)},
+		},
+	}
+	return json.MarshalIndent(grammar, "", "  ")
+}
+
+// wordPattern matches any of words as a whole word
+func wordPattern(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	sort.Strings(quoted)
+	return `\b(` + strings.Join(quoted, "|") + `)\b`
+}
+
+// operatorPattern matches any of ops, preferring the longest
+func operatorPattern(ops []string) string {
+	sorted := append([]string(nil), ops...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	quoted := make([]string, len(sorted))
+	for i, op := range sorted {
+		quoted[i] = regexp.QuoteMeta(op)
+	}
+	return strings.Join(quoted, "|")
+}
+
+// LanguageConfiguration returns a VS Code language-configuration.json
+// describing comments and brackets
+func LanguageConfiguration() ([]byte, error) {
+	pairs := [][2]string{{"{", "}"}, {"[", "]"}, {"(", ")"}}
+	config := map[string]interface{}{
+		"comments": map[string]interface{}{
+			"lineComment":  "//",
+			"blockComment": []string{"/*", "*/"},
+		},
+		"brackets":         pairs,
+		"autoClosingPairs": append(append([][2]string{}, pairs...), [2]string{`"`, `"`}),
+		"surroundingPairs": append(append([][2]string{}, pairs...), [2]string{`"`, `"`}),
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// vscodeManifest returns the package.json of a VS Code extension that
+// contributes the language and its grammar and launches the server
+func vscodeManifest(command []string) ([]byte, error) {
+	manifest := map[string]interface{}{
+		"name":        "qasm",
+		"displayName": "OpenQASM",
+		"description": "OpenQASM 3 language support",
+		"version":     "0.0.1",
+		"engines":     map[string]string{"vscode": "^1.75.0"},
+		"main":        "./out/extension.js",
+		"activationEvents": []string{
+			"onLanguage:qasm",
+		},
+		"contributes": map[string]interface{}{
+			"languages": []interface{}{map[string]interface{}{
+				"id":            "qasm",
+				"aliases":       []string{"OpenQASM", "qasm"},
+				"extensions":    []string{".qasm"},
+				"configuration": "./language-configuration.json",
+			}},
+			"grammars": []interface{}{map[string]interface{}{
+				"language":  "qasm",
+				"scopeName": "source.qasm",
+				"path":      "./syntaxes/qasm.tmLanguage.json",
+			}},
+			"configuration": map[string]interface{}{
+				"title": "OpenQASM",
+				"properties": map[string]interface{}{
+					"qasm.server.command": map[string]interface{}{
+						"type":        "string",
+						"default":     command[0],
+						"description": "Language server executable",
+					},
+					"qasm.server.args": map[string]interface{}{
+						"type":        "array",
+						"default":     command[1:],
+						"description": "Arguments passed to the language server",
+					},
+				},
+			},
+		},
+	}
+	return json.MarshalIndent(manifest, "", "  ")
+}
+
+// neovimPlugin returns a Lua plugin that detects QASM files and starts
+// the language server for them
+func neovimPlugin(command []string) []byte {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = fmt.Sprintf("%q", arg)
+	}
+	return []byte(`vim.filetype.add({ extension = { qasm = "qasm" } })
+
+vim.api.nvim_create_autocmd("FileType", {
+  pattern = "qasm",
+  callback = function(args)
+    vim.bo[args.buf].commentstring = "// %s"
+    vim.lsp.start({
+      name = "qasmparser",
+      cmd = { ` + strings.Join(quoted, ", ") + ` },
+      root_dir = vim.fs.root(args.buf, { ".git" }),
+    })
+  end,
+})
+`)
+}
@@ -0,0 +1,86 @@
+package editor
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTextMateGrammar(t *testing.T) {
+	data, err := TextMateGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var grammar struct {
+		ScopeName string `json:"scopeName"`
+		Patterns  []struct {
+			Name  string `json:"name"`
+			Match string `json:"match"`
+		} `json:"patterns"`
+	}
+	if err := json.Unmarshal(data, &grammar); err != nil {
+		t.Fatal(err)
+	}
+	if grammar.ScopeName != "source.qasm" {
+		t.Errorf("scopeName = %q", grammar.ScopeName)
+	}
+
+	matches := map[string][]string{
+		"keyword.control.qasm":  {"if", "while", "return"},
+		"storage.type.qasm":     {"qubit", "float", "angle"},
+		"keyword.other.qasm":    {"gate", "measure", "ctrl"},
+		"keyword.operator.qasm": {"->", "**", "@"},
+	}
+	for _, p := range grammar.Patterns {
+		words, ok := matches[p.Name]
+		if !ok || p.Match == "" {
+			continue
+		}
+		re, err := regexp.Compile(p.Match)
+		if err != nil {
+			t.Fatalf("%s: %v", p.Name, err)
+		}
+		for _, w := range words {
+			if re.FindString(" "+w+" ") != w {
+				t.Errorf("%s does not match %q", p.Name, w)
+			}
+		}
+		delete(matches, p.Name)
+	}
+	if len(matches) > 0 {
+		t.Errorf("missing patterns: %v", matches)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	files, err := Generate(VSCode, &Options{Command: []string{"qls", "--stdio"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"package.json", "language-configuration.json", "syntaxes/qasm.tmLanguage.json"} {
+		if !json.Valid(files[name]) {
+			t.Errorf("%s is missing or not valid JSON", name)
+		}
+	}
+	if !strings.Contains(string(files["package.json"]), `"qls"`) {
+		t.Error("package.json does not use the configured command")
+	}
+
+	files, err = Generate(Neovim, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lua := string(files["plugin/qasm.lua"]); !strings.Contains(lua, `cmd = { "qasmparser", "lsp" }`) {
+		t.Errorf("unexpected plugin:\n%s", lua)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	if target, err := ParseTarget("neovim"); err != nil || target != Neovim {
+		t.Errorf("ParseTarget(neovim) = %q, %v", target, err)
+	}
+	if _, err := ParseTarget("emacs"); err == nil {
+		t.Error("expected an error for an unsupported editor")
+	}
+}
@@ -0,0 +1,96 @@
+// Package endian handles the two conventions for ordering the bits of a
+// register. Qiskit writes bit 0 of a register last in a bitstring and
+// takes it as the least significant bit of an outcome; textbooks write
+// it first and take it as the most significant. Results read in one
+// convention and compared in the other do not match, without any error,
+// so tools that exchange bitstrings state the Order they use.
+package endian
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Order is a bit order convention. The zero Order is LittleEndian, the
+// convention of Qiskit and of this module.
+type Order string
+
+const (
+	// LittleEndian writes bit 0 last: c[0] = 1 and c[1] = 0 read "01"
+	LittleEndian Order = "little"
+
+	// BigEndian writes bit 0 first: c[0] = 1 and c[1] = 0 read "10"
+	BigEndian Order = "big"
+)
+
+// ParseOrder reads an order by name: "little" or "big", or the empty
+// string for LittleEndian
+func ParseOrder(name string) (Order, error) {
+	switch o := Order(strings.ToLower(name)); o {
+	case "", LittleEndian:
+		return LittleEndian, nil
+	case BigEndian:
+		return BigEndian, nil
+	}
+	return "", fmt.Errorf("unknown bit order %q (want little or big)", name)
+}
+
+func (o Order) big() bool {
+	return o == BigEndian
+}
+
+// Bitstring writes the low n bits of value, bit i of value being bit i of
+// the register, as a string of 0s and 1s in order o
+func (o Order) Bitstring(value uint64, n int) string {
+	b := make([]byte, n)
+	for i := range n {
+		bit := byte('0' + value>>i&1)
+		if o.big() {
+			b[i] = bit
+		} else {
+			b[n-1-i] = bit
+		}
+	}
+	return string(b)
+}
+
+// Value reads a bitstring written in order o, the inverse of Bitstring.
+// Bitstrings longer than 64 bits do not fit and are an error.
+func (o Order) Value(bitstring string) (uint64, error) {
+	if len(bitstring) > 64 {
+		return 0, fmt.Errorf("bitstring of %d bits does not fit in 64", len(bitstring))
+	}
+	if !o.big() {
+		return strconv.ParseUint("0"+bitstring, 2, 64)
+	}
+	return strconv.ParseUint("0"+reverse(bitstring), 2, 64)
+}
+
+// Convert rewrites a bitstring written in order from into order to
+func Convert(bitstring string, from, to Order) string {
+	if from.big() == to.big() {
+		return bitstring
+	}
+	return reverse(bitstring)
+}
+
+// ConvertCounts rewrites the keys of a histogram of outcomes from order
+// from into order to. Keys may contain spaces separating registers, as
+// Qiskit writes them; converting also reverses the order of the
+// registers, so each register keeps its bits together.
+func ConvertCounts(counts map[string]int, from, to Order) map[string]int {
+	converted := make(map[string]int, len(counts))
+	for key, n := range counts {
+		converted[Convert(key, from, to)] += n
+	}
+	return converted
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
@@ -0,0 +1,158 @@
+package endian
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+func TestBitstring(t *testing.T) {
+	// c[0] = 1, c[1] = 1, c[2] = 0, c[3] = 0
+	const value = 0b0011
+	if got := LittleEndian.Bitstring(value, 4); got != "0011" {
+		t.Errorf("little = %s", got)
+	}
+	if got := BigEndian.Bitstring(value, 4); got != "1100" {
+		t.Errorf("big = %s", got)
+	}
+	for _, o := range []Order{LittleEndian, BigEndian, ""} {
+		v, err := o.Value(o.Bitstring(value, 4))
+		if err != nil || v != value {
+			t.Errorf("%q: Value() = %d, %v", o, v, err)
+		}
+	}
+	if _, err := LittleEndian.Value("012"); err == nil {
+		t.Error("Value() accepted a 2")
+	}
+	if got := Convert("0011", LittleEndian, BigEndian); got != "1100" {
+		t.Errorf("Convert() = %s", got)
+	}
+	if got := Convert("0011", "", LittleEndian); got != "0011" {
+		t.Errorf("Convert() within an order = %s", got)
+	}
+	got := ConvertCounts(map[string]int{"01 001": 3, "10 000": 1}, BigEndian, LittleEndian)
+	if want := map[string]int{"100 10": 3, "000 01": 1}; !maps.Equal(got, want) {
+		t.Errorf("ConvertCounts() = %v", got)
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	for name, want := range map[string]Order{"": LittleEndian, "little": LittleEndian, "Big": BigEndian} {
+		if got, err := ParseOrder(name); err != nil || got != want {
+			t.Errorf("ParseOrder(%q) = %q, %v", name, got, err)
+		}
+	}
+	if _, err := ParseOrder("network"); err == nil {
+		t.Error("ParseOrder() accepted network")
+	}
+}
+
+func TestReverse(t *testing.T) {
+	src := `OPENQASM 3.0;
+qubit[4] q;
+bit[4] c;
+int i;
+x q[0];
+cx q[-1], q[i];
+h q[1:2];
+h q[:1];
+measure q[i + 1] -> c[0];
+def f(qubit[2] q) { x q[0]; }
+`
+	want := `OPENQASM 3.0;
+qubit[4] q;
+bit[4] c;
+int i;
+x q[3];
+cx q[0], q[3 - i];
+h q[1:2];
+h q[2:3];
+measure q[3 - (i + 1)] -> c[3];
+def f(qubit[2] q) {
+  x q[0];
+}
+`
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Reverse(program); err != nil {
+		t.Fatal(err)
+	}
+	if got := printer.Print(program); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	program, err = parser.NewParser().ParseString("OPENQASM 3.0;\nconst int n = 2;\nqubit[n] q;\nx q[0];\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Reverse(program); err == nil || err.Error() != "3:1: register q has no literal size" {
+		t.Errorf("Reverse() = %v", err)
+	}
+	if got := printer.Print(program); got != "OPENQASM 3.0;\nconst int n = 2;\nqubit[n] q;\nx q[0];\n" {
+		t.Errorf("failed Reverse() changed the program:\n%s", got)
+	}
+}
+
+func TestReverseClassical(t *testing.T) {
+	src := `OPENQASM 3.0;
+qubit[4] q;
+bit[4] c;
+bit[4] d = "0011";
+c = measure q;
+if (c == 1) {
+  x q[0];
+}
+c = 4;
+while (c != 0) {
+  c = d;
+}
+`
+	want := `OPENQASM 3.0;
+qubit[4] q;
+bit[4] c;
+bit[4] d = "1100";
+measure q -> c;
+if (c == 8) {
+  x q[3];
+}
+c = 2;
+while (c != 0) {
+  c = d;
+}
+`
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Reverse(program); err != nil {
+		t.Fatal(err)
+	}
+	if got := printer.Print(program); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, tt := range []struct{ src, want string }{
+		{"if (c < 3) { x q[0]; }", "4:5: register c is used as an integer, whose bits cannot be reversed here"},
+		{"c += 1;", "4:1: register c is used as an integer, whose bits cannot be reversed here"},
+		{"int i = c + 1;", "4:9: register c is used as an integer, whose bits cannot be reversed here"},
+		{"int i;\nif (c == i) { x q[0]; }", "5:10: cannot reverse the bits of i"},
+		{"c = 16;", "4:5: cannot reverse the bits of 16"},
+	} {
+		src := "OPENQASM 3.0;\nqubit[4] q;\nbit[4] c;\n" + tt.src + "\n"
+		program, err := parser.NewParser().ParseString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := printer.Print(program)
+		if err := Reverse(program); err == nil || err.Error() != tt.want {
+			t.Errorf("Reverse(%q) = %v, want %s", tt.src, err, tt.want)
+		}
+		if got := printer.Print(program); got != before {
+			t.Errorf("failed Reverse() changed the program:\n%s", got)
+		}
+	}
+}
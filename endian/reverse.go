@@ -0,0 +1,347 @@
+package endian
+
+import (
+	"fmt"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// Reverse rewrites program in place so that it numbers the qubits and
+// bits of every register the other way round: q[i] becomes q[n-1-i] for a
+// register of n elements. Outcomes of the reversed program read in one
+// order are the outcomes of the original read in the other, which ports
+// a program between conventions without changing how its results are
+// read. Indices that are not literals become expressions, as in
+// q[3 - i], and ranges keep selecting the same elements.
+//
+// A bit register read or written whole as an integer, as in c == 1 or
+// c = 4, has its bits reversed too: integer and bitstring literals it is
+// compared with or assigned are rewritten, so c == 1 becomes c == 8 for a
+// register of four bits. Any other integer use, such as c < 3 or c + 1,
+// cannot be carried over.
+//
+// Every register must have a literal size; Reverse returns an error
+// naming the first one that does not, or the first integer use it cannot
+// rewrite, leaving program unchanged. Subroutine parameters are left
+// alone, since the registers passed to them are reversed where they are
+// indexed by the caller.
+func Reverse(program *parser.Program) error {
+	r := &reverser{sizes: make(map[string]int64), bits: make(map[string]bool)}
+	for _, stmt := range program.Statements {
+		var name string
+		var size parser.Expression
+		switch s := stmt.(type) {
+		case *parser.QuantumDeclaration:
+			name, size = s.Identifier, s.Size
+		case *parser.ClassicalDeclaration:
+			if s.Type != "bit" && s.Type != "creg" {
+				continue
+			}
+			name, size = s.Identifier, s.Size
+			r.bits[name] = size != nil
+		default:
+			continue
+		}
+		if size == nil {
+			continue
+		}
+		lit, ok := size.(*parser.IntegerLiteral)
+		if !ok {
+			return fmt.Errorf("%d:%d: register %s has no literal size", stmt.Pos().Line, stmt.Pos().Column, name)
+		}
+		r.sizes[name] = lit.Value
+	}
+
+	// Integer uses are checked before anything is rewritten, so a
+	// failure leaves the program as it was
+	for _, stmt := range program.Statements {
+		r.enter(stmt)
+		if err := r.statement(stmt); err != nil {
+			return err
+		}
+	}
+	for _, l := range r.literals {
+		l.rewrite()
+	}
+
+	v := parser.NewDepthFirstVisitor(r)
+	for _, stmt := range program.Statements {
+		r.enter(stmt)
+		parser.Walk(v, stmt)
+	}
+	return nil
+}
+
+type reverser struct {
+	parser.BaseVisitor
+
+	// sizes maps each register to its size and bits tells which of them
+	// are bit registers; shadowed holds the parameters of the subroutine
+	// being walked
+	sizes    map[string]int64
+	bits     map[string]bool
+	shadowed map[string]bool
+
+	// literals are the values compared with or assigned to whole bit
+	// registers
+	literals []literal
+}
+
+// literal is an integer or bitstring literal standing for the bits of a
+// register of n bits
+type literal struct {
+	expr parser.Expression
+	n    int64
+}
+
+// rewrite reverses the bits of the literal
+func (l literal) rewrite() {
+	switch e := l.expr.(type) {
+	case *parser.IntegerLiteral:
+		var v int64
+		for i := int64(0); i < l.n; i++ {
+			if e.Value&(1<<i) != 0 {
+				v |= 1 << (l.n - 1 - i)
+			}
+		}
+		e.Value, e.Raw = v, ""
+	case *parser.StringLiteral:
+		b := []byte(e.Value)
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		e.Value = string(b)
+	}
+}
+
+// enter sets the parameters shadowing registers within a top-level
+// statement
+func (r *reverser) enter(stmt parser.Statement) {
+	r.shadowed = nil
+	if def, ok := stmt.(*parser.SubroutineDefinition); ok {
+		r.shadowed = make(map[string]bool)
+		for _, p := range def.Parameters {
+			r.shadowed[p.Name] = true
+		}
+	}
+}
+
+// register returns the size of the bit register expr names whole
+func (r *reverser) register(expr parser.Expression) (int64, bool) {
+	id, ok := expr.(*parser.Identifier)
+	if !ok || !r.bits[id.Name] {
+		return 0, false
+	}
+	return r.size(id.Name)
+}
+
+// statements checks the integer uses of bit registers in a block
+func (r *reverser) statements(statements []parser.Statement) error {
+	for _, stmt := range statements {
+		if err := r.statement(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *reverser) statement(stmt parser.Statement) error {
+	switch s := stmt.(type) {
+	case *parser.ClassicalDeclaration:
+		if n, ok := r.size(s.Identifier); ok && r.bits[s.Identifier] && s.Initializer != nil {
+			return r.assign(s.Initializer, n)
+		}
+		return r.values(s.Size, s.Initializer)
+	case *parser.Assignment:
+		if n, ok := r.register(s.Target); ok {
+			if s.Operator != "=" {
+				return unsupported(s.Target, s.Target.(*parser.Identifier).Name)
+			}
+			return r.assign(s.Value, n)
+		}
+		return r.values(s.Target, s.Value)
+	case *parser.Measurement:
+		if _, ok := r.register(s.Target); ok {
+			return r.values(s.Qubit)
+		}
+		return r.values(s.Qubit, s.Target)
+	case *parser.GateCall:
+		for _, mod := range s.Modifiers {
+			if err := r.values(mod.Parameters...); err != nil {
+				return err
+			}
+		}
+		if err := r.values(s.Parameters...); err != nil {
+			return err
+		}
+		return r.values(s.Qubits...)
+	case *parser.Reset:
+		return r.values(s.Qubit)
+	case *parser.Barrier:
+		return r.values(s.Qubits...)
+	case *parser.IfStatement:
+		if err := r.values(s.Condition); err != nil {
+			return err
+		}
+		if err := r.statements(s.ThenBody); err != nil {
+			return err
+		}
+		return r.statements(s.ElseBody)
+	case *parser.ForStatement:
+		if err := r.values(s.Iterable); err != nil {
+			return err
+		}
+		return r.statements(s.Body)
+	case *parser.WhileStatement:
+		if err := r.values(s.Condition); err != nil {
+			return err
+		}
+		return r.statements(s.Body)
+	case *parser.SubroutineDefinition:
+		return r.statements(s.Body)
+	}
+	return nil
+}
+
+// assign checks a value assigned to a whole register of n bits
+func (r *reverser) assign(value parser.Expression, n int64) error {
+	if m, ok := r.register(value); ok && m == n {
+		return nil
+	}
+	if _, ok := value.(*parser.MeasureExpression); ok {
+		return r.values(value)
+	}
+	return r.constant(value, n)
+}
+
+// constant records a literal standing for the bits of a register of n
+// bits, failing for any other expression
+func (r *reverser) constant(expr parser.Expression, n int64) error {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral:
+		if e.Value >= 0 && (n >= 63 || e.Value < 1<<n) {
+			r.literals = append(r.literals, literal{expr: e, n: n})
+			return nil
+		}
+	case *parser.StringLiteral:
+		if int64(len(e.Value)) == n {
+			r.literals = append(r.literals, literal{expr: e, n: n})
+			return nil
+		}
+	}
+	pos := expr.Pos()
+	return fmt.Errorf("%d:%d: cannot reverse the bits of %s", pos.Line, pos.Column, printer.Expression(expr))
+}
+
+// values checks expressions in which a whole bit register may only be
+// compared for equality
+func (r *reverser) values(exprs ...parser.Expression) error {
+	for _, expr := range exprs {
+		if err := r.value(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *reverser) value(expr parser.Expression) error {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		if _, ok := r.register(e); ok {
+			return unsupported(e, e.Name)
+		}
+	case *parser.BinaryExpression:
+		if e.Operator == "==" || e.Operator == "!=" {
+			left, lok := r.register(e.Left)
+			right, rok := r.register(e.Right)
+			switch {
+			case lok && rok && left == right:
+				return nil
+			case lok && !rok:
+				return r.constant(e.Right, left)
+			case rok && !lok:
+				return r.constant(e.Left, right)
+			}
+		}
+		return r.values(e.Left, e.Right)
+	case *parser.UnaryExpression:
+		return r.value(e.Operand)
+	case *parser.ParenthesizedExpression:
+		return r.value(e.Expression)
+	case *parser.FunctionCall:
+		return r.values(e.Arguments...)
+	case *parser.IndexedIdentifier:
+		return r.values(e.Index)
+	case *parser.RangedIdentifier:
+		return r.values(e.Start, e.EndIndex)
+	case *parser.RangeExpression:
+		return r.values(e.Start, e.Step, e.Stop)
+	case *parser.ArrayLiteral:
+		return r.values(e.Elements...)
+	}
+	return nil
+}
+
+// unsupported is the error for an integer use of register name that
+// Reverse cannot rewrite
+func unsupported(node parser.Node, name string) error {
+	pos := node.Pos()
+	return fmt.Errorf("%d:%d: register %s is used as an integer, whose bits cannot be reversed here", pos.Line, pos.Column, name)
+}
+
+func (r *reverser) size(name string) (int64, bool) {
+	n, ok := r.sizes[name]
+	return n, ok && !r.shadowed[name]
+}
+
+func (r *reverser) VisitIndexedIdentifier(node *parser.IndexedIdentifier) interface{} {
+	if n, ok := r.size(node.Name); ok && node.Index != nil {
+		node.Index = mirror(node.Index, n)
+	}
+	return nil
+}
+
+func (r *reverser) VisitRangedIdentifier(node *parser.RangedIdentifier) interface{} {
+	n, ok := r.size(node.Name)
+	if !ok {
+		return nil
+	}
+	start, end := node.Start, node.EndIndex
+	if start == nil {
+		start = &parser.IntegerLiteral{Value: 0}
+	}
+	if end == nil {
+		end = &parser.IntegerLiteral{Value: n - 1}
+	}
+	node.Start, node.EndIndex = mirror(end, n), mirror(start, n)
+	return nil
+}
+
+// mirror returns the index n-1-index
+func mirror(index parser.Expression, n int64) parser.Expression {
+	if v, ok := integer(index); ok {
+		if v < 0 {
+			v += n
+		}
+		return &parser.IntegerLiteral{Value: n - 1 - v}
+	}
+	operand := index
+	if _, ok := index.(*parser.BinaryExpression); ok {
+		operand = &parser.ParenthesizedExpression{Expression: index}
+	}
+	return &parser.BinaryExpression{Left: &parser.IntegerLiteral{Value: n - 1}, Operator: "-", Right: operand}
+}
+
+// integer returns the value of an integer literal, negated or not
+func integer(expr parser.Expression) (int64, bool) {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral:
+		return e.Value, true
+	case *parser.UnaryExpression:
+		if lit, ok := e.Operand.(*parser.IntegerLiteral); ok && e.Operator == "-" {
+			return -lit.Value, true
+		}
+	}
+	return 0, false
+}
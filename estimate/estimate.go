@@ -0,0 +1,390 @@
+// Package estimate approximates how a circuit will fare on a target
+// described by a gate library and a coupling map.
+//
+// Fidelity multiplies the fidelities of every operation the circuit
+// applies into an estimated success probability, and ranks the
+// operations by how much they lower it, which points at the gates worth
+// optimizing away first.
+package estimate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/stdlib"
+)
+
+// CouplingMap lists the pairs of physical qubits two-qubit gates can act
+// on. Pairs are undirected. It is stored as a JSON array of pairs:
+//
+//	[[0, 1], [1, 2], [2, 3]]
+type CouplingMap [][2]int
+
+// LoadCouplingMap reads a coupling map file
+func LoadCouplingMap(path string) (CouplingMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m CouplingMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Connected reports whether a two-qubit gate can act on a and b
+func (m CouplingMap) Connected(a, b int) bool {
+	for _, pair := range m {
+		if (pair[0] == a && pair[1] == b) || (pair[0] == b && pair[1] == a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cost is the share of the error one kind of operation contributes: a
+// gate applied Count times to the same qubits
+type Cost struct {
+	Gate     string  `json:"gate"`
+	Qubits   []int   `json:"qubits,omitempty"`
+	Count    int     `json:"count"`
+	Fidelity float64 `json:"fidelity"`
+
+	// Position is where the gate is first applied
+	Position parser.Position `json:"position"`
+}
+
+// Infidelity returns the probability that at least one of the Count
+// applications fails
+func (c Cost) Infidelity() float64 {
+	return 1 - math.Pow(c.Fidelity, float64(c.Count))
+}
+
+// Report is the result of Fidelity
+type Report struct {
+	// SuccessProbability is the product of the fidelities of all
+	// operations
+	SuccessProbability float64 `json:"success_probability"`
+
+	// Operations counts the operations applied, loops unrolled
+	Operations int `json:"operations"`
+
+	// Costs are the operations with a known fidelity below 1, most
+	// costly first
+	Costs []Cost `json:"costs"`
+
+	// Unknown lists gates that neither the library nor the program
+	// defines; they are taken to be perfect
+	Unknown []string `json:"unknown,omitempty"`
+
+	// Uncoupled lists two-qubit operations on qubits the coupling map
+	// does not connect, which need routing before they can run
+	Uncoupled []Cost `json:"uncoupled,omitempty"`
+}
+
+// Top returns the n most costly operations
+func (r *Report) Top(n int) []Cost {
+	return r.Costs[:min(n, len(r.Costs))]
+}
+
+// Fidelity estimates the success probability of program on the target
+// lib and coupling describe. Gates the library lacks are expanded from
+// their definition in the program. Loops over constant ranges are
+// unrolled; other loops and both branches of conditionals are
+// counted once. Virtual qubits are laid out on physical qubits in
+// declaration order, and hardware qubits such as $3 are used as they
+// are; to place a program by a layout file, rewrite it with
+// layout.Apply first. Modifiers are ignored, so ctrl @ x costs what x does. A nil
+// coupling map skips the connectivity check.
+func Fidelity(program *parser.Program, lib *stdlib.Library, coupling CouplingMap) *Report {
+	consts, _ := analysis.EvaluateConstants(program)
+	e := &estimator{
+		lib:       lib,
+		consts:    consts,
+		coupling:  coupling,
+		gates:     make(map[string]*parser.GateDefinition),
+		registers: make(map[string]register),
+		costs:     make(map[string]*Cost),
+		unknown:   make(map[string]bool),
+		report:    &Report{SuccessProbability: 1},
+	}
+	for _, stmt := range program.Statements {
+		if def, ok := stmt.(*parser.GateDefinition); ok {
+			e.gates[def.Name] = def
+		}
+	}
+	e.statements(program.Statements, 1)
+
+	for _, c := range e.costs {
+		e.report.Costs = append(e.report.Costs, *c)
+	}
+	sort.Slice(e.report.Costs, func(i, j int) bool {
+		a, b := e.report.Costs[i], e.report.Costs[j]
+		if a.Infidelity() != b.Infidelity() {
+			return a.Infidelity() > b.Infidelity()
+		}
+		return costKey(a.Gate, a.Qubits) < costKey(b.Gate, b.Qubits)
+	})
+	for name := range e.unknown {
+		e.report.Unknown = append(e.report.Unknown, name)
+	}
+	sort.Strings(e.report.Unknown)
+	return e.report
+}
+
+// register is a quantum register laid out on physical qubits
+type register struct {
+	first, size int
+}
+
+type estimator struct {
+	lib      *stdlib.Library
+	coupling CouplingMap
+	gates    map[string]*parser.GateDefinition
+	consts   analysis.Constants
+
+	registers map[string]register
+	next      int
+
+	costs     map[string]*Cost
+	unknown   map[string]bool
+	uncoupled map[string]int
+	report    *Report
+}
+
+// statements estimates statements executed times times
+func (e *estimator) statements(statements []parser.Statement, times int) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.QuantumDeclaration:
+			size := 1
+			if n, ok := e.consts.Int(s.Size); ok && n > 0 {
+				size = int(n)
+			}
+			e.registers[s.Identifier] = register{first: e.next, size: size}
+			e.next += size
+		case *parser.GateCall:
+			e.gate(s.Name, e.operands(s.Qubits), s.Pos(), times, nil)
+		case *parser.Measurement:
+			e.operation("measure", e.operands([]parser.Expression{s.Qubit}), s.Pos(), times)
+		case *parser.ClassicalDeclaration:
+			if m, ok := s.Initializer.(*parser.MeasureExpression); ok {
+				e.operation("measure", e.operands([]parser.Expression{m.Qubit}), s.Pos(), times)
+			}
+		case *parser.IfStatement:
+			e.statements(s.ThenBody, times)
+			e.statements(s.ElseBody, times)
+		case *parser.ForStatement:
+			e.statements(s.Body, times*e.iterations(s.Iterable))
+		case *parser.WhileStatement:
+			e.statements(s.Body, times)
+		}
+	}
+}
+
+// gate estimates a call of the named gate on qubits, each operand being
+// the physical qubits it stands for. Gates the library lacks are
+// expanded from their definition; expanding tracks the definitions
+// being expanded to stop at recursion.
+func (e *estimator) gate(name string, qubits [][]int, pos parser.Position, times int, expanding map[string]bool) {
+	if _, ok := e.lib.Gate(name); ok {
+		e.operation(name, qubits, pos, times)
+		return
+	}
+	def, ok := e.gates[name]
+	if !ok || expanding[name] || len(def.Qubits) != len(qubits) {
+		e.operation(name, qubits, pos, times)
+		return
+	}
+
+	if expanding == nil {
+		expanding = make(map[string]bool)
+	}
+	expanding[name] = true
+	defer delete(expanding, name)
+
+	args := make(map[string][]int, len(def.Qubits))
+	for i, q := range def.Qubits {
+		args[q.Name] = qubits[i]
+	}
+	for _, stmt := range def.Body {
+		call, ok := stmt.(*parser.GateCall)
+		if !ok {
+			continue
+		}
+		operands := make([][]int, len(call.Qubits))
+		for i, op := range call.Qubits {
+			if id, ok := op.(*parser.Identifier); ok {
+				operands[i] = args[id.Name]
+			}
+		}
+		// Positions point at the call in the program, not the body
+		e.gate(call.Name, operands, pos, times, expanding)
+	}
+}
+
+// operation records a primitive operation applied to qubits times times
+func (e *estimator) operation(name string, qubits [][]int, pos parser.Position, times int) {
+	if times <= 0 {
+		return
+	}
+	// An operand standing for a whole register applies the operation to
+	// each of its qubits in turn
+	for _, qs := range broadcast(qubits) {
+		e.report.Operations += times
+		e.checkCoupling(name, qs, pos, times)
+
+		g, ok := e.lib.Gate(name)
+		if !ok {
+			e.unknown[name] = true
+			continue
+		}
+		if g.Fidelity == 0 || g.Fidelity == 1 {
+			continue
+		}
+		e.report.SuccessProbability *= math.Pow(g.Fidelity, float64(times))
+
+		key := costKey(name, qs)
+		c, ok := e.costs[key]
+		if !ok {
+			c = &Cost{Gate: name, Qubits: qs, Fidelity: g.Fidelity, Position: pos}
+			e.costs[key] = c
+		}
+		c.Count += times
+	}
+}
+
+// checkCoupling records a two-qubit operation on unconnected qubits
+func (e *estimator) checkCoupling(name string, qubits []int, pos parser.Position, times int) {
+	if e.coupling == nil || len(qubits) != 2 || qubits[0] < 0 || qubits[1] < 0 {
+		return
+	}
+	if e.coupling.Connected(qubits[0], qubits[1]) {
+		return
+	}
+	key := costKey(name, qubits)
+	if e.uncoupled == nil {
+		e.uncoupled = make(map[string]int)
+	}
+	i, ok := e.uncoupled[key]
+	if !ok {
+		i = len(e.report.Uncoupled)
+		e.uncoupled[key] = i
+		e.report.Uncoupled = append(e.report.Uncoupled, Cost{Gate: name, Qubits: qubits, Position: pos})
+	}
+	e.report.Uncoupled[i].Count += times
+}
+
+// operands resolves gate operands to the physical qubits they stand for.
+// An operand that cannot be resolved, such as q[i], stands for a single
+// unknown qubit, -1.
+func (e *estimator) operands(exprs []parser.Expression) [][]int {
+	qubits := make([][]int, len(exprs))
+	for i, expr := range exprs {
+		qubits[i] = e.resolve(expr)
+	}
+	return qubits
+}
+
+func (e *estimator) resolve(expr parser.Expression) []int {
+	switch op := expr.(type) {
+	case *parser.Identifier:
+		if n, ok := strings.CutPrefix(op.Name, "$"); ok {
+			if i, err := strconv.Atoi(n); err == nil {
+				return []int{i}
+			}
+		}
+		if r, ok := e.registers[op.Name]; ok {
+			qubits := make([]int, r.size)
+			for i := range qubits {
+				qubits[i] = r.first + i
+			}
+			return qubits
+		}
+	case *parser.IndexedIdentifier:
+		r, ok := e.registers[op.Name]
+		if i, isConst := e.consts.Int(op.Index); ok && isConst && i >= 0 && int(i) < r.size {
+			return []int{r.first + int(i)}
+		}
+	}
+	return []int{-1}
+}
+
+// broadcast expands operands standing for registers into one operation
+// per qubit index, as q applied to a register means q on each qubit
+func broadcast(operands [][]int) [][]int {
+	n := 1
+	for _, qs := range operands {
+		n = max(n, len(qs))
+	}
+	ops := make([][]int, n)
+	for i := range ops {
+		ops[i] = make([]int, len(operands))
+		for j, qs := range operands {
+			if len(qs) == 0 {
+				ops[i][j] = -1
+			} else {
+				ops[i][j] = qs[min(i, len(qs)-1)]
+			}
+		}
+	}
+	return ops
+}
+
+// iterations returns how many times a loop over iterable runs, or 1 if
+// it is not a range with constant bounds
+func (e *estimator) iterations(iterable parser.Expression) int {
+	if n, ok := e.consts.Trips(iterable); ok {
+		return n
+	}
+	return 1
+}
+
+func costKey(gate string, qubits []int) string {
+	return fmt.Sprint(gate, qubits)
+}
+
+// WriteText writes the estimate and its top most costly operations
+func (r *Report) WriteText(w io.Writer, top int) error {
+	fmt.Fprintf(w, "estimated success probability: %.4f (%d operations)\n", r.SuccessProbability, r.Operations)
+	if costs := r.Top(top); len(costs) > 0 {
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "GATE\tQUBITS\tCOUNT\tFIDELITY\tINFIDELITY\tLOCATION")
+		for _, c := range costs {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%.4f\t%.4f\t%d:%d\n", c.Gate, qubitList(c.Qubits), c.Count, c.Fidelity, c.Infidelity(), c.Position.Line, c.Position.Column)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(r.Unknown) > 0 {
+		fmt.Fprintf(w, "\nno fidelity for: %s\n", strings.Join(r.Unknown, ", "))
+	}
+	for _, c := range r.Uncoupled {
+		fmt.Fprintf(w, "%d:%d: %s on uncoupled qubits %s needs routing\n", c.Position.Line, c.Position.Column, c.Gate, qubitList(c.Qubits))
+	}
+	return nil
+}
+
+func qubitList(qubits []int) string {
+	parts := make([]string, len(qubits))
+	for i, q := range qubits {
+		if q < 0 {
+			parts[i] = "?"
+		} else {
+			parts[i] = "$" + strconv.Itoa(q)
+		}
+	}
+	return strings.Join(parts, ",")
+}
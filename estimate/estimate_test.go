@@ -0,0 +1,139 @@
+package estimate
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/stdlib"
+)
+
+var library = &stdlib.Library{Gates: []stdlib.Gate{
+	{Name: "h", Arity: 1, Fidelity: 0.999},
+	{Name: "cx", Arity: 2, Fidelity: 0.99},
+	{Name: "measure", Arity: 1, Fidelity: 0.98},
+}}
+
+func estimate(t *testing.T, src string, coupling CouplingMap) *Report {
+	t.Helper()
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Fidelity(program, library, coupling)
+}
+
+func TestFidelity(t *testing.T) {
+	r := estimate(t, `OPENQASM 3.0;
+qubit[2] q;
+bit[2] c;
+h q[0];
+cx q[0], q[1];
+c = measure q;
+`, CouplingMap{{0, 1}})
+
+	want := 0.999 * 0.99 * 0.98 * 0.98
+	if math.Abs(r.SuccessProbability-want) > 1e-12 {
+		t.Errorf("SuccessProbability = %v, want %v", r.SuccessProbability, want)
+	}
+	if r.Operations != 4 {
+		t.Errorf("Operations = %d, want 4", r.Operations)
+	}
+	if len(r.Costs) != 4 || r.Costs[0].Gate != "measure" || r.Costs[2].Gate != "cx" || r.Costs[3].Gate != "h" {
+		t.Errorf("Costs = %+v", r.Costs)
+	}
+	if len(r.Unknown) != 0 || len(r.Uncoupled) != 0 {
+		t.Errorf("Unknown = %v, Uncoupled = %v", r.Unknown, r.Uncoupled)
+	}
+}
+
+func TestFidelityLoops(t *testing.T) {
+	r := estimate(t, `OPENQASM 3.0;
+qubit[2] q;
+for uint i in [0:2] {
+    cx q[0], q[1];
+}
+for uint i in [4:-1:3] {
+    h q[1];
+}
+`, nil)
+	if len(r.Costs) != 2 || r.Costs[0].Gate != "cx" || r.Costs[0].Count != 3 || r.Costs[1].Count != 2 {
+		t.Errorf("Costs = %+v", r.Costs)
+	}
+}
+
+func TestFidelityConstants(t *testing.T) {
+	r := estimate(t, `OPENQASM 3.0;
+const int n = 2;
+qubit[n] q;
+for uint i in [1:n] {
+    cx q[0], q[n - 1];
+}
+`, CouplingMap{{0, 1}})
+	if len(r.Costs) != 1 || r.Costs[0].Count != 2 || r.Costs[0].Qubits[1] != 1 || len(r.Unknown) != 0 {
+		t.Errorf("Costs = %+v, Unknown = %v", r.Costs, r.Unknown)
+	}
+}
+
+func TestFidelityExpandsDefinitions(t *testing.T) {
+	r := estimate(t, `OPENQASM 3.0;
+gate bell a, b { h a; cx a, b; }
+gate loop a { loop a; }
+qubit[2] q;
+bell q[1], q[0];
+loop q[0];
+rz(0.5) q[1];
+`, nil)
+	if len(r.Costs) != 2 || r.Costs[0].Gate != "cx" || r.Costs[0].Qubits[0] != 1 || r.Costs[0].Qubits[1] != 0 {
+		t.Errorf("Costs = %+v", r.Costs)
+	}
+	if strings.Join(r.Unknown, ",") != "loop,rz" {
+		t.Errorf("Unknown = %v, want [loop rz]", r.Unknown)
+	}
+}
+
+func TestFidelityUncoupled(t *testing.T) {
+	r := estimate(t, `OPENQASM 3.0;
+qubit[3] q;
+cx q[0], q[1];
+cx q[0], q[2];
+cx q[2], q[0];
+cx $4, $1;
+`, CouplingMap{{0, 1}, {1, 2}})
+	if len(r.Uncoupled) != 3 {
+		t.Fatalf("Uncoupled = %+v, want 3 entries", r.Uncoupled)
+	}
+	if c := r.Uncoupled[0]; c.Count != 1 || c.Position.Line != 4 {
+		t.Errorf("Uncoupled[0] = %+v", c)
+	}
+	if c := r.Uncoupled[2]; c.Qubits[0] != 4 || c.Qubits[1] != 1 {
+		t.Errorf("Uncoupled[2] = %+v", c)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	r := estimate(t, `OPENQASM 3.0;
+qubit[3] q;
+h q[0];
+cx q[0], q[2];
+cx q[0], q[2];
+`, CouplingMap{{0, 1}})
+	var sb strings.Builder
+	if err := r.WriteText(&sb, 1); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	for _, want := range []string{
+		"estimated success probability: 0.9791 (3 operations)",
+		"cx    $0,$2   2      0.9900    0.0199      4:1",
+		"4:1: cx on uncoupled qubits $0,$2 needs routing",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "\nh ") {
+		t.Errorf("output lists more than the top operation:\n%s", out)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -166,8 +167,12 @@ h q;
 	// Parse file
 	program, err := p.ParseFile(tempFile)
 	if err != nil {
-		if parseErr, ok := err.(*parser.ParseError); ok {
-			fmt.Printf("Parse error in file: %s\n", parseErr.Error())
+		var parseErrs parser.ParseErrors
+		if errors.As(err, &parseErrs) {
+			fmt.Printf("Parse errors in file: %d\n", len(parseErrs))
+			for _, parseErr := range parseErrs {
+				fmt.Printf("  %s\n", parseErr.Error())
+			}
 		} else {
 			fmt.Printf("File error: %s\n", err)
 		}
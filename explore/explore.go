@@ -0,0 +1,442 @@
+// Package explore is the model behind an interactive AST explorer: a
+// collapsible tree of a program's nodes with fuzzy search, jumping to a
+// source position and a detail view of the selected node's fields and
+// span. It holds no terminal state, so any front end can drive it:
+//
+//	x := explore.New(result.Program, result.Source())
+//	for _, n := range x.Search("/cx") {
+//		x.Reveal(n)
+//	}
+//	for _, line := range x.Lines() {
+//		fmt.Println(line)
+//	}
+//
+// It is meant for people writing visitors and passes, so the tree shows
+// the AST as the types define it, field names included, rather than as
+// the source reads.
+package explore
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Node is one entry of the tree
+type Node struct {
+	// Field is the field of the parent holding the node, with its index
+	// for slices, e.g. "Qubits[1]"; empty for the root
+	Field string
+
+	// Node is the AST node
+	Node parser.Node
+
+	Parent   *Node
+	Children []*Node
+	Depth    int
+
+	// Collapsed hides the children
+	Collapsed bool
+}
+
+// Kind returns the node's type name, such as "GateCall"
+func (n *Node) Kind() string {
+	t := reflect.TypeOf(n.Node)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// Label returns the one-line summary shown in the tree: the field, the
+// kind and the name or value of the node, e.g. "Qubits[0]:
+// IndexedIdentifier q"
+func (n *Node) Label() string {
+	label := n.Kind()
+	if name := summary(n.Node); name != "" {
+		label += " " + name
+	}
+	if n.Field != "" {
+		label = n.Field + ": " + label
+	}
+	return label
+}
+
+// Explorer is the state of an explorer session
+type Explorer struct {
+	Root   *Node
+	Source string
+
+	// Cursor is the selected node
+	Cursor *Node
+}
+
+// New returns an explorer over program with every node expanded and the
+// root selected. Source is the text program was parsed from, for the
+// detail view; it may be empty.
+func New(program *parser.Program, source string) *Explorer {
+	root := build(program, "", nil, 0)
+	return &Explorer{Root: root, Source: source, Cursor: root}
+}
+
+// build returns the tree of n and its descendants
+func build(n parser.Node, field string, parent *Node, depth int) *Node {
+	node := &Node{Field: field, Node: n, Parent: parent, Depth: depth}
+	for _, c := range children(n) {
+		node.Children = append(node.Children, build(c.node, c.field, node, depth+1))
+	}
+	return node
+}
+
+type child struct {
+	field string
+	node  parser.Node
+}
+
+var (
+	nodeType     = reflect.TypeOf((*parser.Node)(nil)).Elem()
+	baseNodeType = reflect.TypeOf(parser.BaseNode{})
+)
+
+// children returns the nodes held in the fields of n, in field order.
+// Fields are found by reflection, so custom statements show their
+// children too.
+func children(n parser.Node) []child {
+	v := reflect.ValueOf(n)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	v = v.Elem()
+	var kids []child
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() || f.Type == baseNodeType {
+			continue
+		}
+		value := v.Field(i)
+		if value.Kind() == reflect.Slice {
+			for j := 0; j < value.Len(); j++ {
+				if node, ok := asNode(value.Index(j)); ok {
+					kids = append(kids, child{fmt.Sprintf("%s[%d]", f.Name, j), node})
+				}
+			}
+			continue
+		}
+		if node, ok := asNode(value); ok {
+			kids = append(kids, child{f.Name, node})
+		}
+	}
+	return kids
+}
+
+// asNode returns the node v holds, if any. Struct values such as
+// Parameter are addressed, since their methods have pointer receivers.
+func asNode(v reflect.Value) (parser.Node, bool) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() || !v.Type().Implements(nodeType) {
+			return nil, false
+		}
+		return v.Interface().(parser.Node), true
+	case reflect.Struct:
+		if v.CanAddr() && v.Addr().Type().Implements(nodeType) {
+			return v.Addr().Interface().(parser.Node), true
+		}
+	}
+	return nil, false
+}
+
+// summary returns the name or value that identifies n in a label
+func summary(n parser.Node) string {
+	v := reflect.ValueOf(n)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	v = v.Elem()
+	for _, field := range []string{"Name", "Identifier", "Path", "Number", "Operator", "Type", "Raw", "Value", "Text"} {
+		f := v.FieldByName(field)
+		if !f.IsValid() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.String:
+			if s := f.String(); s != "" {
+				return firstLine(s)
+			}
+		case reflect.Int64, reflect.Float64, reflect.Bool:
+			return fmt.Sprint(f.Interface())
+		}
+	}
+	return ""
+}
+
+// Visible returns the nodes shown in the tree, in display order: every
+// node whose ancestors are all expanded
+func (x *Explorer) Visible() []*Node {
+	var nodes []*Node
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		nodes = append(nodes, n)
+		if n.Collapsed {
+			return
+		}
+		for _, c := range n.Children {
+			visit(c)
+		}
+	}
+	visit(x.Root)
+	return nodes
+}
+
+// Lines renders the visible tree, one node per line, indented by depth.
+// Nodes with children are marked "▾" when expanded and "▸" when
+// collapsed, and the cursor line starts with ">".
+func (x *Explorer) Lines() []string {
+	visible := x.Visible()
+	lines := make([]string, len(visible))
+	for i, n := range visible {
+		cursor := "  "
+		if n == x.Cursor {
+			cursor = "> "
+		}
+		marker := "  "
+		if len(n.Children) > 0 {
+			marker = "▾ "
+			if n.Collapsed {
+				marker = "▸ "
+			}
+		}
+		lines[i] = cursor + strings.Repeat("  ", n.Depth) + marker + n.Label()
+	}
+	return lines
+}
+
+// Toggle collapses n if it is expanded and expands it otherwise
+func (x *Explorer) Toggle(n *Node) {
+	n.Collapsed = !n.Collapsed && len(n.Children) > 0
+}
+
+// CollapseAll collapses every node below depth, so the tree shows that
+// many levels; 1 shows the top-level statements
+func (x *Explorer) CollapseAll(depth int) {
+	x.each(func(n *Node) {
+		n.Collapsed = n.Depth >= depth && len(n.Children) > 0
+	})
+}
+
+// ExpandAll expands every node
+func (x *Explorer) ExpandAll() {
+	x.each(func(n *Node) { n.Collapsed = false })
+}
+
+// Reveal expands the ancestors of n, so it is visible, and selects it
+func (x *Explorer) Reveal(n *Node) {
+	for p := n.Parent; p != nil; p = p.Parent {
+		p.Collapsed = false
+	}
+	x.Cursor = n
+}
+
+func (x *Explorer) each(f func(n *Node)) {
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		f(n)
+		for _, c := range n.Children {
+			visit(c)
+		}
+	}
+	visit(x.Root)
+}
+
+// At returns the innermost node whose span contains pos, or nil if pos
+// lies outside every statement. Nodes without a position, such as ones
+// built by hand, are skipped.
+func (x *Explorer) At(pos parser.Position) *Node {
+	var found *Node
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		for _, c := range n.Children {
+			if contains(c.Node, pos) {
+				found = c
+				visit(c)
+				return
+			}
+		}
+	}
+	visit(x.Root)
+	return found
+}
+
+// Jump selects and reveals the innermost node at pos, reporting whether
+// there is one
+func (x *Explorer) Jump(pos parser.Position) bool {
+	n := x.At(pos)
+	if n == nil {
+		return false
+	}
+	x.Reveal(n)
+	return true
+}
+
+func contains(n parser.Node, pos parser.Position) bool {
+	start, end := n.Pos(), n.End()
+	if start.Line == 0 {
+		return false
+	}
+	return !before(pos, start) && before(pos, end)
+}
+
+func before(a, b parser.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// Search returns the nodes whose label matches query fuzzily: the
+// characters of query appear in the label in order, ignoring case. The
+// leading "/" of the search key binding may be included. Matches are
+// ranked best first, preferring contiguous matches that start at a word,
+// then tree order.
+func (x *Explorer) Search(query string) []*Node {
+	query = strings.TrimPrefix(query, "/")
+	if query == "" {
+		return nil
+	}
+	type match struct {
+		node  *Node
+		score int
+		order int
+	}
+	var matches []match
+	order := 0
+	x.each(func(n *Node) {
+		if score, ok := fuzzy(query, n.Label()); ok {
+			matches = append(matches, match{n, score, order})
+		}
+		order++
+	})
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].order < matches[j].order
+	})
+	nodes := make([]*Node, len(matches))
+	for i, m := range matches {
+		nodes[i] = m.node
+	}
+	return nodes
+}
+
+// fuzzy reports whether the runes of query appear in order in text,
+// ignoring case, and scores the match: consecutive runes and runes at
+// the start of a word score higher, and a match of the whole of a word
+// scores highest
+func fuzzy(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+	score, qi, prev := 0, 0, -2
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		score++
+		if ti == prev+1 {
+			score += 2
+		}
+		if ti == 0 || !isWordRune(t[ti-1]) {
+			score += 3
+		}
+		prev = ti
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	// The match ends a word, as "cx" does in "GateCall cx"
+	if prev == len(t)-1 || !isWordRune(t[prev+1]) {
+		score += 3
+	}
+	return score, true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Detail renders the detail pane of n: its kind, source span and text,
+// and its fields. Child nodes are summarized by their label; the tree
+// shows them in full.
+func (x *Explorer) Detail(n *Node) string {
+	var sb strings.Builder
+	sb.WriteString(n.Kind() + "\n")
+	start, end := n.Node.Pos(), n.Node.End()
+	if start.Line > 0 {
+		fmt.Fprintf(&sb, "span: %d:%d-%d:%d (offset %d-%d)\n", start.Line, start.Column, end.Line, end.Column, start.Offset, end.Offset)
+		if text, ok := x.text(start, end); ok {
+			sb.WriteString("source: " + firstLine(text))
+			if strings.Contains(text, "\n") {
+				sb.WriteString(" ...")
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	v := reflect.ValueOf(n.Node)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return sb.String()
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() || f.Type == baseNodeType {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", f.Name, fieldValue(v.Field(i)))
+	}
+	return sb.String()
+}
+
+// text returns the source between start and end, by rune offset
+func (x *Explorer) text(start, end parser.Position) (string, bool) {
+	src := []rune(x.Source)
+	if start.Offset < 0 || end.Offset > len(src) || start.Offset >= end.Offset {
+		return "", false
+	}
+	return string(src[start.Offset:end.Offset]), true
+}
+
+// fieldValue renders one field for the detail pane
+func fieldValue(v reflect.Value) string {
+	if node, ok := asNode(v); ok {
+		return (&Node{Node: node}).Label()
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return "nil"
+		}
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return "[]"
+		}
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fieldValue(v.Index(i))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
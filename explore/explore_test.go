@@ -0,0 +1,127 @@
+package explore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const source = `OPENQASM 3.0;
+qubit[2] q;
+gate bell a, b { h a; cx a, b; }
+cx q[0], q[1];
+`
+
+func explorer(t *testing.T) *Explorer {
+	t.Helper()
+	result := parser.NewParser().ParseWithErrors(source)
+	if result.HasErrors() {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+	return New(result.Program, source)
+}
+
+func TestLines(t *testing.T) {
+	x := explorer(t)
+	x.CollapseAll(1)
+	want := []string{
+		"> ▾ Program",
+		"      Version: Version 3.0",
+		"    ▸ Statements[0]: QuantumDeclaration q",
+		"    ▸ Statements[1]: GateDefinition bell",
+		"    ▸ Statements[2]: GateCall cx",
+	}
+	if got := x.Lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Lines() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	call := x.Root.Children[3]
+	x.Toggle(call)
+	x.Cursor = call
+	want = []string{
+		"  ▾ Program",
+		"      Version: Version 3.0",
+		"    ▸ Statements[0]: QuantumDeclaration q",
+		"    ▸ Statements[1]: GateDefinition bell",
+		">   ▾ Statements[2]: GateCall cx",
+		"      ▸ Qubits[0]: IndexedIdentifier q",
+		"      ▸ Qubits[1]: IndexedIdentifier q",
+	}
+	if got := x.Lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Lines() after Toggle =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSearch(t *testing.T) {
+	x := explorer(t)
+	matches := x.Search("/cx")
+	if len(matches) != 2 {
+		t.Fatalf("Search(/cx) = %d matches, want 2", len(matches))
+	}
+	// Equal matches come in tree order
+	if matches[0].Field != "Body[1]" || matches[1].Field != "Statements[2]" {
+		t.Errorf("matches = %s, %s", matches[0].Label(), matches[1].Label())
+	}
+	for _, m := range matches {
+		if !strings.HasSuffix(m.Label(), "GateCall cx") {
+			t.Errorf("match %s is not a cx call", m.Label())
+		}
+	}
+
+	x.CollapseAll(0)
+	x.Reveal(matches[0])
+	if x.Cursor != matches[0] {
+		t.Errorf("Reveal did not select the match")
+	}
+	visible := false
+	for _, n := range x.Visible() {
+		visible = visible || n == matches[0]
+	}
+	if !visible {
+		t.Errorf("Reveal left the match hidden")
+	}
+
+	if got := x.Search("gdf"); len(got) == 0 || got[0].Kind() != "GateDefinition" {
+		t.Errorf("Search(gdf) did not find the gate definition")
+	}
+	if got := x.Search("zz"); len(got) != 0 {
+		t.Errorf("Search(zz) = %d matches, want none", len(got))
+	}
+}
+
+func TestJump(t *testing.T) {
+	x := explorer(t)
+	x.CollapseAll(1)
+	// The "a" operand of cx in the gate body
+	if !x.Jump(parser.Position{Line: 3, Column: 26}) {
+		t.Fatal("Jump found no node")
+	}
+	if got := x.Cursor.Label(); got != "Qubits[0]: Identifier a" {
+		t.Errorf("Jump selected %s", got)
+	}
+	if x.Cursor.Parent.Collapsed || x.Cursor.Parent.Parent.Collapsed {
+		t.Errorf("Jump left the node's ancestors collapsed")
+	}
+	if x.Jump(parser.Position{Line: 9, Column: 1}) {
+		t.Errorf("Jump past the end found a node")
+	}
+}
+
+func TestDetail(t *testing.T) {
+	x := explorer(t)
+	call := x.Root.Children[3].Node
+	got := x.Detail(&Node{Node: call})
+	for _, want := range []string{
+		"GateCall\n",
+		"span: 4:1-4:15",
+		"source: cx q[0], q[1];\n",
+		`Name: "cx"`,
+		"Qubits: [IndexedIdentifier q, IndexedIdentifier q]",
+		"Modifiers: []",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Detail() lacks %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+// Package gradient generates the circuits of parameter-shift gradients.
+// A free parameter θ of a program, a name it uses but does not declare,
+// enters gate calls as arguments a_k(θ). For rotation gates, whose
+// generators have eigenvalues ±1/2, the derivative of an expectation
+// value E is
+//
+//	dE/dθ = Σ_k c_k · (E(a_k + π/2) - E(a_k - π/2)) / 2
+//
+// where c_k = da_k/dθ and each term shifts one argument only. Shifts
+// returns the pair of shifted circuits of every term; Batch packs them
+// for a backend with labels linking each circuit to its term.
+package gradient
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/archive"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/stdlib"
+	"github.com/orangekame3/qasmparser/symbols"
+)
+
+// shiftable lists the gates whose every parameter obeys the two-term
+// shift rule. Controlled rotations such as crx do not, as their
+// generators have three distinct eigenvalues.
+var shiftable = map[string]bool{
+	"rx": true, "ry": true, "rz": true, "rxx": true, "rzz": true,
+	"p": true, "phase": true, "u1": true, "cp": true, "cphase": true, "cu1": true,
+	"u2": true, "u3": true, "u": true, "U": true,
+}
+
+// Term is one argument a free parameter enters
+type Term struct {
+	Parameter string `json:"parameter"`
+
+	// Call is the gate call and Argument the index of the argument
+	Call     *parser.GateCall `json:"-"`
+	Argument int              `json:"argument"`
+
+	// Coefficient is the derivative of the argument with respect to the
+	// parameter
+	Coefficient float64 `json:"coefficient"`
+
+	Position parser.Position `json:"position"`
+}
+
+// Shift is a term's pair of shifted circuits
+type Shift struct {
+	Term
+
+	// Plus and Minus are the program with the term's argument shifted by
+	// +π/2 and -π/2
+	Plus, Minus *parser.Program
+}
+
+// Shifts returns the shifted circuits of every term of the free
+// parameters of program, grouped by parameter in order of first use and
+// in source order within a parameter. values holds the point the
+// gradient is taken at and must give every free parameter. Free
+// parameters may only be used in the arguments of top-level or
+// branched calls of the gates the shift rule holds for, and arguments
+// must be linear in them.
+func Shifts(program *parser.Program, values map[string]float64) ([]Shift, error) {
+	terms, err := Terms(program, values)
+	if err != nil {
+		return nil, err
+	}
+	shifts := make([]Shift, len(terms))
+	for i, t := range terms {
+		shifts[i] = Shift{Term: t, Plus: shifted(program, t, "+"), Minus: shifted(program, t, "-")}
+	}
+	return shifts, nil
+}
+
+// Terms returns the terms of the free parameters of program, as Shifts
+// orders them
+func Terms(program *parser.Program, values map[string]float64) ([]Term, error) {
+	free := freeIdentifiers(program)
+	used := make(map[*parser.Identifier]bool)
+	c := &collector{free: free, used: used, values: values}
+	if err := c.statements(program.Statements, false); err != nil {
+		return nil, err
+	}
+	for _, id := range free {
+		if !used[id] {
+			return nil, fmt.Errorf("%s: parameter %s is used outside the arguments of gate calls", position(id), id.Name)
+		}
+	}
+
+	// Group by parameter, keeping the order of first use
+	var order []string
+	byName := make(map[string][]Term)
+	for _, t := range c.terms {
+		if _, ok := byName[t.Parameter]; !ok {
+			order = append(order, t.Parameter)
+		}
+		byName[t.Parameter] = append(byName[t.Parameter], t)
+	}
+	var terms []Term
+	for _, name := range order {
+		terms = append(terms, byName[name]...)
+	}
+	return terms, nil
+}
+
+// freeIdentifiers returns the identifiers of program that name neither
+// a declaration nor a predefined constant, in source order
+func freeIdentifiers(program *parser.Program) []*parser.Identifier {
+	table := symbols.Build(program)
+	c := &identifiers{}
+	parser.Walk(parser.NewDepthFirstVisitor(c), program)
+	var free []*parser.Identifier
+	for _, id := range c.all {
+		if strings.HasPrefix(id.Name, "$") || stdlib.IsConstant(id.Name) {
+			continue
+		}
+		if _, ok := table.Lookup(id.Name, id.Pos()); !ok {
+			free = append(free, id)
+		}
+	}
+	return free
+}
+
+type identifiers struct {
+	parser.BaseVisitor
+	all []*parser.Identifier
+}
+
+func (c *identifiers) VisitIdentifier(node *parser.Identifier) interface{} {
+	c.all = append(c.all, node)
+	return nil
+}
+
+// collector finds the terms of the gate calls of a program
+type collector struct {
+	free   []*parser.Identifier
+	used   map[*parser.Identifier]bool
+	values map[string]float64
+	terms  []Term
+}
+
+func (c *collector) statements(statements []parser.Statement, loop bool) error {
+	for _, stmt := range statements {
+		var err error
+		switch s := stmt.(type) {
+		case *parser.GateCall:
+			err = c.call(s, loop)
+		case *parser.IfStatement:
+			if err = c.statements(s.ThenBody, loop); err == nil {
+				err = c.statements(s.ElseBody, loop)
+			}
+		case *parser.ForStatement:
+			err = c.statements(s.Body, true)
+		case *parser.WhileStatement:
+			err = c.statements(s.Body, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// within returns the free identifiers inside expr
+func (c *collector) within(expr parser.Node) []*parser.Identifier {
+	var found []*parser.Identifier
+	for _, id := range c.free {
+		if !before(id.Pos(), expr.Pos()) && before(id.Pos(), expr.End()) {
+			found = append(found, id)
+		}
+	}
+	return found
+}
+
+func (c *collector) call(call *parser.GateCall, loop bool) error {
+	for _, mod := range call.Modifiers {
+		for _, p := range mod.Parameters {
+			if ids := c.within(p); len(ids) > 0 {
+				return fmt.Errorf("%s: parameter %s is used in a modifier", position(ids[0]), ids[0].Name)
+			}
+		}
+	}
+	for k, arg := range call.Parameters {
+		ids := c.within(arg)
+		if len(ids) == 0 {
+			continue
+		}
+		name := ids[0].Name
+		switch {
+		case loop:
+			return fmt.Errorf("%s: parameter %s is used in a loop, where each iteration needs its own shift", position(ids[0]), name)
+		case !shiftable[call.Name]:
+			return fmt.Errorf("%s: gate %s does not follow the two-term parameter-shift rule", position(call), call.Name)
+		}
+		for _, mod := range call.Modifiers {
+			if mod.Type != "inv" {
+				return fmt.Errorf("%s: %s @ %s does not follow the two-term parameter-shift rule", position(call), mod.Type, call.Name)
+			}
+		}
+		for _, id := range ids {
+			c.used[id] = true
+		}
+
+		// An argument may use several parameters, each a term of its own
+		var names []string
+		for _, id := range ids {
+			if !contains(names, id.Name) {
+				names = append(names, id.Name)
+			}
+		}
+		for _, name := range names {
+			coeff, err := c.coefficient(arg, name)
+			if err != nil {
+				return fmt.Errorf("%s: %w", position(arg), err)
+			}
+			if coeff != 0 {
+				c.terms = append(c.terms, Term{Parameter: name, Call: call, Argument: k, Coefficient: coeff, Position: arg.Pos()})
+			}
+		}
+	}
+	return nil
+}
+
+// coefficient returns the derivative of a linear argument with respect to
+// parameter name, at the given values
+func (c *collector) coefficient(arg parser.Expression, name string) (float64, error) {
+	if _, ok := c.values[name]; !ok {
+		return 0, fmt.Errorf("no value is given for parameter %s", name)
+	}
+	at := func(delta float64) (float64, error) {
+		env := make(analysis.Constants, len(c.values))
+		for n, v := range c.values {
+			env[n] = analysis.Value{Kind: analysis.Float, Float: v}
+		}
+		env[name] = analysis.Value{Kind: analysis.Float, Float: c.values[name] + delta}
+		v, ok := env.Evaluate(arg)
+		if ok {
+			v, ok = analysis.Cast(v, "float", 0)
+		}
+		if !ok {
+			return 0, fmt.Errorf("cannot evaluate %s", printer.Expression(arg))
+		}
+		return v.Float, nil
+	}
+	var f [3]float64
+	for i := range f {
+		v, err := at(float64(i))
+		if err != nil {
+			return 0, err
+		}
+		f[i] = v
+	}
+	slope := f[1] - f[0]
+	if math.Abs((f[2]-f[1])-slope) > 1e-9*max(1, math.Abs(slope)) {
+		return 0, fmt.Errorf("%s is not linear in %s", printer.Expression(arg), name)
+	}
+	return slope, nil
+}
+
+// shifted returns program with the argument of term shifted by π/2 in
+// the direction of sign
+func shifted(program *parser.Program, t Term, sign string) *parser.Program {
+	arg := t.Call.Parameters[t.Argument]
+	if _, ok := arg.(*parser.Identifier); !ok {
+		arg = &parser.ParenthesizedExpression{Expression: arg}
+	}
+	call := *t.Call
+	call.Parameters = append([]parser.Expression(nil), t.Call.Parameters...)
+	call.Parameters[t.Argument] = &parser.BinaryExpression{
+		Left:     arg,
+		Operator: sign,
+		Right: &parser.BinaryExpression{
+			Left: &parser.Identifier{Name: "pi"}, Operator: "/", Right: &parser.IntegerLiteral{Value: 2},
+		},
+	}
+	out := *program
+	out.Statements = replace(program.Statements, t.Call, &call)
+	return &out
+}
+
+// replace returns statements with old replaced by new, copying the
+// branches on the way to it
+func replace(statements []parser.Statement, old, new *parser.GateCall) []parser.Statement {
+	out := make([]parser.Statement, len(statements))
+	for i, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.GateCall:
+			if s == old {
+				out[i] = new
+				continue
+			}
+		case *parser.IfStatement:
+			branch := *s
+			branch.ThenBody = replace(s.ThenBody, old, new)
+			branch.ElseBody = replace(s.ElseBody, old, new)
+			out[i] = &branch
+			continue
+		}
+		out[i] = stmt
+	}
+	return out
+}
+
+// Batch returns the shifted circuits of program as a batch, named after
+// name with the parameter, the index of the term among its terms and the
+// direction, such as ansatz_theta_0_plus.qasm. Every entry carries the
+// values and the labels gradient.parameter, gradient.term,
+// gradient.coefficient and gradient.shift (plus or minus).
+func Batch(name string, program *parser.Program, values map[string]float64) (archive.Batch, error) {
+	shifts, err := Shifts(program, values)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(name, path.Ext(name))
+	var batch archive.Batch
+	index := make(map[string]int)
+	for _, s := range shifts {
+		term := index[s.Parameter]
+		index[s.Parameter]++
+		for _, side := range []struct {
+			name    string
+			program *parser.Program
+		}{{"plus", s.Plus}, {"minus", s.Minus}} {
+			params := make(map[string]float64, len(values))
+			for n, v := range values {
+				params[n] = v
+			}
+			batch = append(batch, archive.Entry{
+				Source: parser.Source{
+					Name:    fmt.Sprintf("%s_%s_%d_%s.qasm", base, s.Parameter, term, side.name),
+					Content: []byte(printer.Print(side.program)),
+				},
+				Metadata: archive.Metadata{
+					Parameters: params,
+					Labels: map[string]string{
+						"gradient.parameter":   s.Parameter,
+						"gradient.term":        strconv.Itoa(term),
+						"gradient.coefficient": strconv.FormatFloat(s.Coefficient, 'g', -1, 64),
+						"gradient.shift":       side.name,
+					},
+				},
+			})
+		}
+	}
+	return batch, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func position(node parser.Node) string {
+	pos := node.Pos()
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
+
+// before reports whether a comes before b
+func before(a, b parser.Position) bool {
+	return a.Offset < b.Offset
+}
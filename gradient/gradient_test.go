@@ -0,0 +1,180 @@
+package gradient
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/archive"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/sim"
+	"github.com/orangekame3/qasmparser/sweep"
+)
+
+const source = `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+ry(2 * theta) q[0];
+cx q[0], q[1];
+rz(phi) q[1];
+rx(theta + phi / 2) q[1];
+`
+
+func parse(t *testing.T, src string) *parser.Program {
+	t.Helper()
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+// expectation returns the expectation value of ZZ for program bound to
+// values
+func expectation(t *testing.T, program *parser.Program, values map[string]float64) float64 {
+	t.Helper()
+	var axes []sweep.Axis
+	var point sweep.Point
+	for _, name := range []string{"theta", "phi"} {
+		axes = append(axes, sweep.Axis{Name: name})
+		point = append(point, values[name])
+	}
+	bound, err := sweep.Bind(program, axes, point)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := sim.Expectation(bound, "ZZ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestShifts(t *testing.T) {
+	program := parse(t, source)
+	values := map[string]float64{"theta": 0.3, "phi": 1.1}
+	shifts, err := Shifts(program, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, s := range shifts {
+		got = append(got, s.Parameter+" "+printer.Expression(argument(s.Plus, s.Term)))
+	}
+	want := []string{
+		"theta (2 * theta) + pi / 2",
+		"theta (theta + phi / 2) + pi / 2",
+		"phi phi + pi / 2",
+		"phi (theta + phi / 2) + pi / 2",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("shifts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if printer.Print(program) != printer.Print(parse(t, source)) {
+		t.Error("Shifts modified the program")
+	}
+
+	// The shift rule gives the exact derivative, here checked against a
+	// central difference
+	gradient := make(map[string]float64)
+	for _, s := range shifts {
+		plus := expectation(t, s.Plus, values)
+		minus := expectation(t, s.Minus, values)
+		gradient[s.Parameter] += s.Coefficient * (plus - minus) / 2
+	}
+	const h = 1e-5
+	for name := range values {
+		up := map[string]float64{"theta": values["theta"], "phi": values["phi"]}
+		down := map[string]float64{"theta": values["theta"], "phi": values["phi"]}
+		up[name] += h
+		down[name] -= h
+		want := (expectation(t, program, up) - expectation(t, program, down)) / (2 * h)
+		if math.Abs(gradient[name]-want) > 1e-6 {
+			t.Errorf("dE/d%s = %g, want %g", name, gradient[name], want)
+		}
+	}
+}
+
+// argument returns the argument of the term t in program, a copy of the
+// program t was found in
+func argument(program *parser.Program, t Term) parser.Expression {
+	for _, stmt := range program.Statements {
+		if call, ok := stmt.(*parser.GateCall); ok && call.Pos() == t.Call.Pos() {
+			return call.Parameters[t.Argument]
+		}
+	}
+	return nil
+}
+
+func TestShiftsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		values map[string]float64
+		want   string
+	}{
+		{"no value", "qubit q;\nrx(theta) q;", nil, "3:4: no value is given for parameter theta"},
+		{"loop", "qubit q;\nfor int i in [0:2] { rx(theta) q; }", map[string]float64{"theta": 0}, "3:25: parameter theta is used in a loop"},
+		{"gate", "qubit[2] q;\ncrx(theta) q[0], q[1];", map[string]float64{"theta": 0}, "3:1: gate crx does not follow"},
+		{"ctrl", "qubit[2] q;\nctrl @ rx(theta) q[0], q[1];", map[string]float64{"theta": 0}, "3:1: ctrl @ rx does not follow"},
+		{"nonlinear", "qubit q;\nrx(theta * theta) q;", map[string]float64{"theta": 1}, "theta * theta is not linear in theta"},
+		{"classical", "qubit q;\nfloat x = theta;\nrx(theta) q;", map[string]float64{"theta": 0}, "3:11: parameter theta is used outside the arguments of gate calls"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parse(t, "include \"stdgates.inc\";\n"+tt.src)
+			_, err := Shifts(program, tt.values)
+			if err == nil {
+				t.Fatal("want an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	program := parse(t, source)
+	batch, err := Batch("ansatz.qasm", program, map[string]float64{"theta": 0.3, "phi": 1.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := batch.Validate(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var names []string
+	for _, e := range batch {
+		names = append(names, e.Name)
+	}
+	want := "ansatz_theta_0_plus.qasm ansatz_theta_0_minus.qasm ansatz_theta_1_plus.qasm ansatz_theta_1_minus.qasm " +
+		"ansatz_phi_0_plus.qasm ansatz_phi_0_minus.qasm ansatz_phi_1_plus.qasm ansatz_phi_1_minus.qasm"
+	if strings.Join(names, " ") != want {
+		t.Errorf("names %s, want %s", strings.Join(names, " "), want)
+	}
+	if got := batch[1].Metadata.Labels; got["gradient.parameter"] != "theta" || got["gradient.term"] != "0" ||
+		got["gradient.shift"] != "minus" || got["gradient.coefficient"] != "2" {
+		t.Errorf("labels %v", got)
+	}
+
+	// Labels survive a round trip through JSON Lines
+	var buf bytes.Buffer
+	if err := archive.WriteJSONL(&buf, batch); err != nil {
+		t.Fatal(err)
+	}
+	read, err := archive.ReadJSONL(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read[6].Metadata.Labels["gradient.coefficient"]; got != "0.5" {
+		t.Errorf("coefficient %q after a round trip, want 0.5", got)
+	}
+	for _, e := range batch {
+		if _, err := parser.NewParser().ParseString(string(e.Content)); err != nil {
+			t.Errorf("%s: %v", e.Name, err)
+		}
+	}
+}
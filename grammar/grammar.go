@@ -0,0 +1,212 @@
+// Package grammar exposes the OpenQASM 3 grammar the parser is generated
+// from (qasm3Parser.g4 and qasm3Lexer.g4 in this directory) and measures
+// which of its rules and tokens a body of QASM source exercises, so
+// maintainers can find productions no test covers.
+package grammar
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/antlr4-go/antlr/v4"
+	qasm_gen "github.com/orangekame3/qasmparser/gen/parser"
+	"github.com/orangekame3/qasmparser/ignore"
+)
+
+// skippedTokens are lexer rules that discard their text, so no token of
+// these types ever reaches the parser
+var skippedTokens = map[string]bool{
+	"Whitespace":                   true,
+	"Newline":                      true,
+	"VERSION_IDENTIFER_WHITESPACE": true,
+	"ARBITRARY_STRING_WHITESPACE":  true,
+	"EAT_INITIAL_SPACE":            true,
+	"EAT_LINE_END":                 true,
+	"CAL_PRELUDE_WHITESPACE":       true,
+	"DEFCAL_PRELUDE_WHITESPACE":    true,
+}
+
+// Rules returns the names of the parser rules in grammar order
+func Rules() []string {
+	p := qasm_gen.Newqasm3Parser(antlr.NewCommonTokenStream(qasm_gen.Newqasm3Lexer(antlr.NewInputStream("")), antlr.TokenDefaultChannel))
+	return append([]string(nil), p.RuleNames...)
+}
+
+// Tokens returns the names of the token types the lexer can produce, in
+// grammar order. Rules that only skip text, such as Whitespace, are not
+// included.
+func Tokens() []string {
+	lexer := qasm_gen.Newqasm3Lexer(antlr.NewInputStream(""))
+	var names []string
+	for _, name := range lexer.SymbolicNames {
+		if name != "" && !skippedTokens[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Usage counts how often each rule and token occurs in parsed source
+type Usage struct {
+	Rules  map[string]int `json:"rules"`
+	Tokens map[string]int `json:"tokens"`
+}
+
+func newUsage() *Usage {
+	return &Usage{Rules: make(map[string]int), Tokens: make(map[string]int)}
+}
+
+// Exercised parses content and reports the rules and tokens it uses.
+// Content with syntax errors is counted as far as error recovery gets.
+func Exercised(content string) *Usage {
+	usage := newUsage()
+
+	lexer := qasm_gen.Newqasm3Lexer(antlr.NewInputStream(content))
+	lexer.RemoveErrorListeners()
+	stream := antlr.NewCommonTokenStream(lexer, antlr.TokenDefaultChannel)
+	p := qasm_gen.Newqasm3Parser(stream)
+	p.RemoveErrorListeners()
+	tree := p.Program()
+
+	var visit func(node antlr.Tree)
+	visit = func(node antlr.Tree) {
+		if ctx, ok := node.(antlr.RuleContext); ok {
+			if i := ctx.GetRuleIndex(); i >= 0 && i < len(p.RuleNames) {
+				usage.Rules[p.RuleNames[i]]++
+			}
+		}
+		for i := 0; i < node.GetChildCount(); i++ {
+			visit(node.GetChild(i))
+		}
+	}
+	visit(tree)
+
+	// Tokens are counted from the stream so hidden comments are included
+	stream.Fill()
+	for _, tok := range stream.GetAllTokens() {
+		if t := tok.GetTokenType(); t > 0 && t < len(lexer.SymbolicNames) {
+			usage.Tokens[lexer.SymbolicNames[t]]++
+		}
+	}
+	return usage
+}
+
+// Coverage accumulates the usage of a corpus
+type Coverage struct {
+	usage *Usage
+	files int
+}
+
+// NewCoverage creates an empty coverage accumulator
+func NewCoverage() *Coverage {
+	return &Coverage{usage: newUsage()}
+}
+
+// Add records the usage of one source text
+func (c *Coverage) Add(content string) {
+	c.files++
+	u := Exercised(content)
+	for name, n := range u.Rules {
+		c.usage.Rules[name] += n
+	}
+	for name, n := range u.Tokens {
+		c.usage.Tokens[name] += n
+	}
+}
+
+// AddFile records the usage of a file
+func (c *Coverage) AddFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	c.Add(string(content))
+	return nil
+}
+
+// AddDir records the usage of every .qasm and .inc file under root that
+// .qasmignore files do not exclude
+func (c *Coverage) AddDir(root string) error {
+	files, err := ignore.Expand([]string{root}, &ignore.Options{Extensions: []string{".qasm", ".inc"}})
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := c.AddFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Report summarizes a corpus's coverage of the grammar
+type Report struct {
+	Files        int      `json:"files"`
+	RulesHit     int      `json:"rules_hit"`
+	RulesTotal   int      `json:"rules_total"`
+	TokensHit    int      `json:"tokens_hit"`
+	TokensTotal  int      `json:"tokens_total"`
+	UnusedRules  []string `json:"unused_rules"`
+	UnusedTokens []string `json:"unused_tokens"`
+}
+
+// Report lists the rules and tokens the corpus never exercised
+func (c *Coverage) Report() Report {
+	r := Report{Files: c.files, UnusedRules: []string{}, UnusedTokens: []string{}}
+	for _, name := range Rules() {
+		r.RulesTotal++
+		if c.usage.Rules[name] > 0 {
+			r.RulesHit++
+		} else {
+			r.UnusedRules = append(r.UnusedRules, name)
+		}
+	}
+	for _, name := range Tokens() {
+		r.TokensTotal++
+		if c.usage.Tokens[name] > 0 {
+			r.TokensHit++
+		} else {
+			r.UnusedTokens = append(r.UnusedTokens, name)
+		}
+	}
+	return r
+}
+
+// Usage returns the accumulated counts
+func (c *Coverage) Usage() *Usage {
+	return c.usage
+}
+
+// WriteText writes the report for a terminal
+func (r Report) WriteText(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "files:  %d\n", r.Files)
+	fmt.Fprintf(&sb, "rules:  %d/%d (%.1f%%)\n", r.RulesHit, r.RulesTotal, percent(r.RulesHit, r.RulesTotal))
+	fmt.Fprintf(&sb, "tokens: %d/%d (%.1f%%)\n", r.TokensHit, r.TokensTotal, percent(r.TokensHit, r.TokensTotal))
+	writeList(&sb, "unused rules", r.UnusedRules)
+	writeList(&sb, "unused tokens", r.UnusedTokens)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeList(sb *strings.Builder, heading string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	fmt.Fprintf(sb, "\n%s:\n", heading)
+	for _, name := range sorted {
+		fmt.Fprintf(sb, "  %s\n", name)
+	}
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
@@ -0,0 +1,77 @@
+package grammar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRulesAndTokens(t *testing.T) {
+	rules := Rules()
+	if len(rules) == 0 || rules[0] != "program" {
+		t.Fatalf("Rules() should start with program, got %v", rules)
+	}
+	if !contains(rules, "gateStatement") {
+		t.Error("Rules() is missing gateStatement")
+	}
+
+	tokens := Tokens()
+	if !contains(tokens, "GATE") || !contains(tokens, "LineComment") {
+		t.Error("Tokens() is missing GATE or LineComment")
+	}
+	if contains(tokens, "Whitespace") {
+		t.Error("Tokens() should not include skipped Whitespace")
+	}
+}
+
+func TestExercised(t *testing.T) {
+	u := Exercised("OPENQASM 3.0;\nqubit q; // c\ngate g a { x a; }\ng q;\n")
+	if u.Rules["gateStatement"] != 1 || u.Rules["gateCallStatement"] != 2 {
+		t.Errorf("unexpected rule counts: gateStatement=%d gateCallStatement=%d",
+			u.Rules["gateStatement"], u.Rules["gateCallStatement"])
+	}
+	if u.Tokens["LineComment"] != 1 || u.Tokens["GATE"] != 1 {
+		t.Errorf("unexpected token counts: %v", u.Tokens)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	c := NewCoverage()
+	c.Add("OPENQASM 3.0;\nqubit q;\n")
+	c.Add("OPENQASM 3.0;\nqubit q;\nwhile (true) { x q; }\n")
+
+	r := c.Report()
+	if r.Files != 2 || r.RulesHit == 0 || r.RulesHit >= r.RulesTotal {
+		t.Errorf("unexpected report %+v", r)
+	}
+	if contains(r.UnusedRules, "whileStatement") || !contains(r.UnusedRules, "forStatement") {
+		t.Error("unused rules should include forStatement but not whileStatement")
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "unused rules:\n") || !strings.Contains(buf.String(), "  forStatement\n") {
+		t.Errorf("unexpected text report:\n%s", buf.String())
+	}
+}
+
+func TestCoverageTestdata(t *testing.T) {
+	c := NewCoverage()
+	if err := c.AddDir("../testdata"); err != nil {
+		t.Fatal(err)
+	}
+	if r := c.Report(); r.Files == 0 || r.RulesHit == 0 {
+		t.Errorf("testdata corpus not measured: %+v", r)
+	}
+}
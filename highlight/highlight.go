@@ -0,0 +1,189 @@
+// Package highlight classifies source tokens for syntax highlighting.
+// Identifiers are classified by what they resolve to, so a qubit register
+// and a classical variable are colored differently even though both are
+// lexically identifiers.
+package highlight
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/stdlib"
+	"github.com/orangekame3/qasmparser/symbols"
+)
+
+// Kind is the semantic class of a token
+type Kind string
+
+const (
+	KindKeyword    Kind = "keyword"
+	KindType       Kind = "type"
+	KindNumber     Kind = "number"
+	KindString     Kind = "string"
+	KindComment    Kind = "comment"
+	KindOperator   Kind = "operator"
+	KindGate       Kind = "gate"
+	KindSubroutine Kind = "subroutine"
+	KindFunction   Kind = "function"
+	KindQubit      Kind = "qubit"
+	KindVariable   Kind = "variable"
+	KindConstant   Kind = "constant"
+	KindParameter  Kind = "parameter"
+	KindBuiltin    Kind = "builtin"
+
+	// KindIdentifier is an identifier that resolves to nothing known
+	KindIdentifier Kind = "identifier"
+)
+
+// SemanticToken is one classified token. Tokens spanning several lines,
+// such as block comments, are split into one token per line.
+type SemanticToken struct {
+	Position parser.Position `json:"position"`
+	// Length is the length in characters
+	Length int  `json:"length"`
+	Kind   Kind `json:"kind"`
+	// Declaration marks the identifier that declares a symbol
+	Declaration bool `json:"declaration,omitempty"`
+}
+
+// Tokens parses content and classifies its tokens
+func Tokens(content string) []SemanticToken {
+	return FromResult(parser.NewParser().ParseWithErrors(content))
+}
+
+// FromResult classifies the tokens of an existing parse result. Programs
+// with syntax errors are classified as far as their AST reaches.
+func FromResult(result *parser.ParseResult) []SemanticToken {
+	lexed := result.Tokens()
+	c := &classifier{
+		table:    symbols.Build(result.Program),
+		declared: make(map[parser.Position]bool),
+		called:   make(map[string]bool),
+	}
+	if result.Program != nil {
+		parser.Walk(parser.NewDepthFirstVisitor(c), result.Program)
+	}
+	c.locate(lexed)
+
+	var tokens []SemanticToken
+	for _, tok := range lexed {
+		kind, declaration := c.classify(tok)
+		tokens = append(tokens, split(tok, kind, declaration)...)
+	}
+	return tokens
+}
+
+// classifier resolves identifiers through the program's symbol table
+type classifier struct {
+	parser.BaseVisitor
+	table *symbols.Table
+
+	// declared holds the positions of the identifiers that declare
+	// symbols, and called the gates the program calls
+	declared map[parser.Position]bool
+	called   map[string]bool
+}
+
+func (c *classifier) VisitGateCall(node *parser.GateCall) interface{} {
+	c.called[node.Name] = true
+	return nil
+}
+
+// locate finds the identifier token declaring each symbol: the first one
+// with its name inside the declaring statement or parameter
+func (c *classifier) locate(tokens []parser.Token) {
+	for _, sym := range c.table.Symbols {
+		start, end := sym.Node.Pos(), sym.Node.End()
+		for _, tok := range tokens {
+			if tok.Class == parser.TokenIdentifier && tok.Text == sym.Name && !before(tok.Position, start) && before(tok.Position, end) {
+				c.declared[tok.Position] = true
+				break
+			}
+		}
+	}
+}
+
+// kinds maps symbol kinds to token kinds. Parameters of gates and
+// subroutines, qubit arguments included, are KindParameter.
+var kinds = map[symbols.Kind]Kind{
+	symbols.Qubit:      KindQubit,
+	symbols.Variable:   KindVariable,
+	symbols.Constant:   KindConstant,
+	symbols.Gate:       KindGate,
+	symbols.Subroutine: KindSubroutine,
+	symbols.Parameter:  KindParameter,
+	symbols.Loop:       KindVariable,
+}
+
+func (c *classifier) classify(tok parser.Token) (Kind, bool) {
+	switch tok.Class {
+	case parser.TokenKeyword:
+		return KindKeyword, false
+	case parser.TokenType:
+		return KindType, false
+	case parser.TokenNumber:
+		return KindNumber, false
+	case parser.TokenString:
+		return KindString, false
+	case parser.TokenComment:
+		return KindComment, false
+	case parser.TokenOperator:
+		return KindOperator, false
+	}
+
+	if tok.Type == "HardwareQubit" {
+		return KindQubit, false
+	}
+	if sym, ok := c.table.Lookup(tok.Text, tok.Position); ok {
+		kind := kinds[sym.Kind]
+		if sym.Owner != nil {
+			kind = KindParameter
+		}
+		return kind, c.declared[tok.Position]
+	}
+	switch {
+	case stdlib.IsConstant(tok.Text):
+		return KindBuiltin, false
+	case c.called[tok.Text]:
+		return KindGate, false
+	case stdlib.IsFunction(tok.Text):
+		return KindFunction, false
+	}
+	return KindIdentifier, false
+}
+
+// split breaks a multi-line token into one token per line
+func split(tok parser.Token, kind Kind, declaration bool) []SemanticToken {
+	if !strings.Contains(tok.Text, "\n") {
+		return []SemanticToken{{
+			Position:    tok.Position,
+			Length:      utf8.RuneCountInString(tok.Text),
+			Kind:        kind,
+			Declaration: declaration,
+		}}
+	}
+
+	var tokens []SemanticToken
+	pos := tok.Position
+	for i, line := range strings.Split(tok.Text, "\n") {
+		if i > 0 {
+			pos = parser.Position{Line: pos.Line + 1, Column: 1, Offset: pos.Offset + 1}
+		}
+		length := utf8.RuneCountInString(line)
+		if length > 0 {
+			tokens = append(tokens, SemanticToken{Position: pos, Length: length, Kind: kind})
+		}
+		pos.Column += length
+		pos.Offset += length
+	}
+	return tokens
+}
+
+// before reports whether a comes before b
+func before(a, b parser.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
@@ -0,0 +1,113 @@
+package highlight
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const source = `OPENQASM 3.0;
+const float step = pi / 4;
+qubit[2] q;
+bit c;
+gate twist(theta) a {
+  rz(theta * step) a;
+}
+for uint i in [0:1] {
+  twist(i) q[i]; // rotate
+}
+c = measure q[0];
+`
+
+// find returns the first token starting at line and column
+func find(t *testing.T, tokens []SemanticToken, line, column int) SemanticToken {
+	t.Helper()
+	for _, tok := range tokens {
+		if tok.Position.Line == line && tok.Position.Column == column {
+			return tok
+		}
+	}
+	t.Fatalf("No token at %d:%d", line, column)
+	return SemanticToken{}
+}
+
+func TestTokens(t *testing.T) {
+	tokens := Tokens(source)
+
+	tests := []struct {
+		line, column int
+		kind         Kind
+		declaration  bool
+	}{
+		{1, 1, KindKeyword, false},
+		{2, 1, KindKeyword, false},
+		{2, 7, KindType, false},
+		{2, 13, KindConstant, true},
+		{2, 20, KindBuiltin, false},
+		{2, 25, KindNumber, false},
+		{3, 10, KindQubit, true},
+		{4, 5, KindVariable, true},
+		{5, 6, KindGate, true},
+		{5, 12, KindParameter, true},
+		{5, 19, KindParameter, true},
+		{6, 3, KindGate, false},
+		{6, 6, KindParameter, false},
+		{6, 14, KindConstant, false},
+		{6, 20, KindParameter, false},
+		{8, 10, KindVariable, true},
+		{9, 3, KindGate, false},
+		{9, 9, KindVariable, false},
+		{9, 12, KindQubit, false},
+		{9, 18, KindComment, false},
+		{11, 1, KindVariable, false},
+		{11, 3, KindOperator, false},
+	}
+	for _, tt := range tests {
+		got := find(t, tokens, tt.line, tt.column)
+		if got.Kind != tt.kind || got.Declaration != tt.declaration {
+			t.Errorf("%d:%d: expected %s (declaration %v), got %s (declaration %v)",
+				tt.line, tt.column, tt.kind, tt.declaration, got.Kind, got.Declaration)
+		}
+	}
+}
+
+func TestTokensShadowing(t *testing.T) {
+	tokens := Tokens("qubit a;\ngate g a { x a; }\nx a;\n")
+
+	if tok := find(t, tokens, 2, 14); tok.Kind != KindParameter {
+		t.Errorf("Expected gate argument to shadow the register, got %s", tok.Kind)
+	}
+	if tok := find(t, tokens, 3, 3); tok.Kind != KindQubit {
+		t.Errorf("Expected the register outside the gate, got %s", tok.Kind)
+	}
+}
+
+func TestTokensMultiline(t *testing.T) {
+	tokens := Tokens("/* one\ntwo */\nqubit q;\n")
+	if len(tokens) < 2 {
+		t.Fatalf("Expected the block comment to be split, got %+v", tokens)
+	}
+	first, second := tokens[0], tokens[1]
+	if first.Kind != KindComment || first.Length != 6 || second.Position.Line != 2 || second.Length != 6 {
+		t.Errorf("Unexpected comment tokens: %+v %+v", first, second)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, "qubit q;\r\nh q; // a < b\r\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<pre class="qasm"><code><span class="qasm-type">qubit</span> ` +
+		`<span class="qasm-qubit">q</span><span class="qasm-operator">;</span>` + "\n" +
+		`<span class="qasm-gate">h</span> <span class="qasm-qubit">q</span>` +
+		`<span class="qasm-operator">;</span> <span class="qasm-comment">// a &lt; b</span>` +
+		"</code></pre>\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+	if strings.Contains(buf.String(), "\r") {
+		t.Error("Expected normalized line endings")
+	}
+}
@@ -0,0 +1,54 @@
+package highlight
+
+import (
+	"html"
+	"io"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// WriteHTML writes content as a highlighted HTML fragment:
+//
+//	<pre class="qasm"><code><span class="qasm-keyword">gate</span> ...</code></pre>
+//
+// Each token is wrapped in a span whose class is "qasm-" followed by its
+// Kind, so a stylesheet decides the colors.
+func WriteHTML(w io.Writer, content string) error {
+	// Token offsets refer to the normalized text the parser sees
+	content = normalize(content)
+	result := parser.NewParser().ParseWithErrors(content)
+	source := []rune(content)
+
+	var sb strings.Builder
+	sb.WriteString(`<pre class="qasm"><code>`)
+	offset := 0
+	for _, tok := range FromResult(result) {
+		start, end := tok.Position.Offset, tok.Position.Offset+tok.Length
+		if start < offset || end > len(source) {
+			continue
+		}
+		sb.WriteString(html.EscapeString(string(source[offset:start])))
+		sb.WriteString(`<span class="qasm-` + string(tok.Kind) + `">`)
+		sb.WriteString(html.EscapeString(string(source[start:end])))
+		sb.WriteString(`</span>`)
+		offset = end
+	}
+	sb.WriteString(html.EscapeString(strings.TrimSuffix(string(source[offset:]), "\n")))
+	sb.WriteString("</code></pre>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// normalize applies the parser's input normalization: no byte order mark,
+// \n line endings and a final newline
+func normalize(content string) string {
+	content = strings.TrimPrefix(content, "\uFEFF")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content
+}
@@ -0,0 +1,335 @@
+// Package ignore expands file arguments into the programs they name,
+// skipping those listed in .qasmignore files. Ignore files use gitignore
+// syntax:
+//
+//	# vendored code and known-broken fixtures
+//	vendor/
+//	broken_*.qasm
+//	!broken_but_kept.qasm
+//	/generated/**/*.qasm
+//
+// A pattern without a slash matches a name at any depth below the ignore
+// file's directory; one with a slash, other than a trailing one, matches
+// paths relative to that directory. A trailing slash matches directories
+// only, and ! re-includes what an earlier pattern ignored unless a parent
+// directory is ignored. The last matching pattern wins, and ignore files
+// in subdirectories take precedence over those above them.
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// File is the name of ignore files
+const File = ".qasmignore"
+
+// rule is a pattern of an ignore file
+type rule struct {
+	// base is the slash-separated directory of the ignore file, relative
+	// to the matcher's root, or "" for the root itself
+	base    string
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher decides which paths below a root are ignored
+type Matcher struct {
+	rules []rule
+}
+
+// Add adds the patterns of an ignore file in directory base, a
+// slash-separated path relative to the matcher's root ("" or "." for the
+// root). Patterns of later calls take precedence.
+func (m *Matcher) Add(base string, data []byte) error {
+	base = path.Clean(filepath.ToSlash(base))
+	if base == "." {
+		base = ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		r, ok, err := parseRule(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		if ok {
+			r.base = base
+			m.rules = append(m.rules, r)
+		}
+	}
+	return scanner.Err()
+}
+
+// AddFile adds the ignore file in directory dir, if there is one. base is
+// dir relative to the matcher's root.
+func (m *Matcher) AddFile(dir, base string) error {
+	data, err := os.ReadFile(filepath.Join(dir, File))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.Add(base, data); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Join(dir, File), err)
+	}
+	return nil
+}
+
+// Match reports whether a path relative to the matcher's root is
+// ignored, either itself or through an ignored parent directory. dir
+// tells whether the path is a directory.
+func (m *Matcher) Match(name string, dir bool) bool {
+	name = strings.Trim(path.Clean(filepath.ToSlash(name)), "/")
+	parts := strings.Split(name, "/")
+	for i := range parts[:len(parts)-1] {
+		if m.match(strings.Join(parts[:i+1], "/"), true) {
+			return true
+		}
+	}
+	return m.match(name, dir)
+}
+
+// match reports whether the last rule matching name ignores it
+func (m *Matcher) match(name string, dir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		rel := name
+		if r.base != "" {
+			if !strings.HasPrefix(name, r.base+"/") {
+				continue
+			}
+			rel = name[len(r.base)+1:]
+		}
+		if r.dirOnly && !dir {
+			continue
+		}
+		if r.pattern.MatchString(rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// parseRule reads a line of an ignore file, reporting false for blank
+// lines and comments
+func parseRule(line string) (rule, bool, error) {
+	// Trailing spaces are dropped unless escaped
+	line = strings.TrimRight(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false, nil
+	}
+	var r rule
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false, nil
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	expr, err := Compile(line)
+	if err != nil {
+		return rule{}, false, err
+	}
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	r.pattern, err = regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return rule{}, false, fmt.Errorf("pattern %q: %w", line, err)
+	}
+	return r, true, nil
+}
+
+// Compile translates a slash-separated glob into a regular expression
+// without anchors. * and ? match within a path element, [...] matches a
+// class of characters, ** matches any number of elements when it is a
+// whole element, and \ escapes the next character.
+func Compile(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && strings.HasPrefix(glob[i:], "**") && (i == 0 || glob[i-1] == '/') && (i+2 == len(glob) || glob[i+2] == '/'):
+			if i+2 == len(glob) {
+				b.WriteString(".*")
+			} else {
+				// **/ matches zero or more whole elements
+				b.WriteString("(?:.*/)?")
+				i++
+			}
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\':
+			if i+1 == len(glob) {
+				return "", fmt.Errorf("pattern %q ends with an escape", glob)
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("pattern %q has an unclosed [", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String(), nil
+}
+
+// Options configures Expand
+type Options struct {
+	// Extensions are the file extensions directories and globs are
+	// searched for. Nil means .qasm only.
+	Extensions []string
+
+	// NoIgnore disregards ignore files
+	NoIgnore bool
+}
+
+// Expand turns file arguments into the files they name. A directory
+// names the files below it with one of the extensions, and a glob such
+// as corpus/**/*.qasm the matching files below its leading directory
+// that have no glob characters. Both skip what the ignore files in that
+// directory and the directories below it ignore. Any other argument is
+// a file and is kept as given, ignored or not, since it was asked for by
+// name. Files are listed in lexical order per argument, each once.
+func Expand(args []string, opts *Options) ([]string, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	extensions := opts.Extensions
+	if extensions == nil {
+		extensions = []string{".qasm"}
+	}
+	seen := make(map[string]bool)
+	var files []string
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	for _, arg := range args {
+		root, pattern := arg, ""
+		if hasMeta(arg) {
+			root, pattern = split(arg)
+			expr, err := Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			pattern = "^" + expr + "$"
+		} else if info, err := os.Stat(arg); err != nil || !info.IsDir() {
+			add(arg)
+			continue
+		}
+		found, err := walk(root, pattern, extensions, opts.NoIgnore)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range found {
+			add(file)
+		}
+	}
+	return files, nil
+}
+
+// walk lists the files below root with one of extensions, or those
+// matching pattern, a regular expression over paths relative to root
+func walk(root, pattern string, extensions []string, noIgnore bool) ([]string, error) {
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, err
+		}
+	}
+	var m Matcher
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && !noIgnore && m.Match(rel, true) {
+				return filepath.SkipDir
+			}
+			if noIgnore {
+				return nil
+			}
+			return m.AddFile(p, rel)
+		}
+		if !noIgnore && m.Match(rel, false) {
+			return nil
+		}
+		if re != nil {
+			if re.MatchString(rel) {
+				files = append(files, p)
+			}
+			return nil
+		}
+		for _, ext := range extensions {
+			if filepath.Ext(p) == ext {
+				files = append(files, p)
+				break
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// hasMeta reports whether a path has glob characters
+func hasMeta(p string) bool {
+	return strings.ContainsAny(filepath.ToSlash(p), "*?[")
+}
+
+// split returns the leading directories of a glob that have no glob
+// characters and the slash-separated rest
+func split(glob string) (root, pattern string) {
+	parts := strings.Split(filepath.ToSlash(glob), "/")
+	i := 0
+	for i < len(parts)-1 && !hasMeta(parts[i]) {
+		i++
+	}
+	root = strings.Join(parts[:i], "/")
+	switch {
+	case root == "" && i > 0:
+		root = "/"
+	case root == "":
+		root = "."
+	}
+	return filepath.FromSlash(root), strings.Join(parts[i:], "/")
+}
@@ -0,0 +1,145 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	var m Matcher
+	err := m.Add("", []byte(`# corpus exclusions
+vendor/
+broken_*.qasm
+!broken_but_kept.qasm
+/generated/**/*.qasm
+\#literal.qasm
+draft?.qasm
+[ab]_old.qasm
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("sub", []byte("!broken_sub.qasm\nlocal.qasm\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		dir  bool
+		want bool
+	}{
+		{"vendor", true, true},
+		{"vendor", false, false},
+		{"vendor/lib.qasm", false, true},
+		{"deep/vendor/lib.qasm", false, true},
+		{"broken_1.qasm", false, true},
+		{"deep/broken_1.qasm", false, true},
+		{"broken_but_kept.qasm", false, false},
+		{"generated/a.qasm", false, true},
+		{"generated/x/y/a.qasm", false, true},
+		{"other/generated/a.qasm", false, false},
+		{"#literal.qasm", false, true},
+		{"draft1.qasm", false, true},
+		{"draft10.qasm", false, false},
+		{"a_old.qasm", false, true},
+		{"c_old.qasm", false, false},
+		{"sub/broken_sub.qasm", false, false},
+		{"sub/local.qasm", false, true},
+		{"local.qasm", false, false},
+		{"good.qasm", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.path, tt.dir); got != tt.want {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		glob, want string
+	}{
+		{"*.qasm", `[^/]*\.qasm`},
+		{"**/a", `(?:.*/)?a`},
+		{"a/**", `a/.*`},
+		{"a/**/b", `a/(?:.*/)?b`},
+		{"a**b", `a[^/]*[^/]*b`},
+		{"[!x]", `[^x]`},
+	}
+	for _, tt := range tests {
+		got, err := Compile(tt.glob)
+		if err != nil || got != tt.want {
+			t.Errorf("Compile(%q) = %q, %v, want %q", tt.glob, got, err, tt.want)
+		}
+	}
+	for _, glob := range []string{"a\\", "[ab"} {
+		if _, err := Compile(glob); err == nil {
+			t.Errorf("Compile(%q) should fail", glob)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".qasmignore":             "vendor/\nbroken_*.qasm\n",
+		"a.qasm":                  "",
+		"broken_1.qasm":           "",
+		"notes.txt":               "",
+		"lib.inc":                 "",
+		"vendor/v.qasm":           "",
+		"sub/.qasmignore":         "!broken_2.qasm\nskip.qasm\n",
+		"sub/b.qasm":              "",
+		"sub/broken_2.qasm":       "",
+		"sub/skip.qasm":           "",
+		"sub/deeper/c.qasm":       "",
+		"sub/deeper/broken_3.qas": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rel := func(paths []string) string {
+		out := make([]string, len(paths))
+		for i, p := range paths {
+			r, err := filepath.Rel(dir, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out[i] = filepath.ToSlash(r)
+		}
+		return strings.Join(out, " ")
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		opts *Options
+		want string
+	}{
+		{"directory", []string{dir}, nil, "a.qasm sub/b.qasm sub/broken_2.qasm sub/deeper/c.qasm"},
+		{"extensions", []string{dir}, &Options{Extensions: []string{".inc"}}, "lib.inc"},
+		{"no ignore", []string{dir}, &Options{NoIgnore: true}, "a.qasm broken_1.qasm sub/b.qasm sub/broken_2.qasm sub/deeper/c.qasm sub/skip.qasm vendor/v.qasm"},
+		{"glob", []string{filepath.Join(dir, "**", "*.qasm")}, nil, "a.qasm sub/b.qasm sub/broken_2.qasm sub/deeper/c.qasm"},
+		{"glob in subdirectory", []string{filepath.Join(dir, "sub", "*.qasm")}, nil, "sub/b.qasm sub/broken_2.qasm"},
+		{"named file", []string{filepath.Join(dir, "broken_1.qasm"), dir}, nil, "broken_1.qasm a.qasm sub/b.qasm sub/broken_2.qasm sub/deeper/c.qasm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.args, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rel(got) != tt.want {
+				t.Errorf("Expand = %s, want %s", rel(got), tt.want)
+			}
+		})
+	}
+}
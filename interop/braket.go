@@ -0,0 +1,161 @@
+package interop
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Braket IR program schemas FromBraket reads
+const (
+	braketJAQCD    = "braket.ir.jaqcd.program"
+	braketOpenQASM = "braket.ir.openqasm.program"
+)
+
+// braketGates maps JAQCD gate types to the stdgates.inc gates they are.
+// Types not listed keep their names.
+var braketGates = map[string]string{
+	"i":           "id",
+	"cnot":        "cx",
+	"ccnot":       "ccx",
+	"si":          "sdg",
+	"ti":          "tdg",
+	"v":           "sx",
+	"phaseshift":  "p",
+	"cphaseshift": "cp",
+}
+
+// braketFields are the instruction fields the importer understands; an
+// instruction with any other, such as a noise channel's probability or a
+// unitary's matrix, cannot be imported
+var braketFields = map[string]bool{
+	"type": true, "target": true, "targets": true, "control": true, "controls": true, "angle": true,
+}
+
+type braketProgram struct {
+	Header struct {
+		Name string `json:"name"`
+	} `json:"braketSchemaHeader"`
+	Source                    string            `json:"source"`
+	Instructions              []json.RawMessage `json:"instructions"`
+	BasisRotationInstructions []json.RawMessage `json:"basis_rotation_instructions"`
+}
+
+type braketInstruction struct {
+	Type     string   `json:"type"`
+	Target   *int     `json:"target"`
+	Targets  []int    `json:"targets"`
+	Control  *int     `json:"control"`
+	Controls []int    `json:"controls"`
+	Angle    *float64 `json:"angle"`
+}
+
+// FromBraket imports an Amazon Braket IR program. An OpenQASM program is
+// parsed from its source. A JAQCD program becomes a qubit register q
+// sized by the highest qubit it uses, its instructions in order with
+// controls before targets, then its basis rotations and a measurement of
+// every qubit into a bit register c, as Braket samples them. Gates with a
+// counterpart in stdgates.inc take its name and the rest keep theirs; vi
+// becomes inv @ sx. Instructions that carry more than qubits and an
+// angle, such as unitary or noise channels, are reported as an
+// *InstructionError. Result types are not part of the program and are
+// ignored.
+func FromBraket(data []byte) (*parser.Program, error) {
+	var doc braketProgram
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("braket: %w", err)
+	}
+	switch doc.Header.Name {
+	case braketOpenQASM:
+		return parser.NewParser().ParseString(doc.Source)
+	case braketJAQCD, "":
+	default:
+		return nil, fmt.Errorf("braket: unsupported schema %s", doc.Header.Name)
+	}
+
+	var calls []*parser.GateCall
+	qubits := 0
+	for i, raw := range append(doc.Instructions, doc.BasisRotationInstructions...) {
+		call, highest, err := braketCall(i, raw)
+		if err != nil {
+			return nil, err
+		}
+		qubits = max(qubits, highest+1)
+		calls = append(calls, call)
+	}
+
+	version, include := header()
+	program := &parser.Program{Version: version, Statements: []parser.Statement{include}}
+	if qubits == 0 {
+		return program, nil
+	}
+	program.Statements = append(program.Statements, declareQubits("q", qubits), declareBits("c", qubits))
+	for _, call := range calls {
+		program.Statements = append(program.Statements, call)
+	}
+	program.Statements = append(program.Statements,
+		&parser.Measurement{Qubit: &parser.Identifier{Name: "q"}, Target: &parser.Identifier{Name: "c"}})
+	return program, nil
+}
+
+// braketCall converts the index'th JAQCD instruction, returning the
+// highest qubit it uses
+func braketCall(index int, raw json.RawMessage) (*parser.GateCall, int, error) {
+	var inst braketInstruction
+	if err := json.Unmarshal(raw, &inst); err != nil {
+		return nil, 0, fmt.Errorf("braket: instruction %d: %w", index, err)
+	}
+	fail := func(format string, args ...interface{}) error {
+		return &InstructionError{Instruction: index, Name: inst.Type, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, 0, fmt.Errorf("braket: instruction %d: %w", index, err)
+	}
+	var unknown []string
+	for field := range fields {
+		if !braketFields[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, 0, fail("field %s has no OpenQASM equivalent", unknown[0])
+	}
+
+	indices := append([]int{}, inst.Controls...)
+	if inst.Control != nil {
+		indices = append(indices, *inst.Control)
+	}
+	indices = append(indices, inst.Targets...)
+	if inst.Target != nil {
+		indices = append(indices, *inst.Target)
+	}
+	if len(indices) == 0 {
+		return nil, 0, fail("no qubits")
+	}
+
+	call := &parser.GateCall{Name: inst.Type}
+	if name, ok := braketGates[inst.Type]; ok {
+		call.Name = name
+	}
+	if inst.Type == "vi" {
+		call.Name = "sx"
+		call.Modifiers = []parser.Modifier{{Type: "inv"}}
+	}
+	highest := 0
+	for _, q := range indices {
+		highest = max(highest, q)
+		if q < 0 {
+			return nil, 0, fail("qubit %d is out of range", q)
+		}
+		call.Qubits = append(call.Qubits, element("q", q))
+	}
+	if inst.Angle != nil {
+		call.Parameters = []parser.Expression{float(*inst.Angle)}
+	}
+	return call, highest, nil
+}
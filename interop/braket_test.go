@@ -0,0 +1,75 @@
+package interop
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+func TestFromBraket(t *testing.T) {
+	doc := `{
+	  "braketSchemaHeader": {"name": "braket.ir.jaqcd.program", "version": "1"},
+	  "instructions": [
+	    {"type": "h", "target": 0},
+	    {"type": "cnot", "control": 0, "target": 1},
+	    {"type": "rx", "target": 2, "angle": 0.15},
+	    {"type": "ccnot", "controls": [0, 1], "target": 2},
+	    {"type": "vi", "target": 1},
+	    {"type": "xx", "targets": [0, 2], "angle": 1.5}
+	  ],
+	  "results": [{"type": "expectation", "observable": ["x"], "targets": [0]}],
+	  "basis_rotation_instructions": [{"type": "h", "target": 0}]
+	}`
+	program, err := FromBraket([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[3] q;
+bit[3] c;
+h q[0];
+cx q[0], q[1];
+rx(0.15) q[2];
+ccx q[0], q[1], q[2];
+inv @ sx q[1];
+xx(1.5) q[0], q[2];
+h q[0];
+measure q -> c;
+`
+	if got := printer.Print(program); got != want {
+		t.Errorf("FromBraket() =\n%s\nwant\n%s", got, want)
+	}
+	if errs := parser.Check(program); len(errs) > 0 {
+		t.Error(errs)
+	}
+}
+
+func TestFromBraketOpenQASM(t *testing.T) {
+	doc := `{
+	  "braketSchemaHeader": {"name": "braket.ir.openqasm.program", "version": "1"},
+	  "source": "OPENQASM 3.0;\nqubit[2] q;\nh q[0];\n"
+	}`
+	program, err := FromBraket([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(program.Statements) != 2 {
+		t.Errorf("got %d statements, want 2", len(program.Statements))
+	}
+}
+
+func TestFromBraketErrors(t *testing.T) {
+	_, err := FromBraket([]byte(`{"instructions": [{"type": "h", "target": 0},
+		{"type": "bit_flip", "target": 0, "probability": 0.1}]}`))
+	var instErr *InstructionError
+	if !errors.As(err, &instErr) || instErr.Instruction != 1 || instErr.Name != "bit_flip" {
+		t.Errorf("err = %v", err)
+	}
+
+	if _, err := FromBraket([]byte(`{"braketSchemaHeader": {"name": "braket.ir.ahs.program"}}`)); err == nil {
+		t.Error("unsupported schema accepted")
+	}
+}
@@ -0,0 +1,60 @@
+// Package interop imports circuits that Python SDKs export as JSON
+// rather than QASM text into the parser AST, so QASM tooling can process
+// them: Qiskit's Qobj (the output of assemble) and Amazon Braket's IR.
+//
+//	circuits, err := interop.FromQobj(data)
+//	program, err := interop.FromBraket(data)
+//
+// The programs built have no source positions; print them with the
+// printer package to get QASM text.
+package interop
+
+import (
+	"fmt"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// header returns the version header and standard include every imported
+// program starts with
+func header() (*parser.Version, parser.Statement) {
+	return &parser.Version{Number: "3.0"}, &parser.Include{Path: "stdgates.inc"}
+}
+
+// declareQubits declares a qubit register
+func declareQubits(name string, size int) parser.Statement {
+	return &parser.QuantumDeclaration{Type: "qubit", Identifier: name, Size: integer(size)}
+}
+
+// declareBits declares a bit register
+func declareBits(name string, size int) parser.Statement {
+	return &parser.ClassicalDeclaration{Type: "bit", Identifier: name, Size: integer(size)}
+}
+
+// element refers to one element of a register
+func element(register string, index int) parser.Expression {
+	return &parser.IndexedIdentifier{Name: register, Index: integer(index)}
+}
+
+func integer(v int) parser.Expression {
+	return &parser.IntegerLiteral{Value: int64(v)}
+}
+
+func float(v float64) parser.Expression {
+	return &parser.FloatLiteral{Value: v}
+}
+
+// InstructionError reports an instruction that cannot be imported
+type InstructionError struct {
+	// Circuit is the index of the circuit among those in the document
+	Circuit int
+
+	// Instruction is the index of the instruction in the circuit
+	Instruction int
+	Name        string
+	Reason      string
+}
+
+func (e *InstructionError) Error() string {
+	return fmt.Sprintf("circuit %d, instruction %d (%s): %s", e.Circuit, e.Instruction, e.Name, e.Reason)
+}
@@ -0,0 +1,255 @@
+package interop
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Circuit is one experiment of a Qobj
+type Circuit struct {
+	Name    string
+	Program *parser.Program
+}
+
+// qobj is the part of a QASM Qobj the importer reads
+type qobj struct {
+	Type        string `json:"type"`
+	Experiments []struct {
+		Header struct {
+			Name        string  `json:"name"`
+			QubitLabels []label `json:"qubit_labels"`
+			ClbitLabels []label `json:"clbit_labels"`
+			QregSizes   []label `json:"qreg_sizes"`
+			CregSizes   []label `json:"creg_sizes"`
+			NQubits     int     `json:"n_qubits"`
+			MemorySlots int     `json:"memory_slots"`
+		} `json:"header"`
+		Config struct {
+			NQubits     int `json:"n_qubits"`
+			MemorySlots int `json:"memory_slots"`
+		} `json:"config"`
+		Instructions []qobjInstruction `json:"instructions"`
+	} `json:"experiments"`
+	Config struct {
+		NQubits     int `json:"n_qubits"`
+		MemorySlots int `json:"memory_slots"`
+	} `json:"config"`
+}
+
+// label is a [name, number] pair naming a register element or size
+type label struct {
+	Name   string
+	Number int
+}
+
+func (l *label) UnmarshalJSON(data []byte) error {
+	var pair []interface{}
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("label %s is not a [name, number] pair", data)
+	}
+	name, ok1 := pair[0].(string)
+	number, ok2 := pair[1].(float64)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("label %s is not a [name, number] pair", data)
+	}
+	l.Name, l.Number = name, int(number)
+	return nil
+}
+
+type qobjInstruction struct {
+	Name        string            `json:"name"`
+	Qubits      []int             `json:"qubits"`
+	Params      []json.RawMessage `json:"params"`
+	Memory      []int             `json:"memory"`
+	Conditional json.RawMessage   `json:"conditional"`
+}
+
+// FromQobj imports the experiments of a Qiskit QASM Qobj, in order.
+// Registers are declared as the experiment headers name them, falling
+// back to a qubit register q and a bit register c sized by the
+// configuration. Gates keep their Qiskit names, which for the standard
+// gates are those of stdgates.inc; measure, reset and barrier become the
+// corresponding statements. Parameters are numbers or expressions
+// written as strings. Classically conditioned instructions and
+// instructions with matrix parameters, such as unitary, cannot be
+// expressed and are reported as an *InstructionError.
+func FromQobj(data []byte) ([]Circuit, error) {
+	var doc qobj
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("qobj: %w", err)
+	}
+	if doc.Type != "" && doc.Type != "QASM" {
+		return nil, fmt.Errorf("qobj: %s Qobj cannot be imported, only QASM", doc.Type)
+	}
+	circuits := make([]Circuit, 0, len(doc.Experiments))
+	for i, exp := range doc.Experiments {
+		im := &qobjImporter{circuit: i}
+		im.qubits = registers(exp.Header.QubitLabels, exp.Header.QregSizes, "q",
+			firstPositive(exp.Header.NQubits, exp.Config.NQubits, doc.Config.NQubits, maxIndex(exp.Instructions, false)+1))
+		im.clbits = registers(exp.Header.ClbitLabels, exp.Header.CregSizes, "c",
+			firstPositive(exp.Header.MemorySlots, exp.Config.MemorySlots, doc.Config.MemorySlots, maxIndex(exp.Instructions, true)+1))
+
+		version, include := header()
+		program := &parser.Program{Version: version, Statements: []parser.Statement{include}}
+		for _, r := range im.qubits.order {
+			program.Statements = append(program.Statements, declareQubits(r, im.qubits.sizes[r]))
+		}
+		for _, r := range im.clbits.order {
+			program.Statements = append(program.Statements, declareBits(r, im.clbits.sizes[r]))
+		}
+		for j, inst := range exp.Instructions {
+			stmt, err := im.instruction(j, inst)
+			if err != nil {
+				return nil, err
+			}
+			program.Statements = append(program.Statements, stmt)
+		}
+		circuits = append(circuits, Circuit{Name: exp.Header.Name, Program: program})
+	}
+	return circuits, nil
+}
+
+// registerSet maps global qubit or clbit indices to register elements
+type registerSet struct {
+	order    []string
+	sizes    map[string]int
+	elements []label
+}
+
+// registers builds the registers of an experiment from its labels, or a
+// single register named fallback of size n if it has none
+func registers(labels, sizes []label, fallback string, n int) registerSet {
+	set := registerSet{sizes: make(map[string]int)}
+	if len(labels) == 0 {
+		if n <= 0 {
+			return set
+		}
+		set.order = []string{fallback}
+		set.sizes[fallback] = n
+		for i := range n {
+			set.elements = append(set.elements, label{fallback, i})
+		}
+		return set
+	}
+	for _, s := range sizes {
+		set.order = append(set.order, s.Name)
+		set.sizes[s.Name] = s.Number
+	}
+	for _, l := range labels {
+		if _, ok := set.sizes[l.Name]; !ok {
+			set.order = append(set.order, l.Name)
+		}
+		set.sizes[l.Name] = max(set.sizes[l.Name], l.Number+1)
+		set.elements = append(set.elements, l)
+	}
+	return set
+}
+
+// element returns the register element at a global index
+func (s registerSet) element(index int) (parser.Expression, bool) {
+	if index < 0 || index >= len(s.elements) {
+		return nil, false
+	}
+	return element(s.elements[index].Name, s.elements[index].Number), true
+}
+
+type qobjImporter struct {
+	circuit        int
+	qubits, clbits registerSet
+}
+
+func (im *qobjImporter) instruction(index int, inst qobjInstruction) (parser.Statement, error) {
+	fail := func(format string, args ...interface{}) error {
+		return &InstructionError{Circuit: im.circuit, Instruction: index, Name: inst.Name, Reason: fmt.Sprintf(format, args...)}
+	}
+	if len(inst.Conditional) > 0 && string(inst.Conditional) != "null" {
+		return nil, fail("classically conditioned instructions are not supported")
+	}
+	qubits := make([]parser.Expression, len(inst.Qubits))
+	for i, q := range inst.Qubits {
+		e, ok := im.qubits.element(q)
+		if !ok {
+			return nil, fail("qubit %d is out of range", q)
+		}
+		qubits[i] = e
+	}
+
+	switch inst.Name {
+	case "measure":
+		if len(qubits) != 1 || len(inst.Memory) != 1 {
+			return nil, fail("measure needs one qubit and one memory slot")
+		}
+		target, ok := im.clbits.element(inst.Memory[0])
+		if !ok {
+			return nil, fail("memory slot %d is out of range", inst.Memory[0])
+		}
+		return &parser.Measurement{Qubit: qubits[0], Target: target}, nil
+	case "reset":
+		if len(qubits) != 1 {
+			return nil, fail("reset needs one qubit")
+		}
+		return &parser.Reset{Qubit: qubits[0]}, nil
+	case "barrier":
+		return &parser.Barrier{Qubits: qubits}, nil
+	case "bfunc", "snapshot", "save_statevector", "initialize":
+		return nil, fail("%s has no OpenQASM equivalent", inst.Name)
+	}
+
+	call := &parser.GateCall{Name: inst.Name, Qubits: qubits}
+	for _, raw := range inst.Params {
+		param, err := parameter(raw)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		call.Parameters = append(call.Parameters, param)
+	}
+	return call, nil
+}
+
+// parameter converts a Qobj gate parameter, a number or an expression
+// written as a string
+func parameter(raw json.RawMessage) (parser.Expression, error) {
+	var v float64
+	if err := json.Unmarshal(raw, &v); err == nil {
+		return float(v), nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		expr, err := parser.ParseExpression(s)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %w", s, err)
+		}
+		return expr, nil
+	}
+	return nil, fmt.Errorf("parameter %s is not a number or expression", raw)
+}
+
+// maxIndex returns the highest qubit, or memory slot, the instructions
+// use, or -1 if they use none
+func maxIndex(instructions []qobjInstruction, memory bool) int {
+	highest := -1
+	for _, inst := range instructions {
+		indices := inst.Qubits
+		if memory {
+			indices = inst.Memory
+		}
+		for _, i := range indices {
+			highest = max(highest, i)
+		}
+	}
+	return highest
+}
+
+func firstPositive(values ...int) int {
+	for _, v := range values {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+package interop
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+const bell = `{
+  "qobj_id": "bell",
+  "type": "QASM",
+  "schema_version": "1.3.0",
+  "experiments": [{
+    "header": {
+      "name": "bell",
+      "qubit_labels": [["qr", 0], ["qr", 1], ["anc", 0]],
+      "qreg_sizes": [["qr", 2], ["anc", 1]],
+      "clbit_labels": [["cr", 0], ["cr", 1]],
+      "creg_sizes": [["cr", 2]],
+      "n_qubits": 3,
+      "memory_slots": 2
+    },
+    "config": {"n_qubits": 3, "memory_slots": 2},
+    "instructions": [
+      {"name": "reset", "qubits": [2]},
+      {"name": "h", "qubits": [0]},
+      {"name": "cx", "qubits": [0, 1]},
+      {"name": "u3", "params": [0.5, -0.25, "theta / 2"], "qubits": [2]},
+      {"name": "barrier", "qubits": [0, 1, 2]},
+      {"name": "measure", "qubits": [0], "memory": [0]},
+      {"name": "measure", "qubits": [1], "memory": [1]}
+    ]
+  }, {
+    "header": {},
+    "instructions": [
+      {"name": "x", "qubits": [1]},
+      {"name": "measure", "qubits": [1], "memory": [0]}
+    ]
+  }]
+}`
+
+func TestFromQobj(t *testing.T) {
+	circuits, err := FromQobj([]byte(bell))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(circuits) != 2 || circuits[0].Name != "bell" {
+		t.Fatalf("circuits = %+v", circuits)
+	}
+
+	want := `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] qr;
+qubit[1] anc;
+bit[2] cr;
+reset anc[0];
+h qr[0];
+cx qr[0], qr[1];
+u3(0.5, -0.25, theta / 2) anc[0];
+barrier qr[0], qr[1], anc[0];
+measure qr[0] -> cr[0];
+measure qr[1] -> cr[1];
+`
+	if got := printer.Print(circuits[0].Program); got != want {
+		t.Errorf("first circuit:\n%s\nwant\n%s", got, want)
+	}
+
+	// Without labels the registers are sized by the instructions
+	want = `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+bit[1] c;
+x q[1];
+measure q[1] -> c[0];
+`
+	if got := printer.Print(circuits[1].Program); got != want {
+		t.Errorf("second circuit:\n%s\nwant\n%s", got, want)
+	}
+	for _, c := range circuits {
+		if errs := parser.Check(c.Program); len(errs) > 0 {
+			t.Errorf("%s: %v", c.Name, errs)
+		}
+	}
+}
+
+func TestFromQobjErrors(t *testing.T) {
+	tests := []struct {
+		name, doc, want string
+	}{
+		{"pulse", `{"type": "PULSE", "experiments": []}`, "only QASM"},
+		{"conditional", `{"experiments": [{"instructions": [
+			{"name": "x", "qubits": [0], "conditional": 0}]}]}`, "classically conditioned"},
+		{"unitary", `{"experiments": [{"instructions": [
+			{"name": "unitary", "qubits": [0], "params": [[[1, 0], [0, 1]]]}]}]}`, "not a number or expression"},
+		{"qubit", `{"experiments": [{"header": {"qubit_labels": [["q", 0]], "qreg_sizes": [["q", 1]]},
+			"instructions": [{"name": "x", "qubits": [3]}]}]}`, "qubit 3 is out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromQobj([]byte(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+
+	_, err := FromQobj([]byte(`{"experiments": [{}, {"instructions": [{"name": "snapshot", "qubits": [0]}]}]}`))
+	var instErr *InstructionError
+	if !errors.As(err, &instErr) || instErr.Circuit != 1 || instErr.Instruction != 0 {
+		t.Errorf("err = %#v", err)
+	}
+}
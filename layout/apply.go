@@ -0,0 +1,414 @@
+package layout
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Apply rewrites program onto the device qubits of l: operands such as
+// q[1] become hardware qubits such as $4, the declarations of the
+// program's qubits are removed, and operations on whole registers or
+// ranges are split into one operation per qubit, since hardware qubits
+// do not form registers. Every qubit the program declares must be in l.
+//
+// Indices must be literals. On error, such as an operand indexed by a
+// loop variable, program is left unchanged. Gate and subroutine bodies
+// only use their parameters and are kept as they are.
+func Apply(program *parser.Program, l Layout) error {
+	a := &applier{layout: l, sizes: make(map[string]int)}
+	for _, r := range registers(program) {
+		a.sizes[r.name] = r.size
+		for _, key := range r.keys() {
+			if _, ok := l[key]; !ok {
+				return fmt.Errorf("qubit %s is not in the layout", key)
+			}
+		}
+	}
+	statements, err := a.statements(program.Statements)
+	if err != nil {
+		return err
+	}
+	program.Statements = statements
+	return nil
+}
+
+type applier struct {
+	layout Layout
+
+	// sizes maps each quantum register to its size, 0 for a single qubit
+	sizes map[string]int
+}
+
+func (a *applier) statements(statements []parser.Statement) ([]parser.Statement, error) {
+	out := make([]parser.Statement, 0, len(statements))
+	for _, stmt := range statements {
+		rewritten, err := a.statement(stmt)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rewritten...)
+	}
+	return out, nil
+}
+
+// statement returns the statements replacing stmt
+func (a *applier) statement(stmt parser.Statement) ([]parser.Statement, error) {
+	switch s := stmt.(type) {
+	case *parser.QuantumDeclaration:
+		return nil, nil
+	case *parser.GateCall:
+		operands := make([][]parser.Expression, len(s.Qubits))
+		for i, op := range s.Qubits {
+			qubits, err := a.resolve(op)
+			if err != nil {
+				return nil, err
+			}
+			operands[i] = qubits
+		}
+		var out []parser.Statement
+		for _, qubits := range broadcast(operands) {
+			call := *s
+			call.Qubits = qubits
+			out = append(out, &call)
+		}
+		return out, nil
+	case *parser.Barrier:
+		barrier := *s
+		barrier.Qubits = nil
+		for _, op := range s.Qubits {
+			qubits, err := a.resolve(op)
+			if err != nil {
+				return nil, err
+			}
+			barrier.Qubits = append(barrier.Qubits, qubits...)
+		}
+		return []parser.Statement{&barrier}, nil
+	case *parser.Reset:
+		qubits, err := a.resolve(s.Qubit)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]parser.Statement, len(qubits))
+		for i, q := range qubits {
+			reset := *s
+			reset.Qubit = q
+			out[i] = &reset
+		}
+		return out, nil
+	case *parser.Measurement:
+		qubits, err := a.resolve(s.Qubit)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]parser.Statement, len(qubits))
+		for i, q := range qubits {
+			m := *s
+			m.Qubit = q
+			if s.Target != nil && len(qubits) > 1 {
+				if m.Target, err = element(s.Target, i); err != nil {
+					return nil, err
+				}
+			}
+			out[i] = &m
+		}
+		return out, nil
+	case *parser.ClassicalDeclaration:
+		measure, ok := s.Initializer.(*parser.MeasureExpression)
+		if !ok {
+			return []parser.Statement{s}, nil
+		}
+		qubits, err := a.resolve(measure.Qubit)
+		if err != nil {
+			return nil, err
+		}
+		decl := *s
+		if len(qubits) == 1 {
+			m := *measure
+			m.Qubit = qubits[0]
+			decl.Initializer = &m
+			return []parser.Statement{&decl}, nil
+		}
+		// A register measured at its declaration is declared first and
+		// measured a qubit at a time
+		decl.Initializer = nil
+		out := []parser.Statement{&decl}
+		for i, q := range qubits {
+			out = append(out, &parser.Measurement{BaseNode: s.BaseNode, Qubit: q, Target: &parser.IndexedIdentifier{
+				Name: s.Identifier, Index: &parser.IntegerLiteral{Value: int64(i)},
+			}})
+		}
+		return out, nil
+	case *parser.IfStatement:
+		branch := *s
+		var err error
+		if branch.ThenBody, err = a.statements(s.ThenBody); err != nil {
+			return nil, err
+		}
+		if branch.ElseBody, err = a.statements(s.ElseBody); err != nil {
+			return nil, err
+		}
+		return []parser.Statement{&branch}, nil
+	case *parser.ForStatement:
+		loop := *s
+		var err error
+		if loop.Body, err = a.statements(s.Body); err != nil {
+			return nil, err
+		}
+		return []parser.Statement{&loop}, nil
+	case *parser.WhileStatement:
+		loop := *s
+		var err error
+		if loop.Body, err = a.statements(s.Body); err != nil {
+			return nil, err
+		}
+		return []parser.Statement{&loop}, nil
+	}
+	return []parser.Statement{stmt}, nil
+}
+
+// resolve returns the hardware qubits an operand stands for
+func (a *applier) resolve(op parser.Expression) ([]parser.Expression, error) {
+	var keys []string
+	switch e := op.(type) {
+	case *parser.Identifier:
+		if strings.HasPrefix(e.Name, "$") {
+			return []parser.Expression{e}, nil
+		}
+		size, ok := a.sizes[e.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is not a declared qubit", position(op), e.Name)
+		}
+		keys = register{name: e.Name, size: size}.keys()
+	case *parser.IndexedIdentifier:
+		size, ok := a.sizes[e.Name]
+		index, isLit := literal(e.Index, size)
+		if !ok || !isLit {
+			return nil, fmt.Errorf("%s: %s has no literal index into a declared register", position(op), e.Name)
+		}
+		keys = []string{key(e.Name, index)}
+	case *parser.RangedIdentifier:
+		size, ok := a.sizes[e.Name]
+		start, end := 0, size-1
+		var startOK, endOK = true, true
+		if e.Start != nil {
+			start, startOK = literal(e.Start, size)
+		}
+		if e.EndIndex != nil {
+			end, endOK = literal(e.EndIndex, size)
+		}
+		if !ok || !startOK || !endOK {
+			return nil, fmt.Errorf("%s: %s has no literal range into a declared register", position(op), e.Name)
+		}
+		for i := start; i <= end; i++ {
+			keys = append(keys, key(e.Name, i))
+		}
+	default:
+		return nil, fmt.Errorf("%s: operand is not a qubit", position(op))
+	}
+
+	qubits := make([]parser.Expression, len(keys))
+	for i, k := range keys {
+		device, ok := a.layout[k]
+		if !ok {
+			return nil, fmt.Errorf("%s: qubit %s is not in the layout", position(op), k)
+		}
+		qubits[i] = hardware(device)
+	}
+	return qubits, nil
+}
+
+// broadcast pairs operands standing for several qubits element by
+// element, as a gate applied to registers applies to each index
+func broadcast(operands [][]parser.Expression) [][]parser.Expression {
+	n := 1
+	for _, qs := range operands {
+		n = max(n, len(qs))
+	}
+	calls := make([][]parser.Expression, n)
+	for i := range calls {
+		calls[i] = make([]parser.Expression, len(operands))
+		for j, qs := range operands {
+			calls[i][j] = qs[min(i, len(qs)-1)]
+		}
+	}
+	return calls
+}
+
+// element returns element i of the bits a measurement target stands for
+func element(target parser.Expression, i int) (parser.Expression, error) {
+	switch e := target.(type) {
+	case *parser.Identifier:
+		return &parser.IndexedIdentifier{Name: e.Name, Index: &parser.IntegerLiteral{Value: int64(i)}}, nil
+	case *parser.RangedIdentifier:
+		start := 0
+		if e.Start != nil {
+			lit, ok := e.Start.(*parser.IntegerLiteral)
+			if !ok {
+				break
+			}
+			start = int(lit.Value)
+		}
+		return &parser.IndexedIdentifier{Name: e.Name, Index: &parser.IntegerLiteral{Value: int64(start + i)}}, nil
+	}
+	return nil, fmt.Errorf("%s: measurement of several qubits into a single bit", position(target))
+}
+
+// literal returns the value of a literal index into a register of size
+// elements, counting negative indices from its end
+func literal(index parser.Expression, size int) (int, bool) {
+	var v int64
+	switch e := index.(type) {
+	case *parser.IntegerLiteral:
+		v = e.Value
+	case *parser.UnaryExpression:
+		lit, ok := e.Operand.(*parser.IntegerLiteral)
+		if !ok || e.Operator != "-" {
+			return 0, false
+		}
+		v = -lit.Value
+	default:
+		return 0, false
+	}
+	if v < 0 {
+		v += int64(size)
+	}
+	return int(v), v >= 0 && v < int64(size)
+}
+
+func hardware(device int) parser.Expression {
+	return &parser.Identifier{Name: "$" + strconv.Itoa(device)}
+}
+
+func position(node parser.Node) string {
+	return fmt.Sprintf("%d:%d", node.Pos().Line, node.Pos().Column)
+}
+
+// Invert rewrites the hardware qubits of program back to the program
+// qubits l places on them, the inverse of Apply, and declares the
+// registers they belong to after the program's includes, unless it
+// declares them already. Every hardware qubit the program uses must be
+// in l; if one is not, program is left unchanged. The operations Apply
+// split are not merged back. Calibrations are for device qubits and keep
+// them.
+func Invert(program *parser.Program, l Layout) error {
+	inv := &inverter{inverse: l.Inverse()}
+	v := parser.NewDepthFirstVisitor(inv)
+	parser.Walk(v, program)
+	if inv.err != nil {
+		return inv.err
+	}
+	inv.apply = true
+	parser.Walk(v, program)
+
+	declared := make(map[string]bool)
+	for _, r := range registers(program) {
+		declared[r.name] = true
+	}
+	sizes := make(map[string]int)
+	for k := range l {
+		name, index, _ := splitKey(k)
+		sizes[name] = max(sizes[name], index+1)
+	}
+	var decls []parser.Statement
+	for _, name := range l.registerNames() {
+		if declared[name] {
+			continue
+		}
+		decl := &parser.QuantumDeclaration{Type: "qubit", Identifier: name}
+		if sizes[name] > 0 {
+			decl.Size = &parser.IntegerLiteral{Value: int64(sizes[name])}
+		}
+		decls = append(decls, decl)
+	}
+	i := 0
+	for i < len(program.Statements) {
+		if _, ok := program.Statements[i].(*parser.Include); !ok {
+			break
+		}
+		i++
+	}
+	program.Statements = slices.Insert(program.Statements, i, decls...)
+	return nil
+}
+
+// registerNames returns the registers of the program qubits of l, sorted
+func (l Layout) registerNames() []string {
+	var names []string
+	for _, k := range l.keys() {
+		name, _, _ := splitKey(k)
+		if len(names) == 0 || names[len(names)-1] != name {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// inverter checks, then with apply set rewrites, the hardware qubit
+// operands of a program
+type inverter struct {
+	parser.BaseVisitor
+	inverse map[int]string
+	apply   bool
+	err     error
+}
+
+func (v *inverter) operand(op *parser.Expression) {
+	id, ok := (*op).(*parser.Identifier)
+	if !ok {
+		return
+	}
+	n, ok := strings.CutPrefix(id.Name, "$")
+	if !ok {
+		return
+	}
+	device, err := strconv.Atoi(n)
+	k, mapped := v.inverse[device]
+	if err != nil || !mapped {
+		if v.err == nil {
+			v.err = fmt.Errorf("%s: hardware qubit %s is not in the layout", position(id), id.Name)
+		}
+		return
+	}
+	if !v.apply {
+		return
+	}
+	name, index, _ := splitKey(k)
+	if index < 0 {
+		*op = &parser.Identifier{BaseNode: id.BaseNode, Name: name}
+		return
+	}
+	*op = &parser.IndexedIdentifier{BaseNode: id.BaseNode, Name: name, Index: &parser.IntegerLiteral{Value: int64(index)}}
+}
+
+func (v *inverter) VisitGateCall(node *parser.GateCall) interface{} {
+	for i := range node.Qubits {
+		v.operand(&node.Qubits[i])
+	}
+	return nil
+}
+
+func (v *inverter) VisitBarrier(node *parser.Barrier) interface{} {
+	for i := range node.Qubits {
+		v.operand(&node.Qubits[i])
+	}
+	return nil
+}
+
+func (v *inverter) VisitReset(node *parser.Reset) interface{} {
+	v.operand(&node.Qubit)
+	return nil
+}
+
+func (v *inverter) VisitMeasurement(node *parser.Measurement) interface{} {
+	v.operand(&node.Qubit)
+	return nil
+}
+
+func (v *inverter) VisitMeasureExpression(node *parser.MeasureExpression) interface{} {
+	v.operand(&node.Qubit)
+	return nil
+}
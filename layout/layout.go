@@ -0,0 +1,166 @@
+// Package layout maps the qubits a program declares onto the qubits of a
+// device. A Layout is what a placement or routing step decides and what
+// a backend needs to run the program as written; Apply rewrites a
+// program onto the device qubits of a layout and Invert turns it back.
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Layout maps each program qubit, named q[i] for an element of register q
+// or q for a single qubit, to a device qubit. It is stored as a JSON
+// object:
+//
+//	{"q[0]": 3, "q[1]": 0, "anc": 5}
+type Layout map[string]int
+
+// Load reads a layout file
+func Load(path string) (Layout, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Read reads a layout and checks it with Validate
+func Read(r io.Reader) (Layout, error) {
+	var l Layout
+	if err := json.NewDecoder(r).Decode(&l); err != nil {
+		return nil, err
+	}
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write writes l as indented JSON, program qubits in sorted order
+func Write(w io.Writer, l Layout) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// Validate checks that every program qubit is a well formed name and
+// that no two share a device qubit
+func (l Layout) Validate() error {
+	used := make(map[int]string, len(l))
+	for _, key := range l.keys() {
+		if _, _, err := splitKey(key); err != nil {
+			return err
+		}
+		device := l[key]
+		if device < 0 {
+			return fmt.Errorf("%s: device qubit %d is negative", key, device)
+		}
+		if other, ok := used[device]; ok {
+			return fmt.Errorf("%s and %s are both on device qubit %d", other, key, device)
+		}
+		used[device] = key
+	}
+	return nil
+}
+
+// Inverse maps each device qubit of l back to its program qubit
+func (l Layout) Inverse() map[int]string {
+	inverse := make(map[int]string, len(l))
+	for key, device := range l {
+		inverse[device] = key
+	}
+	return inverse
+}
+
+func (l Layout) keys() []string {
+	keys := make([]string, 0, len(l))
+	for key := range l {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Trivial lays the qubits of program out on device qubits in declaration
+// order, which is how estimate places a program without hardware qubits
+func Trivial(program *parser.Program) Layout {
+	l := make(Layout)
+	for _, r := range registers(program) {
+		for _, key := range r.keys() {
+			l[key] = len(l)
+		}
+	}
+	return l
+}
+
+// register is a quantum register a program declares; size is 0 for a
+// single qubit
+type register struct {
+	name string
+	size int
+}
+
+func (r register) keys() []string {
+	if r.size == 0 {
+		return []string{r.name}
+	}
+	keys := make([]string, r.size)
+	for i := range keys {
+		keys[i] = key(r.name, i)
+	}
+	return keys
+}
+
+// registers returns the quantum registers program declares at the top
+// level, in declaration order. Registers whose size is not a literal are
+// taken to be single qubits.
+func registers(program *parser.Program) []register {
+	var regs []register
+	for _, stmt := range program.Statements {
+		decl, ok := stmt.(*parser.QuantumDeclaration)
+		if !ok {
+			continue
+		}
+		r := register{name: decl.Identifier}
+		if lit, ok := decl.Size.(*parser.IntegerLiteral); ok {
+			r.size = int(lit.Value)
+		}
+		regs = append(regs, r)
+	}
+	return regs
+}
+
+func key(name string, index int) string {
+	return name + "[" + strconv.Itoa(index) + "]"
+}
+
+// splitKey splits a program qubit into its register and index, -1 for a
+// single qubit
+func splitKey(key string) (string, int, error) {
+	name, rest, indexed := strings.Cut(key, "[")
+	if !parser.IsValidIdentifier(name) {
+		return "", 0, fmt.Errorf("%q is not a program qubit", key)
+	}
+	if !indexed {
+		return name, -1, nil
+	}
+	digits, ok := strings.CutSuffix(rest, "]")
+	index, err := strconv.Atoi(digits)
+	if !ok || err != nil || index < 0 {
+		return "", 0, fmt.Errorf("%q is not a program qubit", key)
+	}
+	return name, index, nil
+}
@@ -0,0 +1,142 @@
+package layout
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+func parse(t *testing.T, src string) *parser.Program {
+	t.Helper()
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+func TestReadWrite(t *testing.T) {
+	l, err := Read(strings.NewReader(`{"q[1]": 0, "q[0]": 3, "anc": 5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, l); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"anc\": 5,\n  \"q[0]\": 3,\n  \"q[1]\": 0\n}\n"; buf.String() != want {
+		t.Errorf("Write() = %s", buf.String())
+	}
+	if inv := l.Inverse(); inv[3] != "q[0]" || inv[5] != "anc" {
+		t.Errorf("Inverse() = %v", inv)
+	}
+
+	for src, want := range map[string]string{
+		`{"q[0]": 1, "r": 1}`: "q[0] and r are both on device qubit 1",
+		`{"q[0]": -1}`:        "q[0]: device qubit -1 is negative",
+		`{"q[x]": 0}`:         `"q[x]" is not a program qubit`,
+		`{"1q": 0}`:           `"1q" is not a program qubit`,
+	} {
+		if _, err := Read(strings.NewReader(src)); err == nil || err.Error() != want {
+			t.Errorf("Read(%s) = %v, want %s", src, err, want)
+		}
+	}
+}
+
+func TestTrivial(t *testing.T) {
+	l := Trivial(parse(t, "OPENQASM 3.0;\nqubit[2] q;\nqubit anc;\n"))
+	if len(l) != 3 || l["q[0]"] != 0 || l["q[1]"] != 1 || l["anc"] != 2 {
+		t.Errorf("Trivial() = %v", l)
+	}
+}
+
+func TestApplyInvert(t *testing.T) {
+	src := `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[3] q;
+qubit anc;
+bit[3] c;
+h q;
+cx q[0], anc;
+barrier q[1:2], anc;
+if (c[0] == 1) { reset q[-1]; }
+measure q -> c;
+bit b = measure anc;
+`
+	l := Layout{"q[0]": 4, "q[1]": 2, "q[2]": 0, "anc": 1}
+	program := parse(t, src)
+	if err := Apply(program, l); err != nil {
+		t.Fatal(err)
+	}
+	applied := `OPENQASM 3.0;
+include "stdgates.inc";
+bit[3] c;
+h $4;
+h $2;
+h $0;
+cx $4, $1;
+barrier $2, $0, $1;
+if (c[0] == 1) {
+  reset $0;
+}
+measure $4 -> c[0];
+measure $2 -> c[1];
+measure $0 -> c[2];
+bit b = measure $1;
+`
+	if got := printer.Print(program); got != applied {
+		t.Errorf("Apply() =\n%s\nwant\n%s", got, applied)
+	}
+
+	if err := Invert(program, l); err != nil {
+		t.Fatal(err)
+	}
+	inverted := `OPENQASM 3.0;
+include "stdgates.inc";
+qubit anc;
+qubit[3] q;
+bit[3] c;
+h q[0];
+h q[1];
+h q[2];
+cx q[0], anc;
+barrier q[1], q[2], anc;
+if (c[0] == 1) {
+  reset q[2];
+}
+measure q[0] -> c[0];
+measure q[1] -> c[1];
+measure q[2] -> c[2];
+bit b = measure anc;
+`
+	if got := printer.Print(program); got != inverted {
+		t.Errorf("Invert() =\n%s\nwant\n%s", got, inverted)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		"OPENQASM 3.0;\nqubit[2] q;\nx q[0];\n":                        "qubit q[1] is not in the layout",
+		"OPENQASM 3.0;\nqubit[1] q;\nfor int i in [0:0] { x q[i]; }\n": "3:24: q has no literal index into a declared register",
+	} {
+		program := parse(t, src)
+		err := Apply(program, Layout{"q[0]": 0})
+		if err == nil || err.Error() != want {
+			t.Errorf("Apply() = %v, want %s", err, want)
+		}
+		if printer.Print(program) != printer.Print(parse(t, src)) {
+			t.Error("failed Apply() changed the program")
+		}
+	}
+
+	program := parse(t, "OPENQASM 3.0;\nx $0;\ncx $0, $7;\n")
+	if err := Invert(program, Layout{"q[0]": 0}); err == nil || err.Error() != "3:8: hardware qubit $7 is not in the layout" {
+		t.Errorf("Invert() = %v", err)
+	}
+	if got := printer.Print(program); got != "OPENQASM 3.0;\nx $0;\ncx $0, $7;\n" {
+		t.Errorf("failed Invert() changed the program:\n%s", got)
+	}
+}
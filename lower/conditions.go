@@ -0,0 +1,590 @@
+// Package lower rewrites programs into the restricted forms hardware
+// targets accept. It is experimental: the passes, and the Target they
+// are given, may change as more backends are modeled.
+package lower
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/orangekame3/qasmparser/message"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// Target describes what a backend can branch on. The zero Target is the
+// most restrictive: it compares one bit with 0 or 1, has no else
+// branches and no scratch bits to compute conditions in.
+type Target struct {
+	// Name identifies the target in diagnostics
+	Name string
+
+	// Else permits else branches. Without them an else branch becomes a
+	// second if on the opposite comparison.
+	Else bool
+
+	// RegisterComparison permits comparing a whole bit register with an
+	// integer, as in if (c == 5). Without it the comparison is spelled
+	// out bit by bit, which needs the size of the register.
+	RegisterComparison bool
+
+	// ScratchBits is the number of scratch bits the pass may declare,
+	// negative for no limit. Scratch bits are set inside conditionals,
+	// so a target that cannot assign classical bits at run time has none.
+	ScratchBits int
+}
+
+func (t Target) String() string {
+	if t.Name == "" {
+		return "the target"
+	}
+	return t.Name
+}
+
+// Conditions lowers the conditions of the if statements of program into
+// comparisons of a single bit with 0 or 1 and returns the lowered copy;
+// program itself is not modified. A conjunction without an else branch
+// becomes nested comparisons:
+//
+//	if (c[0] && !c[2]) { x q; }
+//
+//	if (c[0] == 1) { if (c[2] == 0) { x q; } }
+//
+// Any other condition is evaluated into scratch bits first, one for each
+// && or || it contains. They are declared as one register at the start of
+// the program, or of the subroutine that needs them:
+//
+//	bit[1] scratch;
+//	scratch[0] = 0;
+//	if (c[0] == 1) { scratch[0] = 1; }
+//	if (c[2] == 0) { scratch[0] = 1; }
+//	if (scratch[0] == 1) { x q; } else { z q; }
+//
+// Conditions that read anything other than bits and bit registers
+// compared with integers, such as integer variables or function calls,
+// cannot be lowered, and neither can conditions that need more scratch
+// bits than target has left. Each is reported as an error and its if
+// statement is kept as written. While loop conditions are not lowered.
+func Conditions(program *parser.Program, target Target) (*parser.Program, []parser.ParseError) {
+	l := &lowerer{target: target, bits: make(map[string]int)}
+	seen := &names{bits: l.bits, seen: make(map[string]bool)}
+	parser.Walk(parser.NewDepthFirstVisitor(seen), program)
+	l.scratch = "scratch"
+	for i := 1; seen.seen[l.scratch]; i++ {
+		l.scratch = "scratch_" + strconv.Itoa(i)
+	}
+
+	lowered := *program
+	lowered.Statements = l.scope(program.Statements)
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		return l.diagnostics[i].Position.Offset < l.diagnostics[j].Position.Offset
+	})
+	return &lowered, l.diagnostics
+}
+
+type lowerer struct {
+	target Target
+
+	// bits maps each bit register to its size, 0 for a single bit and -1
+	// for a register whose size is not a literal
+	bits map[string]int
+
+	// scratch names the scratch registers; used counts the scratch bits
+	// declared in the whole program
+	scratch string
+	used    int
+
+	diagnostics []parser.ParseError
+}
+
+// scope lowers the statements of a program or subroutine body and
+// declares the scratch bits they use after its includes
+func (l *lowerer) scope(statements []parser.Statement) []parser.Statement {
+	sc := &scope{register: l.scratch}
+	body := l.block(statements, sc)
+	if sc.size == 0 {
+		return body
+	}
+	i := 0
+	for i < len(body) {
+		if _, ok := body[i].(*parser.Include); !ok {
+			break
+		}
+		i++
+	}
+	decl := &parser.ClassicalDeclaration{Type: "bit", Size: integer(int64(sc.size)), Identifier: sc.register}
+	return slices.Insert(body, i, parser.Statement(decl))
+}
+
+func (l *lowerer) block(statements []parser.Statement, sc *scope) []parser.Statement {
+	out := make([]parser.Statement, 0, len(statements))
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.IfStatement:
+			out = append(out, l.ifStatement(s, sc)...)
+		case *parser.ForStatement:
+			loop := *s
+			loop.Body = l.block(s.Body, sc)
+			out = append(out, &loop)
+		case *parser.WhileStatement:
+			loop := *s
+			loop.Body = l.block(s.Body, sc)
+			out = append(out, &loop)
+		case *parser.SubroutineDefinition:
+			def := *s
+			def.Body = l.scope(s.Body)
+			out = append(out, &def)
+		default:
+			out = append(out, stmt)
+		}
+	}
+	return out
+}
+
+// ifStatement returns the statements that replace s
+func (l *lowerer) ifStatement(s *parser.IfStatement, sc *scope) []parser.Statement {
+	lowered := *s
+	lowered.ThenBody = l.block(s.ThenBody, sc)
+	lowered.ElseBody = l.block(s.ElseBody, sc)
+
+	cond, ok := l.condition(s.Condition)
+	if !ok {
+		l.report(message.ConditionNotLowered, s.Condition, nil)
+		return []parser.Statement{&lowered}
+	}
+	split := len(lowered.ElseBody) > 0 && !l.target.Else
+	if !split {
+		if tests, ok := cond.conjunction(false); ok {
+			return []parser.Statement{nest(tests, &lowered)}
+		}
+	}
+
+	// The else branch of a split comparison tests the bit again after the
+	// then branch ran, so a bit the then branch may write is copied first
+	t, direct := cond.direct()
+	need := cond.need(true)
+	capture := split && direct && (t.register || writes(lowered.ThenBody, t.name()))
+	if capture {
+		need++
+	}
+	if available := l.target.ScratchBits - l.used; l.target.ScratchBits >= 0 && need > available {
+		l.report(message.ScratchExhausted, s.Condition, map[string]string{
+			"needed":    strconv.Itoa(need),
+			"available": strconv.Itoa(available),
+		})
+		return []parser.Statement{&lowered}
+	}
+	l.used += need
+
+	var out []parser.Statement
+	if !direct {
+		t = l.emit(cond, sc, &out)
+	}
+	if capture {
+		t = sc.capture(t, &out)
+	}
+	lowered.Condition = t.expression()
+	if !split {
+		return append(out, &lowered)
+	}
+	otherwise := &parser.IfStatement{Condition: t.flip().expression(), ThenBody: lowered.ElseBody}
+	lowered.ElseBody = nil
+	return append(out, &lowered, otherwise)
+}
+
+// emit appends the statements that evaluate n into a scratch bit, unless
+// n is a single bit, and returns the comparison that tests it
+func (l *lowerer) emit(n *node, sc *scope, out *[]parser.Statement) test {
+	var t test
+	switch {
+	case n.test == nil:
+		// A conjunction starts true and any false operand clears it; a
+		// disjunction starts false and any true operand sets it
+		start, set := int64(0), int64(1)
+		if n.op == "&&" {
+			start, set = 1, 0
+		}
+		bit := sc.alloc()
+		*out = append(*out, sc.assign(bit, start))
+		for _, child := range n.children {
+			operand := l.emit(child, sc, out)
+			if n.op == "&&" {
+				operand = operand.flip()
+			}
+			*out = append(*out, &parser.IfStatement{
+				Condition: operand.expression(),
+				ThenBody:  []parser.Statement{sc.assign(bit, set)},
+			})
+		}
+		t = test{operand: sc.bit(bit), value: 1}
+	case n.test.register:
+		t = sc.capture(*n.test, out)
+	default:
+		t = *n.test
+	}
+	if n.negated {
+		t = t.flip()
+	}
+	return t
+}
+
+// condition models a condition as operations on bit comparisons,
+// returning false if it reads anything else
+func (l *lowerer) condition(expr parser.Expression) (*node, bool) {
+	switch e := expr.(type) {
+	case *parser.ParenthesizedExpression:
+		return l.condition(e.Expression)
+	case *parser.UnaryExpression:
+		if e.Operator == "!" || (e.Operator == "~" && l.bit(e.Operand)) {
+			n, ok := l.condition(e.Operand)
+			if ok {
+				n.negated = !n.negated
+			}
+			return n, ok
+		}
+	case *parser.BinaryExpression:
+		switch e.Operator {
+		case "&&", "||":
+			n := &node{op: e.Operator}
+			for _, operand := range []parser.Expression{e.Left, e.Right} {
+				child, ok := l.condition(operand)
+				if !ok {
+					return nil, false
+				}
+				if child.op == n.op && !child.negated {
+					n.children = append(n.children, child.children...)
+				} else {
+					n.children = append(n.children, child)
+				}
+			}
+			return n, true
+		case "==", "!=":
+			n, ok := l.comparison(e.Left, e.Right)
+			if !ok {
+				n, ok = l.comparison(e.Right, e.Left)
+			}
+			if ok && e.Operator == "!=" {
+				n.negated = !n.negated
+			}
+			return n, ok
+		}
+	case *parser.Identifier, *parser.IndexedIdentifier:
+		if l.bit(e) {
+			return &node{test: &test{operand: e, value: 1}}, true
+		}
+	}
+	return nil, false
+}
+
+// comparison models operand == value for a bit or bit register operand
+// and an integer or boolean value
+func (l *lowerer) comparison(operand, value parser.Expression) (*node, bool) {
+	var v int64
+	switch lit := value.(type) {
+	case *parser.IntegerLiteral:
+		v = lit.Value
+	case *parser.BooleanLiteral:
+		if lit.Value {
+			v = 1
+		}
+	default:
+		return nil, false
+	}
+	if l.bit(operand) {
+		if v != 0 && v != 1 {
+			return nil, false
+		}
+		return &node{test: &test{operand: operand, value: v}}, true
+	}
+	id, ok := operand.(*parser.Identifier)
+	if !ok {
+		return nil, false
+	}
+	size, ok := l.bits[id.Name]
+	switch {
+	case !ok || size == 0:
+		return nil, false
+	case l.target.RegisterComparison:
+		return &node{test: &test{operand: operand, value: v, register: true}}, true
+	case size < 0 || v < 0 || size < 63 && v >= 1<<size:
+		return nil, false
+	}
+	// Bit i of the register is bit i of the integer
+	n := &node{op: "&&"}
+	for i := range size {
+		bit := &parser.IndexedIdentifier{Name: id.Name, Index: integer(int64(i))}
+		n.children = append(n.children, &node{test: &test{operand: bit, value: v >> i & 1}})
+	}
+	return n, true
+}
+
+// bit reports whether expr is a single bit: a bit variable or an element
+// of a bit register
+func (l *lowerer) bit(expr parser.Expression) bool {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		size, ok := l.bits[e.Name]
+		return ok && size == 0
+	case *parser.IndexedIdentifier:
+		size, ok := l.bits[e.Name]
+		if _, isRange := e.Index.(*parser.RangeExpression); isRange || e.Index == nil {
+			return false
+		}
+		return ok && size != 0
+	}
+	return false
+}
+
+func (l *lowerer) report(code string, condition parser.Expression, args map[string]string) {
+	if args == nil {
+		args = make(map[string]string)
+	}
+	args["condition"] = printer.Expression(condition)
+	args["target"] = l.target.String()
+	pos := condition.Pos()
+	pos.Column--
+	l.diagnostics = append(l.diagnostics, parser.NewDiagnostic("semantic", code, args, pos))
+}
+
+// node is a condition: a comparison, or the && or || of its children
+type node struct {
+	test     *test
+	op       string
+	children []*node
+	negated  bool
+}
+
+// direct returns the comparison n is if it needs no scratch bit
+func (n *node) direct() (test, bool) {
+	switch {
+	case n.test == nil:
+		return test{}, false
+	case !n.negated:
+		return *n.test, true
+	case n.test.register:
+		return test{}, false
+	}
+	return n.test.flip(), true
+}
+
+// need counts the scratch bits emit uses for n
+func (n *node) need(top bool) int {
+	switch {
+	case n.test == nil:
+		count := 1
+		for _, child := range n.children {
+			count += child.need(false)
+		}
+		return count
+	case n.test.register && (!top || n.negated):
+		return 1
+	}
+	return 0
+}
+
+// conjunction returns the comparisons of n if it is a conjunction of
+// single bits, negated if negated is set
+func (n *node) conjunction(negated bool) ([]test, bool) {
+	negated = negated != n.negated
+	if n.test != nil {
+		switch {
+		case !negated:
+			return []test{*n.test}, true
+		case n.test.register:
+			return nil, false
+		}
+		return []test{n.test.flip()}, true
+	}
+	// By De Morgan's law a negated disjunction is a conjunction too
+	if (n.op == "&&") == negated {
+		return nil, false
+	}
+	var tests []test
+	for _, child := range n.children {
+		t, ok := child.conjunction(negated)
+		if !ok {
+			return nil, false
+		}
+		tests = append(tests, t...)
+	}
+	return tests, true
+}
+
+// nest wraps the body of s in one if per comparison, s becoming the
+// outermost
+func nest(tests []test, s *parser.IfStatement) parser.Statement {
+	body := s.ThenBody
+	for i := len(tests) - 1; i > 0; i-- {
+		body = []parser.Statement{&parser.IfStatement{Condition: tests[i].expression(), ThenBody: body}}
+	}
+	s.Condition = tests[0].expression()
+	s.ThenBody = body
+	return s
+}
+
+// test compares a bit, or with register set a whole bit register, with
+// an integer
+type test struct {
+	operand  parser.Expression
+	value    int64
+	register bool
+}
+
+func (t test) expression() parser.Expression {
+	return &parser.BinaryExpression{Left: t.operand, Operator: "==", Right: integer(t.value)}
+}
+
+// flip returns the opposite comparison of a single bit
+func (t test) flip() test {
+	t.value = 1 - t.value
+	return t
+}
+
+// name returns the variable t reads
+func (t test) name() string {
+	switch e := t.operand.(type) {
+	case *parser.Identifier:
+		return e.Name
+	case *parser.IndexedIdentifier:
+		return e.Name
+	}
+	return ""
+}
+
+// scope allocates the scratch bits of a program or subroutine body
+type scope struct {
+	register string
+	size     int
+}
+
+func (sc *scope) alloc() int {
+	sc.size++
+	return sc.size - 1
+}
+
+func (sc *scope) bit(index int) parser.Expression {
+	return &parser.IndexedIdentifier{Name: sc.register, Index: integer(int64(index))}
+}
+
+func (sc *scope) assign(index int, value int64) parser.Statement {
+	return &parser.Assignment{Target: sc.bit(index), Operator: "=", Value: integer(value)}
+}
+
+// capture appends the statements that copy the outcome of t into a new
+// scratch bit and returns the comparison that tests it
+func (sc *scope) capture(t test, out *[]parser.Statement) test {
+	bit := sc.alloc()
+	*out = append(*out, sc.assign(bit, 0), &parser.IfStatement{
+		Condition: t.expression(),
+		ThenBody:  []parser.Statement{sc.assign(bit, 1)},
+	})
+	return test{operand: sc.bit(bit), value: 1}
+}
+
+// writes reports whether statements may assign or measure into name
+func writes(statements []parser.Statement, name string) bool {
+	w := &writer{name: name}
+	parser.WalkStatements(parser.NewDepthFirstVisitor(w), statements)
+	return w.found
+}
+
+type writer struct {
+	parser.BaseVisitor
+	name  string
+	found bool
+}
+
+func (w *writer) VisitMeasurement(node *parser.Measurement) interface{} {
+	w.found = w.found || written(node.Target) == w.name
+	return nil
+}
+
+func (w *writer) VisitAssignment(node *parser.Assignment) interface{} {
+	w.found = w.found || written(node.Target) == w.name
+	return nil
+}
+
+func (w *writer) VisitClassicalDeclaration(node *parser.ClassicalDeclaration) interface{} {
+	_, measured := node.Initializer.(*parser.MeasureExpression)
+	w.found = w.found || measured && node.Identifier == w.name
+	return nil
+}
+
+func written(target parser.Expression) string {
+	switch e := target.(type) {
+	case *parser.Identifier:
+		return e.Name
+	case *parser.IndexedIdentifier:
+		return e.Name
+	case *parser.RangedIdentifier:
+		return e.Name
+	}
+	return ""
+}
+
+// names collects every name a program uses, and the bit registers it
+// declares
+type names struct {
+	parser.BaseVisitor
+	seen map[string]bool
+	bits map[string]int
+}
+
+func (n *names) VisitClassicalDeclaration(node *parser.ClassicalDeclaration) interface{} {
+	n.seen[node.Identifier] = true
+	if node.Type != "bit" && node.Type != "creg" {
+		return nil
+	}
+	switch size := node.Size.(type) {
+	case nil:
+		n.bits[node.Identifier] = 0
+	case *parser.IntegerLiteral:
+		n.bits[node.Identifier] = int(size.Value)
+	default:
+		n.bits[node.Identifier] = -1
+	}
+	return nil
+}
+
+func (n *names) VisitQuantumDeclaration(node *parser.QuantumDeclaration) interface{} {
+	n.seen[node.Identifier] = true
+	return nil
+}
+
+func (n *names) VisitGateDefinition(node *parser.GateDefinition) interface{} {
+	n.seen[node.Name] = true
+	return nil
+}
+
+func (n *names) VisitSubroutineDefinition(node *parser.SubroutineDefinition) interface{} {
+	n.seen[node.Name] = true
+	return nil
+}
+
+func (n *names) VisitParameter(node *parser.Parameter) interface{} {
+	n.seen[node.Name] = true
+	if node.Type == "bit" {
+		n.bits[node.Name] = 0
+	}
+	return nil
+}
+
+func (n *names) VisitIdentifier(node *parser.Identifier) interface{} {
+	n.seen[node.Name] = true
+	return nil
+}
+
+func (n *names) VisitIndexedIdentifier(node *parser.IndexedIdentifier) interface{} {
+	n.seen[node.Name] = true
+	return nil
+}
+
+func (n *names) VisitRangedIdentifier(node *parser.RangedIdentifier) interface{} {
+	n.seen[node.Name] = true
+	return nil
+}
+
+func integer(v int64) parser.Expression {
+	return &parser.IntegerLiteral{Value: v}
+}
@@ -0,0 +1,136 @@
+package lower
+
+import (
+	"testing"
+
+	"github.com/orangekame3/qasmparser/message"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+func TestConditions(t *testing.T) {
+	// Scratch registers are declared before the program's own
+	const header = "OPENQASM 3.0;\n"
+	const decls = "qubit q;\nbit[3] c;\n"
+	tests := []struct {
+		name   string
+		target Target
+		src    string
+		want   string
+	}{
+		{
+			name:   "conjunction nests",
+			target: Target{},
+			src:    "if (c[0] && !c[2]) { x q; }\n",
+			want:   decls + "if (c[0] == 1) {\n  if (c[2] == 0) {\n    x q;\n  }\n}\n",
+		},
+		{
+			name:   "negated disjunction nests",
+			target: Target{},
+			src:    "if (!(c[0] || c[1] != 0)) { x q; }\n",
+			want:   decls + "if (c[0] == 0) {\n  if (c[1] == 0) {\n    x q;\n  }\n}\n",
+		},
+		{
+			name:   "disjunction uses a scratch bit",
+			target: Target{Else: true, ScratchBits: -1},
+			src:    "if (c[0] || !c[2]) { x q; } else { z q; }\n",
+			want: "bit[1] scratch;\n" + decls + "scratch[0] = 0;\nif (c[0] == 1) {\n  scratch[0] = 1;\n}\nif (c[2] == 0) {\n  scratch[0] = 1;\n}\n" +
+				"if (scratch[0] == 1) {\n  x q;\n} else {\n  z q;\n}\n",
+		},
+		{
+			name:   "nested operators",
+			target: Target{ScratchBits: 2},
+			src:    "if ((c[0] && c[1]) || c[2]) { x q; }\n",
+			want: "bit[2] scratch;\n" + decls + "scratch[0] = 0;\nscratch[1] = 1;\nif (c[0] == 0) {\n  scratch[1] = 0;\n}\nif (c[1] == 0) {\n  scratch[1] = 0;\n}\n" +
+				"if (scratch[1] == 1) {\n  scratch[0] = 1;\n}\nif (c[2] == 1) {\n  scratch[0] = 1;\n}\nif (scratch[0] == 1) {\n  x q;\n}\n",
+		},
+		{
+			name:   "register spelled out",
+			target: Target{},
+			src:    "if (c == 5) { x q; }\n",
+			want:   decls + "if (c[0] == 1) {\n  if (c[1] == 0) {\n    if (c[2] == 1) {\n      x q;\n    }\n  }\n}\n",
+		},
+		{
+			name:   "register compared",
+			target: Target{RegisterComparison: true},
+			src:    "if (c == 5) { x q; }\n",
+			want:   decls + "if (c == 5) {\n  x q;\n}\n",
+		},
+		{
+			name:   "else split",
+			target: Target{},
+			src:    "if (!c[1]) { x q; } else { z q; }\n",
+			want:   decls + "if (c[1] == 0) {\n  x q;\n}\nif (c[1] == 1) {\n  z q;\n}\n",
+		},
+		{
+			name:   "else split copies a bit the branch writes",
+			target: Target{ScratchBits: 1},
+			src:    "if (c[1]) { measure q -> c[1]; } else { z q; }\n",
+			want: "bit[1] scratch;\n" + decls + "scratch[0] = 0;\nif (c[1] == 1) {\n  scratch[0] = 1;\n}\n" +
+				"if (scratch[0] == 1) {\n  measure q -> c[1];\n}\nif (scratch[0] == 0) {\n  z q;\n}\n",
+		},
+		{
+			name:   "nested ifs",
+			target: Target{ScratchBits: -1},
+			src:    "for int i in [0:1] { if (c[0] || c[1]) { if (c[2] || c[0]) { x q; } } }\n",
+			want: "bit[2] scratch;\n" + decls + "for int i in [0:1] {\n  scratch[1] = 0;\n  if (c[0] == 1) {\n    scratch[1] = 1;\n  }\n  if (c[1] == 1) {\n    scratch[1] = 1;\n  }\n" +
+				"  if (scratch[1] == 1) {\n    scratch[0] = 0;\n    if (c[2] == 1) {\n      scratch[0] = 1;\n    }\n    if (c[0] == 1) {\n      scratch[0] = 1;\n    }\n" +
+				"    if (scratch[0] == 1) {\n      x q;\n    }\n  }\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := parser.NewParser().ParseString(header + decls + tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := printer.Print(program)
+			lowered, diags := Conditions(program, tt.target)
+			if len(diags) > 0 {
+				t.Fatalf("Conditions() reported %v", diags)
+			}
+			if got := printer.Print(lowered); got != header+tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s%s", got, header, tt.want)
+			}
+			if printer.Print(program) != before {
+				t.Error("Conditions() modified the program")
+			}
+		})
+	}
+}
+
+func TestConditionsNotLowered(t *testing.T) {
+	src := `OPENQASM 3.0;
+qubit q;
+bit[2] c;
+int n;
+if (n > 2) { x q; }
+if (c[0] || c[1]) { x q; }
+if (c == 7) { x q; }
+`
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lowered, diags := Conditions(program, Target{Name: "device"})
+	want := []struct {
+		code, message string
+		line          int
+	}{
+		{message.ConditionNotLowered, "condition n > 2 cannot be lowered to single-bit comparisons for device", 5},
+		{message.ScratchExhausted, "lowering condition c[0] || c[1] needs 1 scratch bits, but device has 0 left", 6},
+		{message.ConditionNotLowered, "condition c == 7 cannot be lowered to single-bit comparisons for device", 7},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("Conditions() = %v", diags)
+	}
+	for i, w := range want {
+		d := diags[i]
+		if d.Code != w.code || d.Message != w.message || d.Position.Line != w.line || d.Severity != parser.SeverityError {
+			t.Errorf("diagnostic %d = %+v", i, d)
+		}
+	}
+	if got, want := printer.Print(lowered), printer.Print(program); got != want {
+		t.Errorf("unlowered statements changed:\n%s", got)
+	}
+}
@@ -0,0 +1,243 @@
+// Package message is the catalog of diagnostic texts. Every diagnostic
+// the parser produces has a stable code, such as QASM0002, and named
+// arguments; its message is the code's template with the arguments
+// filled in. Codes are the machine contract and never change meaning,
+// while the text may be localized by choosing another catalog:
+//
+//	catalog, err := message.Lookup("ja")
+//	diags = parser.Localize(result.Errors, catalog)
+package message
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Diagnostic codes
+const (
+	SyntaxError         = "QASM0001"
+	MismatchedInput     = "QASM0002"
+	ExtraneousInput     = "QASM0003"
+	MissingToken        = "QASM0004"
+	NoViableAlternative = "QASM0005"
+	UnrecognizedToken   = "QASM0006"
+	InvalidUTF8         = "QASM0007"
+	ControlCharacter    = "QASM0008"
+	InvisibleCharacter  = "QASM0009"
+	OldStyleDeclaration = "QASM0010"
+	TrailingInput       = "QASM0011"
+	FileTooLarge        = "QASM0012"
+	ParsingStopped      = "QASM0013"
+	ReadFailed          = "QASM0014"
+	IncludeNotFound     = "QASM0015"
+	CustomStatement     = "QASM0016"
+	MissingSemicolon    = "QASM0017"
+	MeasurementSyntax   = "QASM0018"
+	ResultOverwritten   = "QASM0019"
+	BitNeverWritten     = "QASM0020"
+	PulseBeforeDeclared = "QASM0021"
+	InvalidPragma       = "QASM0022"
+	ConditionNotLowered = "QASM0023"
+	ScratchExhausted    = "QASM0024"
+	NotConstant         = "QASM0025"
+	TooManyIndices      = "QASM0026"
+	IndexOutOfRange     = "QASM0027"
+	ReadonlyAssignment  = "QASM0028"
+	AnglePrecision      = "QASM0029"
+)
+
+// Catalog maps diagnostic codes to message templates. A template names
+// its arguments in braces, e.g. "missing {token} at {input}".
+type Catalog map[string]string
+
+// English is the default catalog, in which the library reports
+// diagnostics
+var English = Catalog{
+	SyntaxError:         "{message}",
+	MismatchedInput:     "mismatched input {input} expecting {expected}",
+	ExtraneousInput:     "extraneous input {input} expecting {expected}",
+	MissingToken:        "missing {token} at {input}",
+	NoViableAlternative: "no viable alternative at input {input}",
+	UnrecognizedToken:   "token recognition error at: {input}",
+	InvalidUTF8:         "invalid UTF-8 byte {byte}",
+	ControlCharacter:    "invalid control character {char}",
+	InvisibleCharacter:  "invisible character {char}",
+	OldStyleDeclaration: "'{keyword}' is OpenQASM 2.0 syntax; use '{replacement}' instead",
+	TrailingInput:       "unexpected {input} after fragment",
+	FileTooLarge:        "file size {size} bytes exceeds limit of {limit} bytes",
+	ParsingStopped:      "parsing stopped: {reason}",
+	ReadFailed:          "{error}",
+	IncludeNotFound:     "include {path} not found",
+	CustomStatement:     "invalid {keyword} statement: {error}",
+	MissingSemicolon:    "missing ';' after {token}",
+	MeasurementSyntax:   "{operator} cannot assign a measurement here",
+	ResultOverwritten:   "{bit} is measured again before the result measured on line {line} is read",
+	BitNeverWritten:     "{bit} is never written",
+	PulseBeforeDeclared: "{type} {name} is used before its declaration on line {line}",
+	InvalidPragma:       "pragma {pragma} needs {expected}, not {value}",
+	ConditionNotLowered: "condition {condition} cannot be lowered to single-bit comparisons for {target}",
+	ScratchExhausted:    "lowering condition {condition} needs {needed} scratch bits, but {target} has {available} left",
+	NotConstant:         "const {name} = {value} is not a constant {type}",
+	TooManyIndices:      "{name} has {dimensions} dimensions but is indexed with {indices}",
+	IndexOutOfRange:     "index {index} is out of range for dimension {dimension} of {name}, of size {size}",
+	ReadonlyAssignment:  "{name} is a readonly array and cannot be assigned",
+	AnglePrecision:      "{value} stored as {type} is off by {loss} radians",
+}
+
+// Japanese translates the English catalog
+var Japanese = Catalog{
+	SyntaxError:         "構文エラー: {message}",
+	MismatchedInput:     "入力 {input} は不正です。{expected} が必要です",
+	ExtraneousInput:     "余分な入力 {input} があります。{expected} が必要です",
+	MissingToken:        "{input} の前に {token} がありません",
+	NoViableAlternative: "入力 {input} を解析できません",
+	UnrecognizedToken:   "トークンを認識できません: {input}",
+	InvalidUTF8:         "不正な UTF-8 バイト {byte} があります",
+	ControlCharacter:    "不正な制御文字 {char} があります",
+	InvisibleCharacter:  "不可視文字 {char} があります",
+	OldStyleDeclaration: "'{keyword}' は OpenQASM 2.0 の構文です。代わりに '{replacement}' を使ってください",
+	TrailingInput:       "断片の後に予期しない {input} があります",
+	FileTooLarge:        "ファイルサイズ {size} バイトが上限の {limit} バイトを超えています",
+	ParsingStopped:      "解析を中断しました: {reason}",
+	ReadFailed:          "ファイルを読み込めません: {error}",
+	IncludeNotFound:     "インクルードファイル {path} が見つかりません",
+	CustomStatement:     "{keyword} 文が不正です: {error}",
+	MissingSemicolon:    "{token} の後に ';' がありません",
+	MeasurementSyntax:   "ここでは {operator} で測定結果を代入できません",
+	ResultOverwritten:   "{line} 行目で {bit} に測定した結果が読まれる前に、再び測定されています",
+	BitNeverWritten:     "{bit} には一度も書き込まれていません",
+	PulseBeforeDeclared: "{type} {name} が {line} 行目で宣言される前に使われています",
+	InvalidPragma:       "pragma {pragma} には {value} ではなく {expected} が必要です",
+	ConditionNotLowered: "条件 {condition} は {target} 向けの単一ビット比較に変換できません",
+	ScratchExhausted:    "条件 {condition} の変換にはスクラッチビットが {needed} 個必要ですが、{target} には残り {available} 個しかありません",
+	NotConstant:         "const {name} = {value} は定数の {type} ではありません",
+	TooManyIndices:      "{name} は {dimensions} 次元ですが、{indices} 個の添字で参照されています",
+	IndexOutOfRange:     "{name} の {dimension} 次元目の大きさは {size} で、添字 {index} は範囲外です",
+	ReadonlyAssignment:  "{name} は readonly の配列なので代入できません",
+	AnglePrecision:      "{value} を {type} として格納すると {loss} ラジアンの誤差が生じます",
+}
+
+// Explanations describe how to fix the most common mistakes, with
+// examples, for diagnostics whose message alone is terse
+var Explanations = map[string]string{
+	MissingSemicolon: `Every statement ends with a semicolon, including the last one on a line:
+
+    h q[0];
+    cx q[0], q[1];`,
+	MeasurementSyntax: `A measurement is written into bits in one of two forms:
+
+    c = measure q;
+    measure q -> c;
+
+The arrow form cannot be combined with an assignment, and '=' does not
+follow 'measure'.`,
+	OldStyleDeclaration: `OpenQASM 3 declares registers by type, with the size in brackets:
+
+    qreg q[2];  becomes  qubit[2] q;
+    creg c[2];  becomes  bit[2] c;`,
+}
+
+// catalogs maps language tags to their catalogs
+var catalogs = map[string]Catalog{
+	"en": English,
+	"ja": Japanese,
+}
+
+// Languages returns the languages Lookup accepts, sorted
+func Languages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Lookup returns the catalog for a language. Lang may be a bare language
+// such as "ja" or a locale such as "ja_JP.UTF-8"; an empty lang selects
+// English.
+func Lookup(lang string) (Catalog, error) {
+	if lang == "" {
+		return English, nil
+	}
+	base := strings.ToLower(lang)
+	if i := strings.IndexAny(base, "-_."); i >= 0 {
+		base = base[:i]
+	}
+	catalog, ok := catalogs[base]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language %q (supported: %s)", lang, strings.Join(Languages(), ", "))
+	}
+	return catalog, nil
+}
+
+// Format returns the message for code with args filled in. It reports
+// false if the catalog has no template for code or the template names an
+// argument args lacks.
+func (c Catalog) Format(code string, args map[string]string) (string, bool) {
+	template, ok := c[code]
+	if !ok {
+		return "", false
+	}
+	var sb strings.Builder
+	for {
+		open := strings.IndexByte(template, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(template[open:], '}')
+		if end < 0 {
+			break
+		}
+		value, ok := args[template[open+1:open+end]]
+		if !ok {
+			return "", false
+		}
+		sb.WriteString(template[:open])
+		sb.WriteString(value)
+		template = template[open+end+1:]
+	}
+	sb.WriteString(template)
+	return sb.String(), true
+}
+
+// Match is the inverse of Format: it reports whether text is the message
+// for code and returns the arguments it was filled with. An argument
+// extends as little as possible, so a value containing the text that
+// follows it in the template is split early.
+func (c Catalog) Match(code, text string) (map[string]string, bool) {
+	template, ok := c[code]
+	if !ok {
+		return nil, false
+	}
+	var (
+		pattern strings.Builder
+		names   []string
+	)
+	pattern.WriteString("(?s)^")
+	for {
+		open := strings.IndexByte(template, '{')
+		end := strings.IndexByte(template[max(open, 0):], '}')
+		if open < 0 || end < 0 {
+			break
+		}
+		pattern.WriteString(regexp.QuoteMeta(template[:open]))
+		pattern.WriteString("(.*?)")
+		names = append(names, template[open+1:open+end])
+		template = template[open+end+1:]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template))
+	pattern.WriteString("$")
+
+	match := regexp.MustCompile(pattern.String()).FindStringSubmatch(text)
+	if match == nil {
+		return nil, false
+	}
+	args := make(map[string]string, len(names))
+	for i, name := range names {
+		args[name] = match[i+1]
+	}
+	return args, true
+}
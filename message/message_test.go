@@ -0,0 +1,74 @@
+package message
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCatalogsComplete(t *testing.T) {
+	for _, lang := range Languages() {
+		catalog, err := Lookup(lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for code, template := range English {
+			translated, ok := catalog[code]
+			if !ok {
+				t.Errorf("%s: missing %s", lang, code)
+				continue
+			}
+			// A translation must use exactly the English arguments
+			args := placeholders(template)
+			if got := placeholders(translated); strings.Join(got, ",") != strings.Join(args, ",") {
+				t.Errorf("%s: %s uses %v, want %v", lang, code, got, args)
+			}
+		}
+	}
+}
+
+// placeholders returns the sorted argument names of a template
+func placeholders(template string) []string {
+	args, _ := Catalog{"x": template}.Match("x", template)
+	var names []string
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFormatMatch(t *testing.T) {
+	args := map[string]string{"token": "';'", "input": "'h'"}
+	text, ok := English.Format(MissingToken, args)
+	if !ok || text != "missing ';' at 'h'" {
+		t.Fatalf("Format() = %q, %v", text, ok)
+	}
+	got, ok := English.Match(MissingToken, text)
+	if !ok || got["token"] != "';'" || got["input"] != "'h'" {
+		t.Errorf("Match() = %v, %v", got, ok)
+	}
+	if _, ok := English.Match(MissingToken, "something else"); ok {
+		t.Error("Match() accepted another message")
+	}
+	if _, ok := English.Format(MissingToken, map[string]string{"token": "x"}); ok {
+		t.Error("Format() accepted missing arguments")
+	}
+	if _, ok := English.Format("QASM9999", nil); ok {
+		t.Error("Format() accepted an unknown code")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, lang := range []string{"ja", "JA", "ja_JP.UTF-8", "ja-JP"} {
+		if c, err := Lookup(lang); err != nil || c[MissingToken] != Japanese[MissingToken] {
+			t.Errorf("Lookup(%q) = %v", lang, err)
+		}
+	}
+	if c, err := Lookup(""); err != nil || c[MissingToken] != English[MissingToken] {
+		t.Errorf("Lookup(\"\") = %v", err)
+	}
+	if _, err := Lookup("xx"); err == nil {
+		t.Error("Lookup(\"xx\") succeeded")
+	}
+}
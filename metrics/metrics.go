@@ -0,0 +1,182 @@
+// Package metrics collects operational metrics of a parsing service and
+// exposes them in the Prometheus text format, so a hosted service can be
+// monitored with standard tooling:
+//
+//	m := metrics.New()
+//	mux.Handle("/parse", m.Middleware("parse", parseHandler))
+//	mux.Handle("/metrics", m.Handler())
+//
+// Error rates and cache hit ratios are left to the monitoring system,
+// which derives them from the exported counters.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Namespace prefixes every exported metric name
+const Namespace = "qasmparser"
+
+// DurationBuckets are the upper bounds, in seconds, of the parse duration
+// histogram
+var DurationBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics holds the counters of one service. It is safe for concurrent
+// use.
+type Metrics struct {
+	mu       sync.Mutex
+	requests map[string]uint64
+	errors   map[string]uint64
+	hits     uint64
+	misses   uint64
+
+	// buckets counts parses per histogram bucket, not cumulatively; the
+	// last entry counts parses slower than every bound
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// New creates an empty set of metrics
+func New() *Metrics {
+	return &Metrics{
+		requests: make(map[string]uint64),
+		errors:   make(map[string]uint64),
+		buckets:  make([]uint64, len(DurationBuckets)+1),
+	}
+}
+
+// ObserveRequest records one request to endpoint and whether it failed
+func (m *Metrics) ObserveRequest(endpoint string, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[endpoint]++
+	if failed {
+		m.errors[endpoint]++
+	}
+}
+
+// ObserveParse records how long one parse took
+func (m *Metrics) ObserveParse(d time.Duration) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(DurationBuckets, seconds)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buckets[i]++
+	m.count++
+	m.sum += seconds
+}
+
+// CacheHit records a lookup answered from a cache
+func (m *Metrics) CacheHit() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hits++
+}
+
+// CacheMiss records a lookup a cache could not answer
+func (m *Metrics) CacheMiss() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.misses++
+}
+
+// CacheCounts returns the cache hits and misses recorded so far
+func (m *Metrics) CacheCounts() (hits, misses uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hits, m.misses
+}
+
+// Middleware counts the requests next serves under endpoint. Responses
+// with a status of 400 or above count as errors.
+func (m *Metrics) Middleware(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		m.ObserveRequest(endpoint, rec.status >= http.StatusBadRequest)
+	})
+}
+
+// statusRecorder remembers the status code a handler writes
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = m.Write(w)
+	})
+}
+
+// Write writes the metrics in the Prometheus text format
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	writeCounterVec(bw, "requests_total", "Requests served, by endpoint.", m.requests)
+	writeCounterVec(bw, "request_errors_total", "Requests that failed, by endpoint.", m.errors)
+	writeCounter(bw, "cache_hits_total", "Lookups answered from a cache.", m.hits)
+	writeCounter(bw, "cache_misses_total", "Lookups a cache could not answer.", m.misses)
+
+	name := Namespace + "_parse_duration_seconds"
+	fmt.Fprintf(bw, "# HELP %s Time spent parsing programs.\n# TYPE %s histogram\n", name, name)
+	var cumulative uint64
+	for i, bound := range DurationBuckets {
+		cumulative += m.buckets[i]
+		fmt.Fprintf(bw, "%s_bucket{le=%q} %d\n", name, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(bw, "%s_bucket{le=\"+Inf\"} %d\n", name, m.count)
+	fmt.Fprintf(bw, "%s_sum %s\n", name, formatFloat(m.sum))
+	fmt.Fprintf(bw, "%s_count %d\n", name, m.count)
+	return bw.Flush()
+}
+
+func writeCounter(w io.Writer, name, help string, value uint64) {
+	name = Namespace + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
+
+func writeCounterVec(w io.Writer, name, help string, values map[string]uint64) {
+	name = Namespace + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	endpoints := make([]string, 0, len(values))
+	for endpoint := range values {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(w, "%s{endpoint=\"%s\"} %d\n", name, escapeLabel(endpoint), values[endpoint])
+	}
+}
+
+// escapeLabel escapes a label value as the text format requires
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	m := New()
+	m.ObserveRequest("parse", false)
+	m.ObserveRequest("parse", true)
+	m.ObserveRequest("format", false)
+	m.CacheHit()
+	m.CacheHit()
+	m.CacheMiss()
+	m.ObserveParse(3 * time.Millisecond)
+	m.ObserveParse(2 * time.Second)
+
+	if hits, misses := m.CacheCounts(); hits != 2 || misses != 1 {
+		t.Errorf("CacheCounts() = %d, %d, want 2, 1", hits, misses)
+	}
+
+	var sb strings.Builder
+	if err := m.Write(&sb); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	for _, want := range []string{
+		"# TYPE qasmparser_requests_total counter\n",
+		`qasmparser_requests_total{endpoint="format"} 1` + "\n",
+		`qasmparser_requests_total{endpoint="parse"} 2` + "\n",
+		`qasmparser_request_errors_total{endpoint="parse"} 1` + "\n",
+		"qasmparser_cache_hits_total 2\n",
+		"qasmparser_cache_misses_total 1\n",
+		"# TYPE qasmparser_parse_duration_seconds histogram\n",
+		`qasmparser_parse_duration_seconds_bucket{le="0.001"} 0` + "\n",
+		`qasmparser_parse_duration_seconds_bucket{le="0.005"} 1` + "\n",
+		`qasmparser_parse_duration_seconds_bucket{le="2.5"} 2` + "\n",
+		`qasmparser_parse_duration_seconds_bucket{le="+Inf"} 2` + "\n",
+		"qasmparser_parse_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, `endpoint="format"`) > strings.Index(out, `endpoint="parse"`) {
+		t.Error("endpoints are not sorted")
+	}
+}
+
+func TestMiddlewareAndHandler(t *testing.T) {
+	m := New()
+	ok := m.Middleware("parse", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	bad := m.Middleware("parse", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "bad program", http.StatusUnprocessableEntity)
+	}))
+	ok.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/parse", nil))
+	bad.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/parse", nil))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `qasmparser_requests_total{endpoint="parse"} 2`) ||
+		!strings.Contains(body, `qasmparser_request_errors_total{endpoint="parse"} 1`) {
+		t.Errorf("unexpected metrics:\n%s", body)
+	}
+}
@@ -0,0 +1,199 @@
+// Package mutate checks parser robustness by mutation: it breaks valid
+// source in systematic token-level ways and verifies that the parser
+// terminates, does not panic and reports at least one diagnostic for every
+// mutant. The parser under test is a plain function, so dialect parsers
+// built on this module can reuse the harness.
+package mutate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Kind identifies a mutation operator
+type Kind string
+
+const (
+	// DeleteSemicolon removes one statement terminator
+	DeleteSemicolon Kind = "delete-semicolon"
+
+	// SwapBrackets exchanges the opening and closing bracket of a pair
+	SwapBrackets Kind = "swap-brackets"
+
+	// Truncate cuts the source off in the middle of a statement
+	Truncate Kind = "truncate"
+)
+
+// Mutant is a mutated copy of a source text
+type Mutant struct {
+	Kind Kind `json:"kind"`
+
+	// Position is where the mutation was applied in the original source
+	Position parser.Position `json:"position"`
+
+	Source string `json:"source"`
+}
+
+// Mutants returns every mutant of src the operators produce, in source
+// order per operator. src should be valid; tokens come from parsing it.
+func Mutants(src string) []Mutant {
+	tokens := parser.NewParser().ParseWithErrors(src).Tokens()
+	runes := []rune(src)
+	replace := func(start, end int, text string) string {
+		return string(runes[:start]) + text + string(runes[end:])
+	}
+
+	var mutants []Mutant
+	for _, tok := range tokens {
+		if tok.Type == "SEMICOLON" {
+			mutants = append(mutants, Mutant{
+				Kind:     DeleteSemicolon,
+				Position: tok.Position,
+				Source:   replace(tok.Position.Offset, tok.EndPos.Offset, ""),
+			})
+		}
+	}
+
+	pairs := map[string]string{"LBRACKET": "RBRACKET", "LPAREN": "RPAREN", "LBRACE": "RBRACE"}
+	var open []parser.Token
+	for _, tok := range tokens {
+		if _, ok := pairs[tok.Type]; ok {
+			open = append(open, tok)
+			continue
+		}
+		if len(open) == 0 || pairs[open[len(open)-1].Type] != tok.Type {
+			continue
+		}
+		o := open[len(open)-1]
+		open = open[:len(open)-1]
+		swapped := []rune(src)
+		swapped[o.Position.Offset], swapped[tok.Position.Offset] = swapped[tok.Position.Offset], swapped[o.Position.Offset]
+		mutants = append(mutants, Mutant{Kind: SwapBrackets, Position: o.Position, Source: string(swapped)})
+	}
+
+	// Cutting after a terminator leaves a valid program, so only cut after
+	// tokens that cannot end a statement
+	for i, tok := range tokens {
+		if tok.Type == "SEMICOLON" || tok.Type == "RBRACE" || tok.Class == parser.TokenComment || i == len(tokens)-1 {
+			continue
+		}
+		mutants = append(mutants, Mutant{
+			Kind:     Truncate,
+			Position: tok.EndPos,
+			Source:   string(runes[:tok.EndPos.Offset]),
+		})
+	}
+	return mutants
+}
+
+// ParseFunc parses source and returns how many diagnostics it reported
+type ParseFunc func(ctx context.Context, src string) (diagnostics int, err error)
+
+// QASM returns a ParseFunc for this module's parser with error recovery
+// disabled, so syntax errors are reported
+func QASM() ParseFunc {
+	p := parser.NewParserWithOptions(&parser.ParseOptions{ErrorRecovery: false})
+	return func(ctx context.Context, src string) (int, error) {
+		result := p.ParseWithErrors(src)
+		return len(result.Errors), nil
+	}
+}
+
+// Options configures Run
+type Options struct {
+	// Timeout bounds each parse. Zero means one second.
+	Timeout time.Duration
+
+	// Kinds restricts the operators applied. Empty means all.
+	Kinds []Kind
+}
+
+// Failure is a mutant the parser mishandled
+type Failure struct {
+	Mutant Mutant `json:"mutant"`
+
+	// Problem is "panic", "timeout", "error" or "no diagnostics"
+	Problem string `json:"problem"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+func (f Failure) String() string {
+	s := fmt.Sprintf("%s at %d:%d: %s", f.Mutant.Kind, f.Mutant.Position.Line, f.Mutant.Position.Column, f.Problem)
+	if f.Detail != "" {
+		s += ": " + f.Detail
+	}
+	return s
+}
+
+// Run parses every mutant of src with parse and returns the mutants that
+// panicked, timed out, failed with an error or produced no diagnostics.
+// A parse that times out is abandoned, not stopped.
+func Run(ctx context.Context, src string, parse ParseFunc, opts *Options) []Failure {
+	if opts == nil {
+		opts = &Options{}
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	wanted := make(map[Kind]bool)
+	for _, k := range opts.Kinds {
+		wanted[k] = true
+	}
+
+	var failures []Failure
+	for _, m := range Mutants(src) {
+		if ctx.Err() != nil {
+			break
+		}
+		if len(wanted) > 0 && !wanted[m.Kind] {
+			continue
+		}
+		if problem, detail := check(ctx, m.Source, parse, timeout); problem != "" {
+			failures = append(failures, Failure{Mutant: m, Problem: problem, Detail: detail})
+		}
+	}
+	return failures
+}
+
+type outcome struct {
+	diagnostics int
+	err         error
+	panicked    interface{}
+}
+
+// check parses one mutant under a timeout
+func check(ctx context.Context, src string, parse ParseFunc, timeout time.Duration) (problem, detail string) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		defer func() {
+			if r := recover(); r != nil {
+				o.panicked = r
+			}
+			done <- o
+		}()
+		o.diagnostics, o.err = parse(ctx, src)
+	}()
+
+	select {
+	case o := <-done:
+		switch {
+		case o.panicked != nil:
+			return "panic", fmt.Sprint(o.panicked)
+		case o.err != nil:
+			return "error", o.err.Error()
+		case o.diagnostics == 0:
+			return "no diagnostics", ""
+		}
+		return "", ""
+	case <-ctx.Done():
+		return "timeout", timeout.String()
+	}
+}
@@ -0,0 +1,63 @@
+package mutate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMutants(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit[2] q;\nh q[0];\n"
+	counts := make(map[Kind]int)
+	for _, m := range Mutants(src) {
+		counts[m.Kind]++
+		if m.Source == src {
+			t.Errorf("%s mutant at %+v is unchanged", m.Kind, m.Position)
+		}
+	}
+	if counts[DeleteSemicolon] != 3 || counts[SwapBrackets] != 2 || counts[Truncate] == 0 {
+		t.Errorf("unexpected mutant counts %v", counts)
+	}
+}
+
+func TestRunTestdata(t *testing.T) {
+	for _, file := range []string{"../testdata/test_simple.qasm", "../testdata/test_gates.qasm"} {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range Run(context.Background(), string(content), QASM(), nil) {
+			t.Errorf("%s: %s", file, f)
+		}
+	}
+}
+
+func TestRunReportsFailures(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit q;\n"
+	lenient := func(ctx context.Context, src string) (int, error) {
+		if strings.Contains(src, "qubit q\n") {
+			panic("boom")
+		}
+		return 0, nil
+	}
+	failures := Run(context.Background(), src, lenient, &Options{Kinds: []Kind{DeleteSemicolon}})
+	if len(failures) != 2 {
+		t.Fatalf("expected 2 failures, got %v", failures)
+	}
+	if failures[0].Problem != "no diagnostics" || failures[1].Problem != "panic" {
+		t.Errorf("unexpected problems %q, %q", failures[0].Problem, failures[1].Problem)
+	}
+
+	never := make(chan struct{})
+	hang := func(ctx context.Context, src string) (int, error) {
+		<-never
+		return 0, errors.New("unreachable")
+	}
+	failures = Run(context.Background(), src, hang, &Options{Kinds: []Kind{DeleteSemicolon}, Timeout: 10 * time.Millisecond})
+	if len(failures) != 2 || failures[0].Problem != "timeout" {
+		t.Errorf("expected timeouts, got %v", failures)
+	}
+}
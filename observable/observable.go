@@ -0,0 +1,357 @@
+// Package observable reconstructs the Pauli observables a program
+// measures. Expectation-value circuits measure in the Z basis after
+// rotating each qubit with basis-change gates, such as h for X or sdg
+// then h for Y; Extract undoes those rotations to recover which Pauli
+// operator every classical bit records, so post-processing can combine
+// shot results into expectation values without re-deriving the circuit.
+package observable
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Pauli is a single-qubit Pauli operator: "X", "Y" or "Z", or "I" for a
+// bit no measurement writes. Unknown is used when the gates before a
+// measurement do not map Z to a Pauli operator.
+type Pauli string
+
+// Pauli operators
+const (
+	I       Pauli = "I"
+	X       Pauli = "X"
+	Y       Pauli = "Y"
+	Z       Pauli = "Z"
+	Unknown Pauli = "?"
+)
+
+// Term is the operator one classical bit records
+type Term struct {
+	Bit   string `json:"bit"`
+	Qubit string `json:"qubit"`
+	Pauli Pauli  `json:"pauli"`
+
+	// Negated is set when the basis change flips the sign, so the bit
+	// records -Pauli
+	Negated bool `json:"negated,omitempty"`
+
+	// Basis lists the basis-change gates applied before the measurement,
+	// in program order
+	Basis []string `json:"basis,omitempty"`
+
+	Position parser.Position `json:"position"`
+}
+
+// Observable is the Pauli string one classical register records per
+// shot: the tensor product of the terms of its bits
+type Observable struct {
+	Register string `json:"register"`
+
+	// Pauli is the string in bit order, bit 0 first, e.g. "XIZ"
+	Pauli string `json:"pauli"`
+
+	// Sign is -1 when an odd number of terms are negated, so the parity
+	// of the register's bits estimates -Pauli
+	Sign  int    `json:"sign"`
+	Terms []Term `json:"terms"`
+}
+
+// Known reports whether every measured bit of the register records a
+// Pauli operator
+func (o Observable) Known() bool {
+	return !strings.Contains(o.Pauli, string(Unknown))
+}
+
+// Extract returns the observable of each classical register a
+// measurement writes, in declaration order. Measurements without a
+// target are not recorded and are skipped.
+//
+// The basis of a measurement is reconstructed from the single-qubit
+// gates applied to its qubit since the last multi-qubit gate or
+// measurement on it: the Clifford gates h, x, y, z, s, sdg, sx and sxdg,
+// inv @ of those, and gates the program defines from them. Any other
+// gate makes the term Unknown. Control flow is read as straight-line
+// code and the last measurement of a bit wins, as it does in the shot
+// record.
+func Extract(program *parser.Program) []Observable {
+	e := &extractor{
+		gates:     make(map[string]*parser.GateDefinition),
+		registers: make(map[string]int),
+		trailing:  make(map[string][]string),
+		terms:     make(map[string]map[int]Term),
+	}
+	for _, stmt := range program.Statements {
+		if def, ok := stmt.(*parser.GateDefinition); ok {
+			e.gates[def.Name] = def
+		}
+	}
+	e.statements(program.Statements)
+
+	var observables []Observable
+	for _, name := range e.bits {
+		terms, ok := e.terms[name]
+		if !ok {
+			continue
+		}
+		size := e.registers[name]
+		o := Observable{Register: name, Sign: 1}
+		var pauli strings.Builder
+		for i := 0; i < max(size, 1); i++ {
+			term, ok := terms[i]
+			if !ok {
+				pauli.WriteString(string(I))
+				continue
+			}
+			pauli.WriteString(string(term.Pauli))
+			if term.Negated {
+				o.Sign = -o.Sign
+			}
+			o.Terms = append(o.Terms, term)
+		}
+		o.Pauli = pauli.String()
+		observables = append(observables, o)
+	}
+	return observables
+}
+
+type extractor struct {
+	gates map[string]*parser.GateDefinition
+
+	// registers maps each register to its size, 0 for a single qubit or
+	// bit; bits lists the classical bit registers in declaration order
+	registers map[string]int
+	bits      []string
+
+	// trailing maps each qubit to the gates applied to it alone since the
+	// last multi-qubit gate or measurement
+	trailing map[string][]string
+
+	// terms maps each bit register to the term of each bit index
+	terms map[string]map[int]Term
+}
+
+func (e *extractor) statements(statements []parser.Statement) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.QuantumDeclaration:
+			e.registers[s.Identifier] = size(s.Size)
+		case *parser.ClassicalDeclaration:
+			if s.Type == "bit" {
+				e.registers[s.Identifier] = size(s.Size)
+				e.bits = append(e.bits, s.Identifier)
+			}
+			if m, ok := s.Initializer.(*parser.MeasureExpression); ok {
+				e.measure(m.Qubit, &parser.Identifier{Name: s.Identifier}, s.Pos())
+			}
+		case *parser.GateCall:
+			e.apply(s)
+		case *parser.Measurement:
+			e.measure(s.Qubit, s.Target, s.Pos())
+		case *parser.Reset:
+			// A reset discards any basis change before it
+			for _, q := range e.qubits(s.Qubit) {
+				delete(e.trailing, q)
+			}
+		case *parser.IfStatement:
+			e.statements(s.ThenBody)
+			e.statements(s.ElseBody)
+		case *parser.ForStatement:
+			e.statements(s.Body)
+		case *parser.WhileStatement:
+			e.statements(s.Body)
+		}
+	}
+}
+
+// apply records a gate call. A call on a single qubit extends the
+// qubit's basis change; a call on several ends the basis change of each.
+func (e *extractor) apply(call *parser.GateCall) {
+	name := call.Name
+	if len(call.Modifiers) == 1 && call.Modifiers[0].Type == "inv" {
+		name = "inv @ " + name
+	} else if len(call.Modifiers) > 0 {
+		name = "?"
+	}
+
+	if len(call.Qubits) == 1 {
+		for _, q := range e.qubits(call.Qubits[0]) {
+			e.trailing[q] = append(e.trailing[q], name)
+		}
+		return
+	}
+	for _, op := range call.Qubits {
+		for _, q := range e.qubits(op) {
+			delete(e.trailing, q)
+		}
+	}
+}
+
+// measure records the measurement of qubit into target
+func (e *extractor) measure(qubit, target parser.Expression, pos parser.Position) {
+	qubits := e.qubits(qubit)
+	if target == nil {
+		for _, q := range qubits {
+			delete(e.trailing, q)
+		}
+		return
+	}
+	name, bits := e.indices(target)
+	if name == "" {
+		return
+	}
+	if e.terms[name] == nil {
+		e.terms[name] = make(map[int]Term)
+	}
+	for i, q := range qubits {
+		if i >= len(bits) {
+			break
+		}
+		basis := e.trailing[q]
+		pauli, negated := e.conjugate(basis)
+		e.terms[name][bits[i]] = Term{
+			Bit:      element(name, bits[i], e.registers[name]),
+			Qubit:    q,
+			Pauli:    pauli,
+			Negated:  negated,
+			Basis:    basis,
+			Position: pos,
+		}
+		delete(e.trailing, q)
+	}
+}
+
+// conjugate returns the operator measured by measuring Z after the
+// gates of basis: G† Z G for their product G. Gates are undone from the
+// last one, which the measurement sees first.
+func (e *extractor) conjugate(basis []string) (Pauli, bool) {
+	p, negated := Z, false
+	var undo func(gates []string, expanding map[string]bool) bool
+	undo = func(gates []string, expanding map[string]bool) bool {
+		for i := len(gates) - 1; i >= 0; i-- {
+			name := gates[i]
+			if rule, ok := conjugations[name]; ok {
+				next := rule[p]
+				p, negated = next.pauli, negated != next.negated
+				continue
+			}
+			def, ok := e.gates[name]
+			if !ok || expanding[name] || len(def.Qubits) != 1 {
+				return false
+			}
+			var body []string
+			for _, stmt := range def.Body {
+				call, ok := stmt.(*parser.GateCall)
+				if !ok || len(call.Modifiers) > 0 {
+					return false
+				}
+				body = append(body, call.Name)
+			}
+			expanding[name] = true
+			ok = undo(body, expanding)
+			delete(expanding, name)
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+	if !undo(basis, make(map[string]bool)) {
+		return Unknown, false
+	}
+	return p, negated
+}
+
+// image is where conjugating by a gate takes a Pauli operator
+type image struct {
+	pauli   Pauli
+	negated bool
+}
+
+// conjugations maps each Clifford basis-change gate G to P -> G† P G
+var conjugations = map[string]map[Pauli]image{
+	"id":   {X: {X, false}, Y: {Y, false}, Z: {Z, false}},
+	"h":    {X: {Z, false}, Y: {Y, true}, Z: {X, false}},
+	"x":    {X: {X, false}, Y: {Y, true}, Z: {Z, true}},
+	"y":    {X: {X, true}, Y: {Y, false}, Z: {Z, true}},
+	"z":    {X: {X, true}, Y: {Y, true}, Z: {Z, false}},
+	"s":    {X: {Y, true}, Y: {X, false}, Z: {Z, false}},
+	"sdg":  {X: {Y, false}, Y: {X, true}, Z: {Z, false}},
+	"sx":   {X: {X, false}, Y: {Z, true}, Z: {Y, false}},
+	"sxdg": {X: {X, false}, Y: {Z, false}, Z: {Y, true}},
+}
+
+func init() {
+	// The inverse of a gate conjugates the other way; the self-inverse
+	// gates are their own
+	for _, pair := range [][2]string{{"s", "sdg"}, {"sx", "sxdg"}, {"id", "id"}, {"h", "h"}, {"x", "x"}, {"y", "y"}, {"z", "z"}} {
+		conjugations["inv @ "+pair[0]] = conjugations[pair[1]]
+		conjugations["inv @ "+pair[1]] = conjugations[pair[0]]
+	}
+}
+
+// qubits returns the qubits an operand refers to, as in stats: q[i] for
+// each qubit of a register, or the operand itself when it cannot be
+// resolved
+func (e *extractor) qubits(operand parser.Expression) []string {
+	name, indices := e.indices(operand)
+	if name == "" {
+		return nil
+	}
+	names := make([]string, len(indices))
+	for i, idx := range indices {
+		names[i] = element(name, idx, e.registers[name])
+	}
+	return names
+}
+
+// indices resolves an operand to its register and the indices it
+// selects, in order. A single qubit or bit has the one index 0.
+func (e *extractor) indices(operand parser.Expression) (string, []int) {
+	switch op := operand.(type) {
+	case *parser.Identifier:
+		n := e.registers[op.Name]
+		if n == 0 {
+			return op.Name, []int{0}
+		}
+		indices := make([]int, n)
+		for i := range indices {
+			indices[i] = i
+		}
+		return op.Name, indices
+	case *parser.IndexedIdentifier:
+		if lit, ok := op.Index.(*parser.IntegerLiteral); ok {
+			return op.Name, []int{int(lit.Value)}
+		}
+	case *parser.RangedIdentifier:
+		start, ok1 := op.Start.(*parser.IntegerLiteral)
+		stop, ok2 := op.EndIndex.(*parser.IntegerLiteral)
+		if ok1 && ok2 {
+			var indices []int
+			for i := start.Value; i <= stop.Value; i++ {
+				indices = append(indices, int(i))
+			}
+			return op.Name, indices
+		}
+	}
+	return "", nil
+}
+
+// element names index of a register of size, or the register itself if
+// it is a single qubit or bit
+func element(name string, index, size int) string {
+	if size == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s[%d]", name, index)
+}
+
+// size returns the size of a declaration, 0 for a single qubit or bit
+// or a size that is not an integer literal
+func size(expr parser.Expression) int {
+	if lit, ok := expr.(*parser.IntegerLiteral); ok {
+		return int(lit.Value)
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package observable
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func extract(t *testing.T, src string) []Observable {
+	t.Helper()
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Extract(program)
+}
+
+func TestExtract(t *testing.T) {
+	obs := extract(t, `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[4] q;
+bit[4] c;
+bit[2] d;
+bit unused;
+h q[0];
+cx q[0], q[1];
+h q[0];
+sdg q[1];
+h q[1];
+x q[3];
+c = measure q;
+`)
+	if len(obs) != 1 {
+		t.Fatalf("Extract() = %+v, want one observable", obs)
+	}
+	o := obs[0]
+	if o.Register != "c" || o.Pauli != "XYZZ" || o.Sign != -1 || !o.Known() {
+		t.Errorf("observable = %s %s sign %d", o.Register, o.Pauli, o.Sign)
+	}
+	if len(o.Terms) != 4 || o.Terms[1].Bit != "c[1]" || o.Terms[1].Qubit != "q[1]" || strings.Join(o.Terms[1].Basis, ",") != "sdg,h" {
+		t.Errorf("Terms = %+v", o.Terms)
+	}
+	if !o.Terms[3].Negated || o.Terms[2].Negated {
+		t.Errorf("x before measurement should negate only q[3]: %+v", o.Terms)
+	}
+}
+
+func TestExtractPerBit(t *testing.T) {
+	obs := extract(t, `OPENQASM 3.0;
+gate ybasis a { sdg a; h a; }
+qubit[3] q;
+bit[3] c;
+bit r;
+ybasis q[0];
+inv @ s q[1];
+h q[1];
+rx(0.3) q[2];
+c[0] = measure q[0];
+c[2] = measure q[2];
+measure q[1] -> r;
+`)
+	if len(obs) != 2 {
+		t.Fatalf("Extract() = %+v, want two observables", obs)
+	}
+	if c := obs[0]; c.Pauli != "YI?" || c.Known() {
+		t.Errorf("c = %s, want YI?", c.Pauli)
+	}
+	if r := obs[1]; r.Register != "r" || r.Pauli != "Y" || r.Terms[0].Bit != "r" {
+		t.Errorf("r = %+v", r)
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	obs := extract(t, `OPENQASM 3.0;
+qubit q;
+bit c;
+h q;
+c = measure q;
+`)
+	data, err := json.Marshal(obs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"register":"c","pauli":"X","sign":1,"terms":[{"bit":"c","qubit":"q","pauli":"X","basis":["h"],"position":{"line":5,"column":1,"offset":35}}]}]`
+	if string(data) != want {
+		t.Errorf("JSON = %s\nwant %s", data, want)
+	}
+}
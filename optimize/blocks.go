@@ -0,0 +1,299 @@
+// Package optimize rewrites programs into equivalent ones with fewer
+// operations, before they are rebased onto a target's gates or
+// exported.
+package optimize
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/sim"
+	"github.com/orangekame3/qasmparser/stdlib"
+)
+
+// Block is a run of gates ConsolidateBlocks replaced with one call
+type Block struct {
+	// Gate names the definition the run became
+	Gate string `json:"gate"`
+
+	// Qubits are the two qubits of the run, as written in the program
+	Qubits [2]string `json:"qubits"`
+
+	// Gates is the number of gates in the run
+	Gates int `json:"gates"`
+
+	// Position is where the run started
+	Position parser.Position `json:"position"`
+
+	// Unitary is the matrix of the definition, first qubit most
+	// significant, when its gates are known and it has no parameters
+	Unitary sim.Matrix `json:"-"`
+}
+
+// ConsolidateBlocks groups each maximal run of gates acting only on the
+// same two qubits into a call of a new gate definition and returns the
+// rewritten copy of program, with the blocks it made in source order;
+// program itself is not modified.
+//
+//	h q[0]; cx q[0], q[1]; rz(pi / 4) q[1]; cx q[0], q[1];
+//
+// becomes
+//
+//	gate block0 a, b { h a; cx a, b; rz(pi / 4) b; cx a, b; }
+//	block0 q[0], q[1];
+//
+// A run starts at a two-qubit gate, taking along the one-qubit gates on
+// either qubit before it, and ends at the first operation on one of its
+// qubits and a third qubit, or at a measurement, reset, barrier or
+// control flow statement touching them. Gates on other qubits may
+// interleave. Runs are only formed within one block of statements, and
+// only runs of at least two gates are replaced. Parameters that are not
+// constant, such as rz(theta), become parameters of the definition, and
+// runs with the same gates share one definition, placed before its
+// first call. Operands must be single qubits: q[i] with a literal i,
+// single qubits declared at the top level or hardware qubits.
+func ConsolidateBlocks(program *parser.Program) (*parser.Program, []Block) {
+	c := &consolidator{
+		qubits: newQubits(program),
+		gates:  sim.GatesOf(program),
+		defs:   make(map[string]*parser.GateDefinition),
+		at:     make(map[*parser.GateDefinition]int),
+	}
+	var statements []parser.Statement
+	for i, stmt := range program.Statements {
+		c.current = i
+		statements = append(statements, bodies(stmt, func(body []parser.Statement) []parser.Statement {
+			return compact(c.statements(body, false))
+		}))
+	}
+	statements = c.statements(statements, true)
+
+	// Place each new definition before the first top-level statement
+	// that calls it
+	before := make(map[int][]parser.Statement)
+	for _, def := range c.order {
+		before[c.at[def]] = append(before[c.at[def]], def)
+	}
+	out := make([]parser.Statement, 0, len(statements)+len(c.order))
+	for i, stmt := range statements {
+		out = append(out, before[i]...)
+		if stmt != nil {
+			out = append(out, stmt)
+		}
+	}
+	sort.SliceStable(c.blocks, func(i, j int) bool {
+		return c.blocks[i].Position.Offset < c.blocks[j].Position.Offset
+	})
+
+	consolidated := *program
+	consolidated.Statements = out
+	return &consolidated, c.blocks
+}
+
+type consolidator struct {
+	qubits *qubits
+	gates  sim.Gates
+
+	// defs maps the body of each new definition to it; order lists them
+	// as made and at holds the top-level statement each must precede
+	defs  map[string]*parser.GateDefinition
+	order []*parser.GateDefinition
+	at    map[*parser.GateDefinition]int
+
+	// current is the index of the top-level statement being rewritten
+	current int
+	blocks  []Block
+}
+
+// run is a run of gates on two qubits, by statement index
+type run struct {
+	qubits  [2]string
+	indices []int
+}
+
+// statements replaces the runs of one block of statements with calls.
+// The call of a run takes the place of its last gate and its other gates
+// become nil, so indices into the block stay valid.
+func (c *consolidator) statements(statements []parser.Statement, top bool) []parser.Statement {
+	var runs []*run
+	open := make(map[string]*run)
+	single := make(map[string][]int)
+	end := func(q string) {
+		if r := open[q]; r != nil {
+			delete(open, r.qubits[0])
+			delete(open, r.qubits[1])
+		}
+		delete(single, q)
+	}
+	endAll := func() {
+		clear(open)
+		clear(single)
+	}
+
+	for i, stmt := range statements {
+		qubits, ok := c.qubits.operands(stmt)
+		call, isCall := stmt.(*parser.GateCall)
+		switch {
+		case !ok:
+			endAll()
+		case !isCall || len(qubits) > 2 || !liftable(call):
+			for _, q := range qubits {
+				end(q)
+			}
+		case len(qubits) == 1:
+			q := qubits[0]
+			if r := open[q]; r != nil {
+				r.indices = append(r.indices, i)
+			} else {
+				single[q] = append(single[q], i)
+			}
+		case len(qubits) == 2:
+			a, b := qubits[0], qubits[1]
+			if r := open[a]; r != nil && r == open[b] {
+				r.indices = append(r.indices, i)
+				continue
+			}
+			pending := append(single[a], single[b]...)
+			end(a)
+			end(b)
+			sort.Ints(pending)
+			r := &run{qubits: [2]string{a, b}, indices: append(pending, i)}
+			open[a], open[b] = r, r
+			runs = append(runs, r)
+		}
+	}
+
+	out := append([]parser.Statement(nil), statements...)
+	for _, r := range runs {
+		if len(r.indices) < 2 {
+			continue
+		}
+		last := r.indices[len(r.indices)-1]
+		calls := make([]*parser.GateCall, len(r.indices))
+		for j, index := range r.indices {
+			calls[j] = statements[index].(*parser.GateCall)
+			out[index] = nil
+		}
+		out[last] = c.replace(r, calls, top, last)
+	}
+	return out
+}
+
+// replace returns the call of the definition for a run of calls
+func (c *consolidator) replace(r *run, calls []*parser.GateCall, top bool, last int) parser.Statement {
+	formal := map[string]string{r.qubits[0]: "a", r.qubits[1]: "b"}
+	def := &parser.GateDefinition{Qubits: []parser.Parameter{{Name: "a"}, {Name: "b"}}}
+	call := &parser.GateCall{BaseNode: calls[len(calls)-1].BaseNode}
+	for _, g := range calls {
+		body := *g
+		body.BaseNode = parser.BaseNode{}
+		body.Parameters = make([]parser.Expression, len(g.Parameters))
+		for i, p := range g.Parameters {
+			if constant(p) {
+				body.Parameters[i] = p
+				continue
+			}
+			name := "p" + strconv.Itoa(len(def.Parameters))
+			def.Parameters = append(def.Parameters, parser.Parameter{Name: name})
+			call.Parameters = append(call.Parameters, p)
+			body.Parameters[i] = &parser.Identifier{Name: name}
+		}
+		body.Qubits = make([]parser.Expression, len(g.Qubits))
+		for i, q := range g.Qubits {
+			body.Qubits[i] = &parser.Identifier{Name: formal[printer.Expression(q)]}
+		}
+		def.Body = append(def.Body, &body)
+	}
+	for _, q := range r.qubits {
+		call.Qubits = append(call.Qubits, operand(calls, q))
+	}
+
+	key := printer.Statement(def)
+	if existing, ok := c.defs[key]; ok {
+		def = existing
+	} else {
+		def.Name = c.name()
+		c.defs[key] = def
+		c.order = append(c.order, def)
+		c.at[def] = -1
+	}
+	at := c.current
+	if top {
+		at = last
+	}
+	if c.at[def] < 0 || at < c.at[def] {
+		c.at[def] = at
+	}
+	call.Name = def.Name
+	block := Block{Gate: def.Name, Qubits: r.qubits, Gates: len(calls), Position: calls[0].Pos()}
+	if len(def.Parameters) == 0 {
+		block.Unitary, _ = c.gates.UnitaryOf(def, nil)
+	}
+	c.blocks = append(c.blocks, block)
+	return call
+}
+
+// operand returns the operand of calls that is q
+func operand(calls []*parser.GateCall, q string) parser.Expression {
+	for _, g := range calls {
+		for _, op := range g.Qubits {
+			if printer.Expression(op) == q {
+				return op
+			}
+		}
+	}
+	return &parser.Identifier{Name: q}
+}
+
+func (c *consolidator) name() string {
+	for i := len(c.order); ; i++ {
+		name := "block" + strconv.Itoa(i)
+		if !c.qubits.names[name] {
+			c.qubits.names[name] = true
+			return name
+		}
+	}
+}
+
+// liftable reports whether a gate call can go into a definition: its
+// modifiers must be constant, as their arguments cannot be lifted
+func liftable(call *parser.GateCall) bool {
+	for _, m := range call.Modifiers {
+		for _, p := range m.Parameters {
+			if !constant(p) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// constant reports whether expr only uses literals, predefined
+// constants and builtin functions
+func constant(expr parser.Expression) bool {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral, *parser.FloatLiteral, *parser.BooleanLiteral:
+		return true
+	case *parser.Identifier:
+		return stdlib.IsConstant(e.Name)
+	case *parser.ParenthesizedExpression:
+		return constant(e.Expression)
+	case *parser.UnaryExpression:
+		return constant(e.Operand)
+	case *parser.BinaryExpression:
+		return constant(e.Left) && constant(e.Right)
+	case *parser.FunctionCall:
+		if !stdlib.IsFunction(e.Name) {
+			return false
+		}
+		for _, arg := range e.Arguments {
+			if !constant(arg) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
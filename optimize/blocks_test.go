@@ -0,0 +1,120 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/sim"
+)
+
+func TestConsolidateBlocks(t *testing.T) {
+	const header = "OPENQASM 3.0;\nqubit[3] q;\n"
+	tests := []struct {
+		name   string
+		src    string
+		want   string
+		blocks int
+	}{
+		{
+			name:   "run with single qubit gates",
+			src:    "h q[0];\ncx q[0], q[1];\nrz(pi / 4) q[1];\ncx q[0], q[1];\n",
+			want:   "gate block0 a, b {\n  h a;\n  cx a, b;\n  rz(pi / 4) b;\n  cx a, b;\n}\nblock0 q[0], q[1];\n",
+			blocks: 1,
+		},
+		{
+			name:   "interleaved gates on other qubits",
+			src:    "cx q[0], q[1];\nh q[2];\ncx q[1], q[0];\n",
+			want:   "h q[2];\ngate block0 a, b {\n  cx a, b;\n  cx b, a;\n}\nblock0 q[0], q[1];\n",
+			blocks: 1,
+		},
+		{
+			name: "third qubit ends the run",
+			src:  "cx q[0], q[1];\ncx q[1], q[2];\ncx q[0], q[1];\n",
+			want: "cx q[0], q[1];\ncx q[1], q[2];\ncx q[0], q[1];\n",
+		},
+		{
+			name:   "parameters are lifted",
+			src:    "float theta;\ncx q[0], q[1];\nrz(theta) q[1];\ncx q[0], q[1];\ncx q[1], q[2];\nrz(2 * theta) q[2];\ncx q[1], q[2];\n",
+			want:   "float theta;\ngate block0(p0) a, b {\n  cx a, b;\n  rz(p0) b;\n  cx a, b;\n}\nblock0(theta) q[0], q[1];\nblock0(2 * theta) q[1], q[2];\n",
+			blocks: 2,
+		},
+		{
+			name: "measurement ends the run",
+			src:  "bit c;\ncx q[0], q[1];\nc = measure q[1];\ncx q[0], q[1];\n",
+			want: "bit c;\ncx q[0], q[1];\nmeasure q[1] -> c;\ncx q[0], q[1];\n",
+		},
+		{
+			name:   "registers are not split",
+			src:    "h q;\ncx q[0], q[1];\ncz q[0], q[1];\n",
+			want:   "h q;\ngate block0 a, b {\n  cx a, b;\n  cz a, b;\n}\nblock0 q[0], q[1];\n",
+			blocks: 1,
+		},
+		{
+			name:   "loop bodies",
+			src:    "for int i in [0:2] {\n  cx q[0], q[1];\n  cz q[0], q[1];\n}\n",
+			want:   "gate block0 a, b {\n  cx a, b;\n  cz a, b;\n}\nfor int i in [0:2] {\n  block0 q[0], q[1];\n}\n",
+			blocks: 1,
+		},
+		{
+			name:   "names are unique",
+			src:    "gate block0 a { x a; }\ncx $0, $1;\ncz $0, $1;\n",
+			want:   "gate block0 a {\n  x a;\n}\ngate block1 a, b {\n  cx a, b;\n  cz a, b;\n}\nblock1 $0, $1;\n",
+			blocks: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := parser.NewParser().ParseString(header + tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := printer.Print(program)
+			got, blocks := ConsolidateBlocks(program)
+			if out := printer.Print(got); out != header+tt.want {
+				t.Errorf("got\n%s\nwant\n%s", out, header+tt.want)
+			}
+			if len(blocks) != tt.blocks {
+				t.Errorf("got %d blocks, want %d", len(blocks), tt.blocks)
+			}
+			if printer.Print(program) != before {
+				t.Error("program was modified")
+			}
+		})
+	}
+}
+
+func TestConsolidateBlocksReport(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit[2] q;\nh q[1];\ncx q[0], q[1];\nx q[0];\n"
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, blocks := ConsolidateBlocks(program)
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(blocks))
+	}
+	b := blocks[0]
+	if b.Gate != "block0" || b.Qubits != [2]string{"q[0]", "q[1]"} || b.Gates != 3 || b.Position.Line != 3 {
+		t.Errorf("got %+v", b)
+	}
+	// h on q[1], then cx, then x on q[0]
+	h, _ := sim.Gate("h", nil)
+	cx, _ := sim.Gate("cx", nil)
+	x, _ := sim.Gate("x", nil)
+	want := kron(x, sim.Identity(2)).Mul(cx).Mul(kron(sim.Identity(2), h))
+	if d := sim.Distance(b.Unitary, want); d > 1e-12 {
+		t.Errorf("unitary is %g off", d)
+	}
+}
+
+// kron returns the tensor product of two 2×2 matrices
+func kron(a, b sim.Matrix) sim.Matrix {
+	out := sim.Identity(4)
+	for i := range 4 {
+		for j := range 4 {
+			out[i][j] = a[i/2][j/2] * b[i%2][j%2]
+		}
+	}
+	return out
+}
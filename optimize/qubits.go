@@ -0,0 +1,158 @@
+package optimize
+
+import (
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// qubits tells apart the single qubits a program's statements act on
+type qubits struct {
+	// sizes maps each quantum register to its size, 0 for a single
+	// qubit and -1 for a size that is not a literal; names holds every
+	// name the program uses
+	sizes map[string]int
+	names map[string]bool
+}
+
+func newQubits(program *parser.Program) *qubits {
+	q := &qubits{sizes: make(map[string]int), names: make(map[string]bool)}
+	parser.Walk(parser.NewDepthFirstVisitor(&declarations{q: q}), program)
+	return q
+}
+
+// operands returns the single qubits a statement acts on, false if it
+// may act on qubits that cannot be told apart or change the values gate
+// parameters read. Other statements without qubits act on none.
+func (q *qubits) operands(stmt parser.Statement) ([]string, bool) {
+	var ops []parser.Expression
+	switch s := stmt.(type) {
+	case *parser.GateCall:
+		ops = s.Qubits
+	case *parser.Measurement:
+		ops = []parser.Expression{s.Qubit}
+	case *parser.Reset:
+		ops = []parser.Expression{s.Qubit}
+	case *parser.Barrier:
+		if len(s.Qubits) == 0 {
+			return nil, false
+		}
+		ops = s.Qubits
+	case *parser.ClassicalDeclaration:
+		if m, ok := s.Initializer.(*parser.MeasureExpression); ok {
+			ops = []parser.Expression{m.Qubit}
+		}
+	case *parser.IfStatement, *parser.ForStatement, *parser.WhileStatement, *parser.Assignment, *parser.BadStatement, *parser.RawStatement:
+		return nil, false
+	}
+	names := make([]string, len(ops))
+	for i, op := range ops {
+		if !q.single(op) {
+			return nil, false
+		}
+		names[i] = printer.Expression(op)
+	}
+	return names, true
+}
+
+// single reports whether op names one qubit: q[i] with a literal i, a
+// single qubit declared at the top level or a hardware qubit
+func (q *qubits) single(op parser.Expression) bool {
+	switch e := op.(type) {
+	case *parser.Identifier:
+		size, declared := q.sizes[e.Name]
+		return strings.HasPrefix(e.Name, "$") || declared && size == 0
+	case *parser.IndexedIdentifier:
+		size, declared := q.sizes[e.Name]
+		_, literal := e.Index.(*parser.IntegerLiteral)
+		return declared && size > 0 && literal
+	}
+	return false
+}
+
+// bodies returns a copy of a control flow statement or subroutine with
+// f applied to each of its bodies, innermost first; other statements are
+// returned as they are
+func bodies(stmt parser.Statement, f func([]parser.Statement) []parser.Statement) parser.Statement {
+	each := func(body []parser.Statement) []parser.Statement {
+		out := make([]parser.Statement, len(body))
+		for i, s := range body {
+			out[i] = bodies(s, f)
+		}
+		return f(out)
+	}
+	switch s := stmt.(type) {
+	case *parser.IfStatement:
+		branch := *s
+		branch.ThenBody = each(s.ThenBody)
+		branch.ElseBody = each(s.ElseBody)
+		return &branch
+	case *parser.ForStatement:
+		loop := *s
+		loop.Body = each(s.Body)
+		return &loop
+	case *parser.WhileStatement:
+		loop := *s
+		loop.Body = each(s.Body)
+		return &loop
+	case *parser.SubroutineDefinition:
+		def := *s
+		def.Body = each(s.Body)
+		return &def
+	}
+	return stmt
+}
+
+// compact drops the nil statements of a rewritten block
+func compact(statements []parser.Statement) []parser.Statement {
+	out := statements[:0]
+	for _, stmt := range statements {
+		if stmt != nil {
+			out = append(out, stmt)
+		}
+	}
+	return out
+}
+
+// declarations collects the qubits and names of a program
+type declarations struct {
+	parser.BaseVisitor
+	q *qubits
+}
+
+func (d *declarations) VisitQuantumDeclaration(node *parser.QuantumDeclaration) interface{} {
+	d.q.names[node.Identifier] = true
+	d.q.sizes[node.Identifier] = 0
+	if lit, ok := node.Size.(*parser.IntegerLiteral); ok {
+		d.q.sizes[node.Identifier] = int(lit.Value)
+	} else if node.Size != nil {
+		d.q.sizes[node.Identifier] = -1
+	}
+	return nil
+}
+
+func (d *declarations) VisitParameter(node *parser.Parameter) interface{} {
+	d.q.names[node.Name] = true
+	return nil
+}
+
+func (d *declarations) VisitGateDefinition(node *parser.GateDefinition) interface{} {
+	d.q.names[node.Name] = true
+	return nil
+}
+
+func (d *declarations) VisitSubroutineDefinition(node *parser.SubroutineDefinition) interface{} {
+	d.q.names[node.Name] = true
+	return nil
+}
+
+func (d *declarations) VisitClassicalDeclaration(node *parser.ClassicalDeclaration) interface{} {
+	d.q.names[node.Identifier] = true
+	return nil
+}
+
+func (d *declarations) VisitIdentifier(node *parser.Identifier) interface{} {
+	d.q.names[node.Name] = true
+	return nil
+}
@@ -0,0 +1,296 @@
+package optimize
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/sim"
+)
+
+// Basis names the gates MergeRotations writes a merged run with
+type Basis string
+
+const (
+	// BasisU writes one builtin U(θ, φ, λ)
+	BasisU Basis = "U"
+
+	// BasisU3 writes one u3(θ, φ, λ) from stdgates.inc
+	BasisU3 Basis = "u3"
+
+	// BasisZSX writes rz(λ); sx; rz(θ + π); sx; rz(φ + π), or a single
+	// rz when θ is zero, for devices whose native gates are rz and sx.
+	// Rotations by zero are left out.
+	BasisZSX Basis = "rz,sx"
+)
+
+// DefaultTolerance is the tolerance MergeRotations uses when none is
+// given
+const DefaultTolerance = 1e-9
+
+// RotationOptions configures MergeRotations
+type RotationOptions struct {
+	// Basis is the gates merged runs are written with; empty means
+	// BasisU
+	Basis Basis
+
+	// Tolerance is the largest deviation accepted between the unitary of
+	// a run and that of the gates replacing it, entry by entry and up to
+	// global phase. Runs within it of the identity are removed. Zero
+	// means DefaultTolerance.
+	Tolerance float64
+}
+
+// RotationReport is the audit trail of MergeRotations: what it merged,
+// with which settings, and how far each replacement is from the gates
+// it replaced
+type RotationReport struct {
+	Basis     Basis   `json:"basis"`
+	Tolerance float64 `json:"tolerance"`
+	Merges    []Merge `json:"merges"`
+}
+
+// Merge is a run of single-qubit gates MergeRotations replaced
+type Merge struct {
+	// Qubit is the qubit of the run, as written in the program
+	Qubit string `json:"qubit"`
+
+	// Gates is the number of gates in the run and Replacement the
+	// number written in its place
+	Gates       int `json:"gates"`
+	Replacement int `json:"replacement"`
+
+	// Deviation is the largest difference between an entry of the run's
+	// unitary and the replacement's, up to global phase
+	Deviation float64 `json:"deviation"`
+
+	// Position is where the run started
+	Position parser.Position `json:"position"`
+}
+
+// MergeRotations replaces each run of single-qubit gates on one qubit
+// with the equivalent gates of a basis, computed from the run's unitary,
+// and returns the rewritten copy of program with its report; program
+// itself is not modified.
+//
+//	h q[0]; t q[0]; h q[0];
+//
+// becomes, in BasisU,
+//
+//	U(pi/4, -pi/2, pi/2) q[0];
+//
+// Runs are formed within one block of statements from standard gates
+// whose parameters are constant, inverted or not, on single qubits as
+// ConsolidateBlocks takes them. A run ends at any other operation on its
+// qubit. A run is only replaced when the replacement has fewer gates and
+// stays within the tolerance.
+func MergeRotations(program *parser.Program, opts *RotationOptions) (*parser.Program, *RotationReport, error) {
+	if opts == nil {
+		opts = &RotationOptions{}
+	}
+	m := &merger{qubits: newQubits(program), basis: opts.Basis, tolerance: opts.Tolerance}
+	if m.basis == "" {
+		m.basis = BasisU
+	}
+	if m.tolerance == 0 {
+		m.tolerance = DefaultTolerance
+	}
+	switch m.basis {
+	case BasisU, BasisU3, BasisZSX:
+	default:
+		return nil, nil, fmt.Errorf("unknown basis %q; use %s, %s or %s", m.basis, BasisU, BasisU3, BasisZSX)
+	}
+	if m.tolerance < 0 {
+		return nil, nil, fmt.Errorf("tolerance %v is negative", m.tolerance)
+	}
+
+	var statements []parser.Statement
+	for _, stmt := range program.Statements {
+		statements = append(statements, bodies(stmt, m.statements))
+	}
+	merged := *program
+	merged.Statements = m.statements(statements)
+
+	sort.SliceStable(m.merges, func(i, j int) bool {
+		return m.merges[i].Position.Offset < m.merges[j].Position.Offset
+	})
+	report := &RotationReport{Basis: m.basis, Tolerance: m.tolerance, Merges: m.merges}
+	if report.Merges == nil {
+		report.Merges = []Merge{}
+	}
+	return &merged, report, nil
+}
+
+type merger struct {
+	qubits    *qubits
+	basis     Basis
+	tolerance float64
+	merges    []Merge
+}
+
+// statements merges the runs of one block of statements
+func (m *merger) statements(statements []parser.Statement) []parser.Statement {
+	type run struct {
+		indices  []int
+		matrices []sim.Matrix
+	}
+	open := make(map[string]*run)
+	removed := make(map[int]bool)
+	replacements := make(map[int][]parser.Statement)
+	flush := func(q string) {
+		r := open[q]
+		delete(open, q)
+		if r == nil || len(r.indices) < 2 {
+			return
+		}
+		first := statements[r.indices[0]].(*parser.GateCall)
+		replacement, ok := m.merge(q, first, r.matrices)
+		if !ok {
+			return
+		}
+		for _, i := range r.indices {
+			removed[i] = true
+		}
+		replacements[r.indices[len(r.indices)-1]] = replacement
+	}
+	flushAll := func() {
+		for q := range open {
+			flush(q)
+		}
+	}
+
+	for i, stmt := range statements {
+		qubits, ok := m.qubits.operands(stmt)
+		if !ok {
+			flushAll()
+			continue
+		}
+		if call, isCall := stmt.(*parser.GateCall); isCall && len(qubits) == 1 {
+			if matrix, ok := unitary(call); ok {
+				r := open[qubits[0]]
+				if r == nil {
+					r = &run{}
+					open[qubits[0]] = r
+				}
+				r.indices = append(r.indices, i)
+				r.matrices = append(r.matrices, matrix)
+				continue
+			}
+		}
+		for _, q := range qubits {
+			flush(q)
+		}
+	}
+	flushAll()
+
+	var out []parser.Statement
+	for i, stmt := range statements {
+		if replacement, ok := replacements[i]; ok {
+			out = append(out, replacement...)
+		} else if !removed[i] {
+			out = append(out, stmt)
+		}
+	}
+	return out
+}
+
+// merge returns the gates replacing a run with the given matrices, in
+// the order they apply, false if they are not fewer or not close enough
+func (m *merger) merge(q string, first *parser.GateCall, matrices []sim.Matrix) ([]parser.Statement, bool) {
+	product := sim.Identity(2)
+	for _, matrix := range matrices {
+		product = matrix.Mul(product)
+	}
+	var gates []*parser.GateCall
+	if sim.Distance(product, sim.Identity(2)) > m.tolerance {
+		gates = m.decompose(product)
+	}
+	if len(gates) >= len(matrices) {
+		return nil, false
+	}
+
+	written := sim.Identity(2)
+	statements := make([]parser.Statement, len(gates))
+	for i, g := range gates {
+		params := make([]float64, len(g.Parameters))
+		for j, p := range g.Parameters {
+			params[j] = p.(*parser.FloatLiteral).Value
+		}
+		matrix, _ := sim.Gate(g.Name, params)
+		written = matrix.Mul(written)
+		g.Qubits = []parser.Expression{first.Qubits[0]}
+		statements[i] = g
+	}
+	deviation := sim.Distance(product, written)
+	if deviation > m.tolerance {
+		return nil, false
+	}
+	m.merges = append(m.merges, Merge{
+		Qubit:       q,
+		Gates:       len(matrices),
+		Replacement: len(gates),
+		Deviation:   deviation,
+		Position:    first.Pos(),
+	})
+	return statements, true
+}
+
+// decompose writes a 2×2 unitary in the basis, without its qubit
+func (m *merger) decompose(u sim.Matrix) []*parser.GateCall {
+	theta, phi, lambda := sim.Angles(u)
+	switch m.basis {
+	case BasisU3:
+		return []*parser.GateCall{gate("u3", theta, phi, lambda)}
+	case BasisZSX:
+		if math.Abs(theta) <= m.tolerance {
+			if angle := sim.Wrap(phi + lambda); math.Abs(angle) > m.tolerance {
+				return []*parser.GateCall{gate("rz", angle)}
+			}
+			return nil
+		}
+		var gates []*parser.GateCall
+		for _, g := range []*parser.GateCall{
+			gate("rz", lambda), gate("sx"), gate("rz", sim.Wrap(theta+math.Pi)), gate("sx"), gate("rz", sim.Wrap(phi+math.Pi)),
+		} {
+			if g.Name == "rz" && math.Abs(g.Parameters[0].(*parser.FloatLiteral).Value) <= m.tolerance {
+				continue
+			}
+			gates = append(gates, g)
+		}
+		return gates
+	}
+	return []*parser.GateCall{gate("U", theta, phi, lambda)}
+}
+
+func gate(name string, params ...float64) *parser.GateCall {
+	call := &parser.GateCall{Name: name}
+	for _, p := range params {
+		call.Parameters = append(call.Parameters, &parser.FloatLiteral{Value: p})
+	}
+	return call
+}
+
+// unitary returns the matrix of a standard single-qubit gate call with
+// constant parameters, inverted or not
+func unitary(call *parser.GateCall) (sim.Matrix, bool) {
+	params := make([]float64, len(call.Parameters))
+	for i, p := range call.Parameters {
+		v, err := sim.Evaluate(p, nil)
+		if err != nil {
+			return nil, false
+		}
+		params[i] = v
+	}
+	matrix, ok := sim.Gate(call.Name, params)
+	if !ok || matrix.Size() != 2 {
+		return nil, false
+	}
+	for _, mod := range call.Modifiers {
+		if mod.Type != "inv" {
+			return nil, false
+		}
+		matrix = matrix.Dagger()
+	}
+	return matrix, true
+}
@@ -0,0 +1,122 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+func TestMergeRotations(t *testing.T) {
+	const header = "OPENQASM 3.0;\nqubit[2] q;\n"
+	symbolic := &printer.Config{Numbers: printer.NumberStyle{Pi: printer.PiSymbolic}}
+	tests := []struct {
+		name   string
+		basis  Basis
+		src    string
+		want   string
+		merges int
+	}{
+		{
+			name:   "run becomes U",
+			src:    "h q[0];\nt q[0];\nh q[0];\n",
+			want:   "U(pi/4, -pi/2, pi/2) q[0];\n",
+			merges: 1,
+		},
+		{
+			name:   "u3",
+			basis:  BasisU3,
+			src:    "rz(pi / 4) q[1];\nrz(pi / 4) q[1];\n",
+			want:   "u3(0.0, 0.0, pi/2) q[1];\n",
+			merges: 1,
+		},
+		{
+			name:   "identity is removed",
+			src:    "h q[0];\nx q[1];\nh q[0];\ninv @ s q[1];\ns q[1];\nx q[1];\n",
+			want:   "",
+			merges: 2,
+		},
+		{
+			name:   "rz and sx",
+			basis:  BasisZSX,
+			src:    "s q[0];\nt q[0];\ns q[0];\n",
+			want:   "rz(-3*pi/4) q[0];\n",
+			merges: 1,
+		},
+		{
+			name:  "no shorter replacement",
+			basis: BasisZSX,
+			src:   "h q[0];\nt q[0];\n",
+			want:  "h q[0];\nt q[0];\n",
+		},
+		{
+			name: "two-qubit gate ends the run",
+			src:  "x q[0];\ncx q[0], q[1];\nx q[0];\n",
+			want: "x q[0];\ncx q[0], q[1];\nx q[0];\n",
+		},
+		{
+			name: "parameters must be constant",
+			src:  "float theta;\nrz(theta) q[0];\nrz(theta) q[0];\n",
+			want: "float theta;\nrz(theta) q[0];\nrz(theta) q[0];\n",
+		},
+		{
+			name:   "bodies",
+			src:    "for int i in [0:1] {\n  x q[0];\n  y q[0];\n}\n",
+			want:   "for int i in [0:1] {\n  U(0.0, 0.0, pi) q[0];\n}\n",
+			merges: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := parser.NewParser().ParseString(header + tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := printer.Print(program)
+			got, report, err := MergeRotations(program, &RotationOptions{Basis: tt.basis})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out := symbolic.Print(got); out != header+tt.want {
+				t.Errorf("got\n%s\nwant\n%s", out, header+tt.want)
+			}
+			if len(report.Merges) != tt.merges {
+				t.Errorf("got %d merges, want %d", len(report.Merges), tt.merges)
+			}
+			for _, m := range report.Merges {
+				if m.Deviation > report.Tolerance {
+					t.Errorf("%s deviates by %g", m.Qubit, m.Deviation)
+				}
+			}
+			if printer.Print(program) != before {
+				t.Error("program was modified")
+			}
+		})
+	}
+}
+
+func TestMergeRotationsReport(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit q;\nh q;\nrz(0.1) q;\nsx q;\nrz(0.2) q;\nh q;\nt q;\n"
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, report, err := MergeRotations(program, &RotationOptions{Basis: BasisZSX, Tolerance: 1e-6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Basis != BasisZSX || report.Tolerance != 1e-6 || len(report.Merges) != 1 {
+		t.Fatalf("got %+v", report)
+	}
+	m := report.Merges[0]
+	if m.Qubit != "q" || m.Gates != 6 || m.Position.Line != 3 {
+		t.Errorf("got %+v", m)
+	}
+	if n := len(got.Statements) - 1; n != m.Replacement || n >= 6 {
+		t.Errorf("replacement has %d gates, report says %d", n, m.Replacement)
+	}
+
+	if _, _, err := MergeRotations(program, &RotationOptions{Basis: "cx"}); err == nil {
+		t.Error("unknown basis accepted")
+	}
+}
@@ -0,0 +1,280 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BatchResult is the outcome of a batch as a whole: a summary of each
+// file, statistics merged across files and the diagnostics, all in the
+// order the files were given however they were scheduled
+type BatchResult struct {
+	Files []FileSummary `json:"files"`
+	Stats BatchStats    `json:"stats"`
+
+	// Diagnostics are those of every file, by file and then position, up
+	// to AggregateOptions.MaxDiagnostics. Each has its File set.
+	Diagnostics []ParseError `json:"diagnostics,omitempty"`
+
+	// Dropped counts the diagnostics beyond MaxDiagnostics, which are
+	// still counted in the statistics
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// FileSummary is what a BatchResult keeps of one file
+type FileSummary struct {
+	File     string        `json:"file"`
+	Errors   int           `json:"errors"`
+	Warnings int           `json:"warnings"`
+	Duration time.Duration `json:"duration_ns"`
+
+	// Skipped is set for a file a fail-fast batch did not parse
+	Skipped bool `json:"skipped,omitempty"`
+
+	// Program is the file's AST, kept only with
+	// AggregateOptions.KeepPrograms
+	Program *Program `json:"program,omitempty"`
+}
+
+// BatchStats are statistics merged across the files of a batch
+type BatchStats struct {
+	Files int `json:"files"`
+
+	// Failed counts the files with error diagnostics and Skipped the
+	// files a fail-fast batch did not parse
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+
+	// Statements counts the top-level statements of the parsed programs
+	Statements int `json:"statements"`
+
+	// Severities, Types and Codes count diagnostics by severity, by type
+	// such as "syntax" and by code. Diagnostics without a severity are
+	// counted as errors.
+	Severities map[Severity]int `json:"severities,omitempty"`
+	Types      map[string]int   `json:"types,omitempty"`
+	Codes      map[string]int   `json:"codes,omitempty"`
+
+	// Duration is the time spent on all files, summed; with concurrent
+	// workers it exceeds the wall-clock time
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// HasErrors reports whether any file of the batch has error diagnostics
+func (r *BatchResult) HasErrors() bool {
+	return r.Stats.Failed > 0
+}
+
+// ExitCode is the exit status a command should end a batch with: 1 if
+// any file has error diagnostics, else 0. It is the same whether the
+// batch kept going or failed fast.
+func (r *BatchResult) ExitCode() int {
+	if r.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+// Summary describes the batch in one line, in the same form whether it
+// kept going or failed fast:
+//
+//	20 files: 15 ok, 1 failed, 4 skipped; 1 error, 0 warnings
+func (r *BatchResult) Summary() string {
+	s := r.Stats
+	ok := s.Files - s.Failed - s.Skipped
+	return fmt.Sprintf("%s: %d ok, %d failed, %d skipped; %s, %s",
+		plural(s.Files, "file"), ok, s.Failed, s.Skipped,
+		plural(s.Severities[SeverityError], "error"), plural(s.Severities[SeverityWarning], "warning"))
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// AggregateOptions bounds what an Aggregator keeps
+type AggregateOptions struct {
+	// MaxDiagnostics caps the diagnostics kept, keeping the first in file
+	// order. Zero keeps all of them.
+	MaxDiagnostics int
+
+	// KeepPrograms keeps the AST of each file. By default ASTs are
+	// released once a file is merged, so a batch's memory does not grow
+	// with the size of its programs.
+	KeepPrograms bool
+}
+
+// Aggregator merges the results of a batch into a BatchResult as they
+// arrive. Results may be added from several goroutines and in any order:
+// each is reduced to its summary and diagnostics, held only until the
+// files before it have arrived, and then merged in file order, so the
+// BatchResult does not depend on scheduling.
+//
+// An Aggregator's Add method fits BatchOptions.Progress; AggregateFiles
+// and AggregateSources wire one up.
+type Aggregator struct {
+	mu      sync.Mutex
+	opts    AggregateOptions
+	pending map[int]reduced
+	next    int
+	result  BatchResult
+}
+
+// reduced is what an Aggregator keeps of a result until it is merged
+type reduced struct {
+	summary     FileSummary
+	diagnostics []ParseError
+	statements  int
+}
+
+// NewAggregator returns an Aggregator for a batch of total files. opts
+// may be nil for the defaults.
+func NewAggregator(total int, opts *AggregateOptions) *Aggregator {
+	a := &Aggregator{pending: make(map[int]reduced)}
+	if opts != nil {
+		a.opts = *opts
+	}
+	a.result.Files = make([]FileSummary, total)
+	a.result.Stats = BatchStats{
+		Files:      total,
+		Severities: make(map[Severity]int),
+		Types:      make(map[string]int),
+		Codes:      make(map[string]int),
+	}
+	return a
+}
+
+// Add adds the result of file p.Index. It is safe for concurrent use.
+func (a *Aggregator) Add(p Progress) {
+	r := a.reduce(p)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if p.Index < a.next || p.Index >= len(a.result.Files) {
+		return
+	}
+	a.pending[p.Index] = r
+	for {
+		next, ok := a.pending[a.next]
+		if !ok {
+			return
+		}
+		delete(a.pending, a.next)
+		a.merge(a.next, next)
+		a.next++
+	}
+}
+
+// Result returns the merged result. Results that are still held because
+// a file before them never arrived are merged in order, and the missing
+// files are left with an empty summary.
+func (a *Aggregator) Result() *BatchResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	indexes := make([]int, 0, len(a.pending))
+	for i := range a.pending {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		a.merge(i, a.pending[i])
+		delete(a.pending, i)
+	}
+	a.next = len(a.result.Files)
+	result := a.result
+	return &result
+}
+
+// reduce keeps what merging needs of a result, dropping the AST unless
+// AggregateOptions.KeepPrograms is set
+func (a *Aggregator) reduce(p Progress) reduced {
+	r := reduced{summary: FileSummary{File: p.File, Duration: p.Duration}}
+	if p.Result == nil {
+		return r
+	}
+	r.summary.Skipped = p.Result.Skipped
+	if program := p.Result.Program; program != nil {
+		r.statements = len(program.Statements)
+		if a.opts.KeepPrograms {
+			r.summary.Program = program
+		}
+	}
+	r.diagnostics = make([]ParseError, len(p.Result.Errors))
+	for i, d := range p.Result.Errors {
+		if d.File == "" {
+			d.File = p.File
+		}
+		switch {
+		case d.IsError():
+			r.summary.Errors++
+		case d.Severity == SeverityWarning:
+			r.summary.Warnings++
+		}
+		r.diagnostics[i] = d
+	}
+	return r
+}
+
+// merge adds the reduced result of file i to the aggregate
+func (a *Aggregator) merge(i int, r reduced) {
+	stats := &a.result.Stats
+	stats.Duration += r.summary.Duration
+	stats.Statements += r.statements
+	if r.summary.Skipped {
+		stats.Skipped++
+	}
+	if r.summary.Errors > 0 {
+		stats.Failed++
+	}
+	for _, d := range r.diagnostics {
+		severity := d.Severity
+		if severity == "" {
+			severity = SeverityError
+		}
+		stats.Severities[severity]++
+		stats.Types[d.Type]++
+		if d.Code != "" {
+			stats.Codes[d.Code]++
+		}
+		if a.opts.MaxDiagnostics > 0 && len(a.result.Diagnostics) >= a.opts.MaxDiagnostics {
+			a.result.Dropped++
+			continue
+		}
+		a.result.Diagnostics = append(a.result.Diagnostics, d)
+	}
+	a.result.Files[i] = r.summary
+}
+
+// AggregateFiles is ParseFiles returning a BatchResult instead of the
+// results themselves, so their ASTs can be released as the batch goes.
+// A Progress callback in opts is still called for each file.
+func (p *Parser) AggregateFiles(ctx context.Context, files []string, opts *BatchOptions, agg *AggregateOptions) *BatchResult {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+	a := NewAggregator(len(files), agg)
+	p.parseBatch(ctx, files, opts, p.fileParser(files, opts), a.sink(files))
+	return a.Result()
+}
+
+// AggregateSources is AggregateFiles for programs already in memory
+func (p *Parser) AggregateSources(ctx context.Context, sources []Source, opts *BatchOptions, agg *AggregateOptions) *BatchResult {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+	a := NewAggregator(len(sources), agg)
+	names := sourceNames(sources)
+	p.parseBatch(ctx, names, opts, p.sourceParser(sources, opts), a.sink(names))
+	return a.Result()
+}
+
+// sink returns a parseBatch sink adding each result to a
+func (a *Aggregator) sink(files []string) func(i int, result *ParseFileResult, elapsed time.Duration) {
+	return func(i int, result *ParseFileResult, elapsed time.Duration) {
+		a.Add(Progress{Index: i, File: files[i], Duration: elapsed, Result: result})
+	}
+}
@@ -18,6 +18,8 @@ type Node interface {
 type BaseNode struct {
 	Position Position `json:"position"`
 	EndPos   Position `json:"end_position"`
+	// Annotations are the annotation lines written before a statement
+	Annotations []Annotation `json:"annotations,omitempty"`
 }
 
 func (n *BaseNode) Pos() Position {
@@ -28,12 +30,52 @@ func (n *BaseNode) End() Position {
 	return n.EndPos
 }
 
+func (n *BaseNode) base() *BaseNode {
+	return n
+}
+
+// Annotation is an annotation line such as "@bind fast" preceding a
+// statement
+type Annotation struct {
+	Position Position `json:"position"`
+	// Keyword is the annotation name without its "@", e.g. "bind"
+	Keyword string `json:"keyword"`
+	Content string `json:"content,omitempty"`
+}
+
+// String renders the annotation as written
+func (a Annotation) String() string {
+	if a.Content == "" {
+		return "@" + a.Keyword
+	}
+	return "@" + a.Keyword + " " + a.Content
+}
+
+// Annotations returns the annotations written before a statement
+func Annotations(stmt Statement) []Annotation {
+	if n, ok := stmt.(interface{ base() *BaseNode }); ok {
+		return n.base().Annotations
+	}
+	return nil
+}
+
+// SetAnnotations replaces the annotations written before a statement
+func SetAnnotations(stmt Statement, annotations []Annotation) {
+	if n, ok := stmt.(interface{ base() *BaseNode }); ok {
+		n.base().Annotations = annotations
+	}
+}
+
 // Program represents the root AST node
 type Program struct {
 	BaseNode
 	Version    *Version    `json:"version,omitempty"`
 	Statements []Statement `json:"statements"`
 	Comments   []Comment   `json:"comments,omitempty"`
+
+	// Run is the configuration the program's execution pragmas set, nil
+	// if it has none
+	Run *RunConfig `json:"run,omitempty"`
 }
 
 func (p *Program) String() string {
@@ -89,10 +131,12 @@ func (q *QuantumDeclaration) String() string {
 // ClassicalDeclaration represents classical variable declarations
 type ClassicalDeclaration struct {
 	BaseNode
-	Type        string     `json:"type"`           // "bit", "int", "float", etc.
-	Size        Expression `json:"size,omitempty"` // for bit[n], int[32], etc.
+	Type        string     `json:"type"`            // "bit", "int", "float", "array", etc.
+	Size        Expression `json:"size,omitempty"`  // for bit[n], int[32], complex[float[64]], etc.
+	Array       *ArrayType `json:"array,omitempty"` // for type "array"
 	Identifier  string     `json:"identifier"`
 	Initializer Expression `json:"initializer,omitempty"`
+	Const       bool       `json:"const,omitempty"`
 }
 
 func (c *ClassicalDeclaration) StatementNode() {}
@@ -137,6 +181,20 @@ func (m *Measurement) String() string {
 	return "Measurement"
 }
 
+// Assignment represents classical assignments such as c[0] = 1 or
+// x += 2. Assigning a measurement is a Measurement instead.
+type Assignment struct {
+	BaseNode
+	Target   Expression `json:"target"`   // Identifier or IndexedIdentifier
+	Operator string     `json:"operator"` // "=", "+=", etc.
+	Value    Expression `json:"value"`
+}
+
+func (a *Assignment) StatementNode() {}
+func (a *Assignment) String() string {
+	return "Assignment: " + a.Operator
+}
+
 // Include represents include statements
 type Include struct {
 	BaseNode
@@ -162,11 +220,44 @@ func (g *GateDefinition) String() string {
 	return "GateDefinition: " + g.Name
 }
 
+// SubroutineDefinition represents def statements
+type SubroutineDefinition struct {
+	BaseNode
+	Name       string      `json:"name"`
+	Parameters []Parameter `json:"parameters,omitempty"`
+	ReturnType string      `json:"return_type,omitempty"`
+	Body       []Statement `json:"body"`
+}
+
+func (s *SubroutineDefinition) StatementNode() {}
+func (s *SubroutineDefinition) String() string {
+	return "SubroutineDefinition: " + s.Name
+}
+
 // Parameter represents function/gate parameters
 type Parameter struct {
 	BaseNode
 	Name string `json:"name"`
 	Type string `json:"type,omitempty"`
+
+	// Array is the type of an array parameter, whose Type spells it out
+	Array *ArrayType `json:"array,omitempty"`
+}
+
+// ArrayType is the type of a classical array, as in
+// array[int[32], 4, 5], or of an array subroutine parameter, as in
+// readonly array[int[8], #dim = 2]
+type ArrayType struct {
+	// Element is the scalar type of the elements, e.g. "int[32]"
+	Element string `json:"element"`
+
+	// Dimensions are the sizes of the dimensions, outermost first. A
+	// parameter may give only how many there are, as Rank.
+	Dimensions []Expression `json:"dimensions,omitempty"`
+	Rank       Expression   `json:"rank,omitempty"`
+
+	// Access is "readonly" or "mutable" for a parameter, "" otherwise
+	Access string `json:"access,omitempty"`
 }
 
 func (p *Parameter) String() string {
@@ -189,6 +280,7 @@ func (i *IfStatement) String() string {
 // ForStatement represents for loops
 type ForStatement struct {
 	BaseNode
+	Type     string      `json:"type,omitempty"` // loop variable type, e.g. "uint"
 	Variable string      `json:"variable"`
 	Iterable Expression  `json:"iterable"`
 	Body     []Statement `json:"body"`
@@ -211,6 +303,128 @@ func (w *WhileStatement) String() string {
 	return "WhileStatement"
 }
 
+// Barrier represents barrier statements, which keep operations from
+// being moved or merged across them. A barrier without qubits spans
+// every qubit.
+type Barrier struct {
+	BaseNode
+	Qubits []Expression `json:"qubits,omitempty"`
+}
+
+func (b *Barrier) StatementNode() {}
+func (b *Barrier) String() string {
+	return "Barrier"
+}
+
+// Reset represents reset statements, which return qubits to |0>
+type Reset struct {
+	BaseNode
+	Qubit Expression `json:"qubit"`
+}
+
+func (r *Reset) StatementNode() {}
+func (r *Reset) String() string {
+	return "Reset"
+}
+
+// CalibrationDefinition represents defcal declarations, which implement
+// an operation on specific qubits in the calibration grammar chosen by
+// defcalgrammar. The body is in that grammar and is kept as written.
+type CalibrationDefinition struct {
+	BaseNode
+	Name string `json:"name"` // the gate, or "measure", "reset" or "delay"
+
+	// Parameters are the arguments in order. One fixed to a value, as in
+	// defcal rx(pi / 2) $0, has no Type and the value as written as its
+	// Name.
+	Parameters []Parameter  `json:"parameters,omitempty"`
+	Qubits     []Expression `json:"qubits"` // hardware qubits such as $0, or names
+	ReturnType string       `json:"return_type,omitempty"`
+	Body       string       `json:"body"`
+
+	// Declarations and References model the body when the program selects
+	// the openpulse grammar; under any other grammar they are empty
+	Declarations []PulseDeclaration `json:"declarations,omitempty"`
+	References   []Identifier       `json:"references,omitempty"`
+}
+
+func (c *CalibrationDefinition) StatementNode() {}
+func (c *CalibrationDefinition) String() string {
+	return "CalibrationDefinition: " + c.Name
+}
+
+// Calibration represents cal blocks, which hold calibration grammar
+// statements outside any defcal, typically the ports and frames defcal
+// bodies share. The body is kept as written.
+type Calibration struct {
+	BaseNode
+	Body string `json:"body"`
+
+	// Declarations and References model the body when the program selects
+	// the openpulse grammar; under any other grammar they are empty
+	Declarations []PulseDeclaration `json:"declarations,omitempty"`
+	References   []Identifier       `json:"references,omitempty"`
+}
+
+func (c *Calibration) StatementNode() {}
+func (c *Calibration) String() string {
+	return "Calibration"
+}
+
+// CalibrationGrammar represents defcalgrammar statements, which choose the
+// grammar of the cal and defcal bodies after them
+type CalibrationGrammar struct {
+	BaseNode
+	Name string `json:"name"` // e.g. "openpulse"
+}
+
+func (c *CalibrationGrammar) StatementNode() {}
+func (c *CalibrationGrammar) String() string {
+	return "CalibrationGrammar: " + c.Name
+}
+
+// PulseDeclaration is a port, frame or waveform declared in an openpulse
+// body, such as frame f = newframe(d0, 5e9, 0.0);
+type PulseDeclaration struct {
+	BaseNode
+	Type   string `json:"type"` // "port", "frame" or "waveform"
+	Name   string `json:"name"`
+	Extern bool   `json:"extern,omitempty"`
+	Value  string `json:"value,omitempty"` // the initializer as written
+}
+
+func (p *PulseDeclaration) String() string {
+	return "PulseDeclaration: " + p.Type + " " + p.Name
+}
+
+// BadStatement holds the source of a statement the parser could not
+// recover, so tools that rewrite the program can keep it as written
+type BadStatement struct {
+	BaseNode
+	Text string `json:"text"`
+}
+
+func (b *BadStatement) StatementNode() {}
+func (b *BadStatement) String() string {
+	return "BadStatement"
+}
+
+// RawStatement holds the source of a valid statement the AST has no node
+// for yet, such as return, switch or box, so tools that rewrite the
+// program keep it as written
+type RawStatement struct {
+	BaseNode
+	// Keyword is the first token of the statement, e.g. "return" or
+	// "input"
+	Keyword string `json:"keyword"`
+	Text    string `json:"text"`
+}
+
+func (r *RawStatement) StatementNode() {}
+func (r *RawStatement) String() string {
+	return "RawStatement: " + r.Keyword
+}
+
 // Expression implementations
 
 // Identifier represents variable references
@@ -224,11 +438,14 @@ func (i *Identifier) String() string {
 	return "Identifier: " + i.Name
 }
 
-// IndexedIdentifier represents array access like q[0]
+// IndexedIdentifier represents array access like q[0]. Indexing more
+// than one dimension, as a[1, 2] or a[1][2], keeps the indices after the
+// first in Indices.
 type IndexedIdentifier struct {
 	BaseNode
-	Name  string     `json:"name"`
-	Index Expression `json:"index"`
+	Name    string       `json:"name"`
+	Index   Expression   `json:"index"`
+	Indices []Expression `json:"indices,omitempty"`
 }
 
 func (i *IndexedIdentifier) ExpressionNode() {}
@@ -249,10 +466,47 @@ func (r *RangedIdentifier) String() string {
 	return "RangedIdentifier: " + r.Name
 }
 
+// RangeExpression represents ranges like [0:2:10] in for loops
+type RangeExpression struct {
+	BaseNode
+	Start Expression `json:"start,omitempty"`
+	Step  Expression `json:"step,omitempty"`
+	Stop  Expression `json:"stop,omitempty"`
+}
+
+func (r *RangeExpression) ExpressionNode() {}
+func (r *RangeExpression) String() string {
+	return "RangeExpression"
+}
+
+// MeasureExpression represents measure q used as a value, as in
+// bit c = measure q;
+type MeasureExpression struct {
+	BaseNode
+	Qubit Expression `json:"qubit"`
+}
+
+func (m *MeasureExpression) ExpressionNode() {}
+func (m *MeasureExpression) String() string {
+	return "MeasureExpression"
+}
+
+// ArrayLiteral represents array initializers like {1, 2, 3}
+type ArrayLiteral struct {
+	BaseNode
+	Elements []Expression `json:"elements"`
+}
+
+func (a *ArrayLiteral) ExpressionNode() {}
+func (a *ArrayLiteral) String() string {
+	return "ArrayLiteral"
+}
+
 // IntegerLiteral represents integer constants
 type IntegerLiteral struct {
 	BaseNode
-	Value int64 `json:"value"`
+	Value int64  `json:"value"`
+	Raw   string `json:"raw,omitempty"` // spelling in the source, e.g. 0x1F
 }
 
 func (i *IntegerLiteral) ExpressionNode() {}
@@ -264,6 +518,7 @@ func (i *IntegerLiteral) String() string {
 type FloatLiteral struct {
 	BaseNode
 	Value float64 `json:"value"`
+	Raw   string  `json:"raw,omitempty"` // spelling in the source, e.g. 1e-3
 }
 
 func (f *FloatLiteral) ExpressionNode() {}
@@ -271,6 +526,19 @@ func (f *FloatLiteral) String() string {
 	return "FloatLiteral"
 }
 
+// ImaginaryLiteral represents the imaginary part of a complex number,
+// such as 3.1im in 2.0 + 3.1im
+type ImaginaryLiteral struct {
+	BaseNode
+	Value float64 `json:"value"`
+	Raw   string  `json:"raw,omitempty"` // spelling in the source, e.g. 3.1 im
+}
+
+func (i *ImaginaryLiteral) ExpressionNode() {}
+func (i *ImaginaryLiteral) String() string {
+	return "ImaginaryLiteral"
+}
+
 // StringLiteral represents string constants
 type StringLiteral struct {
 	BaseNode
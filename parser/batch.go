@@ -0,0 +1,184 @@
+package parser
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress describes a batch after one more file has finished
+type Progress struct {
+	// Index is the position of File among the files of the batch
+	Index    int
+	File     string
+	Done     int
+	Total    int
+	Duration time.Duration
+	Result   *ParseFileResult
+}
+
+// ProgressFunc receives batch progress. Calls are serialized, so
+// implementations do not need their own locking.
+type ProgressFunc func(Progress)
+
+// BatchOptions configures ParseFiles
+type BatchOptions struct {
+	// Concurrency limits how many files are parsed at once.
+	// Zero means runtime.GOMAXPROCS(0).
+	Concurrency int
+
+	// Progress is called after each file completes
+	Progress ProgressFunc
+
+	// Timeout bounds the time spent on each file. Files that take longer
+	// are abandoned and reported with a "limit" diagnostic.
+	Timeout time.Duration
+
+	// MaxFileSize skips files larger than this many bytes, bounding the
+	// memory a single pathological input can consume. Zero means no limit.
+	MaxFileSize int64
+
+	// FailFast stops the batch at the first file with error diagnostics:
+	// files not yet started are skipped and reported with Skipped set,
+	// while files already being parsed finish. Which files are skipped
+	// depends on scheduling unless Concurrency is 1. By default the
+	// batch keeps going and parses every file.
+	FailFast bool
+}
+
+// ParseFiles parses many files concurrently and returns one result per file
+// in the order given. Files not started before ctx is canceled are reported
+// with an "io" diagnostic carrying the context error.
+func (p *Parser) ParseFiles(ctx context.Context, files []string, opts *BatchOptions) []*ParseFileResult {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+	results := make([]*ParseFileResult, len(files))
+	p.parseBatch(ctx, files, opts, p.fileParser(files, opts), func(i int, result *ParseFileResult, _ time.Duration) {
+		results[i] = result
+	})
+	return results
+}
+
+// fileParser returns the parse function of a batch of files
+func (p *Parser) fileParser(files []string, opts *BatchOptions) func(ctx context.Context, i int) *ParseFileResult {
+	return func(ctx context.Context, i int) *ParseFileResult {
+		return p.parseFile(ctx, files[i], opts.MaxFileSize)
+	}
+}
+
+// Source is a named program held in memory, such as an entry of an
+// uploaded archive
+type Source struct {
+	Name    string
+	Content []byte
+}
+
+// ParseSources is ParseFiles for programs already in memory. Results are
+// named after their sources.
+func (p *Parser) ParseSources(ctx context.Context, sources []Source, opts *BatchOptions) []*ParseFileResult {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+	results := make([]*ParseFileResult, len(sources))
+	p.parseBatch(ctx, sourceNames(sources), opts, p.sourceParser(sources, opts), func(i int, result *ParseFileResult, _ time.Duration) {
+		results[i] = result
+	})
+	return results
+}
+
+func sourceNames(sources []Source) []string {
+	names := make([]string, len(sources))
+	for i, src := range sources {
+		names[i] = src.Name
+	}
+	return names
+}
+
+// sourceParser returns the parse function of a batch of sources
+func (p *Parser) sourceParser(sources []Source, opts *BatchOptions) func(ctx context.Context, i int) *ParseFileResult {
+	return func(ctx context.Context, i int) *ParseFileResult {
+		src := sources[i]
+		if opts.MaxFileSize > 0 && int64(len(src.Content)) > opts.MaxFileSize {
+			result := &ParseFileResult{File: src.Name}
+			result.Errors = []ParseError{newSizeLimitError(src.Name, int64(len(src.Content)), opts.MaxFileSize)}
+			return result
+		}
+		return p.parseContent(ctx, src.Name, src.Content)
+	}
+}
+
+// parseBatch runs parse for each of files on a bounded pool of workers,
+// applying the per-file timeout, and hands each result to sink and then
+// to the progress callback. Calls to sink are serialized.
+func (p *Parser) parseBatch(ctx context.Context, files []string, opts *BatchOptions, parse func(ctx context.Context, i int) *ParseFileResult, sink func(i int, result *ParseFileResult, elapsed time.Duration)) {
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	var (
+		mu     sync.Mutex
+		done   int
+		failed atomic.Bool
+	)
+	report := func(i int, result *ParseFileResult, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		if opts.FailFast && result.HasErrors() {
+			failed.Store(true)
+		}
+		sink(i, result, elapsed)
+		if opts.Progress == nil {
+			return
+		}
+		opts.Progress(Progress{
+			Index:    i,
+			File:     files[i],
+			Done:     done,
+			Total:    len(files),
+			Duration: elapsed,
+			Result:   result,
+		})
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(files)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				start := time.Now()
+				var result *ParseFileResult
+				if err := ctx.Err(); err != nil {
+					result = &ParseFileResult{File: files[i]}
+					result.Errors = []ParseError{NewIOError(files[i], err)}
+				} else if failed.Load() {
+					result = &ParseFileResult{File: files[i], Skipped: true}
+				} else {
+					result = parseWithTimeout(ctx, i, opts, parse)
+				}
+				report(i, result, time.Since(start))
+			}
+		}()
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// parseWithTimeout parses one file of a batch under its per-file budget
+func parseWithTimeout(ctx context.Context, i int, opts *BatchOptions, parse func(ctx context.Context, i int) *ParseFileResult) *ParseFileResult {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	return parse(ctx, i)
+}
@@ -0,0 +1,982 @@
+package parser
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/antlr4-go/antlr/v4"
+	qasm_gen "github.com/orangekame3/qasmparser/gen/parser"
+)
+
+// buildProgram converts a parse tree into the AST. Statements the AST has
+// no node for yet become RawStatements; statements the parser could not
+// recover become BadStatements.
+func buildProgram(ctx context.Context, tree *qasm_gen.ProgramContext) *Program {
+	program := &Program{
+		BaseNode: BaseNode{
+			Position: Position{Line: 1, Column: 1},
+		},
+		Statements: make([]Statement, 0),
+		Comments:   make([]Comment, 0),
+	}
+
+	if v, ok := tree.Version().(*qasm_gen.VersionContext); ok && v.VersionSpecifier() != nil {
+		program.Version = &Version{
+			BaseNode: nodeSpan(v),
+			Number:   v.VersionSpecifier().GetText(),
+		}
+	}
+	program.Statements = append(program.Statements, buildStatements(ctx, tree)...)
+	applyCalibrationGrammar(program.Statements)
+	if eof := tree.EOF(); eof != nil {
+		program.EndPos = tokenPosition(eof.GetSymbol())
+	}
+
+	return program
+}
+
+// nodeSpan returns the source range covered by a parse tree node
+func nodeSpan(ctx antlr.ParserRuleContext) BaseNode {
+	start := ctx.GetStart()
+	if start == nil {
+		return BaseNode{}
+	}
+	span := BaseNode{Position: tokenPosition(start)}
+	span.EndPos = span.Position
+
+	// After error recovery the stop token can precede the start token
+	if stop := ctx.GetStop(); stop != nil && stop.GetTokenIndex() >= start.GetTokenIndex() {
+		span.EndPos = tokenEnd(stop)
+	}
+	return span
+}
+
+// tokenSpan returns the source range covered by a single token
+func tokenSpan(tok antlr.Token) BaseNode {
+	return BaseNode{Position: tokenPosition(tok), EndPos: tokenEnd(tok)}
+}
+
+// tokenEnd returns the position just after a token
+func tokenEnd(tok antlr.Token) Position {
+	if tok.GetTokenType() == antlr.TokenEOF {
+		return tokenPosition(tok)
+	}
+	return advancePosition(tokenPosition(tok), tok.GetText())
+}
+
+// buildStatements converts the statements of a program or block. Runs of
+// tokens error recovery skipped between statements become a BadStatement.
+func buildStatements(ctx context.Context, parent antlr.Tree) []Statement {
+	statements := make([]Statement, 0)
+	var skipped []antlr.Token
+	flush := func() {
+		if len(skipped) > 0 {
+			statements = append(statements, badStatement(skipped[0], skipped[len(skipped)-1]))
+			skipped = nil
+		}
+	}
+	for i := 0; i < parent.GetChildCount(); i++ {
+		switch child := parent.GetChild(i).(type) {
+		case antlr.ErrorNode:
+			if tok := child.GetSymbol(); tok.GetTokenIndex() >= 0 {
+				skipped = append(skipped, tok)
+			}
+		case qasm_gen.IStatementOrScopeContext:
+			checkContext(ctx)
+			flush()
+			statements = append(statements, buildStatementOrScope(child)...)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return statements
+}
+
+// buildStatementOrScope flattens a bare scope into its statements
+func buildStatementOrScope(ctx qasm_gen.IStatementOrScopeContext) []Statement {
+	if ctx == nil {
+		return nil
+	}
+	if scope := ctx.Scope(); scope != nil {
+		return buildScope(scope)
+	}
+	stmtCtx := ctx.Statement()
+	if stmtCtx == nil {
+		return nil
+	}
+	// A statement that lost tokens to error recovery would be rewritten
+	// without them, so it is kept as written instead
+	if skipsTokens(stmtCtx) {
+		return []Statement{badStatement(stmtCtx.GetStart(), stmtCtx.GetStop())}
+	}
+	if stmt := buildStatement(stmtCtx); stmt != nil {
+		return []Statement{annotate(stmt, stmtCtx)}
+	}
+	if hasSyntaxError(stmtCtx) {
+		return []Statement{badStatement(stmtCtx.GetStart(), stmtCtx.GetStop())}
+	}
+	// Pragmas are read into Program.Run
+	if stmtCtx.Pragma() != nil {
+		return nil
+	}
+	return []Statement{annotate(rawStatement(stmtCtx), stmtCtx)}
+}
+
+// annotate attaches the annotations written before a statement to its node
+func annotate(stmt Statement, ctx qasm_gen.IStatementContext) Statement {
+	var annotations []Annotation
+	for _, a := range ctx.AllAnnotation() {
+		annotation := Annotation{
+			Position: tokenPosition(a.GetStart()),
+			Keyword:  strings.TrimPrefix(a.AnnotationKeyword().GetText(), "@"),
+		}
+		if content := a.RemainingLineContent(); content != nil {
+			annotation.Content = strings.TrimSpace(content.GetText())
+		}
+		annotations = append(annotations, annotation)
+	}
+	SetAnnotations(stmt, annotations)
+	return stmt
+}
+
+// buildScope converts the statements of a braced block
+func buildScope(ctx qasm_gen.IScopeContext) []Statement {
+	if ctx == nil {
+		return make([]Statement, 0)
+	}
+	return buildStatements(context.Background(), ctx)
+}
+
+// badStatement captures the source from start to stop as written
+func badStatement(start, stop antlr.Token) *BadStatement {
+	if stop == nil || stop.GetTokenIndex() < start.GetTokenIndex() {
+		stop = start
+	}
+	return &BadStatement{
+		BaseNode: BaseNode{Position: tokenPosition(start), EndPos: tokenEnd(stop)},
+		Text:     start.GetInputStream().GetText(start.GetStart(), stop.GetStop()),
+	}
+}
+
+// rawStatement captures a statement the AST has no node for as written,
+// leaving out its annotations
+func rawStatement(ctx qasm_gen.IStatementContext) *RawStatement {
+	start, stop := ctx.GetStart(), ctx.GetStop()
+	for i := 0; i < ctx.GetChildCount(); i++ {
+		if _, annotation := ctx.GetChild(i).(qasm_gen.IAnnotationContext); annotation {
+			continue
+		}
+		if rule, ok := ctx.GetChild(i).(antlr.ParserRuleContext); ok && rule.GetStart() != nil {
+			start = rule.GetStart()
+		}
+		break
+	}
+	if stop == nil || stop.GetTokenIndex() < start.GetTokenIndex() {
+		stop = start
+	}
+	return &RawStatement{
+		BaseNode: BaseNode{Position: tokenPosition(start), EndPos: tokenEnd(stop)},
+		Keyword:  start.GetText(),
+		Text:     start.GetInputStream().GetText(start.GetStart(), stop.GetStop()),
+	}
+}
+
+// skipsTokens reports whether error recovery dropped source tokens from a
+// statement, not counting nested blocks, which are recovered on their own
+func skipsTokens(tree antlr.Tree) bool {
+	for i := 0; i < tree.GetChildCount(); i++ {
+		switch child := tree.GetChild(i).(type) {
+		case antlr.ErrorNode:
+			if child.GetSymbol().GetTokenIndex() >= 0 {
+				return true
+			}
+		case qasm_gen.IScopeContext:
+		default:
+			if skipsTokens(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recognitionContext is a rule context that records the error it failed
+// with, if any
+type recognitionContext interface {
+	GetException() antlr.RecognitionException
+}
+
+// hasSyntaxError reports whether the parser reported an error within a
+// statement, not counting nested blocks
+func hasSyntaxError(tree antlr.Tree) bool {
+	if ctx, ok := tree.(recognitionContext); ok && ctx.GetException() != nil {
+		return true
+	}
+	for i := 0; i < tree.GetChildCount(); i++ {
+		switch child := tree.GetChild(i).(type) {
+		case antlr.ErrorNode:
+			return true
+		case qasm_gen.IScopeContext:
+		default:
+			if hasSyntaxError(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// buildStatement converts one statement, returning nil for statements the
+// AST cannot represent yet, which the caller keeps as RawStatements
+func buildStatement(ctx qasm_gen.IStatementContext) Statement {
+	if ctx == nil {
+		return nil
+	}
+
+	switch {
+	case ctx.IncludeStatement() != nil:
+		return buildInclude(ctx.IncludeStatement().(*qasm_gen.IncludeStatementContext))
+	case ctx.QuantumDeclarationStatement() != nil:
+		return buildQuantumDeclaration(ctx.QuantumDeclarationStatement().(*qasm_gen.QuantumDeclarationStatementContext))
+	case ctx.OldStyleDeclarationStatement() != nil:
+		return buildOldStyleDeclaration(ctx.OldStyleDeclarationStatement().(*qasm_gen.OldStyleDeclarationStatementContext))
+	case ctx.ClassicalDeclarationStatement() != nil:
+		return buildClassicalDeclaration(ctx.ClassicalDeclarationStatement().(*qasm_gen.ClassicalDeclarationStatementContext))
+	case ctx.ConstDeclarationStatement() != nil:
+		return buildConstDeclaration(ctx.ConstDeclarationStatement().(*qasm_gen.ConstDeclarationStatementContext))
+	case ctx.GateCallStatement() != nil:
+		return buildGateCall(ctx.GateCallStatement().(*qasm_gen.GateCallStatementContext))
+	case ctx.BarrierStatement() != nil:
+		return buildBarrier(ctx.BarrierStatement().(*qasm_gen.BarrierStatementContext))
+	case ctx.ResetStatement() != nil:
+		return buildReset(ctx.ResetStatement().(*qasm_gen.ResetStatementContext))
+	case ctx.MeasureArrowAssignmentStatement() != nil:
+		return buildMeasureArrow(ctx.MeasureArrowAssignmentStatement().(*qasm_gen.MeasureArrowAssignmentStatementContext))
+	case ctx.AssignmentStatement() != nil:
+		return buildAssignment(ctx.AssignmentStatement().(*qasm_gen.AssignmentStatementContext))
+	case ctx.GateStatement() != nil:
+		return buildGateDefinition(ctx.GateStatement().(*qasm_gen.GateStatementContext))
+	case ctx.DefStatement() != nil:
+		return buildSubroutineDefinition(ctx.DefStatement().(*qasm_gen.DefStatementContext))
+	case ctx.DefcalStatement() != nil:
+		return buildCalibrationDefinition(ctx.DefcalStatement().(*qasm_gen.DefcalStatementContext))
+	case ctx.CalStatement() != nil:
+		return buildCalibration(ctx.CalStatement().(*qasm_gen.CalStatementContext))
+	case ctx.CalibrationGrammarStatement() != nil:
+		return buildCalibrationGrammar(ctx.CalibrationGrammarStatement().(*qasm_gen.CalibrationGrammarStatementContext))
+	case ctx.IfStatement() != nil:
+		return buildIf(ctx.IfStatement().(*qasm_gen.IfStatementContext))
+	case ctx.ForStatement() != nil:
+		return buildFor(ctx.ForStatement().(*qasm_gen.ForStatementContext))
+	case ctx.WhileStatement() != nil:
+		return buildWhile(ctx.WhileStatement().(*qasm_gen.WhileStatementContext))
+	case ctx.NopStatement() != nil:
+		return customStatement(ctx.NopStatement().(*qasm_gen.NopStatementContext))
+	}
+	return nil
+}
+
+func buildInclude(ctx *qasm_gen.IncludeStatementContext) Statement {
+	literal := ctx.StringLiteral()
+	if literal == nil {
+		return nil
+	}
+	path, err := UnquoteString(literal.GetText())
+	if err != nil {
+		path = strings.Trim(literal.GetText(), `"'`)
+	}
+	return &Include{BaseNode: nodeSpan(ctx), Path: path}
+}
+
+func buildQuantumDeclaration(ctx *qasm_gen.QuantumDeclarationStatementContext) Statement {
+	if ctx.Identifier() == nil {
+		return nil
+	}
+	decl := &QuantumDeclaration{
+		BaseNode:   nodeSpan(ctx),
+		Type:       "qubit",
+		Identifier: ctx.Identifier().GetText(),
+	}
+	if qubitType := ctx.QubitType(); qubitType != nil {
+		decl.Size = buildDesignator(qubitType.Designator())
+	}
+	return decl
+}
+
+// buildOldStyleDeclaration keeps the qreg/creg keyword as the type so the
+// declaration can be printed back the way it was written
+func buildOldStyleDeclaration(ctx *qasm_gen.OldStyleDeclarationStatementContext) Statement {
+	if ctx.Identifier() == nil {
+		return nil
+	}
+	size := buildDesignator(ctx.Designator())
+	if ctx.QREG() != nil {
+		return &QuantumDeclaration{
+			BaseNode:   nodeSpan(ctx),
+			Type:       "qreg",
+			Size:       size,
+			Identifier: ctx.Identifier().GetText(),
+		}
+	}
+	return &ClassicalDeclaration{
+		BaseNode:   nodeSpan(ctx),
+		Type:       "creg",
+		Size:       size,
+		Identifier: ctx.Identifier().GetText(),
+	}
+}
+
+func buildClassicalDeclaration(ctx *qasm_gen.ClassicalDeclarationStatementContext) Statement {
+	if ctx.Identifier() == nil {
+		return nil
+	}
+	decl := &ClassicalDeclaration{
+		BaseNode:    nodeSpan(ctx),
+		Identifier:  ctx.Identifier().GetText(),
+		Initializer: buildDeclarationExpression(ctx.DeclarationExpression()),
+	}
+	switch {
+	case ctx.ScalarType() != nil:
+		decl.Type, decl.Size = buildScalarType(ctx.ScalarType())
+	case ctx.ArrayType() != nil:
+		decl.Type = "array"
+		decl.Array = buildArrayType(ctx.ArrayType())
+	}
+	return decl
+}
+
+// buildArrayType converts array[int[32], 4, 5]
+func buildArrayType(ctx qasm_gen.IArrayTypeContext) *ArrayType {
+	array := &ArrayType{Dimensions: buildExpressionList(ctx.ExpressionList())}
+	if ctx.ScalarType() != nil {
+		array.Element = ctx.ScalarType().GetText()
+	}
+	return array
+}
+
+// buildArrayReferenceType converts the type of an array parameter, e.g.
+// readonly array[int[8], 2] or mutable array[int[8], #dim = 2], and
+// spells it out with the printer's spacing
+func buildArrayReferenceType(ctx qasm_gen.IArrayReferenceTypeContext) (*ArrayType, string) {
+	array := &ArrayType{Dimensions: buildExpressionList(ctx.ExpressionList())}
+	switch {
+	case ctx.READONLY() != nil:
+		array.Access = "readonly"
+	case ctx.MUTABLE() != nil:
+		array.Access = "mutable"
+	}
+	if ctx.ScalarType() != nil {
+		array.Element = ctx.ScalarType().GetText()
+	}
+	parts := []string{array.Element}
+	if ctx.DIM() != nil && ctx.Expression() != nil {
+		array.Rank = buildExpression(ctx.Expression())
+		parts = append(parts, "#dim = "+ctx.Expression().GetText())
+	} else if list := ctx.ExpressionList(); list != nil {
+		for _, e := range list.AllExpression() {
+			parts = append(parts, e.GetText())
+		}
+	}
+	spelled := "array[" + strings.Join(parts, ", ") + "]"
+	if array.Access != "" {
+		spelled = array.Access + " " + spelled
+	}
+	return array, spelled
+}
+
+func buildConstDeclaration(ctx *qasm_gen.ConstDeclarationStatementContext) Statement {
+	if ctx.Identifier() == nil {
+		return nil
+	}
+	decl := &ClassicalDeclaration{
+		BaseNode:    nodeSpan(ctx),
+		Identifier:  ctx.Identifier().GetText(),
+		Initializer: buildDeclarationExpression(ctx.DeclarationExpression()),
+		Const:       true,
+	}
+	decl.Type, decl.Size = buildScalarType(ctx.ScalarType())
+	return decl
+}
+
+// buildScalarType splits a scalar type such as int[32] into its keyword and
+// designator. The designator of complex[float[64]] is that of its float
+// components.
+func buildScalarType(ctx qasm_gen.IScalarTypeContext) (string, Expression) {
+	if ctx == nil || ctx.GetStart() == nil {
+		return "", nil
+	}
+	if ctx.COMPLEX() != nil {
+		var size Expression
+		if float := ctx.ScalarType(); float != nil {
+			_, size = buildScalarType(float)
+		}
+		return "complex", size
+	}
+	return ctx.GetStart().GetText(), buildDesignator(ctx.Designator())
+}
+
+func buildDesignator(ctx qasm_gen.IDesignatorContext) Expression {
+	if ctx == nil {
+		return nil
+	}
+	return buildExpression(ctx.Expression())
+}
+
+// buildDeclarationExpression converts an initializer
+func buildDeclarationExpression(ctx qasm_gen.IDeclarationExpressionContext) Expression {
+	if ctx == nil {
+		return nil
+	}
+	switch {
+	case ctx.MeasureExpression() != nil:
+		return buildMeasureExpression(ctx.MeasureExpression())
+	case ctx.ArrayLiteral() != nil:
+		return buildArrayLiteral(ctx.ArrayLiteral())
+	}
+	return buildExpression(ctx.Expression())
+}
+
+func buildMeasureExpression(ctx qasm_gen.IMeasureExpressionContext) Expression {
+	return &MeasureExpression{
+		BaseNode: nodeSpan(ctx),
+		Qubit:    buildGateOperand(ctx.GateOperand()),
+	}
+}
+
+// buildArrayLiteral converts {a, b, {c, d}}, keeping nested literals in
+// source order
+func buildArrayLiteral(ctx qasm_gen.IArrayLiteralContext) Expression {
+	literal := &ArrayLiteral{BaseNode: nodeSpan(ctx), Elements: make([]Expression, 0)}
+	for i := 0; i < ctx.GetChildCount(); i++ {
+		var element Expression
+		switch child := ctx.GetChild(i).(type) {
+		case qasm_gen.IArrayLiteralContext:
+			element = buildArrayLiteral(child)
+		case qasm_gen.IExpressionContext:
+			element = buildExpression(child)
+		}
+		if element != nil {
+			literal.Elements = append(literal.Elements, element)
+		}
+	}
+	return literal
+}
+
+// buildSet converts a set such as {1, 5}, which only for loops iterate
+// over, to an array literal with the same spelling
+func buildSet(ctx qasm_gen.ISetExpressionContext) Expression {
+	set := &ArrayLiteral{BaseNode: nodeSpan(ctx), Elements: make([]Expression, 0)}
+	for _, e := range ctx.AllExpression() {
+		if element := buildExpression(e); element != nil {
+			set.Elements = append(set.Elements, element)
+		}
+	}
+	return set
+}
+
+func buildGateCall(ctx *qasm_gen.GateCallStatementContext) Statement {
+	call := &GateCall{BaseNode: nodeSpan(ctx), Qubits: make([]Expression, 0)}
+	switch {
+	case ctx.Identifier() != nil:
+		call.Name = ctx.Identifier().GetText()
+	case ctx.GPHASE() != nil:
+		call.Name = ctx.GPHASE().GetText()
+	default:
+		return nil
+	}
+
+	for _, mod := range ctx.AllGateModifier() {
+		call.Modifiers = append(call.Modifiers, buildModifier(mod.(*qasm_gen.GateModifierContext)))
+	}
+	call.Parameters = buildExpressionList(ctx.ExpressionList())
+	if operands := ctx.GateOperandList(); operands != nil {
+		for _, operand := range operands.AllGateOperand() {
+			if qubit := buildGateOperand(operand); qubit != nil {
+				call.Qubits = append(call.Qubits, qubit)
+			}
+		}
+	}
+	return call
+}
+
+func buildBarrier(ctx *qasm_gen.BarrierStatementContext) Statement {
+	barrier := &Barrier{BaseNode: nodeSpan(ctx)}
+	if operands := ctx.GateOperandList(); operands != nil {
+		for _, operand := range operands.AllGateOperand() {
+			if qubit := buildGateOperand(operand); qubit != nil {
+				barrier.Qubits = append(barrier.Qubits, qubit)
+			}
+		}
+	}
+	return barrier
+}
+
+func buildReset(ctx *qasm_gen.ResetStatementContext) Statement {
+	reset := &Reset{BaseNode: nodeSpan(ctx)}
+	if operand := ctx.GateOperand(); operand != nil {
+		reset.Qubit = buildGateOperand(operand)
+	}
+	return reset
+}
+
+func buildModifier(ctx *qasm_gen.GateModifierContext) Modifier {
+	mod := Modifier{BaseNode: nodeSpan(ctx)}
+	if start := ctx.GetStart(); start != nil {
+		mod.Type = start.GetText()
+	}
+	if arg := buildExpression(ctx.Expression()); arg != nil {
+		mod.Parameters = []Expression{arg}
+	}
+	return mod
+}
+
+func buildMeasureArrow(ctx *qasm_gen.MeasureArrowAssignmentStatementContext) Statement {
+	measure := ctx.MeasureExpression()
+	if measure == nil {
+		return nil
+	}
+	stmt := &Measurement{
+		BaseNode: nodeSpan(ctx),
+		Qubit:    buildGateOperand(measure.GateOperand()),
+	}
+	if target := ctx.IndexedIdentifier(); target != nil {
+		stmt.Target = buildIndexedIdentifier(target)
+	}
+	return stmt
+}
+
+// buildAssignment converts an assignment, or the measurement form
+// c = measure q
+func buildAssignment(ctx *qasm_gen.AssignmentStatementContext) Statement {
+	measure := ctx.MeasureExpression()
+	if measure == nil {
+		if ctx.GetOp() == nil || ctx.Expression() == nil {
+			return nil
+		}
+		return &Assignment{
+			BaseNode: nodeSpan(ctx),
+			Target:   buildIndexedIdentifier(ctx.IndexedIdentifier()),
+			Operator: ctx.GetOp().GetText(),
+			Value:    buildExpression(ctx.Expression()),
+		}
+	}
+	if ctx.EQUALS() == nil {
+		return nil
+	}
+	return &Measurement{
+		BaseNode: nodeSpan(ctx),
+		Qubit:    buildGateOperand(measure.GateOperand()),
+		Target:   buildIndexedIdentifier(ctx.IndexedIdentifier()),
+	}
+}
+
+func buildGateDefinition(ctx *qasm_gen.GateStatementContext) Statement {
+	if ctx.Identifier() == nil {
+		return nil
+	}
+	def := &GateDefinition{
+		BaseNode:   nodeSpan(ctx),
+		Name:       ctx.Identifier().GetText(),
+		Parameters: buildIdentifierParameters(ctx.GetParams()),
+		Qubits:     buildIdentifierParameters(ctx.GetQubits()),
+		Body:       buildScope(ctx.Scope()),
+	}
+	if def.Qubits == nil {
+		def.Qubits = make([]Parameter, 0)
+	}
+	return def
+}
+
+func buildIdentifierParameters(ctx qasm_gen.IIdentifierListContext) []Parameter {
+	if ctx == nil {
+		return nil
+	}
+	var params []Parameter
+	for _, id := range ctx.AllIdentifier() {
+		params = append(params, Parameter{BaseNode: tokenSpan(id.GetSymbol()), Name: id.GetText()})
+	}
+	return params
+}
+
+func buildSubroutineDefinition(ctx *qasm_gen.DefStatementContext) Statement {
+	if ctx.Identifier() == nil {
+		return nil
+	}
+	def := &SubroutineDefinition{
+		BaseNode: nodeSpan(ctx),
+		Name:     ctx.Identifier().GetText(),
+		Body:     buildScope(ctx.Scope()),
+	}
+	if args := ctx.ArgumentDefinitionList(); args != nil {
+		for _, arg := range args.AllArgumentDefinition() {
+			if param, ok := buildArgumentDefinition(arg.(*qasm_gen.ArgumentDefinitionContext)); ok {
+				def.Parameters = append(def.Parameters, param)
+			}
+		}
+	}
+	if ret := ctx.ReturnSignature(); ret != nil && ret.ScalarType() != nil {
+		def.ReturnType = ret.ScalarType().GetText()
+	}
+	return def
+}
+
+func buildCalibrationDefinition(ctx *qasm_gen.DefcalStatementContext) Statement {
+	if ctx.DefcalTarget() == nil || ctx.DefcalOperandList() == nil {
+		return nil
+	}
+	def := &CalibrationDefinition{
+		BaseNode: nodeSpan(ctx),
+		Name:     ctx.DefcalTarget().GetText(),
+		Qubits:   make([]Expression, 0),
+	}
+	if args := ctx.DefcalArgumentDefinitionList(); args != nil {
+		for _, arg := range args.AllDefcalArgumentDefinition() {
+			if typed := arg.ArgumentDefinition(); typed != nil {
+				if param, ok := buildArgumentDefinition(typed.(*qasm_gen.ArgumentDefinitionContext)); ok {
+					def.Parameters = append(def.Parameters, param)
+				}
+				continue
+			}
+			start, stop := arg.GetStart(), arg.GetStop()
+			def.Parameters = append(def.Parameters, Parameter{
+				BaseNode: nodeSpan(arg),
+				Name:     start.GetInputStream().GetText(start.GetStart(), stop.GetStop()),
+			})
+		}
+	}
+	for _, operand := range ctx.DefcalOperandList().AllDefcalOperand() {
+		def.Qubits = append(def.Qubits, &Identifier{BaseNode: nodeSpan(operand), Name: operand.GetText()})
+	}
+	if ret := ctx.ReturnSignature(); ret != nil && ret.ScalarType() != nil {
+		def.ReturnType = ret.ScalarType().GetText()
+	}
+	if body := ctx.CalibrationBlock(); body != nil {
+		def.Body = body.GetText()
+		def.Declarations, def.References = scanPulse(body.GetSymbol())
+	}
+	return def
+}
+
+func buildCalibration(ctx *qasm_gen.CalStatementContext) Statement {
+	cal := &Calibration{BaseNode: nodeSpan(ctx)}
+	if body := ctx.CalibrationBlock(); body != nil {
+		cal.Body = body.GetText()
+		cal.Declarations, cal.References = scanPulse(body.GetSymbol())
+	}
+	return cal
+}
+
+func buildCalibrationGrammar(ctx *qasm_gen.CalibrationGrammarStatementContext) Statement {
+	literal := ctx.StringLiteral()
+	if literal == nil {
+		return nil
+	}
+	name, err := UnquoteString(literal.GetText())
+	if err != nil {
+		name = strings.Trim(literal.GetText(), `"'`)
+	}
+	return &CalibrationGrammar{BaseNode: nodeSpan(ctx), Name: name}
+}
+
+// buildArgumentDefinition converts a typed subroutine argument. The type is
+// everything before the name, e.g. "qubit[2]" or "readonly array[int[8], 2]".
+func buildArgumentDefinition(ctx *qasm_gen.ArgumentDefinitionContext) (Parameter, bool) {
+	id := ctx.Identifier()
+	if id == nil {
+		return Parameter{}, false
+	}
+	param := Parameter{BaseNode: nodeSpan(ctx), Name: id.GetText()}
+	switch {
+	case ctx.ScalarType() != nil:
+		param.Type = ctx.ScalarType().GetText()
+	case ctx.QubitType() != nil:
+		param.Type = ctx.QubitType().GetText()
+	case ctx.ArrayReferenceType() != nil:
+		param.Array, param.Type = buildArrayReferenceType(ctx.ArrayReferenceType())
+	case ctx.GetStart() != nil:
+		param.Type = ctx.GetStart().GetText()
+		if d := ctx.Designator(); d != nil {
+			param.Type += d.GetText()
+		}
+	}
+	return param, true
+}
+
+func buildIf(ctx *qasm_gen.IfStatementContext) Statement {
+	return &IfStatement{
+		BaseNode:  nodeSpan(ctx),
+		Condition: buildExpression(ctx.Expression()),
+		ThenBody:  bodyOrEmpty(buildStatementOrScope(ctx.GetIf_body())),
+		ElseBody:  buildStatementOrScope(ctx.GetElse_body()),
+	}
+}
+
+func buildFor(ctx *qasm_gen.ForStatementContext) Statement {
+	if ctx.Identifier() == nil {
+		return nil
+	}
+	loop := &ForStatement{
+		BaseNode: nodeSpan(ctx),
+		Variable: ctx.Identifier().GetText(),
+		Body:     bodyOrEmpty(buildStatementOrScope(ctx.GetBody())),
+	}
+	if scalar := ctx.ScalarType(); scalar != nil {
+		loop.Type = scalar.GetText()
+	}
+	switch {
+	case ctx.RangeExpression() != nil:
+		loop.Iterable = buildRange(ctx.RangeExpression().(*qasm_gen.RangeExpressionContext))
+	case ctx.SetExpression() != nil:
+		loop.Iterable = buildSet(ctx.SetExpression())
+	case ctx.Expression() != nil:
+		loop.Iterable = buildExpression(ctx.Expression())
+	}
+	return loop
+}
+
+func buildWhile(ctx *qasm_gen.WhileStatementContext) Statement {
+	return &WhileStatement{
+		BaseNode:  nodeSpan(ctx),
+		Condition: buildExpression(ctx.Expression()),
+		Body:      bodyOrEmpty(buildStatementOrScope(ctx.GetBody())),
+	}
+}
+
+// bodyOrEmpty keeps required bodies non-nil so they encode as [] in JSON
+func bodyOrEmpty(body []Statement) []Statement {
+	if body == nil {
+		return make([]Statement, 0)
+	}
+	return body
+}
+
+func buildGateOperand(ctx qasm_gen.IGateOperandContext) Expression {
+	if ctx == nil {
+		return nil
+	}
+	if hw := ctx.HardwareQubit(); hw != nil {
+		return &Identifier{BaseNode: tokenSpan(hw.GetSymbol()), Name: hw.GetText()}
+	}
+	return buildIndexedIdentifier(ctx.IndexedIdentifier())
+}
+
+// buildIndexedIdentifier converts name, name[i], name[i, j], name[i][j]
+// and name[a:b]. Indices after a range are dropped, as ranges of arrays
+// have no node yet.
+func buildIndexedIdentifier(ctx qasm_gen.IIndexedIdentifierContext) Expression {
+	if ctx == nil || ctx.Identifier() == nil {
+		return nil
+	}
+	name := ctx.Identifier().GetText()
+	ops := ctx.AllIndexOperator()
+	if len(ops) == 0 {
+		return &Identifier{BaseNode: tokenSpan(ctx.Identifier().GetSymbol()), Name: name}
+	}
+	expr := buildIndex(nodeSpan(ctx), name, ops[0])
+	for _, op := range ops[1:] {
+		expr = appendIndices(expr, op, 0)
+	}
+	return expr
+}
+
+func buildIndex(span BaseNode, name string, ctx qasm_gen.IIndexOperatorContext) Expression {
+	for i := 0; i < ctx.GetChildCount(); i++ {
+		switch item := ctx.GetChild(i).(type) {
+		case *qasm_gen.RangeExpressionContext:
+			r := buildRange(item)
+			return &RangedIdentifier{BaseNode: span, Name: name, Start: r.Start, EndIndex: r.Stop}
+		case qasm_gen.IExpressionContext:
+			return appendIndices(&IndexedIdentifier{BaseNode: span, Name: name, Index: buildExpression(item)}, ctx, i+1)
+		case *qasm_gen.SetExpressionContext:
+			var index Expression
+			if first := item.Expression(0); first != nil {
+				index = buildExpression(first)
+			}
+			return &IndexedIdentifier{BaseNode: span, Name: name, Index: index}
+		}
+	}
+	return &IndexedIdentifier{BaseNode: span, Name: name}
+}
+
+// appendIndices adds the indices of an index operator, from its child
+// from on, to an indexed identifier as further dimensions. Other
+// expressions are returned as they are.
+func appendIndices(expr Expression, ctx qasm_gen.IIndexOperatorContext, from int) Expression {
+	indexed, ok := expr.(*IndexedIdentifier)
+	if !ok {
+		return expr
+	}
+	for i := from; i < ctx.GetChildCount(); i++ {
+		if item, ok := ctx.GetChild(i).(qasm_gen.IExpressionContext); ok {
+			if index := buildExpression(item); index != nil {
+				indexed.Indices = append(indexed.Indices, index)
+			}
+		}
+	}
+	return indexed
+}
+
+// buildRange converts start:stop or start:step:stop, where every part is
+// optional
+func buildRange(ctx *qasm_gen.RangeExpressionContext) *RangeExpression {
+	r := &RangeExpression{BaseNode: nodeSpan(ctx)}
+
+	// Assign each expression to the slot its position between colons selects
+	var parts [3]Expression
+	slot := 0
+	for i := 0; i < ctx.GetChildCount(); i++ {
+		switch child := ctx.GetChild(i).(type) {
+		case antlr.TerminalNode:
+			slot++
+		case qasm_gen.IExpressionContext:
+			if slot < len(parts) {
+				parts[slot] = buildExpression(child)
+			}
+		}
+	}
+
+	r.Start = parts[0]
+	if slot == 2 {
+		r.Step, r.Stop = parts[1], parts[2]
+	} else {
+		r.Stop = parts[1]
+	}
+	return r
+}
+
+func buildExpressionList(ctx qasm_gen.IExpressionListContext) []Expression {
+	if ctx == nil {
+		return nil
+	}
+	var exprs []Expression
+	for _, e := range ctx.AllExpression() {
+		if expr := buildExpression(e); expr != nil {
+			exprs = append(exprs, expr)
+		}
+	}
+	return exprs
+}
+
+// binaryExpressionContext is implemented by every infix expression
+// alternative of the grammar
+type binaryExpressionContext interface {
+	antlr.ParserRuleContext
+	GetOp() antlr.Token
+	Expression(i int) qasm_gen.IExpressionContext
+}
+
+// buildExpression converts an expression subtree
+func buildExpression(ctx qasm_gen.IExpressionContext) Expression {
+	if ctx == nil {
+		return nil
+	}
+
+	switch e := ctx.(type) {
+	case *qasm_gen.LiteralExpressionContext:
+		return buildLiteral(e)
+	case *qasm_gen.ParenthesisExpressionContext:
+		return &ParenthesizedExpression{BaseNode: nodeSpan(e), Expression: buildExpression(e.Expression())}
+	case *qasm_gen.IndexExpressionContext:
+		if e.Expression() == nil || e.IndexOperator() == nil {
+			return nil
+		}
+		// a[i][j] indexes the result of a[i] further
+		if inner, ok := e.Expression().(*qasm_gen.IndexExpressionContext); ok {
+			if indexed, ok := buildExpression(inner).(*IndexedIdentifier); ok {
+				indexed.BaseNode = nodeSpan(e)
+				return appendIndices(indexed, e.IndexOperator(), 0)
+			}
+		}
+		return buildIndex(nodeSpan(e), e.Expression().GetText(), e.IndexOperator())
+	case *qasm_gen.UnaryExpressionContext:
+		if e.GetOp() == nil {
+			return nil
+		}
+		return &UnaryExpression{
+			BaseNode: nodeSpan(e),
+			Operator: e.GetOp().GetText(),
+			Operand:  buildExpression(e.Expression()),
+		}
+	case *qasm_gen.CallExpressionContext:
+		if e.Identifier() == nil {
+			return nil
+		}
+		return &FunctionCall{
+			BaseNode:  nodeSpan(e),
+			Name:      e.Identifier().GetText(),
+			Arguments: nonNilExpressions(buildExpressionList(e.ExpressionList())),
+		}
+	case *qasm_gen.CastExpressionContext:
+		// A cast reads like a call to the target type, e.g. int[8](x)
+		name := ""
+		switch {
+		case e.ScalarType() != nil:
+			name = e.ScalarType().GetText()
+		case e.ArrayType() != nil:
+			name = e.ArrayType().GetText()
+		}
+		return &FunctionCall{
+			BaseNode:  nodeSpan(e),
+			Name:      name,
+			Arguments: nonNilExpressions([]Expression{buildExpression(e.Expression())}),
+		}
+	case *qasm_gen.DurationofExpressionContext:
+		return &FunctionCall{BaseNode: nodeSpan(e), Name: "durationof", Arguments: make([]Expression, 0)}
+	case binaryExpressionContext:
+		if e.GetOp() == nil {
+			return nil
+		}
+		return &BinaryExpression{
+			BaseNode: nodeSpan(e),
+			Left:     buildExpression(e.Expression(0)),
+			Operator: e.GetOp().GetText(),
+			Right:    buildExpression(e.Expression(1)),
+		}
+	}
+	return nil
+}
+
+func nonNilExpressions(exprs []Expression) []Expression {
+	out := make([]Expression, 0, len(exprs))
+	for _, e := range exprs {
+		if e != nil {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// buildLiteral converts a single-token expression. Hardware qubits and
+// timing literals have no dedicated node and are kept verbatim as
+// identifiers.
+func buildLiteral(ctx *qasm_gen.LiteralExpressionContext) Expression {
+	tok := ctx.GetStart()
+	if tok == nil {
+		return nil
+	}
+	span := tokenSpan(tok)
+	text := tok.GetText()
+	digits := strings.ReplaceAll(text, "_", "")
+
+	switch {
+	case ctx.DecimalIntegerLiteral() != nil:
+		value, _ := strconv.ParseInt(digits, 10, 64)
+		return &IntegerLiteral{BaseNode: span, Value: value, Raw: text}
+	case ctx.BinaryIntegerLiteral() != nil, ctx.OctalIntegerLiteral() != nil, ctx.HexIntegerLiteral() != nil:
+		value, _ := strconv.ParseInt(digits, 0, 64)
+		return &IntegerLiteral{BaseNode: span, Value: value, Raw: text}
+	case ctx.FloatLiteral() != nil:
+		value, _ := strconv.ParseFloat(digits, 64)
+		return &FloatLiteral{BaseNode: span, Value: value, Raw: text}
+	case ctx.ImaginaryLiteral() != nil:
+		value, _ := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(digits, "im")), 64)
+		return &ImaginaryLiteral{BaseNode: span, Value: value, Raw: text}
+	case ctx.BooleanLiteral() != nil:
+		return &BooleanLiteral{BaseNode: span, Value: text == "true"}
+	case ctx.BitstringLiteral() != nil:
+		return &StringLiteral{BaseNode: span, Value: strings.Trim(text, `"`)}
+	}
+	return &Identifier{BaseNode: span, Name: text}
+}
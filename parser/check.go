@@ -0,0 +1,279 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// CheckError is a structural invariant a node of an AST breaks
+type CheckError struct {
+	// Path leads from the program to the node, e.g. Statements[2].Qubits[0]
+	Path string
+
+	// Node is the offending node, or nil if the node is missing
+	Node    Node
+	Message string
+}
+
+func (e *CheckError) Error() string {
+	if e.Node != nil && e.Node.Pos().Line > 0 {
+		pos := e.Node.Pos()
+		return fmt.Sprintf("%s (%d:%d): %s", e.Path, pos.Line, pos.Column, e.Message)
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Check verifies the structural invariants of an AST, so passes that
+// build or rewrite programs can catch mistakes before printing or
+// encoding them. It reports, as *CheckError values:
+//
+//   - missing required children, such as a gate call's nil operand
+//   - empty names, such as an identifier or gate name of ""
+//   - negative register sizes
+//   - positions out of order: a node ending before it starts, a child
+//     outside its parent, or a statement starting before the previous
+//     one ends
+//
+// Nodes without a position, as built by hand, are exempt from the
+// position checks. Programs the parser builds pass, apart from the
+// placeholders error recovery leaves.
+func Check(program *Program) []error {
+	c := &checker{}
+	if program == nil {
+		c.fail("", nil, "program is nil")
+		return c.errs
+	}
+	if program.Version != nil {
+		if program.Version.Number == "" {
+			c.fail("Version", program.Version, "version number is empty")
+		}
+		c.span("Version", program, program.Version)
+	}
+	c.statements("Statements", program, program.Statements)
+	return c.errs
+}
+
+type checker struct {
+	errs []error
+}
+
+func (c *checker) fail(path string, node Node, format string, args ...interface{}) {
+	c.errs = append(c.errs, &CheckError{Path: path, Node: node, Message: fmt.Sprintf(format, args...)})
+}
+
+// name reports an empty name
+func (c *checker) name(path string, node Node, field, name string) {
+	if name == "" {
+		c.fail(path, node, "%s is empty", field)
+	}
+}
+
+// span reports a child that does not lie within its parent, or a node
+// that ends before it starts
+func (c *checker) span(path string, parent, child Node) {
+	start, end := child.Pos(), child.End()
+	if start.Line > 0 && end.Line > 0 && before(end, start) {
+		c.fail(path, child, "ends at %d:%d before it starts", end.Line, end.Column)
+	}
+	if parent == nil || start.Line == 0 {
+		return
+	}
+	if p := parent.Pos(); p.Line > 0 && before(start, p) {
+		c.fail(path, child, "starts before its parent at %d:%d", p.Line, p.Column)
+	}
+	if p := parent.End(); p.Line > 0 && end.Line > 0 && before(p, end) {
+		c.fail(path, child, "ends after its parent at %d:%d", p.Line, p.Column)
+	}
+}
+
+// before reports whether a comes before b
+func before(a, b Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+func (c *checker) statements(path string, parent Node, statements []Statement) {
+	var prev Statement
+	for i, stmt := range statements {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		if isNil(stmt) {
+			c.fail(p, nil, "statement is nil")
+			continue
+		}
+		if prev != nil && prev.End().Line > 0 && stmt.Pos().Line > 0 && before(stmt.Pos(), prev.End()) {
+			c.fail(p, stmt, "starts before the previous statement ends")
+		}
+		prev = stmt
+		c.span(p, parent, stmt)
+		c.statement(p, stmt)
+	}
+}
+
+func (c *checker) statement(path string, stmt Statement) {
+	switch s := stmt.(type) {
+	case *Include:
+		c.name(path, s, "include path", s.Path)
+	case *QuantumDeclaration:
+		c.name(path, s, "identifier", s.Identifier)
+		c.size(path+".Size", s, s.Size)
+	case *ClassicalDeclaration:
+		c.name(path, s, "identifier", s.Identifier)
+		c.name(path, s, "type", s.Type)
+		c.size(path+".Size", s, s.Size)
+		if s.Array != nil {
+			for i, dim := range s.Array.Dimensions {
+				c.size(fmt.Sprintf("%s.Array.Dimensions[%d]", path, i), s, dim)
+			}
+		}
+		c.optional(path+".Initializer", s, s.Initializer)
+	case *GateCall:
+		c.name(path, s, "gate name", s.Name)
+		for i := range s.Modifiers {
+			m := &s.Modifiers[i]
+			p := fmt.Sprintf("%s.Modifiers[%d]", path, i)
+			c.name(p, m, "modifier type", m.Type)
+			c.span(p, s, m)
+			c.expressions(p+".Parameters", m, m.Parameters)
+		}
+		c.expressions(path+".Parameters", s, s.Parameters)
+		c.expressions(path+".Qubits", s, s.Qubits)
+	case *Measurement:
+		c.required(path+".Qubit", s, s.Qubit)
+		c.optional(path+".Target", s, s.Target)
+	case *Assignment:
+		c.name(path, s, "operator", s.Operator)
+		c.required(path+".Target", s, s.Target)
+		c.required(path+".Value", s, s.Value)
+	case *Barrier:
+		c.expressions(path+".Qubits", s, s.Qubits)
+	case *Reset:
+		c.required(path+".Qubit", s, s.Qubit)
+	case *GateDefinition:
+		c.name(path, s, "gate name", s.Name)
+		c.parameters(path+".Parameters", s, s.Parameters)
+		c.parameters(path+".Qubits", s, s.Qubits)
+		c.statements(path+".Body", s, s.Body)
+	case *SubroutineDefinition:
+		c.name(path, s, "subroutine name", s.Name)
+		c.parameters(path+".Parameters", s, s.Parameters)
+		c.statements(path+".Body", s, s.Body)
+	case *CalibrationDefinition:
+		c.name(path, s, "calibration name", s.Name)
+		c.parameters(path+".Parameters", s, s.Parameters)
+		c.expressions(path+".Qubits", s, s.Qubits)
+		c.declarations(path+".Declarations", s, s.Declarations)
+	case *Calibration:
+		c.declarations(path+".Declarations", s, s.Declarations)
+	case *CalibrationGrammar:
+		c.name(path, s, "grammar name", s.Name)
+	case *IfStatement:
+		c.required(path+".Condition", s, s.Condition)
+		c.statements(path+".ThenBody", s, s.ThenBody)
+		c.statements(path+".ElseBody", s, s.ElseBody)
+	case *ForStatement:
+		c.name(path, s, "loop variable", s.Variable)
+		c.required(path+".Iterable", s, s.Iterable)
+		c.statements(path+".Body", s, s.Body)
+	case *WhileStatement:
+		c.required(path+".Condition", s, s.Condition)
+		c.statements(path+".Body", s, s.Body)
+	}
+}
+
+func (c *checker) declarations(path string, parent Node, decls []PulseDeclaration) {
+	for i := range decls {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		c.name(p, &decls[i], "declaration name", decls[i].Name)
+		c.span(p, parent, &decls[i])
+	}
+}
+
+func (c *checker) parameters(path string, parent Node, params []Parameter) {
+	for i := range params {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		c.name(p, &params[i], "parameter name", params[i].Name)
+		c.span(p, parent, &params[i])
+	}
+}
+
+// size checks a register size, which must not be negative if it is an
+// integer literal
+func (c *checker) size(path string, parent Node, size Expression) {
+	if size == nil {
+		return
+	}
+	c.required(path, parent, size)
+	switch e := size.(type) {
+	case *IntegerLiteral:
+		if e.Value < 0 {
+			c.fail(path, e, "size %d is negative", e.Value)
+		}
+	case *UnaryExpression:
+		if lit, ok := e.Operand.(*IntegerLiteral); ok && e.Operator == "-" && lit.Value > 0 {
+			c.fail(path, e, "size -%d is negative", lit.Value)
+		}
+	}
+}
+
+func (c *checker) expressions(path string, parent Node, exprs []Expression) {
+	for i, e := range exprs {
+		c.required(fmt.Sprintf("%s[%d]", path, i), parent, e)
+	}
+}
+
+// optional checks expr if it is present
+func (c *checker) optional(path string, parent Node, expr Expression) {
+	if !isNil(expr) {
+		c.required(path, parent, expr)
+	}
+}
+
+// required checks expr, which must be present
+func (c *checker) required(path string, parent Node, expr Expression) {
+	if isNil(expr) {
+		c.fail(path, nil, "expression is nil")
+		return
+	}
+	c.span(path, parent, expr)
+
+	switch e := expr.(type) {
+	case *Identifier:
+		c.name(path, e, "identifier", e.Name)
+	case *IndexedIdentifier:
+		c.name(path, e, "identifier", e.Name)
+		c.required(path+".Index", e, e.Index)
+		c.expressions(path+".Indices", e, e.Indices)
+	case *RangedIdentifier:
+		c.name(path, e, "identifier", e.Name)
+		c.optional(path+".Start", e, e.Start)
+		c.optional(path+".EndIndex", e, e.EndIndex)
+	case *RangeExpression:
+		c.optional(path+".Start", e, e.Start)
+		c.optional(path+".Step", e, e.Step)
+		c.optional(path+".Stop", e, e.Stop)
+	case *MeasureExpression:
+		c.required(path+".Qubit", e, e.Qubit)
+	case *ArrayLiteral:
+		c.expressions(path+".Elements", e, e.Elements)
+	case *BinaryExpression:
+		c.name(path, e, "operator", e.Operator)
+		c.required(path+".Left", e, e.Left)
+		c.required(path+".Right", e, e.Right)
+	case *UnaryExpression:
+		c.name(path, e, "operator", e.Operator)
+		c.required(path+".Operand", e, e.Operand)
+	case *FunctionCall:
+		c.name(path, e, "function name", e.Name)
+		c.expressions(path+".Arguments", e, e.Arguments)
+	case *ParenthesizedExpression:
+		c.required(path+".Expression", e, e.Expression)
+	}
+}
+
+// isNil reports whether n is nil or holds a nil pointer
+func isNil(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
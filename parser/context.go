@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"context"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+// contextCheckInterval is how many tokens are produced between checks of
+// the parse context
+const contextCheckInterval = 256
+
+// parseAborted carries a context error out of the ANTLR call stack
+type parseAborted struct {
+	err error
+}
+
+// contextLexer stops token production once its context is done, which
+// unwinds the parser through a parseAborted panic recovered by parse
+type contextLexer struct {
+	antlr.Lexer
+	ctx   context.Context
+	count int
+}
+
+// withContext wraps lexer so that parsing honors ctx. Contexts that can
+// never be canceled are returned unwrapped.
+func withContext(ctx context.Context, lexer antlr.Lexer) antlr.Lexer {
+	if ctx.Done() == nil {
+		return lexer
+	}
+	return &contextLexer{Lexer: lexer, ctx: ctx}
+}
+
+// NextToken implements antlr.TokenSource
+func (l *contextLexer) NextToken() antlr.Token {
+	l.count++
+	if l.count%contextCheckInterval == 0 {
+		checkContext(l.ctx)
+	}
+	return l.Lexer.NextToken()
+}
+
+// checkContext unwinds the parse through a parseAborted panic once ctx
+// is done. Besides the lexer, the phases after tokenization call it, so
+// a context that ends once every token is read still stops the parse.
+func checkContext(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		panic(parseAborted{err: err})
+	}
+}
@@ -0,0 +1,260 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/antlr4-go/antlr/v4"
+	qasm_gen "github.com/orangekame3/qasmparser/gen/parser"
+	"github.com/orangekame3/qasmparser/message"
+)
+
+// StatementParser builds the node for a custom statement. The node may be
+// of any type implementing Statement; printers write it with its String
+// method, so that should return the statement as QASM source.
+type StatementParser func(src CustomSource) (Statement, error)
+
+// CustomSource is a custom statement as written
+type CustomSource struct {
+	Keyword string
+
+	// Text is the statement from its keyword to the semicolon or closing
+	// brace that ends it
+	Text string
+
+	// Tokens are the tokens between the keyword and the end of the
+	// statement, comments excluded
+	Tokens []Token
+
+	// Span is the source range of the statement, for the node's BaseNode
+	Span BaseNode
+}
+
+// RegisterStatement extends the language with a statement starting with
+// keyword, for research dialects and hardware directives that the grammar
+// does not know. Where a statement may start, keyword and the tokens
+// after it up to the first semicolon, or closing brace, outside brackets
+// are handed to parse instead of the grammar:
+//
+//	p.RegisterStatement("calibrate", func(src parser.CustomSource) (parser.Statement, error) {
+//		return &Calibrate{BaseNode: src.Span, Target: src.Tokens[0].Text}, nil
+//	})
+//
+// Errors from parse are reported as diagnostics and the statement is
+// kept as a BadStatement. Keyword must be a valid identifier that is not
+// a language keyword, and becomes reserved at the start of statements.
+func (p *Parser) RegisterStatement(keyword string, parse StatementParser) error {
+	if !IsValidIdentifier(keyword) {
+		return fmt.Errorf("custom statement keyword %q is not a valid identifier", keyword)
+	}
+	for _, def := range Vocabulary() {
+		if def.Literal == keyword {
+			return fmt.Errorf("custom statement keyword %q is a language keyword", keyword)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.statements[keyword]; ok {
+		return fmt.Errorf("custom statement %q is already registered", keyword)
+	}
+	// Copy on write, so parses in flight keep the set they started with
+	statements := make(map[string]StatementParser, len(p.statements)+1)
+	for k, v := range p.statements {
+		statements[k] = v
+	}
+	statements[keyword] = parse
+	p.statements = statements
+	return nil
+}
+
+// currentStatements returns the registered custom statements
+func (p *Parser) currentStatements() map[string]StatementParser {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.statements
+}
+
+// Token types the dialect lexer reads. The generated constants are not
+// exported, so they are looked up by name.
+var (
+	tokenIdentifier = tokenTypeOf("Identifier")
+	tokenNop        = tokenTypeOf("NOP")
+	tokenSemicolon  = tokenTypeOf("SEMICOLON")
+	tokenElse       = tokenTypeOf("ELSE")
+	tokenLBrace     = tokenTypeOf("LBRACE")
+	tokenRBrace     = tokenTypeOf("RBRACE")
+	tokenLParen     = tokenTypeOf("LPAREN")
+	tokenRParen     = tokenTypeOf("RPAREN")
+	tokenLBracket   = tokenTypeOf("LBRACKET")
+	tokenRBracket   = tokenTypeOf("RBRACKET")
+)
+
+// customChannel carries the tokens of custom statements past the parser.
+// It is neither the default channel nor the hidden one comments use.
+const customChannel = 2
+
+// customToken is a token the dialect lexer retyped or moved to another
+// channel. The keyword of a custom statement becomes a nop statement
+// carrying the built node, so the statement keeps its place in the parse
+// tree.
+type customToken struct {
+	antlr.Token
+	tokenType int
+	channel   int
+
+	// stmt is the node of the statement the token starts, once built
+	stmt Statement
+}
+
+func (t *customToken) GetTokenType() int { return t.tokenType }
+func (t *customToken) GetChannel() int   { return t.channel }
+
+// sourceTokenType returns the type the lexer gave tok
+func sourceTokenType(tok antlr.Token) int {
+	if c, ok := tok.(*customToken); ok {
+		return c.Token.GetTokenType()
+	}
+	return tok.GetTokenType()
+}
+
+// dialectLexer hands custom statements to their parsers as the lexer
+// produces them
+type dialectLexer struct {
+	antlr.Lexer
+	statements map[string]StatementParser
+
+	// prev is the type of the last token the parser sees
+	prev int
+
+	// open is the keyword of the custom statement being read, with its
+	// tokens so far and the bracket depth within it
+	open   *customToken
+	tokens []antlr.Token
+	depth  int
+
+	diagnostics []ParseError
+}
+
+// withDialect wraps lexer to recognize the custom statements. Without
+// any, lexer is returned unwrapped.
+func withDialect(lexer antlr.Lexer, statements map[string]StatementParser) antlr.Lexer {
+	if len(statements) == 0 {
+		return lexer
+	}
+	return &dialectLexer{Lexer: lexer, statements: statements, prev: -1}
+}
+
+// dialectDiagnostics returns the errors custom statement parsers reported
+func dialectDiagnostics(lexer antlr.Lexer) []ParseError {
+	if l, ok := lexer.(*dialectLexer); ok {
+		return l.diagnostics
+	}
+	return nil
+}
+
+// NextToken implements antlr.TokenSource
+func (l *dialectLexer) NextToken() antlr.Token {
+	tok := l.Lexer.NextToken()
+	if tok.GetChannel() != antlr.TokenDefaultChannel {
+		return tok
+	}
+	if l.open != nil {
+		return l.continueStatement(tok)
+	}
+
+	if tok.GetTokenType() == tokenIdentifier && l.atStatementStart() {
+		if _, ok := l.statements[tok.GetText()]; ok {
+			l.open = &customToken{Token: tok, tokenType: tokenNop, channel: antlr.TokenDefaultChannel}
+			l.tokens, l.depth = nil, 0
+			l.prev = tokenNop
+			return l.open
+		}
+	}
+	l.prev = tok.GetTokenType()
+	return tok
+}
+
+// atStatementStart reports whether the next token may start a statement
+func (l *dialectLexer) atStatementStart() bool {
+	switch l.prev {
+	case -1, tokenSemicolon, tokenLBrace, tokenRBrace, tokenElse:
+		return true
+	}
+	return false
+}
+
+// continueStatement handles a token of the open custom statement
+func (l *dialectLexer) continueStatement(tok antlr.Token) antlr.Token {
+	switch tok.GetTokenType() {
+	case antlr.TokenEOF:
+		// Unterminated: the parser reports the missing semicolon
+		l.open = nil
+		return tok
+	case tokenLParen, tokenLBracket, tokenLBrace:
+		l.depth++
+	case tokenRParen, tokenRBracket:
+		l.depth = max(l.depth-1, 0)
+	case tokenRBrace:
+		if l.depth == 0 {
+			// The enclosing block ends before the statement did
+			l.open = nil
+			l.prev = tok.GetTokenType()
+			return tok
+		}
+		l.depth--
+		if l.depth == 0 {
+			l.finish(tok)
+			return &customToken{Token: tok, tokenType: tokenSemicolon, channel: antlr.TokenDefaultChannel}
+		}
+	case tokenSemicolon:
+		if l.depth == 0 {
+			l.finish(tok)
+			return tok
+		}
+	}
+	l.tokens = append(l.tokens, tok)
+	return &customToken{Token: tok, tokenType: tok.GetTokenType(), channel: customChannel}
+}
+
+// finish builds the open statement, which ends with stop
+func (l *dialectLexer) finish(stop antlr.Token) {
+	keyword := l.open
+	l.open = nil
+	l.prev = tokenSemicolon
+
+	src := CustomSource{
+		Keyword: keyword.GetText(),
+		Text:    keyword.GetInputStream().GetText(keyword.GetStart(), stop.GetStop()),
+		Tokens:  make([]Token, len(l.tokens)),
+		Span:    BaseNode{Position: tokenPosition(keyword), EndPos: tokenEnd(stop)},
+	}
+	for i, tok := range l.tokens {
+		src.Tokens[i] = newToken(tok)
+	}
+
+	stmt, err := l.statements[src.Keyword](src)
+	if err == nil && stmt == nil {
+		err = fmt.Errorf("no statement built")
+	}
+	if err != nil {
+		diag := NewDiagnostic("syntax", message.CustomStatement,
+			map[string]string{"keyword": src.Keyword, "error": err.Error()}, Position{
+				Line:   keyword.GetLine(),
+				Column: keyword.GetColumn(),
+				Offset: keyword.GetStart(),
+			})
+		diag.Span = Span{Start: keyword.GetColumn(), End: keyword.GetColumn() + len([]rune(src.Keyword))}
+		l.diagnostics = append(l.diagnostics, diag)
+		stmt = &BadStatement{BaseNode: src.Span, Text: src.Text}
+	}
+	keyword.stmt = stmt
+}
+
+// customStatement returns the node of a custom statement, or nil if ctx
+// is not one
+func customStatement(ctx *qasm_gen.NopStatementContext) Statement {
+	if tok, ok := ctx.GetStart().(*customToken); ok {
+		return tok.stmt
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding names a source text encoding
+type Encoding string
+
+const (
+	// EncodingAuto detects UTF-8, UTF-16 (with or without a BOM) and falls
+	// back to Latin-1 for input that is not valid UTF-8
+	EncodingAuto    Encoding = ""
+	EncodingUTF8    Encoding = "utf-8"
+	EncodingUTF16LE Encoding = "utf-16le"
+	EncodingUTF16BE Encoding = "utf-16be"
+	EncodingLatin1  Encoding = "latin-1"
+)
+
+// ParseEncoding converts a name such as "UTF-16LE" or "iso-8859-1" into an
+// Encoding
+func ParseEncoding(name string) (Encoding, error) {
+	switch strings.ToLower(strings.ReplaceAll(name, "_", "-")) {
+	case "", "auto":
+		return EncodingAuto, nil
+	case "utf-8", "utf8":
+		return EncodingUTF8, nil
+	case "utf-16le", "utf16le":
+		return EncodingUTF16LE, nil
+	case "utf-16be", "utf16be":
+		return EncodingUTF16BE, nil
+	case "latin-1", "latin1", "iso-8859-1":
+		return EncodingLatin1, nil
+	default:
+		return "", fmt.Errorf("unsupported encoding %q", name)
+	}
+}
+
+// DetectEncoding guesses the encoding of raw source bytes
+func DetectEncoding(data []byte) Encoding {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return EncodingUTF8
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return EncodingUTF16BE
+	}
+
+	// QASM sources are overwhelmingly ASCII, so BOM-less UTF-16 shows up as
+	// NUL bytes in every other position
+	sample := data[:min(len(data), 256)&^1]
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case pairs > 0 && oddZeros*2 >= pairs && evenZeros == 0:
+		return EncodingUTF16LE
+	case pairs > 0 && evenZeros*2 >= pairs && oddZeros == 0:
+		return EncodingUTF16BE
+	case utf8.Valid(data):
+		return EncodingUTF8
+	default:
+		return EncodingLatin1
+	}
+}
+
+// decodeSource transcodes raw source bytes to UTF-8. UTF-8 input is
+// returned as is.
+func decodeSource(data []byte, enc Encoding) ([]byte, error) {
+	if enc == EncodingAuto {
+		enc = DetectEncoding(data)
+	}
+
+	switch enc {
+	case EncodingUTF8:
+		return data, nil
+	case EncodingUTF16LE, EncodingUTF16BE:
+		return decodeUTF16(data, enc == EncodingUTF16BE)
+	case EncodingLatin1:
+		buf := make([]byte, 0, len(data))
+		for _, b := range data {
+			buf = utf8.AppendRune(buf, rune(b))
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", enc)
+	}
+}
+
+// decodeUTF16 converts UTF-16 bytes to UTF-8, dropping a leading BOM
+func decodeUTF16(data []byte, bigEndian bool) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("invalid UTF-16 input: odd length %d", len(data))
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		lo, hi := data[2*i], data[2*i+1]
+		if bigEndian {
+			lo, hi = hi, lo
+		}
+		units[i] = uint16(lo) | uint16(hi)<<8
+	}
+	if len(units) > 0 && units[0] == 0xFEFF {
+		units = units[1:]
+	}
+
+	buf := make([]byte, 0, len(units))
+	for _, r := range utf16.Decode(units) {
+		buf = utf8.AppendRune(buf, r)
+	}
+	return buf, nil
+}
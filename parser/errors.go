@@ -2,37 +2,270 @@ package parser
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/antlr4-go/antlr/v4"
+	"github.com/orangekame3/qasmparser/message"
 )
 
+// Severity classifies how serious a diagnostic is
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+	SeverityHint    Severity = "hint"
+)
+
+// rank orders severities from least to most serious.
+// An empty severity is treated as an error for backward compatibility.
+func (s Severity) rank() int {
+	switch s {
+	case SeverityHint:
+		return 0
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// AtLeast reports whether s is at least as serious as min
+func (s Severity) AtLeast(min Severity) bool {
+	return s.rank() >= min.rank()
+}
+
+// ParseSeverity converts a severity name such as "warning" into a Severity
+func ParseSeverity(name string) (Severity, error) {
+	switch sev := Severity(strings.ToLower(name)); sev {
+	case SeverityError, SeverityWarning, SeverityInfo, SeverityHint:
+		return sev, nil
+	default:
+		return "", fmt.Errorf("unknown severity %q", name)
+	}
+}
+
 // ParseError represents parsing errors
 type ParseError struct {
 	Message  string   `json:"message"`
 	Position Position `json:"position"`
-	Type     string   `json:"type"` // "syntax", "semantic", "lexer"
+	Type     string   `json:"type"` // "syntax", "semantic", "lexer", "io", "limit"
+	Severity Severity `json:"severity,omitempty"`
 	Context  string   `json:"context,omitempty"`
+	File     string   `json:"file,omitempty"`
+	Code     string   `json:"code,omitempty"`
+
+	// SourceLine is the text of the line the diagnostic points at and Span
+	// the columns on it the diagnostic covers, captured while parsing so
+	// code frames can be drawn without the original input
+	SourceLine string `json:"source_line,omitempty"`
+	Span       Span   `json:"span,omitzero"`
+
+	// Explanation tells how to fix a common mistake, with examples
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// Span is a range of columns on a diagnostic's source line. Columns are
+// 0-based like diagnostic positions and End is exclusive.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Diagnostic is a ParseError of any severity
+type Diagnostic = ParseError
+
+// IsError returns true if the diagnostic has error severity
+func (e *ParseError) IsError() bool {
+	return e.Severity.AtLeast(SeverityError)
 }
 
 func (e *ParseError) Error() string {
+	level := "error"
+	if !e.IsError() {
+		level = string(e.Severity)
+	}
 	if e.Context != "" {
-		return fmt.Sprintf("%s error at line %d, column %d: %s (context: %s)",
-			e.Type, e.Position.Line, e.Position.Column, e.Message, e.Context)
+		return fmt.Sprintf("%s %s at line %d, column %d: %s (context: %s)",
+			e.Type, level, e.Position.Line, e.Position.Column, e.Message, e.Context)
+	}
+	return fmt.Sprintf("%s %s at line %d, column %d: %s",
+		e.Type, level, e.Position.Line, e.Position.Column, e.Message)
+}
+
+// ParseErrors is the error returned by ParseString, ParseBytes and Validate.
+// It holds every error-severity diagnostic and follows errors.Join
+// semantics: errors.As can extract either the whole ParseErrors or the
+// first *ParseError.
+type ParseErrors []ParseError
+
+func (e ParseErrors) Error() string {
+	messages := make([]string, len(e))
+	for i := range e {
+		messages[i] = e[i].Error()
 	}
-	return fmt.Sprintf("%s error at line %d, column %d: %s",
-		e.Type, e.Position.Line, e.Position.Column, e.Message)
+	return strings.Join(messages, "\n")
+}
+
+// Unwrap returns each diagnostic as a *ParseError
+func (e ParseErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i := range e {
+		errs[i] = &e[i]
+	}
+	return errs
 }
 
 // ParseResult contains parsing results with errors
 type ParseResult struct {
 	Program *Program     `json:"program,omitempty"`
 	Errors  []ParseError `json:"errors,omitempty"`
+
+	// Suppressions are the qasmparser:ignore comments in the source, with
+	// the diagnostics each removed from Errors
+	Suppressions []Suppression `json:"suppressions,omitempty"`
+
+	// tokens and input back Trivia(), Tokens() and Source()
+	tokens []antlr.Token
+	input  antlr.CharStream
 }
 
-// HasErrors returns true if there are any errors
+// ParseFileResult is the outcome of parsing a single file. Read and decode
+// failures are recorded as "io" diagnostics alongside syntax and semantic
+// ones, so every kind of failure survives JSON encoding.
+type ParseFileResult struct {
+	File string `json:"file"`
+	ParseResult
+
+	// Skipped is set for a file a fail-fast batch did not parse because
+	// an earlier file had errors
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// HasErrors returns true if there are any error-severity diagnostics
 func (r *ParseResult) HasErrors() bool {
-	return len(r.Errors) > 0
+	return r.HasSeverity(SeverityError)
+}
+
+// HasSeverity returns true if any diagnostic is at least as serious as min,
+// e.g. HasSeverity(SeverityWarning) implements a "fail on warning" policy
+func (r *ParseResult) HasSeverity(min Severity) bool {
+	for i := range r.Errors {
+		if r.Errors[i].Severity.AtLeast(min) {
+			return true
+		}
+	}
+	return false
+}
+
+// FirstError returns the first error-severity diagnostic, or nil
+func (r *ParseResult) FirstError() *ParseError {
+	for i := range r.Errors {
+		if r.Errors[i].IsError() {
+			return &r.Errors[i]
+		}
+	}
+	return nil
+}
+
+// Warnings returns the warning-severity diagnostics
+func (r *ParseResult) Warnings() []ParseError {
+	var warnings []ParseError
+	for _, err := range r.Errors {
+		if err.Severity == SeverityWarning {
+			warnings = append(warnings, err)
+		}
+	}
+	return warnings
+}
+
+// Sort orders errors by file, line, column and code, and drops identical
+// duplicates produced by cascading recovery
+func (r *ParseResult) Sort() {
+	sort.SliceStable(r.Errors, func(i, j int) bool {
+		return lessParseError(&r.Errors[i], &r.Errors[j])
+	})
+
+	unique := r.Errors[:0]
+	for i, err := range r.Errors {
+		if i > 0 && err == r.Errors[i-1] {
+			continue
+		}
+		unique = append(unique, err)
+	}
+	r.Errors = unique
+}
+
+// lessParseError reports whether a sorts before b
+func lessParseError(a, b *ParseError) bool {
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Position.Line != b.Position.Line {
+		return a.Position.Line < b.Position.Line
+	}
+	if a.Position.Column != b.Position.Column {
+		return a.Position.Column < b.Position.Column
+	}
+	if a.Code != b.Code {
+		return a.Code < b.Code
+	}
+	if a.Type != b.Type {
+		return a.Type < b.Type
+	}
+	return a.Message < b.Message
+}
+
+// Err returns the error-severity diagnostics as a ParseErrors, or nil if
+// there are none
+func (r *ParseResult) Err() error {
+	var errs ParseErrors
+	for _, err := range r.Errors {
+		if err.IsError() {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// attachSource fills in the source line of each diagnostic positioned in
+// input, and a one-column span where the diagnostic has none
+func attachSource(errs []ParseError, input antlr.CharStream) {
+	if len(errs) == 0 || input == nil || input.Size() == 0 {
+		return
+	}
+	lines := strings.Split(input.GetText(0, input.Size()-1), "\n")
+	for i := range errs {
+		err := &errs[i]
+		line := err.Position.Line
+		if line < 1 || line > len(lines) {
+			continue
+		}
+		if err.SourceLine == "" {
+			err.SourceLine = strings.TrimSuffix(lines[line-1], "\r")
+		}
+		if err.Span == (Span{}) {
+			err.Span = Span{Start: err.Position.Column, End: err.Position.Column + 1}
+		}
+	}
+}
+
+// finish puts diagnostics in their final order and applies MaxErrors.
+// Sorting happens first so the same errors are kept on every run.
+func (r *ParseResult) finish(opts *ParseOptions) {
+	r.Sort()
+	if opts.MaxErrors > 0 && len(r.Errors) > opts.MaxErrors {
+		r.Errors = r.Errors[:opts.MaxErrors]
+	}
 }
 
 // ErrorMessages returns all error messages as strings
@@ -46,7 +279,7 @@ func (r *ParseResult) ErrorMessages() []string {
 
 // String returns a formatted string of all errors
 func (r *ParseResult) String() string {
-	if !r.HasErrors() {
+	if len(r.Errors) == 0 {
 		return "No errors"
 	}
 	return strings.Join(r.ErrorMessages(), "\n")
@@ -76,11 +309,121 @@ func (l *ErrorListener) HasErrors() bool {
 
 // SyntaxError implements antlr.ErrorListener interface
 func (l *ErrorListener) SyntaxError(recognizer antlr.Recognizer, offendingSymbol interface{}, line, column int, msg string, e antlr.RecognitionException) {
-	l.errors = append(l.errors, ParseError{
-		Message:  msg,
-		Position: Position{Line: line, Column: column},
-		Type:     "syntax",
-	})
+	code, args := classifySyntaxError(msg)
+	tok, _ := offendingSymbol.(antlr.Token)
+	if p, ok := recognizer.(antlr.Parser); ok && tok != nil {
+		if diag, ok := explainSyntaxError(p.GetTokenStream(), tok, code, args); ok {
+			l.errors = append(l.errors, diag)
+			return
+		}
+	}
+	err := NewDiagnostic("syntax", code, args, Position{Line: line, Column: column})
+	// Cover the whole offending token if it lies on one line
+	if tok != nil && tok.GetTokenType() != antlr.TokenEOF {
+		if text := tok.GetText(); text != "" && !strings.Contains(text, "\n") {
+			err.Span = Span{Start: column, End: column + utf8.RuneCountInString(text)}
+		}
+	}
+	l.errors = append(l.errors, err)
+}
+
+// explainSyntaxError recognizes common mistakes behind a generic ANTLR
+// error, offending being the token it reported, and returns a diagnostic
+// that names the mistake instead
+func explainSyntaxError(stream antlr.TokenStream, offending antlr.Token, code string, args map[string]string) (ParseError, bool) {
+	prev := previousToken(stream, offending)
+
+	// A statement without its semicolon: point after its last token
+	// rather than at the start of the next statement
+	missingSemicolon := code == message.MissingToken && args["token"] == "';'" ||
+		code == message.MismatchedInput && args["expected"] == "';'"
+	if missingSemicolon && prev != nil && prev.GetLine() < offending.GetLine() {
+		text := prev.GetText()
+		if strings.Contains(text, "\n") {
+			return ParseError{}, false
+		}
+		end := prev.GetColumn() + utf8.RuneCountInString(text)
+		diag := NewDiagnostic("syntax", message.MissingSemicolon, map[string]string{"token": "'" + text + "'"},
+			Position{Line: prev.GetLine(), Column: end, Offset: prev.GetStop() + 1})
+		diag.Span = Span{Start: end, End: end + 1}
+		return diag, true
+	}
+
+	// '=' or '->' in the wrong place of a measurement
+	if text := offending.GetText(); (text == "=" || text == "->") && inMeasurement(stream, offending) {
+		pos := Position{Line: offending.GetLine(), Column: offending.GetColumn(), Offset: offending.GetStart()}
+		diag := NewDiagnostic("syntax", message.MeasurementSyntax, map[string]string{"operator": "'" + text + "'"}, pos)
+		diag.Span = Span{Start: pos.Column, End: pos.Column + len(text)}
+		return diag, true
+	}
+	return ParseError{}, false
+}
+
+// previousToken returns the token before tok on the parser's channel
+func previousToken(stream antlr.TokenStream, tok antlr.Token) antlr.Token {
+	for i := tok.GetTokenIndex() - 1; i >= 0; i-- {
+		if t := stream.Get(i); t.GetChannel() == antlr.TokenDefaultChannel {
+			return t
+		}
+	}
+	return nil
+}
+
+// inMeasurement reports whether the statement around tok contains the
+// measure keyword
+func inMeasurement(stream antlr.TokenStream, tok antlr.Token) bool {
+	isMeasure := func(t antlr.Token) bool { return t.GetText() == "measure" }
+	ends := func(t antlr.Token) bool {
+		switch t.GetText() {
+		case ";", "{", "}":
+			return true
+		}
+		return false
+	}
+	for i := tok.GetTokenIndex() - 1; i >= 0; i-- {
+		t := stream.Get(i)
+		if ends(t) {
+			break
+		}
+		if isMeasure(t) {
+			return true
+		}
+	}
+	// Tokens after tok are read through lookahead, which fetches them
+	for k := 1; ; k++ {
+		t := stream.LT(k)
+		if t == nil || t.GetTokenType() == antlr.TokenEOF {
+			return false
+		}
+		if t.GetTokenIndex() <= tok.GetTokenIndex() {
+			continue
+		}
+		if ends(t) {
+			return false
+		}
+		if isMeasure(t) {
+			return true
+		}
+	}
+}
+
+// syntaxCodes are the codes of the messages ANTLR reports
+var syntaxCodes = []string{
+	message.MismatchedInput,
+	message.ExtraneousInput,
+	message.MissingToken,
+	message.NoViableAlternative,
+	message.UnrecognizedToken,
+}
+
+// classifySyntaxError returns the code and arguments of an ANTLR message
+func classifySyntaxError(msg string) (string, map[string]string) {
+	for _, code := range syntaxCodes {
+		if args, ok := message.English.Match(code, msg); ok {
+			return code, args
+		}
+	}
+	return message.SyntaxError, map[string]string{"message": msg}
 }
 
 // ReportAmbiguity implements antlr.ErrorListener interface
@@ -104,6 +447,7 @@ func NewSyntaxError(message string, pos Position) ParseError {
 		Message:  message,
 		Position: pos,
 		Type:     "syntax",
+		Severity: SeverityError,
 	}
 }
 
@@ -113,6 +457,7 @@ func NewSemanticError(message string, pos Position) ParseError {
 		Message:  message,
 		Position: pos,
 		Type:     "semantic",
+		Severity: SeverityError,
 	}
 }
 
@@ -122,5 +467,79 @@ func NewLexerError(message string, pos Position) ParseError {
 		Message:  message,
 		Position: pos,
 		Type:     "lexer",
+		Severity: SeverityError,
+	}
+}
+
+// NewIOError creates a diagnostic for a file that could not be read
+func NewIOError(file string, err error) ParseError {
+	diag := NewDiagnostic("io", message.ReadFailed, map[string]string{"error": err.Error()}, Position{})
+	diag.File = file
+	return diag
+}
+
+// NewLimitError creates a diagnostic for a file skipped or abandoned because
+// it exceeded a time or size budget
+func NewLimitError(file, message string) ParseError {
+	return ParseError{
+		Message:  message,
+		Type:     "limit",
+		Severity: SeverityError,
+		File:     file,
+	}
+}
+
+// NewDiagnostic creates an error-severity diagnostic with a code from the
+// message package, its message being the English text for code filled
+// with args. Localize can translate such diagnostics.
+func NewDiagnostic(errType, code string, args map[string]string, pos Position) ParseError {
+	text, ok := message.English.Format(code, args)
+	if !ok {
+		text = code
+	}
+	return ParseError{
+		Message:     text,
+		Position:    pos,
+		Type:        errType,
+		Severity:    SeverityError,
+		Code:        code,
+		Explanation: message.Explanations[code],
+	}
+}
+
+// Localize returns diags with their messages in the language of catalog.
+// The arguments are recovered from the English message, so diagnostics
+// without a code, or whose code the catalog lacks, keep their message.
+func Localize(diags []ParseError, catalog message.Catalog) []ParseError {
+	localized := make([]ParseError, len(diags))
+	for i, diag := range diags {
+		if args, ok := message.English.Match(diag.Code, diag.Message); ok {
+			if text, ok := catalog.Format(diag.Code, args); ok {
+				diag.Message = text
+			}
+		}
+		localized[i] = diag
+	}
+	return localized
+}
+
+// newSizeLimitError creates a diagnostic for a file of size bytes skipped
+// for exceeding limit
+func newSizeLimitError(file string, size, limit int64) ParseError {
+	diag := NewDiagnostic("limit", message.FileTooLarge, map[string]string{
+		"size":  strconv.FormatInt(size, 10),
+		"limit": strconv.FormatInt(limit, 10),
+	}, Position{})
+	diag.File = file
+	return diag
+}
+
+// NewWarning creates a new warning-severity diagnostic
+func NewWarning(errType, message string, pos Position) ParseError {
+	return ParseError{
+		Message:  message,
+		Position: pos,
+		Type:     errType,
+		Severity: SeverityWarning,
 	}
 }
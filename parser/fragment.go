@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/antlr4-go/antlr/v4"
+	qasm_gen "github.com/orangekame3/qasmparser/gen/parser"
+	"github.com/orangekame3/qasmparser/message"
+)
+
+// fragmentParser is the subset of the generated parser used to parse
+// fragments
+type fragmentParser interface {
+	antlr.Parser
+	Statement() qasm_gen.IStatementContext
+	Expression() qasm_gen.IExpressionContext
+}
+
+// ParseStatement parses a single statement, such as "h q[0];", without a
+// version header or surrounding program. Positions in the result are
+// relative to src. Statements the AST has no node for are reported as an
+// error.
+func ParseStatement(src string) (Statement, error) {
+	var (
+		stmt    Statement
+		keyword string
+	)
+	err := parseFragment(src, func(p fragmentParser) {
+		ctx := p.Statement()
+		stmt = buildStatement(ctx)
+		keyword = ctx.GetStart().GetText()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return nil, fmt.Errorf("%q statements are not represented in the AST", keyword)
+	}
+	// A lone statement has no defcalgrammar selecting openpulse
+	applyCalibrationGrammar([]Statement{stmt})
+	return stmt, nil
+}
+
+// ParseExpression parses a single expression, such as "theta / 2",
+// without a surrounding statement. Positions in the result are relative
+// to src.
+func ParseExpression(src string) (Expression, error) {
+	var expr Expression
+	err := parseFragment(src, func(p fragmentParser) {
+		expr = buildExpression(p.Expression())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// parseFragment runs rule over src and fails if it reports syntax errors
+// or does not consume all of src
+func parseFragment(src string, rule func(p fragmentParser)) error {
+	input := antlr.NewInputStream(NewParser().preprocessContent(src))
+	lexer := qasm_gen.Newqasm3Lexer(input)
+	lexerErrors := NewErrorListener()
+	lexer.RemoveErrorListeners()
+	lexer.AddErrorListener(lexerErrors)
+
+	stream := antlr.NewCommonTokenStream(lexer, antlr.TokenDefaultChannel)
+	var p fragmentParser = qasm_gen.Newqasm3Parser(stream)
+	parserErrors := NewErrorListener()
+	p.RemoveErrorListeners()
+	p.AddErrorListener(parserErrors)
+
+	rule(p)
+
+	errs := append(lexerErrors.GetErrors(), parserErrors.GetErrors()...)
+	if len(errs) == 0 {
+		if next := stream.LT(1); next != nil && next.GetTokenType() != antlr.TokenEOF {
+			pos := Position{Line: next.GetLine(), Column: next.GetColumn(), Offset: next.GetStart()}
+			errs = append(errs, NewDiagnostic("syntax", message.TrailingInput, map[string]string{"input": strconv.Quote(next.GetText())}, pos))
+		}
+	}
+	if len(errs) > 0 {
+		attachSource(errs, input)
+		return ParseErrors(errs)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// jsonBatchSize is the number of statements marshaled concurrently before
+// they are written out, bounding memory use for very large programs
+const jsonBatchSize = 256
+
+// JSONEncoder writes a Program as JSON incrementally, one statement at a
+// time, instead of marshaling the whole tree in memory. Its output is
+// byte-identical to json.Marshal / json.MarshalIndent of the same program.
+//
+// Wrap the writer (e.g. with compress/gzip) to compress the output.
+type JSONEncoder struct {
+	w       io.Writer
+	indent  string
+	workers int
+}
+
+// NewJSONEncoder creates a compact JSON encoder writing to w
+func NewJSONEncoder(w io.Writer) *JSONEncoder {
+	return &JSONEncoder{
+		w:       w,
+		workers: runtime.GOMAXPROCS(0),
+	}
+}
+
+// SetIndent enables pretty output using indent for each nesting level.
+// An empty indent selects compact output.
+func (e *JSONEncoder) SetIndent(indent string) {
+	e.indent = indent
+}
+
+// SetWorkers sets how many statements are marshaled in parallel
+func (e *JSONEncoder) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	e.workers = n
+}
+
+// Encode writes program to the underlying writer
+func (e *JSONEncoder) Encode(program *Program) error {
+	if program == nil {
+		_, err := io.WriteString(e.w, "null")
+		return err
+	}
+
+	bw := bufio.NewWriter(e.w)
+	enc := &jsonWriter{w: bw, indent: e.indent}
+
+	enc.raw("{")
+	enc.field("position", program.Position, true)
+	enc.field("end_position", program.EndPos, false)
+	if program.Version != nil {
+		enc.field("version", program.Version, false)
+	}
+
+	enc.key("statements", false)
+	e.encodeStatements(enc, program.Statements)
+
+	if len(program.Comments) > 0 {
+		enc.field("comments", program.Comments, false)
+	}
+	if program.Run != nil {
+		enc.field("run", program.Run, false)
+	}
+	enc.newline(0)
+	enc.raw("}")
+
+	if enc.err != nil {
+		return enc.err
+	}
+	return bw.Flush()
+}
+
+// encodeStatements writes the statements array, marshaling batches in parallel
+func (e *JSONEncoder) encodeStatements(enc *jsonWriter, statements []Statement) {
+	if statements == nil {
+		enc.raw("null")
+		return
+	}
+	if len(statements) == 0 {
+		enc.raw("[]")
+		return
+	}
+
+	enc.raw("[")
+	prefix := strings.Repeat(enc.indent, 2)
+	chunks := make([][]byte, min(jsonBatchSize, len(statements)))
+
+	for start := 0; start < len(statements) && enc.err == nil; start += jsonBatchSize {
+		batch := statements[start:min(start+jsonBatchSize, len(statements))]
+		errs := make([]error, len(batch))
+
+		var wg sync.WaitGroup
+		next := make(chan int)
+		for w := 0; w < min(e.workers, len(batch)); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					chunks[i], errs[i] = enc.marshal(batch[i], prefix)
+				}
+			}()
+		}
+		for i := range batch {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+
+		for i := range batch {
+			if errs[i] != nil {
+				enc.err = errs[i]
+				return
+			}
+			if start+i > 0 {
+				enc.raw(",")
+			}
+			enc.newline(2)
+			enc.bytes(chunks[i])
+		}
+	}
+
+	enc.newline(1)
+	enc.raw("]")
+}
+
+// jsonWriter tracks layout state and the first write error
+type jsonWriter struct {
+	w      *bufio.Writer
+	indent string
+	err    error
+}
+
+func (j *jsonWriter) raw(s string) {
+	if j.err == nil {
+		_, j.err = j.w.WriteString(s)
+	}
+}
+
+func (j *jsonWriter) bytes(b []byte) {
+	if j.err == nil {
+		_, j.err = j.w.Write(b)
+	}
+}
+
+// newline starts a new line at the given depth in pretty mode
+func (j *jsonWriter) newline(depth int) {
+	if j.indent == "" {
+		return
+	}
+	j.raw("\n")
+	for i := 0; i < depth; i++ {
+		j.raw(j.indent)
+	}
+}
+
+// key writes an object key, preceded by a comma unless it is the first one
+func (j *jsonWriter) key(name string, first bool) {
+	if !first {
+		j.raw(",")
+	}
+	j.newline(1)
+	j.raw(`"` + name + `":`)
+	if j.indent != "" {
+		j.raw(" ")
+	}
+}
+
+// field writes a complete top-level key/value pair
+func (j *jsonWriter) field(name string, value interface{}, first bool) {
+	j.key(name, first)
+	data, err := j.marshal(value, j.indent)
+	if err != nil {
+		if j.err == nil {
+			j.err = err
+		}
+		return
+	}
+	j.bytes(data)
+}
+
+// marshal encodes a value nested under prefix
+func (j *jsonWriter) marshal(value interface{}, prefix string) ([]byte, error) {
+	if j.indent == "" {
+		return json.Marshal(value)
+	}
+	return json.MarshalIndent(value, prefix, j.indent)
+}
@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"github.com/antlr4-go/antlr/v4"
+	qasm_gen "github.com/orangekame3/qasmparser/gen/parser"
+)
+
+// openpulse is the calibration grammar whose bodies the parser models
+const openpulse = "openpulse"
+
+// pulseTypes are the openpulse types a body can declare names of
+var pulseTypes = map[string]bool{"port": true, "frame": true, "waveform": true}
+
+// Token types the openpulse scanner reads, besides those of the dialect
+// lexer
+var (
+	tokenExtern = tokenTypeOf("EXTERN")
+	tokenEquals = tokenTypeOf("EQUALS")
+)
+
+// applyCalibrationGrammar keeps the openpulse model of cal and defcal
+// bodies only where defcalgrammar "openpulse" is in effect, that is after
+// it and before any defcalgrammar choosing another grammar
+func applyCalibrationGrammar(statements []Statement) {
+	grammar := ""
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *CalibrationGrammar:
+			grammar = s.Name
+		case *Calibration:
+			if grammar != openpulse {
+				s.Declarations, s.References = nil, nil
+			}
+		case *CalibrationDefinition:
+			if grammar != openpulse {
+				s.Declarations, s.References = nil, nil
+			}
+		}
+	}
+}
+
+// scanPulse reads the port, frame and waveform declarations in a
+// calibration body and the names it refers to. The body is lexed as
+// OpenQASM, which openpulse extends; statements are split at semicolons
+// and braces, so declarations inside nested blocks are found too.
+func scanPulse(body antlr.Token) ([]PulseDeclaration, []Identifier) {
+	start := tokenPosition(body)
+	input := antlr.NewInputStream(body.GetText())
+	lexer := qasm_gen.Newqasm3Lexer(input)
+	lexer.RemoveErrorListeners()
+
+	s := &pulseScanner{input: input, start: start}
+	var stmt []antlr.Token
+	for _, tok := range lexer.GetAllTokens() {
+		if tok.GetChannel() != antlr.TokenDefaultChannel {
+			continue
+		}
+		switch tok.GetTokenType() {
+		case tokenSemicolon:
+			s.statement(stmt, tok)
+			stmt = nil
+		case tokenLBrace, tokenRBrace:
+			s.statement(stmt, nil)
+			stmt = nil
+		default:
+			stmt = append(stmt, tok)
+		}
+	}
+	s.statement(stmt, nil)
+	return s.declarations, s.references
+}
+
+type pulseScanner struct {
+	input *antlr.InputStream
+
+	// start is where the body begins in the source; token positions are
+	// relative to it
+	start Position
+
+	declarations []PulseDeclaration
+	references   []Identifier
+}
+
+// statement reads the tokens of one statement, up to its semicolon if it
+// has one
+func (s *pulseScanner) statement(tokens []antlr.Token, semicolon antlr.Token) {
+	if len(tokens) == 0 {
+		return
+	}
+	i := 0
+	extern := tokens[0].GetTokenType() == tokenExtern
+	if extern {
+		i++
+	}
+	if i+1 >= len(tokens) || !pulseTypes[tokens[i].GetText()] ||
+		tokens[i].GetTokenType() != tokenIdentifier || tokens[i+1].GetTokenType() != tokenIdentifier {
+		s.refer(tokens)
+		return
+	}
+
+	last := tokens[len(tokens)-1]
+	if semicolon != nil {
+		last = semicolon
+	}
+	decl := PulseDeclaration{
+		BaseNode: BaseNode{Position: s.position(tokens[0]), EndPos: s.end(last)},
+		Type:     tokens[i].GetText(),
+		Name:     tokens[i+1].GetText(),
+		Extern:   extern,
+	}
+	if rest := tokens[i+2:]; len(rest) > 1 && rest[0].GetTokenType() == tokenEquals {
+		decl.Value = s.input.GetText(rest[1].GetStart(), tokens[len(tokens)-1].GetStop())
+		s.refer(rest[1:])
+	}
+	s.declarations = append(s.declarations, decl)
+}
+
+// refer records the identifiers among tokens as references
+func (s *pulseScanner) refer(tokens []antlr.Token) {
+	for _, tok := range tokens {
+		if tok.GetTokenType() == tokenIdentifier {
+			s.references = append(s.references, Identifier{
+				BaseNode: BaseNode{Position: s.position(tok), EndPos: s.end(tok)},
+				Name:     tok.GetText(),
+			})
+		}
+	}
+}
+
+// position returns where a token of the body is in the source
+func (s *pulseScanner) position(tok antlr.Token) Position {
+	rel := tokenPosition(tok)
+	pos := Position{Line: s.start.Line + rel.Line - 1, Column: rel.Column, Offset: s.start.Offset + rel.Offset}
+	if rel.Line == 1 {
+		pos.Column += s.start.Column - 1
+	}
+	return pos
+}
+
+// end returns the position just after a token of the body
+func (s *pulseScanner) end(tok antlr.Token) Position {
+	return advancePosition(s.position(tok), tok.GetText())
+}
@@ -1,14 +1,18 @@
 package parser
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/antlr4-go/antlr/v4"
 	qasm_gen "github.com/orangekame3/qasmparser/gen/parser"
+	"github.com/orangekame3/qasmparser/message"
 )
 
 // ParseOptions configures the parser behavior
@@ -24,6 +28,10 @@ type ParseOptions struct {
 
 	// MaxErrors limits the number of errors to collect
 	MaxErrors int
+
+	// Encoding sets the source encoding for ParseFile and ParseReader.
+	// EncodingAuto (the default) detects UTF-8, UTF-16 and Latin-1.
+	Encoding Encoding
 }
 
 // DefaultParseOptions returns default parsing options
@@ -36,9 +44,17 @@ func DefaultParseOptions() *ParseOptions {
 	}
 }
 
-// Parser represents the main OpenQASM 3.0 parser
+// Parser represents the main OpenQASM 3.0 parser.
+//
+// A Parser is safe for concurrent use by multiple goroutines: every parse
+// call creates its own lexer, token stream and ANTLR parser, and reads the
+// options once at the start of the call. SetOptions may be called
+// concurrently with parsing; in-flight calls keep the options they started
+// with. Options passed to the parser must not be modified afterwards.
 type Parser struct {
-	options *ParseOptions
+	mu         sync.RWMutex
+	options    *ParseOptions
+	statements map[string]StatementParser
 }
 
 // NewParser creates a new parser with default options
@@ -61,10 +77,7 @@ func NewParserWithOptions(opts *ParseOptions) *Parser {
 // ParseString parses QASM code from a string
 func (p *Parser) ParseString(content string) (*Program, error) {
 	result := p.ParseWithErrors(content)
-	if result.HasErrors() {
-		return result.Program, &result.Errors[0]
-	}
-	return result.Program, nil
+	return result.Program, result.Err()
 }
 
 // ParseReader parses QASM code from an io.Reader
@@ -73,7 +86,11 @@ func (p *Parser) ParseReader(reader io.Reader) (*Program, error) {
 	if err != nil {
 		return nil, err
 	}
-	return p.ParseString(string(content))
+	content, err = decodeSource(content, p.currentOptions().Encoding)
+	if err != nil {
+		return nil, err
+	}
+	return p.ParseBytes(content)
 }
 
 // ParseFile parses QASM code from a file
@@ -82,37 +99,180 @@ func (p *Parser) ParseFile(filename string) (*Program, error) {
 	if err != nil {
 		return nil, err
 	}
-	return p.ParseString(string(content))
+	content, err = decodeSource(content, p.currentOptions().Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return p.ParseBytes(content)
+}
+
+// ParseFileWithErrors parses a file and reports every failure, including
+// read errors, as diagnostics tagged with the file name
+func (p *Parser) ParseFileWithErrors(filename string) *ParseFileResult {
+	return p.parseFile(context.Background(), filename, 0)
+}
+
+// parseFile parses a file under ctx, refusing files larger than maxSize
+// bytes when maxSize is positive
+func (p *Parser) parseFile(ctx context.Context, filename string, maxSize int64) *ParseFileResult {
+	result := &ParseFileResult{File: filename}
+	fail := func(diag ParseError) *ParseFileResult {
+		result.Errors = []ParseError{diag}
+		return result
+	}
+
+	if maxSize > 0 {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return fail(NewIOError(filename, err))
+		}
+		if info.Size() > maxSize {
+			return fail(newSizeLimitError(filename, info.Size(), maxSize))
+		}
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return fail(NewIOError(filename, err))
+	}
+	return p.parseContent(ctx, filename, content)
 }
 
-// ParseWithContext parses with context for cancellation
+// parseContent parses the content of the named file under ctx
+func (p *Parser) parseContent(ctx context.Context, filename string, content []byte) *ParseFileResult {
+	result := &ParseFileResult{File: filename}
+	fail := func(diag ParseError) *ParseFileResult {
+		result.Errors = []ParseError{diag}
+		return result
+	}
+
+	content, err := decodeSource(content, p.currentOptions().Encoding)
+	if err != nil {
+		return fail(NewIOError(filename, err))
+	}
+
+	parsed, err := p.parseBytes(ctx, content)
+	if err != nil {
+		diag := NewDiagnostic("limit", message.ParsingStopped, map[string]string{"reason": err.Error()}, Position{})
+		diag.File = filename
+		return fail(diag)
+	}
+
+	result.ParseResult = *parsed
+	for i := range result.Errors {
+		result.Errors[i].File = filename
+	}
+	return result
+}
+
+// ParseBytes parses QASM code from a byte slice without converting it to a
+// string first. The slice is not modified and must not change during parsing.
+func (p *Parser) ParseBytes(content []byte) (*Program, error) {
+	result := p.ParseBytesWithErrors(content)
+	return result.Program, result.Err()
+}
+
+// ParseWithContext parses with context for cancellation. Parsing stops
+// with the context's error once it is canceled or its deadline passes.
 func (p *Parser) ParseWithContext(ctx context.Context, content string) (*Program, error) {
 	// Check if context is already cancelled
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
 
-	// For now, we'll parse directly without context support
-	// Future enhancement could implement context-aware parsing
-	return p.ParseString(content)
+	content = p.preprocessContent(content)
+	opts := p.currentOptions()
+	result, err := p.parse(ctx, newCharStream(content), opts, checkCodePoints(content, opts.StrictMode))
+	if err != nil {
+		return nil, err
+	}
+	return result.Program, result.Err()
 }
 
-// Validate validates QASM syntax without building full AST
+// Validate validates QASM syntax without building full AST.
+// It runs the lexer and parser only, skipping parse tree construction, AST
+// conversion and comment extraction. The returned error is a ParseErrors
+// holding every error found.
 func (p *Parser) Validate(content string) error {
-	result := p.ParseWithErrors(content)
-	if result.HasErrors() {
-		return &result.Errors[0]
+	opts := p.currentOptions()
+	content = p.preprocessContent(content)
+	input := newCharStream(content)
+
+	listener := NewErrorListener()
+
+	lexer := p.createLexer(input)
+	lexer.RemoveErrorListeners()
+	if !opts.ErrorRecovery {
+		lexer.AddErrorListener(listener)
 	}
-	return nil
+	dialect := withDialect(lexer, p.currentStatements())
+
+	stream := antlr.NewCommonTokenStream(dialect, antlr.TokenDefaultChannel)
+
+	parser := qasm_gen.Newqasm3Parser(stream)
+	parser.RemoveErrorListeners()
+	if !opts.ErrorRecovery {
+		parser.AddErrorListener(listener)
+	}
+
+	// The tree is only needed for strict-mode checks
+	parser.BuildParseTrees = opts.StrictMode
+	tree := parser.Program()
+
+	result := &ParseResult{Errors: checkCodePoints(content, opts.StrictMode)}
+	result.Errors = append(result.Errors, listener.GetErrors()...)
+	result.Errors = append(result.Errors, dialectDiagnostics(dialect)...)
+	if opts.StrictMode {
+		result.Errors = append(result.Errors, p.checkStrictness(tree, opts)...)
+	}
+	attachSource(result.Errors, input)
+	// Suppressions only matter for diagnostics, and scanning the token
+	// stream for them costs as much as the rest of validation, so it is
+	// skipped unless the source has a directive to find
+	if len(result.Errors) > 0 && strings.Contains(content, suppressDirective) {
+		result.Suppressions = collectSuppressions(allTokens(stream))
+		result.suppress()
+	}
+	result.finish(opts)
+
+	return result.Err()
 }
 
 // ParseWithErrors returns partial results even with errors
 func (p *Parser) ParseWithErrors(content string) *ParseResult {
 	// Preprocess content to handle common issues
 	content = p.preprocessContent(content)
+	opts := p.currentOptions()
+	result, _ := p.parse(context.Background(), newCharStream(content), opts, checkCodePoints(content, opts.StrictMode))
+	return result
+}
 
-	// Create input stream
-	input := antlr.NewInputStream(content)
+// ParseBytesWithErrors is like ParseWithErrors but reads from a byte slice
+func (p *Parser) ParseBytesWithErrors(content []byte) *ParseResult {
+	result, _ := p.parseBytes(context.Background(), content)
+	return result
+}
+
+// parseBytes preprocesses and parses content, stopping when ctx is done
+func (p *Parser) parseBytes(ctx context.Context, content []byte) (*ParseResult, error) {
+	content = p.preprocessBytes(content)
+	opts := p.currentOptions()
+	return p.parse(ctx, newCharStream(content), opts, checkCodePoints(content, opts.StrictMode))
+}
+
+// parse runs the lexer and parser over input and builds the result,
+// merging in diagnostics already found while preprocessing. It returns an
+// error only if ctx ends before parsing completes.
+func (p *Parser) parse(ctx context.Context, input antlr.CharStream, opts *ParseOptions, diagnostics []ParseError) (result *ParseResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			aborted, ok := r.(parseAborted)
+			if !ok {
+				panic(r)
+			}
+			result, err = nil, aborted.err
+		}
+	}()
 
 	// Create lexer (this will be replaced with generated code)
 	lexer := p.createLexer(input)
@@ -120,12 +280,13 @@ func (p *Parser) ParseWithErrors(content string) *ParseResult {
 	// Create error listener for lexer
 	lexerErrors := NewErrorListener()
 	lexer.RemoveErrorListeners()
-	if !p.options.ErrorRecovery {
+	if !opts.ErrorRecovery {
 		lexer.AddErrorListener(lexerErrors)
 	}
 
-	// Create token stream
-	stream := antlr.NewCommonTokenStream(lexer, antlr.TokenDefaultChannel)
+	// Create token stream, handing custom statements to their parsers
+	dialect := withDialect(withContext(ctx, lexer), p.currentStatements())
+	stream := antlr.NewCommonTokenStream(dialect, antlr.TokenDefaultChannel)
 
 	// Create parser (this will be replaced with generated code)
 	parser := p.createParser(stream)
@@ -133,34 +294,92 @@ func (p *Parser) ParseWithErrors(content string) *ParseResult {
 	// Create error listener for parser
 	parserErrors := NewErrorListener()
 	parser.RemoveErrorListeners()
-	if !p.options.ErrorRecovery {
+	if !opts.ErrorRecovery {
 		parser.AddErrorListener(parserErrors)
 	}
 
 	// Parse the program
 	tree := p.parseProgram(parser)
+	checkContext(ctx)
 
 	// Collect all errors
 	allErrors := make([]ParseError, 0)
+	allErrors = append(allErrors, diagnostics...)
 	allErrors = append(allErrors, lexerErrors.GetErrors()...)
 	allErrors = append(allErrors, parserErrors.GetErrors()...)
-
-	// Limit errors if specified
-	if p.options.MaxErrors > 0 && len(allErrors) > p.options.MaxErrors {
-		allErrors = allErrors[:p.options.MaxErrors]
-	}
+	allErrors = append(allErrors, p.checkStrictness(tree, opts)...)
 
 	// Convert parse tree to AST
-	program := p.convertToAST(tree, content)
+	program := p.convertToAST(ctx, tree)
+	if programCtx, ok := tree.(*qasm_gen.ProgramContext); ok {
+		run, diags := readRunConfig(programCtx)
+		program.Run = run
+		allErrors = append(allErrors, diags...)
+	}
+	checkContext(ctx)
+	tokens := allTokens(stream)
+	allErrors = append(allErrors, dialectDiagnostics(dialect)...)
+	if opts.IncludeComments {
+		program.Comments = extractComments(tokens)
+	}
 
-	return &ParseResult{
+	result = &ParseResult{
 		Program: program,
 		Errors:  allErrors,
+		tokens:  tokens,
+		input:   input,
 	}
+
+	attachSource(result.Errors, input)
+	result.Suppressions = collectSuppressions(tokens)
+	result.suppress()
+	result.finish(opts)
+
+	return result, nil
+}
+
+// checkStrictness reports constructs that the grammar accepts but that are
+// not idiomatic OpenQASM 3.0. They are warnings unless StrictMode is set.
+func (p *Parser) checkStrictness(tree antlr.Tree, opts *ParseOptions) []ParseError {
+	var diagnostics []ParseError
+
+	var walk func(node antlr.Tree)
+	walk = func(node antlr.Tree) {
+		if node == nil {
+			return
+		}
+		if decl, ok := node.(*qasm_gen.OldStyleDeclarationStatementContext); ok {
+			keyword := decl.GetStart()
+			diag := NewDiagnostic("syntax", message.OldStyleDeclaration,
+				map[string]string{"keyword": keyword.GetText(), "replacement": modernDeclarationKeyword(keyword.GetText())},
+				Position{Line: keyword.GetLine(), Column: keyword.GetColumn(), Offset: keyword.GetStart()})
+			if !opts.StrictMode {
+				diag.Severity = SeverityWarning
+			}
+			diagnostics = append(diagnostics, diag)
+		}
+		for i := 0; i < node.GetChildCount(); i++ {
+			walk(node.GetChild(i))
+		}
+	}
+	walk(tree)
+
+	return diagnostics
+}
+
+// modernDeclarationKeyword maps OpenQASM 2.0 register keywords to 3.0 types
+func modernDeclarationKeyword(keyword string) string {
+	if keyword == "qreg" {
+		return "qubit"
+	}
+	return "bit"
 }
 
 // preprocessContent handles common formatting issues
 func (p *Parser) preprocessContent(content string) string {
+	// Strip a leading byte order mark
+	content = strings.TrimPrefix(content, byteOrderMark)
+
 	// Normalize line endings
 	content = strings.ReplaceAll(content, "\r\n", "\n")
 	content = strings.ReplaceAll(content, "\r", "\n")
@@ -173,6 +392,24 @@ func (p *Parser) preprocessContent(content string) string {
 	return content
 }
 
+// preprocessBytes applies the same normalization as preprocessContent,
+// copying only when the content actually needs to change
+func (p *Parser) preprocessBytes(content []byte) []byte {
+	content = bytes.TrimPrefix(content, []byte(byteOrderMark))
+
+	if bytes.IndexByte(content, '\r') >= 0 {
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+		content = bytes.ReplaceAll(content, []byte("\r"), []byte("\n"))
+	}
+
+	if !bytes.HasSuffix(content, []byte("\n")) {
+		// Clip capacity so append never writes into the caller's buffer
+		content = append(content[:len(content):len(content)], '\n')
+	}
+
+	return content
+}
+
 // createLexer creates the ANTLR lexer
 // This is a placeholder - will be replaced with generated lexer
 func (p *Parser) createLexer(input antlr.CharStream) antlr.Lexer {
@@ -206,68 +443,37 @@ func (p *Parser) parseProgram(parser antlr.Parser) antlr.Tree {
 }
 
 // convertToAST converts ANTLR parse tree to our AST
-func (p *Parser) convertToAST(tree antlr.Tree, content string) *Program {
-	program := &Program{
+func (p *Parser) convertToAST(ctx context.Context, tree antlr.Tree) *Program {
+	if program, ok := tree.(*qasm_gen.ProgramContext); ok {
+		return buildProgram(ctx, program)
+	}
+	return &Program{
 		BaseNode: BaseNode{
 			Position: Position{Line: 1, Column: 1},
 		},
 		Statements: make([]Statement, 0),
 		Comments:   make([]Comment, 0),
 	}
-
-	if tree == nil {
-		return program
-	}
-
-	// Basic parsing of tree structure - would be expanded with full AST builder
-	if parseTree, ok := tree.(antlr.ParseTree); ok {
-		// Extract version if present
-		program.Version = p.extractVersion(parseTree)
-
-		// Extract statements - for now just count children as a basic test
-		childCount := parseTree.GetChildCount()
-		for i := 0; i < childCount; i++ {
-			// This is a simplified example - would need full visitor implementation
-			// for complete statement parsing
-		}
-	}
-
-	return program
-}
-
-// extractVersion extracts version information from parse tree
-func (p *Parser) extractVersion(tree antlr.ParseTree) *Version {
-	// Look for version declaration in the parse tree
-	// This is a simplified implementation
-	if tree.GetText() != "" && strings.Contains(tree.GetText(), "3.0") {
-		return &Version{
-			BaseNode: BaseNode{Position: Position{Line: 1, Column: 1}},
-			Number:   "3.0",
-		}
-	}
-
-	// Recursively check children
-	for i := 0; i < tree.GetChildCount(); i++ {
-		if child := tree.GetChild(i); child != nil {
-			if parseTree, ok := child.(antlr.ParseTree); ok {
-				if version := p.extractVersion(parseTree); version != nil {
-					return version
-				}
-			}
-		}
-	}
-
-	return nil
 }
 
 // GetOptions returns the current parser options
 func (p *Parser) GetOptions() *ParseOptions {
-	return p.options
+	return p.currentOptions()
 }
 
-// SetOptions updates the parser options
+// SetOptions updates the parser options for subsequent parse calls
 func (p *Parser) SetOptions(opts *ParseOptions) {
 	if opts != nil {
+		p.mu.Lock()
 		p.options = opts
+		p.mu.Unlock()
 	}
 }
+
+// currentOptions returns the options a parse call should use for its
+// whole duration
+func (p *Parser) currentOptions() *ParseOptions {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.options
+}
@@ -1,8 +1,20 @@
 package parser
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/antlr4-go/antlr/v4"
+	"github.com/orangekame3/qasmparser/message"
 )
 
 func TestNewParser(t *testing.T) {
@@ -80,6 +92,11 @@ func TestPreprocessContent(t *testing.T) {
 			input:    "line1\nline2\n",
 			expected: "line1\nline2\n",
 		},
+		{
+			name:     "strip byte order mark",
+			input:    "\uFEFFline1\n",
+			expected: "line1\n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -179,6 +196,108 @@ func TestErrorListener(t *testing.T) {
 	}
 }
 
+func TestErrorSourceLine(t *testing.T) {
+	p := NewParser()
+	p.SetOptions(&ParseOptions{ErrorRecovery: false})
+	result := p.ParseWithErrors("OPENQASM 3.0;\r\nqubit q;\r\nh q ]] ;\r\n")
+	if len(result.Errors) == 0 {
+		t.Fatal("expected syntax errors")
+	}
+	err := result.Errors[0]
+	if err.SourceLine != "h q ]] ;" {
+		t.Errorf("SourceLine = %q", err.SourceLine)
+	}
+	if err.Span != (Span{Start: 4, End: 5}) {
+		t.Errorf("Span = %+v, want 4-5", err.Span)
+	}
+
+	// Diagnostics found outside the parser get a one-column span
+	result = p.ParseWithErrors("OPENQASM 3.0;\nqubit\x01 q;\n")
+	err = result.Errors[0]
+	if err.SourceLine != "qubit\x01 q;" || err.Span != (Span{Start: 5, End: 6}) {
+		t.Errorf("got line %q span %+v", err.SourceLine, err.Span)
+	}
+
+	// Fragments carry their source line too
+	_, fragErr := ParseStatement("h q[0;")
+	var errs ParseErrors
+	if !errors.As(fragErr, &errs) || errs[0].SourceLine != "h q[0;" {
+		t.Errorf("ParseStatement error = %#v", fragErr)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	p := NewParser()
+	p.SetOptions(&ParseOptions{ErrorRecovery: false})
+	result := p.ParseWithErrors("OPENQASM 3.0;\nqreg q[1];\nqubit r\n")
+	codes := make(map[string]bool)
+	for _, err := range result.Errors {
+		if err.Code == "" {
+			t.Errorf("diagnostic without code: %v", err)
+		}
+		codes[err.Code] = true
+	}
+	if !codes[message.OldStyleDeclaration] || !codes[message.MissingSemicolon] {
+		t.Fatalf("codes = %v", codes)
+	}
+
+	localized := Localize(result.Errors, message.Japanese)
+	for i, err := range localized {
+		if err.Code != result.Errors[i].Code || err.Position != result.Errors[i].Position {
+			t.Errorf("Localize changed more than the message: %v", err)
+		}
+	}
+	found := false
+	for _, err := range localized {
+		if err.Code == message.OldStyleDeclaration {
+			found = true
+			if want := "'qreg' は OpenQASM 2.0 の構文です。代わりに 'qubit' を使ってください"; err.Message != want {
+				t.Errorf("Message = %q, want %q", err.Message, want)
+			}
+		}
+	}
+	if !found {
+		t.Error("old-style declaration warning missing")
+	}
+
+	// Messages without a code are kept
+	plain := []ParseError{NewSyntaxError("custom", Position{})}
+	if got := Localize(plain, message.Japanese); got[0].Message != "custom" {
+		t.Errorf("Message = %q", got[0].Message)
+	}
+}
+
+func TestSyntaxErrorExplanations(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		code   string
+		line   int
+		column int
+	}{
+		{"missing semicolon", "OPENQASM 3.0;\nqubit q\nh q;\n", message.MissingSemicolon, 2, 7},
+		{"measure with '='", "OPENQASM 3.0;\nqubit q;\nbit c;\nmeasure q = c;\n", message.MeasurementSyntax, 4, 10},
+		{"arrow before measure", "OPENQASM 3.0;\nqubit q;\nbit c;\nc -> measure q;\n", message.MeasurementSyntax, 4, 2},
+		{"qreg", "OPENQASM 3.0;\nqreg q[1];\n", message.OldStyleDeclaration, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParserWithOptions(&ParseOptions{ErrorRecovery: false})
+			result := p.ParseWithErrors(tt.source)
+			if len(result.Errors) == 0 {
+				t.Fatal("expected a diagnostic")
+			}
+			err := result.Errors[0]
+			if err.Code != tt.code || err.Position.Line != tt.line || err.Position.Column != tt.column {
+				t.Errorf("got %s at %d:%d: %s", err.Code, err.Position.Line, err.Position.Column, err.Message)
+			}
+			if err.Explanation == "" {
+				t.Errorf("%s has no explanation", err.Code)
+			}
+		})
+	}
+}
+
 func TestASTNodes(t *testing.T) {
 	// Test Position
 	pos := Position{Line: 1, Column: 5, Offset: 10}
@@ -312,3 +431,1586 @@ func TestMockVisitor(t *testing.T) {
 		t.Error("Visitor didn't visit QuantumDeclaration node correctly")
 	}
 }
+
+func TestParseResultSort(t *testing.T) {
+	result := &ParseResult{
+		Errors: []ParseError{
+			{Message: "b", Type: "syntax", Position: Position{Line: 3, Column: 1}},
+			{Message: "a", Type: "syntax", Position: Position{Line: 1, Column: 7}},
+			{Message: "dup", Type: "syntax", Position: Position{Line: 1, Column: 2}},
+			{Message: "dup", Type: "syntax", Position: Position{Line: 1, Column: 2}},
+			{Message: "c", Type: "syntax", Position: Position{Line: 1, Column: 1}, File: "z.qasm"},
+			{Message: "d", Type: "lexer", Position: Position{Line: 1, Column: 7}, Code: "QASM0001"},
+		},
+	}
+
+	result.Sort()
+
+	expected := []string{"dup", "a", "d", "b", "c"}
+	if len(result.Errors) != len(expected) {
+		t.Fatalf("Expected %d errors after de-duplication, got %d", len(expected), len(result.Errors))
+	}
+	for i, msg := range expected {
+		if result.Errors[i].Message != msg {
+			t.Errorf("Error %d: expected %q, got %q", i, msg, result.Errors[i].Message)
+		}
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	warning := NewWarning("syntax", "deprecated syntax", Position{Line: 2, Column: 0})
+	if warning.IsError() {
+		t.Error("Warning should not be an error")
+	}
+	if warning.Error() != "syntax warning at line 2, column 0: deprecated syntax" {
+		t.Errorf("Unexpected warning text: %q", warning.Error())
+	}
+
+	result := &ParseResult{Errors: []ParseError{warning}}
+	if result.HasErrors() {
+		t.Error("Warnings alone should not count as errors")
+	}
+	if !result.HasSeverity(SeverityWarning) {
+		t.Error("Expected HasSeverity(warning) to be true")
+	}
+	if len(result.Warnings()) != 1 {
+		t.Errorf("Expected 1 warning, got %d", len(result.Warnings()))
+	}
+	if result.FirstError() != nil {
+		t.Error("Expected no first error")
+	}
+
+	// Diagnostics without a severity are errors for backward compatibility
+	legacy := ParseError{Message: "legacy", Type: "syntax"}
+	if !legacy.IsError() {
+		t.Error("Empty severity should be treated as an error")
+	}
+
+	if sev, err := ParseSeverity("Warning"); err != nil || sev != SeverityWarning {
+		t.Errorf("ParseSeverity returned %q, %v", sev, err)
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Error("Expected error for unknown severity")
+	}
+}
+
+func TestStrictnessWarnings(t *testing.T) {
+	content := "OPENQASM 3.0;\nqreg q[2];\n"
+
+	result := NewParser().ParseWithErrors(content)
+	if result.HasErrors() {
+		t.Fatalf("Unexpected errors: %s", result.String())
+	}
+	warnings := result.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %d", len(warnings))
+	}
+	if warnings[0].Position.Line != 2 {
+		t.Errorf("Expected warning on line 2, got %d", warnings[0].Position.Line)
+	}
+
+	strict := NewParserWithOptions(&ParseOptions{StrictMode: true, ErrorRecovery: true})
+	if err := strict.Validate(content); err == nil {
+		t.Error("Expected strict mode to reject old-style declarations")
+	}
+}
+
+func TestPreprocessBytes(t *testing.T) {
+	parser := NewParser()
+
+	input := []byte("line1\r\nline2")
+	result := parser.preprocessBytes(input)
+	if string(result) != "line1\nline2\n" {
+		t.Errorf("Expected normalized content, got %q", result)
+	}
+	if string(input) != "line1\r\nline2" {
+		t.Error("preprocessBytes must not modify its input")
+	}
+
+	clean := []byte("line1\n")
+	if result := parser.preprocessBytes(clean); &result[0] != &clean[0] {
+		t.Error("Expected already-normalized content to be returned without copying")
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	parser := NewParser()
+
+	for _, content := range []string{
+		"OPENQASM 3.0;\nqubit q;\nh q;",
+		"OPENQASM 3.0;\n// Ünïcode comment\nqubit q;\n",
+	} {
+		fromBytes := parser.ParseBytesWithErrors([]byte(content))
+		fromString := parser.ParseWithErrors(content)
+
+		if fromBytes.HasErrors() != fromString.HasErrors() {
+			t.Errorf("ParseBytes and ParseString disagree on errors for %q", content)
+		}
+		if (fromBytes.Program.Version == nil) != (fromString.Program.Version == nil) {
+			t.Errorf("ParseBytes and ParseString disagree on version for %q", content)
+		}
+	}
+}
+
+func TestASCIIStream(t *testing.T) {
+	stream := newCharStream("abc")
+	if _, ok := stream.(*asciiStream[string]); !ok {
+		t.Fatalf("Expected ASCII input to use asciiStream, got %T", stream)
+	}
+	if stream.LA(1) != 'a' || stream.Size() != 3 {
+		t.Error("Unexpected stream contents")
+	}
+	stream.Consume()
+	if stream.LA(1) != 'b' || stream.LA(-1) != 'a' {
+		t.Error("Unexpected lookahead after Consume")
+	}
+	if stream.GetText(1, 5) != "bc" {
+		t.Errorf("Unexpected text %q", stream.GetText(1, 5))
+	}
+
+	if _, ok := newCharStream([]byte("qubit ü;")).(*antlr.InputStream); !ok {
+		t.Error("Expected non-ASCII input to fall back to antlr.InputStream")
+	}
+}
+
+func TestValidateFastPath(t *testing.T) {
+	parser := NewParserWithOptions(&ParseOptions{ErrorRecovery: false})
+
+	if err := parser.Validate("OPENQASM 3.0;\nqubit q;\nh q;\n"); err != nil {
+		t.Errorf("Expected valid program, got %v", err)
+	}
+
+	invalid := "OPENQASM 3.0;\nqubit q\nh q;\n"
+	err := parser.Validate(invalid)
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+
+	// Validate must agree with the full parse on the first error
+	full := parser.ParseWithErrors(invalid)
+	if full.FirstError() == nil || full.FirstError().Error() != err.Error() {
+		t.Errorf("Validate returned %q, full parse returned %v", err, full.FirstError())
+	}
+}
+
+// TestValidateAllocations guards the syntax-only pass BenchmarkValidate
+// measures: Validate builds no tree, AST or token list, and must stay
+// well below a full parse
+func TestValidateAllocations(t *testing.T) {
+	parser := NewParser()
+	content := strings.Repeat("qubit[2] q;\nh q[0];\ncx q[0], q[1];\n", 200)
+	validate := testing.AllocsPerRun(5, func() { _ = parser.Validate(content) })
+	parse := testing.AllocsPerRun(5, func() { _ = parser.ParseWithErrors(content) })
+	if validate > parse/2 {
+		t.Errorf("Validate made %.0f allocations, more than half of the %.0f of a full parse", validate, parse)
+	}
+}
+
+func BenchmarkValidate(b *testing.B) {
+	parser := NewParser()
+	content := strings.Repeat("qubit[2] q;\nh q[0];\ncx q[0], q[1];\n", 200)
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = parser.Validate(content)
+	}
+}
+
+func BenchmarkParseWithErrors(b *testing.B) {
+	parser := NewParser()
+	content := strings.Repeat("qubit[2] q;\nh q[0];\ncx q[0], q[1];\n", 200)
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = parser.ParseWithErrors(content)
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	program := &Program{
+		BaseNode: BaseNode{Position: Position{Line: 1, Column: 1}},
+		Version:  &Version{Number: "3.0"},
+		Comments: []Comment{{Text: "// note", Type: "line"}},
+	}
+	for i := 0; i < 600; i++ {
+		program.Statements = append(program.Statements, &GateCall{
+			Name:   "h",
+			Qubits: []Expression{&IndexedIdentifier{Name: "q", Index: &IntegerLiteral{Value: int64(i)}}},
+		})
+	}
+	run, err := NewParser().ParseString("OPENQASM 3.0;\npragma shots 100\npragma seed 7\nqubit q;\n")
+	if err != nil || run.Run == nil {
+		t.Fatalf("run program = %+v, %v", run, err)
+	}
+
+	for _, p := range []*Program{program, run} {
+		for _, indent := range []string{"", "  "} {
+			var expected []byte
+			var err error
+			if indent == "" {
+				expected, err = json.Marshal(p)
+			} else {
+				expected, err = json.MarshalIndent(p, "", indent)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			encoder := NewJSONEncoder(&buf)
+			encoder.SetIndent(indent)
+			encoder.SetWorkers(4)
+			if err := encoder.Encode(p); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != string(expected) {
+				t.Errorf("Streaming output differs from json.Marshal with indent %q:\n%s\nwant\n%s", indent, buf.String(), expected)
+			}
+		}
+	}
+
+	// Empty and nil statement lists
+	for _, p := range []*Program{{Statements: []Statement{}}, {}} {
+		expected, _ := json.MarshalIndent(p, "", "\t")
+		var buf bytes.Buffer
+		encoder := NewJSONEncoder(&buf)
+		encoder.SetIndent("\t")
+		if err := encoder.Encode(p); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != string(expected) {
+			t.Errorf("Expected %s, got %s", expected, buf.String())
+		}
+	}
+}
+
+func TestParserConcurrentUse(t *testing.T) {
+	parser := NewParserWithOptions(&ParseOptions{ErrorRecovery: false})
+	valid := "OPENQASM 3.0;\nqubit[2] q;\nh q[0];\ncx q[0], q[1];\n"
+	invalid := "OPENQASM 3.0;\nqubit q\nh q;\n"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if result := parser.ParseWithErrors(valid); result.HasErrors() {
+					t.Errorf("Unexpected errors: %s", result.String())
+				}
+				if err := parser.Validate(invalid); err == nil {
+					t.Error("Expected validation error")
+				}
+				if i == 0 {
+					parser.SetOptions(&ParseOptions{ErrorRecovery: false, MaxErrors: j + 1})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestTrivia(t *testing.T) {
+	content := "OPENQASM 3.0; // version\n\n/* block\n comment */\nqubit q;  \n"
+	result := NewParserWithOptions(&ParseOptions{IncludeComments: false, ErrorRecovery: true}).ParseWithErrors(content)
+
+	if len(result.Program.Comments) != 0 {
+		t.Errorf("Expected no AST comments with IncludeComments off, got %d", len(result.Program.Comments))
+	}
+
+	trivia := result.Trivia()
+	var rebuilt strings.Builder
+	kinds := make([]TriviaKind, 0, len(trivia))
+	for _, tr := range trivia {
+		kinds = append(kinds, tr.Kind)
+		rebuilt.WriteString(tr.Text)
+	}
+
+	expected := []TriviaKind{
+		TriviaWhitespace, TriviaWhitespace, TriviaLineComment, TriviaNewline, TriviaBlockComment,
+		TriviaNewline, TriviaWhitespace, TriviaWhitespace, TriviaNewline,
+	}
+	if len(kinds) != len(expected) {
+		t.Fatalf("Expected trivia %v, got %v", expected, kinds)
+	}
+	for i := range expected {
+		if kinds[i] != expected[i] {
+			t.Errorf("Trivia %d: expected %s, got %s", i, expected[i], kinds[i])
+		}
+	}
+	if rebuilt.String() != "  // version\n\n/* block\n comment */\n   \n" {
+		t.Errorf("Unexpected trivia text %q", rebuilt.String())
+	}
+
+	block := trivia[4]
+	if block.Position.Line != 3 || block.Position.Column != 1 || block.EndPos.Line != 4 || block.EndPos.Column != 12 {
+		t.Errorf("Unexpected block comment span %+v - %+v", block.Position, block.EndPos)
+	}
+
+	withComments := NewParser().ParseWithErrors(content)
+	if len(withComments.Program.Comments) != 2 {
+		t.Fatalf("Expected 2 AST comments, got %d", len(withComments.Program.Comments))
+	}
+	if withComments.Program.Comments[1].Type != "block" {
+		t.Errorf("Expected block comment, got %q", withComments.Program.Comments[1].Type)
+	}
+}
+
+func TestCodePointDiagnostics(t *testing.T) {
+	parser := NewParser()
+
+	result := parser.ParseBytesWithErrors([]byte("OPENQASM 3.0;\nqubit q;\xff\nh\x00 q;\n"))
+	if len(result.Errors) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %s", len(result.Errors), result.String())
+	}
+	if result.Errors[0].Message != "invalid UTF-8 byte 0xFF" || result.Errors[0].Position.Line != 2 || result.Errors[0].Position.Column != 8 {
+		t.Errorf("Unexpected diagnostic %+v", result.Errors[0])
+	}
+	if result.Errors[1].Message != "invalid control character U+0000" || result.Errors[1].Position.Line != 3 {
+		t.Errorf("Unexpected diagnostic %+v", result.Errors[1])
+	}
+
+	// Invisible characters are warnings, and errors in strict mode
+	hidden := "OPENQASM 3.0;\n// admin\u202E\nqubit q;\n"
+	if result := parser.ParseWithErrors(hidden); result.HasErrors() || len(result.Warnings()) != 1 {
+		t.Errorf("Expected a single warning, got %s", result.String())
+	}
+	strict := NewParserWithOptions(&ParseOptions{StrictMode: true, ErrorRecovery: true})
+	if err := strict.Validate(hidden); err == nil {
+		t.Error("Expected strict mode to reject invisible characters")
+	}
+
+	// Unicode identifiers are accepted
+	if result := parser.ParseWithErrors("OPENQASM 3.0;\nqubit θ;\nqubit 量子;\n"); len(result.Errors) != 0 {
+		t.Errorf("Unexpected diagnostics: %s", result.String())
+	}
+}
+
+func TestIsValidIdentifier(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"q": true, "_q1": true, "θ": true, "量子": true, "ⅷ": true,
+		"": false, "1q": false, "q-1": false, "q\u0301": false,
+	} {
+		if IsValidIdentifier(name) != valid {
+			t.Errorf("IsValidIdentifier(%q) = %v, want %v", name, !valid, valid)
+		}
+	}
+}
+
+func TestUnquoteString(t *testing.T) {
+	tests := map[string]string{
+		`"stdgates.inc"`:  "stdgates.inc",
+		`'stdgates.inc'`:  "stdgates.inc",
+		`"dir\\file.inc"`: `dir\file.inc`,
+		`"say \"hi\""`:    `say "hi"`,
+		`"caf\u00e9.inc"`: "café.inc",
+		`"tab\there"`:     "tab\there",
+	}
+	for literal, expected := range tests {
+		got, err := UnquoteString(literal)
+		if err != nil || got != expected {
+			t.Errorf("UnquoteString(%s) = %q, %v; want %q", literal, got, err, expected)
+		}
+	}
+
+	for _, literal := range []string{`"`, `"unterminated`, `"bad \q"`, "plain"} {
+		if _, err := UnquoteString(literal); err == nil {
+			t.Errorf("Expected error for %s", literal)
+		}
+	}
+}
+
+func TestEncodingDetection(t *testing.T) {
+	source := "OPENQASM 3.0;\n// café\nqubit q;\n"
+
+	utf16le := func(s string, bom bool) []byte {
+		var buf []byte
+		if bom {
+			buf = append(buf, 0xFF, 0xFE)
+		}
+		for _, r := range s {
+			buf = append(buf, byte(r), byte(r>>8))
+		}
+		return buf
+	}
+	utf16be := func(s string) []byte {
+		buf := []byte{0xFE, 0xFF}
+		for _, r := range s {
+			buf = append(buf, byte(r>>8), byte(r))
+		}
+		return buf
+	}
+	latin1 := []byte(strings.ReplaceAll(source, "é", "\xe9"))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		encoding Encoding
+	}{
+		{"utf-8", []byte(source), EncodingUTF8},
+		{"utf-16le with BOM", utf16le(source, true), EncodingUTF16LE},
+		{"utf-16le without BOM", utf16le(source, false), EncodingUTF16LE},
+		{"utf-16be with BOM", utf16be(source), EncodingUTF16BE},
+		{"latin-1", latin1, EncodingLatin1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if enc := DetectEncoding(tt.data); enc != tt.encoding {
+				t.Errorf("Expected %s, got %s", tt.encoding, enc)
+			}
+			decoded, err := decodeSource(tt.data, EncodingAuto)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(decoded) != source {
+				t.Errorf("Expected %q, got %q", source, decoded)
+			}
+
+			parser := NewParser()
+			program, err := parser.ParseReader(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("ParseReader failed: %v", err)
+			}
+			if len(program.Comments) != 1 || program.Comments[0].Text != "// café" {
+				t.Errorf("Unexpected comments %+v", program.Comments)
+			}
+		})
+	}
+
+	// An explicit encoding overrides detection
+	parser := NewParserWithOptions(&ParseOptions{Encoding: EncodingLatin1, IncludeComments: true})
+	program, err := parser.ParseReader(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.Comments[0].Text == "// café" {
+		t.Error("Expected forced Latin-1 decoding to reinterpret UTF-8 bytes")
+	}
+
+	if _, err := decodeSource([]byte{0xFF, 0xFE, 0x41}, EncodingAuto); err == nil {
+		t.Error("Expected error for odd-length UTF-16 input")
+	}
+	if _, err := ParseEncoding("ebcdic"); err == nil {
+		t.Error("Expected error for unsupported encoding")
+	}
+	if enc, err := ParseEncoding("UTF_16LE"); err != nil || enc != EncodingUTF16LE {
+		t.Errorf("ParseEncoding returned %q, %v", enc, err)
+	}
+}
+
+func TestParseErrorsAggregation(t *testing.T) {
+	parser := NewParserWithOptions(&ParseOptions{ErrorRecovery: false})
+	content := "OPENQASM 3.0;\nqubit q\nh q\nx q;\n"
+
+	for name, err := range map[string]error{
+		"ParseString": func() error { _, err := parser.ParseString(content); return err }(),
+		"Validate":    parser.Validate(content),
+	} {
+		var all ParseErrors
+		if !errors.As(err, &all) {
+			t.Fatalf("%s: expected ParseErrors, got %T", name, err)
+		}
+		if len(all) < 2 {
+			t.Errorf("%s: expected every error to be reported, got %d", name, len(all))
+		}
+
+		var first *ParseError
+		if !errors.As(err, &first) {
+			t.Fatalf("%s: expected errors.As to find a *ParseError", name)
+		}
+		if *first != all[0] {
+			t.Errorf("%s: expected errors.As to find the first error, got %v", name, first)
+		}
+		if !strings.Contains(err.Error(), "\n") {
+			t.Errorf("%s: expected one line per error, got %q", name, err.Error())
+		}
+	}
+
+	if _, err := parser.ParseString("OPENQASM 3.0;\nqubit q;\n"); err != nil {
+		t.Errorf("Expected nil error for valid program, got %v", err)
+	}
+}
+
+func TestParseFileWithErrors(t *testing.T) {
+	parser := NewParserWithOptions(&ParseOptions{ErrorRecovery: false})
+
+	missing := parser.ParseFileWithErrors("testdata/does_not_exist.qasm")
+	if !missing.HasErrors() || missing.Errors[0].Type != "io" {
+		t.Fatalf("Expected an io diagnostic, got %+v", missing.Errors)
+	}
+
+	data, err := json.Marshal(missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		File   string `json:"file"`
+		Errors []struct {
+			Type     string `json:"type"`
+			Message  string `json:"message"`
+			Severity string `json:"severity"`
+			File     string `json:"file"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.File != "testdata/does_not_exist.qasm" || len(decoded.Errors) != 1 {
+		t.Fatalf("Unexpected JSON %s", data)
+	}
+	if decoded.Errors[0].Message == "" || decoded.Errors[0].Severity != "error" || decoded.Errors[0].File != decoded.File {
+		t.Errorf("Expected a populated error in JSON, got %s", data)
+	}
+
+	path := t.TempDir() + "/broken.qasm"
+	if err := os.WriteFile(path, []byte("OPENQASM 3.0;\nqubit q\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := parser.ParseFileWithErrors(path)
+	if !broken.HasErrors() || broken.Program == nil {
+		t.Fatal("Expected syntax errors with a partial program")
+	}
+	for _, e := range broken.Errors {
+		if e.File != path {
+			t.Errorf("Expected diagnostic to carry file name, got %q", e.File)
+		}
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := make([]string, 0, 10)
+	for i := 0; i < 10; i++ {
+		path := fmt.Sprintf("%s/f%d.qasm", dir, i)
+		content := "OPENQASM 3.0;\nqubit q;\n"
+		if i%3 == 0 {
+			content = "OPENQASM 3.0;\nqubit q\n"
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	files = append(files, dir+"/missing.qasm")
+
+	var progress []Progress
+	parser := NewParserWithOptions(&ParseOptions{ErrorRecovery: false})
+	results := parser.ParseFiles(context.Background(), files, &BatchOptions{
+		Concurrency: 3,
+		Progress:    func(p Progress) { progress = append(progress, p) },
+	})
+
+	if len(results) != len(files) {
+		t.Fatalf("Expected %d results, got %d", len(files), len(results))
+	}
+	for i, result := range results {
+		if result.File != files[i] {
+			t.Errorf("Result %d is for %s, expected %s", i, result.File, files[i])
+		}
+		wantErr := i%3 == 0 || i == len(files)-1
+		if result.HasErrors() != wantErr {
+			t.Errorf("%s: expected errors=%v, got %s", result.File, wantErr, result.String())
+		}
+	}
+
+	if len(progress) != len(files) {
+		t.Fatalf("Expected %d progress calls, got %d", len(files), len(progress))
+	}
+	for i, p := range progress {
+		if p.Done != i+1 || p.Total != len(files) || p.Result == nil {
+			t.Errorf("Unexpected progress %+v", p)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range parser.ParseFiles(ctx, files[:2], nil) {
+		if !result.HasErrors() || !strings.Contains(result.Errors[0].Message, "canceled") {
+			t.Errorf("Expected cancellation diagnostic, got %s", result.String())
+		}
+	}
+}
+
+func TestParseWithContextDeadline(t *testing.T) {
+	parser := NewParser()
+	content := strings.Repeat("h q;\n", 2000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := parser.ParseWithContext(ctx, content); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A context that ends mid-parse aborts instead of running to completion
+	ctx, cancel = context.WithCancel(context.Background())
+	lexer := withContext(ctx, parser.createLexer(newCharStream(content)))
+	cancel()
+	defer func() {
+		aborted, ok := recover().(parseAborted)
+		if !ok || !errors.Is(aborted.err, context.Canceled) {
+			t.Errorf("Expected parse to abort with context.Canceled, got %v", aborted.err)
+		}
+	}()
+	for {
+		if lexer.NextToken().GetTokenType() == antlr.TokenEOF {
+			t.Fatal("Expected lexer to stop before EOF")
+		}
+	}
+}
+
+func TestParseCanceledAfterTokenization(t *testing.T) {
+	parser := NewParser()
+	content := "OPENQASM 3.0;\n" + strings.Repeat("qubit q;\n", 10)
+
+	// A program too short for the lexer to check the context still stops
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := parser.ParseWithContext(ctx, content); !errors.Is(err, context.Canceled) {
+		t.Errorf("ParseWithContext() = %v, want context.Canceled", err)
+	}
+
+	// The whole program is tokenized and parsed before the context ends,
+	// so only the checks of the later phases can notice
+	input := newCharStream(content)
+	lexer := parser.createLexer(input)
+	stream := antlr.NewCommonTokenStream(lexer, antlr.TokenDefaultChannel)
+	tree := parser.parseProgram(parser.createParser(stream))
+	stream.Fill()
+
+	defer func() {
+		aborted, ok := recover().(parseAborted)
+		if !ok || !errors.Is(aborted.err, context.Canceled) {
+			t.Errorf("Expected building the AST to abort with context.Canceled, got %v", aborted.err)
+		}
+	}()
+	parser.convertToAST(ctx, tree)
+	t.Fatal("Expected building the AST to stop")
+}
+
+func TestParseFilesBudgets(t *testing.T) {
+	dir := t.TempDir()
+	big := dir + "/big.qasm"
+	small := dir + "/small.qasm"
+	if err := os.WriteFile(big, []byte("OPENQASM 3.0;\n"+strings.Repeat("h q;\n", 2000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(small, []byte("OPENQASM 3.0;\nqubit q;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parser := NewParser()
+	results := parser.ParseFiles(context.Background(), []string{big, small}, &BatchOptions{MaxFileSize: 1024})
+	if !results[0].HasErrors() || results[0].Errors[0].Type != "limit" {
+		t.Errorf("Expected size limit diagnostic, got %s", results[0].String())
+	}
+	if results[1].HasErrors() {
+		t.Errorf("Unexpected errors for small file: %s", results[1].String())
+	}
+
+	results = parser.ParseFiles(context.Background(), []string{big}, &BatchOptions{Timeout: time.Nanosecond})
+	if !results[0].HasErrors() || results[0].Errors[0].Type != "limit" {
+		t.Errorf("Expected timeout diagnostic, got %s", results[0].String())
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	sources := []Source{
+		{Name: "good.qasm", Content: []byte("OPENQASM 3.0;\nqubit q;\n")},
+		{Name: "bad.qasm", Content: []byte("OPENQASM 3.0;\nqubit q\n")},
+		{Name: "big.qasm", Content: []byte("OPENQASM 3.0;\n" + strings.Repeat("h q;\n", 500))},
+	}
+	parser := NewParserWithOptions(&ParseOptions{ErrorRecovery: false})
+	results := parser.ParseSources(context.Background(), sources, &BatchOptions{Concurrency: 2, MaxFileSize: 1024})
+
+	if len(results) != len(sources) {
+		t.Fatalf("Expected %d results, got %d", len(sources), len(results))
+	}
+	if results[0].File != "good.qasm" || results[0].HasErrors() {
+		t.Errorf("Unexpected result for good.qasm: %s", results[0].String())
+	}
+	if !results[1].HasErrors() || results[1].Errors[0].File != "bad.qasm" {
+		t.Errorf("Expected syntax error naming bad.qasm, got %s", results[1].String())
+	}
+	if !results[2].HasErrors() || results[2].Errors[0].Type != "limit" {
+		t.Errorf("Expected size limit diagnostic, got %s", results[2].String())
+	}
+}
+
+func TestAggregateSources(t *testing.T) {
+	sources := make([]Source, 0, 20)
+	for i := 0; i < 20; i++ {
+		content := "OPENQASM 3.0;\nqubit q;\nh q;\n"
+		if i%4 == 1 {
+			content = "OPENQASM 3.0;\nqubit q\n"
+		}
+		sources = append(sources, Source{Name: fmt.Sprintf("f%02d.qasm", i), Content: []byte(content)})
+	}
+	parser := NewParserWithOptions(&ParseOptions{ErrorRecovery: false})
+	var progress int
+	result := parser.AggregateSources(context.Background(), sources, &BatchOptions{
+		Concurrency: 4,
+		Progress:    func(Progress) { progress++ },
+	}, &AggregateOptions{MaxDiagnostics: 3})
+
+	if progress != len(sources) {
+		t.Errorf("Expected %d progress calls, got %d", len(sources), progress)
+	}
+	if result.Stats.Files != 20 || result.Stats.Failed != 5 || !result.HasErrors() {
+		t.Errorf("Unexpected stats %+v", result.Stats)
+	}
+	// Files with errors count the statements parsed before the error
+	if result.Stats.Statements != 15*2+5 {
+		t.Errorf("Expected 35 statements, got %d", result.Stats.Statements)
+	}
+	errors := result.Stats.Severities[SeverityError]
+	if errors < 5 || result.Stats.Types["syntax"] != errors {
+		t.Errorf("Expected syntax errors only, got %v and %v", result.Stats.Severities, result.Stats.Types)
+	}
+	for i, f := range result.Files {
+		if f.File != sources[i].Name || (f.Errors > 0) != (i%4 == 1) || f.Program != nil {
+			t.Errorf("Unexpected summary %d: %+v", i, f)
+		}
+	}
+
+	// The kept diagnostics are the first in file order, whatever order
+	// the workers finished in
+	if len(result.Diagnostics) != 3 || result.Dropped != errors-3 {
+		t.Fatalf("Expected 3 diagnostics and %d dropped, got %d and %d", errors-3, len(result.Diagnostics), result.Dropped)
+	}
+	if result.Diagnostics[0].File != "f01.qasm" || result.Diagnostics[2].File != "f09.qasm" {
+		t.Errorf("Unexpected diagnostics %v", result.Diagnostics)
+	}
+
+	kept := parser.AggregateSources(context.Background(), sources[:1], nil, &AggregateOptions{KeepPrograms: true})
+	if kept.Files[0].Program == nil {
+		t.Error("Expected the program to be kept")
+	}
+}
+
+func TestAggregateFailFast(t *testing.T) {
+	sources := []Source{
+		{Name: "a.qasm", Content: []byte("OPENQASM 3.0;\nqubit q;\n")},
+		{Name: "b.qasm", Content: []byte("OPENQASM 3.0;\nqubit q\n")},
+		{Name: "c.qasm", Content: []byte("OPENQASM 3.0;\nqubit q\n")},
+		{Name: "d.qasm", Content: []byte("OPENQASM 3.0;\nqubit q;\n")},
+	}
+	parser := NewParserWithOptions(&ParseOptions{ErrorRecovery: false})
+
+	result := parser.AggregateSources(context.Background(), sources, &BatchOptions{Concurrency: 1}, nil)
+	if got := result.Summary(); got != "4 files: 2 ok, 2 failed, 0 skipped; 2 errors, 0 warnings" {
+		t.Errorf("Unexpected keep-going summary %q", got)
+	}
+
+	result = parser.AggregateSources(context.Background(), sources, &BatchOptions{Concurrency: 1, FailFast: true}, nil)
+	if got := result.Summary(); got != "4 files: 1 ok, 1 failed, 2 skipped; 1 error, 0 warnings" {
+		t.Errorf("Unexpected fail-fast summary %q", got)
+	}
+	if !result.Files[2].Skipped || !result.Files[3].Skipped || result.ExitCode() != 1 {
+		t.Errorf("Unexpected fail-fast result %+v", result.Files)
+	}
+
+	results := parser.ParseSources(context.Background(), sources, &BatchOptions{Concurrency: 1, FailFast: true})
+	if !results[3].Skipped || results[3].Program != nil || results[3].HasErrors() {
+		t.Errorf("Expected d.qasm to be skipped, got %+v", results[3])
+	}
+	if clean := parser.AggregateSources(context.Background(), sources[:1], nil, nil); clean.ExitCode() != 0 {
+		t.Errorf("Expected exit code 0, got %d", clean.ExitCode())
+	}
+}
+
+func TestAggregatorOrder(t *testing.T) {
+	results := []*ParseFileResult{
+		{File: "a", ParseResult: ParseResult{Errors: []ParseError{{Message: "first", Type: "syntax"}}}},
+		{File: "b", ParseResult: ParseResult{Errors: []ParseError{{Message: "second", Type: "semantic", Severity: SeverityWarning, Code: "W1"}}}},
+		{File: "c", ParseResult: ParseResult{Errors: []ParseError{{Message: "third", Type: "io"}}}},
+	}
+	a := NewAggregator(len(results), nil)
+	for _, i := range []int{2, 0, 1} {
+		a.Add(Progress{Index: i, File: results[i].File, Result: results[i]})
+	}
+	result := a.Result()
+	var messages []string
+	for _, d := range result.Diagnostics {
+		messages = append(messages, d.File+":"+d.Message)
+	}
+	if got := strings.Join(messages, " "); got != "a:first b:second c:third" {
+		t.Errorf("Diagnostics in order %s", got)
+	}
+	if result.Stats.Failed != 2 || result.Files[1].Warnings != 1 || result.Stats.Codes["W1"] != 1 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	// Files that never arrive leave a gap rather than holding back the rest,
+	// and results held back meanwhile do not keep their ASTs
+	a = NewAggregator(3, nil)
+	held := *results[2]
+	held.Program = &Program{Statements: []Statement{&BadStatement{}}}
+	a.Add(Progress{Index: 2, File: "c", Result: &held})
+	if p := a.pending[2]; p.summary.Program != nil || p.statements != 1 {
+		t.Errorf("held result %+v, want a summary without the program", p)
+	}
+	result = a.Result()
+	if result.Files[0].File != "" || result.Files[2].Errors != 1 || len(result.Diagnostics) != 1 {
+		t.Errorf("Unexpected result with a missing file %+v", result)
+	}
+}
+
+func TestBuildProgram(t *testing.T) {
+	source := `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+const int n = 0x1F;
+gate rz2(theta) a, b { rz(theta/2) a; ctrl @ x a, b; }
+def f(qubit r, angle[32] t) -> bit { return measure r; }
+for uint i in [0:2:10] { h q[i]; }
+if (c[0] == 1) x q[0]; else { y q[0:1]; }
+c[0] = measure q[0];
+barrier q[0], q;
+barrier;
+reset q[1];
+`
+	result := NewParser().ParseWithErrors(source)
+	if result.HasErrors() {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	program := result.Program
+
+	if program.Version == nil || program.Version.Number != "3.0" {
+		t.Fatalf("Unexpected version: %+v", program.Version)
+	}
+	expected := []string{
+		"Include: stdgates.inc",
+		"QuantumDeclaration: q",
+		"ClassicalDeclaration: n",
+		"GateDefinition: rz2",
+		"SubroutineDefinition: f",
+		"ForStatement",
+		"IfStatement",
+		"Measurement",
+		"Barrier",
+		"Barrier",
+		"Reset",
+	}
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("Expected %d statements, got %d", len(expected), len(program.Statements))
+	}
+	for i, stmt := range program.Statements {
+		if stmt.String() != expected[i] {
+			t.Errorf("Statement %d: expected %q, got %q", i, expected[i], stmt.String())
+		}
+	}
+
+	decl := program.Statements[2].(*ClassicalDeclaration)
+	if !decl.Const || decl.Initializer.(*IntegerLiteral).Value != 31 {
+		t.Errorf("Unexpected const declaration: %+v", decl)
+	}
+
+	gate := program.Statements[3].(*GateDefinition)
+	if gate.Pos() != (Position{Line: 5, Column: 1, Offset: 70}) || gate.End().Column != 55 {
+		t.Errorf("Unexpected gate span: %v - %v", gate.Pos(), gate.End())
+	}
+	call := gate.Body[1].(*GateCall)
+	if call.Name != "x" || len(call.Modifiers) != 1 || call.Modifiers[0].Type != "ctrl" || len(call.Qubits) != 2 {
+		t.Errorf("Unexpected gate body call: %+v", call)
+	}
+
+	def := program.Statements[4].(*SubroutineDefinition)
+	if def.ReturnType != "bit" || len(def.Parameters) != 2 || def.Parameters[1].Type != "angle[32]" {
+		t.Errorf("Unexpected subroutine: %+v", def)
+	}
+
+	loop := program.Statements[5].(*ForStatement)
+	r, ok := loop.Iterable.(*RangeExpression)
+	if !ok || r.Step.(*IntegerLiteral).Value != 2 || r.Stop.(*IntegerLiteral).Value != 10 {
+		t.Errorf("Unexpected loop range: %+v", loop.Iterable)
+	}
+
+	branch := program.Statements[6].(*IfStatement)
+	if _, ok := branch.ElseBody[0].(*GateCall).Qubits[0].(*RangedIdentifier); !ok {
+		t.Errorf("Expected ranged operand in else branch, got %+v", branch.ElseBody)
+	}
+
+	measure := program.Statements[7].(*Measurement)
+	if measure.Target.(*IndexedIdentifier).Name != "c" {
+		t.Errorf("Unexpected measurement target: %+v", measure.Target)
+	}
+
+	if barrier := program.Statements[8].(*Barrier); len(barrier.Qubits) != 2 {
+		t.Errorf("Unexpected barrier: %+v", barrier)
+	}
+	if barrier := program.Statements[9].(*Barrier); len(barrier.Qubits) != 0 {
+		t.Errorf("Expected barrier on every qubit, got %+v", barrier)
+	}
+	if reset := program.Statements[10].(*Reset); reset.Qubit.(*IndexedIdentifier).Name != "q" {
+		t.Errorf("Unexpected reset: %+v", reset)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	result := NewParser().ParseWithErrors("OPENQASM 3.0;\nqubit q; // note\nrz(0.5) q;\n")
+	tokens := result.Tokens()
+
+	expected := []struct {
+		text  string
+		class TokenClass
+	}{
+		{"OPENQASM", TokenKeyword},
+		{"3.0", TokenNumber},
+		{";", TokenOperator},
+		{"qubit", TokenType},
+		{"q", TokenIdentifier},
+		{";", TokenOperator},
+		{"// note", TokenComment},
+		{"rz", TokenIdentifier},
+		{"(", TokenOperator},
+		{"0.5", TokenNumber},
+		{")", TokenOperator},
+		{"q", TokenIdentifier},
+		{";", TokenOperator},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d: %+v", len(expected), len(tokens), tokens)
+	}
+	for i, want := range expected {
+		if tokens[i].Text != want.text || tokens[i].Class != want.class {
+			t.Errorf("Token %d: expected %q (%s), got %q (%s)", i, want.text, want.class, tokens[i].Text, tokens[i].Class)
+		}
+	}
+
+	if tok := tokens[4]; tok.Type != "Identifier" || tok.Position != (Position{Line: 2, Column: 7, Offset: 20}) || tok.EndPos.Column != 8 {
+		t.Errorf("Unexpected identifier token: %+v", tok)
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	stmt, err := ParseStatement("ctrl @ rz(pi / 2) q[0], q[1];")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	call, ok := stmt.(*GateCall)
+	if !ok {
+		t.Fatalf("expected *GateCall, got %T", stmt)
+	}
+	if call.Name != "rz" || len(call.Modifiers) != 1 || len(call.Qubits) != 2 {
+		t.Errorf("unexpected gate call %+v", call)
+	}
+	if call.Pos() != (Position{Line: 1, Column: 1, Offset: 0}) {
+		t.Errorf("position should be relative to the fragment, got %+v", call.Pos())
+	}
+
+	for _, src := range []string{"h q[0]", "h q; x q;", "qubit q"} {
+		if _, err := ParseStatement(src); err == nil {
+			t.Errorf("ParseStatement(%q) should fail", src)
+		}
+	}
+	if _, err := ParseStatement("delay[10ns] q;"); err == nil || !strings.Contains(err.Error(), "delay") {
+		t.Errorf("expected unsupported statement error, got %v", err)
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	expr, err := ParseExpression("theta / 2 + 0x1F")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bin, ok := expr.(*BinaryExpression)
+	if !ok || bin.Operator != "+" {
+		t.Fatalf("expected a + expression, got %#v", expr)
+	}
+	if lit, ok := bin.Right.(*IntegerLiteral); !ok || lit.Value != 31 {
+		t.Errorf("unexpected right operand %#v", bin.Right)
+	}
+
+	_, err = ParseExpression("a +")
+	var errs ParseErrors
+	if !errors.As(err, &errs) || len(errs) == 0 {
+		t.Errorf("expected ParseErrors, got %v", err)
+	}
+	if _, err := ParseExpression("a b"); err == nil {
+		t.Error("trailing tokens should be rejected")
+	}
+}
+
+func TestBadStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // String() of each top-level statement
+		bad  string   // text of the bad statement
+	}{
+		{
+			name: "skipped tokens inside statement",
+			src:  "OPENQASM 3.0;\nqubit q;\nh q[0;\nx q;\n",
+			want: []string{"QuantumDeclaration: q", "BadStatement", "GateCall: x"},
+			bad:  "h q[0;",
+		},
+		{
+			name: "skipped tokens between statements",
+			src:  "OPENQASM 3.0;\nqubit q;\n) ] ;\nx q;\n",
+			want: []string{"QuantumDeclaration: q", "BadStatement", "GateCall: x"},
+			bad:  ") ] ;",
+		},
+		{
+			name: "missing token only",
+			src:  "OPENQASM 3.0;\nqubit q;\nh q\nx q;\n",
+			want: []string{"QuantumDeclaration: q", "GateCall: h", "GateCall: x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewParser().ParseWithErrors(tt.src)
+			var got []string
+			for _, stmt := range result.Program.Statements {
+				got = append(got, stmt.String())
+				if bad, ok := stmt.(*BadStatement); ok {
+					if bad.Text != tt.bad {
+						t.Errorf("Text = %q, want %q", bad.Text, tt.bad)
+					}
+					if bad.Pos().Line != 3 || bad.Pos().Column != 1 || bad.End().Offset-bad.Pos().Offset != len([]rune(tt.bad)) {
+						t.Errorf("span = %v-%v", bad.Pos(), bad.End())
+					}
+				}
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("statements = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Errors inside a block stay inside it
+	result := NewParser().ParseWithErrors("OPENQASM 3.0;\ngate g a { h a; ) ; x a; }\n")
+	gate, ok := result.Program.Statements[0].(*GateDefinition)
+	if !ok || len(gate.Body) != 3 {
+		t.Fatalf("expected gate with 3 body statements, got %+v", result.Program.Statements)
+	}
+	if bad, ok := gate.Body[1].(*BadStatement); !ok || bad.Text != ") ;" {
+		t.Errorf("body[1] = %+v, want BadStatement \") ;\"", gate.Body[1])
+	}
+}
+
+func TestRawStatements(t *testing.T) {
+	src := `OPENQASM 3.0;
+input float theta;
+qubit[2] q;
+pragma qasmparser.shots 10
+def f(qubit r) -> bit {
+  return measure r;
+}
+@bind fast
+h q[0];
+@stretch
+box {
+  delay[10ns] q[1];
+}
+let pair = q[0:1];
+x q[1];
+`
+	result := NewParserWithOptions(&ParseOptions{ErrorRecovery: false}).ParseWithErrors(src)
+	if result.HasErrors() {
+		t.Fatal(result.String())
+	}
+	var got []string
+	for _, stmt := range result.Program.Statements {
+		got = append(got, stmt.String())
+	}
+	want := "RawStatement: input, QuantumDeclaration: q, SubroutineDefinition: f, GateCall: h, RawStatement: box, RawStatement: let, GateCall: x"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("statements = %s, want %s", strings.Join(got, ", "), want)
+	}
+
+	def := result.Program.Statements[2].(*SubroutineDefinition)
+	if raw, ok := def.Body[0].(*RawStatement); !ok || raw.Text != "return measure r;" || raw.Keyword != "return" {
+		t.Errorf("def body = %+v, want the return statement as written", def.Body)
+	}
+	annotated := result.Program.Statements[3].(*GateCall)
+	if annotated.Pos().Line != 9 || len(annotated.Annotations) != 1 {
+		t.Fatalf("annotated statement = %+v", annotated)
+	}
+	if a := annotated.Annotations[0]; a.Keyword != "bind" || a.Content != "fast" || a.Position.Line != 8 || a.String() != "@bind fast" {
+		t.Errorf("annotation = %+v", a)
+	}
+	box := result.Program.Statements[4].(*RawStatement)
+	if box.Text != "box {\n  delay[10ns] q[1];\n}" || box.Keyword != "box" || box.Pos().Line != 11 {
+		t.Errorf("box = %+v", box)
+	}
+	if got := Annotations(box); len(got) != 1 || got[0].String() != "@stretch" {
+		t.Errorf("box annotations = %+v", got)
+	}
+}
+
+// calibrate is a custom statement for the dialect tests
+type calibrate struct {
+	BaseNode
+	Args []string `json:"args"`
+}
+
+func (c *calibrate) StatementNode() {}
+func (c *calibrate) String() string {
+	return "calibrate " + strings.Join(c.Args, " ") + ";"
+}
+
+func TestRegisterStatement(t *testing.T) {
+	p := NewParserWithOptions(&ParseOptions{IncludeComments: true})
+	err := p.RegisterStatement("calibrate", func(src CustomSource) (Statement, error) {
+		if len(src.Tokens) == 0 {
+			return nil, errors.New("missing target")
+		}
+		var args []string
+		for _, tok := range src.Tokens {
+			args = append(args, tok.Text)
+		}
+		return &calibrate{BaseNode: src.Span, Args: args}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, keyword := range []string{"calibrate", "qubit", "1x"} {
+		if err := p.RegisterStatement(keyword, nil); err == nil {
+			t.Errorf("RegisterStatement(%q) succeeded", keyword)
+		}
+	}
+
+	src := "OPENQASM 3.0;\nqubit q;\ncalibrate q (fast); // tune\ngate g a {\n  calibrate a;\n  h a;\n}\nh q;\n"
+	result := p.ParseWithErrors(src)
+	if err := result.Err(); err != nil {
+		t.Fatal(err)
+	}
+	stmts := result.Program.Statements
+	if len(stmts) != 4 {
+		t.Fatalf("got %d statements: %v", len(stmts), stmts)
+	}
+	cal, ok := stmts[1].(*calibrate)
+	if !ok || strings.Join(cal.Args, " ") != "q ( fast )" {
+		t.Fatalf("statement 1 = %#v", stmts[1])
+	}
+	if cal.Pos().Line != 3 || cal.End().Column != 20 {
+		t.Errorf("span = %v-%v", cal.Pos(), cal.End())
+	}
+	gate := stmts[2].(*GateDefinition)
+	if _, ok := gate.Body[0].(*calibrate); !ok || len(gate.Body) != 2 {
+		t.Errorf("gate body = %v", gate.Body)
+	}
+	if len(result.Program.Comments) != 1 {
+		t.Errorf("comments = %v", result.Program.Comments)
+	}
+	for _, tok := range result.Tokens() {
+		if tok.Text == "calibrate" && tok.Type != "Identifier" {
+			t.Errorf("keyword token type = %s", tok.Type)
+		}
+	}
+
+	// A statement may end with a braced block instead of a semicolon
+	result = p.ParseWithErrors("OPENQASM 3.0;\nqubit q;\ncalibrate q {\n  depth 2;\n}\nh q;\n")
+	if err := result.Err(); err != nil || len(result.Program.Statements) != 3 {
+		t.Fatalf("block form: %v %v", err, result.Program.Statements)
+	}
+	if cal := result.Program.Statements[1].(*calibrate); len(cal.Args) != 5 {
+		t.Errorf("block form args = %q", cal.Args)
+	}
+
+	// The keyword is only reserved where a statement starts
+	if _, err := p.ParseString("OPENQASM 3.0;\nqubit calibrate;\nh calibrate;\n"); err != nil {
+		t.Errorf("identifier use: %v", err)
+	}
+
+	// Parser errors are reported and the text is kept
+	result = p.ParseWithErrors("OPENQASM 3.0;\ncalibrate;\n")
+	if len(result.Errors) != 1 || result.Errors[0].Code != message.CustomStatement {
+		t.Fatalf("errors = %v", result.Errors)
+	}
+	if bad, ok := result.Program.Statements[0].(*BadStatement); !ok || bad.Text != "calibrate;" {
+		t.Errorf("statement = %#v", result.Program.Statements[0])
+	}
+
+	// Parsers without registrations see an ordinary identifier
+	if _, err := NewParserWithOptions(&ParseOptions{}).ParseString("OPENQASM 3.0;\ncalibrate q (fast);\n"); err == nil {
+		t.Error("unregistered custom statement parsed")
+	}
+}
+
+func TestSuppressions(t *testing.T) {
+	src := `OPENQASM 3.0;
+// qasmparser:ignore QASM0010
+qreg a[1];
+qreg b[1];
+// qasmparser:ignore QASM0001, qasm0010
+creg c[1];
+// qasmparser:ignore QASM0017
+qubit q;
+// qasmparser:ignored QASM0010
+qreg d[1];
+`
+	result := NewParser().ParseWithErrors(src)
+	var lines []int
+	for _, err := range result.Errors {
+		lines = append(lines, err.Position.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{4, 10}) {
+		t.Errorf("remaining diagnostics on lines %v, want [4 10]", lines)
+	}
+
+	if len(result.Suppressions) != 3 {
+		t.Fatalf("got %d suppressions, want 3", len(result.Suppressions))
+	}
+	s := result.Suppressions[1]
+	if !reflect.DeepEqual(s.Codes, []string{"QASM0001", "qasm0010"}) || s.Line != 6 || s.Position.Line != 5 {
+		t.Errorf("suppression = %+v", s)
+	}
+	if len(s.Suppressed) != 1 || s.Suppressed[0].Code != message.OldStyleDeclaration {
+		t.Errorf("suppressed = %v", s.Suppressed)
+	}
+	// A suppression that hides nothing is listed as stale
+	if stale := result.Suppressions[2]; len(stale.Suppressed) != 0 {
+		t.Errorf("stale suppression hid %v", stale.Suppressed)
+	}
+	if got := len(result.Suppressed()); got != 2 {
+		t.Errorf("Suppressed() = %d diagnostics, want 2", got)
+	}
+}
+
+func TestValidateSuppressions(t *testing.T) {
+	p := NewParserWithOptions(&ParseOptions{StrictMode: true})
+	if err := p.Validate("OPENQASM 3.0;\n// qasmparser:ignore QASM0010\nqreg q[1];\n"); err != nil {
+		t.Errorf("Validate() = %v, want the error suppressed", err)
+	}
+	if err := p.Validate("OPENQASM 3.0;\nqreg q[1];\n"); err == nil {
+		t.Error("Validate() accepted qreg in strict mode")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	src := `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+bit[2] c;
+gate g(theta) a, b { rz(theta) a; cx a, b; }
+for int i in {0, 1} { h q[i]; }
+for int i in [0:1] { reset q[i]; }
+if (c[0] == 1) { x q[1]; } else { ctrl @ g(pi/2) q[0], q[1]; }
+c = measure q;
+`
+	result := NewParser().ParseWithErrors(src)
+	if result.HasErrors() {
+		t.Fatalf("parse errors: %v", result.Errors)
+	}
+	if errs := Check(result.Program); len(errs) != 0 {
+		t.Errorf("Check(parsed) = %v", errs)
+	}
+
+	program := &Program{Statements: []Statement{
+		&QuantumDeclaration{Type: "qubit", Identifier: "q", Size: &IntegerLiteral{Value: -1}},
+		&GateCall{Name: "", Qubits: []Expression{nil, (*Identifier)(nil)}},
+		&Measurement{Qubit: &IndexedIdentifier{Name: "q"}, Target: &Identifier{}},
+		&IfStatement{Condition: &BinaryExpression{Operator: "==", Left: &Identifier{Name: "c"}}},
+		&GateCall{
+			BaseNode: BaseNode{Position: Position{Line: 3, Column: 1}, EndPos: Position{Line: 3, Column: 9}},
+			Name:     "h",
+			Qubits: []Expression{&Identifier{
+				BaseNode: BaseNode{Position: Position{Line: 3, Column: 3}, EndPos: Position{Line: 3, Column: 12}},
+				Name:     "q",
+			}},
+		},
+		&Reset{
+			BaseNode: BaseNode{Position: Position{Line: 2, Column: 1}, EndPos: Position{Line: 2, Column: 9}},
+			Qubit:    &Identifier{Name: "q"},
+		},
+		nil,
+	}}
+	want := []string{
+		"Statements[0].Size: size -1 is negative",
+		"Statements[1]: gate name is empty",
+		"Statements[1].Qubits[0]: expression is nil",
+		"Statements[1].Qubits[1]: expression is nil",
+		"Statements[2].Qubit.Index: expression is nil",
+		"Statements[2].Target: identifier is empty",
+		"Statements[3].Condition.Right: expression is nil",
+		"Statements[4].Qubits[0] (3:3): ends after its parent at 3:9",
+		"Statements[5] (2:1): starts before the previous statement ends",
+		"Statements[6]: statement is nil",
+	}
+	var got []string
+	for _, err := range Check(program) {
+		var checkErr *CheckError
+		if !errors.As(err, &checkErr) {
+			t.Fatalf("error %v is not a *CheckError", err)
+		}
+		got = append(got, err.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if errs := Check(nil); len(errs) != 1 {
+		t.Errorf("Check(nil) = %v, want one error", errs)
+	}
+}
+
+func TestBuildCalibrationDefinition(t *testing.T) {
+	stmt, err := ParseStatement("defcal rx(angle[20] theta, pi / 2) $0, q -> bit { play(d0, wf); }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, ok := stmt.(*CalibrationDefinition)
+	if !ok {
+		t.Fatalf("got %T, want *CalibrationDefinition", stmt)
+	}
+	if def.Name != "rx" || def.ReturnType != "bit" || def.Body != " play(d0, wf); " {
+		t.Errorf("defcal = %+v", def)
+	}
+	params := []Parameter{{Name: "theta", Type: "angle[20]"}, {Name: "pi / 2"}}
+	if len(def.Parameters) != len(params) {
+		t.Fatalf("parameters = %+v", def.Parameters)
+	}
+	for i, p := range params {
+		if def.Parameters[i].Name != p.Name || def.Parameters[i].Type != p.Type {
+			t.Errorf("parameter %d = %+v, want %+v", i, def.Parameters[i], p)
+		}
+	}
+	if len(def.Qubits) != 2 || def.Qubits[0].(*Identifier).Name != "$0" || def.Qubits[1].(*Identifier).Name != "q" {
+		t.Errorf("qubits = %v", def.Qubits)
+	}
+
+	stmt, err = ParseStatement("defcal measure $1 {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def := stmt.(*CalibrationDefinition); def.Name != "measure" || def.Body != "" {
+		t.Errorf("defcal = %+v", def)
+	}
+}
+
+func TestBuildCalibration(t *testing.T) {
+	src := `OPENQASM 3.0;
+defcalgrammar "openpulse";
+cal {
+  extern port d0;
+  frame f0 = newframe(d0, 5.0e9, 0.0);
+}
+defcal x $0 {
+  waveform wf = gaussian(1.0, 160dt, 40dt);
+  play(f0, wf);
+}
+`
+	program, err := NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(program.Statements) != 3 {
+		t.Fatalf("statements = %v", program.Statements)
+	}
+	if g, ok := program.Statements[0].(*CalibrationGrammar); !ok || g.Name != "openpulse" {
+		t.Errorf("statement 0 = %+v, want defcalgrammar", program.Statements[0])
+	}
+	cal, ok := program.Statements[1].(*Calibration)
+	if !ok {
+		t.Fatalf("statement 1 is %T, want *Calibration", program.Statements[1])
+	}
+	want := []PulseDeclaration{
+		{Type: "port", Name: "d0", Extern: true},
+		{Type: "frame", Name: "f0", Value: "newframe(d0, 5.0e9, 0.0)"},
+	}
+	if len(cal.Declarations) != len(want) {
+		t.Fatalf("declarations = %+v", cal.Declarations)
+	}
+	for i, w := range want {
+		d := cal.Declarations[i]
+		if d.Type != w.Type || d.Name != w.Name || d.Extern != w.Extern || d.Value != w.Value {
+			t.Errorf("declaration %d = %+v, want %+v", i, d, w)
+		}
+	}
+	if pos, end := cal.Declarations[1].Pos(), cal.Declarations[1].End(); pos.Line != 5 || pos.Column != 3 || end.Line != 5 || end.Column != 39 {
+		t.Errorf("frame spans %+v to %+v", pos, end)
+	}
+	if src[cal.Declarations[0].Pos().Offset:cal.Declarations[0].End().Offset] != "extern port d0;" {
+		t.Errorf("port offsets %d:%d", cal.Declarations[0].Pos().Offset, cal.Declarations[0].End().Offset)
+	}
+	var refs []string
+	for _, ref := range cal.References {
+		refs = append(refs, ref.Name)
+	}
+	if strings.Join(refs, " ") != "newframe d0" {
+		t.Errorf("references = %v", refs)
+	}
+
+	def := program.Statements[2].(*CalibrationDefinition)
+	if len(def.Declarations) != 1 || def.Declarations[0].Name != "wf" || def.Declarations[0].Type != "waveform" {
+		t.Errorf("defcal declarations = %+v", def.Declarations)
+	}
+	if len(def.References) != 4 || def.References[3].Name != "wf" || def.References[3].Pos().Line != 9 {
+		t.Errorf("defcal references = %+v", def.References)
+	}
+	if errs := Check(program); len(errs) > 0 {
+		t.Errorf("Check() = %v", errs)
+	}
+
+	// Without defcalgrammar "openpulse" the bodies are only text
+	program, err = NewParser().ParseString("OPENQASM 3.0;\ncal { extern port d0; }\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal := program.Statements[0].(*Calibration); cal.Body != " extern port d0; " || cal.Declarations != nil || cal.References != nil {
+		t.Errorf("cal = %+v", cal)
+	}
+	stmt, err := ParseStatement("cal { extern port d0; }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal := stmt.(*Calibration); cal.Declarations != nil {
+		t.Errorf("fragment declarations = %+v", cal.Declarations)
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	src := `OPENQASM 3.0;
+pragma shots 1000
+#pragma seed 7
+pragma shots 4096
+pragma seed many
+pragma custom anything
+qubit q;
+`
+	result := NewParser().ParseWithErrors(src)
+	run := result.Program.Run
+	if run == nil || run.Shots != 4096 || run.Seed == nil || *run.Seed != 7 {
+		t.Fatalf("Run = %+v", run)
+	}
+	if len(result.Errors) != 1 {
+		t.Fatalf("Errors = %v", result.Errors)
+	}
+	d := result.Errors[0]
+	if d.Code != message.InvalidPragma || d.Severity != SeverityWarning || d.Position.Line != 5 {
+		t.Errorf("diagnostic = %+v", d)
+	}
+	if want := `pragma seed needs an integer, not "many"`; d.Message != want {
+		t.Errorf("message = %q, want %q", d.Message, want)
+	}
+	if got := strings.Join(run.Pragmas(), "\n"); got != "pragma shots 4096\npragma seed 7" {
+		t.Errorf("Pragmas() = %q", got)
+	}
+
+	program, err := NewParser().ParseString("OPENQASM 3.0;\npragma shots 0\nqubit q;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.Run != nil {
+		t.Errorf("Run = %+v", program.Run)
+	}
+}
+
+func TestDumpPragmas(t *testing.T) {
+	src := `OPENQASM 3.0;
+qubit q;
+pragma qasmparser.dump_state
+h q;
+#pragma qasmparser.dump_probs after h
+`
+	program, err := NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.Run == nil || len(program.Run.Dumps) != 2 {
+		t.Fatalf("Run = %+v", program.Run)
+	}
+	dumps := program.Run.Dumps
+	if dumps[0].Kind != DumpState || dumps[0].Label != "" || dumps[0].Position.Line != 3 || dumps[0].Position.Column != 1 {
+		t.Errorf("dump 0 = %+v", dumps[0])
+	}
+	if dumps[1].Kind != DumpProbabilities || dumps[1].Label != "after h" || dumps[1].Position.Line != 5 {
+		t.Errorf("dump 1 = %+v", dumps[1])
+	}
+	if got := dumps[1].Pragma(); got != "pragma qasmparser.dump_probs after h" {
+		t.Errorf("Pragma() = %q", got)
+	}
+	if pragmas := program.Run.Pragmas(); len(pragmas) != 0 {
+		t.Errorf("Pragmas() = %v", pragmas)
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	program, err := NewParser().ParseString("OPENQASM 3.0;\nbit[2] c;\nint x;\nc[1] = 1;\nx += 2 * x;\nc = measure q;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(program.Statements) != 5 {
+		t.Fatalf("got %d statements", len(program.Statements))
+	}
+	set, ok := program.Statements[2].(*Assignment)
+	if !ok || set.Operator != "=" || set.Target.(*IndexedIdentifier).Name != "c" {
+		t.Fatalf("statement 2 = %#v", program.Statements[2])
+	}
+	if lit, ok := set.Value.(*IntegerLiteral); !ok || lit.Value != 1 {
+		t.Errorf("value = %#v", set.Value)
+	}
+	add, ok := program.Statements[3].(*Assignment)
+	if !ok || add.Operator != "+=" || add.Target.(*Identifier).Name != "x" {
+		t.Errorf("statement 3 = %#v", program.Statements[3])
+	}
+	if _, ok := program.Statements[4].(*Measurement); !ok {
+		t.Errorf("statement 4 = %#v", program.Statements[4])
+	}
+	if errs := Check(program); len(errs) > 0 {
+		t.Errorf("Check() = %v", errs)
+	}
+}
+
+func TestArrays(t *testing.T) {
+	src := `OPENQASM 3.0;
+array[int[32], 4, 5] a;
+a[1, 2] = a[0][1] + 1;
+def f(readonly array[float[64], 3] r, mutable array[int[8], #dim = 2] m) {}
+`
+	program, err := NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl := program.Statements[0].(*ClassicalDeclaration)
+	if decl.Type != "array" || decl.Array == nil || decl.Array.Element != "int[32]" || len(decl.Array.Dimensions) != 2 {
+		t.Fatalf("declaration = %#v", decl)
+	}
+
+	set := program.Statements[1].(*Assignment)
+	target := set.Target.(*IndexedIdentifier)
+	if target.Name != "a" || target.Index.(*IntegerLiteral).Value != 1 || len(target.Indices) != 1 || target.Indices[0].(*IntegerLiteral).Value != 2 {
+		t.Errorf("target = %#v", target)
+	}
+	read := set.Value.(*BinaryExpression).Left.(*IndexedIdentifier)
+	if read.Name != "a" || read.Index.(*IntegerLiteral).Value != 0 || len(read.Indices) != 1 || read.Indices[0].(*IntegerLiteral).Value != 1 {
+		t.Errorf("a[0][1] = %#v", read)
+	}
+	if read.Pos().Column != 11 || read.End().Column != 18 {
+		t.Errorf("a[0][1] spans %v to %v", read.Pos(), read.End())
+	}
+
+	params := program.Statements[2].(*SubroutineDefinition).Parameters
+	if params[0].Type != "readonly array[float[64], 3]" || params[0].Array.Access != "readonly" || len(params[0].Array.Dimensions) != 1 {
+		t.Errorf("parameter 0 = %#v", params[0])
+	}
+	if params[1].Type != "mutable array[int[8], #dim = 2]" || params[1].Array.Access != "mutable" || params[1].Array.Rank.(*IntegerLiteral).Value != 2 {
+		t.Errorf("parameter 1 = %#v", params[1])
+	}
+	if errs := Check(program); len(errs) > 0 {
+		t.Errorf("Check() = %v", errs)
+	}
+}
+
+func TestComplex(t *testing.T) {
+	src := `OPENQASM 3.0;
+complex[float[64]] z = 2.0 + 3.1im;
+complex w = 1 im;
+`
+	program, err := NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl := program.Statements[0].(*ClassicalDeclaration)
+	if decl.Type != "complex" || decl.Size.(*IntegerLiteral).Value != 64 {
+		t.Fatalf("declaration = %#v", decl)
+	}
+	imag := decl.Initializer.(*BinaryExpression).Right.(*ImaginaryLiteral)
+	if imag.Value != 3.1 || imag.Raw != "3.1im" {
+		t.Errorf("3.1im = %#v", imag)
+	}
+	decl = program.Statements[1].(*ClassicalDeclaration)
+	if imag := decl.Initializer.(*ImaginaryLiteral); decl.Type != "complex" || decl.Size != nil || imag.Value != 1 {
+		t.Errorf("declaration = %#v", decl)
+	}
+}
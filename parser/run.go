@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	qasm_gen "github.com/orangekame3/qasmparser/gen/parser"
+	"github.com/orangekame3/qasmparser/message"
+)
+
+// RunConfig is how a program asks to be run, from its execution pragmas:
+//
+//	pragma shots 4096
+//	pragma seed 7
+//	pragma qasmparser.dump_probs after bell
+type RunConfig struct {
+	// Shots is the number of times to run the program, zero if not given
+	Shots int `json:"shots,omitempty"`
+
+	// Seed seeds the randomness of a simulation, nil if not given
+	Seed *int64 `json:"seed,omitempty"`
+
+	// Dumps are the points a simulation records its state at, in order
+	Dumps []Dump `json:"dumps,omitempty"`
+}
+
+// DumpKind is what a dump records
+type DumpKind string
+
+const (
+	// DumpProbabilities records the probability of each basis state
+	DumpProbabilities DumpKind = "probs"
+
+	// DumpState records the amplitude of each basis state
+	DumpState DumpKind = "state"
+)
+
+// Dump is a point in a program, between two top-level statements, at
+// which a simulation records its state. It is written as
+//
+//	pragma qasmparser.dump_probs [label]
+//	pragma qasmparser.dump_state [label]
+//
+// where the optional label tells the records of several dumps apart.
+type Dump struct {
+	Kind     DumpKind `json:"kind"`
+	Label    string   `json:"label,omitempty"`
+	Position Position `json:"position"`
+}
+
+// Pragma returns the pragma that asks for the dump
+func (d Dump) Pragma() string {
+	pragma := "pragma qasmparser.dump_" + string(d.Kind)
+	if d.Label != "" {
+		pragma += " " + d.Label
+	}
+	return pragma
+}
+
+// Pragmas returns the pragmas that set c, in a fixed order. Dumps are
+// left out, as they belong where they are in the program.
+func (c *RunConfig) Pragmas() []string {
+	var pragmas []string
+	if c.Shots > 0 {
+		pragmas = append(pragmas, "pragma shots "+strconv.Itoa(c.Shots))
+	}
+	if c.Seed != nil {
+		pragmas = append(pragmas, "pragma seed "+strconv.FormatInt(*c.Seed, 10))
+	}
+	return pragmas
+}
+
+// readRunConfig collects the execution pragmas at the top level of a
+// program, returning nil if it has none. A pragma given twice takes its
+// last value. Values that are not integers, or not positive shot counts,
+// are reported as warnings and ignored; other pragmas are left to their
+// tools.
+func readRunConfig(tree *qasm_gen.ProgramContext) (*RunConfig, []ParseError) {
+	var (
+		config *RunConfig
+		diags  []ParseError
+	)
+	for _, child := range tree.AllStatementOrScope() {
+		stmt := child.Statement()
+		if stmt == nil || stmt.Pragma() == nil || stmt.Pragma().RemainingLineContent() == nil {
+			continue
+		}
+		content := stmt.Pragma().RemainingLineContent().GetSymbol()
+		fields := strings.Fields(content.GetText())
+		if len(fields) == 0 {
+			continue
+		}
+		invalid := func(expected string) {
+			pos := tokenPosition(content)
+			pos.Column--
+			diag := NewDiagnostic("semantic", message.InvalidPragma, map[string]string{
+				"pragma": fields[0], "expected": expected, "value": strconv.Quote(strings.Join(fields[1:], " ")),
+			}, pos)
+			diag.Severity = SeverityWarning
+			diags = append(diags, diag)
+		}
+		switch fields[0] {
+		case "shots":
+			shots, err := strconv.Atoi(strings.Join(fields[1:], " "))
+			if err != nil || shots <= 0 {
+				invalid("a positive integer")
+				continue
+			}
+			if config == nil {
+				config = &RunConfig{}
+			}
+			config.Shots = shots
+		case "seed":
+			seed, err := strconv.ParseInt(strings.Join(fields[1:], " "), 10, 64)
+			if err != nil {
+				invalid("an integer")
+				continue
+			}
+			if config == nil {
+				config = &RunConfig{}
+			}
+			config.Seed = &seed
+		case "qasmparser.dump_probs", "qasmparser.dump_state":
+			if config == nil {
+				config = &RunConfig{}
+			}
+			config.Dumps = append(config.Dumps, Dump{
+				Kind:     DumpKind(strings.TrimPrefix(fields[0], "qasmparser.dump_")),
+				Label:    strings.Join(fields[1:], " "),
+				Position: tokenPosition(stmt.GetStart()),
+			})
+		}
+	}
+	return config, diags
+}
@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"unicode/utf8"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+// text is the set of source representations the parser accepts
+type text interface {
+	string | []byte
+}
+
+// asciiStream is an antlr.CharStream reading directly from the source without
+// decoding it into runes. It is only valid for ASCII input, where byte offsets
+// and character indexes coincide.
+type asciiStream[T text] struct {
+	data  T
+	index int
+}
+
+// newCharStream returns a char stream over data, avoiding a copy when the
+// input is plain ASCII (the common case for QASM sources)
+func newCharStream[T text](data T) antlr.CharStream {
+	for i := 0; i < len(data); i++ {
+		if data[i] >= utf8.RuneSelf {
+			return antlr.NewInputStream(string(data))
+		}
+	}
+	return &asciiStream[T]{data: data}
+}
+
+// Consume moves to the next character
+func (s *asciiStream[T]) Consume() {
+	if s.index >= len(s.data) {
+		panic("cannot consume EOF")
+	}
+	s.index++
+}
+
+// LA returns the character at the given offset from the current position
+func (s *asciiStream[T]) LA(offset int) int {
+	if offset == 0 {
+		return 0
+	}
+	if offset < 0 {
+		offset++
+	}
+	pos := s.index + offset - 1
+	if pos < 0 || pos >= len(s.data) {
+		return antlr.TokenEOF
+	}
+	return int(s.data[pos])
+}
+
+// Mark does nothing as the whole input is buffered
+func (s *asciiStream[T]) Mark() int {
+	return -1
+}
+
+// Release does nothing as the whole input is buffered
+func (s *asciiStream[T]) Release(int) {}
+
+// Index returns the current character index
+func (s *asciiStream[T]) Index() int {
+	return s.index
+}
+
+// Seek moves to the given character index
+func (s *asciiStream[T]) Seek(index int) {
+	s.index = min(index, len(s.data))
+}
+
+// Size returns the number of characters in the stream
+func (s *asciiStream[T]) Size() int {
+	return len(s.data)
+}
+
+// GetSourceName returns the stream name reported by ANTLR
+func (s *asciiStream[T]) GetSourceName() string {
+	return "<input>"
+}
+
+// GetText returns the text between start and stop inclusive
+func (s *asciiStream[T]) GetText(start, stop int) string {
+	if stop >= len(s.data) {
+		stop = len(s.data) - 1
+	}
+	if start >= len(s.data) || start > stop {
+		return ""
+	}
+	return string(s.data[start : stop+1])
+}
+
+// GetTextFromTokens returns the text spanned by two tokens
+func (s *asciiStream[T]) GetTextFromTokens(start, stop antlr.Token) string {
+	if start == nil || stop == nil {
+		return ""
+	}
+	return s.GetText(start.GetStart(), stop.GetStop())
+}
+
+// GetTextFromInterval returns the text within an interval
+func (s *asciiStream[T]) GetTextFromInterval(i antlr.Interval) string {
+	return s.GetText(i.Start, i.Stop)
+}
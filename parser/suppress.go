@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+// suppressDirective starts a comment that suppresses diagnostics
+const suppressDirective = "qasmparser:ignore"
+
+// Suppression is a comment such as "// qasmparser:ignore QASM0010" that
+// hides diagnostics with the listed codes on the line after it. Several
+// codes may be listed, separated by spaces or commas.
+type Suppression struct {
+	Codes    []string `json:"codes"`
+	Position Position `json:"position"`
+
+	// Line is the line whose diagnostics are suppressed
+	Line int `json:"line"`
+
+	// Suppressed are the diagnostics the comment hid, empty if it is stale
+	Suppressed []ParseError `json:"suppressed,omitempty"`
+}
+
+// Matches reports whether s hides diagnostic
+func (s *Suppression) Matches(diagnostic ParseError) bool {
+	if diagnostic.Position.Line != s.Line || diagnostic.Code == "" {
+		return false
+	}
+	for _, code := range s.Codes {
+		if strings.EqualFold(code, diagnostic.Code) {
+			return true
+		}
+	}
+	return false
+}
+
+// Suppressed returns every diagnostic hidden by a suppression comment
+func (r *ParseResult) Suppressed() []ParseError {
+	var hidden []ParseError
+	for _, s := range r.Suppressions {
+		hidden = append(hidden, s.Suppressed...)
+	}
+	return hidden
+}
+
+// collectSuppressions finds the suppression comments among tokens. A
+// comment that lists no codes suppresses nothing and is skipped.
+func collectSuppressions(tokens []antlr.Token) []Suppression {
+	var suppressions []Suppression
+	for _, tok := range tokens {
+		kind, ok := commentKind(tok)
+		if !ok || kind != TriviaLineComment {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(tok.GetText(), "//"))
+		rest, ok := strings.CutPrefix(text, suppressDirective)
+		if !ok || rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			continue
+		}
+		codes := strings.FieldsFunc(rest, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		if len(codes) == 0 {
+			continue
+		}
+		suppressions = append(suppressions, Suppression{
+			Codes:    codes,
+			Position: tokenPosition(tok),
+			Line:     tok.GetLine() + 1,
+		})
+	}
+	return suppressions
+}
+
+// suppress moves the diagnostics matched by the result's suppressions
+// out of Errors and into the suppressions that hide them
+func (r *ParseResult) suppress() {
+	if len(r.Suppressions) == 0 {
+		return
+	}
+	kept := r.Errors[:0]
+	for _, diag := range r.Errors {
+		hidden := false
+		for i := range r.Suppressions {
+			if r.Suppressions[i].Matches(diag) {
+				r.Suppressions[i].Suppressed = append(r.Suppressions[i].Suppressed, diag)
+				hidden = true
+				break
+			}
+		}
+		if !hidden {
+			kept = append(kept, diag)
+		}
+	}
+	r.Errors = kept
+}
@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/antlr4-go/antlr/v4"
+	qasm_gen "github.com/orangekame3/qasmparser/gen/parser"
+)
+
+// TokenClass is the lexical category of a token
+type TokenClass string
+
+const (
+	TokenKeyword    TokenClass = "keyword"
+	TokenType       TokenClass = "type"
+	TokenIdentifier TokenClass = "identifier"
+	TokenNumber     TokenClass = "number"
+	TokenString     TokenClass = "string"
+	TokenOperator   TokenClass = "operator"
+	TokenComment    TokenClass = "comment"
+)
+
+// Token is a lexical token of the parsed source. Whitespace is not
+// included; see Trivia for that.
+type Token struct {
+	// Type is the grammar's name for the token, e.g. "Identifier" or "QUBIT"
+	Type     string     `json:"type"`
+	Class    TokenClass `json:"class"`
+	Text     string     `json:"text"`
+	Position Position   `json:"position"`
+	EndPos   Position   `json:"end_position"`
+}
+
+// Tokens returns the tokens of the parsed source in order, comments
+// included
+func (r *ParseResult) Tokens() []Token {
+	tokens := make([]Token, 0, len(r.tokens))
+	for _, tok := range r.tokens {
+		if tok.GetTokenType() == antlr.TokenEOF {
+			continue
+		}
+		tokens = append(tokens, newToken(tok))
+	}
+	return tokens
+}
+
+// newToken describes tok as the lexer produced it
+func newToken(tok antlr.Token) Token {
+	name := tokenTypeName(sourceTokenType(tok))
+	pos := tokenPosition(tok)
+	return Token{
+		Type:     name,
+		Class:    tokenClass(tok, name),
+		Text:     tok.GetText(),
+		Position: pos,
+		EndPos:   advancePosition(pos, tok.GetText()),
+	}
+}
+
+var (
+	vocabularyOnce sync.Once
+	symbolicNames  []string
+	literalNames   []string
+)
+
+// loadVocabulary reads the token names from the generated lexer
+func loadVocabulary() {
+	vocabularyOnce.Do(func() {
+		lexer := qasm_gen.Newqasm3Lexer(antlr.NewInputStream(""))
+		symbolicNames = lexer.SymbolicNames
+		literalNames = lexer.LiteralNames
+	})
+}
+
+// tokenTypeName returns the symbolic name of a token type
+func tokenTypeName(tokenType int) string {
+	loadVocabulary()
+	if tokenType > 0 && tokenType < len(symbolicNames) {
+		return symbolicNames[tokenType]
+	}
+	return ""
+}
+
+// tokenTypeOf returns the token type with the given symbolic name
+func tokenTypeOf(name string) int {
+	loadVocabulary()
+	for tokenType, n := range symbolicNames {
+		if n == name {
+			return tokenType
+		}
+	}
+	panic("parser: unknown token type " + name)
+}
+
+// TokenDefinition describes a token type of the lexer
+type TokenDefinition struct {
+	// Type is the grammar's name for the token, e.g. "GATE"
+	Type string `json:"type"`
+
+	// Literal is the fixed spelling of the token, e.g. "gate", or "" for
+	// tokens such as identifiers whose text varies
+	Literal string `json:"literal,omitempty"`
+
+	Class TokenClass `json:"class"`
+}
+
+// Vocabulary returns the token types of the lexer in grammar order, for
+// tools such as syntax highlighters that need the keyword and operator
+// lists without tokenizing any input
+func Vocabulary() []TokenDefinition {
+	loadVocabulary()
+	var defs []TokenDefinition
+	for t := 1; t < len(symbolicNames); t++ {
+		def := TokenDefinition{Type: symbolicNames[t], Class: classOf(t, symbolicNames[t])}
+		if t < len(literalNames) {
+			def.Literal = strings.Trim(literalNames[t], "'")
+		}
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// typeKeywords are the keywords naming types
+var typeKeywords = map[string]bool{
+	"QUBIT": true, "QREG": true, "CREG": true, "BIT": true, "INT": true,
+	"UINT": true, "FLOAT": true, "ANGLE": true, "BOOL": true, "COMPLEX": true,
+	"ARRAY": true, "DURATION": true, "STRETCH": true, "VOID": true,
+}
+
+func tokenClass(tok antlr.Token, name string) TokenClass {
+	if tok.GetChannel() == antlr.TokenHiddenChannel {
+		return TokenComment
+	}
+	return classOf(sourceTokenType(tok), name)
+}
+
+// classOf classifies a token type by its symbolic name
+func classOf(tokenType int, name string) TokenClass {
+	switch name {
+	case "Identifier", "HardwareQubit":
+		return TokenIdentifier
+	case "DecimalIntegerLiteral", "BinaryIntegerLiteral", "OctalIntegerLiteral",
+		"HexIntegerLiteral", "FloatLiteral", "ImaginaryLiteral", "TimingLiteral",
+		"VersionSpecifier":
+		return TokenNumber
+	case "StringLiteral", "BitstringLiteral", "RemainingLineContent", "CalibrationBlock":
+		return TokenString
+	case "BooleanLiteral", "AnnotationKeyword":
+		return TokenKeyword
+	case "LineComment", "BlockComment":
+		return TokenComment
+	}
+	if typeKeywords[name] {
+		return TokenType
+	}
+
+	// Keywords are the tokens whose literal spelling is a word, e.g. 'gate'
+	if tokenType > 0 && tokenType < len(literalNames) {
+		if literal := strings.Trim(literalNames[tokenType], "'"); literal != "" && isWordStart(literal[0]) {
+			return TokenKeyword
+		}
+	}
+	return TokenOperator
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+// TriviaKind classifies source text that carries no syntactic meaning
+type TriviaKind string
+
+const (
+	TriviaLineComment  TriviaKind = "line_comment"
+	TriviaBlockComment TriviaKind = "block_comment"
+	TriviaWhitespace   TriviaKind = "whitespace"
+	TriviaNewline      TriviaKind = "newline"
+)
+
+// Trivia is a run of comments, whitespace or newlines between tokens.
+// Positions use 1-based lines and columns; EndPos is exclusive.
+type Trivia struct {
+	Kind     TriviaKind `json:"kind"`
+	Text     string     `json:"text"`
+	Position Position   `json:"position"`
+	EndPos   Position   `json:"end_position"`
+}
+
+// Trivia returns every comment, whitespace run and newline run in the
+// source, in order, regardless of ParseOptions.IncludeComments
+func (r *ParseResult) Trivia() []Trivia {
+	if r.tokens == nil {
+		return nil
+	}
+	return collectTrivia(r.tokens, r.input)
+}
+
+// Source returns the text that positions in the result refer to: the
+// input with any byte order mark removed and line endings normalized
+func (r *ParseResult) Source() string {
+	if r.input == nil || r.input.Size() == 0 {
+		return ""
+	}
+	return r.input.GetText(0, r.input.Size()-1)
+}
+
+// collectTrivia walks all tokens, emitting hidden-channel comments and the
+// skipped text between consecutive tokens
+func collectTrivia(tokens []antlr.Token, input antlr.CharStream) []Trivia {
+	var trivia []Trivia
+	pos := Position{Line: 1, Column: 1}
+
+	for _, tok := range tokens {
+		start := tok.GetStart()
+		if tok.GetTokenType() == antlr.TokenEOF {
+			start = input.Size()
+		}
+		if start > pos.Offset {
+			trivia = appendGapTrivia(trivia, input.GetText(pos.Offset, start-1), pos)
+			pos = advancePosition(pos, input.GetText(pos.Offset, start-1))
+		}
+		if tok.GetTokenType() == antlr.TokenEOF {
+			break
+		}
+
+		text := tok.GetText()
+		tokPos := tokenPosition(tok)
+		end := advancePosition(tokPos, text)
+		if kind, ok := commentKind(tok); ok {
+			trivia = append(trivia, Trivia{Kind: kind, Text: text, Position: tokPos, EndPos: end})
+		}
+		pos = end
+	}
+
+	return trivia
+}
+
+// appendGapTrivia splits skipped text into whitespace and newline runs
+func appendGapTrivia(trivia []Trivia, gap string, pos Position) []Trivia {
+	for len(gap) > 0 {
+		kind := TriviaWhitespace
+		n := strings.IndexAny(gap, "\r\n")
+		if n == 0 {
+			kind = TriviaNewline
+			n = len(gap) - len(strings.TrimLeft(gap, "\r\n"))
+		} else if n < 0 {
+			n = len(gap)
+		}
+
+		text := gap[:n]
+		end := advancePosition(pos, text)
+		trivia = append(trivia, Trivia{Kind: kind, Text: text, Position: pos, EndPos: end})
+		gap = gap[n:]
+		pos = end
+	}
+	return trivia
+}
+
+// commentKind reports whether tok is a comment and which kind
+func commentKind(tok antlr.Token) (TriviaKind, bool) {
+	if tok.GetChannel() != antlr.TokenHiddenChannel {
+		return "", false
+	}
+	if strings.HasPrefix(tok.GetText(), "//") {
+		return TriviaLineComment, true
+	}
+	return TriviaBlockComment, true
+}
+
+// tokenPosition returns the 1-based start position of a token
+func tokenPosition(tok antlr.Token) Position {
+	return Position{Line: tok.GetLine(), Column: tok.GetColumn() + 1, Offset: tok.GetStart()}
+}
+
+// advancePosition returns the position just after text starting at pos
+func advancePosition(pos Position, text string) Position {
+	for _, r := range text {
+		pos.Offset++
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
+
+// extractComments builds AST comments from the hidden-channel tokens
+func extractComments(tokens []antlr.Token) []Comment {
+	comments := make([]Comment, 0)
+	for _, tok := range tokens {
+		kind, ok := commentKind(tok)
+		if !ok {
+			continue
+		}
+		commentType := "line"
+		if kind == TriviaBlockComment {
+			commentType = "block"
+		}
+		pos := tokenPosition(tok)
+		comments = append(comments, Comment{
+			BaseNode: BaseNode{Position: pos, EndPos: advancePosition(pos, tok.GetText())},
+			Text:     tok.GetText(),
+			Type:     commentType,
+		})
+	}
+	return comments
+}
+
+// allTokens returns every token the lexer produced, on all channels
+func allTokens(stream *antlr.CommonTokenStream) []antlr.Token {
+	stream.Fill()
+	return stream.GetAllTokens()
+}
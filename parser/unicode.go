@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/orangekame3/qasmparser/message"
+)
+
+// byteOrderMark is the UTF-8 encoded byte order mark
+const byteOrderMark = "\uFEFF"
+
+// checkCodePoints reports characters the lexer would otherwise reject with
+// an opaque "token recognition error", pointing at the offending code point.
+// Invisible formatting characters (zero-width spaces, bidi overrides) are
+// legal inside comments and strings but can disguise code, so they are
+// warnings, or errors in strict mode.
+func checkCodePoints[T text](content T, strict bool) []ParseError {
+	var diagnostics []ParseError
+	line, column, offset := 1, 0, 0
+
+	for i := 0; i < len(content); {
+		r, size := rune(content[i]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRuneInString(string(content[i:min(i+utf8.UTFMax, len(content))]))
+		}
+		pos := Position{Line: line, Column: column, Offset: offset}
+
+		switch {
+		case r == utf8.RuneError && size == 1:
+			diagnostics = append(diagnostics, NewDiagnostic("lexer", message.InvalidUTF8,
+				map[string]string{"byte": fmt.Sprintf("0x%02X", content[i])}, pos))
+		case r == '\n':
+			line++
+			column = -1
+		case r < ' ' && r != '\t' && r != '\r', r == 0x7F:
+			diagnostics = append(diagnostics, NewDiagnostic("lexer", message.ControlCharacter,
+				map[string]string{"char": fmt.Sprintf("%U", r)}, pos))
+		case unicode.Is(unicode.Cf, r):
+			diag := NewDiagnostic("lexer", message.InvisibleCharacter, map[string]string{"char": fmt.Sprintf("%U", r)}, pos)
+			if !strict {
+				diag.Severity = SeverityWarning
+			}
+			diagnostics = append(diagnostics, diag)
+		}
+
+		i += size
+		column++
+		offset++
+	}
+
+	return diagnostics
+}
+
+// IsValidIdentifier reports whether name is a valid OpenQASM 3.0 identifier:
+// a letter, underscore or Unicode letter (categories Lu, Ll, Lt, Lm, Lo, Nl)
+// followed by any of those or ASCII digits
+func IsValidIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r == '_' || unicode.In(r, unicode.Lu, unicode.Ll, unicode.Lt, unicode.Lm, unicode.Lo, unicode.Nl) {
+			continue
+		}
+		if i > 0 && r >= '0' && r <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// UnquoteString removes the quotes from a string literal token such as an
+// include path and resolves backslash escapes (\n, \t, \\, \", \', \uXXXX)
+func UnquoteString(literal string) (string, error) {
+	if len(literal) < 2 {
+		return "", fmt.Errorf("invalid string literal %s", literal)
+	}
+	quote := literal[0]
+	if (quote != '"' && quote != '\'') || literal[len(literal)-1] != quote {
+		return "", fmt.Errorf("invalid string literal %s", literal)
+	}
+
+	body := literal[1 : len(literal)-1]
+	if !strings.ContainsRune(body, '\\') {
+		return body, nil
+	}
+
+	var sb strings.Builder
+	for len(body) > 0 {
+		r, multibyte, tail, err := strconv.UnquoteChar(body, quote)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in string literal %s", literal)
+		}
+		if r < utf8.RuneSelf && !multibyte {
+			sb.WriteByte(byte(r))
+		} else {
+			sb.WriteRune(r)
+		}
+		body = tail
+	}
+	return sb.String(), nil
+}
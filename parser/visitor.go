@@ -11,18 +11,31 @@ type Visitor interface {
 	VisitClassicalDeclaration(node *ClassicalDeclaration) interface{}
 	VisitGateCall(node *GateCall) interface{}
 	VisitMeasurement(node *Measurement) interface{}
+	VisitAssignment(node *Assignment) interface{}
 	VisitInclude(node *Include) interface{}
 	VisitGateDefinition(node *GateDefinition) interface{}
+	VisitSubroutineDefinition(node *SubroutineDefinition) interface{}
 	VisitIfStatement(node *IfStatement) interface{}
 	VisitForStatement(node *ForStatement) interface{}
 	VisitWhileStatement(node *WhileStatement) interface{}
+	VisitBarrier(node *Barrier) interface{}
+	VisitReset(node *Reset) interface{}
+	VisitCalibrationDefinition(node *CalibrationDefinition) interface{}
+	VisitCalibration(node *Calibration) interface{}
+	VisitCalibrationGrammar(node *CalibrationGrammar) interface{}
+	VisitBadStatement(node *BadStatement) interface{}
+	VisitRawStatement(node *RawStatement) interface{}
 
 	// Expression visitors
 	VisitIdentifier(node *Identifier) interface{}
 	VisitIndexedIdentifier(node *IndexedIdentifier) interface{}
 	VisitRangedIdentifier(node *RangedIdentifier) interface{}
+	VisitRangeExpression(node *RangeExpression) interface{}
+	VisitMeasureExpression(node *MeasureExpression) interface{}
+	VisitArrayLiteral(node *ArrayLiteral) interface{}
 	VisitIntegerLiteral(node *IntegerLiteral) interface{}
 	VisitFloatLiteral(node *FloatLiteral) interface{}
+	VisitImaginaryLiteral(node *ImaginaryLiteral) interface{}
 	VisitStringLiteral(node *StringLiteral) interface{}
 	VisitBooleanLiteral(node *BooleanLiteral) interface{}
 	VisitBinaryExpression(node *BinaryExpression) interface{}
@@ -47,19 +60,38 @@ func (v *BaseVisitor) VisitGateCall(node *GateCall) interface{}
 func (v *BaseVisitor) VisitMeasurement(node *Measurement) interface{}                   { return nil }
 func (v *BaseVisitor) VisitInclude(node *Include) interface{}                           { return nil }
 func (v *BaseVisitor) VisitGateDefinition(node *GateDefinition) interface{}             { return nil }
-func (v *BaseVisitor) VisitIfStatement(node *IfStatement) interface{}                   { return nil }
-func (v *BaseVisitor) VisitForStatement(node *ForStatement) interface{}                 { return nil }
-func (v *BaseVisitor) VisitWhileStatement(node *WhileStatement) interface{}             { return nil }
-func (v *BaseVisitor) VisitIdentifier(node *Identifier) interface{}                     { return nil }
-func (v *BaseVisitor) VisitIndexedIdentifier(node *IndexedIdentifier) interface{}       { return nil }
-func (v *BaseVisitor) VisitRangedIdentifier(node *RangedIdentifier) interface{}         { return nil }
-func (v *BaseVisitor) VisitIntegerLiteral(node *IntegerLiteral) interface{}             { return nil }
-func (v *BaseVisitor) VisitFloatLiteral(node *FloatLiteral) interface{}                 { return nil }
-func (v *BaseVisitor) VisitStringLiteral(node *StringLiteral) interface{}               { return nil }
-func (v *BaseVisitor) VisitBooleanLiteral(node *BooleanLiteral) interface{}             { return nil }
-func (v *BaseVisitor) VisitBinaryExpression(node *BinaryExpression) interface{}         { return nil }
-func (v *BaseVisitor) VisitUnaryExpression(node *UnaryExpression) interface{}           { return nil }
-func (v *BaseVisitor) VisitFunctionCall(node *FunctionCall) interface{}                 { return nil }
+func (v *BaseVisitor) VisitSubroutineDefinition(node *SubroutineDefinition) interface{} {
+	return nil
+}
+func (v *BaseVisitor) VisitCalibrationDefinition(node *CalibrationDefinition) interface{} {
+	return nil
+}
+func (v *BaseVisitor) VisitCalibration(node *Calibration) interface{} { return nil }
+func (v *BaseVisitor) VisitAssignment(node *Assignment) interface{}   { return nil }
+func (v *BaseVisitor) VisitCalibrationGrammar(node *CalibrationGrammar) interface{} {
+	return nil
+}
+func (v *BaseVisitor) VisitIfStatement(node *IfStatement) interface{}             { return nil }
+func (v *BaseVisitor) VisitForStatement(node *ForStatement) interface{}           { return nil }
+func (v *BaseVisitor) VisitWhileStatement(node *WhileStatement) interface{}       { return nil }
+func (v *BaseVisitor) VisitBarrier(node *Barrier) interface{}                     { return nil }
+func (v *BaseVisitor) VisitReset(node *Reset) interface{}                         { return nil }
+func (v *BaseVisitor) VisitBadStatement(node *BadStatement) interface{}           { return nil }
+func (v *BaseVisitor) VisitRawStatement(node *RawStatement) interface{}           { return nil }
+func (v *BaseVisitor) VisitIdentifier(node *Identifier) interface{}               { return nil }
+func (v *BaseVisitor) VisitIndexedIdentifier(node *IndexedIdentifier) interface{} { return nil }
+func (v *BaseVisitor) VisitRangedIdentifier(node *RangedIdentifier) interface{}   { return nil }
+func (v *BaseVisitor) VisitRangeExpression(node *RangeExpression) interface{}     { return nil }
+func (v *BaseVisitor) VisitMeasureExpression(node *MeasureExpression) interface{} { return nil }
+func (v *BaseVisitor) VisitArrayLiteral(node *ArrayLiteral) interface{}           { return nil }
+func (v *BaseVisitor) VisitIntegerLiteral(node *IntegerLiteral) interface{}       { return nil }
+func (v *BaseVisitor) VisitFloatLiteral(node *FloatLiteral) interface{}           { return nil }
+func (v *BaseVisitor) VisitImaginaryLiteral(node *ImaginaryLiteral) interface{}   { return nil }
+func (v *BaseVisitor) VisitStringLiteral(node *StringLiteral) interface{}         { return nil }
+func (v *BaseVisitor) VisitBooleanLiteral(node *BooleanLiteral) interface{}       { return nil }
+func (v *BaseVisitor) VisitBinaryExpression(node *BinaryExpression) interface{}   { return nil }
+func (v *BaseVisitor) VisitUnaryExpression(node *UnaryExpression) interface{}     { return nil }
+func (v *BaseVisitor) VisitFunctionCall(node *FunctionCall) interface{}           { return nil }
 func (v *BaseVisitor) VisitParenthesizedExpression(node *ParenthesizedExpression) interface{} {
 	return nil
 }
@@ -87,26 +119,52 @@ func Walk(visitor Visitor, node Node) interface{} {
 		return visitor.VisitGateCall(n)
 	case *Measurement:
 		return visitor.VisitMeasurement(n)
+	case *Assignment:
+		return visitor.VisitAssignment(n)
 	case *Include:
 		return visitor.VisitInclude(n)
 	case *GateDefinition:
 		return visitor.VisitGateDefinition(n)
+	case *SubroutineDefinition:
+		return visitor.VisitSubroutineDefinition(n)
 	case *IfStatement:
 		return visitor.VisitIfStatement(n)
 	case *ForStatement:
 		return visitor.VisitForStatement(n)
 	case *WhileStatement:
 		return visitor.VisitWhileStatement(n)
+	case *Barrier:
+		return visitor.VisitBarrier(n)
+	case *Reset:
+		return visitor.VisitReset(n)
+	case *CalibrationDefinition:
+		return visitor.VisitCalibrationDefinition(n)
+	case *Calibration:
+		return visitor.VisitCalibration(n)
+	case *CalibrationGrammar:
+		return visitor.VisitCalibrationGrammar(n)
+	case *BadStatement:
+		return visitor.VisitBadStatement(n)
+	case *RawStatement:
+		return visitor.VisitRawStatement(n)
 	case *Identifier:
 		return visitor.VisitIdentifier(n)
 	case *IndexedIdentifier:
 		return visitor.VisitIndexedIdentifier(n)
 	case *RangedIdentifier:
 		return visitor.VisitRangedIdentifier(n)
+	case *RangeExpression:
+		return visitor.VisitRangeExpression(n)
+	case *MeasureExpression:
+		return visitor.VisitMeasureExpression(n)
+	case *ArrayLiteral:
+		return visitor.VisitArrayLiteral(n)
 	case *IntegerLiteral:
 		return visitor.VisitIntegerLiteral(n)
 	case *FloatLiteral:
 		return visitor.VisitFloatLiteral(n)
+	case *ImaginaryLiteral:
+		return visitor.VisitImaginaryLiteral(n)
 	case *StringLiteral:
 		return visitor.VisitStringLiteral(n)
 	case *BooleanLiteral:
@@ -189,6 +247,27 @@ func (d *DepthFirstVisitor) VisitMeasurement(node *Measurement) interface{} {
 	return result
 }
 
+func (d *DepthFirstVisitor) VisitAssignment(node *Assignment) interface{} {
+	result := d.visitor.VisitAssignment(node)
+	Walk(d, node.Target)
+	Walk(d, node.Value)
+	return result
+}
+
+func (d *DepthFirstVisitor) VisitBarrier(node *Barrier) interface{} {
+	result := d.visitor.VisitBarrier(node)
+	WalkExpressions(d, node.Qubits)
+	return result
+}
+
+func (d *DepthFirstVisitor) VisitReset(node *Reset) interface{} {
+	result := d.visitor.VisitReset(node)
+	if node.Qubit != nil {
+		Walk(d, node.Qubit)
+	}
+	return result
+}
+
 func (d *DepthFirstVisitor) VisitGateDefinition(node *GateDefinition) interface{} {
 	result := d.visitor.VisitGateDefinition(node)
 	for _, param := range node.Parameters {
@@ -201,6 +280,32 @@ func (d *DepthFirstVisitor) VisitGateDefinition(node *GateDefinition) interface{
 	return result
 }
 
+func (d *DepthFirstVisitor) VisitCalibrationDefinition(node *CalibrationDefinition) interface{} {
+	result := d.visitor.VisitCalibrationDefinition(node)
+	for _, param := range node.Parameters {
+		Walk(d, &param)
+	}
+	WalkExpressions(d, node.Qubits)
+	return result
+}
+
+func (d *DepthFirstVisitor) VisitCalibration(node *Calibration) interface{} {
+	return d.visitor.VisitCalibration(node)
+}
+
+func (d *DepthFirstVisitor) VisitCalibrationGrammar(node *CalibrationGrammar) interface{} {
+	return d.visitor.VisitCalibrationGrammar(node)
+}
+
+func (d *DepthFirstVisitor) VisitSubroutineDefinition(node *SubroutineDefinition) interface{} {
+	result := d.visitor.VisitSubroutineDefinition(node)
+	for _, param := range node.Parameters {
+		Walk(d, &param)
+	}
+	WalkStatements(d, node.Body)
+	return result
+}
+
 func (d *DepthFirstVisitor) VisitIfStatement(node *IfStatement) interface{} {
 	result := d.visitor.VisitIfStatement(node)
 	Walk(d, node.Condition)
@@ -226,6 +331,9 @@ func (d *DepthFirstVisitor) VisitWhileStatement(node *WhileStatement) interface{
 func (d *DepthFirstVisitor) VisitIndexedIdentifier(node *IndexedIdentifier) interface{} {
 	result := d.visitor.VisitIndexedIdentifier(node)
 	Walk(d, node.Index)
+	for _, index := range node.Indices {
+		Walk(d, index)
+	}
 	return result
 }
 
@@ -236,6 +344,26 @@ func (d *DepthFirstVisitor) VisitRangedIdentifier(node *RangedIdentifier) interf
 	return result
 }
 
+func (d *DepthFirstVisitor) VisitRangeExpression(node *RangeExpression) interface{} {
+	result := d.visitor.VisitRangeExpression(node)
+	Walk(d, node.Start)
+	Walk(d, node.Step)
+	Walk(d, node.Stop)
+	return result
+}
+
+func (d *DepthFirstVisitor) VisitMeasureExpression(node *MeasureExpression) interface{} {
+	result := d.visitor.VisitMeasureExpression(node)
+	Walk(d, node.Qubit)
+	return result
+}
+
+func (d *DepthFirstVisitor) VisitArrayLiteral(node *ArrayLiteral) interface{} {
+	result := d.visitor.VisitArrayLiteral(node)
+	WalkExpressions(d, node.Elements)
+	return result
+}
+
 func (d *DepthFirstVisitor) VisitBinaryExpression(node *BinaryExpression) interface{} {
 	result := d.visitor.VisitBinaryExpression(node)
 	Walk(d, node.Left)
@@ -275,14 +403,30 @@ func (d *DepthFirstVisitor) VisitComment(node *Comment) interface{} {
 	return d.visitor.VisitComment(node)
 }
 func (d *DepthFirstVisitor) VisitQuantumDeclaration(node *QuantumDeclaration) interface{} {
-	return d.visitor.VisitQuantumDeclaration(node)
+	result := d.visitor.VisitQuantumDeclaration(node)
+	Walk(d, node.Size)
+	return result
 }
 func (d *DepthFirstVisitor) VisitClassicalDeclaration(node *ClassicalDeclaration) interface{} {
-	return d.visitor.VisitClassicalDeclaration(node)
+	result := d.visitor.VisitClassicalDeclaration(node)
+	Walk(d, node.Size)
+	if node.Array != nil {
+		for _, dim := range node.Array.Dimensions {
+			Walk(d, dim)
+		}
+	}
+	Walk(d, node.Initializer)
+	return result
 }
 func (d *DepthFirstVisitor) VisitInclude(node *Include) interface{} {
 	return d.visitor.VisitInclude(node)
 }
+func (d *DepthFirstVisitor) VisitBadStatement(node *BadStatement) interface{} {
+	return d.visitor.VisitBadStatement(node)
+}
+func (d *DepthFirstVisitor) VisitRawStatement(node *RawStatement) interface{} {
+	return d.visitor.VisitRawStatement(node)
+}
 func (d *DepthFirstVisitor) VisitIdentifier(node *Identifier) interface{} {
 	return d.visitor.VisitIdentifier(node)
 }
@@ -292,6 +436,9 @@ func (d *DepthFirstVisitor) VisitIntegerLiteral(node *IntegerLiteral) interface{
 func (d *DepthFirstVisitor) VisitFloatLiteral(node *FloatLiteral) interface{} {
 	return d.visitor.VisitFloatLiteral(node)
 }
+func (d *DepthFirstVisitor) VisitImaginaryLiteral(node *ImaginaryLiteral) interface{} {
+	return d.visitor.VisitImaginaryLiteral(node)
+}
 func (d *DepthFirstVisitor) VisitStringLiteral(node *StringLiteral) interface{} {
 	return d.visitor.VisitStringLiteral(node)
 }
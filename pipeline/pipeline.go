@@ -0,0 +1,220 @@
+// Package pipeline runs chains of typed stages (parse, analyze, transform,
+// print or export) over sets of files, concurrently and with per-file
+// error aggregation.
+//
+// A pipeline is a single Stage built by composing smaller ones:
+//
+//	outline := pipeline.Then(pipeline.Parse(parser.NewParser()),
+//		pipeline.Map(func(r *parser.ParseFileResult) []analysis.Symbol {
+//			return analysis.Outline(r.Program)
+//		}))
+//	results := pipeline.Run(ctx, files, outline, nil)
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// Stage turns the input for one file into an output. The file name is
+// passed along so stages can report and cache per file.
+type Stage[In, Out any] func(ctx context.Context, file string, in In) (Out, error)
+
+// Then chains two stages. The second does not run if the first fails.
+func Then[A, B, C any](first Stage[A, B], second Stage[B, C]) Stage[A, C] {
+	return func(ctx context.Context, file string, in A) (C, error) {
+		mid, err := first(ctx, file, in)
+		if err != nil {
+			var zero C
+			return zero, err
+		}
+		return second(ctx, file, mid)
+	}
+}
+
+// Map lifts a function that cannot fail into a stage
+func Map[In, Out any](f func(In) Out) Stage[In, Out] {
+	return func(_ context.Context, _ string, in In) (Out, error) {
+		return f(in), nil
+	}
+}
+
+// Parse reads and parses each file. A file with error diagnostics fails
+// the stage with those diagnostics as its error.
+func Parse(p *parser.Parser) Stage[string, *parser.ParseFileResult] {
+	return func(ctx context.Context, file string, _ string) (*parser.ParseFileResult, error) {
+		result := p.ParseFiles(ctx, []string{file}, nil)[0]
+		return result, result.Err()
+	}
+}
+
+// Print renders each parsed program in canonical form
+func Print() Stage[*parser.ParseFileResult, string] {
+	return Map(func(result *parser.ParseFileResult) string {
+		return printer.Print(result.Program)
+	})
+}
+
+// Cached memoizes a stage that starts from the file name by the file's
+// content, so a file that has not changed since the last run is not
+// processed again. Failed runs are not cached. The returned stage is safe
+// for concurrent use and can be shared across Run calls.
+func Cached[Out any](stage Stage[string, Out]) Stage[string, Out] {
+	var (
+		mu    sync.Mutex
+		cache = make(map[string]Out)
+	)
+	return func(ctx context.Context, file string, in string) (Out, error) {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return stage(ctx, file, in)
+		}
+		key := fmt.Sprintf("%s\x00%x", file, sha256.Sum256(content))
+
+		mu.Lock()
+		out, ok := cache[key]
+		mu.Unlock()
+		if ok {
+			return out, nil
+		}
+
+		out, err = stage(ctx, file, in)
+		if err == nil {
+			mu.Lock()
+			cache[key] = out
+			mu.Unlock()
+		}
+		return out, err
+	}
+}
+
+// Options configures Run
+type Options struct {
+	// Concurrency limits how many files are processed at once.
+	// Zero means runtime.GOMAXPROCS(0).
+	Concurrency int
+
+	// FailFast stops the run at the first failed file: files not yet
+	// started fail with ErrSkipped, while files already running finish.
+	// By default the run keeps going and processes every file.
+	FailFast bool
+}
+
+// ErrSkipped is the error of a file a fail-fast run did not process
+// because an earlier file failed
+var ErrSkipped = errors.New("skipped after an earlier failure")
+
+// FileResult is the outcome of a pipeline for one file
+type FileResult[Out any] struct {
+	File   string
+	Output Out
+	Err    error
+}
+
+// Results holds one FileResult per file, in the order the files were given
+type Results[Out any] []FileResult[Out]
+
+// Err joins the errors of every failed file, each prefixed with its file
+// name, or returns nil if all files succeeded. Skipped files are not
+// failures.
+func (r Results[Out]) Err() error {
+	var errs []error
+	for _, fr := range r {
+		if fr.Err != nil && !errors.Is(fr.Err, ErrSkipped) {
+			errs = append(errs, fmt.Errorf("%s: %w", fr.File, fr.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Failed returns the results of the files whose pipeline failed
+func (r Results[Out]) Failed() Results[Out] {
+	var failed Results[Out]
+	for _, fr := range r {
+		if fr.Err != nil && !errors.Is(fr.Err, ErrSkipped) {
+			failed = append(failed, fr)
+		}
+	}
+	return failed
+}
+
+// Skipped returns the results of the files a fail-fast run did not
+// process
+func (r Results[Out]) Skipped() Results[Out] {
+	var skipped Results[Out]
+	for _, fr := range r {
+		if errors.Is(fr.Err, ErrSkipped) {
+			skipped = append(skipped, fr)
+		}
+	}
+	return skipped
+}
+
+// Summary describes the run in one line, in the same form whether it
+// kept going or failed fast:
+//
+//	20 files: 15 ok, 1 failed, 4 skipped
+func (r Results[Out]) Summary() string {
+	failed, skipped := len(r.Failed()), len(r.Skipped())
+	files := "files"
+	if len(r) == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf("%d %s: %d ok, %d failed, %d skipped", len(r), files, len(r)-failed-skipped, failed, skipped)
+}
+
+// Run runs stage over every file concurrently. Each stage receives the
+// file name as its input. Files not started before ctx is canceled fail
+// with the context error, and with opts.FailFast files not started after
+// a failure fail with ErrSkipped.
+func Run[Out any](ctx context.Context, files []string, stage Stage[string, Out], opts *Options) Results[Out] {
+	if opts == nil {
+		opts = &Options{}
+	}
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	results := make(Results[Out], len(files))
+	var failed atomic.Bool
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(files)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i].File = files[i]
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				if failed.Load() {
+					results[i].Err = ErrSkipped
+					continue
+				}
+				results[i].Output, results[i].Err = stage(ctx, files[i], files[i])
+				if opts.FailFast && results[i].Err != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func writeFiles(t *testing.T, files map[string]string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestRun(t *testing.T) {
+	paths := writeFiles(t, map[string]string{
+		"good.qasm": "OPENQASM 3.0;\nqubit[2]   q;\nh q[0];\n",
+	})
+	paths = append(paths, filepath.Join(t.TempDir(), "missing.qasm"))
+
+	results := Run(context.Background(), paths, Then(Parse(parser.NewParser()), Print()), &Options{Concurrency: 2})
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Err != nil {
+		t.Fatalf("unexpected error: %v", results[0].Err)
+	}
+	if want := "OPENQASM 3.0;\nqubit[2] q;\nh q[0];\n"; results[0].Output != want {
+		t.Errorf("output = %q, want %q", results[0].Output, want)
+	}
+
+	failed := results.Failed()
+	if len(failed) != 1 || failed[0].File != paths[1] {
+		t.Fatalf("expected the missing file to fail, got %+v", failed)
+	}
+	if err := results.Err(); err == nil || !strings.Contains(err.Error(), "missing.qasm") {
+		t.Errorf("aggregated error should name the failed file, got %v", err)
+	}
+	var diags parser.ParseErrors
+	if !errors.As(results.Err(), &diags) {
+		t.Error("aggregated error should wrap the parse diagnostics")
+	}
+}
+
+func TestCached(t *testing.T) {
+	paths := writeFiles(t, map[string]string{"a.qasm": "OPENQASM 3.0;\nqubit q;\n"})
+
+	var calls atomic.Int32
+	counting := func(ctx context.Context, file string, in string) (int, error) {
+		calls.Add(1)
+		return len(in), nil
+	}
+	stage := Cached(counting)
+
+	for i := 0; i < 3; i++ {
+		if err := Run(context.Background(), paths, stage, nil).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("stage ran %d times, want 1", calls.Load())
+	}
+
+	if err := os.WriteFile(paths[0], []byte("OPENQASM 3.0;\nqubit[2] q;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	Run(context.Background(), paths, stage, nil)
+	if calls.Load() != 2 {
+		t.Errorf("changed file was not reprocessed")
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := Run(ctx, []string{"a.qasm"}, Map(func(s string) string { return s }), nil)
+	if !errors.Is(results[0].Err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", results[0].Err)
+	}
+}
+
+func TestRunFailFast(t *testing.T) {
+	files := []string{"a", "bad", "c", "d"}
+	stage := func(_ context.Context, file string, _ string) (string, error) {
+		if file == "bad" {
+			return "", errors.New("broken")
+		}
+		return file, nil
+	}
+
+	results := Run(context.Background(), files, stage, &Options{Concurrency: 1})
+	if got := results.Summary(); got != "4 files: 3 ok, 1 failed, 0 skipped" {
+		t.Errorf("keep-going summary %q", got)
+	}
+
+	results = Run(context.Background(), files, stage, &Options{Concurrency: 1, FailFast: true})
+	if got := results.Summary(); got != "4 files: 1 ok, 1 failed, 2 skipped" {
+		t.Errorf("fail-fast summary %q", got)
+	}
+	if skipped := results.Skipped(); len(skipped) != 2 || skipped[0].File != "c" {
+		t.Errorf("expected c and d to be skipped, got %+v", skipped)
+	}
+	if err := results.Err(); err == nil || strings.Contains(err.Error(), "skipped") {
+		t.Errorf("skipped files should not be reported as failures, got %v", err)
+	}
+}
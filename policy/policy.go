@@ -0,0 +1,373 @@
+// Package policy checks programs against the limits a service running
+// them sets, such as the number of qubits of its device, the depth it
+// can run before decoherence and the gates it refuses:
+//
+//	violations := policy.Check(program, policy.MaxQubits(127), policy.MaxDepth(10000), policy.ForbidGates("ccx"))
+//
+// Policies can also be read from a file with Load. Unlike package
+// sanitize, which guards against constructs that are unsafe to accept at
+// all, policies describe what a backend can run.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Violation is one place a program breaks a rule
+type Violation struct {
+	Rule     string          `json:"rule"`
+	Message  string          `json:"message"`
+	Position parser.Position `json:"position"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", v.Position.Line, v.Position.Column, v.Rule, v.Message)
+}
+
+// Rule is one requirement of a policy
+type Rule interface {
+	// Name identifies the rule in violations, such as max-qubits
+	Name() string
+
+	// Check returns the violations of the rule in program
+	Check(program *parser.Program) []Violation
+}
+
+// Check returns the violations of every rule in program, in source order
+func Check(program *parser.Program, rules ...Rule) []Violation {
+	if program == nil {
+		return nil
+	}
+	var violations []Violation
+	for _, rule := range rules {
+		violations = append(violations, rule.Check(program)...)
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Position.Offset < violations[j].Position.Offset
+	})
+	return violations
+}
+
+// MaxQubits limits a program to n qubits: those its declarations add up
+// to, and hardware qubits $0 to $n-1. Declarations must have constant
+// sizes. Statements the AST keeps as text are scanned for hardware
+// qubits, and are violations if they declare qubits.
+func MaxQubits(n int) Rule {
+	return maxQubits(n)
+}
+
+type maxQubits int
+
+func (maxQubits) Name() string { return "max-qubits" }
+
+func (m maxQubits) Check(program *parser.Program) []Violation {
+	limit := int64(m)
+	consts, _ := analysis.EvaluateConstants(program)
+	found := collect(program)
+	violations := found.unchecked(m)
+	var total int64
+	for _, decl := range found.declarations {
+		size := int64(1)
+		if decl.Size != nil {
+			var ok bool
+			if size, ok = consts.Int(decl.Size); !ok {
+				violations = append(violations, Violation{
+					Rule:     m.Name(),
+					Message:  fmt.Sprintf("size of %s is not constant", decl.Identifier),
+					Position: decl.Pos(),
+				})
+				continue
+			}
+		}
+		if total <= limit && total+size > limit {
+			violations = append(violations, Violation{
+				Rule:     m.Name(),
+				Message:  fmt.Sprintf("%s brings the program to %d qubits, more than the limit of %d", decl.Identifier, total+size, limit),
+				Position: decl.Pos(),
+			})
+		}
+		total += size
+	}
+
+	seen := make(map[string]bool)
+	hardware := func(name string, pos parser.Position) {
+		n, err := strconv.ParseInt(strings.TrimPrefix(name, "$"), 10, 64)
+		if err != nil || n < limit || seen[name] {
+			return
+		}
+		seen[name] = true
+		violations = append(violations, Violation{
+			Rule:     m.Name(),
+			Message:  fmt.Sprintf("hardware qubit %s is beyond the limit of %d qubits", name, limit),
+			Position: pos,
+		})
+	}
+	for _, id := range found.hardware {
+		hardware(id.Name, id.Pos())
+	}
+	for _, raw := range found.raw {
+		declares := false
+		for _, tok := range rawTokens(raw) {
+			switch tok.Type {
+			case "HardwareQubit":
+				hardware(tok.Text, tok.Position)
+			case "QUBIT", "QREG":
+				declares = true
+			}
+		}
+		if declares {
+			violations = append(violations, Violation{
+				Rule:     m.Name(),
+				Message:  fmt.Sprintf("%s statement declares qubits the limit cannot count", raw.Keyword),
+				Position: raw.Pos(),
+			})
+		}
+	}
+	return violations
+}
+
+// collector gathers what the rules check, at any depth
+type collector struct {
+	parser.BaseVisitor
+	declarations []*parser.QuantumDeclaration
+	hardware     []*parser.Identifier
+	// raw and bad hold the statements kept as text, whose tokens are all
+	// the rules can check
+	raw []*parser.RawStatement
+	bad []*parser.BadStatement
+}
+
+func (c *collector) VisitQuantumDeclaration(node *parser.QuantumDeclaration) interface{} {
+	c.declarations = append(c.declarations, node)
+	return nil
+}
+
+func (c *collector) VisitIdentifier(node *parser.Identifier) interface{} {
+	if strings.HasPrefix(node.Name, "$") {
+		c.hardware = append(c.hardware, node)
+	}
+	return nil
+}
+
+func (c *collector) VisitRawStatement(node *parser.RawStatement) interface{} {
+	c.raw = append(c.raw, node)
+	return nil
+}
+
+func (c *collector) VisitBadStatement(node *parser.BadStatement) interface{} {
+	c.bad = append(c.bad, node)
+	return nil
+}
+
+func collect(program *parser.Program) *collector {
+	c := &collector{}
+	parser.Walk(parser.NewDepthFirstVisitor(c), program)
+	return c
+}
+
+// unchecked reports the statements with syntax errors, which no rule
+// can check
+func (c *collector) unchecked(rule Rule) []Violation {
+	var violations []Violation
+	for _, bad := range c.bad {
+		violations = append(violations, Violation{
+			Rule:     rule.Name(),
+			Message:  "statement with syntax errors cannot be checked",
+			Position: bad.Pos(),
+		})
+	}
+	return violations
+}
+
+// rawTokens lexes the text of a statement the AST has no node for, placing
+// the tokens where the statement is in the program
+func rawTokens(raw *parser.RawStatement) []parser.Token {
+	tokens := parser.NewParser().ParseWithErrors(raw.Text).Tokens()
+	for i := range tokens {
+		pos := &tokens[i].Position
+		if pos.Line == 1 {
+			pos.Column += raw.Pos().Column - 1
+		}
+		pos.Line += raw.Pos().Line - 1
+		pos.Offset += raw.Pos().Offset
+	}
+	return tokens
+}
+
+// MaxDepth limits the depth of a program to n moments, as
+// analysis.Moments lays it out: gates are not expanded and loop bodies
+// are counted once. The violation is reported at the first operation of
+// the moment past the limit. Statements the AST keeps as text that hold
+// quantum operations, such as box, are violations since they cannot be
+// laid out.
+func MaxDepth(n int) Rule {
+	return maxDepth(n)
+}
+
+type maxDepth int
+
+func (maxDepth) Name() string { return "max-depth" }
+
+func (m maxDepth) Check(program *parser.Program) []Violation {
+	found := collect(program)
+	violations := found.unchecked(m)
+	for _, raw := range found.raw {
+		if operates(raw) {
+			violations = append(violations, Violation{
+				Rule:     m.Name(),
+				Message:  fmt.Sprintf("%s statement cannot be checked against the depth limit", raw.Keyword),
+				Position: raw.Pos(),
+			})
+		}
+	}
+
+	moments := analysis.Moments(program)
+	if len(moments) <= int(m) || len(moments[m].Operations) == 0 {
+		return violations
+	}
+	return append(violations, Violation{
+		Rule:     m.Name(),
+		Message:  fmt.Sprintf("circuit depth %d is more than the limit of %d", len(moments), int(m)),
+		Position: moments[m].Operations[0].Position,
+	})
+}
+
+// operates reports whether a statement kept as text may hold quantum
+// operations: it has a body, or uses qubits
+func operates(raw *parser.RawStatement) bool {
+	for _, tok := range rawTokens(raw) {
+		switch tok.Type {
+		case "LBRACE", "BOX", "DELAY", "MEASURE", "RESET", "BARRIER", "HardwareQubit":
+			return true
+		}
+	}
+	return false
+}
+
+// ForbidGates forbids calls to the named gates, wherever they are made,
+// including in the bodies of other gates. In statements the AST keeps as
+// text, any use of a forbidden name is a violation.
+func ForbidGates(names ...string) Rule {
+	f := forbidGates{}
+	for _, name := range names {
+		f[name] = true
+	}
+	return f
+}
+
+type forbidGates map[string]bool
+
+func (forbidGates) Name() string { return "forbid-gates" }
+
+func (f forbidGates) Check(program *parser.Program) []Violation {
+	c := &gateCalls{forbidden: f}
+	parser.Walk(parser.NewDepthFirstVisitor(c), program)
+	return c.violations
+}
+
+// gateCalls records calls to forbidden gates
+type gateCalls struct {
+	parser.BaseVisitor
+	forbidden  forbidGates
+	violations []Violation
+}
+
+func (c *gateCalls) VisitGateCall(node *parser.GateCall) interface{} {
+	if c.forbidden[node.Name] {
+		c.violations = append(c.violations, Violation{
+			Rule:     c.forbidden.Name(),
+			Message:  fmt.Sprintf("gate %s is not allowed", node.Name),
+			Position: node.Pos(),
+		})
+	}
+	return nil
+}
+
+func (c *gateCalls) VisitRawStatement(node *parser.RawStatement) interface{} {
+	for _, tok := range rawTokens(node) {
+		if tok.Type == "Identifier" && c.forbidden[tok.Text] {
+			c.violations = append(c.violations, Violation{
+				Rule:     c.forbidden.Name(),
+				Message:  fmt.Sprintf("gate %s is not allowed", tok.Text),
+				Position: tok.Position,
+			})
+		}
+	}
+	return nil
+}
+
+func (c *gateCalls) VisitBadStatement(node *parser.BadStatement) interface{} {
+	c.violations = append(c.violations, Violation{
+		Rule:     c.forbidden.Name(),
+		Message:  "statement with syntax errors cannot be checked",
+		Position: node.Pos(),
+	})
+	return nil
+}
+
+// File is a policy as written in a policy file:
+//
+//	{"max_qubits": 127, "max_depth": 10000, "forbid_gates": ["ccx"]}
+//
+// Limits of zero are not checked.
+type File struct {
+	MaxQubits   int      `json:"max_qubits,omitempty"`
+	MaxDepth    int      `json:"max_depth,omitempty"`
+	ForbidGates []string `json:"forbid_gates,omitempty"`
+}
+
+// Rules returns the rules the file sets
+func (f *File) Rules() []Rule {
+	var rules []Rule
+	if f.MaxQubits > 0 {
+		rules = append(rules, MaxQubits(f.MaxQubits))
+	}
+	if f.MaxDepth > 0 {
+		rules = append(rules, MaxDepth(f.MaxDepth))
+	}
+	if len(f.ForbidGates) > 0 {
+		rules = append(rules, ForbidGates(f.ForbidGates...))
+	}
+	return rules
+}
+
+// Load reads the policy file at path
+func Load(path string) ([]Rule, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		return nil, fmt.Errorf("%s: YAML policies are not supported; write the policy as JSON", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Parse decodes a JSON policy. Unknown fields are errors, so that a
+// misspelled limit is not silently left unchecked.
+func Parse(data []byte) ([]Rule, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	if f.MaxQubits < 0 || f.MaxDepth < 0 {
+		return nil, fmt.Errorf("limits cannot be negative")
+	}
+	return f.Rules(), nil
+}
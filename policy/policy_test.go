@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const source = `OPENQASM 3.0;
+include "stdgates.inc";
+const int n = 100;
+qubit[n] q;
+qubit[50] r;
+gate toffoli a, b, c {
+  ccx a, b, c;
+}
+h q[0];
+cx q[0], q[1];
+cx q[1], q[2];
+toffoli q[0], q[1], q[2];
+x $130;
+`
+
+func check(t *testing.T, rules ...Rule) []string {
+	t.Helper()
+	program, err := parser.NewParser().ParseString(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range Check(program, rules...) {
+		got = append(got, v.String())
+	}
+	return got
+}
+
+func TestCheck(t *testing.T) {
+	got := check(t, MaxQubits(127), MaxDepth(3), ForbidGates("ccx"))
+	want := []string{
+		"5:1: max-qubits: r brings the program to 150 qubits, more than the limit of 127",
+		"7:3: forbid-gates: gate ccx is not allowed",
+		"12:1: max-depth: circuit depth 4 is more than the limit of 3",
+		"13:3: max-qubits: hardware qubit $130 is beyond the limit of 127 qubits",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Check() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if got := check(t, MaxQubits(200), MaxDepth(4), ForbidGates("ccz")); len(got) != 0 {
+		t.Errorf("Check() within limits = %v", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(path, []byte(`{"max_qubits": 127, "forbid_gates": ["ccx"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := check(t, rules...); len(got) != 3 {
+		t.Errorf("Check() with loaded rules = %v", got)
+	}
+
+	if _, err := Parse([]byte(`{"max_qbits": 127}`)); err == nil {
+		t.Error("Parse() accepted a misspelled limit")
+	}
+	if _, err := Load(filepath.Join(dir, "policy.yaml")); err == nil || !strings.Contains(err.Error(), "JSON") {
+		t.Errorf("Load(yaml) error = %v", err)
+	}
+}
+
+func TestCheckAnnotated(t *testing.T) {
+	program, err := parser.NewParser().ParseString("OPENQASM 3.0;\nqubit[3] q;\n@fast\nccx q[0], q[1], q[2];\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := Check(program, ForbidGates("ccx"))
+	if len(v) != 1 || v[0].String() != "4:1: forbid-gates: gate ccx is not allowed" {
+		t.Errorf("Check() of an annotated gate call = %v", v)
+	}
+}
+
+func TestCheckRawStatements(t *testing.T) {
+	src := "OPENQASM 3.0;\ninput float theta;\nqubit[3] q;\nbox {\n  ccx q[0], q[1], q[2];\n  x $7;\n}\nif (true) {\n  box {\n    qubit r;\n  }\n}\n"
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range Check(program, MaxQubits(5), MaxDepth(100), ForbidGates("ccx")) {
+		got = append(got, v.String())
+	}
+	want := []string{
+		"4:1: max-depth: box statement cannot be checked against the depth limit",
+		"5:3: forbid-gates: gate ccx is not allowed",
+		"6:5: max-qubits: hardware qubit $7 is beyond the limit of 5 qubits",
+		"9:3: max-qubits: box statement declares qubits the limit cannot count",
+		"9:3: max-depth: box statement cannot be checked against the depth limit",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Check() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
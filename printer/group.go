@@ -0,0 +1,194 @@
+package printer
+
+import (
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Sections of a grouped program, in the order GroupDeclarations puts
+// them
+const (
+	sectionInclude = iota
+	sectionConstant
+	sectionQuantum
+	sectionClassical
+	sectionDefinition
+	sectionBody
+)
+
+// GroupDeclarations returns the edit that gathers the top-level
+// declarations into sections after the version header: includes,
+// constants, quantum declarations, classical declarations, then gate and
+// subroutine definitions, each in source order, separated by blank
+// lines. The rest of the program follows in its original order.
+// Constants come first because declarations may be sized by them.
+//
+// Statements move as written, with the comments attached to them: those
+// on the lines directly above and one after the statement on its line.
+// A classical declaration moves only if its initializer is made of
+// literals and constants, since anything else, such as a measurement,
+// may depend on the statements before it. It returns nil if the program
+// is already grouped, or if a top-level statement shares a line with
+// another one.
+func GroupDeclarations(result *parser.ParseResult) []TextEdit {
+	if result == nil || result.Program == nil || len(result.Program.Statements) == 0 {
+		return nil
+	}
+	g := &grouper{source: []rune(result.Source()), constants: make(map[string]bool)}
+	for _, t := range result.Trivia() {
+		if t.Kind == parser.TriviaLineComment || t.Kind == parser.TriviaBlockComment {
+			g.comments = append(g.comments, t)
+		}
+	}
+
+	var chunks []chunk
+	for _, stmt := range result.Program.Statements {
+		c, ok := g.chunk(stmt)
+		if !ok || len(chunks) > 0 && c.start.Offset < chunks[len(chunks)-1].end.Offset {
+			return nil
+		}
+		chunks = append(chunks, c)
+	}
+
+	sections := make([][]string, sectionBody)
+	var body strings.Builder
+	last := chunks[0].start.Offset
+	for _, c := range chunks {
+		body.WriteString(string(g.source[last:c.start.Offset]))
+		last = c.end.Offset
+		text := string(g.source[c.start.Offset:c.end.Offset])
+		if c.section == sectionBody {
+			body.WriteString(text)
+		} else {
+			sections[c.section] = append(sections[c.section], text)
+		}
+	}
+
+	var parts []string
+	for _, texts := range sections {
+		if len(texts) > 0 {
+			parts = append(parts, strings.Join(texts, ""))
+		}
+	}
+	if rest := strings.Trim(collapseBlankLines(body.String()), "\n"); rest != "" {
+		parts = append(parts, rest+"\n")
+	}
+	grouped := strings.Join(parts, "\n")
+
+	start, end := chunks[0].start, chunks[len(chunks)-1].end
+	if grouped == string(g.source[start.Offset:end.Offset]) {
+		return nil
+	}
+	return []TextEdit{{Start: start, End: end, NewText: grouped}}
+}
+
+// chunk is the source of a top-level statement with its comments, from
+// the start of its first line to the start of the line after it
+type chunk struct {
+	start, end parser.Position
+	section    int
+}
+
+type grouper struct {
+	source    []rune
+	comments  []parser.Trivia
+	constants map[string]bool
+}
+
+// chunk returns the chunk of stmt, or false if stmt shares a line with
+// something other than a comment
+func (g *grouper) chunk(stmt parser.Statement) (chunk, bool) {
+	start, end := lineStart(stmt.Pos()), nextLine(g.source, stmt.End())
+	if strings.TrimSpace(string(g.source[start.Offset:stmt.Pos().Offset])) != "" {
+		return chunk{}, false
+	}
+	trailing := strings.TrimSpace(string(g.source[stmt.End().Offset:end.Offset]))
+	if trailing != "" && !strings.HasPrefix(trailing, "//") &&
+		!(strings.HasPrefix(trailing, "/*") && strings.HasSuffix(trailing, "*/")) {
+		return chunk{}, false
+	}
+	// Take in the comments that fill the lines directly above
+	for i := len(g.comments) - 1; i >= 0; i-- {
+		c := g.comments[i]
+		if c.EndPos.Offset > start.Offset {
+			continue
+		}
+		if !g.ownsLines(c) || nextLine(g.source, c.EndPos).Offset != start.Offset {
+			break
+		}
+		start = lineStart(c.Position)
+	}
+	return chunk{start: start, end: end, section: g.section(stmt)}, true
+}
+
+// ownsLines reports whether nothing but c is on the lines it spans
+func (g *grouper) ownsLines(c parser.Trivia) bool {
+	before := g.source[lineStart(c.Position).Offset:c.Position.Offset]
+	after := g.source[c.EndPos.Offset:nextLine(g.source, c.EndPos).Offset]
+	return strings.TrimSpace(string(before)) == "" && strings.TrimSpace(string(after)) == ""
+}
+
+// section returns the section stmt belongs in
+func (g *grouper) section(stmt parser.Statement) int {
+	switch s := stmt.(type) {
+	case *parser.Include:
+		return sectionInclude
+	case *parser.QuantumDeclaration:
+		return sectionQuantum
+	case *parser.ClassicalDeclaration:
+		if s.Initializer != nil && !g.constant(s.Initializer) {
+			return sectionBody
+		}
+		if s.Const {
+			g.constants[s.Identifier] = true
+			return sectionConstant
+		}
+		return sectionClassical
+	case *parser.GateDefinition, *parser.SubroutineDefinition:
+		return sectionDefinition
+	}
+	return sectionBody
+}
+
+// constant reports whether expr is made of literals and constants
+// declared before it
+func (g *grouper) constant(expr parser.Expression) bool {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral, *parser.FloatLiteral, *parser.ImaginaryLiteral, *parser.BooleanLiteral, *parser.StringLiteral:
+		return true
+	case *parser.Identifier:
+		_, builtin := constants[e.Name]
+		return builtin || g.constants[e.Name]
+	case *parser.ParenthesizedExpression:
+		return g.constant(e.Expression)
+	case *parser.UnaryExpression:
+		return g.constant(e.Operand)
+	case *parser.BinaryExpression:
+		return g.constant(e.Left) && g.constant(e.Right)
+	case *parser.ArrayLiteral:
+		for _, el := range e.Elements {
+			if !g.constant(el) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// collapseBlankLines reduces runs of blank lines to one
+func collapseBlankLines(text string) string {
+	lines := strings.SplitAfter(text, "\n")
+	var sb strings.Builder
+	blank := false
+	for _, line := range lines {
+		isBlank := strings.TrimSpace(line) == "" && strings.HasSuffix(line, "\n")
+		if isBlank && blank {
+			continue
+		}
+		blank = isBlank
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
@@ -0,0 +1,63 @@
+package printer
+
+import "testing"
+
+func TestGroupDeclarations(t *testing.T) {
+	src := `OPENQASM 3.0;
+// Prepare a Bell pair
+qubit[2] q;
+include "stdgates.inc";
+
+/* entangler,
+   reused below */
+gate bell a, b {
+  h a;
+  cx a, b;
+}
+bell q[0], q[1];  // entangle
+bit[2] c;
+const int n = 2;
+int shots = n * 100;
+bit first = measure q[0];
+reset q[1];
+c = measure q;
+`
+	want := `OPENQASM 3.0;
+include "stdgates.inc";
+
+const int n = 2;
+
+// Prepare a Bell pair
+qubit[2] q;
+
+bit[2] c;
+int shots = n * 100;
+
+/* entangler,
+   reused below */
+gate bell a, b {
+  h a;
+  cx a, b;
+}
+
+bell q[0], q[1];  // entangle
+bit first = measure q[0];
+reset q[1];
+c = measure q;
+`
+	edits := GroupDeclarations(parse(t, src))
+	got := apply(t, src, edits)
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if again := GroupDeclarations(parse(t, got)); again != nil {
+		t.Errorf("grouped program changed again: %+v", again)
+	}
+}
+
+func TestGroupDeclarationsSharedLine(t *testing.T) {
+	src := "OPENQASM 3.0;\nh q; qubit q;\n"
+	if edits := GroupDeclarations(parse(t, src)); edits != nil {
+		t.Errorf("expected no edits, got %+v", edits)
+	}
+}
@@ -0,0 +1,123 @@
+package printer
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/stdlib"
+)
+
+// OrganizeIncludes returns the edits that gather the top-level include
+// statements directly after the version header, sorted and without
+// duplicates. Standard includes (see package stdlib) none of whose gates
+// the program calls are removed; other includes are always kept since
+// their contents are unknown. It returns nil if the includes are already
+// organized.
+func OrganizeIncludes(result *parser.ParseResult) []TextEdit {
+	if result == nil || result.Program == nil {
+		return nil
+	}
+	program := result.Program
+	source := []rune(result.Source())
+
+	var includes []*parser.Include
+	for _, stmt := range program.Statements {
+		if inc, ok := stmt.(*parser.Include); ok {
+			includes = append(includes, inc)
+		}
+	}
+	if len(includes) == 0 {
+		return nil
+	}
+
+	used := calledGates(program)
+	seen := make(map[string]bool)
+	var paths []string
+	for _, inc := range includes {
+		if seen[inc.Path] || (stdlib.IsStandard(inc.Path) && !providesAny(inc.Path, used)) {
+			continue
+		}
+		seen[inc.Path] = true
+		paths = append(paths, inc.Path)
+	}
+	sort.Strings(paths)
+
+	var block strings.Builder
+	for _, path := range paths {
+		block.WriteString("include " + strconv.Quote(path) + ";\n")
+	}
+
+	// The organized block goes at the start of the line after the header
+	insertAt := parser.Position{Line: 1, Column: 1}
+	if program.Version != nil {
+		insertAt = nextLine(source, program.Version.End())
+	}
+	edits := []TextEdit{{Start: insertAt, End: insertAt, NewText: block.String()}}
+	for _, inc := range includes {
+		start, end := inc.Pos(), inc.End()
+		if line := lineStart(start); strings.TrimSpace(string(source[line.Offset:start.Offset])) == "" {
+			next := nextLine(source, end)
+			if strings.TrimSpace(string(source[end.Offset:next.Offset])) == "" {
+				// The include is alone on its line, so remove the line
+				start, end = line, next
+			}
+		}
+		edits = append(edits, TextEdit{Start: start, End: end})
+	}
+
+	if out, err := ApplyEdits(string(source), edits); err != nil || out == string(source) {
+		return nil
+	}
+	return edits
+}
+
+// calledGates returns the names of gates the program calls but does not
+// define itself
+func calledGates(program *parser.Program) map[string]bool {
+	called := make(map[string]bool)
+	defined := make(map[string]bool)
+	var visit func(statements []parser.Statement)
+	visit = func(statements []parser.Statement) {
+		for _, stmt := range statements {
+			switch s := stmt.(type) {
+			case *parser.GateCall:
+				called[s.Name] = true
+			case *parser.GateDefinition:
+				defined[s.Name] = true
+			}
+			if bodies, ok := blockBodies(stmt); ok {
+				for _, body := range bodies {
+					visit(body)
+				}
+			}
+		}
+	}
+	visit(program.Statements)
+
+	for name := range defined {
+		delete(called, name)
+	}
+	return called
+}
+
+func providesAny(path string, gates map[string]bool) bool {
+	for gate := range gates {
+		if stdlib.Defines(path, gate) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextLine returns the position at the start of the line following pos,
+// or the end of the source if pos is on the last line
+func nextLine(source []rune, pos parser.Position) parser.Position {
+	for i := pos.Offset; i < len(source); i++ {
+		if source[i] == '\n' {
+			return parser.Position{Line: pos.Line + 1, Column: 1, Offset: i + 1}
+		}
+	}
+	return parser.Position{Line: pos.Line, Column: pos.Column + len(source) - pos.Offset, Offset: len(source)}
+}
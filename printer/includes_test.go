@@ -0,0 +1,60 @@
+package printer
+
+import "testing"
+
+func TestOrganizeIncludes(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "dedupe, sort and move to top",
+			src: `OPENQASM 3.0;
+include "stdgates.inc";
+qubit q;
+include "custom.inc";
+include "stdgates.inc";
+h q;
+`,
+			want: `OPENQASM 3.0;
+include "custom.inc";
+include "stdgates.inc";
+qubit q;
+h q;
+`,
+		},
+		{
+			name: "unused standard include",
+			src: `OPENQASM 3.0;
+include "stdgates.inc";
+include "custom.inc";
+gate h a { U(0, 0, 0) a; }
+qubit q;
+h q;
+`,
+			want: `OPENQASM 3.0;
+include "custom.inc";
+gate h a { U(0, 0, 0) a; }
+qubit q;
+h q;
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := OrganizeIncludes(parse(t, tt.src))
+			if got := apply(t, tt.src, edits); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrganizeIncludesOrganized(t *testing.T) {
+	src := "OPENQASM 3.0;\ninclude \"stdgates.inc\";\nqubit q;\nh q;\n"
+	if edits := OrganizeIncludes(parse(t, src)); edits != nil {
+		t.Errorf("expected no edits, got %+v", edits)
+	}
+}
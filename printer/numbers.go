@@ -0,0 +1,211 @@
+package printer
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// PiStyle selects how angles involving pi are printed
+type PiStyle int
+
+const (
+	// PiKeep prints expressions and literals as they are
+	PiKeep PiStyle = iota
+
+	// PiNumeric evaluates constant expressions naming pi, tau or euler,
+	// printing pi/2 as 1.5707963267948966
+	PiNumeric
+
+	// PiSymbolic prints float literals close to a common fraction of pi
+	// as that fraction, printing 1.5707963267948966 as pi/2
+	PiSymbolic
+)
+
+// NumberStyle controls how float literals are printed. The zero
+// NumberStyle keeps each literal as it was written.
+type NumberStyle struct {
+	// Format is the notation floats are written in: 'f' for decimal, 'e'
+	// for scientific or 'g' for whichever is shorter. Zero keeps the
+	// source spelling of parsed literals and uses 'g' otherwise.
+	Format byte
+
+	// Precision is the number of digits after the decimal point for 'f'
+	// and 'e', and of significant digits for 'g'. Zero means as many as
+	// it takes to read back the same value.
+	Precision int
+
+	Pi PiStyle
+}
+
+// symbolicDenominators are the fractions of pi PiSymbolic recognizes,
+// smallest first so pi/2 wins over 2*pi/4
+var symbolicDenominators = []int64{1, 2, 3, 4, 6, 8, 12, 16}
+
+// literal renders a float literal
+func (n NumberStyle) literal(lit *parser.FloatLiteral) string {
+	if n.Pi == PiSymbolic {
+		if s, ok := symbolic(lit); ok {
+			return s
+		}
+	}
+	if n.Format == 0 && lit.Raw != "" {
+		return lit.Raw
+	}
+	return n.format(lit.Value)
+}
+
+// format renders a float value in the style's notation
+func (n NumberStyle) format(v float64) string {
+	format, precision := n.Format, n.Precision
+	if format == 0 {
+		format = 'g'
+	}
+	if precision == 0 {
+		precision = -1
+	}
+	s := strconv.FormatFloat(v, format, precision, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// symbolic returns lit as k*pi/n if it is within its written precision of
+// such a fraction, up to 4*pi
+func symbolic(lit *parser.FloatLiteral) (string, bool) {
+	v := lit.Value
+	if v == 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return "", false
+	}
+	// A literal written with few digits is matched as loosely as its
+	// digits allow, but never so loosely that 0.5 reads as pi/6
+	scale := max(math.Abs(v), 1)
+	tolerance := 1e-9 * scale
+	if lit.Raw != "" {
+		tolerance = min(max(tolerance, halfUnit(lit.Raw)), 1e-4*scale)
+	}
+	for _, den := range symbolicDenominators {
+		num := math.Round(v * float64(den) / math.Pi)
+		if num == 0 || math.Abs(num) > 4*float64(den) {
+			continue
+		}
+		if math.Abs(v-num*math.Pi/float64(den)) <= tolerance {
+			return piFraction(int64(num), den), true
+		}
+	}
+	return "", false
+}
+
+// halfUnit returns half a unit in the last digit of a decimal literal
+func halfUnit(raw string) float64 {
+	raw = strings.ReplaceAll(raw, "_", "")
+	mantissa, exponent, _ := strings.Cut(strings.ToLower(raw), "e")
+	exp, _ := strconv.Atoi(exponent)
+	if _, frac, ok := strings.Cut(mantissa, "."); ok {
+		exp -= len(frac)
+	}
+	return 0.5 * math.Pow(10, float64(exp))
+}
+
+// piFraction renders num*pi/den
+func piFraction(num, den int64) string {
+	var s string
+	switch num {
+	case 1:
+		s = "pi"
+	case -1:
+		s = "-pi"
+	default:
+		s = strconv.FormatInt(num, 10) + "*pi"
+	}
+	if den != 1 {
+		s += "/" + strconv.FormatInt(den, 10)
+	}
+	return s
+}
+
+// operand renders an operand of an operator, parenthesizing a literal
+// the style turns into a compound expression such as pi/2
+func (c *Config) operand(expr parser.Expression) string {
+	s := c.Expression(expr)
+	if _, ok := expr.(*parser.FloatLiteral); ok && strings.ContainsAny(s, "*/") {
+		return "(" + s + ")"
+	}
+	if c.Numbers.Pi == PiNumeric && strings.HasPrefix(s, "-") && namesConstant(expr) {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// constants are the built-in constants and their values
+var constants = map[string]float64{
+	"pi":    math.Pi,
+	"π":     math.Pi,
+	"tau":   2 * math.Pi,
+	"τ":     2 * math.Pi,
+	"euler": math.E,
+	"ℇ":     math.E,
+}
+
+// constant evaluates an arithmetic expression of literals and built-in
+// constants
+func constant(expr parser.Expression) (float64, bool) {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral:
+		return float64(e.Value), true
+	case *parser.FloatLiteral:
+		return e.Value, true
+	case *parser.Identifier:
+		v, ok := constants[e.Name]
+		return v, ok
+	case *parser.ParenthesizedExpression:
+		return constant(e.Expression)
+	case *parser.UnaryExpression:
+		v, ok := constant(e.Operand)
+		switch {
+		case !ok:
+		case e.Operator == "-":
+			return -v, true
+		case e.Operator == "+":
+			return v, true
+		}
+	case *parser.BinaryExpression:
+		l, ok1 := constant(e.Left)
+		r, ok2 := constant(e.Right)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		switch e.Operator {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			return l / r, r != 0
+		case "**":
+			return math.Pow(l, r), true
+		}
+	}
+	return 0, false
+}
+
+// namesConstant reports whether expr uses a built-in constant
+func namesConstant(expr parser.Expression) bool {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		_, ok := constants[e.Name]
+		return ok
+	case *parser.ParenthesizedExpression:
+		return namesConstant(e.Expression)
+	case *parser.UnaryExpression:
+		return namesConstant(e.Operand)
+	case *parser.BinaryExpression:
+		return namesConstant(e.Left) || namesConstant(e.Right)
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package printer
+
+import (
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestNumberStyle(t *testing.T) {
+	tests := []struct {
+		name   string
+		style  NumberStyle
+		source string
+		want   string
+	}{
+		{"keep", NumberStyle{}, "rz(1.50e0) q;", "rz(1.50e0) q;"},
+		{"decimal", NumberStyle{Format: 'f', Precision: 3}, "rz(1.23456e-1) q;", "rz(0.123) q;"},
+		{"scientific", NumberStyle{Format: 'e', Precision: 2}, "rz(1234.5) q;", "rz(1.23e+03) q;"},
+		{"shortest", NumberStyle{Format: 'g'}, "rz(2.50) q;", "rz(2.5) q;"},
+		{"whole", NumberStyle{Format: 'g'}, "rz(2.0) q;", "rz(2.0) q;"},
+		{"numeric", NumberStyle{Pi: PiNumeric, Format: 'f', Precision: 4}, "rz(pi/2) q;", "rz(1.5708) q;"},
+		{"numeric subexpression", NumberStyle{Pi: PiNumeric}, "rz(theta * -tau) q;", "rz(theta * (-6.283185307179586)) q;"},
+		{"numeric keeps integers", NumberStyle{Pi: PiNumeric}, "rz(2 * 3) q;", "rz(2 * 3) q;"},
+		{"symbolic", NumberStyle{Pi: PiSymbolic}, "rz(1.5707963267948966) q;", "rz(pi/2) q;"},
+		{"symbolic fraction", NumberStyle{Pi: PiSymbolic}, "rz(-2.35619) q;", "rz(-3*pi/4) q;"},
+		{"symbolic multiple", NumberStyle{Pi: PiSymbolic}, "rz(6.2831853) q;", "rz(2*pi) q;"},
+		{"symbolic operand", NumberStyle{Pi: PiSymbolic}, "rz(theta + 0.785398) q;", "rz(theta + (pi/4)) q;"},
+		{"symbolic too loose", NumberStyle{Pi: PiSymbolic}, "rz(0.5) q;", "rz(0.5) q;"},
+		{"symbolic too far", NumberStyle{Pi: PiSymbolic}, "rz(1.5707) q;", "rz(1.5707) q;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := parser.ParseStatement(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &Config{Numbers: tt.style}
+			if got := c.Statement(stmt); got != tt.want {
+				t.Errorf("Statement() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberStyleBuiltLiterals(t *testing.T) {
+	lit := &parser.FloatLiteral{Value: 3}
+	if got := Expression(lit); got != "3.0" {
+		t.Errorf("Expression() = %q, want 3.0", got)
+	}
+	c := &Config{Numbers: NumberStyle{Pi: PiSymbolic}}
+	if got := c.Expression(&parser.FloatLiteral{Value: 3.141592653589793}); got != "pi" {
+		t.Errorf("symbolic Expression() = %q, want pi", got)
+	}
+}
@@ -0,0 +1,424 @@
+// Package printer renders AST nodes as OpenQASM 3.0 source in a canonical
+// layout: one statement per line, two-space indentation inside blocks and
+// single spaces around binary operators. A Config adjusts the rendering,
+// such as how numbers are written.
+package printer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// indentUnit is one level of block indentation
+const indentUnit = "  "
+
+// Config holds printing options. The zero Config is the canonical layout
+// that Print and the other package functions use.
+type Config struct {
+	Numbers NumberStyle
+
+	// MaxWidth is the width in characters past which the operands of gate
+	// calls and barriers wrap onto continuation lines, indented two levels
+	// deeper than the statement. Zero never wraps.
+	MaxWidth int
+}
+
+// Print renders a whole program. Statements the AST has no node for are
+// written as they were in the source. Comments are not part of the AST
+// and are therefore not printed; use FormatRange to reformat source in
+// place without losing them.
+func Print(program *parser.Program) string {
+	return (&Config{}).Print(program)
+}
+
+// Format is Print for callers that must not lose source: it parses the
+// rendering back with p, which should be the parser that read program so
+// that custom statements are recognized, and fails if that gives
+// different statements than the program holds, rather than return output
+// that silently drops or changes some. A nil p means parser.NewParser().
+func Format(p *parser.Parser, program *parser.Program) (string, error) {
+	if program == nil {
+		return "", errors.New("formatting a nil program")
+	}
+	if p == nil {
+		p = parser.NewParser()
+	}
+	out := Print(program)
+	again := p.ParseWithErrors(out)
+	if err := compare(program.Statements, again.Program.Statements); err != nil {
+		return "", fmt.Errorf("formatting would change the program: %w", err)
+	}
+	return out, nil
+}
+
+// compare reports the first statement of want that reads back from its
+// rendering as a different node, comparing nested blocks statement by
+// statement
+func compare(want, got []parser.Statement) error {
+	for i := 0; i < len(want) && i < len(got); i++ {
+		pos := want[i].Pos()
+		before, after := Statement(want[i]), Statement(got[i])
+		if reflect.TypeOf(want[i]) != reflect.TypeOf(got[i]) {
+			return fmt.Errorf("%d:%d: %q reads back as %s", pos.Line, pos.Column, before, got[i])
+		}
+		if before != after {
+			return fmt.Errorf("%d:%d: %q reads back as %q", pos.Line, pos.Column, before, after)
+		}
+		wantBodies, _ := blockBodies(want[i])
+		gotBodies, _ := blockBodies(got[i])
+		for j := range wantBodies {
+			if err := compare(wantBodies[j], gotBodies[j]); err != nil {
+				return err
+			}
+		}
+	}
+	if len(want) != len(got) {
+		return fmt.Errorf("%d statements read back as %d", len(want), len(got))
+	}
+	return nil
+}
+
+// Fprint writes the rendering of a program to w
+func Fprint(w io.Writer, program *parser.Program) error {
+	return (&Config{}).Fprint(w, program)
+}
+
+// Statement renders a single statement at the outermost indentation level,
+// without a trailing newline
+func Statement(stmt parser.Statement) string {
+	return (&Config{}).Statement(stmt)
+}
+
+// Expression renders an expression
+func Expression(expr parser.Expression) string {
+	return (&Config{}).Expression(expr)
+}
+
+// Print renders a whole program as the package function Print does
+func (c *Config) Print(program *parser.Program) string {
+	var sb strings.Builder
+	if program.Version != nil {
+		sb.WriteString("OPENQASM " + program.Version.Number + ";\n")
+	}
+	if program.Run != nil {
+		for _, pragma := range program.Run.Pragmas() {
+			sb.WriteString(pragma + "\n")
+		}
+	}
+	// Dumps are written back between the statements they were among
+	var dumps []parser.Dump
+	if program.Run != nil {
+		dumps = program.Run.Dumps
+	}
+	for _, stmt := range program.Statements {
+		for len(dumps) > 0 && dumps[0].Position.Offset < stmt.Pos().Offset {
+			sb.WriteString(dumps[0].Pragma() + "\n")
+			dumps = dumps[1:]
+		}
+		c.writeStatement(&sb, stmt, 0)
+		sb.WriteString("\n")
+	}
+	for _, dump := range dumps {
+		sb.WriteString(dump.Pragma() + "\n")
+	}
+	return sb.String()
+}
+
+// Fprint writes the rendering of a program to w
+func (c *Config) Fprint(w io.Writer, program *parser.Program) error {
+	_, err := io.WriteString(w, c.Print(program))
+	return err
+}
+
+// Statement renders a single statement at the outermost indentation level,
+// without a trailing newline
+func (c *Config) Statement(stmt parser.Statement) string {
+	var sb strings.Builder
+	c.writeStatement(&sb, stmt, 0)
+	return sb.String()
+}
+
+// Expression renders an expression
+func (c *Config) Expression(expr parser.Expression) string {
+	if c.Numbers.Pi == PiNumeric {
+		if v, ok := constant(expr); ok && namesConstant(expr) {
+			return c.Numbers.format(v)
+		}
+	}
+	switch e := expr.(type) {
+	case nil:
+		return ""
+	case *parser.Identifier:
+		return e.Name
+	case *parser.IndexedIdentifier:
+		return e.Name + "[" + c.expressionList(append([]parser.Expression{e.Index}, e.Indices...)) + "]"
+	case *parser.RangedIdentifier:
+		return e.Name + "[" + c.Expression(e.Start) + ":" + c.Expression(e.EndIndex) + "]"
+	case *parser.RangeExpression:
+		parts := []string{c.Expression(e.Start)}
+		if e.Step != nil {
+			parts = append(parts, c.Expression(e.Step))
+		}
+		parts = append(parts, c.Expression(e.Stop))
+		return "[" + strings.Join(parts, ":") + "]"
+	case *parser.IntegerLiteral:
+		if e.Raw != "" {
+			return e.Raw
+		}
+		return strconv.FormatInt(e.Value, 10)
+	case *parser.FloatLiteral:
+		return c.Numbers.literal(e)
+	case *parser.ImaginaryLiteral:
+		if e.Raw != "" {
+			return e.Raw
+		}
+		return strconv.FormatFloat(e.Value, 'g', -1, 64) + "im"
+	case *parser.StringLiteral:
+		return `"` + e.Value + `"`
+	case *parser.BooleanLiteral:
+		return strconv.FormatBool(e.Value)
+	case *parser.BinaryExpression:
+		return c.operand(e.Left) + " " + e.Operator + " " + c.operand(e.Right)
+	case *parser.UnaryExpression:
+		if _, ok := e.Operand.(*parser.FloatLiteral); ok && e.Operator == "-" {
+			// Negation commutes with the product of a fraction of pi
+			return "-" + c.Expression(e.Operand)
+		}
+		return e.Operator + c.operand(e.Operand)
+	case *parser.ParenthesizedExpression:
+		return "(" + c.Expression(e.Expression) + ")"
+	case *parser.FunctionCall:
+		return e.Name + "(" + c.expressionList(e.Arguments) + ")"
+	case *parser.MeasureExpression:
+		return "measure " + c.Expression(e.Qubit)
+	case *parser.ArrayLiteral:
+		return "{" + c.expressionList(e.Elements) + "}"
+	default:
+		return expr.String()
+	}
+}
+
+func (c *Config) expressionList(exprs []parser.Expression) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = c.Expression(e)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sized renders a type with its optional designator, e.g. bit[2]
+func (c *Config) sized(typ string, size parser.Expression) string {
+	if size == nil {
+		return typ
+	}
+	if typ == "complex" {
+		return "complex[" + c.sized("float", size) + "]"
+	}
+	return typ + "[" + c.Expression(size) + "]"
+}
+
+// arrayType renders array[int[32], 4, 5]
+func (c *Config) arrayType(a *parser.ArrayType) string {
+	parts := []string{a.Element}
+	if a.Rank != nil {
+		parts = append(parts, "#dim = "+c.Expression(a.Rank))
+	}
+	for _, d := range a.Dimensions {
+		parts = append(parts, c.Expression(d))
+	}
+	typ := "array[" + strings.Join(parts, ", ") + "]"
+	if a.Access != "" {
+		typ = a.Access + " " + typ
+	}
+	return typ
+}
+
+func (c *Config) writeStatement(sb *strings.Builder, stmt parser.Statement, depth int) {
+	for _, a := range parser.Annotations(stmt) {
+		sb.WriteString(strings.Repeat(indentUnit, depth) + a.String() + "\n")
+	}
+	sb.WriteString(strings.Repeat(indentUnit, depth))
+
+	switch s := stmt.(type) {
+	case *parser.Include:
+		sb.WriteString("include " + strconv.Quote(s.Path) + ";")
+	case *parser.QuantumDeclaration:
+		if s.Type == "qreg" {
+			sb.WriteString("qreg " + c.sized(s.Identifier, s.Size) + ";")
+		} else {
+			sb.WriteString(c.sized(s.Type, s.Size) + " " + s.Identifier + ";")
+		}
+	case *parser.ClassicalDeclaration:
+		if s.Type == "creg" {
+			sb.WriteString("creg " + c.sized(s.Identifier, s.Size) + ";")
+			break
+		}
+		if s.Const {
+			sb.WriteString("const ")
+		}
+		if s.Array != nil {
+			sb.WriteString(c.arrayType(s.Array) + " " + s.Identifier)
+		} else {
+			sb.WriteString(c.sized(s.Type, s.Size) + " " + s.Identifier)
+		}
+		if s.Initializer != nil {
+			sb.WriteString(" = " + c.Expression(s.Initializer))
+		}
+		sb.WriteString(";")
+	case *parser.GateCall:
+		for _, m := range s.Modifiers {
+			sb.WriteString(m.Type)
+			if len(m.Parameters) > 0 {
+				sb.WriteString("(" + c.expressionList(m.Parameters) + ")")
+			}
+			sb.WriteString(" @ ")
+		}
+		head := s.Name
+		if len(s.Parameters) > 0 {
+			head += "(" + c.expressionList(s.Parameters) + ")"
+		}
+		c.writeOperands(sb, head, s.Qubits, depth)
+	case *parser.Barrier:
+		c.writeOperands(sb, "barrier", s.Qubits, depth)
+	case *parser.Reset:
+		sb.WriteString("reset " + c.Expression(s.Qubit) + ";")
+	case *parser.Measurement:
+		sb.WriteString("measure " + c.Expression(s.Qubit))
+		if s.Target != nil {
+			sb.WriteString(" -> " + c.Expression(s.Target))
+		}
+		sb.WriteString(";")
+	case *parser.Assignment:
+		sb.WriteString(c.Expression(s.Target) + " " + s.Operator + " " + c.Expression(s.Value) + ";")
+	case *parser.GateDefinition:
+		sb.WriteString("gate " + s.Name)
+		if len(s.Parameters) > 0 {
+			sb.WriteString("(" + parameterList(s.Parameters) + ")")
+		}
+		sb.WriteString(" " + parameterList(s.Qubits) + " ")
+		c.writeBlock(sb, s.Body, depth)
+	case *parser.SubroutineDefinition:
+		sb.WriteString("def " + s.Name + "(" + parameterList(s.Parameters) + ")")
+		if s.ReturnType != "" {
+			sb.WriteString(" -> " + s.ReturnType)
+		}
+		sb.WriteString(" ")
+		c.writeBlock(sb, s.Body, depth)
+	case *parser.CalibrationDefinition:
+		sb.WriteString("defcal " + s.Name)
+		if len(s.Parameters) > 0 {
+			sb.WriteString("(" + parameterList(s.Parameters) + ")")
+		}
+		sb.WriteString(" " + c.expressionList(s.Qubits))
+		if s.ReturnType != "" {
+			sb.WriteString(" -> " + s.ReturnType)
+		}
+		sb.WriteString(" {" + s.Body + "}")
+	case *parser.Calibration:
+		sb.WriteString("cal {" + s.Body + "}")
+	case *parser.CalibrationGrammar:
+		sb.WriteString("defcalgrammar " + strconv.Quote(s.Name) + ";")
+	case *parser.IfStatement:
+		sb.WriteString("if (" + c.Expression(s.Condition) + ") ")
+		c.writeBlock(sb, s.ThenBody, depth)
+		if len(s.ElseBody) > 0 {
+			sb.WriteString(" else ")
+			c.writeBlock(sb, s.ElseBody, depth)
+		}
+	case *parser.ForStatement:
+		sb.WriteString("for ")
+		if s.Type != "" {
+			sb.WriteString(s.Type + " ")
+		}
+		sb.WriteString(s.Variable + " in " + c.Expression(s.Iterable) + " ")
+		c.writeBlock(sb, s.Body, depth)
+	case *parser.WhileStatement:
+		sb.WriteString("while (" + c.Expression(s.Condition) + ") ")
+		c.writeBlock(sb, s.Body, depth)
+	case *parser.BadStatement:
+		// Kept as written so broken code survives formatting
+		sb.WriteString(s.Text)
+	case *parser.RawStatement:
+		sb.WriteString(s.Text)
+	default:
+		sb.WriteString(stmt.String())
+	}
+}
+
+// writeOperands renders the rest of a statement, head followed by its
+// operands, wrapping the operands to keep lines within MaxWidth. Each line
+// holds at least one operand, however long.
+func (c *Config) writeOperands(sb *strings.Builder, head string, operands []parser.Expression, depth int) {
+	if len(operands) == 0 {
+		sb.WriteString(head + ";")
+		return
+	}
+	parts := make([]string, len(operands))
+	for i, op := range operands {
+		parts[i] = c.Expression(op)
+	}
+	// The line so far, including indentation and what precedes head
+	lineStart := strings.LastIndexByte(sb.String(), '\n') + 1
+	width := utf8.RuneCountInString(sb.String()[lineStart:])
+	line := head + " " + strings.Join(parts, ", ") + ";"
+	if c.MaxWidth <= 0 || width+utf8.RuneCountInString(line) <= c.MaxWidth {
+		sb.WriteString(line)
+		return
+	}
+
+	continuation := strings.Repeat(indentUnit, depth+2)
+	sb.WriteString(head + " ")
+	width += utf8.RuneCountInString(head) + 1
+	for i, part := range parts {
+		if i == len(parts)-1 {
+			part += ";"
+		} else {
+			part += ","
+		}
+		n := utf8.RuneCountInString(part)
+		if i > 0 {
+			if width+1+n > c.MaxWidth {
+				sb.WriteString("\n" + continuation)
+				width = len(continuation)
+			} else {
+				sb.WriteString(" ")
+				width++
+			}
+		}
+		sb.WriteString(part)
+		width += n
+	}
+}
+
+// writeBlock renders a braced body, indenting its statements one level
+// deeper than the statement that owns it
+func (c *Config) writeBlock(sb *strings.Builder, body []parser.Statement, depth int) {
+	if len(body) == 0 {
+		sb.WriteString("{}")
+		return
+	}
+	sb.WriteString("{\n")
+	for _, stmt := range body {
+		c.writeStatement(sb, stmt, depth+1)
+		sb.WriteString("\n")
+	}
+	sb.WriteString(strings.Repeat(indentUnit, depth) + "}")
+}
+
+func parameterList(params []parser.Parameter) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.Name
+		if p.Type != "" {
+			parts[i] = p.Type + " " + p.Name
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,327 @@
+package printer
+
+import (
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func parse(t *testing.T, src string) *parser.ParseResult {
+	t.Helper()
+	result := parser.NewParser().ParseWithErrors(src)
+	if result.HasErrors() {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+	return result
+}
+
+func apply(t *testing.T, src string, edits []TextEdit) string {
+	t.Helper()
+	out, err := ApplyEdits(src, edits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestPrint(t *testing.T) {
+	src := `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2]   q;
+const int n=0x1F;
+bit[2] c = measure q;
+gate rzz(theta) a,b { cx a,b; rz(theta) b; cx a,b; }
+for int i in [0:n] { if (c[0]==1) { x q[0]; } else { h q[1]; } }
+measure q[0]->c[0];
+c[1]=0; n  +=1;
+barrier  q[0],q[1];
+barrier;
+reset   q[0];
+defcalgrammar  "openpulse";
+cal {extern port d0;}
+defcal  rz(angle[20]  theta) $0 { shift_phase(drive0, theta); }
+defcal measure $0->bit {return capture(a0, 100dt);}
+defcal rx(pi / 2) $1, q {}
+`
+	want := `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+const int n = 0x1F;
+bit[2] c = measure q;
+gate rzz(theta) a, b {
+  cx a, b;
+  rz(theta) b;
+  cx a, b;
+}
+for int i in [0:n] {
+  if (c[0] == 1) {
+    x q[0];
+  } else {
+    h q[1];
+  }
+}
+measure q[0] -> c[0];
+c[1] = 0;
+n += 1;
+barrier q[0], q[1];
+barrier;
+reset q[0];
+defcalgrammar "openpulse";
+cal {extern port d0;}
+defcal rz(angle[20] theta) $0 { shift_phase(drive0, theta); }
+defcal measure $0 -> bit {return capture(a0, 100dt);}
+defcal rx(pi / 2) $1, q {}
+`
+	got := Print(parse(t, src).Program)
+	if got != want {
+		t.Errorf("Print() =\n%s\nwant:\n%s", got, want)
+	}
+
+	// The canonical form is stable
+	if again := Print(parse(t, got).Program); again != got {
+		t.Errorf("Print() is not idempotent:\n%s", again)
+	}
+}
+
+func TestPrintArrays(t *testing.T) {
+	src := `OPENQASM 3.0;
+array[int[32],4,  5] a = {{1, 2}, {3, 4}};
+a[1][2]=a[0 , 1];
+def f(readonly  array[int[8],#dim=2] r) {}
+`
+	want := `OPENQASM 3.0;
+array[int[32], 4, 5] a = {{1, 2}, {3, 4}};
+a[1, 2] = a[0, 1];
+def f(readonly array[int[8], #dim = 2] r) {}
+`
+	if got := Print(parse(t, src).Program); got != want {
+		t.Errorf("Print() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrintComplex(t *testing.T) {
+	src := "OPENQASM 3.0;\ncomplex[float[ 64 ]] z = 2.0+3.1im;\ncomplex w = z * 1 im;\n"
+	want := "OPENQASM 3.0;\ncomplex[float[64]] z = 2.0 + 3.1im;\ncomplex w = z * 1 im;\n"
+	if got := Print(parse(t, src).Program); got != want {
+		t.Errorf("Print() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrintKeepsBadStatements(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit   q;\ngate g a {\n h a;\n cx a ) ;\n}\nh q[0;\n"
+	result := parser.NewParser().ParseWithErrors(src)
+	want := "OPENQASM 3.0;\nqubit q;\ngate g a {\n  h a;\n  cx a ) ;\n}\nh q[0;\n"
+	if got := Print(result.Program); got != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrintKeepsRawStatements(t *testing.T) {
+	src := "OPENQASM 3.0;\ninput  float theta;\nqubit   q;\ndef f(qubit r) -> bit {\n  return   measure r;\n}\n@bind fast\nh q;\nswitch (1) {\n  case 1 {\n  }\n}\n"
+	want := "OPENQASM 3.0;\ninput  float theta;\nqubit q;\ndef f(qubit r) -> bit {\n  return   measure r;\n}\n@bind fast\nh q;\nswitch (1) {\n  case 1 {\n  }\n}\n"
+	if got := Print(parse(t, src).Program); got != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	src := "OPENQASM 3.0;\ninput float theta;\nqubit q;\ndef f(qubit r) -> bit {\n  return measure r;\n}\n@bind fast\nrx(theta) q;\n"
+	if got, err := Format(nil, parse(t, src).Program); err != nil || got != src {
+		t.Errorf("Format() = %q, %v, want %q", got, err, src)
+	}
+	if _, err := Format(nil, nil); err == nil {
+		t.Error("Format() of a nil program should fail")
+	}
+
+	tests := []struct {
+		name string
+		stmt parser.Statement
+		want string
+	}{
+		{
+			name: "syntax error",
+			stmt: &parser.RawStatement{Keyword: "input", Text: "input float;"},
+			want: `formatting would change the program: 0:0: "input float;" reads back as BadStatement`,
+		},
+		{
+			name: "changed parameter",
+			stmt: &parser.GateCall{Name: "rx", Parameters: []parser.Expression{&parser.Identifier{Name: "pi/2"}}, Qubits: []parser.Expression{&parser.Identifier{Name: "q"}}},
+			want: `formatting would change the program: 0:0: "rx(pi/2) q;" reads back as "rx(pi / 2) q;"`,
+		},
+		{
+			name: "nested",
+			stmt: &parser.IfStatement{Condition: &parser.BooleanLiteral{Value: true}, ThenBody: []parser.Statement{
+				&parser.GateCall{Name: "x", Qubits: []parser.Expression{&parser.Identifier{Name: "q r"}}},
+			}},
+			want: `formatting would change the program: 0:0: "x q r;" reads back as BadStatement`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := &parser.Program{Statements: []parser.Statement{tt.stmt}}
+			if _, err := Format(nil, program); err == nil || err.Error() != tt.want {
+				t.Errorf("Format() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatCustomStatements(t *testing.T) {
+	p := parser.NewParser()
+	err := p.RegisterStatement("calibrate", func(src parser.CustomSource) (parser.Statement, error) {
+		return &parser.RawStatement{BaseNode: src.Span, Keyword: src.Keyword, Text: src.Text}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := "OPENQASM 3.0;\nqubit q;\ncalibrate q;\nh q;\n"
+	result := p.ParseWithErrors(src)
+	if result.HasErrors() {
+		t.Fatal(result.String())
+	}
+	if got, err := Format(p, result.Program); err != nil || got != src {
+		t.Errorf("Format() = %q, %v, want %q", got, err, src)
+	}
+	if _, err := Format(nil, result.Program); err == nil {
+		t.Error("Format() with a parser that does not know the statement should fail")
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit q;\n"
+	at := func(offset int) parser.Position { return parser.Position{Line: 1, Column: offset + 1, Offset: offset} }
+	edits := []TextEdit{
+		{Start: at(9), End: at(12), NewText: "4.0"},
+		{Start: at(0), End: at(0), NewText: "// v\n"},
+	}
+	if got := apply(t, src, edits); got != "// v\nOPENQASM 4.0;\nqubit q;\n" {
+		t.Errorf("ApplyEdits() = %q", got)
+	}
+	if edits[0].NewText != "4.0" {
+		t.Error("ApplyEdits() reordered the caller's edits")
+	}
+
+	for _, bad := range [][]TextEdit{
+		{{Start: at(0), End: at(5)}, {Start: at(3), End: at(8)}},
+		{{Start: at(20), End: at(40)}},
+		{{Start: at(5), End: at(3)}},
+	} {
+		if got, err := ApplyEdits(src, bad); err == nil {
+			t.Errorf("ApplyEdits(%+v) = %q, want an error", bad, got)
+		}
+	}
+}
+
+func TestFormatRange(t *testing.T) {
+	src := "OPENQASM 3.0;\n" + // 1
+		"qubit[2]   q;\n" + // 2
+		"gate g a {\n" + // 3
+		"      x   a;\n" + // 4
+		"h a; // trailing\n" + // 5
+		"  }\n" + // 6
+		"bit  c;\n" // 7
+	result := parse(t, src)
+
+	tests := []struct {
+		name       string
+		start, end int
+		want       string
+	}{
+		{
+			name:  "body only",
+			start: 4, end: 4,
+			want: "OPENQASM 3.0;\nqubit[2]   q;\ngate g a {\n  x a;\nh a; // trailing\n  }\nbit  c;\n",
+		},
+		{
+			name:  "closing brace",
+			start: 6, end: 7,
+			want: "OPENQASM 3.0;\nqubit[2]   q;\ngate g a {\n      x   a;\nh a; // trailing\n}\nbit c;\n",
+		},
+		{
+			name:  "whole document",
+			start: 1, end: 7,
+			want: "OPENQASM 3.0;\nqubit[2] q;\ngate g a {\n  x a;\n  h a; // trailing\n}\nbit c;\n",
+		},
+		{
+			name:  "outside",
+			start: 8, end: 9,
+			want: src,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := FormatRange(result, tt.start, tt.end)
+			for _, e := range edits {
+				if e.Start.Line < tt.start || e.End.Line > tt.end {
+					t.Errorf("edit %+v outside lines %d-%d", e, tt.start, tt.end)
+				}
+			}
+			if got := apply(t, src, edits); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRangeAnnotated(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit q;\n@bind fast\nh   q;\ngate g a {\n@unroll\n    x a;\n}\n"
+	want := "OPENQASM 3.0;\nqubit q;\n@bind fast\nh q;\ngate g a {\n  @unroll\n  x a;\n}\n"
+	if got := apply(t, src, FormatRange(parse(t, src), 1, 8)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := Print(parse(t, src).Program); got != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatRangeSkipsComments(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit q;\nx /* keep */   q;\n"
+	if edits := FormatRange(parse(t, src), 3, 3); len(edits) != 0 {
+		t.Errorf("statement containing a comment was rewritten: %+v", edits)
+	}
+}
+
+func TestFormatRangeFormatted(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit q;\ngate g a {\n  x a;\n}\n"
+	if edits := FormatRange(parse(t, src), 1, 5); len(edits) != 0 {
+		t.Errorf("expected no edits for formatted source, got %+v", edits)
+	}
+}
+
+func TestPrintMaxWidth(t *testing.T) {
+	src := `OPENQASM 3.0;
+qubit[12] q;
+barrier q[0], q[1], q[2], q[3], q[4], q[5], q[6], q[7], q[8], q[9];
+for uint i in [0:1] { ctrl @ mcx q[0], q[1], q[2], q[3], q[4], q[5], q[6], q[7]; }
+h q[0];
+`
+	want := `OPENQASM 3.0;
+qubit[12] q;
+barrier q[0], q[1], q[2], q[3], q[4],
+    q[5], q[6], q[7], q[8], q[9];
+for uint i in [0:1] {
+  ctrl @ mcx q[0], q[1], q[2], q[3],
+      q[4], q[5], q[6], q[7];
+}
+h q[0];
+`
+	c := &Config{MaxWidth: 40}
+	if got := c.Print(parse(t, src).Program); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrintRunConfig(t *testing.T) {
+	src := "OPENQASM 3.0;\n#pragma seed 7\nqubit q;\npragma shots 100\nh q;\n"
+	want := "OPENQASM 3.0;\npragma shots 100\npragma seed 7\nqubit q;\nh q;\n"
+	if got := Print(parse(t, src).Program); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	// Dumps stay between the statements they were among
+	src = "OPENQASM 3.0;\nqubit q;\n#pragma qasmparser.dump_state\nh q;\npragma qasmparser.dump_probs end\n"
+	want = "OPENQASM 3.0;\nqubit q;\npragma qasmparser.dump_state\nh q;\npragma qasmparser.dump_probs end\n"
+	if got := Print(parse(t, src).Program); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,180 @@
+package printer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// TextEdit replaces the source between Start and End (exclusive) with
+// NewText. Positions use the parser's 1-based lines and columns.
+type TextEdit struct {
+	Start   parser.Position `json:"start"`
+	End     parser.Position `json:"end"`
+	NewText string          `json:"new_text"`
+}
+
+// FormatRange formats the statements between startLine and endLine
+// (inclusive) and returns the edits that apply it, leaving the rest of the
+// document untouched. Statements that only partly overlap the range are
+// re-indented but not rewritten.
+//
+// Only what the AST represents is rewritten: statements containing
+// comments are left alone, and statements without an AST node (such as
+// reset) and the text between statements are never touched.
+func FormatRange(result *parser.ParseResult, startLine, endLine int) []TextEdit {
+	if result == nil || result.Program == nil {
+		return nil
+	}
+	f := &rangeFormatter{
+		source:    []rune(result.Source()),
+		startLine: startLine,
+		endLine:   endLine,
+	}
+	for _, t := range result.Trivia() {
+		if t.Kind == parser.TriviaLineComment || t.Kind == parser.TriviaBlockComment {
+			f.comments = append(f.comments, t)
+		}
+	}
+	f.statements(result.Program.Statements, 0)
+	return f.edits
+}
+
+type rangeFormatter struct {
+	source             []rune
+	comments           []parser.Trivia
+	startLine, endLine int
+	edits              []TextEdit
+}
+
+func (f *rangeFormatter) statements(statements []parser.Statement, depth int) {
+	for _, stmt := range statements {
+		start, end := stmt.Pos(), stmt.End()
+		if end.Line < f.startLine || start.Line > f.endLine {
+			continue
+		}
+
+		if bodies, ok := blockBodies(stmt); ok {
+			if f.inRange(start.Line) {
+				f.reindent(start, depth)
+			}
+			for _, body := range bodies {
+				f.statements(body, depth+1)
+			}
+			if f.inRange(end.Line) && end.Line != start.Line {
+				// End is just past the closing brace
+				brace := parser.Position{Line: end.Line, Column: end.Column - 1, Offset: end.Offset - 1}
+				f.reindent(brace, depth)
+			}
+			continue
+		}
+
+		switch stmt.(type) {
+		case *parser.BadStatement, *parser.RawStatement:
+			continue
+		}
+		// The rendering includes the annotation lines, so they are
+		// replaced along with the statement
+		if annotations := parser.Annotations(stmt); len(annotations) > 0 {
+			start = annotations[0].Position
+		}
+		if !f.inRange(start.Line) || !f.inRange(end.Line) || f.hasComment(start, end) {
+			continue
+		}
+		var sb strings.Builder
+		(&Config{}).writeStatement(&sb, stmt, depth)
+		if f.lineLeadsWith(start) {
+			f.replace(lineStart(start), end, sb.String())
+		} else {
+			f.replace(start, end, strings.TrimPrefix(sb.String(), strings.Repeat(indentUnit, depth)))
+		}
+	}
+}
+
+// blockBodies returns the nested statement lists of a block statement
+func blockBodies(stmt parser.Statement) ([][]parser.Statement, bool) {
+	switch s := stmt.(type) {
+	case *parser.GateDefinition:
+		return [][]parser.Statement{s.Body}, true
+	case *parser.SubroutineDefinition:
+		return [][]parser.Statement{s.Body}, true
+	case *parser.IfStatement:
+		return [][]parser.Statement{s.ThenBody, s.ElseBody}, true
+	case *parser.ForStatement:
+		return [][]parser.Statement{s.Body}, true
+	case *parser.WhileStatement:
+		return [][]parser.Statement{s.Body}, true
+	}
+	return nil, false
+}
+
+func (f *rangeFormatter) inRange(line int) bool {
+	return line >= f.startLine && line <= f.endLine
+}
+
+// reindent sets the indentation of the line holding pos, provided pos is
+// the first non-blank character of that line
+func (f *rangeFormatter) reindent(pos parser.Position, depth int) {
+	if f.lineLeadsWith(pos) {
+		f.replace(lineStart(pos), pos, strings.Repeat(indentUnit, depth))
+	}
+}
+
+// lineLeadsWith reports whether only whitespace precedes pos on its line
+func (f *rangeFormatter) lineLeadsWith(pos parser.Position) bool {
+	return strings.TrimSpace(f.text(lineStart(pos), pos)) == ""
+}
+
+func (f *rangeFormatter) hasComment(start, end parser.Position) bool {
+	for _, c := range f.comments {
+		if c.Position.Offset < end.Offset && c.EndPos.Offset > start.Offset {
+			return true
+		}
+	}
+	return false
+}
+
+// replace records an edit unless it would not change anything
+func (f *rangeFormatter) replace(start, end parser.Position, text string) {
+	if f.text(start, end) == text {
+		return
+	}
+	f.edits = append(f.edits, TextEdit{Start: start, End: end, NewText: text})
+}
+
+func (f *rangeFormatter) text(start, end parser.Position) string {
+	if start.Offset < 0 || end.Offset > len(f.source) || start.Offset > end.Offset {
+		return ""
+	}
+	return string(f.source[start.Offset:end.Offset])
+}
+
+// lineStart returns the position of the first column on pos's line
+func lineStart(pos parser.Position) parser.Position {
+	return parser.Position{Line: pos.Line, Column: 1, Offset: pos.Offset - (pos.Column - 1)}
+}
+
+// ApplyEdits applies edits to the source they were computed for, in
+// order of their start. Edits that overlap or fall outside the source are
+// an error.
+func ApplyEdits(source string, edits []TextEdit) (string, error) {
+	sorted := slices.Clone(edits)
+	slices.SortStableFunc(sorted, func(a, b TextEdit) int {
+		return a.Start.Offset - b.Start.Offset
+	})
+	runes := []rune(source)
+	var sb strings.Builder
+	last := 0
+	for _, e := range sorted {
+		if e.Start.Offset < last || e.End.Offset < e.Start.Offset || e.End.Offset > len(runes) {
+			return "", fmt.Errorf("%d:%d: edit overlaps another or is outside the source", e.Start.Line, e.Start.Column)
+		}
+		sb.WriteString(string(runes[last:e.Start.Offset]))
+		sb.WriteString(e.NewText)
+		last = e.End.Offset
+	}
+	sb.WriteString(string(runes[last:]))
+	return sb.String(), nil
+}
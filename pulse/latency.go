@@ -0,0 +1,400 @@
+package pulse
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/units"
+)
+
+// LatencyReport attributes the time a program takes on hardware to its
+// qubits and gates
+type LatencyReport struct {
+	// Unit is the unit of every time in the report: "ns", or "dt" when
+	// all durations are in dt and its length is not known
+	Unit string `json:"unit"`
+
+	// Total is the wall-clock time of the program, the end of its
+	// critical path
+	Total float64 `json:"total"`
+
+	// Qubits are the hardware qubits in order of first use, with the
+	// time operations keep each busy
+	Qubits []QubitLatency `json:"qubits"`
+
+	// Gates are the operations by name, longest total first
+	Gates []GateLatency `json:"gates"`
+
+	// Path is the critical path: the chain of operations, each waiting
+	// for the one before, that ends last
+	Path []Step `json:"path"`
+
+	// Untimed lists the operations, such as "h $2", that no defcal with
+	// durations implements; they are taken to take no time
+	Untimed []string `json:"untimed,omitempty"`
+}
+
+// QubitLatency is the time operations keep a qubit busy
+type QubitLatency struct {
+	Qubit string  `json:"qubit"`
+	Busy  float64 `json:"busy"`
+}
+
+// GateLatency is the time spent in one operation across the program
+type GateLatency struct {
+	Gate  string  `json:"gate"`
+	Count int     `json:"count"`
+	Total float64 `json:"total"`
+}
+
+// Step is an operation scheduled on hardware qubits
+type Step struct {
+	Gate     string   `json:"gate"`
+	Qubits   []string `json:"qubits"`
+	Line     int      `json:"line"`
+	Start    float64  `json:"start"`
+	Duration float64  `json:"duration"`
+}
+
+// End returns when the step finishes
+func (s Step) End() float64 {
+	return s.Start + s.Duration
+}
+
+// Latency schedules the operations program applies to hardware qubits,
+// each as soon as its qubits are free, and reports where the time goes.
+// An operation takes as long as the body of the defcal that implements
+// it, as Skeleton matches them; gates no defcal covers are expanded from
+// their definitions, and branches and loop bodies are counted once.
+//
+// A body's duration comes from its play, capture, delay and barrier
+// statements. Each is timed on the frame it names first: play and
+// capture last as long as the first duration among their arguments, or
+// the waveform they play when it is declared in the body with one;
+// delay lasts its designator; barrier waits for the frames it names. The
+// body takes as long as its busiest frame. Durations in dt are converted
+// with dt, the length of dt in nanoseconds; when dt is 0 they cannot be
+// mixed with durations in other units.
+func Latency(program *parser.Program, dt float64) (*LatencyReport, error) {
+	report := &LatencyReport{Unit: "ns", Qubits: []QubitLatency{}, Gates: []GateLatency{}, Path: []Step{}}
+	inDT, inSI := false, false
+	for _, stmt := range program.Statements {
+		if cal, ok := stmt.(*parser.CalibrationDefinition); ok {
+			for _, m := range durationLiteral.FindAllStringSubmatch(comment.ReplaceAllString(cal.Body, " "), -1) {
+				if m[2] == "dt" {
+					inDT = true
+				} else {
+					inSI = true
+				}
+			}
+		}
+	}
+	if dt == 0 && inDT {
+		if inSI {
+			return nil, fmt.Errorf("defcal durations mix dt with other units; the length of dt is needed")
+		}
+		report.Unit = "dt"
+	}
+
+	l := &latency{
+		report:    report,
+		durations: make(map[*parser.CalibrationDefinition]float64),
+		clock:     make(map[string]float64),
+		last:      make(map[string]int),
+		qubits:    make(map[string]int),
+		gates:     make(map[string]int),
+		untimed:   make(map[string]bool),
+	}
+	if length := new(big.Rat).SetFloat64(dt); length != nil && dt > 0 {
+		l.dt = units.New(length, units.Nanosecond)
+	}
+	newWalker(program, l.schedule).statements(program.Statements)
+
+	sort.SliceStable(report.Gates, func(i, j int) bool {
+		return report.Gates[i].Total > report.Gates[j].Total
+	})
+	end := -1
+	for i, step := range l.steps {
+		if end < 0 || step.End() > l.steps[end].End() {
+			end = i
+		}
+	}
+	for i := end; i >= 0; i = l.prev[i] {
+		report.Path = append(report.Path, l.steps[i])
+	}
+	for i, j := 0, len(report.Path)-1; i < j; i, j = i+1, j-1 {
+		report.Path[i], report.Path[j] = report.Path[j], report.Path[i]
+	}
+	if end >= 0 {
+		report.Total = l.steps[end].End()
+	}
+	return report, nil
+}
+
+type latency struct {
+	report *LatencyReport
+
+	// dt is the length of dt, zero if unknown
+	dt units.Duration
+
+	// durations caches the duration of each defcal body, negative for
+	// bodies without one
+	durations map[*parser.CalibrationDefinition]float64
+
+	// clock is when each qubit is next free, and last the index of the
+	// step that occupies it until then
+	clock map[string]float64
+	last  map[string]int
+
+	// steps are the scheduled operations in order, and prev the index of
+	// the step each waited for, -1 for none
+	steps []Step
+	prev  []int
+
+	// qubits and gates map names to their index in the report
+	qubits  map[string]int
+	gates   map[string]int
+	untimed map[string]bool
+}
+
+// schedule places one operation
+func (l *latency) schedule(op operation, cal *parser.CalibrationDefinition) {
+	d := -1.0
+	if cal != nil {
+		if cached, ok := l.durations[cal]; ok {
+			d = cached
+		} else {
+			d = l.duration(cal.Body)
+			l.durations[cal] = d
+		}
+	}
+	if d < 0 {
+		key := op.name + " " + strings.Join(op.qubits, ",")
+		if !l.untimed[key] {
+			l.untimed[key] = true
+			l.report.Untimed = append(l.report.Untimed, key)
+		}
+		return
+	}
+
+	step := Step{Gate: op.name, Qubits: op.qubits, Line: op.line}
+	prev := -1
+	for _, q := range op.qubits {
+		if t, ok := l.clock[q]; ok && (prev < 0 || t > step.Start) {
+			step.Start, prev = t, l.last[q]
+		}
+	}
+	step.Duration = d
+	for _, q := range op.qubits {
+		l.clock[q] = step.End()
+		l.last[q] = len(l.steps)
+		i, ok := l.qubits[q]
+		if !ok {
+			i = len(l.report.Qubits)
+			l.qubits[q] = i
+			l.report.Qubits = append(l.report.Qubits, QubitLatency{Qubit: q})
+		}
+		l.report.Qubits[i].Busy += d
+	}
+	l.steps = append(l.steps, step)
+	l.prev = append(l.prev, prev)
+
+	i, ok := l.gates[op.name]
+	if !ok {
+		i = len(l.report.Gates)
+		l.gates[op.name] = i
+		l.report.Gates = append(l.report.Gates, GateLatency{Gate: op.name})
+	}
+	l.report.Gates[i].Count++
+	l.report.Gates[i].Total += d
+}
+
+var (
+	comment         = regexp.MustCompile(`//[^\n]*|/\*(?s:.*?)\*/`)
+	durationLiteral = regexp.MustCompile(`\b(\d+(?:\.\d*)?(?:[eE][+-]?\d+)?)(dt|ns|us|µs|ms|s)\b`)
+	waveformDecl    = regexp.MustCompile(`^waveform\s+(\w+)\s*=(.*)$`)
+	delayStmt       = regexp.MustCompile(`^delay\s*\[([^\]]*)\]\s*(.*)$`)
+	barrierStmt     = regexp.MustCompile(`^barrier\b(.*)$`)
+	timedCall       = regexp.MustCompile(`\b(play|capture\w*)\s*\(`)
+)
+
+// duration returns how long a defcal body takes, or -1 if it has no
+// timed statements
+func (l *latency) duration(body string) float64 {
+	frames := make(map[string]float64)
+	lengths := make(map[string]float64)
+	timed := false
+	for _, stmt := range strings.FieldsFunc(comment.ReplaceAllString(body, " "), func(r rune) bool {
+		return r == ';' || r == '{' || r == '}'
+	}) {
+		stmt = strings.TrimSpace(stmt)
+		if m := waveformDecl.FindStringSubmatch(stmt); m != nil {
+			if d, ok := l.first(m[2]); ok {
+				lengths[m[1]] = d
+			}
+			continue
+		}
+		if m := delayStmt.FindStringSubmatch(stmt); m != nil {
+			if d, ok := l.first(m[1]); ok {
+				timed = true
+				for _, frame := range splitArguments(m[2]) {
+					frames[frame] += d
+				}
+			}
+			continue
+		}
+		if m := barrierStmt.FindStringSubmatch(stmt); m != nil {
+			names := splitArguments(m[1])
+			latest := 0.0
+			for _, frame := range names {
+				latest = max(latest, frames[frame])
+			}
+			for _, frame := range names {
+				frames[frame] = latest
+			}
+			continue
+		}
+		loc := timedCall.FindStringIndex(stmt)
+		if loc == nil {
+			continue
+		}
+		args := splitArguments(enclosed(stmt[loc[1]:]))
+		if len(args) == 0 {
+			continue
+		}
+		d, ok := l.first(strings.Join(args[1:], ","))
+		if !ok && len(args) > 1 {
+			d, ok = lengths[args[1]]
+		}
+		if ok {
+			timed = true
+			frames[args[0]] += d
+		}
+	}
+	if !timed {
+		return -1
+	}
+	longest := 0.0
+	for _, t := range frames {
+		longest = max(longest, t)
+	}
+	return longest
+}
+
+// first returns the first duration literal in s in the report's unit
+func (l *latency) first(s string) (float64, bool) {
+	m := durationLiteral.FindString(s)
+	if m == "" {
+		return 0, false
+	}
+	d, err := units.ParseDuration(m)
+	if err != nil {
+		return 0, false
+	}
+	if d.Unit() == units.DT && l.dt.IsZero() {
+		return d.Float(), true
+	}
+	ns, err := d.Convert(units.Nanosecond, l.dt)
+	if err != nil {
+		return 0, false
+	}
+	return ns.Float(), true
+}
+
+// enclosed returns the text of s up to the parenthesis that closes one
+// already open
+func enclosed(s string) string {
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth == 0 {
+				return s[:i]
+			}
+			depth--
+		}
+	}
+	return s
+}
+
+// splitArguments splits s at the commas outside brackets, trimming each
+// argument and dropping empty ones
+func splitArguments(s string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i, r := range s + "," {
+		switch r {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				if arg := strings.TrimSpace(s[start:i]); arg != "" {
+					args = append(args, arg)
+				}
+				start = i + 1
+			}
+		}
+	}
+	return args
+}
+
+// WriteText writes the report as tables: time per qubit with its share of
+// the total, time per gate, then the critical path
+func (r *LatencyReport) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "total latency: %s %s (critical path of %d operations)\n", amount(r.Total), r.Unit, len(r.Path))
+	if len(r.Qubits) > 0 {
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "QUBIT\tBUSY\tUTILIZATION")
+		for _, q := range r.Qubits {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", q.Qubit, amount(q.Busy), share(q.Busy, r.Total))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w)
+		fmt.Fprintln(tw, "GATE\tCOUNT\tTOTAL")
+		for _, g := range r.Gates {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", g.Gate, g.Count, amount(g.Total))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, "\ncritical path:")
+		fmt.Fprintln(tw, "START\tDURATION\tGATE\tQUBITS\tLINE")
+		for _, s := range r.Path {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", amount(s.Start), amount(s.Duration), s.Gate, strings.Join(s.Qubits, ","), s.Line)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(r.Untimed) > 0 {
+		fmt.Fprintf(w, "\nno durations for: %s\n", strings.Join(r.Untimed, ", "))
+	}
+	return nil
+}
+
+func amount(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func share(part, total float64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*part/total)
+}
@@ -0,0 +1,129 @@
+package pulse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const timed = `OPENQASM 3.0;
+defcalgrammar "openpulse";
+cal {
+  extern port d0;
+  extern port d1;
+  frame q0_drive = newframe(d0, 5.0e9, 0.0);
+  frame q1_drive = newframe(d1, 5.1e9, 0.0);
+}
+defcal x $0 { play(q0_drive, gaussian(1.0, 160dt, 40dt)); }
+defcal x $1 {
+  waveform wf = drag(1.0, 120dt, 30dt, 0.5);
+  play(q1_drive, wf);
+}
+defcal cx $0, $1 {
+  play(q0_drive, constant(0.5, 400dt));
+  delay[100dt] q1_drive; // the barrier waits for q0_drive, not this 900dt
+  barrier q0_drive, q1_drive;
+  play(q1_drive, gaussian(1.0, 160dt, 40dt));
+}
+defcal measure $0 -> bit { return capture(q0_drive, 800dt); }
+h $0;
+x $0;
+x $1;
+cx $0, $1;
+x $1;
+bit b = measure $0;
+`
+
+func TestLatency(t *testing.T) {
+	program, err := parser.NewParser().ParseString(timed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Latency(program, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Unit != "dt" || report.Total != 1520 {
+		t.Errorf("total = %v %s, want 1520 dt", report.Total, report.Unit)
+	}
+	qubits := []QubitLatency{{"$0", 1520}, {"$1", 800}}
+	if !reflect.DeepEqual(report.Qubits, qubits) {
+		t.Errorf("qubits = %+v, want %+v", report.Qubits, qubits)
+	}
+	gates := []GateLatency{{"measure", 1, 800}, {"cx", 1, 560}, {"x", 3, 400}}
+	if !reflect.DeepEqual(report.Gates, gates) {
+		t.Errorf("gates = %+v, want %+v", report.Gates, gates)
+	}
+	path := []Step{
+		{Gate: "x", Qubits: []string{"$0"}, Line: 22, Start: 0, Duration: 160},
+		{Gate: "cx", Qubits: []string{"$0", "$1"}, Line: 24, Start: 160, Duration: 560},
+		{Gate: "measure", Qubits: []string{"$0"}, Line: 26, Start: 720, Duration: 800},
+	}
+	if !reflect.DeepEqual(report.Path, path) {
+		t.Errorf("path = %+v, want %+v", report.Path, path)
+	}
+	if !reflect.DeepEqual(report.Untimed, []string{"h $0"}) {
+		t.Errorf("untimed = %v", report.Untimed)
+	}
+
+	var sb strings.Builder
+	if err := report.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `total latency: 1520 dt (critical path of 3 operations)
+
+QUBIT  BUSY  UTILIZATION
+$0     1520  100.0%
+$1     800   52.6%
+
+GATE     COUNT  TOTAL
+measure  1      800
+cx       1      560
+x        3      400
+
+critical path:
+START  DURATION  GATE     QUBITS  LINE
+0      160       x        $0      22
+160    560       cx       $0,$1   24
+720    800       measure  $0      26
+
+no durations for: h $0
+`
+	if sb.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", sb.String(), want)
+	}
+
+	// With the length of dt the report is in nanoseconds
+	if report, err = Latency(program, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if report.Unit != "ns" || report.Total != 760 {
+		t.Errorf("total = %v %s, want 760 ns", report.Total, report.Unit)
+	}
+}
+
+func TestLatencyUnits(t *testing.T) {
+	src := `OPENQASM 3.0;
+defcalgrammar "openpulse";
+defcal x $0 { play(f, gaussian(1.0, 0.1us, 40ns)); }
+defcal y $0 { delay[160dt] f; }
+x $0;
+y $0;
+`
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Latency(program, 0); err == nil {
+		t.Error("Latency() mixing dt and ns without the length of dt succeeded")
+	}
+	report, err := Latency(program, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 420 || len(report.Path) != 2 {
+		t.Errorf("total = %v over %+v, want 420 ns", report.Total, report.Path)
+	}
+}
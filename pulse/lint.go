@@ -0,0 +1,92 @@
+package pulse
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/orangekame3/qasmparser/message"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Lint checks the openpulse bodies of program and reports, as errors,
+// ports, frames and waveforms used before they are declared. Names
+// declared in cal blocks are shared by every body after them; names
+// declared in a defcal body belong to that body alone and shadow the
+// shared ones. Bodies are only modeled under defcalgrammar "openpulse",
+// so programs in any other grammar have nothing to report.
+func Lint(program *parser.Program) []parser.ParseError {
+	var (
+		diags  []parser.ParseError
+		shared = make(map[string]parser.PulseDeclaration)
+	)
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *parser.Calibration:
+			diags = append(diags, useBeforeDeclaration(s.Declarations, s.References, shared, program.Statements)...)
+			for _, decl := range s.Declarations {
+				if _, ok := shared[decl.Name]; !ok {
+					shared[decl.Name] = decl
+				}
+			}
+		case *parser.CalibrationDefinition:
+			diags = append(diags, useBeforeDeclaration(s.Declarations, s.References, shared, program.Statements)...)
+		}
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Position.Offset < diags[j].Position.Offset
+	})
+	return diags
+}
+
+// useBeforeDeclaration reports the references of one body to names
+// declared in it, or in a later cal block, after the reference. Shared
+// holds the declarations of the cal blocks before the body.
+func useBeforeDeclaration(decls []parser.PulseDeclaration, refs []parser.Identifier,
+	shared map[string]parser.PulseDeclaration, statements []parser.Statement) []parser.ParseError {
+	local := make(map[string]parser.PulseDeclaration)
+	for _, decl := range decls {
+		if _, ok := local[decl.Name]; !ok {
+			local[decl.Name] = decl
+		}
+	}
+	var diags []parser.ParseError
+	for _, ref := range refs {
+		decl, ok := local[ref.Name]
+		if ok && decl.Position.Offset < ref.Position.Offset {
+			continue
+		}
+		if _, declared := shared[ref.Name]; declared {
+			continue
+		}
+		if !ok {
+			if decl, ok = laterDeclaration(ref, statements); !ok {
+				continue
+			}
+		}
+		pos := ref.Position
+		pos.Column--
+		diags = append(diags, parser.NewDiagnostic("semantic", message.PulseBeforeDeclared, map[string]string{
+			"type": decl.Type,
+			"name": ref.Name,
+			"line": strconv.Itoa(decl.Position.Line),
+		}, pos))
+	}
+	return diags
+}
+
+// laterDeclaration returns the first declaration of ref's name in a cal
+// block after ref
+func laterDeclaration(ref parser.Identifier, statements []parser.Statement) (parser.PulseDeclaration, bool) {
+	for _, stmt := range statements {
+		cal, ok := stmt.(*parser.Calibration)
+		if !ok || cal.Pos().Offset < ref.Position.Offset {
+			continue
+		}
+		for _, decl := range cal.Declarations {
+			if decl.Name == ref.Name {
+				return decl, true
+			}
+		}
+	}
+	return parser.PulseDeclaration{}, false
+}
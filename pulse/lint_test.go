@@ -0,0 +1,71 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/orangekame3/qasmparser/message"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestLint(t *testing.T) {
+	src := `OPENQASM 3.0;
+defcalgrammar "openpulse";
+cal {
+  extern port d0;
+  frame f0 = newframe(d1, 5.0e9, 0.0);
+  extern port d1;
+}
+defcal x $0 {
+  play(f0, wf);
+  waveform wf = gaussian(1.0, 160dt, 40dt);
+  play(f1, wf);
+}
+defcal y $0 {
+  waveform f0 = constant(1.0, 160dt);
+  play(f0, f0);
+}
+cal {
+  frame f1 = newframe(d0, 4.9e9, 0.0);
+}
+defcal z $0 { play(f1, capture); }
+`
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		line, column int
+		message      string
+	}{
+		{5, 22, "port d1 is used before its declaration on line 6"},
+		{9, 11, "waveform wf is used before its declaration on line 10"},
+		{11, 7, "frame f1 is used before its declaration on line 18"},
+	}
+	diags := Lint(program)
+	if len(diags) != len(want) {
+		t.Fatalf("Lint() = %v", diags)
+	}
+	for i, w := range want {
+		d := diags[i]
+		if d.Position.Line != w.line || d.Position.Column != w.column || d.Message != w.message {
+			t.Errorf("diagnostic %d = %d:%d %s, want %d:%d %s", i,
+				d.Position.Line, d.Position.Column, d.Message, w.line, w.column, w.message)
+		}
+		if d.Code != message.PulseBeforeDeclared || d.Severity != parser.SeverityError {
+			t.Errorf("diagnostic %d = %+v", i, d)
+		}
+	}
+
+	// Bodies in another grammar are not read
+	other := `OPENQASM 3.0;
+defcalgrammar "other";
+defcal x $0 { play(f0); }
+cal { frame f0 = newframe(d0, 5.0e9, 0.0); }
+`
+	if program, err = parser.NewParser().ParseString(other); err != nil {
+		t.Fatal(err)
+	}
+	if diags := Lint(program); len(diags) != 0 {
+		t.Errorf("Lint() in another grammar = %v", diags)
+	}
+}
@@ -0,0 +1,112 @@
+// Package pulse works with the pulse level of programs: the defcal
+// calibrations that implement operations on hardware qubits.
+package pulse
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// Grammar is the calibration grammar skeletons are written in
+const Grammar = "openpulse"
+
+// Stub is a calibration a program needs but does not define: an
+// operation it applies to hardware qubits with no defcal to implement it
+type Stub struct {
+	// Name is the gate, "measure" or "reset"
+	Name string `json:"name"`
+
+	// Parameters is the number of angles the gate takes
+	Parameters int `json:"parameters,omitempty"`
+
+	// Qubits are the hardware qubits, such as $0, in operand order
+	Qubits []string `json:"qubits"`
+
+	// Uses are the lines of the operations that need the calibration; for
+	// a gate reached through the definition of another, the line of the
+	// call to that gate
+	Uses []int `json:"uses"`
+}
+
+// Definition returns the defcal declaration of s, with an empty body
+// noting where it is needed
+func (s Stub) Definition() *parser.CalibrationDefinition {
+	def := &parser.CalibrationDefinition{Name: s.Name, Qubits: make([]parser.Expression, len(s.Qubits))}
+	for i := range s.Parameters {
+		name := "theta"
+		if s.Parameters > 1 {
+			name += strconv.Itoa(i)
+		}
+		def.Parameters = append(def.Parameters, parser.Parameter{Name: name, Type: "angle"})
+	}
+	for i, q := range s.Qubits {
+		def.Qubits[i] = &parser.Identifier{Name: q}
+	}
+	if s.Name == "measure" {
+		def.ReturnType = "bit"
+	}
+	lines := make([]string, len(s.Uses))
+	for i, line := range s.Uses {
+		lines[i] = strconv.Itoa(line)
+	}
+	noun := "line"
+	if len(lines) > 1 {
+		noun = "lines"
+	}
+	def.Body = fmt.Sprintf("\n    // used on %s %s\n", noun, strings.Join(lines, ", "))
+	return def
+}
+
+// Skeleton returns the calibrations program needs and does not define, in
+// the order they are first needed. An operation needs one when all its
+// operands are hardware qubits; operations on virtual qubits are not
+// placed yet and need none. A defcal covers an operation if it has the
+// same name and number of angles and each of its operands is the same
+// hardware qubit or a name, which stands for any qubit. A gate the
+// program defines needs no calibration of its own when none covers it,
+// since its definition is used instead, but the gates in its body do.
+// Gates with modifiers are left out, as defcal cannot name them.
+func Skeleton(program *parser.Program) []Stub {
+	s := &skeleton{index: make(map[string]int)}
+	newWalker(program, s.need).statements(program.Statements)
+	return s.stubs
+}
+
+// WriteSkeleton writes stubs as a calibration file to fill in
+func WriteSkeleton(w io.Writer, stubs []Stub) error {
+	var sb strings.Builder
+	sb.WriteString("OPENQASM 3.0;\n")
+	sb.WriteString(printer.Statement(&parser.CalibrationGrammar{Name: Grammar}) + "\n")
+	for _, stub := range stubs {
+		sb.WriteString("\n" + printer.Statement(stub.Definition()) + "\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+type skeleton struct {
+	// index maps each stub's key to its position in stubs
+	index map[string]int
+	stubs []Stub
+}
+
+// need records an operation no defcal covers
+func (s *skeleton) need(op operation, cal *parser.CalibrationDefinition) {
+	if cal != nil {
+		return
+	}
+	key := fmt.Sprintf("%s/%d %s", op.name, op.params, strings.Join(op.qubits, ","))
+	if i, ok := s.index[key]; ok {
+		if uses := s.stubs[i].Uses; uses[len(uses)-1] != op.line {
+			s.stubs[i].Uses = append(uses, op.line)
+		}
+		return
+	}
+	s.index[key] = len(s.stubs)
+	s.stubs = append(s.stubs, Stub{Name: op.name, Parameters: op.params, Qubits: op.qubits, Uses: []int{op.line}})
+}
@@ -0,0 +1,92 @@
+package pulse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const calibrated = `OPENQASM 3.0;
+defcalgrammar "openpulse";
+defcal x $0 { play(d0, wf); }
+defcal rz(angle theta) q { shift_phase(f, -theta); }
+defcal measure $1 -> bit { return capture(a1, wf); }
+gate bell a, b { h a; cx a, b; }
+qubit[2] v;
+x $0;
+x $1;
+rz(0.5) $2;
+bell $0, $1;
+h v[0];
+ctrl @ x $0, $1;
+bit b0 = measure $0;
+bit b1 = measure $1;
+if (b0) {
+    reset $1;
+    x $1;
+}
+`
+
+func TestSkeleton(t *testing.T) {
+	program, err := parser.NewParser().ParseString(calibrated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Stub{
+		{Name: "x", Qubits: []string{"$1"}, Uses: []int{9, 18}},
+		{Name: "h", Qubits: []string{"$0"}, Uses: []int{11}},
+		{Name: "cx", Qubits: []string{"$0", "$1"}, Uses: []int{11}},
+		{Name: "measure", Qubits: []string{"$0"}, Uses: []int{14}},
+		{Name: "reset", Qubits: []string{"$1"}, Uses: []int{17}},
+	}
+	if got := Skeleton(program); !reflect.DeepEqual(got, want) {
+		t.Errorf("Skeleton() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestWriteSkeleton(t *testing.T) {
+	stubs := []Stub{
+		{Name: "rx", Parameters: 1, Qubits: []string{"$0"}, Uses: []int{4}},
+		{Name: "u3", Parameters: 3, Qubits: []string{"$1"}, Uses: []int{5, 7}},
+		{Name: "measure", Qubits: []string{"$0"}, Uses: []int{8}},
+	}
+	var sb strings.Builder
+	if err := WriteSkeleton(&sb, stubs); err != nil {
+		t.Fatal(err)
+	}
+	want := `OPENQASM 3.0;
+defcalgrammar "openpulse";
+
+defcal rx(angle theta) $0 {
+    // used on line 4
+}
+
+defcal u3(angle theta0, angle theta1, angle theta2) $1 {
+    // used on lines 5, 7
+}
+
+defcal measure $0 -> bit {
+    // used on line 8
+}
+`
+	if sb.String() != want {
+		t.Errorf("WriteSkeleton() =\n%s\nwant\n%s", sb.String(), want)
+	}
+
+	// The skeleton is a valid program whose calibrations cover the stubs
+	program, err := parser.NewParser().ParseString(sb.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(program.Statements) != len(stubs)+1 {
+		t.Fatalf("skeleton has %d statements, want %d", len(program.Statements), len(stubs)+1)
+	}
+	w := newWalker(program, nil)
+	for _, stub := range stubs {
+		if w.calibration(stub.Name, stub.Parameters, stub.Qubits) == nil {
+			t.Errorf("skeleton does not cover %+v", stub)
+		}
+	}
+}
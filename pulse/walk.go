@@ -0,0 +1,162 @@
+package pulse
+
+import (
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// operation is an operation applied to hardware qubits
+type operation struct {
+	name   string
+	params int
+	qubits []string
+
+	// line is where the operation is applied; for a gate reached through
+	// the definition of another, the line of the call to that gate
+	line int
+}
+
+// walker follows the operations a program applies to hardware qubits in
+// source order, through the definitions of the gates no defcal covers.
+// Branches and loop bodies are followed once.
+type walker struct {
+	calibrations []*parser.CalibrationDefinition
+	gates        map[string]*parser.GateDefinition
+
+	// visit is called with each operation and the defcal that covers it,
+	// or nil if none does
+	visit func(op operation, cal *parser.CalibrationDefinition)
+
+	// expanding lists the gates whose definitions are being followed, so
+	// a recursive definition is not followed forever
+	expanding []string
+}
+
+// newWalker returns a walker over the calibrations and gate definitions
+// of program
+func newWalker(program *parser.Program, visit func(operation, *parser.CalibrationDefinition)) *walker {
+	w := &walker{gates: make(map[string]*parser.GateDefinition), visit: visit}
+	for _, stmt := range program.Statements {
+		switch st := stmt.(type) {
+		case *parser.CalibrationDefinition:
+			w.calibrations = append(w.calibrations, st)
+		case *parser.GateDefinition:
+			w.gates[st.Name] = st
+		}
+	}
+	return w
+}
+
+func (w *walker) statements(statements []parser.Statement) {
+	for _, stmt := range statements {
+		switch st := stmt.(type) {
+		case *parser.GateCall:
+			if len(st.Modifiers) == 0 {
+				w.apply(operation{st.Name, len(st.Parameters), hardware(st.Qubits...), st.Pos().Line})
+			}
+		case *parser.Measurement:
+			w.apply(operation{"measure", 0, hardware(st.Qubit), st.Pos().Line})
+		case *parser.ClassicalDeclaration:
+			if m, ok := st.Initializer.(*parser.MeasureExpression); ok {
+				w.apply(operation{"measure", 0, hardware(m.Qubit), st.Pos().Line})
+			}
+		case *parser.Reset:
+			w.apply(operation{"reset", 0, hardware(st.Qubit), st.Pos().Line})
+		case *parser.SubroutineDefinition:
+			w.statements(st.Body)
+		case *parser.IfStatement:
+			w.statements(st.ThenBody)
+			w.statements(st.ElseBody)
+		case *parser.ForStatement:
+			w.statements(st.Body)
+		case *parser.WhileStatement:
+			w.statements(st.Body)
+		}
+	}
+}
+
+// hardware returns the names of operands, or nil unless every one of
+// them is a hardware qubit
+func hardware(operands ...parser.Expression) []string {
+	names := make([]string, len(operands))
+	for i, op := range operands {
+		id, ok := op.(*parser.Identifier)
+		if !ok || !strings.HasPrefix(id.Name, "$") {
+			return nil
+		}
+		names[i] = id.Name
+	}
+	return names
+}
+
+// apply visits op, or the operations of its gate's definition if no
+// defcal covers it
+func (w *walker) apply(op operation) {
+	if len(op.qubits) == 0 {
+		return
+	}
+	cal := w.calibration(op.name, op.params, op.qubits)
+	if def, ok := w.gates[op.name]; ok && cal == nil {
+		w.expand(def, op.qubits, op.line)
+		return
+	}
+	w.visit(op, cal)
+}
+
+// calibration returns the first defcal that implements the operation, or
+// nil if none does
+func (w *walker) calibration(name string, params int, qubits []string) *parser.CalibrationDefinition {
+	for _, cal := range w.calibrations {
+		if cal.Name != name || len(cal.Parameters) != params || len(cal.Qubits) != len(qubits) {
+			continue
+		}
+		matches := true
+		for i, q := range cal.Qubits {
+			id, ok := q.(*parser.Identifier)
+			if !ok || strings.HasPrefix(id.Name, "$") && id.Name != qubits[i] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return cal
+		}
+	}
+	return nil
+}
+
+// expand follows the body of a gate definition applied to qubits
+func (w *walker) expand(def *parser.GateDefinition, qubits []string, line int) {
+	if len(def.Qubits) != len(qubits) {
+		return
+	}
+	for _, name := range w.expanding {
+		if name == def.Name {
+			return
+		}
+	}
+	w.expanding = append(w.expanding, def.Name)
+	defer func() { w.expanding = w.expanding[:len(w.expanding)-1] }()
+
+	placed := make(map[string]string, len(qubits))
+	for i, q := range def.Qubits {
+		placed[q.Name] = qubits[i]
+	}
+	for _, stmt := range def.Body {
+		call, ok := stmt.(*parser.GateCall)
+		if !ok || len(call.Modifiers) > 0 {
+			continue
+		}
+		operands := make([]string, len(call.Qubits))
+		for i, op := range call.Qubits {
+			id, ok := op.(*parser.Identifier)
+			if !ok || placed[id.Name] == "" {
+				operands = nil
+				break
+			}
+			operands[i] = placed[id.Name]
+		}
+		w.apply(operation{call.Name, len(call.Parameters), operands, line})
+	}
+}
@@ -0,0 +1,200 @@
+// Package qasm is a small, stable entry point to the library for the
+// common path: parse a program, check it, and format or outline it.
+//
+//	result, err := qasm.Parse(src, qasm.WithStrict(), qasm.WithIncludes(os.DirFS("lib")))
+//	if err != nil {
+//		// err is a parser.ParseErrors listing every error
+//	}
+//	fmt.Print(result.Format())
+//
+// The parser, analysis and printer packages remain available for
+// anything this package does not cover.
+package qasm
+
+import (
+	"io/fs"
+	"strconv"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/deps"
+	"github.com/orangekame3/qasmparser/message"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/symbols"
+)
+
+// Option configures Parse and ParseFile
+type Option func(*config)
+
+type config struct {
+	parse    parser.ParseOptions
+	includes fs.FS
+	paths    []string
+	catalog  message.Catalog
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{parse: *parser.DefaultParseOptions()}
+	// Unlike the parser's default, syntax errors are reported unless
+	// WithErrorRecovery asks for partial results
+	c.parse.ErrorRecovery = false
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithStrict enables strict OpenQASM 3.0 compliance checks
+func WithStrict() Option {
+	return func(c *config) { c.parse.StrictMode = true }
+}
+
+// WithErrorRecovery recovers from syntax errors to build as much of the
+// program as possible, at the cost of not reporting them
+func WithErrorRecovery() Option {
+	return func(c *config) { c.parse.ErrorRecovery = true }
+}
+
+// WithoutComments leaves comments out of the program
+func WithoutComments() Option {
+	return func(c *config) { c.parse.IncludeComments = false }
+}
+
+// WithMaxErrors limits how many diagnostics are collected
+func WithMaxErrors(n int) Option {
+	return func(c *config) { c.parse.MaxErrors = n }
+}
+
+// WithIncludes resolves include directives in fsys, relative to its root
+// and then to each of paths, and parses the included files. Includes
+// that cannot be found are reported as errors; standard includes such as
+// stdgates.inc need no file.
+func WithIncludes(fsys fs.FS, paths ...string) Option {
+	return func(c *config) {
+		c.includes = fsys
+		c.paths = paths
+	}
+}
+
+// WithMessages reports diagnostics in the language of catalog, e.g. one
+// returned by message.Lookup("ja"). Diagnostic codes are unaffected.
+func WithMessages(catalog message.Catalog) Option {
+	return func(c *config) { c.catalog = catalog }
+}
+
+// Included is a file a program includes, directly or through other
+// includes
+type Included struct {
+	Path    string          `json:"path"`
+	Program *parser.Program `json:"program"`
+}
+
+// Result is a parsed program with its diagnostics
+type Result struct {
+	*parser.ParseResult
+
+	// Includes are the included files in the order they were reached,
+	// when WithIncludes is given
+	Includes []Included `json:"includes,omitempty"`
+}
+
+// Parse parses src. The result is returned even when err is not nil, so
+// callers can inspect partial programs and every diagnostic; err is a
+// parser.ParseErrors holding the error-severity diagnostics.
+func Parse(src string, opts ...Option) (*Result, error) {
+	c := newConfig(opts)
+	r := &Result{ParseResult: parser.NewParserWithOptions(&c.parse).ParseWithErrors(src)}
+	c.finish(r)
+	return r, r.Err()
+}
+
+// ParseFile is Parse for the file at path
+func ParseFile(path string, opts ...Option) (*Result, error) {
+	c := newConfig(opts)
+	file := parser.NewParserWithOptions(&c.parse).ParseFileWithErrors(path)
+	r := &Result{ParseResult: &file.ParseResult}
+	c.finish(r)
+	return r, r.Err()
+}
+
+// Format parses src and returns it in canonical form. It fails rather
+// than drop statements the printer cannot reproduce.
+func Format(src string, opts ...Option) (string, error) {
+	c := newConfig(opts)
+	p := parser.NewParserWithOptions(&c.parse)
+	r := &Result{ParseResult: p.ParseWithErrors(src)}
+	c.finish(r)
+	if err := r.Err(); err != nil {
+		return "", err
+	}
+	return printer.Format(p, r.Program)
+}
+
+// Format returns the program in canonical form
+func (r *Result) Format() string {
+	return printer.Print(r.Program)
+}
+
+// Outline returns the program's symbols as a tree, as editors show them
+func (r *Result) Outline() []analysis.Symbol {
+	return analysis.Outline(r.Program)
+}
+
+// Symbols returns the program's symbol table, for queries by name or
+// position
+func (r *Result) Symbols() *symbols.Table {
+	return symbols.Build(r.Program)
+}
+
+// finish resolves includes and localizes the diagnostics of r
+func (c *config) finish(r *Result) {
+	c.resolve(r)
+	if c.catalog != nil {
+		r.Errors = parser.Localize(r.Errors, c.catalog)
+	}
+}
+
+// resolve parses the files r's program includes
+func (c *config) resolve(r *Result) {
+	if c.includes == nil || r.Program == nil {
+		return
+	}
+	resolver := &deps.Resolver{FS: c.includes, Paths: c.paths}
+
+	var roots []string
+	for _, stmt := range r.Program.Statements {
+		inc, ok := stmt.(*parser.Include)
+		if !ok {
+			continue
+		}
+		path, standard, err := resolver.Resolve(".", inc.Path)
+		switch {
+		case err != nil:
+			r.Errors = append(r.Errors, parser.NewDiagnostic("semantic", message.IncludeNotFound, map[string]string{"path": strconv.Quote(inc.Path)}, inc.Pos()))
+		case !standard:
+			roots = append(roots, path)
+		}
+	}
+	if len(roots) == 0 {
+		return
+	}
+
+	graph, err := resolver.Graph(roots...)
+	if err != nil {
+		r.Errors = append(r.Errors, parser.NewIOError("", err))
+	}
+	p := parser.NewParserWithOptions(&c.parse)
+	for _, path := range graph.Files {
+		content, err := fs.ReadFile(c.includes, path)
+		if err != nil {
+			r.Errors = append(r.Errors, parser.NewIOError(path, err))
+			continue
+		}
+		included := p.ParseBytesWithErrors(content)
+		for _, diag := range included.Errors {
+			diag.File = path
+			r.Errors = append(r.Errors, diag)
+		}
+		r.Includes = append(r.Includes, Included{Path: path, Program: included.Program})
+	}
+}
@@ -0,0 +1,127 @@
+package qasm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/orangekame3/qasmparser/message"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestParse(t *testing.T) {
+	r, err := Parse("OPENQASM 3.0;\nqubit   q;\ngate g a { h a; }\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "OPENQASM 3.0;\nqubit q;\ngate g a {\n  h a;\n}\n"; r.Format() != want {
+		t.Errorf("Format() = %q, want %q", r.Format(), want)
+	}
+	if outline := r.Outline(); len(outline) != 2 || outline[1].Name != "g" {
+		t.Errorf("Outline() = %+v", outline)
+	}
+	if a, ok := r.Symbols().Lookup("a", parser.Position{Line: 3, Column: 12}); !ok || len(a.References) != 1 {
+		t.Errorf("Symbols().Lookup(a) = %+v, %v", a, ok)
+	}
+}
+
+func TestParseReportsSyntaxErrors(t *testing.T) {
+	src := "OPENQASM 3.0;\nqubit q\nh q;\n"
+	r, err := Parse(src)
+	var errs parser.ParseErrors
+	if !errors.As(err, &errs) || len(errs) == 0 {
+		t.Fatalf("Parse() error = %v, want ParseErrors", err)
+	}
+	if r == nil || r.Program == nil {
+		t.Fatal("Parse() did not return the partial result")
+	}
+	if _, err := Parse(src, WithErrorRecovery()); err != nil {
+		t.Errorf("Parse() with recovery = %v", err)
+	}
+}
+
+func TestWithMessages(t *testing.T) {
+	_, err := Parse("OPENQASM 3.0;\nqreg q[1];\n", WithStrict(), WithMessages(message.Japanese))
+	var errs parser.ParseErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if errs[0].Code != message.OldStyleDeclaration || !strings.Contains(errs[0].Message, "構文") {
+		t.Errorf("diagnostic = %+v", errs[0])
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	src := "OPENQASM 3.0;\nqreg q[1];\n"
+	if _, err := Parse(src); err != nil {
+		t.Fatalf("Parse() = %v", err)
+	}
+	if _, err := Parse(src, WithStrict()); err == nil {
+		t.Error("Parse() with WithStrict accepted qreg")
+	}
+}
+
+func TestWithIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"gates.inc":    {Data: []byte("include \"more.inc\";\ngate bell a, b { h a; cx a, b; }\n")},
+		"lib/more.inc": {Data: []byte("gate flip a { x a; }\n")},
+		"broken.inc":   {Data: []byte("gate g a { h a\n")},
+	}
+	src := "OPENQASM 3.0;\ninclude \"stdgates.inc\";\ninclude \"gates.inc\";\nqubit[2] q;\nbell q[0], q[1];\n"
+	r, err := Parse(src, WithIncludes(fsys, "lib"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Includes) != 2 || r.Includes[0].Path != "gates.inc" || r.Includes[1].Path != "lib/more.inc" {
+		t.Fatalf("Includes = %+v", r.Includes)
+	}
+	if r.Includes[1].Program == nil || len(r.Includes[1].Program.Statements) != 1 {
+		t.Errorf("lib/more.inc was not parsed")
+	}
+
+	_, err = Parse("OPENQASM 3.0;\ninclude \"missing.inc\";\n", WithIncludes(fsys))
+	if err == nil || !strings.Contains(err.Error(), `include "missing.inc" not found`) {
+		t.Errorf("Parse() with a missing include = %v", err)
+	}
+
+	_, err = Parse("OPENQASM 3.0;\ninclude \"broken.inc\";\n", WithIncludes(fsys))
+	var errs parser.ParseErrors
+	if !errors.As(err, &errs) || errs[0].File != "broken.inc" {
+		t.Errorf("Parse() with a broken include = %v, want an error in broken.inc", err)
+	}
+}
+
+func TestParseFileAndFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "p.qasm")
+	if err := os.WriteFile(path, []byte("OPENQASM 3.0;\nqubit q;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Program.Statements) != 1 {
+		t.Errorf("ParseFile() statements = %d, want 1", len(r.Program.Statements))
+	}
+	if _, err := ParseFile(path + ".missing"); err == nil {
+		t.Error("ParseFile() of a missing file succeeded")
+	}
+
+	if out, err := Format("OPENQASM 3.0;\nh   q ;\n"); err != nil || out != "OPENQASM 3.0;\nh q;\n" {
+		t.Errorf("Format() = %q, %v", out, err)
+	}
+}
+
+func TestFormatKeepsEveryStatement(t *testing.T) {
+	src := "OPENQASM 3.0;\ninput float theta;\nqubit q;\ndef f(qubit r) -> bit {\n  return measure r;\n}\n@bind fast\nrx(theta) q;\n"
+	out, err := Format(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != src {
+		t.Errorf("Format() =\n%s\nwant\n%s", out, src)
+	}
+}
@@ -0,0 +1,109 @@
+package render
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// GitHub writes diagnostics as GitHub Actions workflow commands, which
+// show up as annotations on the lines they refer to:
+//
+//	::error file=a.qasm,line=2,col=8,title=syntax::missing ';'
+func GitHub(w io.Writer, diags []parser.ParseError) error {
+	var sb strings.Builder
+	for _, diag := range diags {
+		props := []string{}
+		if diag.File != "" {
+			props = append(props, "file="+escapeProperty(diag.File))
+		}
+		if diag.Position.Line > 0 {
+			props = append(props,
+				fmt.Sprintf("line=%d", diag.Position.Line),
+				fmt.Sprintf("col=%d", diag.Position.Column+1))
+		}
+		if diag.Type != "" {
+			props = append(props, "title="+escapeProperty(diag.Type))
+		}
+		fmt.Fprintf(&sb, "::%s %s::%s\n", githubLevel(diag.Severity), strings.Join(props, ","), escapeData(diag.Message))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func githubLevel(sev parser.Severity) string {
+	switch sev {
+	case parser.SeverityWarning:
+		return "warning"
+	case parser.SeverityInfo, parser.SeverityHint:
+		return "notice"
+	default:
+		return "error"
+	}
+}
+
+// escapeData escapes a workflow command message
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a workflow command property value
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// codeQualityIssue is one entry of a GitLab Code Quality report
+type codeQualityIssue struct {
+	Description string              `json:"description"`
+	CheckName   string              `json:"check_name"`
+	Fingerprint string              `json:"fingerprint"`
+	Severity    string              `json:"severity"`
+	Location    codeQualityLocation `json:"location"`
+}
+
+type codeQualityLocation struct {
+	Path  string `json:"path"`
+	Lines struct {
+		Begin int `json:"begin"`
+	} `json:"lines"`
+}
+
+// CodeQuality writes diagnostics as a GitLab Code Quality report, which
+// merge requests show inline. Fingerprints are derived from the file,
+// line, type and message, so an issue keeps its identity between runs.
+func CodeQuality(w io.Writer, diags []parser.ParseError) error {
+	issues := make([]codeQualityIssue, 0, len(diags))
+	for _, diag := range diags {
+		issue := codeQualityIssue{
+			Description: diag.Message,
+			CheckName:   diag.Type,
+			Severity:    codeQualitySeverity(diag.Severity),
+			Location:    codeQualityLocation{Path: diag.File},
+		}
+		issue.Location.Lines.Begin = max(diag.Position.Line, 1)
+
+		sum := md5.Sum([]byte(fmt.Sprintf("%s:%d:%s:%s", diag.File, diag.Position.Line, diag.Type, diag.Message)))
+		issue.Fingerprint = hex.EncodeToString(sum[:])
+		issues = append(issues, issue)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(issues)
+}
+
+func codeQualitySeverity(sev parser.Severity) string {
+	switch sev {
+	case parser.SeverityWarning:
+		return "minor"
+	case parser.SeverityInfo, parser.SeverityHint:
+		return "info"
+	default:
+		return "major"
+	}
+}
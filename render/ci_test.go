@@ -0,0 +1,66 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+var ciDiagnostics = []parser.ParseError{
+	{Message: "missing ';'\nat 'h'", Position: parser.Position{Line: 2, Column: 7}, Type: "syntax", File: "dir/a,b.qasm"},
+	parser.NewWarning("syntax", "'qreg' is OpenQASM 2.0 syntax", parser.Position{Line: 3, Column: 0}),
+}
+
+func TestGitHub(t *testing.T) {
+	var buf bytes.Buffer
+	if err := GitHub(&buf, ciDiagnostics); err != nil {
+		t.Fatal(err)
+	}
+	want := "::error file=dir/a%2Cb.qasm,line=2,col=8,title=syntax::missing ';'%0Aat 'h'\n" +
+		"::warning line=3,col=1,title=syntax::'qreg' is OpenQASM 2.0 syntax\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestCodeQuality(t *testing.T) {
+	var buf bytes.Buffer
+	if err := CodeQuality(&buf, ciDiagnostics); err != nil {
+		t.Fatal(err)
+	}
+
+	var issues []struct {
+		Description string `json:"description"`
+		CheckName   string `json:"check_name"`
+		Fingerprint string `json:"fingerprint"`
+		Severity    string `json:"severity"`
+		Location    struct {
+			Path  string `json:"path"`
+			Lines struct {
+				Begin int `json:"begin"`
+			} `json:"lines"`
+		} `json:"location"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &issues); err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %d", len(issues))
+	}
+	if issues[0].Severity != "major" || issues[1].Severity != "minor" {
+		t.Errorf("unexpected severities %q, %q", issues[0].Severity, issues[1].Severity)
+	}
+	if issues[0].Location.Path != "dir/a,b.qasm" || issues[0].Location.Lines.Begin != 2 {
+		t.Errorf("unexpected location %+v", issues[0].Location)
+	}
+	if issues[0].Fingerprint == "" || issues[0].Fingerprint == issues[1].Fingerprint {
+		t.Error("fingerprints should be set and distinct")
+	}
+
+	var empty bytes.Buffer
+	if err := CodeQuality(&empty, nil); err != nil || empty.String() != "[]\n" {
+		t.Errorf("empty report = %q, %v", empty.String(), err)
+	}
+}
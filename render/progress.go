@@ -0,0 +1,46 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const (
+	// progressWidth is the number of cells in the progress bar
+	progressWidth = 30
+
+	// timeResolution is the precision of per-file timings
+	timeResolution = time.Microsecond
+)
+
+// Progress returns a parser.ProgressFunc drawing a progress bar with
+// per-file timing on w, typically os.Stderr. It returns nil, disabling
+// progress output, when quiet is set or w is not a terminal.
+func Progress(w io.Writer, quiet bool) parser.ProgressFunc {
+	if quiet || !isTerminal(w) {
+		return nil
+	}
+	return progressBar(w)
+}
+
+// progressBar draws an in-place progress line, ending it once the batch
+// is complete
+func progressBar(w io.Writer) parser.ProgressFunc {
+	return func(p parser.Progress) {
+		filled := 0
+		if p.Total > 0 {
+			filled = p.Done * progressWidth / p.Total
+		}
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+
+		// \x1b[K clears whatever a longer previous file name left behind
+		fmt.Fprintf(w, "\r[%s] %d/%d %s (%s)\x1b[K", bar, p.Done, p.Total, p.File, p.Duration.Round(timeResolution))
+		if p.Done == p.Total {
+			fmt.Fprintln(w)
+		}
+	}
+}
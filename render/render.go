@@ -0,0 +1,225 @@
+// Package render formats parser diagnostics for terminals and CI systems
+package render
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// ColorMode selects when ANSI colors are used
+type ColorMode string
+
+const (
+	// ColorAuto colors output when writing to a terminal, honoring the
+	// NO_COLOR and CLICOLOR_FORCE environment variables
+	ColorAuto   ColorMode = "auto"
+	ColorAlways ColorMode = "always"
+	ColorNever  ColorMode = "never"
+)
+
+// ParseColorMode converts a --color flag value into a ColorMode
+func ParseColorMode(value string) (ColorMode, error) {
+	switch mode := ColorMode(strings.ToLower(value)); mode {
+	case ColorAuto, ColorAlways, ColorNever:
+		return mode, nil
+	case "":
+		return ColorAuto, nil
+	default:
+		return "", fmt.Errorf("invalid color mode %q (want auto, always or never)", value)
+	}
+}
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiBlue   = "\x1b[34m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// Renderer writes diagnostics in a consistent, optionally colored layout:
+//
+//	file.qasm:3:5: error: missing ';' at 'h'
+//	   3 | qubit q
+//	     |     ^
+type Renderer struct {
+	w     io.Writer
+	color bool
+}
+
+// New creates a renderer writing to w
+func New(w io.Writer, mode ColorMode) *Renderer {
+	return &Renderer{w: w, color: useColor(w, mode, os.Getenv)}
+}
+
+// Colored reports whether the renderer emits ANSI escape codes
+func (r *Renderer) Colored() bool {
+	return r.color
+}
+
+// useColor resolves a color mode against the environment and output
+func useColor(w io.Writer, mode ColorMode, getenv func(string) string) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force := getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true
+	}
+	if getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(w)
+}
+
+// isTerminal reports whether w is a character device such as a TTY
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Diagnostics renders each diagnostic. Source is the text the diagnostics
+// refer to and may be empty, in which case only the source lines captured
+// in the diagnostics are shown.
+func (r *Renderer) Diagnostics(diags []parser.ParseError, source string) error {
+	lines := strings.Split(source, "\n")
+	for i := range diags {
+		if err := r.diagnostic(&diags[i], lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Diagnostic renders a single diagnostic
+func (r *Renderer) Diagnostic(diag parser.ParseError, source string) error {
+	return r.diagnostic(&diag, strings.Split(source, "\n"))
+}
+
+func (r *Renderer) diagnostic(diag *parser.ParseError, lines []string) error {
+	var sb strings.Builder
+
+	// Diagnostic columns are 0-based; print them 1-based like compilers do
+	location := fmt.Sprintf("%d:%d", diag.Position.Line, diag.Position.Column+1)
+	if diag.File != "" {
+		location = diag.File + ":" + location
+	}
+	severity := severityName(diag.Severity)
+
+	sb.WriteString(r.paint(ansiBold, location+":"))
+	sb.WriteString(" ")
+	sb.WriteString(r.paint(ansiBold+severityColor(diag.Severity), severity+":"))
+	sb.WriteString(" ")
+	sb.WriteString(diag.Message)
+	if diag.Code != "" {
+		sb.WriteString(" " + r.paint(ansiDim, "["+diag.Code+"]"))
+	}
+	sb.WriteString("\n")
+
+	if text := sourceLine(diag, lines); text != "" {
+		gutter := fmt.Sprintf("%4d | ", diag.Position.Line)
+		sb.WriteString(r.paint(ansiDim, gutter+text))
+		sb.WriteString("\n")
+
+		carets := 1
+		if diag.Span.Start == diag.Position.Column && diag.Span.End > diag.Span.Start {
+			carets = diag.Span.End - diag.Span.Start
+		}
+		sb.WriteString(r.paint(ansiDim, strings.Repeat(" ", len(gutter)-2)+"| "))
+		sb.WriteString(caretPadding(text, diag.Position.Column))
+		sb.WriteString(r.paint(severityColor(diag.Severity), strings.Repeat("^", carets)))
+		sb.WriteString("\n")
+	}
+
+	// The explanation follows as a note, its lines aligned after the label
+	if diag.Explanation != "" {
+		label := "  = help: "
+		for i, line := range strings.Split(diag.Explanation, "\n") {
+			switch {
+			case i == 0:
+				sb.WriteString(r.paint(ansiBold, label) + line)
+			case line != "":
+				sb.WriteString(strings.Repeat(" ", len(label)) + line)
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(r.w, sb.String())
+	return err
+}
+
+// sourceLine returns the line a diagnostic points at, preferring the line
+// captured while parsing since the source may have changed since
+func sourceLine(diag *parser.ParseError, lines []string) string {
+	if diag.SourceLine != "" {
+		return diag.SourceLine
+	}
+	if line := diag.Position.Line; line >= 1 && line <= len(lines) {
+		return lines[line-1]
+	}
+	return ""
+}
+
+// paint wraps text in an ANSI style when colors are enabled
+func (r *Renderer) paint(style, text string) string {
+	if !r.color || style == "" {
+		return text
+	}
+	return style + text + ansiReset
+}
+
+// caretPadding returns whitespace reaching the given 0-based column,
+// preserving tabs so the caret lines up with the source line
+func caretPadding(line string, column int) string {
+	var sb strings.Builder
+	for i, r := range []rune(line) {
+		if i >= column {
+			break
+		}
+		if r == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+	}
+	return sb.String()
+}
+
+func severityName(sev parser.Severity) string {
+	if sev == "" {
+		return string(parser.SeverityError)
+	}
+	return string(sev)
+}
+
+func severityColor(sev parser.Severity) string {
+	switch sev {
+	case parser.SeverityWarning:
+		return ansiYellow
+	case parser.SeverityInfo:
+		return ansiBlue
+	case parser.SeverityHint:
+		return ansiCyan
+	default:
+		return ansiRed
+	}
+}
@@ -0,0 +1,131 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestRendererPlain(t *testing.T) {
+	var buf bytes.Buffer
+	r := New(&buf, ColorNever)
+
+	diags := []parser.ParseError{
+		{Message: "missing ';'", Position: parser.Position{Line: 2, Column: 7}, Type: "syntax", File: "a.qasm"},
+		parser.NewWarning("syntax", "'qreg' is OpenQASM 2.0 syntax", parser.Position{Line: 3, Column: 0}),
+	}
+	source := "OPENQASM 3.0;\nqubit q\nqreg r[2];\n"
+	if err := r.Diagnostics(diags, source); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "a.qasm:2:8: error: missing ';'\n" +
+		"   2 | qubit q\n" +
+		"     |        ^\n" +
+		"3:1: warning: 'qreg' is OpenQASM 2.0 syntax\n" +
+		"   3 | qreg r[2];\n" +
+		"     | ^\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRendererSourceLine(t *testing.T) {
+	var buf bytes.Buffer
+	diag := parser.NewSyntaxError("extraneous input", parser.Position{Line: 3, Column: 4})
+	diag.SourceLine = "h q ]] ;"
+	diag.Span = parser.Span{Start: 4, End: 6}
+	if err := New(&buf, ColorNever).Diagnostic(diag, ""); err != nil {
+		t.Fatal(err)
+	}
+	expected := "3:5: error: extraneous input\n" +
+		"   3 | h q ]] ;\n" +
+		"     |     ^^\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRendererExplanation(t *testing.T) {
+	var buf bytes.Buffer
+	diag := parser.NewSyntaxError("missing ';' after 'q'", parser.Position{Line: 2, Column: 7})
+	diag.Explanation = "Every statement ends with ';'.\n\n    qubit q;"
+	if err := New(&buf, ColorNever).Diagnostic(diag, "OPENQASM 3.0;\nqubit q\n"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "2:8: error: missing ';' after 'q'\n" +
+		"   2 | qubit q\n" +
+		"     |        ^\n" +
+		"  = help: Every statement ends with ';'.\n" +
+		"\n" +
+		"              qubit q;\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRendererColors(t *testing.T) {
+	var buf bytes.Buffer
+	r := New(&buf, ColorAlways)
+	if err := r.Diagnostic(parser.NewWarning("syntax", "careful", parser.Position{Line: 1}), "x;\n"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, ansiYellow) || !strings.Contains(out, ansiDim) {
+		t.Errorf("Expected warning color and dimmed context, got %q", out)
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+	var buf bytes.Buffer
+
+	tests := []struct {
+		name string
+		mode ColorMode
+		env  map[string]string
+		want bool
+	}{
+		{"never", ColorNever, map[string]string{"CLICOLOR_FORCE": "1"}, false},
+		{"always", ColorAlways, map[string]string{"NO_COLOR": "1"}, true},
+		{"auto non-tty", ColorAuto, nil, false},
+		{"auto forced", ColorAuto, map[string]string{"CLICOLOR_FORCE": "1"}, true},
+		{"auto force disabled", ColorAuto, map[string]string{"CLICOLOR_FORCE": "0"}, false},
+		{"no color wins", ColorAuto, map[string]string{"NO_COLOR": "1", "CLICOLOR_FORCE": "1"}, false},
+	}
+	for _, tt := range tests {
+		if got := useColor(&buf, tt.mode, env(tt.env)); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	if _, err := ParseColorMode("sometimes"); err == nil {
+		t.Error("Expected error for invalid color mode")
+	}
+	if mode, err := ParseColorMode("ALWAYS"); err != nil || mode != ColorAlways {
+		t.Errorf("ParseColorMode returned %q, %v", mode, err)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	if Progress(&buf, false) != nil {
+		t.Error("Expected no progress output for non-terminal writers")
+	}
+
+	draw := progressBar(&buf)
+	draw(parser.Progress{File: "a.qasm", Done: 1, Total: 2})
+	draw(parser.Progress{File: "b.qasm", Done: 2, Total: 2})
+
+	out := buf.String()
+	if !strings.Contains(out, "1/2 a.qasm") || !strings.Contains(out, "2/2 b.qasm") {
+		t.Errorf("Unexpected progress output %q", out)
+	}
+	if !strings.HasSuffix(out, "\n") {
+		t.Error("Expected progress line to end once the batch completes")
+	}
+}
@@ -0,0 +1,80 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// TemplateFuncs returns the helper functions available to output
+// templates in addition to the text/template builtins:
+//
+//	json       value as compact JSON
+//	join       strings joined by a separator
+//	upper      upper-case string
+//	lower      lower-case string
+//	location   "file:line:column" of a diagnostic
+//	severity   severity of a diagnostic ("error" when unset)
+//	statements number of top-level statements of a program
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"join":  func(sep string, items []string) string { return strings.Join(items, sep) },
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"location": func(diag parser.ParseError) string {
+			// Diagnostic columns are 0-based; locations are 1-based
+			loc := fmt.Sprintf("%d:%d", diag.Position.Line, diag.Position.Column+1)
+			if diag.File != "" {
+				loc = diag.File + ":" + loc
+			}
+			return loc
+		},
+		"severity": func(diag parser.ParseError) string {
+			return severityName(diag.Severity)
+		},
+		"statements": func(program *parser.Program) int {
+			if program == nil {
+				return 0
+			}
+			return len(program.Statements)
+		},
+	}
+}
+
+// NewTemplate parses template text with TemplateFuncs available
+func NewTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(TemplateFuncs()).Parse(text)
+}
+
+// LoadTemplate reads and parses a template file, as given to
+// --template-file
+func LoadTemplate(path string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewTemplate(filepath.Base(path), string(text))
+}
+
+// ExecuteTemplate applies a template to data, such as a
+// *parser.ParseFileResult, and writes the output to w. Nothing is written
+// if execution fails part way.
+func ExecuteTemplate(w io.Writer, tmpl *template.Template, data interface{}) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,53 @@
+package render
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.tmpl")
+	text := `{{.File}}: {{statements .Program}} statements
+{{range .Errors}}{{location .}} {{severity . | upper}} {{.Message}}
+{{end}}`
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := LoadTemplate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &parser.ParseFileResult{File: "a.qasm"}
+	result.Program = &parser.Program{Statements: []parser.Statement{&parser.Include{Path: "stdgates.inc"}}}
+	result.Errors = []parser.ParseError{
+		{Message: "missing ';'", Position: parser.Position{Line: 2, Column: 7}, File: "a.qasm"},
+	}
+
+	var buf bytes.Buffer
+	if err := ExecuteTemplate(&buf, tmpl, result); err != nil {
+		t.Fatal(err)
+	}
+	want := "a.qasm: 1 statements\na.qasm:2:8 ERROR missing ';'\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestTemplateErrorWritesNothing(t *testing.T) {
+	tmpl, err := NewTemplate("bad", "partial {{.Missing}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := ExecuteTemplate(&buf, tmpl, &parser.ParseFileResult{}); err == nil {
+		t.Fatal("expected an execution error")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("partial output written: %q", buf.String())
+	}
+}
@@ -0,0 +1,305 @@
+// Package sanitize checks untrusted programs against a policy of allowed
+// constructs, as a service accepting user-submitted QASM must before
+// compiling or running it.
+package sanitize
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Policy lists what a program may use. The zero Policy forbids extern
+// functions and pragmas and places no limit on qubits or includes.
+type Policy struct {
+	// AllowExtern permits extern declarations and calls to them
+	AllowExtern bool
+
+	// AllowPragmas permits pragma directives
+	AllowPragmas bool
+
+	// MaxQubits bounds the number of qubits a program uses: those its
+	// declarations add up to plus each distinct hardware qubit such as
+	// $3. Statements kept as text, which the limit cannot see into, are
+	// violations while it is set. Zero means no limit.
+	MaxQubits int
+
+	// AllowedIncludes lists the include paths a program may use. Nil
+	// allows every include; an empty slice allows none.
+	AllowedIncludes []string
+}
+
+// Rule names the policy a violation breaks
+type Rule string
+
+const (
+	RuleExtern  Rule = "extern"
+	RulePragma  Rule = "pragma"
+	RuleQubits  Rule = "max-qubits"
+	RuleInclude Rule = "include"
+)
+
+// Violation is one construct the policy disallows
+type Violation struct {
+	Rule     Rule            `json:"rule"`
+	Message  string          `json:"message"`
+	Position parser.Position `json:"position"`
+
+	// statement is the top-level statement Strip removes to fix the
+	// violation, or nil if removing statements cannot fix it
+	statement parser.Statement
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", v.Position.Line, v.Position.Column, v.Rule, v.Message)
+}
+
+// Check returns every violation of policy in a parse result. It needs the
+// result rather than just the program because pragma and extern
+// declarations are found in the token stream.
+func Check(result *parser.ParseResult, policy Policy) []Violation {
+	if result == nil || result.Program == nil {
+		return nil
+	}
+	var violations []Violation
+
+	externs := make(map[string]bool)
+	tokens := result.Tokens()
+	for i, tok := range tokens {
+		switch tok.Type {
+		case "EXTERN":
+			if i+1 < len(tokens) && tokens[i+1].Type == "Identifier" {
+				externs[tokens[i+1].Text] = true
+			}
+			if !policy.AllowExtern {
+				violations = append(violations, Violation{
+					Rule:      RuleExtern,
+					Message:   "extern declarations are not allowed",
+					Position:  tok.Position,
+					statement: enclosing(result.Program.Statements, tok.Position),
+				})
+			}
+		case "PRAGMA":
+			if !policy.AllowPragmas {
+				violations = append(violations, Violation{Rule: RulePragma, Message: "pragmas are not allowed", Position: tok.Position})
+			}
+		}
+	}
+
+	allowed := make(map[string]bool)
+	for _, path := range policy.AllowedIncludes {
+		allowed[path] = true
+	}
+
+	for _, stmt := range result.Program.Statements {
+		if s, ok := stmt.(*parser.Include); ok && policy.AllowedIncludes != nil && !allowed[s.Path] {
+			violations = append(violations, Violation{
+				Rule:      RuleInclude,
+				Message:   fmt.Sprintf("include %q is not allowed", s.Path),
+				Position:  s.Pos(),
+				statement: s,
+			})
+		}
+
+		if !policy.AllowExtern && len(externs) > 0 {
+			for _, call := range externCalls(stmt, externs) {
+				violations = append(violations, Violation{
+					Rule:      RuleExtern,
+					Message:   fmt.Sprintf("call to extern function %s is not allowed", call.Name),
+					Position:  call.Pos(),
+					statement: stmt,
+				})
+			}
+		}
+	}
+
+	limit := int64(policy.MaxQubits)
+	var qubits int64
+	found := collectQubits(result.Program)
+	for _, s := range found.declarations {
+		size, ok := declaredSize(s.Size)
+		switch {
+		case !ok && limit > 0:
+			violations = append(violations, Violation{
+				Rule:     RuleQubits,
+				Message:  fmt.Sprintf("size of %s must be an integer literal", s.Identifier),
+				Position: s.Pos(),
+			})
+		case limit > 0 && size > limit:
+			violations = append(violations, Violation{
+				Rule:     RuleQubits,
+				Message:  fmt.Sprintf("%s declares %d qubits, more than the limit of %d", s.Identifier, size, limit),
+				Position: s.Pos(),
+			})
+		}
+		qubits = add(qubits, size)
+	}
+
+	// Statements kept as text may declare or use qubits the limit cannot
+	// see, so the check fails closed on them
+	if limit > 0 {
+		for _, stmt := range found.opaque {
+			message := "statement with syntax errors cannot be checked against the qubit limit"
+			if raw, ok := stmt.(*parser.RawStatement); ok {
+				message = fmt.Sprintf("%s statement cannot be checked against the qubit limit", raw.Keyword)
+			}
+			violations = append(violations, Violation{
+				Rule:      RuleQubits,
+				Message:   message,
+				Position:  stmt.Pos(),
+				statement: enclosing(result.Program.Statements, stmt.Pos()),
+			})
+		}
+	}
+
+	// Hardware qubits count once each, however often they are used
+	seen := make(map[string]bool)
+	for _, id := range found.hardware {
+		if !seen[id.Name] {
+			seen[id.Name] = true
+			qubits = add(qubits, 1)
+		}
+	}
+
+	if limit > 0 && qubits > limit {
+		violations = append(violations, Violation{
+			Rule:     RuleQubits,
+			Message:  fmt.Sprintf("program uses %s qubits, more than the limit of %d", count(qubits), limit),
+			Position: result.Program.Pos(),
+		})
+	}
+	return violations
+}
+
+// enclosing returns the top-level statement containing pos, or nil
+func enclosing(statements []parser.Statement, pos parser.Position) parser.Statement {
+	for _, stmt := range statements {
+		if stmt.Pos().Offset <= pos.Offset && pos.Offset < stmt.End().Offset {
+			return stmt
+		}
+	}
+	return nil
+}
+
+// declaredSize returns the number of qubits a declaration size stands for
+func declaredSize(size parser.Expression) (int64, bool) {
+	switch s := size.(type) {
+	case nil:
+		return 1, true
+	case *parser.IntegerLiteral:
+		return s.Value, true
+	}
+	return 0, false
+}
+
+// add returns a + b, saturating at math.MaxInt64 so that huge
+// declarations cannot wrap the total below the limit
+func add(a, b int64) int64 {
+	if b > math.MaxInt64-a {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+// count writes a qubit total, which may have saturated
+func count(n int64) string {
+	if n == math.MaxInt64 {
+		return "at least " + strconv.FormatInt(n, 10)
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// qubitCollector records what the qubit limit counts, at any depth
+type qubitCollector struct {
+	parser.BaseVisitor
+	declarations []*parser.QuantumDeclaration
+	hardware     []*parser.Identifier
+	// opaque holds the statements kept as text
+	opaque []parser.Statement
+}
+
+func (c *qubitCollector) VisitQuantumDeclaration(node *parser.QuantumDeclaration) interface{} {
+	c.declarations = append(c.declarations, node)
+	return nil
+}
+
+func (c *qubitCollector) VisitIdentifier(node *parser.Identifier) interface{} {
+	if strings.HasPrefix(node.Name, "$") {
+		c.hardware = append(c.hardware, node)
+	}
+	return nil
+}
+
+func (c *qubitCollector) VisitRawStatement(node *parser.RawStatement) interface{} {
+	c.opaque = append(c.opaque, node)
+	return nil
+}
+
+func (c *qubitCollector) VisitBadStatement(node *parser.BadStatement) interface{} {
+	c.opaque = append(c.opaque, node)
+	return nil
+}
+
+func collectQubits(program *parser.Program) *qubitCollector {
+	c := &qubitCollector{}
+	parser.Walk(parser.NewDepthFirstVisitor(c), program)
+	return c
+}
+
+// callCollector records calls to extern functions
+type callCollector struct {
+	parser.BaseVisitor
+	externs map[string]bool
+	calls   []*parser.FunctionCall
+}
+
+func (c *callCollector) VisitFunctionCall(node *parser.FunctionCall) interface{} {
+	if c.externs[node.Name] {
+		c.calls = append(c.calls, node)
+	}
+	return nil
+}
+
+func externCalls(stmt parser.Statement, externs map[string]bool) []*parser.FunctionCall {
+	c := &callCollector{externs: externs}
+	parser.Walk(parser.NewDepthFirstVisitor(c), stmt)
+	return c.calls
+}
+
+// Strip returns a copy of program without the top-level statements that
+// cause violations, together with the violations that removing
+// statements cannot fix, such as too many qubits. A pragma violation
+// clears the program's run configuration, the only pragmas printed back,
+// so the stripped program contains no pragmas. The original program is
+// not modified.
+func Strip(program *parser.Program, violations []Violation) (*parser.Program, []Violation) {
+	drop := make(map[parser.Statement]bool)
+	pragmas := false
+	var remaining []Violation
+	for _, v := range violations {
+		if v.statement != nil {
+			drop[v.statement] = true
+			continue
+		}
+		if v.Rule == RulePragma {
+			pragmas = true
+			continue
+		}
+		remaining = append(remaining, v)
+	}
+
+	stripped := *program
+	if pragmas {
+		stripped.Run = nil
+	}
+	stripped.Statements = make([]parser.Statement, 0, len(program.Statements))
+	for _, stmt := range program.Statements {
+		if !drop[stmt] {
+			stripped.Statements = append(stripped.Statements, stmt)
+		}
+	}
+	return &stripped, remaining
+}
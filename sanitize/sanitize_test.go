@@ -0,0 +1,144 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+const source = `OPENQASM 3.0;
+pragma shots 1000
+pragma qasmparser.dump_probs after_setup
+include "stdgates.inc";
+include "secret.inc";
+extern readout(int) -> int;
+qubit[3] q;
+qubit r;
+int x = readout(1);
+h q[0];
+`
+
+func parse(t *testing.T, src string) *parser.ParseResult {
+	t.Helper()
+	result := parser.NewParserWithOptions(&parser.ParseOptions{ErrorRecovery: false}).ParseWithErrors(src)
+	if result.HasErrors() {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+	return result
+}
+
+func TestCheck(t *testing.T) {
+	result := parse(t, source)
+	policy := Policy{MaxQubits: 3, AllowedIncludes: []string{"stdgates.inc"}}
+
+	rules := make(map[Rule]int)
+	for _, v := range Check(result, policy) {
+		rules[v.Rule]++
+	}
+	// The extern declaration is kept as text, so the qubit limit cannot
+	// check it either
+	want := map[Rule]int{RulePragma: 2, RuleInclude: 1, RuleExtern: 2, RuleQubits: 2}
+	for rule, n := range want {
+		if rules[rule] != n {
+			t.Errorf("%s violations = %d, want %d (all: %v)", rule, rules[rule], n, rules)
+		}
+	}
+
+	permissive := Policy{AllowExtern: true, AllowPragmas: true}
+	if v := Check(result, permissive); len(v) != 0 {
+		t.Errorf("permissive policy reported %v", v)
+	}
+}
+
+func TestStrip(t *testing.T) {
+	result := parse(t, source)
+	violations := Check(result, Policy{MaxQubits: 3, AllowedIncludes: []string{"stdgates.inc"}})
+
+	stripped, remaining := Strip(result.Program, violations)
+	if len(remaining) != 1 || remaining[0].Rule != RuleQubits {
+		t.Errorf("expected only the qubit limit to remain, got %v", remaining)
+	}
+	for _, stmt := range stripped.Statements {
+		if inc, ok := stmt.(*parser.Include); ok && inc.Path == "secret.inc" {
+			t.Error("disallowed include was not stripped")
+		}
+		if decl, ok := stmt.(*parser.ClassicalDeclaration); ok && decl.Identifier == "x" {
+			t.Error("statement calling an extern was not stripped")
+		}
+	}
+	if len(stripped.Statements) != len(result.Program.Statements)-3 {
+		t.Errorf("stripped %d statements, want 3", len(result.Program.Statements)-len(stripped.Statements))
+	}
+	out := printer.Print(stripped)
+	if strings.Contains(out, "extern") {
+		t.Errorf("stripped program still declares an extern:\n%s", out)
+	}
+	if strings.Contains(out, "pragma") {
+		t.Errorf("stripped program still has pragmas:\n%s", out)
+	}
+	if result.Program.Run == nil {
+		t.Error("Strip modified the original program")
+	}
+}
+
+func TestCheckQubitOverflow(t *testing.T) {
+	result := parse(t, "OPENQASM 3.0;\nqubit[9223372036854775807] a;\nqubit[9223372036854775807] b;\n")
+	var messages []string
+	for _, v := range Check(result, Policy{MaxQubits: 10}) {
+		if v.Rule == RuleQubits {
+			messages = append(messages, v.String())
+		}
+	}
+	want := []string{
+		"2:1: max-qubits: a declares 9223372036854775807 qubits, more than the limit of 10",
+		"3:1: max-qubits: b declares 9223372036854775807 qubits, more than the limit of 10",
+		"1:1: max-qubits: program uses at least 9223372036854775807 qubits, more than the limit of 10",
+	}
+	if strings.Join(messages, "\n") != strings.Join(want, "\n") {
+		t.Errorf("violations:\n%s\nwant:\n%s", strings.Join(messages, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckHardwareQubits(t *testing.T) {
+	result := parse(t, "OPENQASM 3.0;\ninclude \"stdgates.inc\";\nh $0;\ncx $0, $1;\nqubit q;\nh $2;\n")
+	if v := Check(result, Policy{MaxQubits: 4}); len(v) != 0 {
+		t.Errorf("4 qubits reported %v", v)
+	}
+	v := Check(result, Policy{MaxQubits: 3})
+	if len(v) != 1 || v[0].Message != "program uses 4 qubits, more than the limit of 3" {
+		t.Errorf("violations %v, want the program over the limit of 3", v)
+	}
+}
+
+func TestCheckAnnotated(t *testing.T) {
+	result := parse(t, "OPENQASM 3.0;\n@x\nqubit[1000] q;\n")
+	v := Check(result, Policy{MaxQubits: 10})
+	if len(v) == 0 || v[0].Rule != RuleQubits {
+		t.Errorf("annotated declaration over the limit reported %v", v)
+	}
+}
+
+func TestCheckNested(t *testing.T) {
+	result := parse(t, "OPENQASM 3.0;\nif (true) {\n  qubit[1000] q;\n}\n")
+	v := Check(result, Policy{MaxQubits: 10})
+	if len(v) == 0 || v[0].String() != "3:3: max-qubits: q declares 1000 qubits, more than the limit of 10" {
+		t.Errorf("nested declaration over the limit reported %v", v)
+	}
+}
+
+func TestCheckRawStatements(t *testing.T) {
+	result := parse(t, "OPENQASM 3.0;\nqubit q;\nbox {\n  h $5;\n}\n")
+	v := Check(result, Policy{MaxQubits: 10})
+	if len(v) != 1 || v[0].String() != "3:1: max-qubits: box statement cannot be checked against the qubit limit" {
+		t.Errorf("violations %v, want the box statement", v)
+	}
+	if v := Check(result, Policy{}); len(v) != 0 {
+		t.Errorf("no qubit limit reported %v", v)
+	}
+	stripped, remaining := Strip(result.Program, v)
+	if len(remaining) != 0 || len(stripped.Statements) != 1 {
+		t.Errorf("Strip() = %v, %v, want the box statement removed", stripped.Statements, remaining)
+	}
+}
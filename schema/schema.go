@@ -0,0 +1,240 @@
+// Package schema describes the JSON documents the library's result types
+// encode to, as JSON Schema (draft 2020-12), so consumers can validate
+// output and generate bindings.
+//
+// Output formats are versioned by Version. Within a major version fields
+// are only ever added: existing fields keep their names, types and
+// meaning, and fields that are always present stay required.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/deps"
+	"github.com/orangekame3/qasmparser/doc"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Version is the version of the JSON output formats. The major number
+// changes only when a format changes incompatibly.
+const Version = "1.10"
+
+// outputs maps each command to a value of the type its JSON output encodes
+var outputs = map[string]interface{}{
+	"parse":   parser.ParseFileResult{},
+	"doc":     doc.Document{},
+	"outline": []analysis.Symbol{},
+	"deps":    []deps.Closure{},
+}
+
+// statementTypes and expressionTypes list the concrete AST nodes the
+// Statement and Expression interfaces encode as
+var (
+	statementTypes = []parser.Statement{
+		&parser.Include{},
+		&parser.QuantumDeclaration{},
+		&parser.ClassicalDeclaration{},
+		&parser.GateCall{},
+		&parser.Measurement{},
+		&parser.Assignment{},
+		&parser.GateDefinition{},
+		&parser.SubroutineDefinition{},
+		&parser.IfStatement{},
+		&parser.ForStatement{},
+		&parser.WhileStatement{},
+		&parser.Barrier{},
+		&parser.Reset{},
+		&parser.CalibrationDefinition{},
+		&parser.Calibration{},
+		&parser.CalibrationGrammar{},
+		&parser.BadStatement{},
+		&parser.RawStatement{},
+	}
+	expressionTypes = []parser.Expression{
+		&parser.Identifier{},
+		&parser.IndexedIdentifier{},
+		&parser.RangedIdentifier{},
+		&parser.RangeExpression{},
+		&parser.MeasureExpression{},
+		&parser.ArrayLiteral{},
+		&parser.IntegerLiteral{},
+		&parser.FloatLiteral{},
+		&parser.ImaginaryLiteral{},
+		&parser.StringLiteral{},
+		&parser.BooleanLiteral{},
+		&parser.BinaryExpression{},
+		&parser.UnaryExpression{},
+		&parser.FunctionCall{},
+		&parser.ParenthesizedExpression{},
+	}
+)
+
+// StatementTypes returns an empty value of every concrete node type a
+// Statement can hold
+func StatementTypes() []parser.Statement {
+	return append([]parser.Statement(nil), statementTypes...)
+}
+
+// ExpressionTypes returns an empty value of every concrete node type an
+// Expression can hold
+func ExpressionTypes() []parser.Expression {
+	return append([]parser.Expression(nil), expressionTypes...)
+}
+
+// Commands returns the commands that have a schema, sorted
+func Commands() []string {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// For returns the indented JSON Schema of a command's output, as printed
+// by --schema
+func For(command string) ([]byte, error) {
+	v, ok := outputs[command]
+	if !ok {
+		return nil, fmt.Errorf("no schema for command %q (want one of %s)", command, strings.Join(Commands(), ", "))
+	}
+	s := Generate(v)
+	s["$id"] = "https://github.com/orangekame3/qasmparser/schema/" + command + ".json"
+	s["title"] = "qasmparser " + command + " output"
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// Generate returns the JSON Schema of the JSON encoding of v's type.
+// Named struct types become definitions under $defs.
+func Generate(v interface{}) map[string]interface{} {
+	g := &generator{defs: make(map[string]interface{}), names: make(map[reflect.Type]string)}
+	root := g.schema(reflect.TypeOf(v))
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["version"] = Version
+	if len(g.defs) > 0 {
+		root["$defs"] = g.defs
+	}
+	return root
+}
+
+type generator struct {
+	defs  map[string]interface{}
+	names map[reflect.Type]string
+}
+
+var (
+	statementType  = reflect.TypeOf((*parser.Statement)(nil)).Elem()
+	expressionType = reflect.TypeOf((*parser.Expression)(nil)).Elem()
+)
+
+func (g *generator) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case statementType:
+		return g.anyOf(statementTypes)
+	case expressionType:
+		return g.anyOf(expressionTypes)
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		return map[string]interface{}{"$ref": "#/$defs/" + g.define(t)}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *generator) anyOf(nodes interface{}) map[string]interface{} {
+	var options []interface{}
+	list := reflect.ValueOf(nodes)
+	for i := 0; i < list.Len(); i++ {
+		options = append(options, g.schema(list.Index(i).Elem().Type()))
+	}
+	return map[string]interface{}{"anyOf": options}
+}
+
+// define adds the definition of a struct type and returns its name. Types
+// sharing a name across packages are qualified by package.
+func (g *generator) define(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := g.defs[name]; taken || name == "" {
+		name = path.Base(t.PkgPath()) + "." + t.Name()
+	}
+	g.names[t] = name
+	g.defs[name] = nil // reserve the name while recursing
+
+	properties := make(map[string]interface{})
+	var required []string
+	g.fields(t, properties, &required)
+	def := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		def["required"] = required
+	}
+	g.defs[name] = def
+	return name
+}
+
+// fields adds the encoded fields of a struct, including those promoted
+// from embedded structs
+func (g *generator) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, properties, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			*required = append(*required, name)
+			if nullable(f.Type) {
+				prop = map[string]interface{}{"anyOf": []interface{}{prop, map[string]interface{}{"type": "null"}}}
+			}
+		}
+		properties[name] = prop
+	}
+}
+
+// nullable reports whether a value of type t can encode as null
+func nullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return false
+}
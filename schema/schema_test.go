@@ -0,0 +1,108 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func load(t *testing.T, command string) map[string]interface{} {
+	t.Helper()
+	data, err := For(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s map[string]interface{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	return s
+}
+
+func definition(t *testing.T, s map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+	def, ok := s["$defs"].(map[string]interface{})[name].(map[string]interface{})
+	if !ok {
+		t.Fatalf("missing definition %s", name)
+	}
+	return def
+}
+
+// TestCompatibility pins the required fields of version 1. Removing one
+// is an incompatible change that needs a new major Version.
+func TestCompatibility(t *testing.T) {
+	required := map[string]map[string][]string{
+		"parse": {
+			"ParseFileResult": {"file"},
+			"ParseError":      {"message", "position", "type"},
+			"Position":        {"column", "line", "offset"},
+			"Program":         {"end_position", "position", "statements"},
+			"GateCall":        {"name", "qubits"},
+		},
+		"doc": {
+			"Document": {"symbols"},
+			"Symbol":   {"kind", "name", "position", "signature"},
+		},
+		"outline": {
+			"Symbol": {"kind", "name", "range"},
+		},
+		"deps": {
+			"Closure": {"file", "files"},
+		},
+	}
+
+	for command, defs := range required {
+		s := load(t, command)
+		if s["version"] != Version {
+			t.Errorf("%s: version = %v, want %s", command, s["version"], Version)
+		}
+		for name, fields := range defs {
+			def := definition(t, s, name)
+			have := make(map[string]bool)
+			for _, f := range def["required"].([]interface{}) {
+				have[f.(string)] = true
+			}
+			for _, f := range fields {
+				if !have[f] {
+					t.Errorf("%s: %s no longer requires %q", command, name, f)
+				}
+			}
+		}
+	}
+}
+
+// TestParseOutputMatches checks that every field of real parse output is
+// described by the schema
+func TestParseOutputMatches(t *testing.T) {
+	s := load(t, "parse")
+	result := &parser.ParseFileResult{File: "a.qasm"}
+	result.ParseResult = *parser.NewParser().ParseWithErrors("OPENQASM 3.0;\nqubit[2] q;\nh q[0];\n")
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded map[string]interface{}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		t.Fatal(err)
+	}
+	check := func(def string, object map[string]interface{}) {
+		props := definition(t, s, def)["properties"].(map[string]interface{})
+		for key := range object {
+			if _, ok := props[key]; !ok {
+				t.Errorf("%s has undocumented field %q", def, key)
+			}
+		}
+	}
+	check("ParseFileResult", encoded)
+	program := encoded["program"].(map[string]interface{})
+	check("Program", program)
+	check("GateCall", program["statements"].([]interface{})[1].(map[string]interface{}))
+}
+
+func TestForUnknown(t *testing.T) {
+	if _, err := For("estimate"); err == nil {
+		t.Error("expected an error for a command without a schema")
+	}
+}
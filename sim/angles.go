@@ -0,0 +1,39 @@
+package sim
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Angles returns θ, φ and λ such that U(θ, φ, λ) equals the 2×2 unitary
+// m up to global phase. θ is in [0, π] and φ and λ in (-π, π]; when θ
+// is 0 or π only the sum or difference of φ and λ matters, and λ or φ
+// is 0.
+func Angles(m Matrix) (theta, phi, lambda float64) {
+	// m = e^{iγ} U(θ, φ, λ): |m00| = cos(θ/2), |m10| = sin(θ/2) and the
+	// phases of the entries are γ, γ+φ, γ+λ+π and γ+φ+λ
+	theta = 2 * math.Atan2(cmplx.Abs(m[1][0]), cmplx.Abs(m[0][0]))
+	const eps = 1e-12
+	switch {
+	case cmplx.Abs(m[1][0]) < eps:
+		lambda = cmplx.Phase(m[1][1]) - cmplx.Phase(m[0][0])
+	case cmplx.Abs(m[0][0]) < eps:
+		phi = cmplx.Phase(m[1][0]) - cmplx.Phase(-m[0][1])
+	default:
+		phi = cmplx.Phase(m[1][0]) - cmplx.Phase(m[0][0])
+		lambda = cmplx.Phase(-m[0][1]) - cmplx.Phase(m[0][0])
+	}
+	return theta, Wrap(phi), Wrap(lambda)
+}
+
+// Wrap returns the angle equal to a modulo 2π in (-π, π]
+func Wrap(a float64) float64 {
+	a = math.Mod(a, 2*math.Pi)
+	switch {
+	case a > math.Pi:
+		a -= 2 * math.Pi
+	case a <= -math.Pi:
+		a += 2 * math.Pi
+	}
+	return a
+}
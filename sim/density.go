@@ -0,0 +1,153 @@
+package sim
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// MaxDensityQubits is the most qubits a Machine simulates on a density
+// matrix; the density matrix of n qubits has 4^n entries
+const MaxDensityQubits = 10
+
+// DensityMatrix returns a copy of the density matrix, or nil when the
+// machine runs on a state vector
+func (m *Machine) DensityMatrix() Matrix {
+	if m.noise == nil {
+		return nil
+	}
+	dim := 1 << len(m.qubits)
+	rho := zero(dim)
+	for r := range dim {
+		copy(rho[r], m.state[r*dim:(r+1)*dim])
+	}
+	return rho
+}
+
+// apply applies a unitary gate to targets: U·ψ, or U·ρ·U† as U on the
+// row qubits and the conjugate of U on the column qubits
+func (m *Machine) apply(gate Matrix, targets []int) {
+	Apply(m.state, gate, targets)
+	if m.noise == nil {
+		return
+	}
+	columns := make([]int, len(targets))
+	for i, t := range targets {
+		columns[i] = t + len(m.qubits)
+	}
+	Apply(m.state, conjugate(gate), columns)
+}
+
+// channels applies the noise the library gives for gate name to each of
+// targets
+func (m *Machine) channels(name string, targets []int) {
+	if m.noise == nil {
+		return
+	}
+	g, ok := m.noise.Gate(name)
+	if !ok || g.Noise == nil {
+		return
+	}
+	for _, q := range targets {
+		if p := g.Noise.Depolarizing; p > 0 {
+			m.channel(depolarizing(p), q)
+		}
+		if gamma := g.Noise.AmplitudeDamping; gamma > 0 {
+			m.channel(amplitudeDamping(gamma), q)
+		}
+	}
+}
+
+// channel applies the channel ρ ↦ Σ K·ρ·K† of the Kraus operators kraus
+// to qubit q
+func (m *Machine) channel(kraus []Matrix, q int) {
+	out := make([]complex128, len(m.state))
+	term := make([]complex128, len(m.state))
+	for _, k := range kraus {
+		copy(term, m.state)
+		Apply(term, k, []int{q})
+		Apply(term, conjugate(k), []int{q + len(m.qubits)})
+		for i, a := range term {
+			out[i] += a
+		}
+	}
+	m.state = out
+}
+
+// depolarizing returns the Kraus operators of an X, Y or Z error with
+// probability p in all
+func depolarizing(p float64) []Matrix {
+	keep := complex(math.Sqrt(1-p), 0)
+	flip := complex(math.Sqrt(p/3), 0)
+	return []Matrix{
+		Identity(2).Scale(keep),
+		paulis['X'].Scale(flip),
+		paulis['Y'].Scale(flip),
+		paulis['Z'].Scale(flip),
+	}
+}
+
+// amplitudeDamping returns the Kraus operators of decay from 1 to 0 with
+// probability gamma
+func amplitudeDamping(gamma float64) []Matrix {
+	return []Matrix{
+		{{1, 0}, {0, complex(math.Sqrt(1-gamma), 0)}},
+		{{0, complex(math.Sqrt(gamma), 0)}, {0, 0}},
+	}
+}
+
+// conjugate returns the entrywise complex conjugate of m
+func conjugate(m Matrix) Matrix {
+	out := zero(len(m))
+	for i := range m {
+		for j := range m[i] {
+			out[i][j] = cmplx.Conj(m[i][j])
+		}
+	}
+	return out
+}
+
+// collapseDensity measures qubit q of the density matrix, collapsing it,
+// and returns the outcome
+func (m *Machine) collapseDensity(q int) int {
+	n := len(m.qubits)
+	dim := 1 << n
+	mask := 1 << (n - 1 - q)
+	var one float64
+	for r := range dim {
+		if r&mask != 0 {
+			one += real(m.state[r*dim+r])
+		}
+	}
+	outcome, p := 0, 1-one
+	if m.rng.Float64() < one {
+		outcome, p = 1, one
+	}
+	scale := complex(1/p, 0)
+	for r := range dim {
+		for c := range dim {
+			i := r*dim + c
+			if (r&mask != 0) == (outcome == 1) && (c&mask != 0) == (outcome == 1) {
+				m.state[i] = mul(m.state[i], scale)
+			} else {
+				m.state[i] = 0
+			}
+		}
+	}
+	return outcome
+}
+
+// readout returns the bit a measurement reads for outcome, after the
+// library's readout error
+func (m *Machine) readout(outcome int) int {
+	if m.noise == nil || m.noise.Readout == nil {
+		return outcome
+	}
+	p := m.noise.Readout.ZeroToOne
+	if outcome == 1 {
+		p = m.noise.Readout.OneToZero
+	}
+	if p > 0 && m.rng.Float64() < p {
+		return 1 - outcome
+	}
+	return outcome
+}
@@ -0,0 +1,75 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/stdlib"
+)
+
+func TestDensityMatrix(t *testing.T) {
+	m := machine(t, `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+h q[0];
+cx q[0], q[1];
+`, &RunOptions{Noise: &stdlib.Library{}})
+	if err := m.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if m.State() != nil {
+		t.Error("State() on a density matrix")
+	}
+	bell := Matrix{{0.5, 0, 0, 0.5}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0.5, 0, 0, 0.5}}
+	if d := Distance(m.DensityMatrix(), bell); d > 1e-12 {
+		t.Errorf("density matrix is %g from the Bell state", d)
+	}
+}
+
+func TestNoiseChannels(t *testing.T) {
+	lib := &stdlib.Library{Gates: []stdlib.Gate{
+		{Name: "x", Arity: 1, Noise: &stdlib.Noise{Depolarizing: 0.3}},
+		{Name: "y", Arity: 1, Noise: &stdlib.Noise{AmplitudeDamping: 0.25}},
+	}}
+	tests := []struct {
+		gate string
+		one  float64
+	}{
+		{"x", 0.8}, // X and Y errors undo the flip, Z errors do not
+		{"y", 0.75},
+		{"z", 0},
+	}
+	for _, tt := range tests {
+		m := machine(t, "OPENQASM 3.0;\ninclude \"stdgates.inc\";\nqubit q;\n"+tt.gate+" q;\n", &RunOptions{Noise: lib})
+		if err := m.Run(); err != nil {
+			t.Fatal(err)
+		}
+		p := m.Probabilities()
+		if math.Abs(p[1]-tt.one) > 1e-12 || math.Abs(p[0]+p[1]-1) > 1e-12 {
+			t.Errorf("%s: probabilities %v, want %g of 1", tt.gate, p, tt.one)
+		}
+	}
+}
+
+func TestReadoutError(t *testing.T) {
+	program, err := parser.NewParser().ParseString(`OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+bit[2] c;
+x q[1];
+c = measure q;
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib := &stdlib.Library{Readout: &stdlib.Readout{ZeroToOne: 1, OneToZero: 0.5}}
+	counts, err := Sample(program, 400, &RunOptions{Noise: lib})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// q[0] always reads 1; q[1] reads 0 half the time
+	if len(counts) != 2 || counts["01"] < 150 || counts["11"] < 150 {
+		t.Errorf("counts = %v", counts)
+	}
+}
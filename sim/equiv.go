@@ -0,0 +1,292 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// DefaultTolerance is the tolerance Equivalent uses when none is given
+const DefaultTolerance = 1e-9
+
+// EquivalenceOptions configures Equivalent
+type EquivalenceOptions struct {
+	// Tolerance is the largest deviation, entry by entry and up to
+	// global phase, at which two circuits are still equivalent. Zero
+	// means DefaultTolerance.
+	Tolerance float64
+
+	// Input, if set, is the state both circuits start from: they are
+	// compared by the states they produce from it instead of by their
+	// unitaries. Amplitudes are indexed with the first qubit most
+	// significant.
+	Input []complex128
+}
+
+// Equivalence is the outcome of comparing two circuits
+type Equivalence struct {
+	// Equivalent reports whether Deviation is within the tolerance
+	Equivalent bool `json:"equivalent"`
+
+	// Deviation is the largest difference between entries of the two
+	// unitaries, or of the two final states, up to global phase
+	Deviation float64 `json:"deviation"`
+
+	// Qubits are the qubits compared, in the order of the first circuit
+	Qubits []string `json:"qubits"`
+}
+
+// Equivalent compares two small circuits numerically, by their
+// unitaries or, given an input state, by the states they produce. Unlike
+// a structural comparison this accepts circuits that differ in gates,
+// such as a gate and its decomposition, as long as they have the same
+// effect up to global phase.
+//
+// Both circuits must act on the same qubits, matched by name, and consist
+// of gate calls only; see Unitary.
+func Equivalent(a, b *parser.Program, opts *EquivalenceOptions) (*Equivalence, error) {
+	if opts == nil {
+		opts = &EquivalenceOptions{}
+	}
+	tolerance := opts.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	qubits, err := programQubits(a)
+	if err != nil {
+		return nil, err
+	}
+	other, err := programQubits(b)
+	if err != nil {
+		return nil, err
+	}
+	if !sameQubits(qubits, other) {
+		return nil, fmt.Errorf("the circuits act on different qubits: %s and %s", strings.Join(qubits, ", "), strings.Join(other, ", "))
+	}
+	ua, err := unitary(a, qubits)
+	if err != nil {
+		return nil, err
+	}
+	ub, err := unitary(b, qubits)
+	if err != nil {
+		return nil, err
+	}
+
+	var deviation float64
+	if opts.Input != nil {
+		if len(opts.Input) != len(ua) {
+			return nil, fmt.Errorf("input state has %d amplitudes, want %d for %d qubits", len(opts.Input), len(ua), len(qubits))
+		}
+		if math.Abs(norm(opts.Input)-1) > tolerance {
+			return nil, fmt.Errorf("input state has norm %g, not 1", norm(opts.Input))
+		}
+		deviation = Distance(column(ua, opts.Input), column(ub, opts.Input))
+	} else {
+		deviation = Distance(ua, ub)
+	}
+	return &Equivalence{Equivalent: deviation <= tolerance, Deviation: deviation, Qubits: qubits}, nil
+}
+
+// Unitary returns the unitary of a program and the qubits it acts on,
+// the first most significant: the elements of its quantum registers in
+// declaration order, or its hardware qubits in numerical order. The
+// program may define gates and declare bits, but otherwise only call
+// gates and place barriers; measurements, resets and control flow are
+// an error.
+func Unitary(program *parser.Program) (Matrix, []string, error) {
+	qubits, err := programQubits(program)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := unitary(program, qubits)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, qubits, nil
+}
+
+// unitary returns the unitary of program on qubits, taking the program's
+// gate calls as the body of a gate on them
+func unitary(program *parser.Program, qubits []string) (Matrix, error) {
+	sizes := registers(program)
+	def := &parser.GateDefinition{Name: "circuit"}
+	for _, q := range qubits {
+		def.Qubits = append(def.Qubits, parser.Parameter{Name: q})
+	}
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *parser.Include, *parser.GateDefinition, *parser.QuantumDeclaration, *parser.Barrier:
+		case *parser.ClassicalDeclaration:
+			if s.Initializer != nil {
+				return nil, fmt.Errorf("%s: %s is not part of a unitary circuit", position(s), s.Identifier)
+			}
+		case *parser.GateCall:
+			calls, err := broadcast(s, sizes)
+			if err != nil {
+				return nil, err
+			}
+			for _, call := range calls {
+				def.Body = append(def.Body, call)
+			}
+		default:
+			return nil, fmt.Errorf("%s: %s is not part of a unitary circuit", position(stmt), stmt)
+		}
+	}
+	return GatesOf(program).UnitaryOf(def, nil)
+}
+
+// broadcast splits a gate call on registers into calls on single
+// qubits, each operand an identifier naming one qubit as q[i]
+func broadcast(call *parser.GateCall, sizes map[string]int) ([]*parser.GateCall, error) {
+	width := 1
+	for _, op := range call.Qubits {
+		if id, ok := op.(*parser.Identifier); ok && sizes[id.Name] > 0 {
+			if width > 1 && sizes[id.Name] != width {
+				return nil, fmt.Errorf("%s: registers of different sizes in one call", position(call))
+			}
+			width = sizes[id.Name]
+		}
+	}
+	calls := make([]*parser.GateCall, width)
+	for i := range calls {
+		single := *call
+		single.Qubits = make([]parser.Expression, len(call.Qubits))
+		for j, op := range call.Qubits {
+			var name string
+			switch e := op.(type) {
+			case *parser.Identifier:
+				name = e.Name
+				if sizes[e.Name] > 0 {
+					name = e.Name + "[" + strconv.Itoa(i) + "]"
+				}
+			case *parser.IndexedIdentifier:
+				lit, ok := e.Index.(*parser.IntegerLiteral)
+				if !ok || lit.Value < 0 || int(lit.Value) >= sizes[e.Name] {
+					return nil, fmt.Errorf("%s: %s is not a qubit of the circuit", position(call), printer.Expression(op))
+				}
+				name = e.Name + "[" + strconv.FormatInt(lit.Value, 10) + "]"
+			default:
+				return nil, fmt.Errorf("%s: %s is not a qubit of the circuit", position(call), printer.Expression(op))
+			}
+			single.Qubits[j] = &parser.Identifier{Name: name}
+		}
+		calls[i] = &single
+	}
+	return calls, nil
+}
+
+// programQubits returns the qubits of a program, first most significant
+func programQubits(program *parser.Program) ([]string, error) {
+	var qubits []string
+	for _, stmt := range program.Statements {
+		decl, ok := stmt.(*parser.QuantumDeclaration)
+		if !ok {
+			continue
+		}
+		if decl.Size == nil {
+			qubits = append(qubits, decl.Identifier)
+			continue
+		}
+		lit, ok := decl.Size.(*parser.IntegerLiteral)
+		if !ok {
+			return nil, fmt.Errorf("%s: register %s has no literal size", position(decl), decl.Identifier)
+		}
+		for i := range int(lit.Value) {
+			qubits = append(qubits, decl.Identifier+"["+strconv.Itoa(i)+"]")
+		}
+	}
+	if qubits == nil {
+		qubits = hardwareQubits(program)
+	}
+	if len(qubits) > MaxQubits {
+		return nil, fmt.Errorf("the circuit has %d qubits, more than %d", len(qubits), MaxQubits)
+	}
+	return qubits, nil
+}
+
+// hardwareQubits returns the hardware qubits a program's gate calls use,
+// in numerical order
+func hardwareQubits(program *parser.Program) []string {
+	seen := make(map[int]bool)
+	for _, stmt := range program.Statements {
+		call, ok := stmt.(*parser.GateCall)
+		if !ok {
+			continue
+		}
+		for _, op := range call.Qubits {
+			if id, ok := op.(*parser.Identifier); ok {
+				if n, err := strconv.Atoi(strings.TrimPrefix(id.Name, "$")); err == nil && strings.HasPrefix(id.Name, "$") {
+					seen[n] = true
+				}
+			}
+		}
+	}
+	numbers := make([]int, 0, len(seen))
+	for n := range seen {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	qubits := make([]string, len(numbers))
+	for i, n := range numbers {
+		qubits[i] = "$" + strconv.Itoa(n)
+	}
+	return qubits
+}
+
+// registers maps each quantum register of a program to its size, 0 for
+// a single qubit
+func registers(program *parser.Program) map[string]int {
+	sizes := make(map[string]int)
+	for _, stmt := range program.Statements {
+		if decl, ok := stmt.(*parser.QuantumDeclaration); ok {
+			sizes[decl.Identifier] = 0
+			if lit, ok := decl.Size.(*parser.IntegerLiteral); ok {
+				sizes[decl.Identifier] = int(lit.Value)
+			}
+		}
+	}
+	return sizes
+}
+
+func sameQubits(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, q := range a {
+		seen[q] = true
+	}
+	for _, q := range b {
+		if !seen[q] {
+			return false
+		}
+	}
+	return true
+}
+
+// column returns m·state as a matrix of one column
+func column(m Matrix, state []complex128) Matrix {
+	out := make(Matrix, len(m))
+	for i := range m {
+		var sum complex128
+		for j, v := range state {
+			sum += m[i][j] * v
+		}
+		out[i] = []complex128{sum}
+	}
+	return out
+}
+
+// norm returns the Euclidean norm of a state
+func norm(state []complex128) float64 {
+	var sum float64
+	for _, v := range state {
+		sum += real(v)*real(v) + imag(v)*imag(v)
+	}
+	return math.Sqrt(sum)
+}
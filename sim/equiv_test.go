@@ -0,0 +1,87 @@
+package sim
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestEquivalent(t *testing.T) {
+	const header = "OPENQASM 3.0;\ninclude \"stdgates.inc\";\n"
+	tests := []struct {
+		name  string
+		a, b  string
+		input []complex128
+		want  bool
+	}{
+		{"decomposed swap", "qubit[2] q;\nswap q[0], q[1];\n", "qubit[2] q;\ncx q[0], q[1];\ncx q[1], q[0];\ncx q[0], q[1];\n", nil, true},
+		{"global phase", "qubit q;\nz q;\n", "qubit q;\nrz(pi) q;\n", nil, true},
+		{"broadcast", "qubit[2] q;\nh q;\n", "qubit[2] q;\nh q[1];\nh q[0];\n", nil, true},
+		{"user gate", "qubit[2] q;\ngate bell a, b { h a; cx a, b; }\nbell q[0], q[1];\n", "qubit[2] q;\nh q[0];\ncx q[0], q[1];\n", nil, true},
+		{"different", "qubit[2] q;\ncx q[0], q[1];\n", "qubit[2] q;\ncx q[1], q[0];\n", nil, false},
+		{"same on an input", "qubit[2] q;\ncx q[0], q[1];\n", "qubit[2] q;\ncz q[0], q[1];\n", []complex128{1, 0, 0, 0}, true},
+		{"hardware qubits", "cx $0, $2;\n", "h $2;\ncz $0, $2;\nh $2;\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := parser.NewParser().ParseString(header + tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := parser.NewParser().ParseString(header + tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Equivalent(a, b, &EquivalenceOptions{Input: tt.input})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Equivalent != tt.want {
+				t.Errorf("got %+v, want equivalent %v", got, tt.want)
+			}
+			if tt.want && got.Deviation > DefaultTolerance || !tt.want && got.Deviation < 0.1 {
+				t.Errorf("deviation %g", got.Deviation)
+			}
+		})
+	}
+}
+
+func TestEquivalentTolerance(t *testing.T) {
+	a, _ := parser.NewParser().ParseString("OPENQASM 3.0;\nqubit q;\nrz(0.5) q;\n")
+	b, _ := parser.NewParser().ParseString("OPENQASM 3.0;\nqubit q;\nrz(0.5001) q;\n")
+	strict, err := Equivalent(a, b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loose, err := Equivalent(a, b, &EquivalenceOptions{Tolerance: 1e-3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strict.Equivalent || !loose.Equivalent {
+		t.Errorf("got %+v and %+v", strict, loose)
+	}
+	if want := math.Sin(0.0001 / 2); math.Abs(strict.Deviation-want) > 1e-9 {
+		t.Errorf("deviation %g, want %g", strict.Deviation, want)
+	}
+}
+
+func TestEquivalentErrors(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"qubit[2] q;", "qubit[3] q;", "different qubits"},
+		{"qubit q;\nbit c;\nc = measure q;", "qubit q;", "not part of a unitary circuit"},
+		{"qubit q;\nreset q;", "qubit q;", "3:1: Reset is not part of a unitary circuit"},
+	}
+	for _, tt := range tests {
+		a, _ := parser.NewParser().ParseString("OPENQASM 3.0;\n" + tt.a + "\n")
+		b, _ := parser.NewParser().ParseString("OPENQASM 3.0;\n" + tt.b + "\n")
+		_, err := Equivalent(a, b, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got error %v, want %q", tt.a, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// constants are the values of OpenQASM's predefined constants
+var constants = map[string]float64{
+	"pi": math.Pi, "π": math.Pi, "tau": 2 * math.Pi, "τ": 2 * math.Pi, "euler": math.E, "ℇ": math.E,
+}
+
+// functions are the predefined functions of one real argument
+var functions = map[string]func(float64) float64{
+	"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	"arcsin": math.Asin, "arccos": math.Acos, "arctan": math.Atan,
+	"exp": math.Exp, "log": math.Log, "sqrt": math.Sqrt,
+	"floor": math.Floor, "ceiling": math.Ceil,
+}
+
+// Evaluate returns the value of a real-valued expression such as a gate
+// parameter. Identifiers are looked up in env, then among the predefined
+// constants; expressions naming anything else, or using operators and
+// functions without a real value, are an error.
+func Evaluate(expr parser.Expression, env map[string]float64) (float64, error) {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral:
+		return float64(e.Value), nil
+	case *parser.FloatLiteral:
+		return e.Value, nil
+	case *parser.Identifier:
+		if v, ok := env[e.Name]; ok {
+			return v, nil
+		}
+		if v, ok := constants[e.Name]; ok {
+			return v, nil
+		}
+		return 0, fmt.Errorf("%s has no known value", e.Name)
+	case *parser.ParenthesizedExpression:
+		return Evaluate(e.Expression, env)
+	case *parser.UnaryExpression:
+		v, err := Evaluate(e.Operand, env)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Operator {
+		case "-":
+			return -v, nil
+		case "+":
+			return v, nil
+		}
+	case *parser.BinaryExpression:
+		l, err := Evaluate(e.Left, env)
+		if err != nil {
+			return 0, err
+		}
+		r, err := Evaluate(e.Right, env)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Operator {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/":
+			if r == 0 {
+				return 0, fmt.Errorf("division by zero in %s", printer.Expression(expr))
+			}
+			return l / r, nil
+		case "**":
+			return math.Pow(l, r), nil
+		}
+	case *parser.FunctionCall:
+		f, ok := functions[e.Name]
+		if ok && len(e.Arguments) == 1 {
+			v, err := Evaluate(e.Arguments[0], env)
+			if err != nil {
+				return 0, err
+			}
+			return f(v), nil
+		}
+		if e.Name == "pow" && len(e.Arguments) == 2 {
+			x, err := Evaluate(e.Arguments[0], env)
+			if err != nil {
+				return 0, err
+			}
+			y, err := Evaluate(e.Arguments[1], env)
+			if err != nil {
+				return 0, err
+			}
+			return math.Pow(x, y), nil
+		}
+	}
+	return 0, fmt.Errorf("%s is not a real expression", printer.Expression(expr))
+}
@@ -0,0 +1,84 @@
+package sim
+
+import (
+	"fmt"
+	"math/cmplx"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// PauliString is an observable that is a product of Pauli operators, one
+// letter of I, X, Y or Z per qubit in the order of Machine.Qubits: ZZI is
+// Z on the first two qubits of a three-qubit program
+type PauliString string
+
+var paulis = map[rune]Matrix{
+	'X': {{0, 1}, {1, 0}},
+	'Y': {{0, -1i}, {1i, 0}},
+	'Z': {{1, 0}, {0, -1}},
+}
+
+// Expectation returns ⟨ψ|O|ψ⟩ for the state ψ program prepares and the
+// observable O. The program runs as on a Machine, but may not measure or
+// reset qubits, which would make ψ depend on the outcomes.
+func Expectation(program *parser.Program, observable PauliString) (float64, error) {
+	c := &collapses{}
+	parser.Walk(parser.NewDepthFirstVisitor(c), program)
+	if c.first != nil {
+		return 0, fmt.Errorf("%s: expectation values need a program without measurements or resets", position(c.first))
+	}
+	m, err := NewMachine(program, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(observable) != len(m.qubits) {
+		return 0, fmt.Errorf("observable %s has %d letters for %d qubits", observable, len(observable), len(m.qubits))
+	}
+	if err := m.Run(); err != nil {
+		return 0, err
+	}
+
+	applied := m.State()
+	for q, letter := range string(observable) {
+		if letter == 'I' {
+			continue
+		}
+		pauli, ok := paulis[letter]
+		if !ok {
+			return 0, fmt.Errorf("observable %s has %c, not one of I, X, Y and Z", observable, letter)
+		}
+		Apply(applied, pauli, []int{q})
+	}
+	var sum complex128
+	for i, a := range m.state {
+		sum += mul(cmplx.Conj(a), applied[i])
+	}
+	return real(sum), nil
+}
+
+// collapses finds the first measurement or reset of a program
+type collapses struct {
+	parser.BaseVisitor
+	first parser.Node
+}
+
+func (c *collapses) found(node parser.Node) {
+	if c.first == nil || node.Pos().Offset < c.first.Pos().Offset {
+		c.first = node
+	}
+}
+
+func (c *collapses) VisitMeasurement(node *parser.Measurement) interface{} {
+	c.found(node)
+	return nil
+}
+
+func (c *collapses) VisitMeasureExpression(node *parser.MeasureExpression) interface{} {
+	c.found(node)
+	return nil
+}
+
+func (c *collapses) VisitReset(node *parser.Reset) interface{} {
+	c.found(node)
+	return nil
+}
@@ -0,0 +1,58 @@
+package sim
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestExpectation(t *testing.T) {
+	program, err := parser.NewParser().ParseString(`OPENQASM 3.0;
+include "stdgates.inc";
+qubit[3] q;
+h q[0];
+cx q[0], q[1];
+ry(0.6) q[2];
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		observable PauliString
+		want       float64
+	}{
+		{"III", 1},
+		{"ZZI", 1},
+		{"XXI", 1},
+		{"YYI", -1},
+		{"ZII", 0},
+		{"IIZ", math.Cos(0.6)},
+		{"IIX", math.Sin(0.6)},
+		{"ZZZ", math.Cos(0.6)},
+	}
+	for _, tt := range tests {
+		got, err := Expectation(program, tt.observable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("Expectation(%s) = %g, want %g", tt.observable, got, tt.want)
+		}
+	}
+
+	for observable, want := range map[PauliString]string{"ZZ": "2 letters for 3 qubits", "ZQI": "has Q"} {
+		if _, err := Expectation(program, observable); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expectation(%s) error = %v", observable, err)
+		}
+	}
+
+	measured, err := parser.NewParser().ParseString("OPENQASM 3.0;\nqubit q;\nbit c;\nh q;\nc = measure q;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Expectation(measured, "Z"); err == nil || !strings.HasPrefix(err.Error(), "5:1: ") {
+		t.Errorf("Expectation() of a measured program error = %v", err)
+	}
+}
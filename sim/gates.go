@@ -0,0 +1,119 @@
+package sim
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// standard are the gates of stdgates.inc and qelib1.inc with a fixed
+// matrix, by name, and the number of parameters each takes
+var standard = map[string]struct {
+	params int
+	matrix func(p []float64) Matrix
+}{
+	"id":     {0, func([]float64) Matrix { return Identity(2) }},
+	"u0":     {1, func([]float64) Matrix { return Identity(2) }},
+	"x":      {0, func([]float64) Matrix { return Matrix{{0, 1}, {1, 0}} }},
+	"y":      {0, func([]float64) Matrix { return Matrix{{0, -1i}, {1i, 0}} }},
+	"z":      {0, func([]float64) Matrix { return phase(math.Pi) }},
+	"h":      {0, func([]float64) Matrix { return Matrix{{1, 1}, {1, -1}}.Scale(complex(1/math.Sqrt2, 0)) }},
+	"s":      {0, func([]float64) Matrix { return phase(math.Pi / 2) }},
+	"sdg":    {0, func([]float64) Matrix { return phase(-math.Pi / 2) }},
+	"t":      {0, func([]float64) Matrix { return phase(math.Pi / 4) }},
+	"tdg":    {0, func([]float64) Matrix { return phase(-math.Pi / 4) }},
+	"sx":     {0, func([]float64) Matrix { return sx() }},
+	"sxdg":   {0, func([]float64) Matrix { return sx().Dagger() }},
+	"rx":     {1, func(p []float64) Matrix { return rx(p[0]) }},
+	"ry":     {1, func(p []float64) Matrix { return ry(p[0]) }},
+	"rz":     {1, func(p []float64) Matrix { return rz(p[0]) }},
+	"p":      {1, func(p []float64) Matrix { return phase(p[0]) }},
+	"phase":  {1, func(p []float64) Matrix { return phase(p[0]) }},
+	"u1":     {1, func(p []float64) Matrix { return phase(p[0]) }},
+	"u2":     {2, func(p []float64) Matrix { return U(math.Pi/2, p[0], p[1]) }},
+	"u3":     {3, func(p []float64) Matrix { return U(p[0], p[1], p[2]) }},
+	"u":      {3, func(p []float64) Matrix { return U(p[0], p[1], p[2]) }},
+	"U":      {3, func(p []float64) Matrix { return U(p[0], p[1], p[2]) }},
+	"cx":     {0, func([]float64) Matrix { return Controlled(Matrix{{0, 1}, {1, 0}}) }},
+	"CX":     {0, func([]float64) Matrix { return Controlled(Matrix{{0, 1}, {1, 0}}) }},
+	"cy":     {0, func([]float64) Matrix { return Controlled(Matrix{{0, -1i}, {1i, 0}}) }},
+	"cz":     {0, func([]float64) Matrix { return Controlled(phase(math.Pi)) }},
+	"ch":     {0, func([]float64) Matrix { return Controlled(Matrix{{1, 1}, {1, -1}}.Scale(complex(1/math.Sqrt2, 0))) }},
+	"csx":    {0, func([]float64) Matrix { return Controlled(sx()) }},
+	"cp":     {1, func(p []float64) Matrix { return Controlled(phase(p[0])) }},
+	"cphase": {1, func(p []float64) Matrix { return Controlled(phase(p[0])) }},
+	"cu1":    {1, func(p []float64) Matrix { return Controlled(phase(p[0])) }},
+	"crx":    {1, func(p []float64) Matrix { return Controlled(rx(p[0])) }},
+	"cry":    {1, func(p []float64) Matrix { return Controlled(ry(p[0])) }},
+	"crz":    {1, func(p []float64) Matrix { return Controlled(rz(p[0])) }},
+	"cu3":    {3, func(p []float64) Matrix { return Controlled(U(p[0], p[1], p[2])) }},
+	"cu": {4, func(p []float64) Matrix {
+		return Controlled(U(p[0], p[1], p[2]).Scale(cmplx.Exp(complex(0, p[3]))))
+	}},
+	"swap": {0, func([]float64) Matrix {
+		return Matrix{{1, 0, 0, 0}, {0, 0, 1, 0}, {0, 1, 0, 0}, {0, 0, 0, 1}}
+	}},
+	"rxx": {1, func(p []float64) Matrix {
+		c, s := complex(math.Cos(p[0]/2), 0), complex(0, -math.Sin(p[0]/2))
+		return Matrix{{c, 0, 0, s}, {0, c, s, 0}, {0, s, c, 0}, {s, 0, 0, c}}
+	}},
+	"rzz": {1, func(p []float64) Matrix {
+		a, b := cmplx.Exp(complex(0, -p[0]/2)), cmplx.Exp(complex(0, p[0]/2))
+		return Matrix{{a, 0, 0, 0}, {0, b, 0, 0}, {0, 0, b, 0}, {0, 0, 0, a}}
+	}},
+	"ccx": {0, func([]float64) Matrix { return Controlled(Controlled(Matrix{{0, 1}, {1, 0}})) }},
+	"cswap": {0, func([]float64) Matrix {
+		return Controlled(Matrix{{1, 0, 0, 0}, {0, 0, 1, 0}, {0, 1, 0, 0}, {0, 0, 0, 1}})
+	}},
+}
+
+// Gate returns the matrix of a standard gate for the given parameter
+// values, false if name is not a standard gate or takes a different
+// number of parameters
+func Gate(name string, params []float64) (Matrix, bool) {
+	g, ok := standard[name]
+	if !ok || len(params) != g.params {
+		return nil, false
+	}
+	return g.matrix(params), true
+}
+
+// U returns the matrix of the builtin gate U(θ, φ, λ)
+func U(theta, phi, lambda float64) Matrix {
+	c, s := math.Cos(theta/2), math.Sin(theta/2)
+	return Matrix{
+		{complex(c, 0), -cmplx.Exp(complex(0, lambda)) * complex(s, 0)},
+		{cmplx.Exp(complex(0, phi)) * complex(s, 0), cmplx.Exp(complex(0, phi+lambda)) * complex(c, 0)},
+	}
+}
+
+// Controlled returns m controlled by one more qubit, which comes first
+func Controlled(m Matrix) Matrix {
+	n := len(m)
+	out := Identity(2 * n)
+	for i := range n {
+		copy(out[n+i][n:], m[i])
+	}
+	return out
+}
+
+func phase(lambda float64) Matrix {
+	return Matrix{{1, 0}, {0, cmplx.Exp(complex(0, lambda))}}
+}
+
+func rx(theta float64) Matrix {
+	c, s := complex(math.Cos(theta/2), 0), complex(0, -math.Sin(theta/2))
+	return Matrix{{c, s}, {s, c}}
+}
+
+func ry(theta float64) Matrix {
+	c, s := complex(math.Cos(theta/2), 0), complex(math.Sin(theta/2), 0)
+	return Matrix{{c, -s}, {s, c}}
+}
+
+func rz(theta float64) Matrix {
+	return Matrix{{cmplx.Exp(complex(0, -theta/2)), 0}, {0, cmplx.Exp(complex(0, theta/2))}}
+}
+
+func sx() Matrix {
+	return Matrix{{0.5 + 0.5i, 0.5 - 0.5i}, {0.5 - 0.5i, 0.5 + 0.5i}}
+}
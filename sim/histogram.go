@@ -0,0 +1,122 @@
+package sim
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Counts maps the outcomes of shots, as Machine.Outcome writes them, to
+// the number of shots that gave them
+type Counts map[string]int
+
+// Sample runs program shots times on fresh machines sharing one source
+// of randomness, seeded as for a single run, and counts the outcomes. The snapshots of dump pragmas
+// are not taken.
+func Sample(program *parser.Program, shots int, opts *RunOptions) (Counts, error) {
+	var o RunOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.Rand = o.random(program)
+	o.Dump = nil
+	counts := make(Counts)
+	for range shots {
+		m, err := NewMachine(program, &o)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Run(); err != nil {
+			return nil, err
+		}
+		counts[m.Outcome()]++
+	}
+	return counts, nil
+}
+
+// Bin is an outcome of a histogram
+type Bin struct {
+	Bitstring   string  `json:"bitstring"`
+	Count       int     `json:"count"`
+	Probability float64 `json:"probability"`
+}
+
+// Histogram returns the outcomes, most frequent first and in bitstring
+// order among equals, with their share of all shots
+func (c Counts) Histogram() []Bin {
+	total := 0
+	for _, n := range c {
+		total += n
+	}
+	bins := make([]Bin, 0, len(c))
+	for bitstring, n := range c {
+		bins = append(bins, Bin{Bitstring: bitstring, Count: n, Probability: float64(n) / float64(total)})
+	}
+	sort.Slice(bins, func(i, j int) bool {
+		if bins[i].Count != bins[j].Count {
+			return bins[i].Count > bins[j].Count
+		}
+		return bins[i].Bitstring < bins[j].Bitstring
+	})
+	return bins
+}
+
+// top returns the first n bins, or all of them if n is not positive
+func top(bins []Bin, n int) []Bin {
+	if n > 0 && len(bins) > n {
+		return bins[:n]
+	}
+	return bins
+}
+
+// WriteHistogram writes the top bins, or all of them if n is not
+// positive, with bars scaled to the largest:
+//
+//	OUTCOME  COUNT  PROBABILITY
+//	00       514    0.5020  ████████████████████
+//	11       510    0.4980  ███████████████████
+func WriteHistogram(w io.Writer, bins []Bin, n int) error {
+	bins = top(bins, n)
+	const width = 20
+	most := 0
+	for _, b := range bins {
+		most = max(most, b.Count)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OUTCOME\tCOUNT\tPROBABILITY")
+	for _, b := range bins {
+		bar := strings.Repeat("█", max(b.Count*width/most, 1))
+		fmt.Fprintf(tw, "%s\t%d\t%.4f\t%s\n", b.Bitstring, b.Count, b.Probability, bar)
+	}
+	return tw.Flush()
+}
+
+// WriteHistogramJSON writes the top bins, or all of them if n is not
+// positive, as a JSON array
+func WriteHistogramJSON(w io.Writer, bins []Bin, n int) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(top(bins, n))
+}
+
+// WriteHistogramCSV writes the top bins, or all of them if n is not
+// positive, as CSV with a header row:
+//
+//	bitstring,count,probability
+//	00,514,0.501953125
+func WriteHistogramCSV(w io.Writer, bins []Bin, n int) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"bitstring", "count", "probability"})
+	for _, b := range top(bins, n) {
+		cw.Write([]string{b.Bitstring, strconv.Itoa(b.Count), strconv.FormatFloat(b.Probability, 'g', -1, 64)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
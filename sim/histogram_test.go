@@ -0,0 +1,126 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestSample(t *testing.T) {
+	program, err := parser.NewParser().ParseString(`OPENQASM 3.0;
+include "stdgates.inc";
+qubit[3] q;
+bit[2] c;
+bit flag;
+h q[0];
+cx q[0], q[1];
+x q[2];
+c = measure q[0:1];
+flag = measure q[2];
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err := Sample(program, 200, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts["1 00"]+counts["1 11"] != 200 || counts["1 00"] < 70 || counts["1 11"] < 70 {
+		t.Errorf("counts = %v", counts)
+	}
+	again, err := Sample(program, 200, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again["1 00"] != counts["1 00"] {
+		t.Errorf("samples differ: %v and %v", counts, again)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	bins := Counts{"01": 1, "00": 5, "11": 5, "10": 2}.Histogram()
+	var order []string
+	for _, b := range bins {
+		order = append(order, b.Bitstring)
+	}
+	if strings.Join(order, " ") != "00 11 10 01" || bins[0].Probability != 5.0/13 {
+		t.Fatalf("bins = %+v", bins)
+	}
+
+	var text bytes.Buffer
+	if err := WriteHistogram(&text, bins, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := "OUTCOME  COUNT  PROBABILITY\n" +
+		"00       5      0.3846  ████████████████████\n" +
+		"11       5      0.3846  ████████████████████\n"
+	if text.String() != want {
+		t.Errorf("text =\n%s\nwant\n%s", text.String(), want)
+	}
+
+	var js bytes.Buffer
+	if err := WriteHistogramJSON(&js, bins, 0); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Bin
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil || len(decoded) != 4 || decoded[3] != bins[3] {
+		t.Errorf("JSON = %s (%v)", js.String(), err)
+	}
+
+	var csv bytes.Buffer
+	if err := WriteHistogramCSV(&csv, bins, 1); err != nil {
+		t.Fatal(err)
+	}
+	if want := "bitstring,count,probability\n00,5,0.38461538461538464\n"; csv.String() != want {
+		t.Errorf("CSV = %q, want %q", csv.String(), want)
+	}
+}
+
+func TestSampleSeed(t *testing.T) {
+	const source = `OPENQASM 3.0;
+include "stdgates.inc";
+pragma seed 7
+qubit[2] q;
+bit[2] c;
+ry(1.1) q[0];
+h q[1];
+crz(0.4) q[1], q[0];
+c = measure q;
+`
+	program, err := parser.NewParser().ParseString(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err := Sample(program, 1000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The counts for seed 7 are part of the reproducibility contract: a
+	// change here breaks the pipelines that pin them
+	want := Counts{"00": 362, "01": 126, "10": 378, "11": 134}
+	for outcome, n := range want {
+		if counts[outcome] != n {
+			t.Fatalf("counts = %v, want %v", counts, want)
+		}
+	}
+
+	seed := int64(7)
+	same, err := Sample(program, 1000, &RunOptions{Seed: &seed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed = 8
+	other, err := Sample(program, 1000, &RunOptions{Seed: &seed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same["00"] != want["00"] || same["11"] != want["11"] {
+		t.Errorf("seed 7 gave %v, pragma seed 7 gave %v", same, counts)
+	}
+	if other["00"] == want["00"] && other["11"] == want["11"] {
+		t.Errorf("seeds 7 and 8 both gave %v", other)
+	}
+}
@@ -0,0 +1,136 @@
+// Package sim computes the unitaries of small circuits, for passes that
+// rewrite gates numerically and for checking that a rewrite kept the
+// circuit's effect. Matrices are dense, so it is meant for a handful of
+// qubits. Machine and Sample run whole programs on a state vector of up
+// to MaxStateQubits qubits.
+//
+// Runs are reproducible: for a fixed seed, a program gives the same
+// outcomes, counts and snapshots on every run and every platform. The
+// only randomness is the seeded math/rand source, whose sequence Go keeps
+// fixed; amplitudes are summed in a fixed order, and products are rounded
+// before they are summed, so that platforms with fused multiply-add round
+// as others do. Tests and pipelines may rely on exact results. The one
+// exception is a program calling exp or log, which the math package
+// computes with code specific to some platforms.
+//
+// The first qubit a gate acts on is the most significant bit of a
+// matrix index: cx is
+//
+//	1 0 0 0
+//	0 1 0 0
+//	0 0 0 1
+//	0 0 1 0
+package sim
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Matrix is a square complex matrix, row by row
+type Matrix [][]complex128
+
+// Identity returns the n×n identity matrix
+func Identity(n int) Matrix {
+	m := zero(n)
+	for i := range n {
+		m[i][i] = 1
+	}
+	return m
+}
+
+func zero(n int) Matrix {
+	m := make(Matrix, n)
+	for i := range m {
+		m[i] = make([]complex128, n)
+	}
+	return m
+}
+
+// Size returns the number of rows of m
+func (m Matrix) Size() int {
+	return len(m)
+}
+
+// Mul returns the product m·b: b is applied first, then m
+func (m Matrix) Mul(b Matrix) Matrix {
+	n := len(m)
+	out := zero(n)
+	for i := range n {
+		for k := range n {
+			if m[i][k] == 0 {
+				continue
+			}
+			for j := range n {
+				out[i][j] += mul(m[i][k], b[k][j])
+			}
+		}
+	}
+	return out
+}
+
+// mul returns a·b. Each product is rounded before it is summed, so that
+// no platform fuses them into a multiply-add that rounds differently.
+func mul(a, b complex128) complex128 {
+	return complex(
+		float64(real(a)*real(b))-float64(imag(a)*imag(b)),
+		float64(real(a)*imag(b))+float64(imag(a)*real(b)),
+	)
+}
+
+// probability returns |a|², rounded as mul rounds
+func probability(a complex128) float64 {
+	return float64(real(a)*real(a)) + float64(imag(a)*imag(a))
+}
+
+// Dagger returns the conjugate transpose of m
+func (m Matrix) Dagger() Matrix {
+	n := len(m)
+	out := zero(n)
+	for i := range n {
+		for j := range n {
+			out[j][i] = cmplx.Conj(m[i][j])
+		}
+	}
+	return out
+}
+
+// Scale returns m multiplied by c
+func (m Matrix) Scale(c complex128) Matrix {
+	out := zero(len(m))
+	for i := range m {
+		for j := range m[i] {
+			out[i][j] = mul(c, m[i][j])
+		}
+	}
+	return out
+}
+
+// Distance returns the largest difference between an entry of a and the
+// same entry of b, once b is multiplied by the global phase that brings
+// it closest to a. It is zero when the matrices differ only in global
+// phase, which no measurement can observe. Matrices of different sizes
+// are infinitely far apart.
+func Distance(a, b Matrix) float64 {
+	if len(a) != len(b) {
+		return math.Inf(1)
+	}
+	// The phase of the trace of b†a aligns b with a
+	var overlap complex128
+	for i := range a {
+		for j := range a[i] {
+			overlap += cmplx.Conj(b[i][j]) * a[i][j]
+		}
+	}
+	phase := complex(1, 0)
+	if cmplx.Abs(overlap) > 0 {
+		phase = overlap / complex(cmplx.Abs(overlap), 0)
+	}
+	var d float64
+	for i := range a {
+		for j := range a[i] {
+			d = max(d, cmplx.Abs(a[i][j]-phase*b[i][j]))
+		}
+	}
+	return d
+}
@@ -0,0 +1,1013 @@
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/endian"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/stdlib"
+)
+
+// MaxStateQubits is the most qubits a Machine simulates; the state of n
+// qubits has 2^n amplitudes
+const MaxStateQubits = 20
+
+// DefaultMaxSteps is the number of statements a Machine executes before
+// giving up on a program that does not end
+const DefaultMaxSteps = 1_000_000
+
+// RunOptions configures a Machine
+type RunOptions struct {
+	// Seed seeds the draws of measurement outcomes. Nil means the seed
+	// the program's seed pragma gives, or 0.
+	Seed *int64
+
+	// Rand, if set, draws measurement outcomes instead, for callers that
+	// share one source between runs
+	Rand *rand.Rand
+
+	// MaxSteps bounds the statements the machine executes, so that a
+	// loop that does not end is an error. Zero means DefaultMaxSteps.
+	MaxSteps int
+
+	// Dump, if set, receives each snapshot the program's dump pragmas
+	// take as a line of JSON, as it is taken
+	Dump io.Writer
+
+	// Noise, if set, runs the program on a density matrix, adding the
+	// noise its gates have in the library after each call and its
+	// readout error to each measurement. A library without noise runs
+	// the program exactly, as a mixed state.
+	Noise *stdlib.Library
+}
+
+// random returns the source a run of program draws outcomes from
+func (o *RunOptions) random(program *parser.Program) *rand.Rand {
+	if o.Rand != nil {
+		return o.Rand
+	}
+	var seed int64
+	switch {
+	case o.Seed != nil:
+		seed = *o.Seed
+	case program.Run != nil && program.Run.Seed != nil:
+		seed = *program.Run.Seed
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// Snapshot is the state of a simulation at a dump pragma. Only basis
+// states with a nonzero amplitude are listed; they are spelled as
+// bitstrings with the first qubit leftmost, such as 01 for q[1] set.
+type Snapshot struct {
+	Kind     parser.DumpKind `json:"kind"`
+	Label    string          `json:"label,omitempty"`
+	Position parser.Position `json:"position"`
+	Qubits   []string        `json:"qubits"`
+
+	// Probabilities are taken by dump_probs, and State, the amplitudes as
+	// real and imaginary parts, by dump_state. On a density matrix,
+	// dump_state takes Density instead, its entries keyed by row and
+	// column, such as "01,11".
+	Probabilities map[string]float64    `json:"probabilities,omitempty"`
+	State         map[string][2]float64 `json:"state,omitempty"`
+	Density       map[string][2]float64 `json:"density,omitempty"`
+}
+
+// Machine executes a program on a state vector, or with noise on a
+// density matrix, one statement at a time.
+// It runs gate calls, including those of gates the program defines,
+// measurements, resets and barriers, classical declarations and
+// assignments, and if, for and while statements; bit registers hold
+// integers whose bit i is element i. Subroutines, arrays and timing are
+// not simulated and are an error when reached.
+type Machine struct {
+	gates Gates
+	rng   *rand.Rand
+
+	// qubits are the names of the qubits, first most significant, and
+	// registers the indices of the qubits of each quantum register
+	qubits    []string
+	registers map[string][]int
+	state     []complex128
+
+	// noise is the library of a machine running on a density matrix ρ,
+	// nil on a state vector. ρ is stored in state row by row, so that an
+	// index is the row's qubits followed by the column's.
+	noise *stdlib.Library
+
+	// env holds the classical variables and constants; types the type
+	// and width each variable was declared with
+	env   analysis.Constants
+	types map[string]declared
+
+	// bits are the bit registers in the order first declared
+	bits []string
+
+	stack    []*block
+	steps    int
+	maxSteps int
+
+	// dumps are the dump pragmas not reached yet
+	dumps     []parser.Dump
+	dump      io.Writer
+	snapshots []Snapshot
+}
+
+type declared struct {
+	typ   string
+	width int
+}
+
+// block is a list of statements being executed, with the loop that runs
+// it again, if any
+type block struct {
+	statements []parser.Statement
+	next       int
+
+	// A for loop runs the block once per value, with its variable set to
+	// each; saved is the variable's value outside the loop
+	loop     *parser.ForStatement
+	values   []analysis.Value
+	index    int
+	saved    analysis.Value
+	hadSaved bool
+
+	// A while loop runs the block while its condition holds
+	while *parser.WhileStatement
+}
+
+// NewMachine prepares program to run from |0...0⟩. The qubits are those
+// of its quantum registers in declaration order, whose sizes must be
+// constant, or else the hardware qubits it uses.
+func NewMachine(program *parser.Program, opts *RunOptions) (*Machine, error) {
+	if opts == nil {
+		opts = &RunOptions{}
+	}
+	m := &Machine{
+		gates:     GatesOf(program),
+		rng:       opts.random(program),
+		registers: make(map[string][]int),
+		env:       make(analysis.Constants),
+		types:     make(map[string]declared),
+		maxSteps:  opts.MaxSteps,
+		dump:      opts.Dump,
+		noise:     opts.Noise,
+	}
+	limit := MaxStateQubits
+	if m.noise != nil {
+		limit = MaxDensityQubits
+	}
+	if program.Run != nil {
+		m.dumps = program.Run.Dumps
+	}
+	if m.maxSteps == 0 {
+		m.maxSteps = DefaultMaxSteps
+	}
+	consts, _ := analysis.EvaluateConstants(program)
+	for _, stmt := range program.Statements {
+		decl, ok := stmt.(*parser.QuantumDeclaration)
+		if !ok {
+			continue
+		}
+		if decl.Size == nil {
+			m.registers[decl.Identifier] = []int{len(m.qubits)}
+			m.qubits = append(m.qubits, decl.Identifier)
+			continue
+		}
+		size, ok := consts.Int(decl.Size)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("%s: register %s has no constant size", position(decl), decl.Identifier)
+		}
+		if len(m.qubits)+int(size) > limit {
+			return nil, fmt.Errorf("the program has more than %d qubits", limit)
+		}
+		indices := make([]int, size)
+		for i := range indices {
+			indices[i] = len(m.qubits)
+			m.qubits = append(m.qubits, decl.Identifier+"["+strconv.Itoa(i)+"]")
+		}
+		m.registers[decl.Identifier] = indices
+	}
+	if len(m.qubits) == 0 {
+		m.qubits = hardwareQubits(program)
+		if len(m.qubits) > limit {
+			return nil, fmt.Errorf("the program has more than %d qubits", limit)
+		}
+		for i, q := range m.qubits {
+			m.registers[q] = []int{i}
+		}
+	}
+	size := 1 << len(m.qubits)
+	if m.noise != nil {
+		size *= size
+	}
+	m.state = make([]complex128, size)
+	m.state[0] = 1
+	m.enter(&block{statements: program.Statements})
+	if err := m.snapshot(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Qubits returns the names of the qubits, such as q[0] or $3, first most
+// significant
+func (m *Machine) Qubits() []string {
+	return m.qubits
+}
+
+// State returns a copy of the state vector, indexed with the first qubit
+// most significant, or nil when the machine runs on a density matrix
+func (m *Machine) State() []complex128 {
+	if m.noise != nil {
+		return nil
+	}
+	return append([]complex128(nil), m.state...)
+}
+
+// Probabilities returns the probability of each basis state
+func (m *Machine) Probabilities() []float64 {
+	if m.noise != nil {
+		dim := 1 << len(m.qubits)
+		probs := make([]float64, dim)
+		for i := range probs {
+			probs[i] = real(m.state[i*dim+i])
+		}
+		return probs
+	}
+	probs := make([]float64, len(m.state))
+	for i, a := range m.state {
+		probs[i] = probability(a)
+	}
+	return probs
+}
+
+// Variables returns the values of the classical variables and constants
+// declared so far, by name. A bit register is an integer whose bit i is
+// element i.
+func (m *Machine) Variables() map[string]analysis.Value {
+	vars := make(map[string]analysis.Value, len(m.env))
+	for name, v := range m.env {
+		vars[name] = v
+	}
+	return vars
+}
+
+// Outcome returns the bit registers as a bitstring, written as Qiskit
+// writes counts: each register little endian, the register declared last
+// first, separated by spaces
+func (m *Machine) Outcome() string {
+	parts := make([]string, 0, len(m.bits))
+	for i := len(m.bits) - 1; i >= 0; i-- {
+		name := m.bits[i]
+		parts = append(parts, endian.LittleEndian.Bitstring(uint64(m.env[name].Int), m.types[name].width))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Steps returns the number of statements executed so far
+func (m *Machine) Steps() int {
+	return m.steps
+}
+
+// Next returns the statement Step executes next, or nil when the program
+// has ended
+func (m *Machine) Next() parser.Statement {
+	if len(m.stack) == 0 {
+		return nil
+	}
+	top := m.stack[len(m.stack)-1]
+	return top.statements[top.next]
+}
+
+// Done reports whether the program has ended
+func (m *Machine) Done() bool {
+	return len(m.stack) == 0
+}
+
+// Run executes the rest of the program
+func (m *Machine) Run() error {
+	for !m.Done() {
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step executes the next statement. Entering an if, for or while
+// statement is a step of its own, and so is each statement of its body.
+// Once the machine has executed MaxSteps statements, Step fails instead.
+func (m *Machine) Step() error {
+	if m.Done() {
+		return errors.New("the program has ended")
+	}
+	if m.steps >= m.maxSteps {
+		return fmt.Errorf("%s: stopped after %d statements", position(m.Next()), m.maxSteps)
+	}
+	top := m.stack[len(m.stack)-1]
+	stmt := top.statements[top.next]
+	top.next++
+	m.steps++
+	if err := m.execute(stmt); err != nil {
+		// Errors from building gate matrices carry their position already
+		if strings.HasPrefix(err.Error(), position(stmt)+": ") {
+			return err
+		}
+		return fmt.Errorf("%s: %w", position(stmt), err)
+	}
+	if err := m.settle(); err != nil {
+		return err
+	}
+	return m.snapshot()
+}
+
+// Snapshots returns the snapshots the dump pragmas passed so far took
+func (m *Machine) Snapshots() []Snapshot {
+	return m.snapshots
+}
+
+// snapshot takes the dumps placed before the next statement. Pragmas are
+// only allowed at the top level, so none are due inside a block.
+func (m *Machine) snapshot() error {
+	if len(m.stack) > 1 {
+		return nil
+	}
+	for len(m.dumps) > 0 {
+		d := m.dumps[0]
+		if next := m.Next(); next != nil && next.Pos().Offset < d.Position.Offset {
+			return nil
+		}
+		m.dumps = m.dumps[1:]
+		snap := m.take(d)
+		m.snapshots = append(m.snapshots, snap)
+		if m.dump != nil {
+			if err := json.NewEncoder(m.dump).Encode(snap); err != nil {
+				return fmt.Errorf("%d:%d: %w", d.Position.Line, d.Position.Column, err)
+			}
+		}
+	}
+	return nil
+}
+
+// take returns the snapshot a dump asks for of the current state
+func (m *Machine) take(d parser.Dump) Snapshot {
+	snap := Snapshot{Kind: d.Kind, Label: d.Label, Position: d.Position, Qubits: m.qubits}
+	n := len(m.qubits)
+	if d.Kind == parser.DumpProbabilities {
+		for i, p := range m.Probabilities() {
+			if p < 1e-18 {
+				continue
+			}
+			if snap.Probabilities == nil {
+				snap.Probabilities = make(map[string]float64)
+			}
+			snap.Probabilities[basis(i, n)] = p
+		}
+		return snap
+	}
+	for i, a := range m.state {
+		if cmplx.Abs(a) < 1e-9 {
+			continue
+		}
+		if m.noise != nil {
+			if snap.Density == nil {
+				snap.Density = make(map[string][2]float64)
+			}
+			snap.Density[basis(i>>n, n)+","+basis(i&(1<<n-1), n)] = [2]float64{real(a), imag(a)}
+			continue
+		}
+		if snap.State == nil {
+			snap.State = make(map[string][2]float64)
+		}
+		snap.State[basis(i, n)] = [2]float64{real(a), imag(a)}
+	}
+	return snap
+}
+
+// basis spells basis state i of n qubits as a bitstring, first qubit
+// leftmost
+func basis(i, n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%0*b", n, i)
+}
+
+// settle leaves the stack on the next statement to execute, finishing
+// blocks and starting the next iteration of loops
+func (m *Machine) settle() error {
+	for len(m.stack) > 0 {
+		top := m.stack[len(m.stack)-1]
+		if top.next < len(top.statements) {
+			return nil
+		}
+		switch {
+		case top.loop != nil && top.index+1 < len(top.values):
+			top.index++
+			top.next = 0
+			m.env[top.loop.Variable] = top.values[top.index]
+			continue
+		case top.while != nil:
+			again, err := m.condition(top.while.Condition)
+			if err != nil {
+				return fmt.Errorf("%s: %w", position(top.while), err)
+			}
+			if again {
+				top.next = 0
+				continue
+			}
+		case top.loop != nil:
+			delete(m.env, top.loop.Variable)
+			if top.hadSaved {
+				m.env[top.loop.Variable] = top.saved
+			}
+		}
+		m.stack = m.stack[:len(m.stack)-1]
+	}
+	return nil
+}
+
+// enter pushes a block to execute next, unless it is empty
+func (m *Machine) enter(b *block) {
+	if len(b.statements) > 0 {
+		m.stack = append(m.stack, b)
+	}
+}
+
+func (m *Machine) execute(stmt parser.Statement) error {
+	switch s := stmt.(type) {
+	case *parser.Include, *parser.GateDefinition, *parser.SubroutineDefinition, *parser.QuantumDeclaration,
+		*parser.Barrier, *parser.CalibrationGrammar, *parser.CalibrationDefinition, *parser.Calibration:
+		return nil
+	case *parser.ClassicalDeclaration:
+		return m.declare(s)
+	case *parser.Assignment:
+		return m.assign(s)
+	case *parser.GateCall:
+		return m.call(s)
+	case *parser.Measurement:
+		bits, err := m.measure(s.Qubit)
+		if err != nil || s.Target == nil {
+			return err
+		}
+		return m.store(s.Target, bits)
+	case *parser.Reset:
+		qubits, err := m.operand(s.Qubit)
+		if err != nil {
+			return err
+		}
+		for _, q := range qubits {
+			if m.collapse(q) == 1 {
+				m.apply(Matrix{{0, 1}, {1, 0}}, []int{q})
+			}
+		}
+		return nil
+	case *parser.IfStatement:
+		ok, err := m.condition(s.Condition)
+		if err != nil {
+			return err
+		}
+		if ok {
+			m.enter(&block{statements: s.ThenBody})
+		} else {
+			m.enter(&block{statements: s.ElseBody})
+		}
+		return nil
+	case *parser.ForStatement:
+		values, err := m.iterate(s.Iterable)
+		if err != nil || len(values) == 0 || len(s.Body) == 0 {
+			return err
+		}
+		b := &block{statements: s.Body, loop: s, values: values}
+		b.saved, b.hadSaved = m.env[s.Variable]
+		m.env[s.Variable] = values[0]
+		m.enter(b)
+		return nil
+	case *parser.WhileStatement:
+		ok, err := m.condition(s.Condition)
+		if err != nil || !ok {
+			return err
+		}
+		if len(s.Body) == 0 {
+			// Test the condition again as the next step
+			m.stack[len(m.stack)-1].next--
+			return nil
+		}
+		m.enter(&block{statements: s.Body, while: s})
+		return nil
+	}
+	return fmt.Errorf("%s is not supported by the simulator", stmt)
+}
+
+// declare executes a classical declaration
+func (m *Machine) declare(d *parser.ClassicalDeclaration) error {
+	if d.Array != nil {
+		return fmt.Errorf("array %s is not supported by the simulator", d.Identifier)
+	}
+	t := declared{typ: d.Type}
+	if d.Size != nil {
+		width, err := m.evaluate(d.Size)
+		if err != nil {
+			return err
+		}
+		if width.Kind != analysis.Int || width.Int <= 0 || width.Int > 64 {
+			return fmt.Errorf("%s has no valid size", d.Identifier)
+		}
+		t.width = int(width.Int)
+	}
+	if d.Type == "bit" {
+		t.width = max(t.width, 1)
+		if _, ok := m.types[d.Identifier]; !ok {
+			m.bits = append(m.bits, d.Identifier)
+		}
+	}
+	m.types[d.Identifier] = t
+
+	if measure, ok := d.Initializer.(*parser.MeasureExpression); ok {
+		bits, err := m.measure(measure.Qubit)
+		if err != nil {
+			return err
+		}
+		return m.store(&parser.Identifier{Name: d.Identifier}, bits)
+	}
+	v := analysis.Value{Kind: analysis.Int}
+	if d.Initializer != nil {
+		var err error
+		if v, err = m.evaluate(d.Initializer); err != nil {
+			return err
+		}
+	}
+	return m.set(d.Identifier, v)
+}
+
+// set assigns v to a variable, converted to its type
+func (m *Machine) set(name string, v analysis.Value) error {
+	t, ok := m.types[name]
+	if !ok {
+		return fmt.Errorf("%s is not a classical variable", name)
+	}
+	converted, ok := analysis.Cast(v, t.typ, t.width)
+	if !ok {
+		return fmt.Errorf("cannot assign %s to %s of type %s", v, name, t.typ)
+	}
+	m.env[name] = converted
+	return nil
+}
+
+// assign executes an assignment, which may measure into bits
+func (m *Machine) assign(a *parser.Assignment) error {
+	if measure, ok := a.Value.(*parser.MeasureExpression); ok && a.Operator == "=" {
+		bits, err := m.measure(measure.Qubit)
+		if err != nil {
+			return err
+		}
+		return m.store(a.Target, bits)
+	}
+	value, err := m.evaluate(a.Value)
+	if err != nil {
+		return err
+	}
+	if a.Operator != "=" {
+		current, err := m.evaluate(a.Target)
+		if err != nil {
+			return err
+		}
+		op := strings.TrimSuffix(a.Operator, "=")
+		combined, ok := m.env.Evaluate(&parser.BinaryExpression{
+			Left: literal(current), Operator: op, Right: literal(value),
+		})
+		if !ok {
+			return fmt.Errorf("cannot apply %s to %s and %s", a.Operator, current, value)
+		}
+		value = combined
+	}
+	switch t := a.Target.(type) {
+	case *parser.Identifier:
+		return m.set(t.Name, value)
+	case *parser.IndexedIdentifier:
+		bit, ok := analysis.Cast(value, "bit", 1)
+		if !ok {
+			return fmt.Errorf("cannot assign %s to a bit", value)
+		}
+		return m.store(t, []int{int(bit.Int)})
+	}
+	return fmt.Errorf("cannot assign to %T", a.Target)
+}
+
+// store writes measured bits to a bit register, a single bit or one
+// element
+func (m *Machine) store(target parser.Expression, bits []int) error {
+	var name string
+	var first int
+	switch t := target.(type) {
+	case *parser.Identifier:
+		name = t.Name
+	case *parser.IndexedIdentifier:
+		name = t.Name
+		index, err := m.index(t.Index, m.types[name].width)
+		if err != nil {
+			return err
+		}
+		first = index
+	default:
+		return fmt.Errorf("cannot store measurements in %T", target)
+	}
+	t, ok := m.types[name]
+	if !ok {
+		return fmt.Errorf("%s is not a classical variable", name)
+	}
+	if t.typ != "bit" && t.typ != "int" && t.typ != "uint" {
+		return fmt.Errorf("cannot store measurements in %s of type %s", name, t.typ)
+	}
+	if target, ok := target.(*parser.Identifier); ok && len(bits) != t.width && t.width > 0 {
+		return fmt.Errorf("%d bits measured into %s of %d", len(bits), target.Name, t.width)
+	}
+	value := uint64(m.env[name].Int)
+	for i, bit := range bits {
+		mask := uint64(1) << (first + i)
+		value &^= mask
+		if bit == 1 {
+			value |= mask
+		}
+	}
+	return m.set(name, analysis.Value{Kind: analysis.Int, Int: int64(value)})
+}
+
+// call applies a gate call, broadcast over registers
+func (m *Machine) call(call *parser.GateCall) error {
+	// The matrix is built for parameters evaluated here, so gate bodies
+	// see numbers whatever the classical state
+	bound := *call
+	bound.Parameters = make([]parser.Expression, len(call.Parameters))
+	for i, p := range call.Parameters {
+		v, err := m.number(p)
+		if err != nil {
+			return err
+		}
+		bound.Parameters[i] = &parser.FloatLiteral{Value: v}
+	}
+	bound.Modifiers = make([]parser.Modifier, len(call.Modifiers))
+	for i, mod := range call.Modifiers {
+		bound.Modifiers[i] = parser.Modifier{BaseNode: mod.BaseNode, Type: mod.Type}
+		for _, p := range mod.Parameters {
+			v, err := m.number(p)
+			if err != nil {
+				return err
+			}
+			bound.Modifiers[i].Parameters = append(bound.Modifiers[i].Parameters, &parser.FloatLiteral{Value: v})
+		}
+	}
+
+	operands := make([][]int, len(call.Qubits))
+	width := 1
+	for i, op := range call.Qubits {
+		qubits, err := m.operand(op)
+		if err != nil {
+			return err
+		}
+		if len(qubits) > 1 {
+			if width > 1 && len(qubits) != width {
+				return errors.New("registers of different sizes in one call")
+			}
+			width = len(qubits)
+		}
+		operands[i] = qubits
+	}
+	u := &unitaries{gates: m.gates, active: make(map[string]bool)}
+	gate, err := u.call(&bound, nil)
+	if err != nil {
+		return err
+	}
+	for k := range width {
+		targets := make([]int, len(operands))
+		seen := make(map[int]bool)
+		for i, qubits := range operands {
+			targets[i] = qubits[0]
+			if len(qubits) > 1 {
+				targets[i] = qubits[k]
+			}
+			if seen[targets[i]] {
+				return fmt.Errorf("%s is given qubit %s twice", call.Name, m.qubits[targets[i]])
+			}
+			seen[targets[i]] = true
+		}
+		m.apply(gate, targets)
+		m.channels(call.Name, targets)
+	}
+	return nil
+}
+
+// measure measures the qubits of an operand in order, returning the bits
+func (m *Machine) measure(operand parser.Expression) ([]int, error) {
+	qubits, err := m.operand(operand)
+	if err != nil {
+		return nil, err
+	}
+	bits := make([]int, len(qubits))
+	for i, q := range qubits {
+		bits[i] = m.readout(m.collapse(q))
+	}
+	return bits, nil
+}
+
+// collapse measures qubit q, collapsing the state, and returns the
+// outcome
+func (m *Machine) collapse(q int) int {
+	if m.noise != nil {
+		return m.collapseDensity(q)
+	}
+	mask := 1 << (len(m.qubits) - 1 - q)
+	var one float64
+	for i, a := range m.state {
+		if i&mask != 0 {
+			one += probability(a)
+		}
+	}
+	outcome, p := 0, 1-one
+	if m.rng.Float64() < one {
+		outcome, p = 1, one
+	}
+	scale := complex(1/math.Sqrt(p), 0)
+	for i := range m.state {
+		if (i&mask != 0) == (outcome == 1) {
+			m.state[i] = mul(m.state[i], scale)
+		} else {
+			m.state[i] = 0
+		}
+	}
+	return outcome
+}
+
+// operand returns the indices of the qubits an operand names
+func (m *Machine) operand(op parser.Expression) ([]int, error) {
+	switch e := op.(type) {
+	case *parser.Identifier:
+		if qubits, ok := m.registers[e.Name]; ok {
+			return qubits, nil
+		}
+		return nil, fmt.Errorf("%s is not a qubit", e.Name)
+	case *parser.IndexedIdentifier:
+		register, ok := m.registers[e.Name]
+		if !ok || len(e.Indices) > 0 {
+			return nil, fmt.Errorf("%s is not a qubit", printer.Expression(op))
+		}
+		i, err := m.index(e.Index, len(register))
+		if err != nil {
+			return nil, err
+		}
+		return []int{register[i]}, nil
+	case *parser.RangedIdentifier:
+		register, ok := m.registers[e.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s is not a qubit register", e.Name)
+		}
+		start, err := m.index(e.Start, len(register))
+		if err != nil {
+			return nil, err
+		}
+		stop, err := m.index(e.EndIndex, len(register))
+		if err != nil {
+			return nil, err
+		}
+		if stop < start {
+			return nil, fmt.Errorf("%s selects no qubits", printer.Expression(op))
+		}
+		return register[start : stop+1], nil
+	}
+	return nil, fmt.Errorf("%s is not a qubit", printer.Expression(op))
+}
+
+// index evaluates an index into something of size elements; -1 is the
+// last
+func (m *Machine) index(expr parser.Expression, size int) (int, error) {
+	v, err := m.evaluate(expr)
+	if err != nil {
+		return 0, err
+	}
+	if v.Kind != analysis.Int {
+		return 0, fmt.Errorf("index %s is not an integer", printer.Expression(expr))
+	}
+	i := int(v.Int)
+	if i < 0 {
+		i += size
+	}
+	if i < 0 || i >= size {
+		return 0, fmt.Errorf("index %d is out of range for %d elements", v.Int, size)
+	}
+	return i, nil
+}
+
+// iterate returns the values a for loop runs over: a range, whose stop
+// is included, or a set of values
+func (m *Machine) iterate(iterable parser.Expression) ([]analysis.Value, error) {
+	switch e := iterable.(type) {
+	case *parser.RangeExpression:
+		start, err := m.evaluate(e.Start)
+		if err != nil {
+			return nil, err
+		}
+		stop, err := m.evaluate(e.Stop)
+		if err != nil {
+			return nil, err
+		}
+		step := analysis.Value{Kind: analysis.Int, Int: 1}
+		if e.Step != nil {
+			if step, err = m.evaluate(e.Step); err != nil {
+				return nil, err
+			}
+		}
+		if start.Kind != analysis.Int || stop.Kind != analysis.Int || step.Kind != analysis.Int || step.Int == 0 {
+			return nil, errors.New("the range is not of integers")
+		}
+		var values []analysis.Value
+		for i := start.Int; (step.Int > 0 && i <= stop.Int) || (step.Int < 0 && i >= stop.Int); i += step.Int {
+			values = append(values, analysis.Value{Kind: analysis.Int, Int: i})
+			if len(values) > DefaultMaxSteps {
+				return nil, errors.New("the range is too long")
+			}
+		}
+		return values, nil
+	case *parser.ArrayLiteral:
+		values := make([]analysis.Value, len(e.Elements))
+		for i, elem := range e.Elements {
+			v, err := m.evaluate(elem)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %s", printer.Expression(iterable))
+}
+
+// condition evaluates the condition of an if or while statement
+func (m *Machine) condition(expr parser.Expression) (bool, error) {
+	v, err := m.evaluate(expr)
+	if err != nil {
+		return false, err
+	}
+	b, ok := analysis.Cast(v, "bool", 0)
+	if !ok {
+		return false, fmt.Errorf("condition %s is not a boolean", printer.Expression(expr))
+	}
+	return b.Bool, nil
+}
+
+// number evaluates a real-valued expression, such as a gate parameter
+func (m *Machine) number(expr parser.Expression) (float64, error) {
+	v, err := m.evaluate(expr)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := analysis.Cast(v, "float", 0)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a number", printer.Expression(expr))
+	}
+	return f.Float, nil
+}
+
+// evaluate returns the value of a classical expression in the current
+// state
+func (m *Machine) evaluate(expr parser.Expression) (analysis.Value, error) {
+	bound, err := m.bind(expr)
+	if err != nil {
+		return analysis.Value{}, err
+	}
+	v, ok := m.env.Evaluate(bound)
+	if !ok {
+		return analysis.Value{}, fmt.Errorf("cannot evaluate %s", printer.Expression(expr))
+	}
+	return v, nil
+}
+
+// bind replaces the elements of integer variables, such as c[0], with
+// their values, which Constants.Evaluate does not read
+func (m *Machine) bind(expr parser.Expression) (parser.Expression, error) {
+	switch e := expr.(type) {
+	case *parser.IndexedIdentifier:
+		v, ok := m.env[e.Name]
+		if !ok || v.Kind != analysis.Int || len(e.Indices) > 0 {
+			return nil, fmt.Errorf("cannot evaluate %s", printer.Expression(expr))
+		}
+		width := m.types[e.Name].width
+		if width == 0 {
+			width = 64
+		}
+		i, err := m.index(e.Index, width)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.IntegerLiteral{Value: v.Int >> i & 1}, nil
+	case *parser.ParenthesizedExpression:
+		inner, err := m.bind(e.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.ParenthesizedExpression{Expression: inner}, nil
+	case *parser.UnaryExpression:
+		operand, err := m.bind(e.Operand)
+		if err != nil {
+			return nil, err
+		}
+		if e.Operator == "!" {
+			operand = m.truth(e.Operand, operand)
+		}
+		return &parser.UnaryExpression{Operator: e.Operator, Operand: operand}, nil
+	case *parser.BinaryExpression:
+		left, err := m.bind(e.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := m.bind(e.Right)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case e.Operator == "&&" || e.Operator == "||":
+			left, right = m.truth(e.Left, left), m.truth(e.Right, right)
+		case (e.Operator == "==" || e.Operator == "!=") && m.boolean(right):
+			left = m.truth(e.Left, left)
+		case (e.Operator == "==" || e.Operator == "!=") && m.boolean(left):
+			right = m.truth(e.Right, right)
+		}
+		return &parser.BinaryExpression{Left: left, Operator: e.Operator, Right: right}, nil
+	case *parser.FunctionCall:
+		args := make([]parser.Expression, len(e.Arguments))
+		for i, arg := range e.Arguments {
+			bound, err := m.bind(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = bound
+		}
+		return &parser.FunctionCall{Name: e.Name, Arguments: args}, nil
+	case *parser.MeasureExpression:
+		return nil, errors.New("measure can only be assigned")
+	}
+	return expr, nil
+}
+
+// truth casts a bit, bound from expr, to bool where it meets a logical
+// operator or a bool, as QASM does implicitly; Constants.Evaluate applies
+// logical operators to bools only
+func (m *Machine) truth(expr, bound parser.Expression) parser.Expression {
+	if !m.bit(expr) {
+		return bound
+	}
+	v, ok := m.env.Evaluate(bound)
+	if !ok || v.Kind != analysis.Int {
+		return bound
+	}
+	return &parser.BooleanLiteral{Value: v.Int != 0}
+}
+
+// bit reports whether expr reads a single bit, such as c[0] or a bit
+// variable
+func (m *Machine) bit(expr parser.Expression) bool {
+	switch e := expr.(type) {
+	case *parser.ParenthesizedExpression:
+		return m.bit(e.Expression)
+	case *parser.IndexedIdentifier:
+		return true
+	case *parser.Identifier:
+		t := m.types[e.Name]
+		return t.typ == "bit" && t.width == 1
+	}
+	return false
+}
+
+// boolean reports whether a bound expression evaluates to a bool
+func (m *Machine) boolean(bound parser.Expression) bool {
+	v, ok := m.env.Evaluate(bound)
+	return ok && v.Kind == analysis.Bool
+}
+
+// literal writes a value as an expression Constants.Evaluate reads back
+func literal(v analysis.Value) parser.Expression {
+	switch v.Kind {
+	case analysis.Int:
+		return &parser.IntegerLiteral{Value: v.Int}
+	case analysis.Bool:
+		return &parser.BooleanLiteral{Value: v.Bool}
+	case analysis.Angle:
+		return &parser.FunctionCall{Name: "angle", Arguments: []parser.Expression{&parser.FloatLiteral{Value: v.Float}}}
+	case analysis.Complex:
+		return &parser.BinaryExpression{
+			Left: &parser.FloatLiteral{Value: v.Float}, Operator: "+", Right: &parser.ImaginaryLiteral{Value: v.Imag},
+		}
+	}
+	return &parser.FloatLiteral{Value: v.Float}
+}
@@ -0,0 +1,222 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func machine(t *testing.T, source string, opts *RunOptions) *Machine {
+	t.Helper()
+	program, err := parser.NewParser().ParseString(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMachine(program, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMachine(t *testing.T) {
+	const source = `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+bit[2] c;
+int n = 0;
+gate bell a, b { h a; cx a, b; }
+bell q[0], q[1];
+c = measure q;
+for int i in [0:3] {
+  n += i;
+}
+if (c[0] == 1) {
+  x q;
+}
+while (n < 20) {
+  n = n * 2;
+}
+angle[8] theta = pi;
+rx(theta) q[1];
+`
+	outcomes := make(map[int64]int)
+	for seed := range int64(20) {
+		m := machine(t, source, &RunOptions{Rand: rand.New(rand.NewSource(seed))})
+		if err := m.Run(); err != nil {
+			t.Fatal(err)
+		}
+		vars := m.Variables()
+		c := vars["c"].Int
+		outcomes[c]++
+		if c != 0 && c != 3 {
+			t.Fatalf("Bell pair measured as %02b", c)
+		}
+		if n := vars["n"].Int; n != 24 {
+			t.Errorf("n = %d, want 24", n)
+		}
+		if _, ok := vars["i"]; ok {
+			t.Error("loop variable outlived its loop")
+		}
+		// Both qubits end in |0⟩ after the x, then rx(π) flips q[1]
+		if p := m.Probabilities(); math.Abs(p[1]-1) > 1e-9 {
+			t.Errorf("probabilities = %v, want |01⟩", p)
+		}
+	}
+	if outcomes[0] == 0 || outcomes[3] == 0 {
+		t.Errorf("outcomes over 20 seeds = %v", outcomes)
+	}
+}
+
+func TestMachineBitConditions(t *testing.T) {
+	m := machine(t, `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[3] q;
+bit[3] c;
+int hits = 0;
+x q[0];
+x q[1];
+c = measure q;
+bit b = c[0];
+if (c[0] && !c[2]) {
+  hits += 1;
+}
+if (c[0] || c[2]) {
+  hits += 2;
+}
+if (c[2] == false) {
+  hits += 4;
+}
+if (true != c[1]) {
+  hits += 8;
+}
+if (!(c[2])) {
+  hits += 16;
+}
+if (b && c[1]) {
+  hits += 32;
+}
+`, nil)
+	if err := m.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if hits := m.Variables()["hits"].Int; hits != 55 {
+		t.Errorf("hits = %d, want 55", hits)
+	}
+}
+
+func TestMachineStep(t *testing.T) {
+	m := machine(t, `OPENQASM 3.0;
+include "stdgates.inc";
+qubit q;
+for int i in {1, 2} {
+  h q;
+}
+bit b = measure q;
+`, nil)
+	var lines []int
+	for !m.Done() {
+		lines = append(lines, m.Next().Pos().Line)
+		if err := m.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []int{2, 3, 4, 5, 5, 7}
+	if len(lines) != len(want) {
+		t.Fatalf("stepped through lines %v, want %v", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("stepped through lines %v, want %v", lines, want)
+		}
+	}
+	// h twice is the identity, so the measurement is certain
+	if b := m.Variables()["b"]; b.Int != 0 {
+		t.Errorf("b = %v", b)
+	}
+	if err := m.Step(); err == nil {
+		t.Error("Step() after the end succeeded")
+	}
+}
+
+func TestMachineDumps(t *testing.T) {
+	var out bytes.Buffer
+	m := machine(t, `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+pragma qasmparser.dump_state start
+h q[0];
+for int i in [0:1] {
+  z q[0];
+}
+cx q[0], q[1];
+pragma qasmparser.dump_probs bell
+`, &RunOptions{Dump: &out})
+	if len(m.Snapshots()) != 0 {
+		t.Fatalf("snapshots before the first statement = %v", m.Snapshots())
+	}
+	// The dump after the declaration is taken once it has run
+	if err := m.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if snaps := m.Snapshots(); len(snaps) != 1 || snaps[0].State["00"] != [2]float64{1, 0} || len(snaps[0].State) != 1 {
+		t.Fatalf("snapshots = %+v", snaps)
+	}
+	if err := m.Run(); err != nil {
+		t.Fatal(err)
+	}
+	snaps := m.Snapshots()
+	if len(snaps) != 2 || snaps[1].Label != "bell" || snaps[1].State != nil {
+		t.Fatalf("snapshots = %+v", snaps)
+	}
+	if p := snaps[1].Probabilities; len(p) != 2 || math.Abs(p["00"]-0.5) > 1e-9 || math.Abs(p["11"]-0.5) > 1e-9 {
+		t.Errorf("probabilities = %v", p)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("dumped %q", out.String())
+	}
+	var snap Snapshot
+	if err := json.Unmarshal([]byte(lines[0]), &snap); err != nil {
+		t.Fatal(err)
+	}
+	if snap.Kind != parser.DumpState || snap.Label != "start" || snap.Position.Line != 4 || len(snap.Qubits) != 2 {
+		t.Errorf("first dump = %s", lines[0])
+	}
+}
+
+func TestMachineErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"qubit q;\nwhile (true) { }\n", "2:1: stopped after 100 statements"},
+		{"qubit q;\nbit[2] c;\nc = measure q;\n", "3:1: 1 bits measured into c of 2"},
+		{"qubit[2] q;\nint i = 2;\nx q[i];\n", "3:1: index 2 is out of range for 2 elements"},
+		{"qubit q;\nfoo q;\n", "2:1: gate foo with 0 parameters is not known"},
+		{"qubit q;\nfloat f = 1.5;\nf = measure q;\n", "3:1: cannot store measurements in f of type float"},
+	}
+	for _, tt := range tests {
+		m := machine(t, tt.source, &RunOptions{MaxSteps: 100})
+		if err := m.Run(); err == nil || err.Error() != tt.want {
+			t.Errorf("%q: Run() = %v, want %s", tt.source, err, tt.want)
+		}
+	}
+
+	program, err := parser.NewParser().ParseString("qubit[21] q;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMachine(program, nil); err == nil {
+		t.Error("NewMachine() accepted 21 qubits")
+	}
+}
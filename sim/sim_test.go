@@ -0,0 +1,93 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestGatesAreUnitary(t *testing.T) {
+	params := []float64{0.3, -1.2, 2.5, 0.7}
+	for name, g := range standard {
+		m, ok := Gate(name, params[:g.params])
+		if !ok {
+			t.Fatalf("%s: no matrix", name)
+		}
+		if d := Distance(m.Mul(m.Dagger()), Identity(m.Size())); d > 1e-12 {
+			t.Errorf("%s is not unitary: %g", name, d)
+		}
+	}
+	if _, ok := Gate("rz", nil); ok {
+		t.Error("rz without its parameter has a matrix")
+	}
+}
+
+func TestGateRelations(t *testing.T) {
+	gate := func(name string, params ...float64) Matrix {
+		m, _ := Gate(name, params)
+		return m
+	}
+	tests := []struct {
+		name string
+		a, b Matrix
+	}{
+		{"sx squared is x", gate("sx").Mul(gate("sx")), gate("x")},
+		{"hzh is x", gate("h").Mul(gate("z")).Mul(gate("h")), gate("x")},
+		{"rz is p up to phase", gate("rz", 0.4), gate("p", 0.4)},
+		{"u2 is U", gate("u2", 0.1, 0.2), U(math.Pi/2, 0.1, 0.2)},
+		{"cz is symmetric", gate("swap").Mul(gate("cz")).Mul(gate("swap")), gate("cz")},
+	}
+	for _, tt := range tests {
+		if d := Distance(tt.a, tt.b); d > 1e-12 {
+			t.Errorf("%s: distance %g", tt.name, d)
+		}
+	}
+	if d := Distance(gate("x"), gate("z")); d < 1 {
+		t.Errorf("x and z are %g apart", d)
+	}
+}
+
+func TestAngles(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	cases := [][3]float64{{0, 0, 0}, {0, 0.5, 0.5}, {math.Pi, 0.3, 0}, {math.Pi / 2, 0, math.Pi}}
+	for range 50 {
+		cases = append(cases, [3]float64{rng.Float64() * math.Pi, rng.Float64()*6 - 3, rng.Float64()*6 - 3})
+	}
+	for _, c := range cases {
+		m := U(c[0], c[1], c[2]).Scale(complex(math.Cos(c[1]), math.Sin(c[1])))
+		theta, phi, lambda := Angles(m)
+		if d := Distance(U(theta, phi, lambda), m); d > 1e-9 {
+			t.Errorf("U%v: got U(%g, %g, %g), distance %g", c, theta, phi, lambda, d)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		src  string
+		want float64
+		err  bool
+	}{
+		{"pi / 2", math.Pi / 2, false},
+		{"-(tau - 1) * 2", -(2*math.Pi - 1) * 2, false},
+		{"2 ** 3 + sqrt(4)", 10, false},
+		{"cos(theta)", math.Cos(0.5), false},
+		{"phi", 0, true},
+		{"1 / 0", 0, true},
+	}
+	for _, tt := range tests {
+		stmt, err := parser.ParseStatement("rz(" + tt.src + ") q;")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Evaluate(stmt.(*parser.GateCall).Parameters[0], map[string]float64{"theta": 0.5})
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.src, err)
+		}
+		if !tt.err && math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s = %g, want %g", tt.src, got, tt.want)
+		}
+	}
+}
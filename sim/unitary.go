@@ -0,0 +1,250 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/cmplx"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// MaxQubits is the most qubits UnitaryOf builds a matrix for; the
+// matrix of n qubits has 4^n entries
+const MaxQubits = 10
+
+// Gates holds the gate definitions calls in a gate body may refer to,
+// by name. Definitions take precedence over standard gates of the same
+// name.
+type Gates map[string]*parser.GateDefinition
+
+// GatesOf returns the gates a program defines at the top level
+func GatesOf(program *parser.Program) Gates {
+	gates := make(Gates)
+	for _, stmt := range program.Statements {
+		if def, ok := stmt.(*parser.GateDefinition); ok {
+			gates[def.Name] = def
+		}
+	}
+	return gates
+}
+
+// UnitaryOf returns the matrix of a gate definition whose body only calls
+// standard gates, U and gphase, for the given values of its parameters.
+// Use Gates.UnitaryOf when the body calls other definitions.
+func UnitaryOf(def *parser.GateDefinition, params []float64) (Matrix, error) {
+	return Gates(nil).UnitaryOf(def, params)
+}
+
+// UnitaryOf returns the matrix of a gate definition for the given values
+// of its parameters, with the first qubit of the definition as the most
+// significant bit. Calls may use the inv, pow, ctrl and negctrl
+// modifiers; pow takes integer exponents. Definitions of more than
+// MaxQubits qubits, recursive definitions, and bodies with statements
+// other than gate calls and barriers are an error.
+func (g Gates) UnitaryOf(def *parser.GateDefinition, params []float64) (Matrix, error) {
+	u := &unitaries{gates: g, active: make(map[string]bool)}
+	return u.definition(def, params)
+}
+
+type unitaries struct {
+	gates Gates
+
+	// active holds the definitions being expanded, to catch recursion
+	active map[string]bool
+}
+
+func (u *unitaries) definition(def *parser.GateDefinition, params []float64) (Matrix, error) {
+	if len(params) != len(def.Parameters) {
+		return nil, fmt.Errorf("gate %s takes %d parameters, given %d", def.Name, len(def.Parameters), len(params))
+	}
+	n := len(def.Qubits)
+	if n > MaxQubits {
+		return nil, fmt.Errorf("gate %s acts on %d qubits, more than %d", def.Name, n, MaxQubits)
+	}
+	if u.active[def.Name] {
+		return nil, fmt.Errorf("gate %s is defined in terms of itself", def.Name)
+	}
+	u.active[def.Name] = true
+	defer delete(u.active, def.Name)
+
+	env := make(map[string]float64, len(params))
+	for i, p := range def.Parameters {
+		env[p.Name] = params[i]
+	}
+	index := make(map[string]int, n)
+	for i, q := range def.Qubits {
+		index[q.Name] = i
+	}
+
+	m := Identity(1 << n)
+	for _, stmt := range def.Body {
+		switch s := stmt.(type) {
+		case *parser.Barrier:
+		case *parser.GateCall:
+			gate, err := u.call(s, env)
+			if err != nil {
+				return nil, err
+			}
+			targets := make([]int, len(s.Qubits))
+			for i, q := range s.Qubits {
+				id, ok := q.(*parser.Identifier)
+				if ok {
+					targets[i], ok = index[id.Name]
+				}
+				if !ok {
+					return nil, fmt.Errorf("%s: %s is not a qubit of gate %s", position(s), printer.Expression(q), def.Name)
+				}
+			}
+			applyColumns(m, gate, targets)
+		default:
+			return nil, fmt.Errorf("%s: %s is not supported in a gate body", position(stmt), stmt)
+		}
+	}
+	return m, nil
+}
+
+// call returns the matrix of a gate call, modifiers included
+func (u *unitaries) call(call *parser.GateCall, env map[string]float64) (Matrix, error) {
+	params := make([]float64, len(call.Parameters))
+	for i, p := range call.Parameters {
+		v, err := Evaluate(p, env)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", position(call), err)
+		}
+		params[i] = v
+	}
+
+	var m Matrix
+	if def, ok := u.gates[call.Name]; ok {
+		var err error
+		if m, err = u.definition(def, params); err != nil {
+			return nil, fmt.Errorf("%s: %w", position(call), err)
+		}
+	} else if call.Name == "gphase" && len(params) == 1 {
+		m = Matrix{{cmplx.Exp(complex(0, params[0]))}}
+	} else if m, ok = Gate(call.Name, params); !ok {
+		return nil, fmt.Errorf("%s: gate %s with %d parameters is not known", position(call), call.Name, len(params))
+	}
+
+	// The modifier next to the gate applies first
+	for i := len(call.Modifiers) - 1; i >= 0; i-- {
+		mod := call.Modifiers[i]
+		arg := 1.0
+		if len(mod.Parameters) > 0 {
+			v, err := Evaluate(mod.Parameters[0], env)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", position(call), err)
+			}
+			arg = v
+		}
+		switch mod.Type {
+		case "inv":
+			m = m.Dagger()
+		case "pow":
+			if arg != math.Trunc(arg) {
+				return nil, fmt.Errorf("%s: pow(%g) is not an integer power", position(call), arg)
+			}
+			m = power(m, int(arg))
+		case "ctrl", "negctrl":
+			if arg < 1 || arg != math.Trunc(arg) {
+				return nil, fmt.Errorf("%s: %s(%g) is not a positive number of controls", position(call), mod.Type, arg)
+			}
+			for range int(arg) {
+				if mod.Type == "ctrl" {
+					m = Controlled(m)
+				} else {
+					m = negControlled(m)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%s: modifier %s is not known", position(call), mod.Type)
+		}
+	}
+	if want := bits.Len(uint(m.Size())) - 1; want != len(call.Qubits) {
+		return nil, fmt.Errorf("%s: %s acts on %d qubits, given %d", position(call), call.Name, want, len(call.Qubits))
+	}
+	return m, nil
+}
+
+// power returns m to the k-th power, negative k inverting it
+func power(m Matrix, k int) Matrix {
+	if k < 0 {
+		m, k = m.Dagger(), -k
+	}
+	out := Identity(m.Size())
+	for range k {
+		out = m.Mul(out)
+	}
+	return out
+}
+
+// negControlled returns m controlled by one more qubit, which comes
+// first, being 0
+func negControlled(m Matrix) Matrix {
+	n := len(m)
+	out := Identity(2 * n)
+	for i := range n {
+		copy(out[i][:n], m[i])
+	}
+	return out
+}
+
+// Apply applies the matrix of a gate to a state vector in place. targets
+// are the qubits the gate acts on, in its order; qubit 0 of the state is
+// its most significant bit.
+func Apply(state []complex128, gate Matrix, targets []int) {
+	n := bits.Len(uint(len(state))) - 1
+	k := len(targets)
+	masks := make([]int, k)
+	var all int
+	for i, t := range targets {
+		masks[i] = 1 << (n - 1 - t)
+		all |= masks[i]
+	}
+	// offsets[j] is the state index offset of the gate's basis state j
+	offsets := make([]int, 1<<k)
+	for j := range offsets {
+		for i := range k {
+			if j&(1<<(k-1-i)) != 0 {
+				offsets[j] |= masks[i]
+			}
+		}
+	}
+	in := make([]complex128, len(offsets))
+	for base := range state {
+		if base&all != 0 {
+			continue
+		}
+		for j, off := range offsets {
+			in[j] = state[base|off]
+		}
+		for j, off := range offsets {
+			var sum complex128
+			for l, v := range in {
+				sum += mul(gate[j][l], v)
+			}
+			state[base|off] = sum
+		}
+	}
+}
+
+// applyColumns applies a gate after the unitary m, in place
+func applyColumns(m Matrix, gate Matrix, targets []int) {
+	column := make([]complex128, len(m))
+	for c := range m {
+		for r := range m {
+			column[r] = m[r][c]
+		}
+		Apply(column, gate, targets)
+		for r := range m {
+			m[r][c] = column[r]
+		}
+	}
+}
+
+func position(node parser.Node) string {
+	pos := node.Pos()
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
@@ -0,0 +1,106 @@
+package sim
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestUnitaryOf(t *testing.T) {
+	src := `OPENQASM 3.0;
+gate mycz a, b { h b; cx a, b; h b; }
+gate myswap a, b { cx a, b; cx b, a; cx a, b; }
+gate mycx a, b { ctrl @ x a, b; }
+gate zero a, b { negctrl @ x a, b; }
+gate myz a { pow(2) @ s a; }
+gate undo a { inv @ t a; t a; }
+gate phased(theta) a { gphase(theta / 2); rz(theta) a; }
+gate toffoli a, b, c { h c; cx b, c; tdg c; cx a, c; t c; cx b, c; tdg c; cx a, c; t b; t c; h c; cx a, b; t a; tdg b; cx a, b; }
+gate nested a, b { mycz b, a; }
+`
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gates := GatesOf(program)
+	gate := func(name string, params ...float64) Matrix {
+		m, _ := Gate(name, params)
+		return m
+	}
+	tests := []struct {
+		name   string
+		params []float64
+		want   Matrix
+	}{
+		{"mycz", nil, gate("cz")},
+		{"myswap", nil, gate("swap")},
+		{"mycx", nil, gate("cx")},
+		{"zero", nil, Matrix{{0, 1, 0, 0}, {1, 0, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}},
+		{"myz", nil, gate("z")},
+		{"undo", nil, Identity(2)},
+		{"phased", []float64{0.8}, gate("p", 0.8)},
+		{"toffoli", nil, gate("ccx")},
+		{"nested", nil, gate("cz")},
+	}
+	for _, tt := range tests {
+		got, err := gates.UnitaryOf(gates[tt.name], tt.params)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if d := Distance(got, tt.want); d > 1e-12 {
+			t.Errorf("%s: distance %g", tt.name, d)
+		}
+	}
+
+	// phased(θ) is exactly p(θ), global phase included
+	got, _ := gates.UnitaryOf(gates["phased"], []float64{0.8})
+	if math.Abs(real(got[0][0])-1) > 1e-12 {
+		t.Errorf("gphase was dropped: %v", got)
+	}
+}
+
+func TestUnitaryOfErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		params []float64
+		want   string
+	}{
+		{"gate g a { foo a; }", nil, "2:12: gate foo with 0 parameters is not known"},
+		{"gate g a { g a; }", nil, "defined in terms of itself"},
+		{"gate g(t) a { rz(t) a; }", nil, "takes 1 parameters, given 0"},
+		{"gate g a { rz(phi) a; }", nil, "phi has no known value"},
+		{"gate g a, b { cx a; }", nil, "cx acts on 2 qubits, given 1"},
+		{"gate g a { pow(0.5) @ x a; }", nil, "not an integer power"},
+	}
+	for _, tt := range tests {
+		program, err := parser.NewParser().ParseString("OPENQASM 3.0;\n" + tt.src + "\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gates := GatesOf(program)
+		_, err = gates.UnitaryOf(gates["g"], tt.params)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	// x on qubit 1 of 3 takes |000> to |010>
+	state := make([]complex128, 8)
+	state[0] = 1
+	x, _ := Gate("x", nil)
+	Apply(state, x, []int{1})
+	if state[2] != 1 {
+		t.Errorf("got %v", state)
+	}
+	// cx with qubit 1 controlling qubit 0 takes |010> to |110>
+	cx, _ := Gate("cx", nil)
+	Apply(state, cx, []int{1, 0})
+	if state[6] != 1 {
+		t.Errorf("got %v", state)
+	}
+}
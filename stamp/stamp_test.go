@@ -0,0 +1,66 @@
+package stamp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/orangekame3/qasmparser/checksum"
+)
+
+func TestApply(t *testing.T) {
+	input := []byte("OPENQASM 3.0;\nqubit q;\nh q;\n")
+	output := []byte("OPENQASM 3.0;\n// note: kept\nqubit q;\nh q;\n")
+	s := New(input, "format", "group-declarations")
+	if s.Version == "" {
+		t.Error("New did not set a version")
+	}
+	s.Version = "v1.2.3"
+
+	stamped := Apply(output, s)
+	want := "// Code generated by qasmparser v1.2.3. DO NOT EDIT.\n" +
+		"// pipeline: format, group-declarations\n" +
+		"// input: sha256:" + checksum.Sum(input) + "\n" +
+		string(output)
+	if string(stamped) != want {
+		t.Errorf("Apply() =\n%s\nwant\n%s", stamped, want)
+	}
+
+	// Restamping replaces the header rather than stacking another
+	s.Date = time.Date(2026, 10, 15, 18, 30, 0, 0, time.FixedZone("JST", 9*3600))
+	restamped := Apply(stamped, s)
+	if strings.Count(string(restamped), "Code generated") != 1 {
+		t.Errorf("restamped output has more than one header:\n%s", restamped)
+	}
+	if !strings.Contains(string(restamped), "// date: 2026-10-15T09:30:00Z\n") {
+		t.Errorf("restamped output has no UTC date:\n%s", restamped)
+	}
+	if got := Strip(restamped); string(got) != string(output) {
+		t.Errorf("Strip() =\n%s\nwant\n%s", got, output)
+	}
+
+	got, ok := Read(restamped)
+	if !ok {
+		t.Fatal("Read found no stamp")
+	}
+	if !reflect.DeepEqual(got.Pipeline, s.Pipeline) || got.Version != s.Version ||
+		got.Input != s.Input || !got.Date.Equal(s.Date) {
+		t.Errorf("Read() = %+v, want %+v", got, s)
+	}
+}
+
+func TestReadUnstamped(t *testing.T) {
+	for _, content := range []string{
+		"",
+		"OPENQASM 3.0;\n",
+		"// Code generated by another tool. DO NOT EDIT.\nOPENQASM 3.0;\n",
+	} {
+		if _, ok := Read([]byte(content)); ok {
+			t.Errorf("Read(%q) found a stamp", content)
+		}
+		if got := Strip([]byte(content)); string(got) != content {
+			t.Errorf("Strip(%q) = %q", content, got)
+		}
+	}
+}
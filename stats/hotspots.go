@@ -0,0 +1,127 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Hotspot is a source line or block and the gates it applies
+type Hotspot struct {
+	// Kind is "line" for a single line, or the statement a block is:
+	// "for", "while" or "if"
+	Kind  string `json:"kind"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+
+	// Gates is the number of gates applied, counting each iteration of
+	// loops with constant ranges
+	Gates int `json:"gates"`
+}
+
+// Hotspots returns the lines and blocks of program that apply gates, the
+// most gates first. As in Compute, gate and subroutine definitions are
+// not counted; unlike Compute, a for loop over a constant range counts
+// its body once per iteration, the range written with literals or const
+// declarations. While loops count their body once.
+func Hotspots(program *parser.Program) []Hotspot {
+	consts, _ := analysis.EvaluateConstants(program)
+	h := &hotspots{lines: make(map[int]int), consts: consts}
+	h.statements(program.Statements, 1)
+
+	spots := h.blocks
+	for line, gates := range h.lines {
+		spots = append(spots, Hotspot{Kind: "line", Start: line, End: line, Gates: gates})
+	}
+	sort.SliceStable(spots, func(i, j int) bool {
+		if spots[i].Gates != spots[j].Gates {
+			return spots[i].Gates > spots[j].Gates
+		}
+		if spots[i].Start != spots[j].Start {
+			return spots[i].Start < spots[j].Start
+		}
+		// Blocks before the lines they start on
+		return spots[i].End > spots[j].End
+	})
+	return spots
+}
+
+type hotspots struct {
+	lines  map[int]int
+	blocks []Hotspot
+	consts analysis.Constants
+}
+
+// statements counts the gates of statements, each applied times times,
+// and returns the total
+func (h *hotspots) statements(statements []parser.Statement, times int) int {
+	total := 0
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.GateCall:
+			h.lines[s.Pos().Line] += times
+			total += times
+		case *parser.IfStatement:
+			total += h.block("if", s, h.statements(s.ThenBody, times)+h.statements(s.ElseBody, times))
+		case *parser.ForStatement:
+			n := tripCount(h.consts, s.Iterable)
+			if n < 0 {
+				n = 1
+			}
+			total += h.block("for", s, h.statements(s.Body, times*n))
+		case *parser.WhileStatement:
+			total += h.block("while", s, h.statements(s.Body, times))
+		}
+	}
+	return total
+}
+
+// block records a block statement applying gates, and returns gates
+func (h *hotspots) block(kind string, stmt parser.Statement, gates int) int {
+	if gates > 0 {
+		h.blocks = append(h.blocks, Hotspot{Kind: kind, Start: stmt.Pos().Line, End: stmt.End().Line, Gates: gates})
+	}
+	return gates
+}
+
+// tripCount returns how many times a loop over iterable runs, or -1 if
+// that is not known from literals and constants
+func tripCount(consts analysis.Constants, iterable parser.Expression) int {
+	if n, ok := consts.Trips(iterable); ok {
+		return n
+	}
+	return -1
+}
+
+// WriteHistogram writes the top hotspots, or all of them if top is not
+// positive, with bars scaled to the largest:
+//
+//	LINES  KIND  GATES
+//	5-7    for   40  ████████████████████
+//	6      line  30  ███████████████
+func WriteHistogram(w io.Writer, spots []Hotspot, top int) error {
+	if top > 0 && len(spots) > top {
+		spots = spots[:top]
+	}
+	const width = 20
+	most := 0
+	for _, s := range spots {
+		most = max(most, s.Gates)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINES\tKIND\tGATES")
+	for _, s := range spots {
+		lines := fmt.Sprint(s.Start)
+		if s.End > s.Start {
+			lines = fmt.Sprintf("%d-%d", s.Start, s.End)
+		}
+		bar := strings.Repeat("█", max(s.Gates*width/most, 1))
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", lines, s.Kind, s.Gates, bar)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,49 @@
+package stats
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const hotspotSource = `OPENQASM 3.0;
+qubit[2] q;
+gate bell a, b { h a; cx a, b; }
+h q[0];
+for uint i in [0:9] {
+  cx q[0], q[1];
+  h q[0]; x q[1];
+}
+bell q[0], q[1];
+`
+
+func TestHotspots(t *testing.T) {
+	program, err := parser.NewParser().ParseString(hotspotSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Hotspot{
+		{Kind: "for", Start: 5, End: 8, Gates: 30},
+		{Kind: "line", Start: 7, End: 7, Gates: 20},
+		{Kind: "line", Start: 6, End: 6, Gates: 10},
+		{Kind: "line", Start: 4, End: 4, Gates: 1},
+		{Kind: "line", Start: 9, End: 9, Gates: 1},
+	}
+	got := Hotspots(program)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Hotspots() = %+v, want %+v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHistogram(&buf, got, 2); err != nil {
+		t.Fatal(err)
+	}
+	expected := "LINES  KIND  GATES\n" +
+		"5-8    for   30  ████████████████████\n" +
+		"7      line  20  █████████████\n"
+	if buf.String() != expected {
+		t.Errorf("WriteHistogram() =\n%s\nwant\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/orangekame3/qasmparser/analysis"
+)
+
+// WriteLifetimes writes one timeline per qubit, a column per moment: █
+// where an operation acts on it, R where it is reset, · where it idles
+// between uses and blank outside its lifetime.
+//
+//	QUBIT  USES  IDLE  TIMELINE
+//	q[0]   3     1     █·█R
+//	q[1]   1     0      █
+func WriteLifetimes(w io.Writer, lifetimes []analysis.Lifetime) error {
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUBIT\tUSES\tIDLE\tTIMELINE")
+	for _, lt := range lifetimes {
+		idle := 0
+		for _, win := range lt.Idle {
+			idle += win.Len()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", lt.Qubit, len(lt.Uses), idle, timeline(lt))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	// Unused qubits have an empty timeline, which tabwriter pads
+	for _, line := range strings.SplitAfter(sb.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, strings.TrimRight(line, " \n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeline draws a lifetime up to its last use
+func timeline(lt analysis.Lifetime) string {
+	cells := []rune(strings.Repeat(" ", lt.LastUse+1))
+	for _, win := range lt.Idle {
+		for m := win.Start; m < win.End; m++ {
+			cells[m] = '·'
+		}
+	}
+	for _, m := range lt.Uses {
+		cells[m] = '█'
+	}
+	for _, m := range lt.Resets {
+		cells[m] = 'R'
+	}
+	return string(cells)
+}
@@ -0,0 +1,34 @@
+package stats
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func TestWriteLifetimes(t *testing.T) {
+	program, err := parser.NewParser().ParseString(`OPENQASM 3.0;
+qubit[3] q;
+h q[0];
+h q[1];
+x q[1];
+cx q[0], q[1];
+reset q[0];
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteLifetimes(&buf, analysis.Liveness(program)); err != nil {
+		t.Fatal(err)
+	}
+	want := "QUBIT  USES  IDLE  TIMELINE\n" +
+		"q[0]   3     1     █·█R\n" +
+		"q[1]   3     0     ███\n" +
+		"q[2]   0     0\n"
+	if buf.String() != want {
+		t.Errorf("WriteLifetimes() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
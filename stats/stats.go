@@ -0,0 +1,198 @@
+// Package stats computes size metrics of circuits, such as depth, gate
+// counts and loop structure, and compares them between two versions of a
+// circuit so optimization work can be quantified.
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Stats are the metrics of one circuit. Gate and subroutine definitions
+// are not counted, only the operations the program applies. Loop and
+// branch bodies are counted once, as they appear in the source.
+type Stats struct {
+	Qubits       int            `json:"qubits"`
+	Depth        int            `json:"depth"`
+	Gates        int            `json:"gates"`
+	CX           int            `json:"cx"`
+	Measurements int            `json:"measurements"`
+	GateCounts   map[string]int `json:"gate_counts"`
+
+	// Loops and Branches count for and while loops and if statements;
+	// Nesting is how deeply they nest, 0 for straight-line code
+	Loops    int `json:"loops"`
+	Branches int `json:"branches"`
+	Nesting  int `json:"nesting"`
+
+	// Instructions estimates the size of the program once for loops with
+	// constant ranges are unrolled: its gates, measurements, resets and
+	// barriers, counted once per iteration, plus one for each branch and
+	// each loop left rolled. Both arms of a branch are counted.
+	Instructions int `json:"instructions"`
+
+	// Trips lists every loop with how many times it runs
+	Trips []Trip `json:"trips,omitempty"`
+}
+
+// Trip is a loop and the number of times it runs
+type Trip struct {
+	Kind string `json:"kind"` // "for" or "while"
+	Line int    `json:"line"`
+
+	// Count is the number of iterations, or -1 if it is not known from
+	// literals and constants
+	Count int `json:"count"`
+}
+
+// Compute returns the metrics of program. Qubits are counted from
+// declarations whose size is a constant expression, such as a literal or
+// a const declared before it; depth is the number of
+// moments analysis.Moments lays the circuit out in.
+func Compute(program *parser.Program) Stats {
+	consts, _ := analysis.EvaluateConstants(program)
+	c := &counter{stats: Stats{GateCounts: make(map[string]int)}, consts: consts}
+	c.stats.Instructions = c.statements(program.Statements, 0)
+	c.stats.Depth = len(analysis.Moments(program))
+	return c.stats
+}
+
+type counter struct {
+	stats  Stats
+	consts analysis.Constants
+}
+
+// statements counts statements, nested depth loops and branches deep, and
+// returns their instruction count for one run
+func (c *counter) statements(statements []parser.Statement, depth int) int {
+	instructions := 0
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.QuantumDeclaration:
+			size := 1
+			if s.Size != nil {
+				size = 0
+				if n, ok := c.consts.Int(s.Size); ok && n > 0 {
+					size = int(n)
+				}
+			}
+			c.stats.Qubits += size
+		case *parser.ClassicalDeclaration:
+			if _, ok := s.Initializer.(*parser.MeasureExpression); ok {
+				c.stats.Measurements++
+				instructions++
+			}
+		case *parser.GateCall:
+			c.stats.Gates++
+			c.stats.GateCounts[s.Name]++
+			if (s.Name == "cx" || s.Name == "CX") && len(s.Modifiers) == 0 {
+				c.stats.CX++
+			}
+			instructions++
+		case *parser.Measurement:
+			c.stats.Measurements++
+			instructions++
+		case *parser.Barrier, *parser.Reset:
+			instructions++
+		case *parser.IfStatement:
+			c.stats.Branches++
+			c.stats.Nesting = max(c.stats.Nesting, depth+1)
+			instructions += 1 + c.statements(s.ThenBody, depth+1) + c.statements(s.ElseBody, depth+1)
+		case *parser.ForStatement:
+			trip := c.loop("for", s, depth)
+			body := c.statements(s.Body, depth+1)
+			if trip.Count >= 0 {
+				instructions += trip.Count * body
+			} else {
+				instructions += 1 + body
+			}
+		case *parser.WhileStatement:
+			c.loop("while", s, depth)
+			instructions += 1 + c.statements(s.Body, depth+1)
+		}
+	}
+	return instructions
+}
+
+// loop records a loop at depth and returns its trip count
+func (c *counter) loop(kind string, stmt parser.Statement, depth int) Trip {
+	c.stats.Loops++
+	c.stats.Nesting = max(c.stats.Nesting, depth+1)
+	trip := Trip{Kind: kind, Line: stmt.Pos().Line, Count: -1}
+	if f, ok := stmt.(*parser.ForStatement); ok {
+		trip.Count = tripCount(c.consts, f.Iterable)
+	}
+	c.stats.Trips = append(c.stats.Trips, trip)
+	return trip
+}
+
+// Delta is the change of one metric between two circuits
+type Delta struct {
+	Metric string `json:"metric"`
+	Old    int    `json:"old"`
+	New    int    `json:"new"`
+}
+
+// Change returns New minus Old
+func (d Delta) Change() int {
+	return d.New - d.Old
+}
+
+// Compare returns the change of every metric from old to new: the
+// totals first, then the count of each gate either circuit uses, by name
+func Compare(old, new Stats) []Delta {
+	deltas := []Delta{
+		{Metric: "qubits", Old: old.Qubits, New: new.Qubits},
+		{Metric: "depth", Old: old.Depth, New: new.Depth},
+		{Metric: "gates", Old: old.Gates, New: new.Gates},
+		{Metric: "cx", Old: old.CX, New: new.CX},
+		{Metric: "measurements", Old: old.Measurements, New: new.Measurements},
+		{Metric: "loops", Old: old.Loops, New: new.Loops},
+		{Metric: "branches", Old: old.Branches, New: new.Branches},
+		{Metric: "nesting", Old: old.Nesting, New: new.Nesting},
+		{Metric: "instructions", Old: old.Instructions, New: new.Instructions},
+	}
+
+	names := make(map[string]bool)
+	for name := range old.GateCounts {
+		names[name] = true
+	}
+	for name := range new.GateCounts {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		deltas = append(deltas, Delta{Metric: "gate " + name, Old: old.GateCounts[name], New: new.GateCounts[name]})
+	}
+	return deltas
+}
+
+// WriteTable writes deltas as an aligned table:
+//
+//	METRIC  OLD  NEW  DELTA
+//	depth   12   9    -3
+func WriteTable(w io.Writer, deltas []Delta) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tOLD\tNEW\tDELTA")
+	for _, d := range deltas {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", d.Metric, d.Old, d.New, signed(d.Change()))
+	}
+	return tw.Flush()
+}
+
+// signed formats n with an explicit sign unless it is zero
+func signed(n int) string {
+	if n > 0 {
+		return fmt.Sprintf("+%d", n)
+	}
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,142 @@
+package stats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+func compute(t *testing.T, src string) Stats {
+	t.Helper()
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Compute(program)
+}
+
+func TestCompute(t *testing.T) {
+	s := compute(t, `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[3] q;
+bit[3] c;
+gate bell a, b { h a; cx a, b; }
+h q[0];
+h q[2];
+cx q[0], q[1];
+x q[2];
+cx q[1], q[2];
+c = measure q;
+`)
+	want := Stats{Qubits: 3, Depth: 4, Gates: 5, CX: 2, Measurements: 1}
+	if s.Qubits != want.Qubits || s.Depth != want.Depth || s.Gates != want.Gates || s.CX != want.CX || s.Measurements != want.Measurements {
+		t.Errorf("Compute() = %+v, want %+v", s, want)
+	}
+	if s.GateCounts["h"] != 2 || s.GateCounts["cx"] != 2 || s.GateCounts["x"] != 1 {
+		t.Errorf("GateCounts = %v", s.GateCounts)
+	}
+}
+
+func TestComputeBroadcast(t *testing.T) {
+	s := compute(t, "OPENQASM 3.0;\nqubit[2] q;\nqubit r;\nh q;\nx r;\nh q[1];\n")
+	if s.Depth != 2 || s.Qubits != 3 {
+		t.Errorf("Compute() = %+v, want depth 2 and 3 qubits", s)
+	}
+}
+
+func TestComputeControlFlow(t *testing.T) {
+	s := compute(t, `OPENQASM 3.0;
+qubit[2] q;
+bit c;
+int n = 3;
+for uint i in [0:3] {
+  h q[0];
+  for uint j in [0:n] {
+    cx q[0], q[1];
+  }
+}
+c = measure q[0];
+if (c) {
+  x q[1];
+} else {
+  while (c) { c = measure q[1]; }
+}
+barrier q;
+`)
+	if s.Loops != 3 || s.Branches != 1 || s.Nesting != 2 {
+		t.Errorf("loops, branches, nesting = %d, %d, %d, want 3, 1, 2", s.Loops, s.Branches, s.Nesting)
+	}
+	want := []Trip{{Kind: "for", Line: 5, Count: 4}, {Kind: "for", Line: 7, Count: -1}, {Kind: "while", Line: 15, Count: -1}}
+	if !reflect.DeepEqual(s.Trips, want) {
+		t.Errorf("Trips = %+v, want %+v", s.Trips, want)
+	}
+	// 4 × (h + rolled loop + cx), measure, if + x + while + measure, barrier
+	if s.Instructions != 4*3+1+4+1 {
+		t.Errorf("Instructions = %d, want %d", s.Instructions, 4*3+1+4+1)
+	}
+}
+
+func TestComputeConstants(t *testing.T) {
+	s := compute(t, `OPENQASM 3.0;
+const uint n = 3;
+qubit[n + 1] q;
+for uint i in [0:n - 1] {
+  h q[i];
+}
+`)
+	if s.Qubits != 4 || s.Instructions != 3 {
+		t.Errorf("qubits, instructions = %d, %d, want 4, 3", s.Qubits, s.Instructions)
+	}
+	if want := []Trip{{Kind: "for", Line: 4, Count: 3}}; !reflect.DeepEqual(s.Trips, want) {
+		t.Errorf("Trips = %+v, want %+v", s.Trips, want)
+	}
+}
+
+func TestCompareTable(t *testing.T) {
+	old := compute(t, "OPENQASM 3.0;\nqubit[2] q;\nh q[0];\nh q[0];\ncx q[0], q[1];\n")
+	new := compute(t, "OPENQASM 3.0;\nqubit[2] q;\ncx q[0], q[1];\nx q[1];\n")
+
+	deltas := Compare(old, new)
+	byMetric := make(map[string]Delta)
+	for _, d := range deltas {
+		byMetric[d.Metric] = d
+	}
+	if d := byMetric["depth"]; d.Old != 3 || d.New != 2 || d.Change() != -1 {
+		t.Errorf("depth delta = %+v", d)
+	}
+	if d := byMetric["gate x"]; d.Old != 0 || d.New != 1 {
+		t.Errorf("gate x delta = %+v", d)
+	}
+	if d := byMetric["gate h"]; d.Old != 2 || d.New != 0 {
+		t.Errorf("gate h delta = %+v", d)
+	}
+
+	var sb strings.Builder
+	if err := WriteTable(&sb, deltas); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != len(deltas)+1 {
+		t.Fatalf("table has %d lines, want %d:\n%s", len(lines), len(deltas)+1, sb.String())
+	}
+	if !strings.HasPrefix(lines[0], "METRIC") {
+		t.Errorf("header = %q", lines[0])
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "depth") && !strings.HasSuffix(line, "-1") {
+			t.Errorf("depth row = %q, want delta -1", line)
+		}
+		if strings.HasPrefix(line, "gate x") && !strings.HasSuffix(line, "+1") {
+			t.Errorf("gate x row = %q, want delta +1", line)
+		}
+	}
+}
+
+func TestComputeAnnotated(t *testing.T) {
+	s := compute(t, "OPENQASM 3.0;\nqubit[3] q;\n@fast\nccx q[0], q[1], q[2];\n")
+	if s.Gates != 1 || s.GateCounts["ccx"] != 1 {
+		t.Errorf("Compute() = %+v, want the annotated ccx counted", s)
+	}
+}
@@ -0,0 +1,319 @@
+package stdlib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/units"
+)
+
+// Library describes the gates of a target, such as a device's native
+// gate set, in one file that every tool reads instead of taking
+// per-feature flags. Libraries are written in JSON:
+//
+//	{
+//	  "name": "device-a",
+//	  "gates": [
+//	    {"name": "sx", "arity": 1, "matrix": [[[0.5, 0.5], [0.5, -0.5]], [[0.5, -0.5], [0.5, 0.5]]],
+//	     "duration": "35ns", "fidelity": 0.9995},
+//	    {"name": "cz", "arity": 2, "qubits": ["a", "b"], "decomposition": "h b; cx a, b; h b;",
+//	     "noise": {"depolarizing": 0.01}}
+//	  ],
+//	  "readout": {"zero_to_one": 0.02, "one_to_zero": 0.05}
+//	}
+type Library struct {
+	Name  string `json:"name,omitempty"`
+	Gates []Gate `json:"gates"`
+
+	// Readout is the error of measurements on the target, if any
+	Readout *Readout `json:"readout,omitempty"`
+}
+
+// Noise is the error a gate adds to each qubit it acts on, as the
+// probabilities of quantum channels applied after it
+type Noise struct {
+	// Depolarizing is the probability of an X, Y or Z error, each as
+	// likely as the others
+	Depolarizing float64 `json:"depolarizing,omitempty"`
+
+	// AmplitudeDamping is the probability of decay from 1 to 0
+	AmplitudeDamping float64 `json:"amplitude_damping,omitempty"`
+}
+
+// Readout is the error of measurement: the probabilities of reading 1
+// from a qubit in 0, and 0 from a qubit in 1
+type Readout struct {
+	ZeroToOne float64 `json:"zero_to_one,omitempty"`
+	OneToZero float64 `json:"one_to_zero,omitempty"`
+}
+
+// Gate describes one gate of a library
+type Gate struct {
+	Name       string   `json:"name"`
+	Parameters []string `json:"parameters,omitempty"`
+
+	// Arity is the number of qubits the gate acts on
+	Arity int `json:"arity"`
+
+	// Qubits names the qubit arguments of the decomposition. It defaults
+	// to q0, q1, ... when a decomposition is given without it.
+	Qubits []string `json:"qubits,omitempty"`
+
+	// Matrix is the unitary of a gate without parameters, row by row.
+	// Entries are real numbers or [re, im] pairs.
+	Matrix [][]Complex `json:"matrix,omitempty"`
+
+	// Decomposition is the body of the gate in QASM, in terms of its
+	// parameters and qubits, e.g. "h b; cx a, b; h b;"
+	Decomposition string `json:"decomposition,omitempty"`
+
+	// Duration is how long the gate takes, as a QASM duration literal
+	// such as "35ns" or "120dt"
+	Duration string `json:"duration,omitempty"`
+
+	// Fidelity is the average gate fidelity, between 0 and 1. Zero means
+	// unknown.
+	Fidelity float64 `json:"fidelity,omitempty"`
+
+	// Noise is the error simulations add after the gate, if any
+	Noise *Noise `json:"noise,omitempty"`
+}
+
+// Complex is a matrix entry, encoded as a number or an [re, im] pair
+type Complex complex128
+
+// MarshalJSON implements json.Marshaler
+func (c Complex) MarshalJSON() ([]byte, error) {
+	if imag(c) == 0 {
+		return json.Marshal(real(c))
+	}
+	return json.Marshal([2]float64{real(c), imag(c)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (c *Complex) UnmarshalJSON(data []byte) error {
+	var re float64
+	if err := json.Unmarshal(data, &re); err == nil {
+		*c = Complex(complex(re, 0))
+		return nil
+	}
+	var pair [2]float64
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return fmt.Errorf("matrix entry %s must be a number or an [re, im] pair", data)
+	}
+	*c = Complex(complex(pair[0], pair[1]))
+	return nil
+}
+
+// unitaryTolerance bounds the error accepted in a gate matrix
+const unitaryTolerance = 1e-6
+
+// Load reads and checks the library file at path
+func Load(path string) (*Library, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		return nil, fmt.Errorf("%s: YAML gate libraries are not supported; write the library as JSON", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lib, err := ParseLibrary(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return lib, nil
+}
+
+// ParseLibrary decodes and checks a JSON library
+func ParseLibrary(data []byte) (*Library, error) {
+	var lib Library
+	if err := json.Unmarshal(data, &lib); err != nil {
+		return nil, err
+	}
+	if err := lib.Check(); err != nil {
+		return nil, err
+	}
+	return &lib, nil
+}
+
+// Check reports every problem with the library: invalid names,
+// duplicates, matrices that are not unitary or do not match the arity,
+// decompositions that do not parse, and malformed durations or
+// fidelities and noise probabilities
+func (l *Library) Check() error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i := range l.Gates {
+		g := &l.Gates[i]
+		if seen[g.Name] {
+			errs = append(errs, fmt.Errorf("gate %s: defined more than once", g.Name))
+		}
+		seen[g.Name] = true
+		if err := g.check(); err != nil {
+			errs = append(errs, fmt.Errorf("gate %s: %w", g.Name, err))
+		}
+	}
+	if r := l.Readout; r != nil {
+		if err := checkProbability("readout zero_to_one", r.ZeroToOne); err != nil {
+			errs = append(errs, err)
+		}
+		if err := checkProbability("readout one_to_zero", r.OneToZero); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *Gate) check() error {
+	if !parser.IsValidIdentifier(g.Name) {
+		return fmt.Errorf("name %q is not a valid identifier", g.Name)
+	}
+	for _, p := range g.Parameters {
+		if !parser.IsValidIdentifier(p) {
+			return fmt.Errorf("parameter %q is not a valid identifier", p)
+		}
+	}
+	if g.Arity < 1 {
+		return fmt.Errorf("arity must be at least 1")
+	}
+	if g.Qubits != nil && len(g.Qubits) != g.Arity {
+		return fmt.Errorf("%d qubit names for arity %d", len(g.Qubits), g.Arity)
+	}
+	if g.Matrix != nil {
+		if len(g.Parameters) > 0 {
+			return fmt.Errorf("a gate with parameters cannot have a fixed matrix")
+		}
+		if err := checkUnitary(g.Matrix, 1<<g.Arity); err != nil {
+			return err
+		}
+	}
+	if g.Decomposition != "" {
+		if _, err := g.Definition(); err != nil {
+			return err
+		}
+	}
+	if g.Duration != "" {
+		if _, _, err := ParseDuration(g.Duration); err != nil {
+			return err
+		}
+	}
+	if g.Fidelity < 0 || g.Fidelity > 1 {
+		return fmt.Errorf("fidelity %v is not between 0 and 1", g.Fidelity)
+	}
+	if g.Noise != nil {
+		if err := checkProbability("depolarizing", g.Noise.Depolarizing); err != nil {
+			return err
+		}
+		if err := checkProbability("amplitude_damping", g.Noise.AmplitudeDamping); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkProbability(name string, p float64) error {
+	if p < 0 || p > 1 {
+		return fmt.Errorf("%s %v is not between 0 and 1", name, p)
+	}
+	return nil
+}
+
+// checkUnitary reports whether m is a unitary matrix of size n
+func checkUnitary(m [][]Complex, n int) error {
+	if len(m) != n {
+		return fmt.Errorf("matrix has %d rows, want %d", len(m), n)
+	}
+	for _, row := range m {
+		if len(row) != n {
+			return fmt.Errorf("matrix row has %d entries, want %d", len(row), n)
+		}
+	}
+	// Rows must be orthonormal
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			var dot complex128
+			for k := 0; k < n; k++ {
+				dot += complex128(m[i][k]) * cmplx.Conj(complex128(m[j][k]))
+			}
+			want := complex128(0)
+			if i == j {
+				want = 1
+			}
+			if cmplx.Abs(dot-want) > unitaryTolerance {
+				return fmt.Errorf("matrix is not unitary")
+			}
+		}
+	}
+	return nil
+}
+
+// Gate returns the gate named name
+func (l *Library) Gate(name string) (Gate, bool) {
+	for _, g := range l.Gates {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return Gate{}, false
+}
+
+// Names returns the names of the library's gates, sorted
+func (l *Library) Names() []string {
+	names := make([]string, len(l.Gates))
+	for i, g := range l.Gates {
+		names[i] = g.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Definition returns the gate's decomposition as a gate definition, or
+// nil if it has none
+func (g *Gate) Definition() (*parser.GateDefinition, error) {
+	if g.Decomposition == "" {
+		return nil, nil
+	}
+	qubits := g.Qubits
+	if qubits == nil {
+		for i := 0; i < g.Arity; i++ {
+			qubits = append(qubits, "q"+strconv.Itoa(i))
+		}
+	}
+	header := "gate " + g.Name
+	if len(g.Parameters) > 0 {
+		header += "(" + strings.Join(g.Parameters, ", ") + ")"
+	}
+	stmt, err := parser.ParseStatement(header + " " + strings.Join(qubits, ", ") + " { " + g.Decomposition + " }")
+	if err != nil {
+		return nil, fmt.Errorf("decomposition: %w", err)
+	}
+	def, ok := stmt.(*parser.GateDefinition)
+	if !ok {
+		return nil, fmt.Errorf("decomposition is not a gate body")
+	}
+	return def, nil
+}
+
+// ParseDuration splits a QASM duration literal such as "35ns" into its
+// value and unit, reading µs as us. units.ParseDuration keeps the value
+// exact.
+func ParseDuration(s string) (float64, string, error) {
+	d, err := units.ParseDuration(s)
+	if err != nil {
+		return 0, "", err
+	}
+	value := d.Float()
+	if math.IsInf(value, 0) {
+		return 0, "", fmt.Errorf("duration %q is out of range", s)
+	}
+	return value, string(d.Unit()), nil
+}
@@ -0,0 +1,100 @@
+package stdlib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const library = `{
+  "name": "device-a",
+  "gates": [
+    {"name": "sx", "arity": 1, "matrix": [[[0.5, 0.5], [0.5, -0.5]], [[0.5, -0.5], [0.5, 0.5]]],
+     "duration": "35ns", "fidelity": 0.9995},
+    {"name": "cz", "arity": 2, "qubits": ["a", "b"], "decomposition": "h b; cx a, b; h b;", "duration": "120dt",
+     "noise": {"depolarizing": 0.01}},
+    {"name": "rzx", "parameters": ["theta"], "arity": 2, "decomposition": "h q1; cx q0, q1; rz(theta) q1; cx q0, q1; h q1;"}
+  ],
+  "readout": {"zero_to_one": 0.02, "one_to_zero": 0.05}
+}`
+
+func TestLoadLibrary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device.json")
+	if err := os.WriteFile(path, []byte(library), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lib, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(lib.Names(), ","); got != "cz,rzx,sx" {
+		t.Errorf("Names() = %s", got)
+	}
+
+	sx, ok := lib.Gate("sx")
+	if !ok || complex128(sx.Matrix[0][1]) != complex(0.5, -0.5) {
+		t.Fatalf("sx = %+v", sx)
+	}
+	if value, unit, err := ParseDuration(sx.Duration); err != nil || value != 35 || unit != "ns" {
+		t.Errorf("ParseDuration(%q) = %v %s %v", sx.Duration, value, unit, err)
+	}
+
+	if cz, _ := lib.Gate("cz"); cz.Noise == nil || cz.Noise.Depolarizing != 0.01 {
+		t.Errorf("cz noise = %+v", cz.Noise)
+	}
+	if lib.Readout == nil || lib.Readout.OneToZero != 0.05 {
+		t.Errorf("readout = %+v", lib.Readout)
+	}
+
+	rzx, _ := lib.Gate("rzx")
+	def, err := rzx.Definition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(def.Body) != 5 || def.Qubits[1].Name != "q1" || def.Parameters[0].Name != "theta" {
+		t.Errorf("definition = %+v", def)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "device.yaml")); err == nil || !strings.Contains(err.Error(), "JSON") {
+		t.Errorf("Load(yaml) error = %v", err)
+	}
+}
+
+func TestLibraryCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		gate string
+		want string
+	}{
+		{"bad name", `{"name": "1x", "arity": 1}`, "valid identifier"},
+		{"arity", `{"name": "g", "arity": 0}`, "arity"},
+		{"matrix size", `{"name": "g", "arity": 1, "matrix": [[1]]}`, "rows"},
+		{"not unitary", `{"name": "g", "arity": 1, "matrix": [[1, 1], [0, 1]]}`, "not unitary"},
+		{"parametric matrix", `{"name": "g", "parameters": ["t"], "arity": 1, "matrix": [[1, 0], [0, 1]]}`, "fixed matrix"},
+		{"decomposition", `{"name": "g", "arity": 1, "decomposition": "h q0"}`, "decomposition"},
+		{"duration", `{"name": "g", "arity": 1, "duration": "fast"}`, "duration"},
+		{"fidelity", `{"name": "g", "arity": 1, "fidelity": 1.5}`, "fidelity"},
+		{"qubit names", `{"name": "g", "arity": 2, "qubits": ["a"]}`, "qubit names"},
+		{"depolarizing", `{"name": "g", "arity": 1, "noise": {"depolarizing": -0.1}}`, "depolarizing"},
+		{"damping", `{"name": "g", "arity": 1, "noise": {"amplitude_damping": 2}}`, "amplitude_damping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLibrary([]byte(`{"gates": [` + tt.gate + `]}`))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	_, err := ParseLibrary([]byte(`{"gates": [{"name": "g", "arity": 1}, {"name": "g", "arity": 1}]}`))
+	if err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("duplicate error = %v", err)
+	}
+
+	_, err = ParseLibrary([]byte(`{"gates": [], "readout": {"zero_to_one": 0.1, "one_to_zero": 1.1}}`))
+	if err == nil || !strings.Contains(err.Error(), "one_to_zero") {
+		t.Errorf("readout error = %v", err)
+	}
+}
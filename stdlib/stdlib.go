@@ -0,0 +1,86 @@
+// Package stdlib describes the names OpenQASM predefines and the standard
+// include files compilers provide, so tools can tell which symbols are in
+// scope without reading include files from disk. Gate libraries describe
+// the gates of a target beyond those names; see Library.
+package stdlib
+
+import "sort"
+
+// includes maps each standard include file to the gates it defines
+var includes = map[string][]string{
+	// OpenQASM 3 standard gate library
+	"stdgates.inc": {
+		"p", "x", "y", "z", "h", "s", "sdg", "t", "tdg", "sx",
+		"rx", "ry", "rz", "cx", "cy", "cz", "cp", "crx", "cry", "crz", "ch",
+		"swap", "ccx", "cswap", "cu", "CX", "phase", "cphase", "id",
+		"u1", "u2", "u3",
+	},
+	// OpenQASM 2 quantum experience library
+	"qelib1.inc": {
+		"u3", "u2", "u1", "cx", "id", "u0", "u", "p", "x", "y", "z", "h",
+		"s", "sdg", "t", "tdg", "rx", "ry", "rz", "sx", "sxdg", "cz", "cy",
+		"swap", "ch", "ccx", "cswap", "crx", "cry", "crz", "cu1", "cp",
+		"cu3", "csx", "cu", "rxx", "rzz", "rccx", "rc3x", "c3x", "c3sqrtx",
+		"c4x",
+	},
+}
+
+// IsStandard reports whether path names a standard include file
+func IsStandard(path string) bool {
+	_, ok := includes[path]
+	return ok
+}
+
+// Gates returns the gates a standard include file defines, sorted by name,
+// or nil if path is not a standard include
+func Gates(path string) []string {
+	gates, ok := includes[path]
+	if !ok {
+		return nil
+	}
+	sorted := append([]string(nil), gates...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Defines reports whether the standard include file path defines gate
+func Defines(path, gate string) bool {
+	for _, g := range includes[path] {
+		if g == gate {
+			return true
+		}
+	}
+	return false
+}
+
+// constants are the constants OpenQASM predefines
+var constants = map[string]bool{
+	"pi": true, "π": true, "tau": true, "τ": true, "euler": true, "ℇ": true,
+}
+
+// functions are the classical functions OpenQASM predefines
+var functions = map[string]bool{
+	"arccos": true, "arcsin": true, "arctan": true, "ceiling": true, "cos": true,
+	"exp": true, "floor": true, "log": true, "mod": true, "popcount": true,
+	"pow": true, "rotl": true, "rotr": true, "sin": true, "sqrt": true,
+	"tan": true, "real": true, "imag": true, "sizeof": true,
+}
+
+// builtinGates are the gates every program can call without an include
+var builtinGates = map[string]bool{"U": true, "gphase": true}
+
+// IsConstant reports whether name is a predefined constant such as pi
+func IsConstant(name string) bool {
+	return constants[name]
+}
+
+// IsFunction reports whether name is a predefined classical function
+func IsFunction(name string) bool {
+	return functions[name]
+}
+
+// IsBuiltinGate reports whether name is a gate available without any
+// include
+func IsBuiltinGate(name string) bool {
+	return builtinGates[name]
+}
@@ -0,0 +1,24 @@
+package stdlib
+
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	if !IsStandard("stdgates.inc") || IsStandard("custom.inc") {
+		t.Error("IsStandard misclassifies includes")
+	}
+	if !Defines("stdgates.inc", "cx") || Defines("stdgates.inc", "rzz") {
+		t.Error("Defines reports the wrong stdgates.inc gates")
+	}
+	if !Defines("qelib1.inc", "rzz") {
+		t.Error("qelib1.inc should define rzz")
+	}
+	gates := Gates("stdgates.inc")
+	for i := 1; i < len(gates); i++ {
+		if gates[i-1] > gates[i] {
+			t.Fatalf("Gates() is not sorted: %v", gates)
+		}
+	}
+	if Gates("custom.inc") != nil {
+		t.Error("Gates() of an unknown include should be nil")
+	}
+}
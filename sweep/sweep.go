@@ -0,0 +1,271 @@
+// Package sweep runs a parameterized program over a grid of parameter
+// values. Each point of the grid binds the parameters as constants; the
+// bound programs can be written out for other tools, or simulated for
+// the expectation value of an observable:
+//
+//	theta, _ := sweep.ParseAxis("theta=0:pi:0.1")
+//	results, err := sweep.Expectations(program, []sweep.Axis{theta}, "ZZ")
+//	sweep.WriteCSV(os.Stdout, []sweep.Axis{theta}, results)
+package sweep
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/analysis"
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/sim"
+)
+
+// MaxPoints is the most points a grid may have
+const MaxPoints = 1_000_000
+
+// Axis is a parameter and the values it takes
+type Axis struct {
+	Name   string
+	Values []float64
+}
+
+// ParseAxis reads an axis written as name=start:stop:step, where stop is
+// included if a whole number of steps away, or as name=v1,v2,... Values
+// are constant expressions such as pi/2.
+func ParseAxis(spec string) (Axis, error) {
+	name, values, ok := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !parser.IsValidIdentifier(name) {
+		return Axis{}, fmt.Errorf("axis %q is not of the form name=start:stop:step or name=v1,v2,...", spec)
+	}
+	axis := Axis{Name: name}
+	if !strings.Contains(values, ":") {
+		for _, v := range strings.Split(values, ",") {
+			f, err := number(v)
+			if err != nil {
+				return Axis{}, fmt.Errorf("axis %s: %w", name, err)
+			}
+			axis.Values = append(axis.Values, f)
+		}
+		return axis, nil
+	}
+
+	bounds := strings.Split(values, ":")
+	if len(bounds) != 3 {
+		return Axis{}, fmt.Errorf("axis %s: a range is start:stop:step", name)
+	}
+	var start, stop, step float64
+	for i, dst := range []*float64{&start, &stop, &step} {
+		f, err := number(bounds[i])
+		if err != nil {
+			return Axis{}, fmt.Errorf("axis %s: %w", name, err)
+		}
+		*dst = f
+	}
+	if step == 0 || (stop-start)/step < 0 {
+		return Axis{}, fmt.Errorf("axis %s: step %g does not lead from %g to %g", name, step, start, stop)
+	}
+	// Values are computed from their index rather than summed, so that
+	// steps do not accumulate rounding, and the stop is kept if rounding
+	// leaves it a hair beyond the last step
+	n := math.Floor((stop-start)/step+1e-9) + 1
+	if n > MaxPoints {
+		return Axis{}, fmt.Errorf("axis %s has more than %d values", name, MaxPoints)
+	}
+	for i := range int(n) {
+		axis.Values = append(axis.Values, start+float64(i)*step)
+	}
+	return axis, nil
+}
+
+// number evaluates a constant expression
+func number(src string) (float64, error) {
+	expr, err := parser.ParseExpression(strings.TrimSpace(src))
+	if err != nil {
+		return 0, fmt.Errorf("value %q: %w", strings.TrimSpace(src), err)
+	}
+	v, ok := analysis.Constants{}.Evaluate(expr)
+	if ok {
+		v, ok = analysis.Cast(v, "float", 0)
+	}
+	if !ok {
+		return 0, fmt.Errorf("value %q is not a constant number", strings.TrimSpace(src))
+	}
+	return v.Float, nil
+}
+
+// Point is a point of a grid: a value for each axis, in axis order
+type Point []float64
+
+// Grid returns every combination of the values of axes, the last axis
+// varying fastest
+func Grid(axes []Axis) ([]Point, error) {
+	total := 1
+	for _, a := range axes {
+		total *= len(a.Values)
+		if total > MaxPoints {
+			return nil, fmt.Errorf("the grid has more than %d points", MaxPoints)
+		}
+	}
+	points := make([]Point, 0, total)
+	point := make(Point, len(axes))
+	var fill func(i int)
+	fill = func(i int) {
+		if i == len(axes) {
+			points = append(points, append(Point(nil), point...))
+			return
+		}
+		for _, v := range axes[i].Values {
+			point[i] = v
+			fill(i + 1)
+		}
+	}
+	if total > 0 {
+		fill(0)
+	}
+	return points, nil
+}
+
+// Bind returns program with the parameters of axes set to the values of
+// point, as const float declarations after its leading includes, which
+// replace any input declarations of them. The program itself is not
+// modified. Parameters must not be declared by the program otherwise.
+func Bind(program *parser.Program, axes []Axis, point Point) (*parser.Program, error) {
+	for _, stmt := range program.Statements {
+		decl, ok := stmt.(*parser.ClassicalDeclaration)
+		if !ok {
+			continue
+		}
+		for _, a := range axes {
+			if decl.Identifier == a.Name {
+				return nil, fmt.Errorf("%d:%d: parameter %s is declared by the program", decl.Pos().Line, decl.Pos().Column, a.Name)
+			}
+		}
+	}
+	at := 0
+	for at < len(program.Statements) {
+		if _, ok := program.Statements[at].(*parser.Include); !ok {
+			break
+		}
+		at++
+	}
+	bound := *program
+	bound.Statements = make([]parser.Statement, 0, len(program.Statements)+len(axes))
+	bound.Statements = append(bound.Statements, program.Statements[:at]...)
+	for i, a := range axes {
+		bound.Statements = append(bound.Statements, &parser.ClassicalDeclaration{
+			Type:        "float",
+			Identifier:  a.Name,
+			Initializer: &parser.FloatLiteral{Value: point[i]},
+			Const:       true,
+		})
+	}
+	for _, stmt := range program.Statements[at:] {
+		if name, ok := inputName(stmt); ok && onAxis(axes, name) {
+			continue
+		}
+		bound.Statements = append(bound.Statements, stmt)
+	}
+	return &bound, nil
+}
+
+// onAxis reports whether name is the parameter of one of axes
+func onAxis(axes []Axis, name string) bool {
+	for _, a := range axes {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// inputName returns the name an input declaration declares, such as theta
+// for input float theta;
+func inputName(stmt parser.Statement) (string, bool) {
+	raw, ok := stmt.(*parser.RawStatement)
+	if !ok || raw.Keyword != "input" {
+		return "", false
+	}
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(raw.Text), ";"))
+	return fields[len(fields)-1], true
+}
+
+// Sources returns the program bound to each point of the grid of axes,
+// printed and named after name with the index of the point, such as
+// ansatz_007.qasm for ansatz.qasm
+func Sources(name string, program *parser.Program, axes []Axis) ([]parser.Source, error) {
+	points, err := Grid(axes)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(name, path.Ext(name))
+	digits := len(strconv.Itoa(max(len(points)-1, 0)))
+	sources := make([]parser.Source, len(points))
+	for i, p := range points {
+		bound, err := Bind(program, axes, p)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = parser.Source{
+			Name:    fmt.Sprintf("%s_%0*d.qasm", base, digits, i),
+			Content: []byte(printer.Print(bound)),
+		}
+	}
+	return sources, nil
+}
+
+// Result is the expectation value of an observable at a point
+type Result struct {
+	Point       Point
+	Expectation float64
+}
+
+// Expectations simulates program at each point of the grid of axes and
+// returns the expectation value of observable there, as sim.Expectation
+// computes it
+func Expectations(program *parser.Program, axes []Axis, observable sim.PauliString) ([]Result, error) {
+	points, err := Grid(axes)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(points))
+	for i, p := range points {
+		bound, err := Bind(program, axes, p)
+		if err != nil {
+			return nil, err
+		}
+		e, err := sim.Expectation(bound, observable)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = Result{Point: p, Expectation: e}
+	}
+	return results, nil
+}
+
+// WriteCSV writes results as CSV, with a column for each axis and one for
+// the expectation value:
+//
+//	theta,expectation
+//	0,1
+//	0.1,0.9950041652780258
+func WriteCSV(w io.Writer, axes []Axis, results []Result) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, 0, len(axes)+1)
+	for _, a := range axes {
+		header = append(header, a.Name)
+	}
+	cw.Write(append(header, "expectation"))
+	for _, r := range results {
+		row := make([]string, 0, len(r.Point)+1)
+		for _, v := range r.Point {
+			row = append(row, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		cw.Write(append(row, strconv.FormatFloat(r.Expectation, 'g', -1, 64)))
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,135 @@
+package sweep
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+const source = `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+ry(theta) q[0];
+cx q[0], q[1];
+rz(phi) q[1];
+`
+
+func parse(t *testing.T) *parser.Program {
+	t.Helper()
+	program, err := parser.NewParser().ParseString(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+func TestParseAxis(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []float64
+	}{
+		{"theta=0:1:0.25", []float64{0, 0.25, 0.5, 0.75, 1}},
+		{"theta=0:pi:pi/2", []float64{0, math.Pi / 2, math.Pi}},
+		{"theta=0:0.3:0.1", []float64{0, 0.1, 0.2, 0.30000000000000004}},
+		{"theta=1:0:-0.5", []float64{1, 0.5, 0}},
+		{"phi = 0.5, -pi", []float64{0.5, -math.Pi}},
+	}
+	for _, tt := range tests {
+		axis, err := ParseAxis(tt.spec)
+		if err != nil {
+			t.Errorf("ParseAxis(%q): %v", tt.spec, err)
+			continue
+		}
+		if len(axis.Values) != len(tt.want) {
+			t.Errorf("ParseAxis(%q) = %v, want %v", tt.spec, axis.Values, tt.want)
+			continue
+		}
+		for i := range tt.want {
+			if math.Abs(axis.Values[i]-tt.want[i]) > 1e-15 {
+				t.Errorf("ParseAxis(%q) = %v, want %v", tt.spec, axis.Values, tt.want)
+			}
+		}
+	}
+	for _, spec := range []string{"theta", "1x=0", "theta=0:1", "theta=0:1:-1", "theta=0:1:0", "theta=q"} {
+		if _, err := ParseAxis(spec); err == nil {
+			t.Errorf("ParseAxis(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestExpectations(t *testing.T) {
+	theta, _ := ParseAxis("theta=0:pi:pi/2")
+	phi, _ := ParseAxis("phi=0,1")
+	axes := []Axis{theta, phi}
+	results, err := Expectations(parse(t), axes, "ZI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 6 || results[1].Point[0] != 0 || results[1].Point[1] != 1 {
+		t.Fatalf("results = %+v", results)
+	}
+	for _, r := range results {
+		if want := math.Cos(r.Point[0]); math.Abs(r.Expectation-want) > 1e-12 {
+			t.Errorf("<ZI> at %v = %g, want %g", r.Point, r.Expectation, want)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := WriteCSV(&out, axes, results[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if want := "theta,phi,expectation\n0,0,1\n0,1,1\n"; out.String() != want {
+		t.Errorf("CSV = %q, want %q", out.String(), want)
+	}
+}
+
+func TestSources(t *testing.T) {
+	program := parse(t)
+	theta, _ := ParseAxis("theta=0,0.5")
+	phi, _ := ParseAxis("phi=-1")
+	sources, err := Sources("dir/ansatz.qasm", program, []Axis{theta, phi})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 || sources[1].Name != "dir/ansatz_1.qasm" {
+		t.Fatalf("sources = %v", sources)
+	}
+	want := `OPENQASM 3.0;
+include "stdgates.inc";
+const float theta = 0.5;
+const float phi = -1.0;
+qubit[2] q;
+`
+	if got := string(sources[1].Content); !strings.HasPrefix(got, want) {
+		t.Errorf("bound source =\n%s\nwant it to start with\n%s", got, want)
+	}
+	if len(program.Statements) != 5 {
+		t.Errorf("Bind() changed the program: %d statements", len(program.Statements))
+	}
+
+	declared, err := parser.NewParser().ParseString("OPENQASM 3.0;\nfloat theta = 1;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Bind(declared, []Axis{theta}, Point{0}); err == nil || !strings.Contains(err.Error(), "declared") {
+		t.Errorf("Bind() of a declared parameter error = %v", err)
+	}
+
+	// Input declarations give way to the bound constants
+	input, err := parser.NewParser().ParseString("OPENQASM 3.0;\ninput float theta;\ninput float phi;\nqubit q;\nrx(theta) q;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, err := Bind(input, []Axis{theta}, Point{0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "OPENQASM 3.0;\nconst float theta = 0.5;\ninput float phi;\nqubit q;\nrx(theta) q;\n"
+	if got := printer.Print(bound); got != want {
+		t.Errorf("bound input program =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,334 @@
+// Package symbols builds the symbol table of a program: the names it
+// declares, the scopes they are visible in and the places that refer to
+// them. Editors, linters and other tools embedding the parser query it by
+// name or by position instead of walking the AST themselves.
+package symbols
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// Kind classifies a symbol
+type Kind string
+
+const (
+	Qubit      Kind = "qubit"
+	Variable   Kind = "variable"
+	Constant   Kind = "constant"
+	Gate       Kind = "gate"
+	Subroutine Kind = "subroutine"
+	Parameter  Kind = "parameter"
+	Loop       Kind = "loop"
+)
+
+// Symbol is a name the program declares
+type Symbol struct {
+	Name string `json:"name"`
+	Kind Kind   `json:"kind"`
+
+	// Type is the declared type, such as qubit[2], const int[32] or angle
+	// for a gate parameter; empty for gates and subroutines
+	Type string `json:"type,omitempty"`
+
+	// Position is where the declaring statement or parameter starts
+	Position parser.Position `json:"position"`
+
+	// References are the identifiers, gate calls and function calls that
+	// refer to the symbol, in source order
+	References []parser.Node `json:"-"`
+
+	// Node is the declaring statement or parameter, and Owner the gate or
+	// subroutine a parameter belongs to
+	Node  parser.Node `json:"-"`
+	Owner parser.Node `json:"-"`
+
+	// Scope is the scope the symbol is declared in
+	Scope *Scope `json:"-"`
+}
+
+// Scope is a region of the program names can be declared in: the whole
+// program, or the body of a gate, subroutine, branch or loop. Gate and
+// subroutine parameters and loop variables belong to the scope of their
+// body.
+type Scope struct {
+	// Node is the statement opening the scope, nil for the global scope
+	Node parser.Node
+
+	// Start and End bound the scope; End is exclusive
+	Start, End parser.Position
+
+	Parent   *Scope
+	Children []*Scope
+
+	// Symbols are the names declared directly in the scope, in order
+	Symbols []*Symbol
+}
+
+// Contains reports whether pos lies within the scope
+func (s *Scope) Contains(pos parser.Position) bool {
+	return !before(pos, s.Start) && before(pos, s.End)
+}
+
+// Lookup returns the symbol name refers to in the scope: the first
+// declared with that name in it or, failing that, in the nearest scope
+// enclosing it
+func (s *Scope) Lookup(name string) (*Symbol, bool) {
+	for scope := s; scope != nil; scope = scope.Parent {
+		for _, sym := range scope.Symbols {
+			if sym.Name == name {
+				return sym, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Table is the symbol table of a program
+type Table struct {
+	// Global is the scope of the whole program
+	Global *Scope
+
+	// Symbols are all the symbols of the program in source order
+	Symbols []*Symbol
+}
+
+// Build collects the symbols of program and resolves the names it uses
+// to them. Names that resolve to no declaration, such as those of the
+// standard gates, are left out.
+func Build(program *parser.Program) *Table {
+	global := &Scope{
+		Start: parser.Position{Line: 1, Column: 1},
+		End:   parser.Position{Line: math.MaxInt, Column: math.MaxInt},
+	}
+	t := &Table{Global: global}
+	if program == nil {
+		return t
+	}
+	t.statements(program.Statements, global)
+	parser.Walk(parser.NewDepthFirstVisitor(&references{table: t}), program)
+	t.sortReferences()
+	return t
+}
+
+func (t *Table) declare(scope *Scope, sym *Symbol) {
+	sym.Scope = scope
+	sym.Position = sym.Node.Pos()
+	scope.Symbols = append(scope.Symbols, sym)
+	t.Symbols = append(t.Symbols, sym)
+}
+
+// open returns a scope for the body of node, nested in parent
+func open(parent *Scope, node parser.Node) *Scope {
+	scope := &Scope{Node: node, Start: node.Pos(), End: node.End(), Parent: parent}
+	parent.Children = append(parent.Children, scope)
+	return scope
+}
+
+func (t *Table) parameters(scope *Scope, params []parser.Parameter, kind Kind, typ string, owner parser.Node) {
+	for i := range params {
+		p := &params[i]
+		sym := &Symbol{Name: p.Name, Kind: kind, Type: p.Type, Node: p, Owner: owner}
+		if sym.Type == "" {
+			sym.Type = typ
+		}
+		t.declare(scope, sym)
+	}
+}
+
+func (t *Table) statements(statements []parser.Statement, scope *Scope) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *parser.QuantumDeclaration:
+			t.declare(scope, &Symbol{Name: s.Identifier, Kind: Qubit, Type: sized(s.Type, s.Size), Node: s})
+		case *parser.ClassicalDeclaration:
+			sym := &Symbol{Name: s.Identifier, Kind: Variable, Type: classicalType(s), Node: s}
+			if s.Const {
+				sym.Kind, sym.Type = Constant, "const "+sym.Type
+			}
+			t.declare(scope, sym)
+		case *parser.GateDefinition:
+			t.declare(scope, &Symbol{Name: s.Name, Kind: Gate, Node: s})
+			inner := open(scope, s)
+			t.parameters(inner, s.Parameters, Parameter, "angle", s)
+			t.parameters(inner, s.Qubits, Qubit, "qubit", s)
+			t.statements(s.Body, inner)
+		case *parser.SubroutineDefinition:
+			t.declare(scope, &Symbol{Name: s.Name, Kind: Subroutine, Node: s})
+			inner := open(scope, s)
+			t.parameters(inner, s.Parameters, Parameter, "", s)
+			t.statements(s.Body, inner)
+		case *parser.IfStatement:
+			inner := open(scope, s)
+			t.statements(s.ThenBody, inner)
+			t.statements(s.ElseBody, inner)
+		case *parser.ForStatement:
+			inner := open(scope, s)
+			t.declare(inner, &Symbol{Name: s.Variable, Kind: Loop, Type: s.Type, Node: s})
+			t.statements(s.Body, inner)
+		case *parser.WhileStatement:
+			t.statements(s.Body, open(scope, s))
+		}
+	}
+}
+
+// ScopeAt returns the innermost scope containing pos
+func (t *Table) ScopeAt(pos parser.Position) *Scope {
+	scope := t.Global
+	for {
+		next := scope
+		for _, child := range scope.Children {
+			if child.Contains(pos) {
+				next = child
+				break
+			}
+		}
+		if next == scope {
+			return scope
+		}
+		scope = next
+	}
+}
+
+// Lookup returns the symbol name refers to at pos, as resolved in the
+// innermost scope containing pos
+func (t *Table) Lookup(name string, pos parser.Position) (*Symbol, bool) {
+	return t.ScopeAt(pos).Lookup(name)
+}
+
+// Named returns every symbol declared with name, in source order
+func (t *Table) Named(name string) []*Symbol {
+	var out []*Symbol
+	for _, sym := range t.Symbols {
+		if sym.Name == name {
+			out = append(out, sym)
+		}
+	}
+	return out
+}
+
+// At returns the symbol declared or referred to at pos. A gate,
+// subroutine or loop counts as declared on the first line of its header,
+// before its body.
+func (t *Table) At(pos parser.Position) (*Symbol, bool) {
+	var best *Symbol
+	var bestStart, bestEnd parser.Position
+	consider := func(sym *Symbol, start, end parser.Position) {
+		if before(pos, start) || !before(pos, end) {
+			return
+		}
+		if best == nil || before(bestStart, start) || before(end, bestEnd) {
+			best, bestStart, bestEnd = sym, start, end
+		}
+	}
+	for _, sym := range t.Symbols {
+		start, end := header(sym.Node)
+		consider(sym, start, end)
+		for _, ref := range sym.References {
+			consider(sym, ref.Pos(), ref.End())
+		}
+	}
+	return best, best != nil
+}
+
+// header returns the part of a declaration that names the symbol: all of
+// it, or the part of a block statement on its first line before its body
+func header(node parser.Node) (parser.Position, parser.Position) {
+	var body []parser.Statement
+	switch n := node.(type) {
+	case *parser.GateDefinition:
+		body = n.Body
+	case *parser.SubroutineDefinition:
+		body = n.Body
+	case *parser.ForStatement:
+		body = n.Body
+	default:
+		return node.Pos(), node.End()
+	}
+	end := parser.Position{Line: node.Pos().Line + 1, Column: 1}
+	if len(body) > 0 && before(body[0].Pos(), end) {
+		end = body[0].Pos()
+	}
+	return node.Pos(), end
+}
+
+// references resolves the names the program uses
+type references struct {
+	parser.BaseVisitor
+	table *Table
+}
+
+func (r *references) add(name string, node parser.Node) {
+	if sym, ok := r.table.Lookup(name, node.Pos()); ok {
+		sym.References = append(sym.References, node)
+	}
+}
+
+func (r *references) VisitIdentifier(node *parser.Identifier) interface{} {
+	r.add(node.Name, node)
+	return nil
+}
+
+func (r *references) VisitIndexedIdentifier(node *parser.IndexedIdentifier) interface{} {
+	r.add(node.Name, node)
+	return nil
+}
+
+func (r *references) VisitRangedIdentifier(node *parser.RangedIdentifier) interface{} {
+	r.add(node.Name, node)
+	return nil
+}
+
+func (r *references) VisitGateCall(node *parser.GateCall) interface{} {
+	r.add(node.Name, node)
+	return nil
+}
+
+func (r *references) VisitFunctionCall(node *parser.FunctionCall) interface{} {
+	r.add(node.Name, node)
+	return nil
+}
+
+// sortReferences puts the references of every symbol in source order
+func (t *Table) sortReferences() {
+	for _, sym := range t.Symbols {
+		sort.SliceStable(sym.References, func(i, j int) bool {
+			return before(sym.References[i].Pos(), sym.References[j].Pos())
+		})
+	}
+}
+
+// classicalType spells the type of a classical declaration
+func classicalType(d *parser.ClassicalDeclaration) string {
+	if d.Array == nil {
+		return sized(d.Type, d.Size)
+	}
+	parts := []string{d.Array.Element}
+	for _, dim := range d.Array.Dimensions {
+		parts = append(parts, printer.Expression(dim))
+	}
+	return "array[" + strings.Join(parts, ", ") + "]"
+}
+
+// sized spells a type with its designator, such as int[32]
+func sized(typ string, size parser.Expression) string {
+	switch {
+	case size == nil:
+		return typ
+	case typ == "complex":
+		return "complex[float[" + printer.Expression(size) + "]]"
+	}
+	return typ + "[" + printer.Expression(size) + "]"
+}
+
+// before reports whether a comes before b, comparing lines then columns
+func before(a, b parser.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
@@ -0,0 +1,109 @@
+package symbols
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+const source = `OPENQASM 3.0;
+include "stdgates.inc";
+qubit[2] q;
+const int n = 2;
+bit[n] c;
+gate rzz(theta) a, b {
+  cx a, b;
+  rz(theta) b;
+}
+def flip(qubit r, int[8] k) -> bit {
+  x r;
+}
+for uint i in [0:n - 1] {
+  rzz(0.1) q[i], q[1];
+}
+c[0] = flip(q[0], n);
+`
+
+func build(t *testing.T) *Table {
+	t.Helper()
+	program, err := parser.NewParser().ParseString(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Build(program)
+}
+
+func TestBuild(t *testing.T) {
+	table := build(t)
+	var got []string
+	for _, sym := range table.Symbols {
+		got = append(got, sym.Name+":"+string(sym.Kind)+":"+sym.Type)
+	}
+	want := "q:qubit:qubit[2] n:constant:const int c:variable:bit[n] rzz:gate: theta:parameter:angle a:qubit:qubit b:qubit:qubit " +
+		"flip:subroutine: r:parameter:qubit k:parameter:int[8] i:loop:uint"
+	if strings.Join(got, " ") != want {
+		t.Errorf("symbols = %s\nwant %s", strings.Join(got, " "), want)
+	}
+
+	q := table.Named("q")[0]
+	if q.Position != (parser.Position{Line: 3, Column: 1, Offset: 38}) || q.Scope != table.Global {
+		t.Errorf("q declared at %+v in %p", q.Position, q.Scope)
+	}
+	var lines []int
+	for _, ref := range q.References {
+		lines = append(lines, ref.Pos().Line)
+	}
+	if len(lines) != 3 || lines[0] != 14 || lines[1] != 14 || lines[2] != 16 {
+		t.Errorf("q referenced on lines %v", lines)
+	}
+	if n := table.Named("n")[0]; len(n.References) != 3 {
+		t.Errorf("n has %d references", len(n.References))
+	}
+	if rzz := table.Named("rzz")[0]; len(rzz.References) != 1 || rzz.References[0].Pos().Line != 14 {
+		t.Errorf("rzz references = %v", rzz.References)
+	}
+	if cx := table.Named("cx"); len(cx) != 0 {
+		t.Errorf("standard gate cx has symbols %v", cx)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	table := build(t)
+
+	// Inside the gate, b is its argument; outside it is undeclared
+	b, ok := table.Lookup("b", parser.Position{Line: 7, Column: 9})
+	if !ok || b.Kind != Qubit || b.Owner.(*parser.GateDefinition).Name != "rzz" {
+		t.Errorf("b in rzz = %+v, %v", b, ok)
+	}
+	if _, ok := table.Lookup("b", parser.Position{Line: 14, Column: 3}); ok {
+		t.Error("b resolved outside rzz")
+	}
+	if scope := table.ScopeAt(parser.Position{Line: 14, Column: 3}); scope.Node.(*parser.ForStatement).Variable != "i" || scope.Parent != table.Global {
+		t.Errorf("scope on line 14 = %+v", scope)
+	}
+	if i, ok := table.Lookup("i", parser.Position{Line: 14, Column: 14}); !ok || i.Kind != Loop {
+		t.Errorf("i = %+v, %v", i, ok)
+	}
+
+	tests := []struct {
+		line, column int
+		want         string
+	}{
+		{3, 10, "q"},  // declaration
+		{14, 12, "q"}, // reference
+		{14, 14, "i"}, // index inside a reference
+		{6, 7, "rzz"}, // gate header
+		{8, 6, "theta"},
+		{16, 10, "flip"},
+	}
+	for _, tt := range tests {
+		sym, ok := table.At(parser.Position{Line: tt.line, Column: tt.column})
+		if !ok || sym.Name != tt.want {
+			t.Errorf("At(%d:%d) = %+v, want %s", tt.line, tt.column, sym, tt.want)
+		}
+	}
+	if sym, ok := table.At(parser.Position{Line: 7, Column: 1}); ok {
+		t.Errorf("At() in a gate body's indentation = %s", sym.Name)
+	}
+}
@@ -0,0 +1,242 @@
+// Package synth generates circuits that realize a given effect on a
+// device, for routers and for users writing their own mappers.
+package synth
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/orangekame3/qasmparser/estimate"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// Permutation returns swap gates on hardware qubits that move the state
+// of device qubit i to device qubit perm[i], swapping only pairs the
+// coupling map connects. A nil coupling map connects every pair. See
+// Swaps for how the network is found.
+func Permutation(perm []int, coupling estimate.CouplingMap) ([]parser.Statement, error) {
+	swaps, err := Swaps(perm, coupling)
+	if err != nil {
+		return nil, err
+	}
+	statements := make([]parser.Statement, len(swaps))
+	for i, s := range swaps {
+		statements[i] = &parser.GateCall{Name: "swap", Qubits: []parser.Expression{
+			&parser.Identifier{Name: "$" + strconv.Itoa(s[0])},
+			&parser.Identifier{Name: "$" + strconv.Itoa(s[1])},
+		}}
+	}
+	return statements, nil
+}
+
+// Swaps returns the pairs of device qubits to swap, in order, to move
+// the state of qubit i to qubit perm[i]. Qubits the permutation does not
+// name stay where they are and may be swapped through.
+//
+// Without a coupling map each cycle of the permutation takes one swap
+// fewer than its length, which is the fewest possible. On a coupling
+// map, swaps that bring both of their states closer to their
+// destinations are made first; the remaining states are then routed
+// along a spanning tree, filling its leaves one at a time, which always
+// finishes in at most n(n-1)/2 swaps. Moving a state between qubits the
+// coupling map does not connect is an error.
+func Swaps(perm []int, coupling estimate.CouplingMap) ([][2]int, error) {
+	n := len(perm)
+	seen := make([]bool, n)
+	for _, p := range perm {
+		if p < 0 || p >= n || seen[p] {
+			return nil, fmt.Errorf("%v is not a permutation of 0..%d", perm, n-1)
+		}
+		seen[p] = true
+	}
+	if coupling == nil {
+		return cycles(perm), nil
+	}
+
+	r := newRouter(perm, coupling)
+	for i, p := range perm {
+		if r.dist[i][p] < 0 {
+			return nil, fmt.Errorf("qubits %d and %d are not connected", i, p)
+		}
+	}
+	r.happy()
+	r.leaves()
+	return r.swaps, nil
+}
+
+// cycles realizes perm with all pairs connected: each cycle i, perm[i],
+// perm[perm[i]], ... is closed by swapping its first qubit with each of
+// the others in turn
+func cycles(perm []int) [][2]int {
+	var swaps [][2]int
+	done := make([]bool, len(perm))
+	for start := range perm {
+		if done[start] {
+			continue
+		}
+		cycle := []int{start}
+		done[start] = true
+		for q := perm[start]; q != start; q = perm[q] {
+			cycle = append(cycle, q)
+			done[q] = true
+		}
+		for _, q := range cycle[1:] {
+			swaps = append(swaps, [2]int{cycle[0], q})
+		}
+	}
+	return swaps
+}
+
+// router moves tokens, the states to permute, over the coupling graph.
+// token[q] is the destination of the state on qubit q.
+type router struct {
+	adj   [][]int
+	dist  [][]int
+	token []int
+	swaps [][2]int
+}
+
+func newRouter(perm []int, coupling estimate.CouplingMap) *router {
+	n := len(perm)
+	for _, pair := range coupling {
+		n = max(n, pair[0]+1, pair[1]+1)
+	}
+	r := &router{adj: make([][]int, n), token: make([]int, n)}
+	for _, pair := range coupling {
+		if pair[0] != pair[1] {
+			r.adj[pair[0]] = append(r.adj[pair[0]], pair[1])
+			r.adj[pair[1]] = append(r.adj[pair[1]], pair[0])
+		}
+	}
+	for q := range r.token {
+		r.token[q] = q
+		if q < len(perm) {
+			r.token[q] = perm[q]
+		}
+	}
+	r.dist = make([][]int, n)
+	for q := range n {
+		r.dist[q] = r.bfs(q)
+	}
+	return r
+}
+
+// bfs returns the distance of every qubit from q, -1 if unreachable
+func (r *router) bfs(q int) []int {
+	dist := make([]int, len(r.adj))
+	for i := range dist {
+		dist[i] = -1
+	}
+	dist[q] = 0
+	queue := []int{q}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range r.adj[cur] {
+			if dist[next] < 0 {
+				dist[next] = dist[cur] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+	return dist
+}
+
+func (r *router) swap(a, b int) {
+	r.token[a], r.token[b] = r.token[b], r.token[a]
+	r.swaps = append(r.swaps, [2]int{a, b})
+}
+
+// happy makes every swap that moves both of its tokens closer to their
+// destinations, until none is left
+func (r *router) happy() {
+	for found := true; found; {
+		found = false
+		for a := range r.adj {
+			for _, b := range r.adj[a] {
+				ta, tb := r.token[a], r.token[b]
+				if a < b && r.dist[ta][b] < r.dist[ta][a] && r.dist[tb][a] < r.dist[tb][b] {
+					r.swap(a, b)
+					found = true
+				}
+			}
+		}
+	}
+}
+
+// leaves routes the remaining tokens over a spanning tree of each
+// connected component. Taken in reverse breadth-first order, each node
+// is a leaf of the tree left once the nodes after it are done: the token
+// bound for it is moved there along the tree, which never passes through
+// the nodes already done, since they are not ancestors of either end.
+func (r *router) leaves() {
+	n := len(r.adj)
+	parent := make([]int, n)
+	visited := make([]bool, n)
+	var order []int
+	for root := range n {
+		if visited[root] {
+			continue
+		}
+		visited[root] = true
+		parent[root] = -1
+		queue := []int{root}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			order = append(order, cur)
+			for _, next := range r.adj[cur] {
+				if !visited[next] {
+					visited[next] = true
+					parent[next] = cur
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		leaf := order[i]
+		from := 0
+		for q := range r.token {
+			if r.token[q] == leaf {
+				from = q
+			}
+		}
+		path := treePath(parent, from, leaf)
+		for j := 0; j+1 < len(path); j++ {
+			r.swap(path[j], path[j+1])
+		}
+	}
+}
+
+// treePath returns the path from a to b in the tree parent describes
+func treePath(parent []int, a, b int) []int {
+	depth := func(q int) int {
+		d := 0
+		for ; parent[q] >= 0; q = parent[q] {
+			d++
+		}
+		return d
+	}
+	var up, down []int
+	da, db := depth(a), depth(b)
+	for ; da > db; da-- {
+		up = append(up, a)
+		a = parent[a]
+	}
+	for ; db > da; db-- {
+		down = append(down, b)
+		b = parent[b]
+	}
+	for a != b {
+		up = append(up, a)
+		down = append(down, b)
+		a, b = parent[a], parent[b]
+	}
+	up = append(up, a)
+	for i := len(down) - 1; i >= 0; i-- {
+		up = append(up, down[i])
+	}
+	return up
+}
@@ -0,0 +1,112 @@
+package synth
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/estimate"
+	"github.com/orangekame3/qasmparser/printer"
+)
+
+// apply returns where the state of each qubit ends up after swaps
+func apply(n int, swaps [][2]int) []int {
+	at := make([]int, n) // at[q] is the qubit whose state is on q
+	for q := range at {
+		at[q] = q
+	}
+	for _, s := range swaps {
+		at[s[0]], at[s[1]] = at[s[1]], at[s[0]]
+	}
+	moved := make([]int, n)
+	for q, state := range at {
+		moved[state] = q
+	}
+	return moved
+}
+
+func TestSwaps(t *testing.T) {
+	line := estimate.CouplingMap{{0, 1}, {1, 2}, {2, 3}, {3, 4}}
+	grid := estimate.CouplingMap{{0, 1}, {1, 2}, {3, 4}, {4, 5}, {0, 3}, {1, 4}, {2, 5}}
+	tests := []struct {
+		name     string
+		perm     []int
+		coupling estimate.CouplingMap
+		swaps    int
+	}{
+		{"identity", []int{0, 1, 2}, line, 0},
+		{"all to all cycle", []int{1, 2, 3, 0}, nil, 3},
+		{"all to all transpositions", []int{1, 0, 3, 2}, nil, 2},
+		{"adjacent", []int{1, 0, 2, 3, 4}, line, 1},
+		{"reverse line", []int{4, 3, 2, 1, 0}, line, 10},
+		{"shift line", []int{1, 2, 3, 4, 0}, line, 4},
+		{"grid", []int{5, 4, 3, 2, 1, 0}, grid, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			swaps, err := Swaps(tt.perm, tt.coupling)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range swaps {
+				if tt.coupling != nil && !tt.coupling.Connected(s[0], s[1]) {
+					t.Errorf("swap %v is not coupled", s)
+				}
+			}
+			n := len(tt.perm)
+			for _, pair := range tt.coupling {
+				n = max(n, pair[0]+1, pair[1]+1)
+			}
+			moved := apply(n, swaps)
+			for i, p := range tt.perm {
+				if moved[i] != p {
+					t.Fatalf("swaps %v move %d to %d, want %d", swaps, i, moved[i], p)
+				}
+			}
+			if tt.swaps > 0 && len(swaps) != tt.swaps {
+				t.Errorf("got %d swaps %v, want %d", len(swaps), swaps, tt.swaps)
+			}
+		})
+	}
+}
+
+func TestSwapsRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ring := estimate.CouplingMap{{0, 1}, {1, 2}, {2, 3}, {3, 4}, {4, 5}, {5, 6}, {6, 7}, {7, 0}, {2, 6}}
+	for range 200 {
+		perm := rng.Perm(8)
+		swaps, err := Swaps(perm, ring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(swaps) > 8*7/2 {
+			t.Errorf("%v took %d swaps", perm, len(swaps))
+		}
+		moved := apply(8, swaps)
+		for i, p := range perm {
+			if moved[i] != p {
+				t.Fatalf("%v: swaps %v move %d to %d", perm, swaps, i, moved[i])
+			}
+		}
+	}
+}
+
+func TestPermutation(t *testing.T) {
+	statements, err := Permutation([]int{2, 0, 1}, estimate.CouplingMap{{0, 1}, {1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	for _, stmt := range statements {
+		got += printer.Statement(stmt) + "\n"
+	}
+	if got != "swap $0, $1;\nswap $1, $2;\n" {
+		t.Errorf("got:\n%s", got)
+	}
+
+	if _, err := Swaps([]int{0, 0}, nil); err == nil || err.Error() != "[0 0] is not a permutation of 0..1" {
+		t.Errorf("Swaps() = %v", err)
+	}
+	if _, err := Swaps([]int{1, 0, 2}, estimate.CouplingMap{{1, 2}}); err == nil || err.Error() != "qubits 0 and 1 are not connected" {
+		t.Errorf("Swaps() = %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package synth
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/cmplx"
+
+	"github.com/orangekame3/qasmparser/builder"
+	"github.com/orangekame3/qasmparser/parser"
+)
+
+// normTolerance bounds how far from 1 the norm of a state may be
+const normTolerance = 1e-9
+
+// angleTolerance is the rotation angle below which a rotation is left out
+const angleTolerance = 1e-12
+
+// State returns gates preparing the state with the given amplitudes from
+// |0...0⟩ on qubits, up to global phase. Amplitude i is that of the basis
+// state whose bits, most significant first, are the values of qubits in
+// order; there must be 2^len(qubits) of them and their norm must be 1.
+//
+// The circuit is the one of Möttönen et al.: ry rotations controlled by
+// the qubits before them set the magnitudes one qubit at a time, and rz
+// rotations set the relative phases, each uniformly controlled rotation
+// written with rotations and cx gates along a Gray code. Rotations by
+// zero are left out, so basis states and product states take few gates.
+func State(amplitudes []complex128, qubits []parser.Expression) ([]parser.Statement, error) {
+	n := len(qubits)
+	if len(amplitudes) != 1<<n || n == 0 {
+		return nil, fmt.Errorf("%d amplitudes for %d qubits, want %d", len(amplitudes), n, 1<<n)
+	}
+	var sum float64
+	for _, a := range amplitudes {
+		sum += real(a)*real(a) + imag(a)*imag(a)
+	}
+	if math.Abs(math.Sqrt(sum)-1) > normTolerance {
+		return nil, fmt.Errorf("amplitudes have norm %g, not 1", math.Sqrt(sum))
+	}
+
+	p := &preparation{qubits: qubits}
+	// Magnitudes: qubit k is rotated by the split of the weight of each
+	// assignment of the qubits before it between its two values
+	magnitudes := make([]float64, len(amplitudes))
+	for i, a := range amplitudes {
+		magnitudes[i] = cmplx.Abs(a)
+	}
+	for k := range n {
+		block := 1 << (n - k) // amplitudes sharing the first k bits
+		angles := make([]float64, 1<<k)
+		// Assignments of no weight may take any angle; they take the
+		// angle of one that has weight, which saves the controls when
+		// the others all agree
+		var empty []int
+		known := 0.0
+		for prefix := range angles {
+			var w0, w1 float64
+			for i := range block / 2 {
+				w0 += magnitudes[prefix*block+i] * magnitudes[prefix*block+i]
+				w1 += magnitudes[prefix*block+block/2+i] * magnitudes[prefix*block+block/2+i]
+			}
+			if w0+w1 == 0 {
+				empty = append(empty, prefix)
+				continue
+			}
+			angles[prefix] = 2 * math.Atan2(math.Sqrt(w1), math.Sqrt(w0))
+			known = angles[prefix]
+		}
+		for _, prefix := range empty {
+			angles[prefix] = known
+		}
+		if err := p.multiplexed("ry", angles, k); err != nil {
+			return nil, err
+		}
+	}
+
+	// Phases: the diagonal diag(e^{iφ_x}) splits into an rz on the last
+	// qubit controlled by the others and a diagonal on the others, which
+	// is split the same way, down to a global phase
+	phases := make([]float64, len(amplitudes))
+	for i, a := range amplitudes {
+		phases[i] = cmplx.Phase(a)
+	}
+	for k := n - 1; k >= 0; k-- {
+		angles := make([]float64, len(phases)/2)
+		rest := make([]float64, len(phases)/2)
+		for prefix := range angles {
+			angles[prefix] = phases[2*prefix+1] - phases[2*prefix]
+			rest[prefix] = (phases[2*prefix] + phases[2*prefix+1]) / 2
+		}
+		if err := p.multiplexed("rz", angles, k); err != nil {
+			return nil, err
+		}
+		phases = rest
+	}
+	return p.statements, nil
+}
+
+// Initialize is State for qubits in any state: it resets them first, as
+// an init statement would
+func Initialize(amplitudes []complex128, qubits []parser.Expression) ([]parser.Statement, error) {
+	prep, err := State(amplitudes, qubits)
+	if err != nil {
+		return nil, err
+	}
+	statements := make([]parser.Statement, 0, len(qubits)+len(prep))
+	for _, q := range qubits {
+		stmt, err := builder.QuasiQuote("reset %v;", q)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, stmt)
+	}
+	return append(statements, prep...), nil
+}
+
+type preparation struct {
+	qubits     []parser.Expression
+	statements []parser.Statement
+}
+
+// multiplexed appends a rotation of qubit target by angles[c], where c
+// is the value of the qubits before it, first most significant. It is
+// written as rotations by the Walsh transform of the angles along the
+// Gray code, each followed by a cx from the control whose bit changes
+// next.
+func (p *preparation) multiplexed(gate string, angles []float64, target int) error {
+	k := bits.Len(uint(len(angles))) - 1
+	alphas := make([]float64, len(angles))
+	uniform := true
+	for i := range alphas {
+		g := i ^ i>>1
+		for j, theta := range angles {
+			sign := 1.0
+			if bits.OnesCount(uint(j&g))%2 == 1 {
+				sign = -1
+			}
+			alphas[i] += sign * theta
+		}
+		alphas[i] /= float64(len(angles))
+		if i > 0 && math.Abs(alphas[i]) > angleTolerance {
+			uniform = false
+		}
+	}
+	if uniform {
+		// Without controls the cx gates cancel
+		return p.rotation(gate, alphas[0], target)
+	}
+	for i, alpha := range alphas {
+		if err := p.rotation(gate, alpha, target); err != nil {
+			return err
+		}
+		// The bit of the Gray code that changes from i to i+1, wrapping
+		// around to the most significant one
+		bit := k - 1
+		if i+1 < len(alphas) {
+			bit = bits.TrailingZeros(uint(i + 1))
+		}
+		stmt, err := builder.QuasiQuote("cx %v, %v;", p.qubits[target-1-bit], p.qubits[target])
+		if err != nil {
+			return err
+		}
+		p.statements = append(p.statements, stmt)
+	}
+	return nil
+}
+
+func (p *preparation) rotation(gate string, angle float64, target int) error {
+	if math.Abs(angle) <= angleTolerance {
+		return nil
+	}
+	stmt, err := builder.QuasiQuote(gate+"(%f) %v;", angle, p.qubits[target])
+	if err != nil {
+		return err
+	}
+	p.statements = append(p.statements, stmt)
+	return nil
+}
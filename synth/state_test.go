@@ -0,0 +1,130 @@
+package synth
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/orangekame3/qasmparser/parser"
+	"github.com/orangekame3/qasmparser/printer"
+	"github.com/orangekame3/qasmparser/sim"
+)
+
+// prepared returns the state the statements prepare on qubit[n] q from
+// |0...0⟩
+func prepared(t *testing.T, n int, statements []parser.Statement) []complex128 {
+	t.Helper()
+	src := "OPENQASM 3.0;\ninclude \"stdgates.inc\";\nqubit[" + strconv.Itoa(n) + "] q;\n"
+	for _, stmt := range statements {
+		src += printer.Statement(stmt) + "\n"
+	}
+	program, err := parser.NewParser().ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _, err := sim.Unitary(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := make([]complex128, 1<<n)
+	for i := range state {
+		state[i] = u[i][0]
+	}
+	return state
+}
+
+func register(n int) []parser.Expression {
+	qubits := make([]parser.Expression, n)
+	for i := range qubits {
+		qubits[i] = &parser.IndexedIdentifier{Name: "q", Index: &parser.IntegerLiteral{Value: int64(i)}}
+	}
+	return qubits
+}
+
+// distance returns how far apart two states are, up to global phase
+func distance(a, b []complex128) float64 {
+	ma, mb := make(sim.Matrix, len(a)), make(sim.Matrix, len(b))
+	for i := range a {
+		ma[i], mb[i] = []complex128{a[i]}, []complex128{b[i]}
+	}
+	return sim.Distance(ma, mb)
+}
+
+func TestState(t *testing.T) {
+	s := complex(1/math.Sqrt2, 0)
+	w := complex(1/math.Sqrt(3), 0)
+	tests := []struct {
+		name  string
+		amps  []complex128
+		gates int
+	}{
+		{"basis state", []complex128{0, 0, 0, 1}, 2},
+		{"bell", []complex128{s, 0, 0, s}, 5},
+		{"plus minus", []complex128{0.5, -0.5, 0.5, -0.5}, 0},
+		{"phases", []complex128{s, 1i * s}, 2},
+		{"w", []complex128{0, w, w, 0, w, 0, 0, 0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := len(strconv.FormatInt(int64(len(tt.amps)-1), 2))
+			statements, err := State(tt.amps, register(n))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := distance(prepared(t, n, statements), tt.amps); d > 1e-9 {
+				t.Errorf("prepared state is %g off", d)
+			}
+			if tt.gates > 0 && len(statements) != tt.gates {
+				t.Errorf("got %d gates, want %d", len(statements), tt.gates)
+			}
+		})
+	}
+}
+
+func TestStateRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for n := 1; n <= 4; n++ {
+		for range 10 {
+			amps := make([]complex128, 1<<n)
+			var sum float64
+			for i := range amps {
+				amps[i] = complex(rng.NormFloat64(), rng.NormFloat64())
+				sum += real(amps[i] * cmplx.Conj(amps[i]))
+			}
+			for i := range amps {
+				amps[i] /= complex(math.Sqrt(sum), 0)
+			}
+			statements, err := State(amps, register(n))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := distance(prepared(t, n, statements), amps); d > 1e-9 {
+				t.Fatalf("%d qubits: prepared state is %g off", n, d)
+			}
+		}
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	statements, err := Initialize([]complex128{0, 1}, register(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, stmt := range statements {
+		got = append(got, printer.Statement(stmt))
+	}
+	if want := "reset q[0];\nry(3.141592653589793) q[0];"; strings.Join(got, "\n") != want {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), want)
+	}
+
+	if _, err := State([]complex128{1, 0, 0}, register(2)); err == nil {
+		t.Error("3 amplitudes accepted for 2 qubits")
+	}
+	if _, err := State([]complex128{1, 1}, register(1)); err == nil || err.Error() != "amplitudes have norm 1.4142135623730951, not 1" {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+// Package units holds QASM durations exactly. A duration literal such as
+// 100ns or 1.5us is kept as a rational amount of its unit, so durations
+// in different units add and compare without the rounding of floats:
+// 100ns plus 0.2us is 300ns, not 300.00000000000006ns.
+//
+// Durations in dt, the sample time of a backend, convert to other units
+// only given the length of dt.
+package units
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Unit is a unit of time of QASM duration literals
+type Unit string
+
+const (
+	Nanosecond  Unit = "ns"
+	Microsecond Unit = "us"
+	Millisecond Unit = "ms"
+	Second      Unit = "s"
+
+	// DT is the sample time of a backend, whose length depends on it
+	DT Unit = "dt"
+)
+
+// siUnits are the SI units, smallest first, with their length in
+// nanoseconds
+var siUnits = []struct {
+	unit Unit
+	ns   int64
+}{
+	{Nanosecond, 1},
+	{Microsecond, 1e3},
+	{Millisecond, 1e6},
+	{Second, 1e9},
+}
+
+// nanoseconds returns the length of an SI unit in nanoseconds, or nil for
+// dt and unknown units
+func (u Unit) nanoseconds() *big.Rat {
+	for _, s := range siUnits {
+		if s.unit == u {
+			return big.NewRat(s.ns, 1)
+		}
+	}
+	return nil
+}
+
+// ParseUnit reads a unit as QASM spells it. µs is read as us.
+func ParseUnit(s string) (Unit, error) {
+	switch u := Unit(s); u {
+	case Nanosecond, Microsecond, Millisecond, Second, DT:
+		return u, nil
+	case "µs":
+		return Microsecond, nil
+	}
+	return "", fmt.Errorf("unknown time unit %q (want dt, ns, us, µs, ms or s)", s)
+}
+
+// Duration is an exact, non-negative amount of a unit of time. The zero
+// Duration is zero nanoseconds.
+type Duration struct {
+	amount *big.Rat // nil means zero
+	unit   Unit
+}
+
+// New returns amount of unit. It panics if unit is not a Unit.
+func New(amount *big.Rat, unit Unit) Duration {
+	if _, err := ParseUnit(string(unit)); err != nil {
+		panic(err)
+	}
+	return Duration{amount: new(big.Rat).Set(amount), unit: unit}
+}
+
+// decimal matches the numbers of duration literals, without underscores
+var decimal = regexp.MustCompile(`^(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?$`)
+
+// ParseDuration reads a QASM duration literal such as "100ns", "1.5 us"
+// or "2_000dt": a decimal number, with underscores between digits and an
+// optional exponent, then its unit
+func ParseDuration(s string) (Duration, error) {
+	text := strings.TrimSpace(s)
+	// Units are tried longest first, so that 5ms is not read as 5m
+	// seconds
+	for _, spelling := range []string{"ns", "us", "µs", "ms", "dt", "s"} {
+		number, ok := strings.CutSuffix(text, spelling)
+		if !ok {
+			continue
+		}
+		number = strings.ReplaceAll(strings.TrimRight(number, " \t"), "_", "")
+		if !decimal.MatchString(number) {
+			break
+		}
+		amount, _ := new(big.Rat).SetString(number)
+		unit, _ := ParseUnit(spelling)
+		return Duration{amount: amount, unit: unit}, nil
+	}
+	return Duration{}, fmt.Errorf("duration %q is not a number followed by one of dt, ns, us, µs, ms, s", s)
+}
+
+// Amount returns the amount of the duration's unit
+func (d Duration) Amount() *big.Rat {
+	if d.amount == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Set(d.amount)
+}
+
+// Unit returns the duration's unit
+func (d Duration) Unit() Unit {
+	if d.unit == "" {
+		return Nanosecond
+	}
+	return d.unit
+}
+
+// Float returns the amount of the duration's unit as the nearest float
+func (d Duration) Float() float64 {
+	f, _ := d.Amount().Float64()
+	return f
+}
+
+// IsZero reports whether d is no time at all
+func (d Duration) IsZero() bool {
+	return d.amount == nil || d.amount.Sign() == 0
+}
+
+// Convert returns d in unit. dt is the length of one dt, used between dt
+// and the SI units; it is an error to need it when it is zero or itself
+// in dt.
+func (d Duration) Convert(unit Unit, dt Duration) (Duration, error) {
+	if _, err := ParseUnit(string(unit)); err != nil {
+		return Duration{}, err
+	}
+	from := d.Unit()
+	if from == unit {
+		return d, nil
+	}
+	amount := d.Amount()
+	if from == DT || unit == DT {
+		if dt.IsZero() || dt.Unit() == DT {
+			return Duration{}, fmt.Errorf("converting %s to %s needs the length of dt", d, unit)
+		}
+		length := dt.Amount()
+		length.Mul(length, dt.Unit().nanoseconds())
+		if from == DT {
+			amount.Mul(amount, length)
+			from = Nanosecond
+		} else {
+			amount.Mul(amount, from.nanoseconds())
+			return Duration{amount: amount.Quo(amount, length), unit: DT}, nil
+		}
+	}
+	amount.Mul(amount, from.nanoseconds())
+	return Duration{amount: amount.Quo(amount, unit.nanoseconds()), unit: unit}, nil
+}
+
+// common returns d and e in one unit: the smaller of two SI units, or dt
+// when both are in dt; mixing dt with SI units converts dt with dt
+func common(d, e, dt Duration) (Duration, Duration, error) {
+	unit := d.Unit()
+	switch {
+	case unit == e.Unit():
+		return d, e, nil
+	case unit == DT || e.Unit() == DT:
+		unit = Nanosecond
+	case e.Unit().nanoseconds().Cmp(unit.nanoseconds()) < 0:
+		unit = e.Unit()
+	}
+	d, err := d.Convert(unit, dt)
+	if err != nil {
+		return Duration{}, Duration{}, err
+	}
+	e, err = e.Convert(unit, dt)
+	if err != nil {
+		return Duration{}, Duration{}, err
+	}
+	return d, e, nil
+}
+
+// Add returns d plus e, in the smaller of their units. dt is the length
+// of one dt, needed only to add dt to SI units, in which case the sum is
+// in nanoseconds.
+func (d Duration) Add(e, dt Duration) (Duration, error) {
+	d, e, err := common(d, e, dt)
+	if err != nil {
+		return Duration{}, err
+	}
+	amount := d.Amount()
+	return Duration{amount: amount.Add(amount, e.Amount()), unit: d.Unit()}, nil
+}
+
+// Compare returns -1, 0 or +1 as d is shorter than, as long as or longer
+// than e. dt is as for Add.
+func (d Duration) Compare(e, dt Duration) (int, error) {
+	d, e, err := common(d, e, dt)
+	if err != nil {
+		return 0, err
+	}
+	return d.Amount().Cmp(e.Amount()), nil
+}
+
+// Normalize returns d in the largest SI unit of which it is at least one,
+// so 1500ns becomes 1.5us and 0.002s becomes 2ms. Durations in dt and of
+// zero are returned as they are.
+func (d Duration) Normalize() Duration {
+	if d.Unit() == DT || d.IsZero() {
+		return d
+	}
+	best, _ := d.Convert(Nanosecond, Duration{})
+	for _, s := range siUnits[1:] {
+		c, _ := d.Convert(s.unit, Duration{})
+		if c.amount.Cmp(big.NewRat(1, 1)) < 0 {
+			break
+		}
+		best = c
+	}
+	return best
+}
+
+// String writes d as a QASM duration literal, such as 1.5us. An amount
+// with no exact decimal, such as a third of a nanosecond, is rounded to
+// nine decimal places.
+func (d Duration) String() string {
+	amount := d.Amount()
+	digits, exact := decimals(amount)
+	if !exact {
+		digits = 9
+	}
+	s := amount.FloatString(digits)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s + string(d.Unit())
+}
+
+// decimals returns how many decimal places write r exactly, reporting
+// false if none do
+func decimals(r *big.Rat) (int, bool) {
+	denom := new(big.Int).Set(r.Denom())
+	two, five := big.NewInt(2), big.NewInt(5)
+	var twos, fives int
+	mod := new(big.Int)
+	for mod.Mod(denom, two).Sign() == 0 {
+		denom.Quo(denom, two)
+		twos++
+	}
+	for mod.Mod(denom, five).Sign() == 0 {
+		denom.Quo(denom, five)
+		fives++
+	}
+	return max(twos, fives), denom.Cmp(big.NewInt(1)) == 0
+}
@@ -0,0 +1,98 @@
+package units
+
+import (
+	"math/big"
+	"testing"
+)
+
+func parse(t *testing.T, s string) Duration {
+	t.Helper()
+	d, err := ParseDuration(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in, want string
+		unit     Unit
+	}{
+		{"100ns", "100ns", Nanosecond},
+		{"1.5 us", "1.5us", Microsecond},
+		{"2µs", "2us", Microsecond},
+		{"5ms", "5ms", Millisecond},
+		{"0.25s", "0.25s", Second},
+		{"2_000dt", "2000dt", DT},
+		{"1e-3s", "0.001s", Second},
+		{".5ns", "0.5ns", Nanosecond},
+	}
+	for _, tt := range tests {
+		d := parse(t, tt.in)
+		if d.String() != tt.want || d.Unit() != tt.unit {
+			t.Errorf("ParseDuration(%q) = %s in %s", tt.in, d, d.Unit())
+		}
+	}
+	for _, bad := range []string{"", "ns", "10", "-5ns", "1/3ns", "0x10ns", "10 m", "10min"} {
+		if d, err := ParseDuration(bad); err == nil {
+			t.Errorf("ParseDuration(%q) = %s", bad, d)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	sum, err := parse(t, "100ns").Add(parse(t, "0.2us"), Duration{})
+	if err != nil || sum.String() != "300ns" {
+		t.Errorf("100ns + 0.2us = %s, %v", sum, err)
+	}
+	if c, err := parse(t, "1000ns").Compare(parse(t, "1us"), Duration{}); err != nil || c != 0 {
+		t.Errorf("1000ns vs 1us = %d, %v", c, err)
+	}
+	if c, err := parse(t, "0.3s").Compare(parse(t, "299999999.999ns"), Duration{}); err != nil || c != 1 {
+		t.Errorf("0.3s vs 299999999.999ns = %d, %v", c, err)
+	}
+
+	// dt converts only when its length is known
+	if _, err := parse(t, "10dt").Add(parse(t, "1ns"), Duration{}); err == nil {
+		t.Error("added dt to ns without the length of dt")
+	}
+	dt := parse(t, "0.222ns")
+	sum, err = parse(t, "10dt").Add(parse(t, "1ns"), dt)
+	if err != nil || sum.String() != "3.22ns" {
+		t.Errorf("10dt + 1ns = %s, %v", sum, err)
+	}
+	sum, err = parse(t, "10dt").Add(parse(t, "5dt"), Duration{})
+	if err != nil || sum.String() != "15dt" {
+		t.Errorf("10dt + 5dt = %s, %v", sum, err)
+	}
+	samples, err := parse(t, "1us").Convert(DT, dt)
+	if err != nil || samples.String() != "4504.504504505dt" {
+		t.Errorf("1us = %s, %v", samples, err)
+	}
+	if back, _ := samples.Convert(Microsecond, dt); back.String() != "1us" {
+		t.Errorf("round trip through dt = %s", back)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"1500ns": "1.5us",
+		"0.002s": "2ms",
+		"999ns":  "999ns",
+		"0.5ns":  "0.5ns",
+		"120dt":  "120dt",
+		"0s":     "0s",
+	}
+	for in, want := range tests {
+		if got := parse(t, in).Normalize().String(); got != want {
+			t.Errorf("Normalize(%s) = %s, want %s", in, got, want)
+		}
+	}
+	if got := New(big.NewRat(1, 3), Nanosecond).String(); got != "0.333333333ns" {
+		t.Errorf("a third of a nanosecond = %s", got)
+	}
+	if got := (Duration{}).String(); got != "0ns" {
+		t.Errorf("zero Duration = %s", got)
+	}
+}